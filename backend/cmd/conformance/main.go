@@ -0,0 +1,104 @@
+// Command conformance checks a running registry against the module and provider
+// registry protocols, following the requests terraform init makes.
+//
+//	go run ./cmd/conformance -url http://localhost:9080 -token $API_KEY \
+//	    -module myorg/vpc/aws -provider myorg/example@1.2.0 -platform linux_amd64
+//
+// It exits with status 1 when a flow fails.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"iac-tool/internal/conformance"
+)
+
+// listFlag collects a repeatable flag
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ",") }
+func (l *listFlag) Set(v string) error { *l = append(*l, v); return nil }
+
+func main() {
+	var modules, providers, platforms listFlag
+	baseURL := flag.String("url", envOr("REGISTRY_URL", "http://localhost:9080"), "registry base URL (REGISTRY_URL)")
+	token := flag.String("token", os.Getenv("REGISTRY_TOKEN"), "API key for private namespaces (REGISTRY_TOKEN)")
+	asJSON := flag.Bool("json", false, "print the reports as JSON")
+	flag.Var(&modules, "module", "module to check as namespace/name/provider[@version] (repeatable)")
+	flag.Var(&providers, "provider", "provider to check as namespace/name[@version] (repeatable)")
+	flag.Var(&platforms, "platform", "provider platform as os_arch (repeatable, default linux_amd64)")
+	flag.Parse()
+
+	if len(modules) == 0 && len(providers) == 0 {
+		fmt.Fprintln(os.Stderr, "conformance: nothing to check; pass -module and/or -provider")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if len(platforms) == 0 {
+		platforms = listFlag{"linux_amd64"}
+	}
+
+	checker := conformance.New(*baseURL, *token)
+	var reports []*conformance.Report
+	for _, m := range modules {
+		address, version, _ := strings.Cut(m, "@")
+		parts := strings.Split(address, "/")
+		if len(parts) != 3 {
+			fatalf("-module %q must be namespace/name/provider[@version]", m)
+		}
+		reports = append(reports, checker.CheckModule(parts[0], parts[1], parts[2], version))
+	}
+	for _, p := range providers {
+		address, version, _ := strings.Cut(p, "@")
+		parts := strings.Split(address, "/")
+		if len(parts) != 2 {
+			fatalf("-provider %q must be namespace/name[@version]", p)
+		}
+		for _, platform := range platforms {
+			goos, goarch, ok := strings.Cut(platform, "_")
+			if !ok {
+				fatalf("-platform %q must be os_arch", platform)
+			}
+			reports = append(reports, checker.CheckProvider(parts[0], parts[1], version, goos, goarch))
+		}
+	}
+
+	failed := false
+	for _, r := range reports {
+		failed = failed || r.Failed
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(reports, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		for _, r := range reports {
+			fmt.Println(r.Flow)
+			for _, s := range r.Steps {
+				if s.Err != "" {
+					fmt.Printf("  FAIL %-10s %s\n       %s\n", s.Name, s.URL, s.Err)
+				} else {
+					fmt.Printf("  ok   %-10s %s\n", s.Name, s.URL)
+				}
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "conformance: "+format+"\n", args...)
+	os.Exit(2)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"iac-tool/internal/api"
+	"iac-tool/internal/conformance"
+	"iac-tool/internal/crypto"
+	"iac-tool/internal/database"
+	"iac-tool/internal/gpg"
+	"iac-tool/internal/registry"
+	"iac-tool/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// TestConformance serves the real router from httptest on a temporary database and runs
+// the module and provider flows of terraform init against it. The signing key is the one
+// gpg.Init generates on first start. The test is skipped when no PostgreSQL server is
+// reachable with the POSTGRES_* settings or gpg is not installed.
+func TestConformance(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+	openTestDatabase(t)
+
+	gin.SetMode(gin.TestMode)
+	t.Setenv("GPG_HOME", t.TempDir())
+	buildDir := t.TempDir()
+	t.Setenv("BUILD_DIR", buildDir)
+
+	if err := crypto.Init(); err != nil {
+		t.Fatalf("crypto: %v", err)
+	}
+	if err := registry.InitToken(); err != nil {
+		t.Fatalf("registry token: %v", err)
+	}
+	if err := validation.Register(); err != nil {
+		t.Fatalf("validators: %v", err)
+	}
+	if err := api.InitRunnerAPIKey(); err != nil {
+		t.Fatalf("api key: %v", err)
+	}
+	if err := gpg.Init(); err != nil {
+		t.Fatalf("gpg: %v", err)
+	}
+	if gpg.GetKeyID() == "" {
+		t.Fatal("gpg.Init did not generate a signing key")
+	}
+
+	seedConformance(t, buildDir)
+
+	router, err := newRouter()
+	if err != nil {
+		t.Fatalf("router: %v", err)
+	}
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	// The namespace is private: every request carries the API key, as terraform does
+	checker := conformance.New(srv.URL, api.GetRunnerAPIKey())
+	checker.Client = srv.Client()
+
+	for _, report := range []*conformance.Report{
+		checker.CheckModule("conformance", "network", "aws", ""),
+		checker.CheckModule("conformance", "network", "aws", "1.0.0"),
+		checker.CheckProvider("conformance", "example", "", "linux", "amd64"),
+		checker.CheckProvider("conformance", "example", "0.1.0", "darwin", "arm64"),
+	} {
+		if report.Failed {
+			out, _ := json.MarshalIndent(report, "", "  ")
+			t.Errorf("%s failed:\n%s", report.Flow, out)
+		}
+	}
+}
+
+// openTestDatabase creates an empty database on the PostgreSQL server of the POSTGRES_*
+// settings, points database.Init at it and drops it when the test ends
+func openTestDatabase(t *testing.T) {
+	t.Helper()
+	env := func(key, fallback string) string {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+		return fallback
+	}
+	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		env("POSTGRES_HOST", "localhost"), env("POSTGRES_PORT", "5432"),
+		env("POSTGRES_USER", "registry"), env("POSTGRES_PASSWORD", "registry"), env("POSTGRES_DB", "registry"))
+	admin, err := sql.Open("postgres", connStr)
+	if err != nil {
+		t.Skipf("PostgreSQL is not available: %v", err)
+	}
+	if err := admin.Ping(); err != nil {
+		admin.Close()
+		t.Skipf("PostgreSQL is not available: %v", err)
+	}
+
+	suffix := make([]byte, 6)
+	rand.Read(suffix)
+	name := "conformance_" + hex.EncodeToString(suffix)
+	if _, err := admin.Exec("CREATE DATABASE " + name); err != nil {
+		admin.Close()
+		t.Skipf("cannot create a test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if database.DB != nil {
+			database.DB.Close()
+		}
+		if _, err := admin.Exec("DROP DATABASE IF EXISTS " + name + " WITH (FORCE)"); err != nil {
+			t.Logf("dropping %s: %v", name, err)
+		}
+		admin.Close()
+	})
+
+	t.Setenv("POSTGRES_DB", name)
+	if err := database.Init(); err != nil {
+		t.Fatalf("database: %v", err)
+	}
+}
+
+// seedConformance adds a private namespace with a module and a provider whose platform
+// packages exist in buildDir
+func seedConformance(t *testing.T, buildDir string) {
+	t.Helper()
+	now := time.Now()
+	insert := func(query string, args ...interface{}) {
+		t.Helper()
+		if _, err := database.DB.Exec(query, args...); err != nil {
+			t.Fatalf("seeding: %v", err)
+		}
+	}
+
+	namespaceID := uuid.New().String()
+	insert(`INSERT INTO namespaces (id, name, is_public, created_at, updated_at) VALUES ($1, 'conformance', FALSE, $2, $2)`,
+		namespaceID, now)
+
+	moduleID := uuid.New().String()
+	insert(`
+		INSERT INTO modules (id, namespace_id, name, provider, description, source_url, git_url, git_ref, synced, created_at, updated_at)
+		VALUES ($1, $2, 'network', 'aws', 'Conformance module', 'https://git.example.com/network', 'https://git.example.com/network.git', 'main', TRUE, $3, $3)
+	`, moduleID, namespaceID, now)
+	for _, version := range []string{"0.9.0", "1.0.0"} {
+		insert(`
+			INSERT INTO module_versions (id, module_id, version, download_url, enabled, tag_date, created_at)
+			VALUES ($1, $2, $3, $4, TRUE, $5, $5)
+		`, uuid.New().String(), moduleID, version, "git::https://git.example.com/network.git?ref=v"+version, now)
+	}
+
+	providerID := uuid.New().String()
+	insert(`
+		INSERT INTO providers (id, namespace_id, name, description, source_url, synced, created_at, updated_at)
+		VALUES ($1, $2, 'example', 'Conformance provider', 'https://git.example.com/terraform-provider-example', TRUE, $3, $3)
+	`, providerID, namespaceID, now)
+	for _, version := range []string{"0.1.0", "1.0.0"} {
+		versionID := uuid.New().String()
+		insert(`
+			INSERT INTO provider_versions (id, provider_id, version, protocols, enabled, tag_date, created_at)
+			VALUES ($1, $2, $3, '["5.0"]', TRUE, $4, $4)
+		`, versionID, providerID, version, now)
+		for _, platform := range [][2]string{{"linux", "amd64"}, {"darwin", "arm64"}} {
+			filename := fmt.Sprintf("terraform-provider-example_%s_%s_%s.zip", version, platform[0], platform[1])
+			dir := filepath.Join(buildDir, "providers", "conformance", "example", version)
+			shasum := writeProviderPackage(t, dir, filename)
+			insert(`
+				INSERT INTO provider_platforms (id, version_id, os, arch, filename, download_url, shasum)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+			`, uuid.New().String(), versionID, platform[0], platform[1], filename,
+				"/downloads/providers/conformance/example/"+version+"/"+filename, shasum)
+		}
+	}
+}
+
+// writeProviderPackage writes a zip holding a dummy provider binary and returns its SHA-256
+func writeProviderPackage(t *testing.T, dir, filename string) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(dir, filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	zw := zip.NewWriter(io.MultiWriter(f, h))
+	w, err := zw.Create("terraform-provider-example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("#!/bin/sh\n"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
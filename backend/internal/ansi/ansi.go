@@ -0,0 +1,206 @@
+// Package ansi converts the output terraform, tofu and hooks write to the runner's PTY,
+// which carries ANSI escape sequences, to plain text or to HTML.
+//
+// The HTML is safe to embed: all text is HTML-escaped and the only markup emitted is
+// <span> elements with an inline style for the SGR attributes (colors, bold, dim, italic,
+// underline) of the text they hold. Other escape sequences are dropped.
+package ansi
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// escapePattern matches CSI sequences (colors, cursor movement, erasing) and OSC sequences
+// (window titles, hyperlinks), plus other two-character escapes
+var escapePattern = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// Strip returns s without escape sequences. Carriage returns of CRLF line ends are dropped
+// and a line rewritten in place with a bare carriage return keeps its last version.
+func Strip(s string) string {
+	return normalizeLines(escapePattern.ReplaceAllString(s, ""))
+}
+
+// normalizeLines resolves carriage returns the way a terminal shows them
+func normalizeLines(s string) string {
+	if !strings.Contains(s, "\r") {
+		return s
+	}
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		if j := strings.LastIndex(strings.TrimRight(line, "\r"), "\r"); j >= 0 {
+			line = line[j+1:]
+		}
+		lines[i] = strings.TrimRight(line, "\r")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// colors are the 16 standard and bright colors, as xterm shows them
+var colors = [16]string{
+	"#000000", "#cd0000", "#00cd00", "#cdcd00", "#0000ee", "#cd00cd", "#00cdcd", "#e5e5e5",
+	"#7f7f7f", "#ff0000", "#00ff00", "#ffff00", "#5c5cff", "#ff00ff", "#00ffff", "#ffffff",
+}
+
+// style is the SGR state applied to text
+type style struct {
+	fg, bg                             string
+	bold, dim, italic, underline, hide bool
+}
+
+func (s style) css() string {
+	var rules []string
+	if s.fg != "" {
+		rules = append(rules, "color:"+s.fg)
+	}
+	if s.bg != "" {
+		rules = append(rules, "background-color:"+s.bg)
+	}
+	if s.bold {
+		rules = append(rules, "font-weight:bold")
+	}
+	if s.dim {
+		rules = append(rules, "opacity:0.7")
+	}
+	if s.italic {
+		rules = append(rules, "font-style:italic")
+	}
+	if s.underline {
+		rules = append(rules, "text-decoration:underline")
+	}
+	if s.hide {
+		rules = append(rules, "visibility:hidden")
+	}
+	return strings.Join(rules, ";")
+}
+
+// color256 returns the color of an index of the 256-color palette
+func color256(n int) string {
+	switch {
+	case n < 16:
+		return colors[n]
+	case n < 232:
+		n -= 16
+		level := func(v int) int {
+			if v == 0 {
+				return 0
+			}
+			return 55 + v*40
+		}
+		return fmt.Sprintf("#%02x%02x%02x", level(n/36), level(n/6%6), level(n%6))
+	}
+	gray := 8 + (n-232)*10
+	return fmt.Sprintf("#%02x%02x%02x", gray, gray, gray)
+}
+
+// apply updates the style with the parameters of an SGR sequence ("1;31", "38;5;208", "")
+func (s *style) apply(params string) {
+	codes := strings.Split(params, ";")
+	for i := 0; i < len(codes); i++ {
+		code, err := strconv.Atoi(codes[i])
+		if err != nil {
+			code = 0 // an empty parameter means 0
+		}
+		switch {
+		case code == 0:
+			*s = style{}
+		case code == 1:
+			s.bold = true
+		case code == 2:
+			s.dim = true
+		case code == 3:
+			s.italic = true
+		case code == 4:
+			s.underline = true
+		case code == 8:
+			s.hide = true
+		case code == 22:
+			s.bold, s.dim = false, false
+		case code == 23:
+			s.italic = false
+		case code == 24:
+			s.underline = false
+		case code == 28:
+			s.hide = false
+		case code >= 30 && code <= 37:
+			s.fg = colors[code-30]
+		case code >= 90 && code <= 97:
+			s.fg = colors[code-90+8]
+		case code == 39:
+			s.fg = ""
+		case code >= 40 && code <= 47:
+			s.bg = colors[code-40]
+		case code >= 100 && code <= 107:
+			s.bg = colors[code-100+8]
+		case code == 49:
+			s.bg = ""
+		case code == 38 || code == 48:
+			// Extended color: 5;n (256 colors) or 2;r;g;b
+			var color string
+			if i+2 < len(codes) && codes[i+1] == "5" {
+				if n, err := strconv.Atoi(codes[i+2]); err == nil && n >= 0 && n < 256 {
+					color = color256(n)
+				}
+				i += 2
+			} else if i+4 < len(codes) && codes[i+1] == "2" {
+				var rgb [3]int
+				for j := range rgb {
+					rgb[j], _ = strconv.Atoi(codes[i+2+j])
+					rgb[j] = min(max(rgb[j], 0), 255)
+				}
+				color = fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2])
+				i += 4
+			}
+			if code == 38 {
+				s.fg = color
+			} else {
+				s.bg = color
+			}
+		}
+	}
+}
+
+// sgrPattern matches an SGR sequence, capturing its parameters
+var sgrPattern = regexp.MustCompile(`^\x1b\[([0-9;]*)m$`)
+
+// ToHTML renders s as escaped HTML, with text in colors and attributes wrapped in styled
+// spans. The result is meant for a <pre> element; line breaks are kept as they are.
+func ToHTML(s string) string {
+	var b strings.Builder
+	var current style
+	open := false
+	write := func(text string) {
+		text = normalizeLines(text)
+		if text == "" {
+			return
+		}
+		if css := current.css(); css != "" && !open {
+			b.WriteString(`<span style="` + css + `">`)
+			open = true
+		}
+		b.WriteString(html.EscapeString(text))
+	}
+
+	last := 0
+	for _, loc := range escapePattern.FindAllStringIndex(s, -1) {
+		write(s[last:loc[0]])
+		last = loc[1]
+		m := sgrPattern.FindStringSubmatch(s[loc[0]:loc[1]])
+		if m == nil {
+			continue
+		}
+		if open {
+			b.WriteString("</span>")
+			open = false
+		}
+		current.apply(m[1])
+	}
+	write(s[last:])
+	if open {
+		b.WriteString("</span>")
+	}
+	return b.String()
+}
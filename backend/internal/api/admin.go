@@ -0,0 +1,99 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"iac-tool/internal/build"
+	"iac-tool/internal/cache"
+	"iac-tool/internal/database"
+	"iac-tool/internal/scheduler"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetArtifactGCReport reports provider files with no database reference and
+// provider platforms whose files are missing, without changing anything
+// GET /api/admin/gc
+func GetArtifactGCReport(c *gin.Context) {
+	report, err := build.CollectArtifacts(build.ArtifactDir(), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// RunArtifactGC removes provider files with no database reference. Pass
+// ?dry_run=true to only report them.
+// POST /api/admin/gc
+func RunArtifactGC(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	report, err := build.CollectArtifacts(build.ArtifactDir(), dryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !dryRun {
+		log.Printf("Artifact GC by %s: removed %d orphaned files (%d bytes), %d platforms missing files",
+			c.GetString("api_key_name"), report.Removed, report.ReclaimedBytes, len(report.Missing))
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// GetRegistryCacheStats reports the size and hit rate of the registry lookup cache
+// GET /api/admin/registry-cache
+func GetRegistryCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, cache.Registry.Stats())
+}
+
+// FlushRegistryCache empties the registry lookup cache and resets its counters
+// DELETE /api/admin/registry-cache
+func FlushRegistryCache(c *gin.Context) {
+	cache.Registry.Flush()
+	cache.Registry.ResetStats()
+	log.Printf("Registry cache flushed by %s", c.GetString("api_key_name"))
+	c.JSON(http.StatusOK, gin.H{"message": "Registry cache flushed"})
+}
+
+// GetReplicaStatus reports whether a read replica is configured and how far behind it is
+// GET /api/admin/replica
+func GetReplicaStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, database.GetReplicaStatus())
+}
+
+// GetBackgroundJobs reports whether the background jobs are alive: when each last ran and
+// finished, how many items it processed and its last error
+// GET /api/admin/jobs
+func GetBackgroundJobs(c *gin.Context) {
+	jobs, err := scheduler.Status()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, jobs)
+}
+
+// GetRunnerStatus reports a runner's installed tools, free disk space and PTY support:
+// the default runner, or the runner of the pool given as ?url=. Pass ?refresh=true to
+// bypass the cached capabilities.
+// GET /api/admin/runner
+func GetRunnerStatus(c *gin.Context) {
+	runnerURL := build.RunnerURL()
+	if requested := strings.TrimSuffix(c.Query("url"), "/"); requested != "" {
+		if !slices.Contains(build.RunnerPool(), requested) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Runner is not part of the pool"})
+			return
+		}
+		runnerURL = requested
+	}
+	caps, err := build.GetRunnerCapabilities(runnerURL, c.Query("refresh") == "true")
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"url": runnerURL, "reachable": false, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"url": runnerURL, "reachable": true, "capabilities": caps})
+}
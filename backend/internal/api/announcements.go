@@ -0,0 +1,284 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const announcementColumns = `id, title, message, severity, namespace_id, module_id, provider_id, starts_at, ends_at, created_at, updated_at`
+
+// announcementSeverities are the allowed values of announcements.severity
+var announcementSeverities = map[string]bool{"info": true, "warning": true, "critical": true}
+
+// scanAnnouncement reads a row selected with announcementColumns
+func scanAnnouncement(scan func(dest ...interface{}) error) (models.Announcement, error) {
+	var a models.Announcement
+	var namespaceID, moduleID, providerID sql.NullString
+	var endsAt sql.NullTime
+	err := scan(&a.ID, &a.Title, &a.Message, &a.Severity, &namespaceID, &moduleID, &providerID, &a.StartsAt, &endsAt, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return a, err
+	}
+	if namespaceID.Valid {
+		a.NamespaceID = &namespaceID.String
+	}
+	if moduleID.Valid {
+		a.ModuleID = &moduleID.String
+	}
+	if providerID.Valid {
+		a.ProviderID = &providerID.String
+	}
+	if endsAt.Valid {
+		a.EndsAt = &endsAt.Time
+	}
+	now := time.Now()
+	a.Active = !a.StartsAt.After(now) && (a.EndsAt == nil || a.EndsAt.After(now))
+	return a, nil
+}
+
+// nilIfEmpty treats an empty optional ID like an omitted one
+func nilIfEmpty(s *string) *string {
+	if s != nil && *s == "" {
+		return nil
+	}
+	return s
+}
+
+// GetAnnouncements lists the announcements shown right now, newest first. With module_id,
+// provider_id or namespace_id it returns the global announcements and those attached to
+// that item (a module or provider also gets its namespace's); without, only global ones.
+// all=true also returns scheduled and ended announcements of every target, for admins.
+// GET /api/announcements?module_id=...&all=true
+func GetAnnouncements(c *gin.Context) {
+	query := `SELECT ` + announcementColumns + ` FROM announcements WHERE TRUE`
+	args := []interface{}{}
+
+	if c.Query("all") != "true" {
+		args = append(args, time.Now())
+		query += fmt.Sprintf(` AND starts_at <= $%d AND (ends_at IS NULL OR ends_at > $%d)`, len(args), len(args))
+
+		target := `namespace_id IS NULL AND module_id IS NULL AND provider_id IS NULL`
+		if id := c.Query("module_id"); id != "" {
+			args = append(args, id)
+			target += fmt.Sprintf(` OR module_id = $%d OR namespace_id = (SELECT namespace_id FROM modules WHERE id = $%d)`, len(args), len(args))
+		} else if id := c.Query("provider_id"); id != "" {
+			args = append(args, id)
+			target += fmt.Sprintf(` OR provider_id = $%d OR namespace_id = (SELECT namespace_id FROM providers WHERE id = $%d)`, len(args), len(args))
+		} else if id := c.Query("namespace_id"); id != "" {
+			args = append(args, id)
+			target += fmt.Sprintf(` OR namespace_id = $%d`, len(args))
+		}
+		query += ` AND (` + target + `)`
+	}
+	query += ` ORDER BY starts_at DESC, created_at DESC`
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	announcements := []models.Announcement{}
+	for rows.Next() {
+		a, err := scanAnnouncement(rows.Scan)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		announcements = append(announcements, a)
+	}
+
+	c.JSON(http.StatusOK, announcements)
+}
+
+// GetAnnouncement returns a single announcement
+// GET /api/announcements/:id
+func GetAnnouncement(c *gin.Context) {
+	a, err := scanAnnouncement(database.DB.QueryRow(`SELECT `+announcementColumns+` FROM announcements WHERE id = $1`, c.Param("id")).Scan)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Announcement not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, a)
+}
+
+// CreateAnnouncement publishes an announcement
+// POST /api/announcements
+func CreateAnnouncement(c *gin.Context) {
+	var input models.AnnouncementCreate
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	if input.Severity == "" {
+		input.Severity = "info"
+	}
+	if !announcementSeverities[input.Severity] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "severity must be 'info', 'warning' or 'critical'"})
+		return
+	}
+
+	input.NamespaceID = nilIfEmpty(input.NamespaceID)
+	input.ModuleID = nilIfEmpty(input.ModuleID)
+	input.ProviderID = nilIfEmpty(input.ProviderID)
+	targets := []struct {
+		table string
+		id    *string
+	}{{"namespaces", input.NamespaceID}, {"modules", input.ModuleID}, {"providers", input.ProviderID}}
+	attached := 0
+	for _, target := range targets {
+		if target.id == nil {
+			continue
+		}
+		attached++
+		var exists bool
+		database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM `+target.table+` WHERE id = $1)`, *target.id).Scan(&exists)
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": strings.TrimSuffix(target.table, "s") + " " + *target.id + " not found"})
+			return
+		}
+	}
+	if attached > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An announcement can be attached to one namespace, module or provider"})
+		return
+	}
+
+	now := time.Now()
+	startsAt := now
+	if input.StartsAt != nil {
+		startsAt = *input.StartsAt
+	}
+	if input.EndsAt != nil && !input.EndsAt.After(startsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be after starts_at"})
+		return
+	}
+
+	id := generateID()
+	_, err := database.DB.Exec(`
+		INSERT INTO announcements (id, title, message, severity, namespace_id, module_id, provider_id, starts_at, ends_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10)
+	`, id, input.Title, input.Message, input.Severity, input.NamespaceID, input.ModuleID, input.ProviderID, startsAt, input.EndsAt, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	a, err := scanAnnouncement(database.DB.QueryRow(`SELECT `+announcementColumns+` FROM announcements WHERE id = $1`, id).Scan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, a)
+}
+
+// UpdateAnnouncement edits the text, severity or schedule of an announcement
+// PATCH /api/announcements/:id
+func UpdateAnnouncement(c *gin.Context) {
+	id := c.Param("id")
+
+	var input models.AnnouncementUpdate
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	current, err := scanAnnouncement(database.DB.QueryRow(`SELECT `+announcementColumns+` FROM announcements WHERE id = $1`, id).Scan)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Announcement not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := []string{}
+	args := []interface{}{}
+	addUpdate := func(column string, value interface{}) {
+		args = append(args, value)
+		updates = append(updates, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if input.Title != nil {
+		if *input.Title == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "title cannot be empty"})
+			return
+		}
+		addUpdate("title", *input.Title)
+	}
+	if input.Message != nil {
+		addUpdate("message", *input.Message)
+	}
+	if input.Severity != nil {
+		if !announcementSeverities[*input.Severity] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "severity must be 'info', 'warning' or 'critical'"})
+			return
+		}
+		addUpdate("severity", *input.Severity)
+	}
+	startsAt, endsAt := current.StartsAt, current.EndsAt
+	if input.StartsAt != nil {
+		startsAt = *input.StartsAt
+		addUpdate("starts_at", startsAt)
+	}
+	if len(input.EndsAt) > 0 {
+		// An explicit null clears the end, so the announcement is shown until deleted
+		endsAt = nil
+		if string(input.EndsAt) != "null" {
+			var t time.Time
+			if err := json.Unmarshal(input.EndsAt, &t); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be an RFC 3339 time or null"})
+				return
+			}
+			endsAt = &t
+		}
+		addUpdate("ends_at", endsAt)
+	}
+	if endsAt != nil && !endsAt.After(startsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be after starts_at"})
+		return
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	addUpdate("updated_at", time.Now())
+	args = append(args, id)
+	query := fmt.Sprintf("UPDATE announcements SET %s WHERE id = $%d", strings.Join(updates, ", "), len(args))
+	if _, err := database.DB.Exec(query, args...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	GetAnnouncement(c)
+}
+
+// DeleteAnnouncement removes an announcement
+// DELETE /api/announcements/:id
+func DeleteAnnouncement(c *gin.Context) {
+	result, err := database.DB.Exec("DELETE FROM announcements WHERE id = $1", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Announcement not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Announcement deleted"})
+}
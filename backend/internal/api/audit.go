@@ -0,0 +1,84 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+	"iac-tool/internal/notify"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordAuditEvent stores an audit event and sends it as a notification
+func recordAuditEvent(action, actor, targetType, targetID string, details map[string]interface{}) error {
+	var detailsJSON sql.NullString
+	if len(details) > 0 {
+		data, _ := json.Marshal(details)
+		detailsJSON = sql.NullString{String: string(data), Valid: true}
+	}
+
+	_, err := database.DB.Exec(`
+		INSERT INTO audit_events (id, action, actor, target_type, target_id, details, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, generateID(), action, actor, targetType, targetID, detailsJSON, time.Now())
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{"actor": actor, "target_type": targetType, "target_id": targetID}
+	for k, v := range details {
+		data[k] = v
+	}
+	notify.Send(action, fmt.Sprintf("%s by %s on %s %s", action, actor, targetType, targetID), data)
+	return nil
+}
+
+// GetAuditEvents lists audit events, newest first
+// GET /api/admin/audit-events?action=...&target_id=...&limit=100
+func GetAuditEvents(c *gin.Context) {
+	query := `SELECT id, action, actor, target_type, target_id, details, created_at FROM audit_events WHERE TRUE`
+	args := []interface{}{}
+	if action := c.Query("action"); action != "" {
+		args = append(args, action)
+		query += fmt.Sprintf(` AND action = $%d`, len(args))
+	}
+	if targetID := c.Query("target_id"); targetID != "" {
+		args = append(args, targetID)
+		query += fmt.Sprintf(` AND target_id = $%d`, len(args))
+	}
+	limit := 100
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 1000 {
+		limit = l
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(` ORDER BY created_at DESC LIMIT $%d`, len(args))
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var e models.AuditEvent
+		var details sql.NullString
+		if err := rows.Scan(&e.ID, &e.Action, &e.Actor, &e.TargetType, &e.TargetID, &details, &e.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if details.Valid {
+			json.Unmarshal([]byte(details.String), &e.Details)
+		}
+		events = append(events, e)
+	}
+
+	c.JSON(http.StatusOK, events)
+}
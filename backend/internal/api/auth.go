@@ -0,0 +1,237 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/signing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// roleRank orders API key permissions; a key satisfies every role ranked at or below its own
+var roleRank = map[string]int{
+	"read":     1,
+	"write":    2,
+	"approver": 3,
+	"admin":    4,
+}
+
+// RequireRole protects sensitive management endpoints with an API key holding at
+// least the given permission. The key is read from X-API-Key or "Authorization: Bearer",
+// or taken from the frontend session cookie (see sessions.go).
+// The key's name, ID and permission are stored in the context as "api_key_name",
+// "api_key_id" and "api_key_permissions".
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authorizeRole(c, role) {
+			c.Next()
+		}
+	}
+}
+
+// authorizeRole authenticates the request and checks that its key holds at least role,
+// for RequireRole and for handlers of open routes where only some inputs need a role. On
+// failure the response is sent and it returns false.
+func authorizeRole(c *gin.Context, role string) bool {
+	token := requestAPIKey(c)
+	if rejectLockedOut(c, token, false) {
+		return false
+	}
+
+	if token == "" {
+		session, err := loadSession(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication error"})
+			c.Abort()
+			return false
+		}
+		if session != nil {
+			if roleRank[session.Permissions] < roleRank[role] {
+				c.JSON(http.StatusForbidden, gin.H{"error": "API key lacks '" + role + "' permission"})
+				c.Abort()
+				return false
+			}
+			recordAuthSuccess(c, session.APIKeyID, session.KeyName)
+			c.Set("api_key_name", session.KeyName)
+			c.Set("api_key_id", session.APIKeyID)
+			c.Set("api_key_permissions", session.Permissions)
+			return true
+		}
+	}
+
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key with '" + role + "' permission required"})
+		c.Abort()
+		return false
+	}
+
+	var id, name, permissions string
+	var expiresAt sql.NullTime
+	err := database.DB.QueryRow(`
+		SELECT id, name, permissions, expires_at
+		FROM api_keys
+		WHERE key_hash = $1
+	`, hashAPIKey(token)).Scan(&id, &name, &permissions, &expiresAt)
+
+	if err == sql.ErrNoRows {
+		recordAuthFailure(c, token)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication error"})
+		c.Abort()
+		return false
+	}
+
+	if expiresAt.Valid && expiresAt.Time.Before(time.Now()) {
+		recordAuthFailure(c, token)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key has expired"})
+		c.Abort()
+		return false
+	}
+
+	if roleRank[permissions] < roleRank[role] {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API key lacks '" + role + "' permission"})
+		c.Abort()
+		return false
+	}
+
+	database.DB.Exec("UPDATE api_keys SET last_used_at = $1 WHERE id = $2", time.Now(), id)
+	recordAuthSuccess(c, id, name)
+
+	c.Set("api_key_name", name)
+	c.Set("api_key_id", id)
+	c.Set("api_key_permissions", permissions)
+	return true
+}
+
+// requestAPIKey returns the API key sent in X-API-Key or "Authorization: Bearer", if any
+func requestAPIKey(c *gin.Context) string {
+	if token := c.GetHeader("X-API-Key"); token != "" {
+		return token
+	}
+	parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+	if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
+		return parts[1]
+	}
+	return ""
+}
+
+// hasCredentials reports whether the request carries an API key or a session cookie
+func hasCredentials(c *gin.Context) bool {
+	if requestAPIKey(c) != "" {
+		return true
+	}
+	token, err := c.Cookie(sessionCookie)
+	return err == nil && token != ""
+}
+
+// signedResponseWriter holds back the response so its signature can be sent as a header
+type signedResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *signedResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *signedResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// WriteHeaderNow is deferred until the signature is known
+func (w *signedResponseWriter) WriteHeaderNow() {}
+
+// RequireRunnerSignature protects the endpoints the runner calls back: with
+// RUNNER_SHARED_SECRET set, requests must be signed by the runner and responses are
+// signed in turn. Without the secret every request passes, as before.
+func RequireRunnerSignature() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		secret := signing.Secret()
+		if secret == "" {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if msg := bodyLimitMessage(err); msg != "" {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": msg})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err := signing.VerifyRequest(secret, c.Request, body); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		writer := &signedResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		requestSignature := c.Request.Header.Get(signing.SignatureHeader)
+		writer.Header().Set(signing.SignatureHeader, signing.ResponseSignature(secret, requestSignature, writer.Status(), writer.body.Bytes()))
+		writer.ResponseWriter.WriteHeaderNow()
+		writer.ResponseWriter.Write(writer.body.Bytes())
+	}
+}
+
+// defaultInternalCIDRs are the networks internal endpoints accept when
+// INTERNAL_ALLOWED_CIDRS is unset: loopback and private ranges
+var defaultInternalCIDRs = []string{"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "::1/128", "fc00::/7"}
+
+// RequireInternalNetwork restricts internal endpoints to callers from the networks in
+// INTERNAL_ALLOWED_CIDRS (comma-separated), or private networks by default. The peer
+// address of the connection is used, not X-Forwarded-For, so the header cannot be
+// spoofed; put internal callers on a direct route to the backend.
+func RequireInternalNetwork() (gin.HandlerFunc, error) {
+	cidrs := defaultInternalCIDRs
+	if configured := os.Getenv("INTERNAL_ALLOWED_CIDRS"); configured != "" {
+		cidrs = strings.Split(configured, ",")
+	}
+
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("INTERNAL_ALLOWED_CIDRS: %w", err)
+		}
+		networks = append(networks, network)
+	}
+
+	return func(c *gin.Context) {
+		host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+		if err != nil {
+			host = c.Request.RemoteAddr
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			for _, network := range networks {
+				if network.Contains(ip) {
+					c.Next()
+					return
+				}
+			}
+		}
+		log.Printf("Rejected internal request %s %s from %s", c.Request.Method, c.Request.URL.Path, host)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Internal endpoint is not reachable from this network"})
+		c.Abort()
+	}, nil
+}
@@ -0,0 +1,463 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+	"iac-tool/internal/notify"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Brute-force protection: failed authentications are counted per client IP and per
+// presented key. From AUTH_FAILURE_THRESHOLD failures within AUTH_FAILURE_WINDOW on, the
+// client is refused for AUTH_LOCKOUT_BASE, doubling with every further failure up to
+// AUTH_LOCKOUT_MAX. Counters live in memory, per backend instance.
+
+// authSettings is the brute-force and anomaly detection configuration
+type authSettings struct {
+	failureThreshold int
+	failureWindow    time.Duration
+	lockoutBase      time.Duration
+	lockoutMax       time.Duration
+	volumeMin        int
+	volumeFactor     float64
+	countryHeader    string
+}
+
+var (
+	authConfigOnce sync.Once
+	authConfig     authSettings
+)
+
+func authEnvInt(env string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(env)); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+func authEnvDuration(env string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(env)); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// authSettingsFromEnv returns the configuration, read once
+func authSettingsFromEnv() authSettings {
+	authConfigOnce.Do(func() {
+		authConfig = authSettings{
+			failureThreshold: authEnvInt("AUTH_FAILURE_THRESHOLD", 5),
+			failureWindow:    authEnvDuration("AUTH_FAILURE_WINDOW", 15*time.Minute),
+			lockoutBase:      authEnvDuration("AUTH_LOCKOUT_BASE", time.Minute),
+			lockoutMax:       authEnvDuration("AUTH_LOCKOUT_MAX", time.Hour),
+			volumeMin:        authEnvInt("AUTH_VOLUME_MIN", 500),
+			volumeFactor:     5,
+			countryHeader:    os.Getenv("AUTH_COUNTRY_HEADER"),
+		}
+		if f, err := strconv.ParseFloat(os.Getenv("AUTH_VOLUME_FACTOR"), 64); err == nil && f > 1 {
+			authConfig.volumeFactor = f
+		}
+	})
+	return authConfig
+}
+
+// failureRecord counts recent failed authentications of one subject
+type failureRecord struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+var authFailures = struct {
+	sync.Mutex
+	subjects map[string]*failureRecord
+}{subjects: map[string]*failureRecord{}}
+
+// authSubjects are the counters a request is tracked under: its client IP and, when it
+// presented one, the key
+func authSubjects(c *gin.Context, token string) []string {
+	subjects := []string{"ip:" + c.ClientIP()}
+	if token != "" {
+		subjects = append(subjects, "key:"+hashAPIKey(token)[:16])
+	}
+	return subjects
+}
+
+// authLockedOut returns how long the request's IP or key is still locked out
+func authLockedOut(c *gin.Context, token string) time.Duration {
+	authFailures.Lock()
+	defer authFailures.Unlock()
+
+	var remaining time.Duration
+	now := time.Now()
+	for _, subject := range authSubjects(c, token) {
+		if record, ok := authFailures.subjects[subject]; ok && record.lockedUntil.After(now) {
+			if d := record.lockedUntil.Sub(now); d > remaining {
+				remaining = d
+			}
+		}
+	}
+	return remaining
+}
+
+// rejectLockedOut answers 429 with Retry-After if the request is locked out. Terraform
+// protocol endpoints report errors as {"errors": [...]}.
+func rejectLockedOut(c *gin.Context, token string, terraformErrors bool) bool {
+	remaining := authLockedOut(c, token)
+	if remaining <= 0 {
+		return false
+	}
+
+	message := fmt.Sprintf("Too many failed authentication attempts, retry in %ds", int(math.Ceil(remaining.Seconds())))
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(remaining.Seconds()))))
+	if terraformErrors {
+		c.JSON(http.StatusTooManyRequests, gin.H{"errors": []string{message}})
+	} else {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": message})
+	}
+	c.Abort()
+	return true
+}
+
+// recordAuthFailure counts a failed authentication and locks the client out once it
+// crosses the threshold. The first lockout of a subject raises a brute_force alert.
+func recordAuthFailure(c *gin.Context, token string) {
+	cfg := authSettingsFromEnv()
+	now := time.Now()
+
+	var alerts []models.AuthLockout
+	authFailures.Lock()
+	for subject, record := range authFailures.subjects {
+		if now.Sub(record.lastFailure) > cfg.failureWindow && record.lockedUntil.Before(now) {
+			delete(authFailures.subjects, subject)
+		}
+	}
+	for _, subject := range authSubjects(c, token) {
+		record, ok := authFailures.subjects[subject]
+		if !ok {
+			record = &failureRecord{}
+			authFailures.subjects[subject] = record
+		}
+		record.failures++
+		record.lastFailure = now
+
+		if excess := record.failures - cfg.failureThreshold; excess >= 0 {
+			lockout := cfg.lockoutBase * time.Duration(math.Pow(2, math.Min(float64(excess), 30)))
+			if lockout > cfg.lockoutMax || lockout <= 0 {
+				lockout = cfg.lockoutMax
+			}
+			record.lockedUntil = now.Add(lockout)
+			if excess == 0 {
+				alerts = append(alerts, models.AuthLockout{Subject: subject, Failures: record.failures, LockedUntil: record.lockedUntil})
+			}
+		}
+	}
+	authFailures.Unlock()
+
+	for _, lockout := range alerts {
+		log.Printf("Locking out %s after %d failed authentication attempts (until %s)", lockout.Subject, lockout.Failures, lockout.LockedUntil.Format(time.RFC3339))
+		raiseSecurityAlert("brute_force", "", "", c.ClientIP(), "", map[string]interface{}{
+			"subject":      lockout.Subject,
+			"failures":     lockout.Failures,
+			"locked_until": lockout.LockedUntil,
+			"path":         c.Request.URL.Path,
+		})
+	}
+}
+
+// recordAuthSuccess clears the client's failure count and checks the key's usage for
+// anomalies
+func recordAuthSuccess(c *gin.Context, keyID, keyName string) {
+	authFailures.Lock()
+	delete(authFailures.subjects, "ip:"+c.ClientIP())
+	authFailures.Unlock()
+
+	checkKeyLocation(c, keyID, keyName)
+	checkKeyVolume(c, keyID, keyName)
+}
+
+// clientLocation is where a request comes from: the country reported by a proxy or CDN in
+// AUTH_COUNTRY_HEADER (e.g. CF-IPCountry), otherwise the client's /16 (IPv4) or /48 (IPv6)
+func clientLocation(c *gin.Context) string {
+	if header := authSettingsFromEnv().countryHeader; header != "" {
+		if country := c.GetHeader(header); country != "" {
+			return "country:" + country
+		}
+	}
+	ip := net.ParseIP(c.ClientIP())
+	if ip == nil {
+		return "unknown"
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return "net:" + (&net.IPNet{IP: ip4.Mask(net.CIDRMask(16, 32)), Mask: net.CIDRMask(16, 32)}).String()
+	}
+	return "net:" + (&net.IPNet{IP: ip.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// keyLocationFlushInterval is how often the requests of a key from a location it is already
+// recorded at are added to api_key_locations
+const keyLocationFlushInterval = time.Minute
+
+// keyLocation is a key/location pair this instance has recorded, with the requests since
+type keyLocation struct {
+	flushedAt time.Time
+	pending   int
+}
+
+var keyLocations = struct {
+	sync.Mutex
+	pairs map[string]*keyLocation
+}{pairs: map[string]*keyLocation{}}
+
+// checkKeyLocation records where a key is used from and raises a new_location alert the
+// first time an established key shows up somewhere else. Only a pair this instance has not
+// seen yet is written right away; the requests of known pairs are flushed once per
+// keyLocationFlushInterval.
+func checkKeyLocation(c *gin.Context, keyID, keyName string) {
+	location := clientLocation(c)
+	now := time.Now()
+
+	keyLocations.Lock()
+	pair := keyID + "\x00" + location
+	l, seen := keyLocations.pairs[pair]
+	if !seen {
+		l = &keyLocation{}
+		keyLocations.pairs[pair] = l
+	}
+	l.pending++
+	count := l.pending
+	if seen && now.Sub(l.flushedAt) < keyLocationFlushInterval {
+		keyLocations.Unlock()
+		return
+	}
+	l.flushedAt, l.pending = now, 0
+	keyLocations.Unlock()
+
+	var inserted bool
+	err := database.DB.QueryRow(`
+		INSERT INTO api_key_locations (api_key_id, location, first_seen_at, last_seen_at, request_count)
+		VALUES ($1, $2, $3, $3, $4)
+		ON CONFLICT (api_key_id, location) DO UPDATE
+		SET last_seen_at = EXCLUDED.last_seen_at, request_count = api_key_locations.request_count + EXCLUDED.request_count
+		RETURNING (xmax = 0)
+	`, keyID, location, now, count).Scan(&inserted)
+	if err != nil {
+		// Write the pair and its requests again on its next request
+		keyLocations.Lock()
+		l.flushedAt, l.pending = time.Time{}, l.pending+count
+		keyLocations.Unlock()
+		return
+	}
+	if !inserted {
+		return
+	}
+
+	var known int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM api_key_locations WHERE api_key_id = $1 AND location <> $2`, keyID, location).Scan(&known)
+	if known > 0 {
+		raiseSecurityAlert("new_location", keyID, keyName, c.ClientIP(), location, map[string]interface{}{
+			"known_locations": known,
+			"path":            c.Request.URL.Path,
+		})
+	}
+}
+
+// keyVolume counts a key's requests per hour
+type keyVolume struct {
+	hour    int64
+	count   int
+	history []int // Counts of previous hours with traffic, newest last (at most 24)
+	alerted bool
+}
+
+var keyVolumes = struct {
+	sync.Mutex
+	keys map[string]*keyVolume
+}{keys: map[string]*keyVolume{}}
+
+// checkKeyVolume raises a volume_spike alert (once per hour) when a key's requests in the
+// current hour exceed both AUTH_VOLUME_MIN and AUTH_VOLUME_FACTOR times its hourly average
+func checkKeyVolume(c *gin.Context, keyID, keyName string) {
+	cfg := authSettingsFromEnv()
+	hour := time.Now().Unix() / 3600
+
+	keyVolumes.Lock()
+	v, ok := keyVolumes.keys[keyID]
+	if !ok {
+		v = &keyVolume{hour: hour}
+		keyVolumes.keys[keyID] = v
+	}
+	if v.hour != hour {
+		v.history = append(v.history, v.count)
+		if len(v.history) > 24 {
+			v.history = v.history[len(v.history)-24:]
+		}
+		v.hour, v.count, v.alerted = hour, 0, false
+	}
+	v.count++
+
+	threshold := float64(cfg.volumeMin)
+	var average float64
+	if len(v.history) > 0 {
+		total := 0
+		for _, n := range v.history {
+			total += n
+		}
+		average = float64(total) / float64(len(v.history))
+		threshold = math.Max(threshold, average*cfg.volumeFactor)
+	}
+	spike := !v.alerted && float64(v.count) > threshold
+	if spike {
+		v.alerted = true
+	}
+	count := v.count
+	keyVolumes.Unlock()
+
+	if spike {
+		raiseSecurityAlert("volume_spike", keyID, keyName, c.ClientIP(), clientLocation(c), map[string]interface{}{
+			"requests_this_hour": count,
+			"hourly_average":     math.Round(average*10) / 10,
+		})
+	}
+}
+
+// raiseSecurityAlert stores an alert for review and sends it as a security.<type> notification
+func raiseSecurityAlert(alertType, keyID, keyName, clientIP, location string, details map[string]interface{}) {
+	detailsJSON, _ := json.Marshal(details)
+	_, err := database.DB.Exec(`
+		INSERT INTO security_alerts (id, type, api_key_id, api_key_name, client_ip, location, details, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, generateID(), alertType, nullIfEmpty(keyID), nullIfEmpty(keyName), clientIP, nullIfEmpty(location), string(detailsJSON), time.Now())
+	if err != nil {
+		log.Printf("Warning: failed to store security alert: %v", err)
+	}
+
+	data := map[string]interface{}{"client_ip": clientIP, "api_key_name": keyName, "location": location}
+	for k, v := range details {
+		data[k] = v
+	}
+	notify.Send("security."+alertType, fmt.Sprintf("Security alert %s from %s", alertType, clientIP), data)
+}
+
+// nullIfEmpty stores empty strings as NULL
+func nullIfEmpty(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// GetSecurityAlerts lists security alerts, newest first
+// GET /api/admin/security-alerts?type=...&acknowledged=false&limit=100
+func GetSecurityAlerts(c *gin.Context) {
+	query := `SELECT id, type, api_key_id, api_key_name, client_ip, location, details, created_at, acknowledged_at, acknowledged_by
+		FROM security_alerts WHERE TRUE`
+	args := []interface{}{}
+	if alertType := c.Query("type"); alertType != "" {
+		args = append(args, alertType)
+		query += fmt.Sprintf(` AND type = $%d`, len(args))
+	}
+	switch c.Query("acknowledged") {
+	case "true":
+		query += ` AND acknowledged_at IS NOT NULL`
+	case "false":
+		query += ` AND acknowledged_at IS NULL`
+	}
+	limit := 100
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 1000 {
+		limit = l
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(` ORDER BY created_at DESC LIMIT $%d`, len(args))
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	alerts := []models.SecurityAlert{}
+	for rows.Next() {
+		var a models.SecurityAlert
+		var details sql.NullString
+		var acknowledgedAt sql.NullTime
+		if err := rows.Scan(&a.ID, &a.Type, &a.APIKeyID, &a.APIKeyName, &a.ClientIP, &a.Location, &details, &a.CreatedAt, &acknowledgedAt, &a.AcknowledgedBy); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if details.Valid {
+			json.Unmarshal([]byte(details.String), &a.Details)
+		}
+		if acknowledgedAt.Valid {
+			a.AcknowledgedAt = &acknowledgedAt.Time
+		}
+		alerts = append(alerts, a)
+	}
+
+	c.JSON(http.StatusOK, alerts)
+}
+
+// AcknowledgeSecurityAlert marks an alert as reviewed by the calling admin key
+// POST /api/admin/security-alerts/:id/acknowledge
+func AcknowledgeSecurityAlert(c *gin.Context) {
+	result, err := database.DB.Exec(`
+		UPDATE security_alerts SET acknowledged_at = $1, acknowledged_by = $2
+		WHERE id = $3 AND acknowledged_at IS NULL
+	`, time.Now(), c.GetString("api_key_name"), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found or already acknowledged"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Alert acknowledged"})
+}
+
+// GetAuthLockouts lists the IPs and keys currently locked out on this instance
+// GET /api/admin/auth-lockouts
+func GetAuthLockouts(c *gin.Context) {
+	authFailures.Lock()
+	lockouts := []models.AuthLockout{}
+	now := time.Now()
+	for subject, record := range authFailures.subjects {
+		if record.lockedUntil.After(now) {
+			lockouts = append(lockouts, models.AuthLockout{Subject: subject, Failures: record.failures, LockedUntil: record.lockedUntil})
+		}
+	}
+	authFailures.Unlock()
+
+	sort.Slice(lockouts, func(i, j int) bool { return lockouts[i].LockedUntil.After(lockouts[j].LockedUntil) })
+	c.JSON(http.StatusOK, lockouts)
+}
+
+// ClearAuthLockout lifts a lockout early, e.g. after a legitimate user mistyped a key
+// DELETE /api/admin/auth-lockouts/:subject
+func ClearAuthLockout(c *gin.Context) {
+	authFailures.Lock()
+	_, ok := authFailures.subjects[c.Param("subject")]
+	delete(authFailures.subjects, c.Param("subject"))
+	authFailures.Unlock()
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No lockout for " + c.Param("subject")})
+		return
+	}
+	if err := recordAuditEvent("auth.lockout_cleared", c.GetString("api_key_name"), "auth_subject", c.Param("subject"), nil); err != nil {
+		log.Printf("Warning: failed to record audit event: %v", err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Lockout cleared"})
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+
+	"iac-tool/internal/scheduler"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListAutoDestroySchedules lists the last and next auto-destroy of every deployment with
+// auto_destroy_after
+// GET /api/auto-destroy
+func ListAutoDestroySchedules(c *gin.Context) {
+	schedules, err := scheduler.AutoDestroySchedules("")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, schedules)
+}
+
+// GetAutoDestroySchedule returns the last and next auto-destroy of a deployment
+// GET /api/deployments/:id/auto-destroy
+func GetAutoDestroySchedule(c *gin.Context) {
+	schedules, err := scheduler.AutoDestroySchedules(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(schedules) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found or has no auto_destroy_after"})
+		return
+	}
+	c.JSON(http.StatusOK, schedules[0])
+}
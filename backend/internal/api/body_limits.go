@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Default request body limits, overridden by MAX_JSON_BODY_SIZE and MAX_UPLOAD_SIZE
+const (
+	defaultMaxJSONBodySize = 10 << 20 // 10 MiB
+	defaultMaxUploadSize   = 1 << 30  // 1 GiB
+)
+
+// parseSize parses a size such as "512m", "2g" or a plain byte count
+func parseSize(s string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "k"):
+		multiplier, s = 1<<10, strings.TrimSuffix(s, "k")
+	case strings.HasSuffix(s, "m"):
+		multiplier, s = 1<<20, strings.TrimSuffix(s, "m")
+	case strings.HasSuffix(s, "g"):
+		multiplier, s = 1<<30, strings.TrimSuffix(s, "g")
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
+
+// sizeFromEnv reads a size from the environment, def when the variable is unset
+func sizeFromEnv(name string, def int64) (int64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	size, err := parseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return size, nil
+}
+
+// LimitRequestBody caps request bodies: multipart uploads at MAX_UPLOAD_SIZE (default
+// 1g), every other body at MAX_JSON_BODY_SIZE (default 10m). Bodies that announce a
+// larger Content-Length are rejected with 413 before they are read; bodies that turn out
+// larger fail when read, which bindJSON and the upload handler also answer with 413.
+func LimitRequestBody() (gin.HandlerFunc, error) {
+	maxJSON, err := sizeFromEnv("MAX_JSON_BODY_SIZE", defaultMaxJSONBodySize)
+	if err != nil {
+		return nil, err
+	}
+	maxUpload, err := sizeFromEnv("MAX_UPLOAD_SIZE", defaultMaxUploadSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+		limit, what := maxJSON, "Request body"
+		if strings.HasPrefix(c.ContentType(), "multipart/") {
+			limit, what = maxUpload, "Upload"
+		}
+		if c.Request.ContentLength > limit {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("%s exceeds the limit of %d bytes", what, limit)})
+			c.Abort()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}, nil
+}
+
+// bodyLimitMessage returns the message for an error caused by reading past the body
+// limit, empty for any other error
+func bodyLimitMessage(err error) string {
+	var maxBytes *http.MaxBytesError
+	if !errors.As(err, &maxBytes) {
+		return ""
+	}
+	return fmt.Sprintf("Request body exceeds the limit of %d bytes", maxBytes.Limit)
+}
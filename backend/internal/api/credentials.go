@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"iac-tool/internal/credentials"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCredentialHealth lists the credential status of every module, provider and
+// deployment with stored git credentials
+// GET /api/credentials
+func GetCredentialHealth(c *gin.Context) {
+	all, err := credentials.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, all)
+}
+
+// CheckAllCredentials starts validating every stored credential in the background; the
+// results show up in GET /api/credentials as the checks finish
+// POST /api/credentials/check
+func CheckAllCredentials(c *gin.Context) {
+	if !credentials.StartCheckAll() {
+		c.JSON(http.StatusAccepted, gin.H{"message": "Credential check already running"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Credential check started"})
+}
+
+// CheckCredential validates the stored credential of one resource now
+// POST /api/credentials/:type/:id/check
+func CheckCredential(c *gin.Context) {
+	resourceType := c.Param("type")
+	if !credentials.IsResourceType(resourceType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be modules, providers or deployments"})
+		return
+	}
+
+	h, err := credentials.Get(resourceType, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Resource not found or has no stored credentials"})
+		return
+	}
+	credentials.Check(h)
+	c.JSON(http.StatusOK, h)
+}
+
+// SetCredentialExpiry records when a stored credential (e.g., a personal access
+// token) expires so it can be flagged ahead of time; null clears it
+// PUT /api/credentials/:type/:id
+func SetCredentialExpiry(c *gin.Context) {
+	resourceType := c.Param("type")
+	if !credentials.IsResourceType(resourceType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be modules, providers or deployments"})
+		return
+	}
+
+	var input struct {
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	found, err := credentials.SetExpiry(resourceType, c.Param("id"), input.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Resource not found or has no stored credentials"})
+		return
+	}
+
+	h, err := credentials.Get(resourceType, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	credentials.Check(h)
+	c.JSON(http.StatusOK, h)
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"iac-tool/internal/notify"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDeadLetters lists notifications the webhook did not accept after all retries, newest
+// first. ?pending=true lists those not yet redelivered, ?event_type= filters by type.
+// GET /api/admin/dead-letters
+func GetDeadLetters(c *gin.Context) {
+	var pending *bool
+	if p, err := strconv.ParseBool(c.Query("pending")); err == nil {
+		pending = &p
+	}
+	limit := 100
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 1000 {
+		limit = l
+	}
+	letters, err := notify.DeadLetters(c.Query("event_type"), pending, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, letters)
+}
+
+// RedeliverDeadLetter posts a dead letter to the webhook again
+// POST /api/admin/dead-letters/:id/redeliver
+func RedeliverDeadLetter(c *gin.Context) {
+	letter, err := notify.Redeliver(c.Param("id"), c.GetString("api_key_name"))
+	switch {
+	case err == sql.ErrNoRows:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead letter not found"})
+		return
+	case err == notify.ErrAlreadyRedelivered || err == notify.ErrNoWebhook:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil && letter != nil:
+		// The webhook still fails; the dead letter records the new attempts
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Redelivery failed: " + err.Error(), "dead_letter": letter})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordAuditEvent("dead_letter.redelivered", c.GetString("api_key_name"), "dead_letter", letter.ID,
+		map[string]interface{}{"event_type": letter.EventType})
+	c.JSON(http.StatusOK, letter)
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"iac-tool/internal/build"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDeploymentRunInputs returns the outputs of other deployments a run consumes and
+// the runs that produced them. Values are not returned.
+// GET /api/deployments/:id/runs/:runId/inputs
+func GetDeploymentRunInputs(c *gin.Context) {
+	run, err := getDeploymentRun(c.Param("runId"))
+	if err != nil || run.DeploymentID != c.Param("id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT i.variable, i.source_deployment_id, d.name, i.source_run_id, i.source_path, i.output_name, i.sensitive, i.created_at
+		FROM deployment_run_inputs i
+		JOIN deployments d ON d.id = i.source_deployment_id
+		WHERE i.run_id = $1
+		ORDER BY i.variable
+	`, run.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	inputs := []models.DeploymentRunInput{}
+	for rows.Next() {
+		var input models.DeploymentRunInput
+		if err := rows.Scan(&input.Variable, &input.SourceDeploymentID, &input.SourceDeploymentName, &input.SourceRunID,
+			&input.SourcePath, &input.Output, &input.Sensitive, &input.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		inputs = append(inputs, input)
+	}
+
+	c.JSON(http.StatusOK, inputs)
+}
+
+// GetDeploymentOutputs returns the outputs of a deployment's latest successful applies,
+// one entry per path, for automation such as CMDB syncs. Sensitive values are never
+// returned.
+// GET /api/deployments/:id/outputs
+func GetDeploymentOutputs(c *gin.Context) {
+	id := c.Param("id")
+	var name, namespace string
+	err := database.DB.QueryRow(`
+		SELECT d.name, n.name FROM deployments d JOIN namespaces n ON d.namespace_id = n.id WHERE d.id = $1
+	`, id).Scan(&name, &namespace)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found"})
+		return
+	}
+
+	path := c.Query("path")
+	outputs, err := build.LatestOutputs(id, path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if path != "" && len(outputs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Path " + path + " has no successful apply"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deployment_id": id,
+		"deployment":    name,
+		"namespace":     namespace,
+		"paths":         outputs,
+	})
+}
+
+// GetDeploymentDependencies returns the edges of the deployment graph around a deployment:
+// the deployments whose outputs its runs consumed and the deployments consuming its outputs
+// GET /api/deployments/:id/dependencies
+func GetDeploymentDependencies(c *gin.Context) {
+	id := c.Param("id")
+	var exists bool
+	database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM deployments WHERE id = $1)`, id).Scan(&exists)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found"})
+		return
+	}
+
+	upstream, err := deploymentDependencies(`r.deployment_id = $1`, `i.source_deployment_id`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	downstream, err := deploymentDependencies(`i.source_deployment_id = $1`, `r.deployment_id`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.DeploymentDependencies{Upstream: upstream, Downstream: downstream})
+}
+
+// deploymentDependencies groups the run inputs matching where by the deployment in column other
+func deploymentDependencies(where, other, id string) ([]models.DeploymentDependency, error) {
+	rows, err := database.DB.Query(`
+		SELECT d.id, d.name, n.name, i.output_name, r.id, i.created_at
+		FROM deployment_run_inputs i
+		JOIN deployment_runs r ON r.id = i.run_id
+		JOIN deployments d ON d.id = `+other+`
+		JOIN namespaces n ON n.id = d.namespace_id
+		WHERE `+where+`
+		ORDER BY i.created_at DESC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dependencies := []models.DeploymentDependency{}
+	index := map[string]int{}
+	for rows.Next() {
+		var dep models.DeploymentDependency
+		var output, runID string
+		var createdAt time.Time
+		if err := rows.Scan(&dep.DeploymentID, &dep.Name, &dep.Namespace, &output, &runID, &createdAt); err != nil {
+			return nil, err
+		}
+
+		i, ok := index[dep.DeploymentID]
+		if !ok {
+			// Rows are newest first, so the first row of a deployment is its latest use
+			dep.Outputs = []string{}
+			dep.LastRunID = runID
+			dep.LastUsedAt = createdAt
+			index[dep.DeploymentID] = len(dependencies)
+			dependencies = append(dependencies, dep)
+			i = len(dependencies) - 1
+		}
+		if !slices.Contains(dependencies[i].Outputs, output) {
+			dependencies[i].Outputs = append(dependencies[i].Outputs, output)
+		}
+	}
+	return dependencies, rows.Err()
+}
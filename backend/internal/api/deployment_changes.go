@@ -0,0 +1,240 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"iac-tool/internal/crypto"
+	"iac-tool/internal/database"
+	"iac-tool/internal/git"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validateWatchPaths checks that watch globs are relative to the repository root
+func validateWatchPaths(patterns []string) error {
+	for _, p := range patterns {
+		if strings.TrimSpace(p) == "" || strings.HasPrefix(p, "/") {
+			return fmt.Errorf("watch_paths must be relative to the repository root")
+		}
+		for _, part := range strings.Split(p, "/") {
+			if part == ".." {
+				return fmt.Errorf("watch_paths must not contain '..'")
+			}
+		}
+	}
+	return nil
+}
+
+// globToRegexp converts a watch glob to a regular expression. "*" and "?" stay within
+// one path segment, "**" spans directories, and a pattern without wildcards matches
+// the file itself or everything below it.
+func globToRegexp(pattern string) *regexp.Regexp {
+	pattern = strings.TrimPrefix(strings.TrimSuffix(pattern, "/"), "./")
+	if !strings.ContainsAny(pattern, "*?") {
+		return regexp.MustCompile("^" + regexp.QuoteMeta(pattern) + "(/.*)?$")
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			b.WriteString("[^/]*")
+		case pattern[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// pathContains reports whether file lies in the run path dir ("." is the repository root)
+func pathContains(dir, file string) bool {
+	dir = strings.Trim(strings.TrimPrefix(dir, "./"), "/")
+	if dir == "" || dir == "." {
+		return true
+	}
+	return file == dir || strings.HasPrefix(file, dir+"/")
+}
+
+// normalizeRepoURL makes URLs of the same repository comparable
+func normalizeRepoURL(repoURL string) string {
+	u := strings.ToLower(strings.TrimSpace(repoURL))
+	u = strings.TrimSuffix(strings.TrimSuffix(u, "/"), ".git")
+	return strings.TrimPrefix(strings.TrimPrefix(u, "https://"), "http://")
+}
+
+// DetectDeploymentChanges computes the files changed by a push and returns the
+// deployments (and run paths) they affect, so triggers only start relevant runs.
+// A deployment is affected when a changed file is under a path it has been run for
+// (its working directory if it has no runs yet) or matches one of its watch_paths.
+// POST /api/deployments/changes
+func DetectDeploymentChanges(c *gin.Context) {
+	var input models.RepositoryChanges
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	input.Before = strings.ToLower(input.Before)
+	input.After = strings.ToLower(input.After)
+	if (!commitSHAPattern.MatchString(input.Before) && !git.IsZeroSHA(input.Before)) || !commitSHAPattern.MatchString(input.After) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "before and after must be full commit SHAs"})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT d.id, d.name, n.name, d.git_url, d.git_auth_type, d.git_auth_data, d.working_directory, d.watch_paths
+		FROM deployments d
+		JOIN namespaces n ON d.namespace_id = n.id
+		ORDER BY n.name, d.name
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	type candidate struct {
+		affected   models.AffectedDeployment
+		workingDir string
+		watch      []string
+	}
+	var candidates []candidate
+	var auth *git.AuthConfig
+	repo := normalizeRepoURL(input.GitURL)
+	for rows.Next() {
+		var cand candidate
+		var gitURL string
+		var authType, authData, workingDir, watchJSON sql.NullString
+		if err := rows.Scan(&cand.affected.DeploymentID, &cand.affected.Name, &cand.affected.Namespace, &gitURL,
+			&authType, &authData, &workingDir, &watchJSON); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if normalizeRepoURL(gitURL) != repo {
+			continue
+		}
+		cand.workingDir = workingDir.String
+		if watchJSON.Valid && watchJSON.String != "" {
+			json.Unmarshal([]byte(watchJSON.String), &cand.watch)
+		}
+
+		// Any deployment of the repository with credentials can read the diff
+		if auth == nil && authType.Valid && authData.Valid {
+			if decryptedData, err := crypto.DecryptJSON(authData.String); err == nil {
+				var authJSON map[string]string
+				if err := json.Unmarshal([]byte(decryptedData), &authJSON); err == nil {
+					auth = &git.AuthConfig{
+						Type:     authType.String,
+						Username: authJSON["username"],
+						Password: authJSON["password"],
+					}
+				}
+			}
+		}
+		candidates = append(candidates, cand)
+	}
+	rows.Close()
+
+	result := models.ChangeSet{
+		Before:       input.Before,
+		After:        input.After,
+		ChangedFiles: []string{},
+		Deployments:  []models.AffectedDeployment{},
+	}
+	if len(candidates) == 0 {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	if git.IsZeroSHA(input.Before) {
+		result.AllChanged = true
+	} else {
+		files, err := git.ChangedFiles(input.GitURL, input.Before, input.After, auth)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to compute changes: " + err.Error()})
+			return
+		}
+		result.ChangedFiles = files
+	}
+
+	for _, cand := range candidates {
+		// Paths the deployment is run for; its working directory until it has runs
+		paths := map[string]bool{}
+		runPaths, err := database.DB.Query(`SELECT DISTINCT path FROM deployment_runs WHERE deployment_id = $1 AND path IS NOT NULL`, cand.affected.DeploymentID)
+		if err == nil {
+			for runPaths.Next() {
+				var p string
+				if runPaths.Scan(&p) == nil {
+					paths[p] = true
+				}
+			}
+			runPaths.Close()
+		}
+		if len(paths) == 0 && cand.workingDir != "" {
+			paths[cand.workingDir] = true
+		}
+
+		watch := make([]*regexp.Regexp, len(cand.watch))
+		for i, pattern := range cand.watch {
+			watch[i] = globToRegexp(pattern)
+		}
+
+		affectedPaths := map[string]bool{}
+		matched := []string{}
+		watchHit := false
+		for _, file := range result.ChangedFiles {
+			hit := false
+			for p := range paths {
+				if pathContains(p, file) {
+					affectedPaths[p] = true
+					hit = true
+				}
+			}
+			for _, re := range watch {
+				if re.MatchString(file) {
+					watchHit = true
+					hit = true
+				}
+			}
+			if hit {
+				matched = append(matched, file)
+			}
+		}
+
+		// A watch glob match re-runs every path of the deployment
+		if result.AllChanged || watchHit {
+			for p := range paths {
+				affectedPaths[p] = true
+			}
+		}
+		if !result.AllChanged && len(matched) == 0 {
+			continue
+		}
+
+		cand.affected.Paths = make([]string, 0, len(affectedPaths))
+		for p := range affectedPaths {
+			cand.affected.Paths = append(cand.affected.Paths, p)
+		}
+		sort.Strings(cand.affected.Paths)
+		cand.affected.MatchedFiles = matched
+		result.Deployments = append(result.Deployments, cand.affected)
+	}
+
+	c.JSON(http.StatusOK, result)
+}
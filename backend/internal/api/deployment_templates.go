@@ -0,0 +1,291 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+	"iac-tool/internal/sourcehosts"
+
+	"github.com/gin-gonic/gin"
+)
+
+const deploymentTemplateSelect = `
+	SELECT id, name, description, git_url_pattern, settings, created_at, updated_at
+	FROM deployment_templates`
+
+func scanDeploymentTemplate(row rowScanner) (*models.DeploymentTemplate, error) {
+	var t models.DeploymentTemplate
+	var settingsJSON sql.NullString
+	if err := row.Scan(&t.ID, &t.Name, &t.Description, &t.GitURLPattern, &settingsJSON, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if settingsJSON.Valid && settingsJSON.String != "" {
+		json.Unmarshal([]byte(settingsJSON.String), &t.Settings)
+	}
+	return &t, nil
+}
+
+// expandGitURLPattern fills in the {namespace} and {name} placeholders of a template's
+// repository URL
+func expandGitURLPattern(pattern, namespace, name string) string {
+	return strings.NewReplacer("{namespace}", namespace, "{name}", name).Replace(pattern)
+}
+
+// validateDeploymentTemplate checks a template's repository pattern and settings
+func validateDeploymentTemplate(pattern string, settings *models.DeploymentSettings) error {
+	if !isValidGitURL(expandGitURLPattern(pattern, "namespace", "name")) {
+		return fmt.Errorf("git_url_pattern must be an HTTPS git repository URL, optionally with {namespace} and {name} (e.g., https://github.com/org/{name}.git)")
+	}
+	if err := sourcehosts.Check(sourcehosts.KindGit, expandGitURLPattern(pattern, "namespace", "name")); err != nil {
+		return fmt.Errorf("git_url_pattern: %w", err)
+	}
+	return validateDeploymentSettings(settings)
+}
+
+// GetDeploymentTemplates lists deployment templates
+// GET /api/deployment-templates
+func GetDeploymentTemplates(c *gin.Context) {
+	rows, err := database.DB.Query(deploymentTemplateSelect + " ORDER BY name")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	templates := []models.DeploymentTemplate{}
+	for rows.Next() {
+		t, err := scanDeploymentTemplate(rows)
+		if err != nil {
+			continue
+		}
+		templates = append(templates, *t)
+	}
+	c.JSON(http.StatusOK, templates)
+}
+
+// GetDeploymentTemplate returns a deployment template
+// GET /api/deployment-templates/:id
+func GetDeploymentTemplate(c *gin.Context) {
+	t, err := scanDeploymentTemplate(database.DB.QueryRow(deploymentTemplateSelect+" WHERE id = $1", c.Param("id")))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// CreateDeploymentTemplate creates a deployment template
+// POST /api/deployment-templates
+func CreateDeploymentTemplate(c *gin.Context) {
+	var input models.DeploymentTemplateCreate
+	if !bindJSON(c, &input) {
+		return
+	}
+	if err := validateDeploymentTemplate(input.GitURLPattern, &input.Settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settingsBytes, _ := json.Marshal(input.Settings)
+	id := generateID()
+	now := time.Now()
+	_, err := database.DB.Exec(`
+		INSERT INTO deployment_templates (id, name, description, git_url_pattern, settings, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+	`, id, input.Name, input.Description, input.GitURLPattern, string(settingsBytes), now)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			c.JSON(http.StatusConflict, gin.H{"error": "A template with this name already exists"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	t, err := scanDeploymentTemplate(database.DB.QueryRow(deploymentTemplateSelect+" WHERE id = $1", id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, t)
+}
+
+// UpdateDeploymentTemplate updates a deployment template. Deployments created from it
+// before keep their settings.
+// PATCH /api/deployment-templates/:id
+func UpdateDeploymentTemplate(c *gin.Context) {
+	id := c.Param("id")
+	var input models.DeploymentTemplateUpdate
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	t, err := scanDeploymentTemplate(database.DB.QueryRow(deploymentTemplateSelect+" WHERE id = $1", id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+	if input.Description != nil {
+		t.Description = input.Description
+	}
+	if input.GitURLPattern != nil {
+		t.GitURLPattern = *input.GitURLPattern
+	}
+	if input.Settings != nil {
+		t.Settings = *input.Settings
+	}
+	if err := validateDeploymentTemplate(t.GitURLPattern, &t.Settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settingsBytes, _ := json.Marshal(t.Settings)
+	t.UpdatedAt = time.Now()
+	_, err = database.DB.Exec(`
+		UPDATE deployment_templates
+		SET description = $1, git_url_pattern = $2, settings = $3, updated_at = $4
+		WHERE id = $5
+	`, t.Description, t.GitURLPattern, string(settingsBytes), t.UpdatedAt, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// DeleteDeploymentTemplate deletes a deployment template; deployments created from it
+// are kept
+// DELETE /api/deployment-templates/:id
+func DeleteDeploymentTemplate(c *gin.Context) {
+	result, err := database.DB.Exec(`DELETE FROM deployment_templates WHERE id = $1`, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Template deleted"})
+}
+
+// CreateDeploymentFromTemplate creates a deployment with a template's settings, its
+// repository URL taken from the template's pattern unless given
+// POST /api/deployment-templates/:id/deployments
+func CreateDeploymentFromTemplate(c *gin.Context) {
+	var input models.DeploymentFromTemplate
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	t, err := scanDeploymentTemplate(database.DB.QueryRow(deploymentTemplateSelect+" WHERE id = $1", c.Param("id")))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+	var namespaceName string
+	if err := database.DB.QueryRow(`SELECT name FROM namespaces WHERE id = $1`, input.NamespaceID).Scan(&namespaceName); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Namespace not found"})
+		return
+	}
+
+	create := models.DeploymentCreate{
+		NamespaceID:        input.NamespaceID,
+		Name:               input.Name,
+		Description:        input.Description,
+		GitURL:             input.GitURL,
+		DeploymentSettings: t.Settings,
+	}
+	if create.GitURL == "" {
+		create.GitURL = expandGitURLPattern(t.GitURLPattern, namespaceName, input.Name)
+	}
+	if create.Description == nil {
+		create.Description = t.Description
+	}
+
+	authType, authData, err := deploymentAuth(input.IsPrivate, input.GitUsername, input.GitPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt authentication data"})
+		return
+	}
+	createDeployment(c, &create, authType, authData)
+}
+
+// CloneDeployment creates a deployment with the settings of an existing one, e.g. a new
+// environment of the same stack. Git credentials are copied only when the repository
+// stays on the same host.
+// POST /api/deployments/:id/clone
+func CloneDeployment(c *gin.Context) {
+	var input models.DeploymentClone
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	source, err := scanDeployment(database.DB.QueryRow(deploymentSelect+` WHERE d.id = $1`, c.Param("id")))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found"})
+		return
+	}
+	var authType, authData sql.NullString
+	database.DB.QueryRow(`SELECT git_auth_type, git_auth_data FROM deployments WHERE id = $1`, source.ID).Scan(&authType, &authData)
+
+	create := models.DeploymentCreate{
+		NamespaceID:        source.NamespaceID,
+		Name:               input.Name,
+		Description:        source.Description,
+		GitURL:             source.GitURL,
+		DeploymentSettings: deploymentSettings(&source.Deployment),
+	}
+	if input.NamespaceID != "" {
+		create.NamespaceID = input.NamespaceID
+	}
+	if input.Description != nil {
+		create.Description = input.Description
+	}
+	if input.GitURL != "" {
+		create.GitURL = input.GitURL
+		if !sameGitHost(input.GitURL, source.GitURL) {
+			authType, authData = sql.NullString{}, sql.NullString{}
+		}
+	}
+
+	createDeployment(c, &create, authType, authData)
+}
+
+// deploymentSettings returns the settings of a deployment as they are given on create
+func deploymentSettings(d *models.Deployment) models.DeploymentSettings {
+	hooks, cloneOptions, pipeline, terragrunt := d.Hooks, d.CloneOptions, d.Pipeline, d.Terragrunt
+	return models.DeploymentSettings{
+		TerraformWorkspace: d.TerraformWorkspace,
+		Hooks:              &hooks,
+		RunnerImage:        d.RunnerImage,
+		AutoDestroyAfter:   d.AutoDestroyAfter,
+		PlanValidity:       d.PlanValidity,
+		CloneOptions:       &cloneOptions,
+		Pipeline:           &pipeline,
+		Terragrunt:         &terragrunt,
+		WatchPaths:         d.WatchPaths,
+		RegistryNamespaces: d.RegistryNamespaces,
+	}
+}
+
+// sameGitHost reports whether two repository URLs point at the same host, so
+// credentials for one may be used for the other
+func sameGitHost(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return ua.Host != "" && strings.EqualFold(ua.Host, ub.Host)
+}
@@ -2,12 +2,18 @@ package api
 
 import (
 	"bufio"
+	"compress/gzip"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -16,6 +22,10 @@ import (
 	"iac-tool/internal/database"
 	"iac-tool/internal/git"
 	"iac-tool/internal/models"
+	"iac-tool/internal/plan"
+	"iac-tool/internal/server"
+	"iac-tool/internal/sourcehosts"
+	"iac-tool/internal/tfconfig"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,10 +33,7 @@ import (
 // ListDeployments lists all deployments
 // GET /api/deployments
 func ListDeployments(c *gin.Context) {
-	rows, err := database.DB.Query(`
-		SELECT d.id, d.namespace_id, d.name, d.description, d.git_url, d.created_at, d.updated_at, n.name as namespace
-		FROM deployments d
-		JOIN namespaces n ON d.namespace_id = n.id
+	rows, err := database.DB.Query(deploymentSelect + `
 		ORDER BY d.created_at DESC
 	`)
 	if err != nil {
@@ -37,8 +44,7 @@ func ListDeployments(c *gin.Context) {
 
 	deployments := make([]models.DeploymentWithNamespace, 0)
 	for rows.Next() {
-		var d models.DeploymentWithNamespace
-		err := rows.Scan(&d.ID, &d.NamespaceID, &d.Name, &d.Description, &d.GitURL, &d.CreatedAt, &d.UpdatedAt, &d.Namespace)
+		d, err := scanDeployment(rows)
 		if err != nil {
 			continue
 		}
@@ -53,14 +59,7 @@ func ListDeployments(c *gin.Context) {
 func GetDeployment(c *gin.Context) {
 	id := c.Param("id")
 
-	var d models.DeploymentWithNamespace
-	err := database.DB.QueryRow(`
-		SELECT d.id, d.namespace_id, d.name, d.description, d.git_url, d.created_at, d.updated_at, n.name as namespace
-		FROM deployments d
-		JOIN namespaces n ON d.namespace_id = n.id
-		WHERE d.id = $1
-	`, id).Scan(&d.ID, &d.NamespaceID, &d.Name, &d.Description, &d.GitURL, &d.CreatedAt, &d.UpdatedAt, &d.Namespace)
-
+	d, err := scanDeployment(database.DB.QueryRow(deploymentSelect+` WHERE d.id = $1`, id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found"})
 		return
@@ -74,48 +73,140 @@ func GetDeployment(c *gin.Context) {
 func CreateDeployment(c *gin.Context) {
 	var input models.DeploymentCreate
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	authType, authData, err := deploymentAuth(input.IsPrivate, input.GitUsername, input.GitPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt authentication data"})
 		return
 	}
 
+	createDeployment(c, &input, authType, authData)
+}
+
+// deploymentAuth returns the auth type and encrypted auth data stored for a private
+// repository (both NULL for public ones)
+func deploymentAuth(isPrivate bool, username, password string) (authType, authData sql.NullString, err error) {
+	if !isPrivate || username == "" {
+		return authType, authData, nil
+	}
+
+	// Encrypt authentication data
+	authJSON := map[string]string{
+		"username": username,
+		"password": password,
+	}
+	authDataBytes, _ := json.Marshal(authJSON)
+	encrypted, err := crypto.EncryptJSON(string(authDataBytes))
+	if err != nil {
+		return authType, authData, err
+	}
+
+	authType = sql.NullString{String: "http", Valid: true}
+	authData = sql.NullString{String: encrypted, Valid: true}
+	return authType, authData, nil
+}
+
+// createDeployment validates and inserts a deployment with already encrypted git
+// credentials, responding with the created deployment
+func createDeployment(c *gin.Context, input *models.DeploymentCreate, authType, authData sql.NullString) {
 	// Validate Git URL format
 	if !isValidGitURL(input.GitURL) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Git URL. Must be a valid HTTPS git repository URL (e.g., https://github.com/org/repo.git)"})
 		return
 	}
+	if !checkSourceHost(c, sourcehosts.KindGit, input.GitURL) {
+		return
+	}
+	// Reading other namespaces' modules and providers is granted by admins; an
+	// organization's defaults were set by one
+	if len(input.RegistryNamespaces) > 0 && !authorizeRole(c, "admin") {
+		return
+	}
 
-	// Prepare auth config and encrypted data
-	var authType sql.NullString
-	var authData sql.NullString
-
-	if input.IsPrivate && input.GitUsername != "" {
-		// Encrypt authentication data
-		authJSON := map[string]string{
-			"username": input.GitUsername,
-			"password": input.GitPassword,
+	// Deployments in an organization count against its quota and inherit its defaults
+	org, vcs, err := namespaceOrganization(input.NamespaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if org != nil {
+		if q := org.Quotas.MaxDeployments; q > 0 && org.Usage.Deployments >= q {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Organization %s has reached its quota of %d deployments", org.Name, q)})
+			return
 		}
-		authDataBytes, _ := json.Marshal(authJSON)
-		encrypted, err := crypto.EncryptJSON(string(authDataBytes))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt authentication data"})
+		inheritDeploymentSettings(&input.DeploymentSettings, org.DefaultDeploymentSettings)
+		if !authType.Valid {
+			if data, ok := vcsConnectionAuth(vcs, input.GitURL); ok {
+				authType = sql.NullString{String: "http", Valid: true}
+				authData = data
+			}
+		}
+	}
+
+	if err := validateDeploymentSettings(&input.DeploymentSettings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var concurrencyJSON sql.NullString
+	if input.Concurrency != nil {
+		if err := validateConcurrencyOptions(input.Concurrency); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		concurrencyBytes, _ := json.Marshal(input.Concurrency)
+		concurrencyJSON = sql.NullString{String: string(concurrencyBytes), Valid: true}
+	}
+
+	var cloneJSON sql.NullString
+	if input.CloneOptions != nil {
+		cloneBytes, _ := json.Marshal(input.CloneOptions)
+		cloneJSON = sql.NullString{String: string(cloneBytes), Valid: true}
+	}
 
-		authType = sql.NullString{String: "http", Valid: true}
-		authData = sql.NullString{String: encrypted, Valid: true}
+	var pipelineJSON sql.NullString
+	if input.Pipeline != nil {
+		pipelineBytes, _ := json.Marshal(input.Pipeline)
+		pipelineJSON = sql.NullString{String: string(pipelineBytes), Valid: true}
+	}
+
+	var terragruntJSON sql.NullString
+	if input.Terragrunt != nil {
+		terragruntBytes, _ := json.Marshal(input.Terragrunt)
+		terragruntJSON = sql.NullString{String: string(terragruntBytes), Valid: true}
+	}
+
+	var watchJSON sql.NullString
+	if len(input.WatchPaths) > 0 {
+		watchBytes, _ := json.Marshal(input.WatchPaths)
+		watchJSON = sql.NullString{String: string(watchBytes), Valid: true}
+	}
+
+	var registryJSON sql.NullString
+	if len(input.RegistryNamespaces) > 0 {
+		registryBytes, _ := json.Marshal(input.RegistryNamespaces)
+		registryJSON = sql.NullString{String: string(registryBytes), Valid: true}
+	}
+
+	var hooksJSON sql.NullString
+	if input.Hooks != nil {
+		hooksBytes, _ := json.Marshal(input.Hooks)
+		hooksJSON = sql.NullString{String: string(hooksBytes), Valid: true}
 	}
 
 	deploymentID := generateID()
 	now := time.Now()
 
-	_, err := database.DB.Exec(`
-		INSERT INTO deployments (id, namespace_id, name, description, git_url, git_auth_type, git_auth_data, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-	`, deploymentID, input.NamespaceID, input.Name, input.Description, input.GitURL, authType, authData, now, now)
+	_, err = database.DB.Exec(`
+		INSERT INTO deployments (id, namespace_id, name, description, git_url, git_auth_type, git_auth_data, terraform_workspace, hooks, runner_image, auto_destroy_after, plan_validity, clone_options, pipeline, terragrunt, watch_paths, registry_namespaces, concurrency, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+	`, deploymentID, input.NamespaceID, input.Name, input.Description, input.GitURL, authType, authData, input.TerraformWorkspace, hooksJSON, input.RunnerImage, input.AutoDestroyAfter, input.PlanValidity, cloneJSON, pipelineJSON, terragruntJSON, watchJSON, registryJSON, concurrencyJSON, now, now)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") || strings.Contains(err.Error(), "duplicate key") {
 			c.JSON(http.StatusConflict, gin.H{"error": "A deployment with this name already exists in this namespace"})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -124,17 +215,363 @@ func CreateDeployment(c *gin.Context) {
 	}
 
 	// Get the created deployment with namespace
-	var deployment models.DeploymentWithNamespace
-	database.DB.QueryRow(`
-		SELECT d.id, d.namespace_id, d.name, d.description, d.git_url, d.created_at, d.updated_at, n.name as namespace
-		FROM deployments d
-		JOIN namespaces n ON d.namespace_id = n.id
-		WHERE d.id = $1
-	`, deploymentID).Scan(&deployment.ID, &deployment.NamespaceID, &deployment.Name, &deployment.Description, &deployment.GitURL, &deployment.CreatedAt, &deployment.UpdatedAt, &deployment.Namespace)
+	deployment, _ := scanDeployment(database.DB.QueryRow(deploymentSelect+` WHERE d.id = $1`, deploymentID))
 
 	c.JSON(http.StatusCreated, deployment)
 }
 
+// UpdateDeployment updates an existing deployment
+// PATCH /api/deployments/:id
+func UpdateDeployment(c *gin.Context) {
+	id := c.Param("id")
+
+	var input models.DeploymentUpdate
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	// Build dynamic update query
+	updates := []string{}
+	args := []interface{}{}
+	addUpdate := func(column string, value interface{}) {
+		args = append(args, value)
+		updates = append(updates, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if input.Description != nil {
+		addUpdate("description", *input.Description)
+	}
+	if input.TerraformWorkspace != nil {
+		addUpdate("terraform_workspace", *input.TerraformWorkspace)
+	}
+	if input.Hooks != nil {
+		if err := validateHooks(input.Hooks); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		hooksBytes, _ := json.Marshal(input.Hooks)
+		addUpdate("hooks", string(hooksBytes))
+	}
+	if input.RunnerImage != nil {
+		if *input.RunnerImage == "" {
+			addUpdate("runner_image", nil)
+		} else if !isValidImageRef(*input.RunnerImage) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid runner image reference"})
+			return
+		} else {
+			addUpdate("runner_image", *input.RunnerImage)
+		}
+	}
+	if input.AutoDestroyAfter != nil {
+		if *input.AutoDestroyAfter == "" {
+			addUpdate("auto_destroy_after", nil)
+		} else if !isValidTTL(*input.AutoDestroyAfter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "auto_destroy_after must be a positive duration (e.g., 72h)"})
+			return
+		} else {
+			addUpdate("auto_destroy_after", *input.AutoDestroyAfter)
+		}
+		addUpdate("auto_destroy_notified_at", nil)
+	}
+	if input.PlanValidity != nil {
+		if *input.PlanValidity == "" {
+			addUpdate("plan_validity", nil)
+		} else if !isValidTTL(*input.PlanValidity) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "plan_validity must be a positive duration (e.g., 24h)"})
+			return
+		} else {
+			addUpdate("plan_validity", *input.PlanValidity)
+		}
+	}
+	if input.CloneOptions != nil {
+		if err := validateCloneOptions(input.CloneOptions); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		cloneBytes, _ := json.Marshal(input.CloneOptions)
+		addUpdate("clone_options", string(cloneBytes))
+	}
+	if input.Pipeline != nil {
+		if err := validatePipelineOptions(input.Pipeline); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		pipelineBytes, _ := json.Marshal(input.Pipeline)
+		addUpdate("pipeline", string(pipelineBytes))
+	}
+	if input.Terragrunt != nil {
+		if err := validateTerragruntOptions(input.Terragrunt); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		terragruntBytes, _ := json.Marshal(input.Terragrunt)
+		addUpdate("terragrunt", string(terragruntBytes))
+	}
+	if input.WatchPaths != nil {
+		if len(*input.WatchPaths) == 0 {
+			addUpdate("watch_paths", nil)
+		} else if err := validateWatchPaths(*input.WatchPaths); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		} else {
+			watchBytes, _ := json.Marshal(*input.WatchPaths)
+			addUpdate("watch_paths", string(watchBytes))
+		}
+	}
+	if input.RegistryNamespaces != nil {
+		// Reading another namespace's modules and providers is granted by admins; dropping
+		// namespaces is not
+		var current []string
+		var registryJSON sql.NullString
+		database.DB.QueryRow(`SELECT registry_namespaces FROM deployments WHERE id = $1`, id).Scan(&registryJSON)
+		json.Unmarshal([]byte(registryJSON.String), &current)
+		widens := slices.ContainsFunc(*input.RegistryNamespaces, func(name string) bool { return !slices.Contains(current, name) })
+		if widens && !authorizeRole(c, "admin") {
+			return
+		}
+		if len(*input.RegistryNamespaces) == 0 {
+			addUpdate("registry_namespaces", nil)
+		} else if err := validateRegistryNamespaces(*input.RegistryNamespaces); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		} else {
+			registryBytes, _ := json.Marshal(*input.RegistryNamespaces)
+			addUpdate("registry_namespaces", string(registryBytes))
+		}
+	}
+	if input.Concurrency != nil {
+		if input.Concurrency.Group == "" && len(input.Concurrency.Workspaces) == 0 {
+			addUpdate("concurrency", nil)
+		} else if err := validateConcurrencyOptions(input.Concurrency); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		} else {
+			concurrencyBytes, _ := json.Marshal(input.Concurrency)
+			addUpdate("concurrency", string(concurrencyBytes))
+		}
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	addUpdate("updated_at", time.Now())
+	args = append(args, id)
+
+	query := fmt.Sprintf("UPDATE deployments SET %s WHERE id = $%d", strings.Join(updates, ", "), len(args))
+	result, err := database.DB.Exec(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found"})
+		return
+	}
+
+	deployment, err := scanDeployment(database.DB.QueryRow(deploymentSelect+` WHERE d.id = $1`, id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, deployment)
+}
+
+// commitSHAPattern matches full SHA-1 and SHA-256 commit IDs
+var commitSHAPattern = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// deploymentSelect is the base query used by scanDeployment
+const deploymentSelect = `
+	SELECT d.id, d.namespace_id, d.name, d.description, d.git_url, d.terraform_workspace, d.hooks, d.runner_image, d.auto_destroy_after, d.plan_validity, d.clone_options, d.pipeline, d.terragrunt, d.watch_paths, d.registry_namespaces, d.concurrency, d.credential_status, d.created_at, d.updated_at, n.name as namespace
+	FROM deployments d
+	JOIN namespaces n ON d.namespace_id = n.id
+`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanDeployment scans a row selected with deploymentSelect
+func scanDeployment(row rowScanner) (models.DeploymentWithNamespace, error) {
+	var d models.DeploymentWithNamespace
+	var hooksJSON, cloneJSON, pipelineJSON, terragruntJSON, watchJSON, registryJSON, concurrencyJSON sql.NullString
+
+	err := row.Scan(&d.ID, &d.NamespaceID, &d.Name, &d.Description, &d.GitURL, &d.TerraformWorkspace, &hooksJSON, &d.RunnerImage, &d.AutoDestroyAfter, &d.PlanValidity, &cloneJSON, &pipelineJSON, &terragruntJSON, &watchJSON, &registryJSON, &concurrencyJSON, &d.CredentialStatus, &d.CreatedAt, &d.UpdatedAt, &d.Namespace)
+	if err != nil {
+		return d, err
+	}
+
+	if hooksJSON.Valid && hooksJSON.String != "" {
+		json.Unmarshal([]byte(hooksJSON.String), &d.Hooks)
+	}
+	if d.Hooks.PreInit == nil {
+		d.Hooks.PreInit = make([]models.RunHook, 0)
+	}
+	if d.Hooks.PostApply == nil {
+		d.Hooks.PostApply = make([]models.RunHook, 0)
+	}
+	if cloneJSON.Valid && cloneJSON.String != "" {
+		json.Unmarshal([]byte(cloneJSON.String), &d.CloneOptions)
+	}
+	if d.CloneOptions.ExtraPaths == nil {
+		d.CloneOptions.ExtraPaths = make([]string, 0)
+	}
+	if pipelineJSON.Valid && pipelineJSON.String != "" {
+		json.Unmarshal([]byte(pipelineJSON.String), &d.Pipeline)
+	}
+	if d.Pipeline.PolicyChecks == nil {
+		d.Pipeline.PolicyChecks = make([]models.RunHook, 0)
+	}
+	if terragruntJSON.Valid && terragruntJSON.String != "" {
+		json.Unmarshal([]byte(terragruntJSON.String), &d.Terragrunt)
+	}
+	if watchJSON.Valid && watchJSON.String != "" {
+		json.Unmarshal([]byte(watchJSON.String), &d.WatchPaths)
+	}
+	if d.WatchPaths == nil {
+		d.WatchPaths = make([]string, 0)
+	}
+	if registryJSON.Valid && registryJSON.String != "" {
+		json.Unmarshal([]byte(registryJSON.String), &d.RegistryNamespaces)
+	}
+	if d.RegistryNamespaces == nil {
+		d.RegistryNamespaces = make([]string, 0)
+	}
+	if concurrencyJSON.Valid && concurrencyJSON.String != "" {
+		json.Unmarshal([]byte(concurrencyJSON.String), &d.Concurrency)
+	}
+
+	return d, nil
+}
+
+// validateDeploymentSettings checks the settings shared by deployments and deployment
+// templates
+func validateDeploymentSettings(s *models.DeploymentSettings) error {
+	if s.RunnerImage != nil && !isValidImageRef(*s.RunnerImage) {
+		return fmt.Errorf("Invalid runner image reference")
+	}
+	if s.AutoDestroyAfter != nil && *s.AutoDestroyAfter != "" && !isValidTTL(*s.AutoDestroyAfter) {
+		return fmt.Errorf("auto_destroy_after must be a positive duration (e.g., 72h)")
+	}
+	if s.PlanValidity != nil && *s.PlanValidity != "" && !isValidTTL(*s.PlanValidity) {
+		return fmt.Errorf("plan_validity must be a positive duration (e.g., 24h)")
+	}
+	if s.CloneOptions != nil {
+		if err := validateCloneOptions(s.CloneOptions); err != nil {
+			return err
+		}
+	}
+	if s.Pipeline != nil {
+		if err := validatePipelineOptions(s.Pipeline); err != nil {
+			return err
+		}
+	}
+	if s.Terragrunt != nil {
+		if err := validateTerragruntOptions(s.Terragrunt); err != nil {
+			return err
+		}
+	}
+	if len(s.WatchPaths) > 0 {
+		if err := validateWatchPaths(s.WatchPaths); err != nil {
+			return err
+		}
+	}
+	if len(s.RegistryNamespaces) > 0 {
+		if err := validateRegistryNamespaces(s.RegistryNamespaces); err != nil {
+			return err
+		}
+	}
+	if s.Hooks != nil {
+		if err := validateHooks(s.Hooks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// concurrencyGroupPattern matches concurrency group names such as "prod-network"
+var concurrencyGroupPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,99}$`)
+
+// validateConcurrencyOptions checks the names of concurrency groups
+func validateConcurrencyOptions(opts *models.ConcurrencyOptions) error {
+	if opts.Group != "" && !concurrencyGroupPattern.MatchString(opts.Group) {
+		return fmt.Errorf("concurrency group %q must be lowercase letters, digits, '.', '_' or '-'", opts.Group)
+	}
+	for workspace, group := range opts.Workspaces {
+		if workspace == "" || !concurrencyGroupPattern.MatchString(group) {
+			return fmt.Errorf("concurrency group %q of workspace %q must be lowercase letters, digits, '.', '_' or '-'", group, workspace)
+		}
+	}
+	return nil
+}
+
+// validateRegistryNamespaces checks that every namespace runs may read exists
+func validateRegistryNamespaces(names []string) error {
+	for _, name := range names {
+		var exists bool
+		err := database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM namespaces WHERE name = $1)`, name).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check registry namespace %q: %w", name, err)
+		}
+		if !exists {
+			return fmt.Errorf("registry namespace %q not found", name)
+		}
+	}
+	return nil
+}
+
+// validateHooks checks that every hook has a command and a known failure mode
+func validateHooks(hooks *models.DeploymentHooks) error {
+	return validateRunHooks(append(append([]models.RunHook{}, hooks.PreInit...), hooks.PostApply...))
+}
+
+// validatePipelineOptions checks the policy check commands like hooks
+func validatePipelineOptions(opts *models.PipelineOptions) error {
+	return validateRunHooks(opts.PolicyChecks)
+}
+
+// validateTerragruntOptions checks the binary terragrunt wraps
+func validateTerragruntOptions(opts *models.TerragruntOptions) error {
+	if opts.TFBinary != "" && opts.TFBinary != "terraform" && opts.TFBinary != "tofu" {
+		return fmt.Errorf("terragrunt tf_binary must be 'terraform' or 'tofu'")
+	}
+	return nil
+}
+
+func validateRunHooks(hooks []models.RunHook) error {
+	for _, hook := range hooks {
+		if strings.TrimSpace(hook.Command) == "" {
+			return fmt.Errorf("hook command is required")
+		}
+		if hook.OnFailure != "" && hook.OnFailure != "fail" && hook.OnFailure != "warn" {
+			return fmt.Errorf("hook on_failure must be 'fail' or 'warn'")
+		}
+		if hook.Timeout < 0 {
+			return fmt.Errorf("hook timeout must be a positive number of seconds")
+		}
+	}
+	return nil
+}
+
+// validateCloneOptions checks that sparse checkout paths stay inside the repository
+func validateCloneOptions(opts *models.CloneOptions) error {
+	for _, p := range opts.ExtraPaths {
+		if p == "" || strings.HasPrefix(p, "/") || strings.HasPrefix(p, "-") {
+			return fmt.Errorf("clone extra_paths must be relative directories within the repository")
+		}
+		for _, part := range strings.Split(p, "/") {
+			if part == ".." {
+				return fmt.Errorf("clone extra_paths must not contain '..'")
+			}
+		}
+	}
+	return nil
+}
+
 // DeleteDeployment deletes a deployment
 // DELETE /api/deployments/:id
 func DeleteDeployment(c *gin.Context) {
@@ -253,17 +690,71 @@ func GetDeploymentDirectory(c *gin.Context) {
 	}
 
 	// List directory
-	files, readme, err := git.ListDirectory(gitURL, ref, path, auth)
+	dir, err := git.ListDirectory(gitURL, ref, path, auth)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list directory: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"path":   path,
-		"files":  files,
-		"readme": readme,
-	})
+	listing := models.DirectoryListing{
+		Path:      path,
+		Files:     make([]models.FileNode, 0, len(dir.Entries)),
+		Readme:    dir.Readme,
+		HasGitOps: dir.IaCType != "",
+		IaCType:   dir.IaCType,
+	}
+	for _, e := range dir.Entries {
+		node := models.FileNode{
+			Name:               e.Name,
+			Path:               e.Path,
+			Type:               "file",
+			Size:               e.Size,
+			IsDir:              e.IsDir,
+			Deployable:         e.IaCType != "",
+			IaCType:            e.IaCType,
+			ContainsDeployable: e.ContainsIaC,
+		}
+		if e.IsDir {
+			node.Type = "dir"
+		}
+		listing.Files = append(listing.Files, node)
+	}
+
+	// The repository root shows the platform.yaml runs at this ref would use
+	if path == "" || path == "." {
+		if config, err := build.LoadPlatformConfig(id, ref); err != nil {
+			listing.PlatformConfigError = err.Error()
+		} else {
+			listing.PlatformConfig = config
+		}
+	}
+
+	c.JSON(http.StatusOK, listing)
+}
+
+// replayDeploymentRun answers a request whose Idempotency-Key already created a run with
+// that run, and reports whether it did
+func replayDeploymentRun(c *gin.Context, deploymentID, key, fingerprint string) bool {
+	runID, err := findIdempotent("deployment_runs", deploymentID, key, fingerprint)
+	if err == errIdempotencyMismatch {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+	if runID == "" {
+		return false
+	}
+	run, err := getDeploymentRun(runID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+	markReplayed(c)
+	c.JSON(http.StatusOK, run)
+	return true
 }
 
 // CreateDeploymentRun creates a new deployment run
@@ -272,26 +763,52 @@ func CreateDeploymentRun(c *gin.Context) {
 	id := c.Param("id")
 	var input models.DeploymentRunCreate
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
 		return
 	}
 
 	input.DeploymentID = id
 
-	// Validate tool
-	if input.Tool != "terraform" && input.Tool != "tofu" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Tool must be 'terraform' or 'tofu'"})
+	// A retried request with the same Idempotency-Key gets the run the first one created
+	key, err := idempotencyKey(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	fingerprint := requestFingerprint(input)
+	if key != "" && replayDeploymentRun(c, id, key, fingerprint) {
+		return
+	}
+
+	// Pinning a commit makes the run independent of where the ref points now
+	var commitSHA sql.NullString
+	if input.CommitSHA != "" {
+		input.CommitSHA = strings.ToLower(input.CommitSHA)
+		if !commitSHAPattern.MatchString(input.CommitSHA) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "commit_sha must be a full 40 or 64 character commit SHA"})
+			return
+		}
+		commitSHA = sql.NullString{String: input.CommitSHA, Valid: true}
+		if input.Ref == "" {
+			input.Ref = input.CommitSHA
+		}
+	}
+	if input.Ref == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ref or commit_sha is required"})
 		return
 	}
 
 	// Verify deployment exists
 	var gitURL, workingDirectory string
-	err := database.DB.QueryRow("SELECT git_url, working_directory FROM deployments WHERE id = $1", id).Scan(&gitURL, &workingDirectory)
+	var defaultWorkspace, runnerImage sql.NullString
+	err = database.DB.QueryRow("SELECT git_url, working_directory, terraform_workspace, runner_image FROM deployments WHERE id = $1", id).Scan(&gitURL, &workingDirectory, &defaultWorkspace, &runnerImage)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found"})
 		return
 	}
+	if !runQuotaAllows(c, id) {
+		return
+	}
 
 	// Use deployment's working_directory if path is not provided
 	deployPath := input.Path
@@ -299,24 +816,132 @@ func CreateDeploymentRun(c *gin.Context) {
 		deployPath = workingDirectory
 	}
 
+	// The repository's platform.yaml fills in what the request leaves out
+	configRef := input.Ref
+	if input.CommitSHA != "" {
+		configRef = input.CommitSHA
+	}
+	platformConfig, err := build.LoadPlatformConfig(id, configRef)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if platformConfig == nil {
+		platformConfig = &models.PlatformConfig{}
+	}
+	if runnerImage.String != "" {
+		// The deployment's image pins the tool versions (see build.RestrictPlatformConfig)
+		platformConfig.RunnerImage, platformConfig.ToolVersion = "", ""
+	}
+	if input.Tool == "" {
+		input.Tool = platformConfig.Tool
+	}
+	if input.Tool == "" {
+		// The runner detects the tool and version from the repository
+		input.Tool = "auto"
+	}
+	if len(input.TfvarsFiles) == 0 {
+		input.TfvarsFiles = platformConfig.VarFiles
+	}
+	if platformConfig.RunnerImage != "" {
+		runnerImage = sql.NullString{String: platformConfig.RunnerImage, Valid: true}
+	}
+
+	// A configuration using language features the tool cannot run fails here, naming the
+	// feature, rather than inside init. The check is skipped when the code cannot be read;
+	// the run then reports the clone failure itself.
+	var requiredFeatures []string
+	features, err := build.LoadToolFeatures(id, configRef, deployPath)
+	if err != nil {
+		log.Printf("Failed to detect the language features of deployment %s at %s: %v", id, configRef, err)
+	} else {
+		// A namespace bound to no qualifying runner fails when the run starts
+		runners, _ := build.DeploymentRunnerPool(id)
+		input.Tool, err = build.CheckToolFeatures(input.Tool, platformConfig.ToolVersion, runnerImage.String, runners, features)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "features": features})
+			return
+		}
+		for _, f := range features {
+			requiredFeatures = append(requiredFeatures, f.Key)
+		}
+	}
+
+	// Use the platform.yaml's first workspace, then the deployment's terraform_workspace,
+	// if workspace is not provided
+	workspace := input.TerraformWorkspace
+	if workspace == "" && len(platformConfig.Workspaces) > 0 {
+		workspace = platformConfig.Workspaces[0]
+	}
+	if workspace == "" && defaultWorkspace.Valid {
+		workspace = defaultWorkspace.String
+	}
+	if len(platformConfig.Workspaces) > 0 && !slices.Contains(platformConfig.Workspaces, workspace) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("workspace %q is not one of the workspaces in platform.yaml", workspace)})
+		return
+	}
+
+	operation := "apply"
+	if input.Destroy {
+		operation = "destroy"
+	}
+
+	// Resolve the outputs the run consumes now, so a missing output fails the request
+	inputs, err := build.ResolveRunInputs(id, input.Inputs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, in := range inputs {
+		if _, ok := input.EnvVars["TF_VAR_"+in.Variable]; ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "env_vars already sets TF_VAR_" + in.Variable + ", which is passed from an input"})
+			return
+		}
+	}
+
 	runID := generateID()
 	now := time.Now()
 
-	// Serialize env vars to JSON
-	envVarsJSON, _ := json.Marshal(input.EnvVars)
+	// Env vars often hold cloud credentials, so they are stored encrypted
+	envVars, err := crypto.EncryptEnvVars(input.EnvVars)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt env vars"})
+		return
+	}
 
 	// Serialize tfvars files to JSON
 	tfvarsFilesJSON, _ := json.Marshal(input.TfvarsFiles)
+	var requiredFeaturesJSON *string
+	if len(requiredFeatures) > 0 {
+		data, _ := json.Marshal(requiredFeatures)
+		value := string(data)
+		requiredFeaturesJSON = &value
+	}
 
-	_, err = database.DB.Exec(`
-		INSERT INTO deployment_runs (id, deployment_id, path, ref, tool, env_vars, tfvars_files, init_flags, plan_flags, status, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, 'pending', $10)
-	`, runID, input.DeploymentID, deployPath, input.Ref, input.Tool, string(envVarsJSON), string(tfvarsFilesJSON), input.InitFlags, input.PlanFlags, now)
+	result, err := database.DB.Exec(`
+		INSERT INTO deployment_runs (id, deployment_id, path, ref, commit_sha, tool, env_vars, tfvars_files, init_flags, plan_flags, terraform_workspace, operation,
+		                             idempotency_key, idempotency_fingerprint, required_features, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, 'pending', $16)
+		ON CONFLICT (deployment_id, idempotency_key) WHERE idempotency_key IS NOT NULL DO NOTHING
+	`, runID, input.DeploymentID, deployPath, input.Ref, commitSHA, input.Tool, envVars, string(tfvarsFilesJSON), input.InitFlags, input.PlanFlags, workspace, operation,
+		nullableKey(key), fingerprint, requiredFeaturesJSON, now)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		// A concurrent request with the same key created the run first
+		if !replayDeploymentRun(c, id, key, fingerprint) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Run was not created, retry the request"})
+		}
+		return
+	}
+
+	if err := build.SaveRunInputs(runID, inputs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Get the created run
 	run, err := getDeploymentRun(runID)
@@ -326,7 +951,7 @@ func CreateDeploymentRun(c *gin.Context) {
 	}
 
 	// Start the deployment asynchronously
-	go build.ExecuteDeploymentRun(runID, id, deployPath, input.Ref, input.Tool, input.EnvVars, input.TfvarsFiles, input.InitFlags, input.PlanFlags)
+	go build.ExecuteDeploymentRun(runID, id, deployPath, input.Ref, input.Tool, input.TfvarsFiles, input.InitFlags, input.PlanFlags, workspace)
 
 	c.JSON(http.StatusCreated, run)
 }
@@ -369,7 +994,8 @@ func ListDeploymentRuns(c *gin.Context) {
 		if err := rows.Scan(&runID); err != nil {
 			continue
 		}
-		run, err := getDeploymentRun(runID)
+		// Listed without the encrypted artifacts, which only the run detail returns
+		run, err := loadDeploymentRun(runID, false)
 		if err != nil {
 			continue
 		}
@@ -398,12 +1024,12 @@ func GetDirectoryStatus(c *gin.Context) {
 	// Get last run for this path
 	var run models.DeploymentRun
 	err := database.DB.QueryRow(`
-		SELECT id, deployment_id, path, ref, status, error_message, created_at, started_at, completed_at
+		SELECT id, deployment_id, path, ref, commit_sha, status, error_message, created_at, started_at, completed_at
 		FROM deployment_runs
 		WHERE deployment_id = $1 AND path = $2
 		ORDER BY created_at DESC
 		LIMIT 1
-	`, id, path).Scan(&run.ID, &run.DeploymentID, &run.Path, &run.Ref, &run.Status, &run.ErrorMessage, &run.CreatedAt, &run.StartedAt, &run.CompletedAt)
+	`, id, path).Scan(&run.ID, &run.DeploymentID, &run.Path, &run.Ref, &run.CommitSHA, &run.Status, &run.ErrorMessage, &run.CreatedAt, &run.StartedAt, &run.CompletedAt)
 
 	if err == nil {
 		status.LastRun = &run
@@ -412,7 +1038,7 @@ func GetDirectoryStatus(c *gin.Context) {
 		switch run.Status {
 		case "success":
 			status.StatusColor = "green"
-		case "pending", "initializing", "planning", "applying":
+		case "pending", "initializing", "planning", "applying", "importing", "modifying_state", "destroying", "runner_unreachable":
 			status.StatusColor = "yellow"
 		case "awaiting_approval":
 			status.StatusColor = "purple"
@@ -420,6 +1046,8 @@ func GetDirectoryStatus(c *gin.Context) {
 			status.StatusColor = "red"
 		case "cancelled":
 			status.StatusColor = "gray"
+		case "stale", "expired":
+			status.StatusColor = "orange"
 		default:
 			status.StatusColor = "blue"
 		}
@@ -428,12 +1056,18 @@ func GetDirectoryStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, status)
 }
 
-// GetDeploymentRun gets a single deployment run by ID
+// GetDeploymentRun gets a single deployment run by ID. Its logs and outputs are only
+// decrypted and returned to callers with a read key or session; without credentials they
+// are left empty.
 // GET /api/deployments/:id/runs/:runId
 func GetDeploymentRun(c *gin.Context) {
 	runID := c.Param("runId")
 
-	run, err := getDeploymentRun(runID)
+	withArtifacts := hasCredentials(c)
+	if withArtifacts && !authorizeRole(c, "read") {
+		return
+	}
+	run, err := loadDeploymentRun(runID, withArtifacts)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
 		return
@@ -442,52 +1076,359 @@ func GetDeploymentRun(c *gin.Context) {
 	c.JSON(http.StatusOK, run)
 }
 
+// GetDeploymentRunApplyReport returns the per-resource results of a run's apply,
+// including resources that completed before a partial failure
+// GET /api/deployments/:id/runs/:runId/apply-report
+func GetDeploymentRunApplyReport(c *gin.Context) {
+	runID := c.Param("runId")
+
+	run, err := getDeploymentRun(runID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return
+	}
+
+	report := models.ApplyReport{
+		RunID:     run.ID,
+		Status:    run.Status,
+		Resources: run.ApplyReport,
+	}
+	for _, res := range run.ApplyReport {
+		switch res.Status {
+		case "complete":
+			report.Complete++
+		case "errored":
+			report.Errored++
+		default:
+			report.Pending++
+		}
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetDeploymentRunChanges returns the plan of a run as a change list grouped by action
+// GET /api/deployments/:id/runs/:runId/changes
+func GetDeploymentRunChanges(c *gin.Context) {
+	var status string
+	var planJSON sql.NullString
+	err := database.DB.QueryRow(`SELECT status, plan_json FROM deployment_runs WHERE id = $1 AND deployment_id = $2`,
+		c.Param("runId"), c.Param("id")).Scan(&status, &planJSON)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return
+	}
+
+	summary := &models.PlanSummary{
+		Counts:  map[string]int{},
+		Groups:  []models.PlanChangeGroup{},
+		Outputs: []models.PlanOutputChange{},
+	}
+	if planJSON.Valid && planJSON.String != "" {
+		summary, err = plan.Summarize([]byte(build.OpenArtifact(planJSON)))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	summary.RunID = c.Param("runId")
+	summary.Status = status
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// GetDeploymentRunStages returns the pipeline stages of a run with their status, timing and logs
+// GET /api/deployments/:id/runs/:runId/stages
+func GetDeploymentRunStages(c *gin.Context) {
+	run, err := getDeploymentRun(c.Param("runId"))
+	if err != nil || run.DeploymentID != c.Param("id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT name, status, started_at, completed_at, duration_seconds, log, error, reused
+		FROM deployment_run_stages
+		WHERE run_id = $1
+		ORDER BY position
+	`, run.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	stages := []models.DeploymentRunStage{}
+	for rows.Next() {
+		var stage models.DeploymentRunStage
+		var startedAt, completedAt sql.NullTime
+		var duration sql.NullFloat64
+		var stageLog, stageError sql.NullString
+		if err := rows.Scan(&stage.Name, &stage.Status, &startedAt, &completedAt, &duration, &stageLog, &stageError, &stage.Reused); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if startedAt.Valid {
+			stage.StartedAt = &startedAt.Time
+		}
+		if completedAt.Valid {
+			stage.CompletedAt = &completedAt.Time
+		}
+		stage.DurationSeconds = duration.Float64
+		stage.Log = stageLog.String
+		stage.Error = stageError.String
+		stages = append(stages, stage)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"run_id": run.ID, "status": run.Status, "stages": stages})
+}
+
 // ApproveDeploymentRun approves or rejects a deployment run
 // POST /api/deployments/:id/runs/:runId/approve
 func ApproveDeploymentRun(c *gin.Context) {
 	runID := c.Param("runId")
 	var input models.DeploymentRunApproval
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
 		return
 	}
 
 	// Check that run is in awaiting_approval state
-	var status string
-	err := database.DB.QueryRow(`SELECT status FROM deployment_runs WHERE id = $1`, runID).Scan(&status)
-	if err != nil {
+	var deploymentID, status string
+	var planExpiresAt sql.NullTime
+	var decided sql.NullString
+	err := database.DB.QueryRow(`SELECT deployment_id, status, plan_expires_at, approved_by FROM deployment_runs WHERE id = $1`, runID).
+		Scan(&deploymentID, &status, &planExpiresAt, &decided)
+	if err != nil || deploymentID != c.Param("id") {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
 		return
 	}
 
+	if status == "stale" || status == "expired" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Plan is " + status + "; re-plan the run before approving"})
+		return
+	}
 	if status != "awaiting_approval" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Run is not awaiting approval"})
 		return
 	}
 
-	// Update approval status
-	approvedBy := input.ApprovedBy
+	// A scheduled apply keeps the run awaiting approval until its window opens
+	if decided.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "Run has already been approved or rejected"})
+		return
+	}
+
+	// The run is marked expired shortly after; never approve an expired plan
+	if input.Approved && planExpiresAt.Valid && time.Now().After(planExpiresAt.Time) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Plan expired at " + planExpiresAt.Time.Format(time.RFC3339) + "; re-plan the run before approving"})
+		return
+	}
+
+	input.Comment = strings.TrimSpace(input.Comment)
+	input.ChangeTicket = strings.TrimSpace(input.ChangeTicket)
+	if input.Comment == "" && os.Getenv("APPROVAL_REQUIRE_COMMENT") == "true" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A comment is required"})
+		return
+	}
+	if input.Approved {
+		if input.ChangeTicket == "" && os.Getenv("APPROVAL_REQUIRE_CHANGE_TICKET") == "true" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A change ticket is required to approve"})
+			return
+		}
+		if len(input.ChangeTicket) > 255 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "change_ticket must be at most 255 characters"})
+			return
+		}
+		if input.ApplyNotBefore != nil && planExpiresAt.Valid && !input.ApplyNotBefore.Before(planExpiresAt.Time) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "apply_not_before must be before the plan expires at " + planExpiresAt.Time.Format(time.RFC3339)})
+			return
+		}
+	} else {
+		input.ApplyNotBefore = nil
+	}
+
+	// The decision is recorded under the key that made it (see RequireRole)
+	approvedBy := c.GetString("api_key_name")
 	if !input.Approved {
 		approvedBy = "REJECTED"
 	}
 
+	var comment, changeTicket sql.NullString
+	if input.Comment != "" {
+		comment = sql.NullString{String: input.Comment, Valid: true}
+	}
+	if input.ChangeTicket != "" {
+		changeTicket = sql.NullString{String: input.ChangeTicket, Valid: true}
+	}
+
+	// approved_by IS NULL: of concurrent approvals or rejections only the first is recorded
 	now := time.Now()
-	_, err = database.DB.Exec(`
+	result, err := database.DB.Exec(`
 		UPDATE deployment_runs 
-		SET approved_by = $1, approved_at = $2
-		WHERE id = $3
-	`, approvedBy, now, runID)
+		SET approved_by = $1, approved_at = $2, approval_comment = $3, change_ticket = $4, apply_not_before = $5
+		WHERE id = $6 AND approved_by IS NULL
+	`, approvedBy, now, comment, changeTicket, input.ApplyNotBefore, runID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Run has already been approved or rejected"})
+		return
+	}
 
 	run, _ := getDeploymentRun(runID)
 	c.JSON(http.StatusOK, run)
 }
 
+// ReplanDeploymentRun starts a fresh plan with the settings of a stale, expired, failed or cancelled run
+// POST /api/deployments/:id/runs/:runId/replan
+func ReplanDeploymentRun(c *gin.Context) {
+	parent, err := getDeploymentRun(c.Param("runId"))
+	if err != nil || parent.DeploymentID != c.Param("id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return
+	}
+	if parent.Operation != "apply" && parent.Operation != "destroy" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only apply and destroy runs can be re-planned"})
+		return
+	}
+	if parent.Status != "stale" && parent.Status != "expired" && parent.Status != "failed" && parent.Status != "cancelled" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only stale, expired, failed or cancelled runs can be re-planned"})
+		return
+	}
+	if !runQuotaAllows(c, parent.DeploymentID) {
+		return
+	}
+
+	// Plan the current tip of the ref, unless the run was created for an explicit commit
+	var commitSHA sql.NullString
+	if parent.CommitSHA != nil && *parent.CommitSHA == parent.Ref {
+		commitSHA = sql.NullString{String: *parent.CommitSHA, Valid: true}
+	}
+
+	runID := generateID()
+	tfvarsFilesJSON, _ := json.Marshal(parent.TfvarsFiles)
+	_, err = database.DB.Exec(`
+		INSERT INTO deployment_runs (id, deployment_id, path, ref, commit_sha, tool, env_vars, tfvars_files, init_flags, plan_flags,
+		                             terraform_workspace, operation, parent_run_id, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, 'pending', $14)
+	`, runID, parent.DeploymentID, parent.Path, parent.Ref, commitSHA, parent.Tool, parent.StoredEnvVars, string(tfvarsFilesJSON),
+		parent.InitFlags, parent.PlanFlags, parent.TerraformWorkspace, parent.Operation, parent.ID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := build.CopyRunInputs(parent.ID, runID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	run, err := getDeploymentRun(runID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	go build.ExecuteDeploymentRun(runID, parent.DeploymentID, parent.Path, parent.Ref, parent.Tool, parent.TfvarsFiles, parent.InitFlags, parent.PlanFlags, parent.TerraformWorkspace)
+
+	c.JSON(http.StatusCreated, run)
+}
+
+// GetDeploymentRunManifest returns the snapshot of everything a run started with
+// GET /api/deployments/:id/runs/:runId/manifest
+func GetDeploymentRunManifest(c *gin.Context) {
+	var exists bool
+	database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM deployment_runs WHERE id = $1 AND deployment_id = $2)`,
+		c.Param("runId"), c.Param("id")).Scan(&exists)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return
+	}
+
+	manifest, err := build.LoadRunManifest(c.Param("runId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if manifest == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run has no manifest; it has not started or started before manifests were recorded"})
+		return
+	}
+	c.JSON(http.StatusOK, manifest)
+}
+
+// ReproduceDeploymentRun starts a new run that replays the manifest of a finished apply or
+// destroy run: the same commit, tool version, settings and env vars, whatever changed since
+// POST /api/deployments/:id/runs/:runId/reproduce
+func ReproduceDeploymentRun(c *gin.Context) {
+	source, err := getDeploymentRun(c.Param("runId"))
+	if err != nil || source.DeploymentID != c.Param("id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return
+	}
+	if source.Operation != "apply" && source.Operation != "destroy" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only apply and destroy runs can be reproduced"})
+		return
+	}
+	switch source.Status {
+	case "success", "failed", "cancelled", "stale", "expired":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only finished runs can be reproduced"})
+		return
+	}
+	manifest, err := build.LoadRunManifest(source.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if manifest == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Run has no manifest to reproduce"})
+		return
+	}
+	if manifest.CommitSHA == "" || manifest.Tool == "auto" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Run failed before its commit and tool were resolved and cannot be reproduced exactly"})
+		return
+	}
+	if !runQuotaAllows(c, source.DeploymentID) {
+		return
+	}
+
+	// The new run carries the env vars the source received, inputs included
+	var manifestEnvVars sql.NullString
+	database.DB.QueryRow(`SELECT manifest_env_vars FROM deployment_runs WHERE id = $1`, source.ID).Scan(&manifestEnvVars)
+
+	runID := generateID()
+	tfvarsFilesJSON, _ := json.Marshal(manifest.TfvarsFiles)
+	_, err = database.DB.Exec(`
+		INSERT INTO deployment_runs (id, deployment_id, path, ref, commit_sha, tool, tool_version, env_vars, tfvars_files, init_flags, plan_flags,
+		                             terraform_workspace, operation, reproduces_run_id, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, $10, $11, $12, $13, $14, 'pending', $15)
+	`, runID, source.DeploymentID, manifest.Path, manifest.Ref, manifest.CommitSHA, manifest.Tool, manifest.ToolVersion, manifestEnvVars,
+		string(tfvarsFilesJSON), manifest.InitFlags, manifest.PlanFlags, manifest.Workspace, manifest.Operation, source.ID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := build.CopyRunInputs(source.ID, runID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	run, err := getDeploymentRun(runID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	go build.ExecuteDeploymentRun(runID, source.DeploymentID, manifest.Path, manifest.Ref, manifest.Tool, manifest.TfvarsFiles,
+		manifest.InitFlags, manifest.PlanFlags, manifest.Workspace)
+
+	c.JSON(http.StatusCreated, run)
+}
+
 // CancelDeploymentRun cancels a running deployment
 // POST /api/deployments/:id/runs/:runId/cancel
 func CancelDeploymentRun(c *gin.Context) {
@@ -503,7 +1444,7 @@ func CancelDeploymentRun(c *gin.Context) {
 	}
 
 	// Check if run can be cancelled
-	cancellableStatuses := []string{"pending", "initializing", "planning", "awaiting_approval", "applying"}
+	cancellableStatuses := []string{"pending", "initializing", "planning", "awaiting_approval", "applying", "importing", "modifying_state", "destroying", "runner_unreachable"}
 	canCancel := false
 	for _, s := range cancellableStatuses {
 		if status == s {
@@ -519,12 +1460,7 @@ func CancelDeploymentRun(c *gin.Context) {
 
 	// Send cancel request to runner if it has started
 	if workDir.Valid && workDir.String != "" {
-		runnerURL := os.Getenv("RUNNER_URL")
-		if runnerURL == "" {
-			runnerURL = "http://runner:8080"
-		}
-
-		resp, err := http.Post(runnerURL+"/deploy/"+workDir.String+"/cancel", "application/json", nil)
+		resp, err := build.RunnerClient().Post(build.RunRunnerURL(runID)+"/deploy/"+workDir.String+"/cancel", "application/json", nil)
 		if err == nil {
 			defer resp.Body.Close()
 		}
@@ -567,7 +1503,7 @@ func DeleteDeploymentRun(c *gin.Context) {
 	}
 
 	// Don't allow deletion of active runs
-	activeStatuses := []string{"pending", "initializing", "planning", "awaiting_approval", "applying"}
+	activeStatuses := []string{"pending", "initializing", "planning", "awaiting_approval", "applying", "importing", "modifying_state", "destroying", "runner_unreachable"}
 	for _, s := range activeStatuses {
 		if status == s {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete an active run. Please cancel it first."})
@@ -591,21 +1527,32 @@ func DeleteDeploymentRun(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Run deleted successfully"})
 }
 
-// getDeploymentRun is a helper to fetch a deployment run with all fields
+// getDeploymentRun is a helper to fetch a deployment run without its encrypted artifacts,
+// which only GetDeploymentRun returns
 func getDeploymentRun(runID string) (*models.DeploymentRun, error) {
+	return loadDeploymentRun(runID, false)
+}
+
+// loadDeploymentRun fetches a deployment run; the artifacts encrypted at rest (plan and
+// apply outputs, logs) are only decrypted and returned with withArtifacts
+func loadDeploymentRun(runID string, withArtifacts bool) (*models.DeploymentRun, error) {
 	var run models.DeploymentRun
-	var envVarsJSON, tfvarsFilesJSON, initLog, planLog, planOutput, applyLog, applyOutput, workDir, approvedBy, initFlags, planFlags sql.NullString
+	var envVarsJSON, tfvarsFilesJSON, initLog, planLog, planOutput, applyLog, applyOutput, hookLog, applyReport, operationArgs, parentRunID, operationResult, codeChanges, stateLock, commandExit, workDir, approvedBy, initFlags, planFlags, workspace, requiredFeatures sql.NullString
 
 	err := database.DB.QueryRow(`
-		SELECT id, deployment_id, path, ref, tool, env_vars, tfvars_files, init_flags, plan_flags, status, 
-		       init_log, plan_log, plan_output, apply_log, apply_output, error_message, work_dir,
-		       approved_by, approved_at, created_at, started_at, completed_at
+		SELECT id, deployment_id, path, ref, commit_sha, tool, tool_version, env_vars, tfvars_files, init_flags, plan_flags, terraform_workspace, status,
+		       init_log, plan_log, plan_output, apply_log, apply_output, hook_log, apply_report,
+		       operation, operation_args, parent_run_id, reproduces_run_id, stack_run_id, operation_result, code_changes, error_message, failure_category, failure_hint, state_lock, command_exit, work_dir,
+		       runner_url, approved_by, approved_at, plan_expires_at, approval_comment, change_ticket, apply_not_before, concurrency_group, required_features,
+		       created_at, started_at, completed_at
 		FROM deployment_runs
 		WHERE id = $1
 	`, runID).Scan(
-		&run.ID, &run.DeploymentID, &run.Path, &run.Ref, &run.Tool,
-		&envVarsJSON, &tfvarsFilesJSON, &initFlags, &planFlags, &run.Status, &initLog, &planLog, &planOutput, &applyLog, &applyOutput,
-		&run.ErrorMessage, &workDir, &approvedBy, &run.ApprovedAt,
+		&run.ID, &run.DeploymentID, &run.Path, &run.Ref, &run.CommitSHA, &run.Tool, &run.ToolVersion,
+		&envVarsJSON, &tfvarsFilesJSON, &initFlags, &planFlags, &workspace, &run.Status, &initLog, &planLog, &planOutput, &applyLog, &applyOutput, &hookLog, &applyReport,
+		&run.Operation, &operationArgs, &parentRunID, &run.ReproducesRunID, &run.StackRunID, &operationResult, &codeChanges,
+		&run.ErrorMessage, &run.FailureCategory, &run.FailureHint, &stateLock, &commandExit, &workDir, &run.RunnerURL, &approvedBy, &run.ApprovedAt, &run.PlanExpiresAt,
+		&run.ApprovalComment, &run.ChangeTicket, &run.ApplyNotBefore, &run.ConcurrencyGroup, &requiredFeatures,
 		&run.CreatedAt, &run.StartedAt, &run.CompletedAt,
 	)
 
@@ -613,12 +1560,9 @@ func getDeploymentRun(runID string) (*models.DeploymentRun, error) {
 		return nil, err
 	}
 
-	// Parse env vars
-	if envVarsJSON.Valid && envVarsJSON.String != "" {
-		json.Unmarshal([]byte(envVarsJSON.String), &run.EnvVars)
-	} else {
-		run.EnvVars = make(map[string]string)
-	}
+	// Env vars are returned with their values redacted (see RevealRunEnvVars)
+	run.StoredEnvVars = envVarsJSON.String
+	run.EnvVars = redactEnvVars(envVarsJSON.String)
 
 	// Parse tfvars files
 	if tfvarsFilesJSON.Valid && tfvarsFilesJSON.String != "" {
@@ -626,22 +1570,64 @@ func getDeploymentRun(runID string) (*models.DeploymentRun, error) {
 	} else {
 		run.TfvarsFiles = make([]string, 0)
 	}
+	if requiredFeatures.Valid && requiredFeatures.String != "" {
+		json.Unmarshal([]byte(requiredFeatures.String), &run.RequiredFeatures)
+	}
 
 	// Set nullable strings
-	if initLog.Valid {
-		run.InitLog = initLog.String
+	if initLog.Valid && withArtifacts {
+		run.InitLog = build.OpenArtifact(initLog)
+	}
+	if planLog.Valid && withArtifacts {
+		run.PlanLog = build.OpenArtifact(planLog)
+	}
+	if planOutput.Valid && withArtifacts {
+		run.PlanOutput = build.OpenArtifact(planOutput)
+	}
+	if applyLog.Valid && withArtifacts {
+		run.ApplyLog = build.OpenArtifact(applyLog)
+	}
+	if applyOutput.Valid && withArtifacts {
+		run.ApplyOutput = build.OpenArtifact(applyOutput)
+	}
+	if hookLog.Valid && withArtifacts {
+		run.HookLog = build.OpenArtifact(hookLog)
+	}
+	if applyReport.Valid && applyReport.String != "" {
+		json.Unmarshal([]byte(applyReport.String), &run.ApplyReport)
+	}
+	if run.ApplyReport == nil {
+		run.ApplyReport = make([]models.ApplyResourceResult, 0)
+	}
+	if operationArgs.Valid && operationArgs.String != "" {
+		run.OperationArgs = json.RawMessage(operationArgs.String)
+	}
+	if parentRunID.Valid {
+		run.ParentRunID = &parentRunID.String
 	}
-	if planLog.Valid {
-		run.PlanLog = planLog.String
+	if operationResult.Valid && operationResult.String != "" {
+		var result models.OperationResult
+		if err := json.Unmarshal([]byte(operationResult.String), &result); err == nil {
+			run.OperationResult = &result
+		}
 	}
-	if planOutput.Valid {
-		run.PlanOutput = planOutput.String
+	if codeChanges.Valid && codeChanges.String != "" {
+		var changes models.RunCodeChanges
+		if err := json.Unmarshal([]byte(codeChanges.String), &changes); err == nil {
+			run.CodeChanges = &changes
+		}
 	}
-	if applyLog.Valid {
-		run.ApplyLog = applyLog.String
+	if stateLock.Valid && stateLock.String != "" {
+		var lock models.StateLock
+		if err := json.Unmarshal([]byte(stateLock.String), &lock); err == nil {
+			run.StateLock = &lock
+		}
 	}
-	if applyOutput.Valid {
-		run.ApplyOutput = applyOutput.String
+	if commandExit.Valid && commandExit.String != "" {
+		var exit models.CommandExit
+		if err := json.Unmarshal([]byte(commandExit.String), &exit); err == nil {
+			run.CommandExit = &exit
+		}
 	}
 	if workDir.Valid {
 		run.WorkDir = workDir.String
@@ -655,10 +1641,102 @@ func getDeploymentRun(runID string) (*models.DeploymentRun, error) {
 	if planFlags.Valid {
 		run.PlanFlags = planFlags.String
 	}
+	if workspace.Valid {
+		run.TerraformWorkspace = workspace.String
+	}
 
 	return &run, nil
 }
 
+// GetDeploymentRunLogs returns the logs of a run as stored with the runner's escape
+// sequences (format=raw, the default), as plain text (plain) or rendered to HTML (html)
+// GET /api/deployments/:id/runs/:runId/logs?format=plain
+func GetDeploymentRunLogs(c *gin.Context) {
+	format := c.DefaultQuery("format", "raw")
+	if format != "raw" && format != "plain" && format != "html" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be raw, plain or html"})
+		return
+	}
+
+	var exists bool
+	database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM deployment_runs WHERE id = $1 AND deployment_id = $2)`,
+		c.Param("runId"), c.Param("id")).Scan(&exists)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return
+	}
+
+	logs, err := build.LoadRunLogs(c.Param("runId"), format)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, logs)
+}
+
+// runLogPhases are the phases whose logs can be downloaded, in run order
+var runLogPhases = []string{"init", "plan", "apply", "hooks"}
+
+// DownloadDeploymentRunLogs sends the logs of one phase of a run (init, plan, apply or
+// hooks; all of them by default) as a text file attachment, ANSI-stripped unless
+// format=raw, and gzip-compressed with gzip=true
+// GET /api/deployments/:id/runs/:runId/logs/download?phase=plan
+func DownloadDeploymentRunLogs(c *gin.Context) {
+	phase := c.DefaultQuery("phase", "all")
+	format := c.DefaultQuery("format", "plain")
+	if format != "raw" && format != "plain" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be raw or plain"})
+		return
+	}
+	if phase != "all" && !slices.Contains(runLogPhases, phase) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "phase must be init, plan, apply, hooks or all"})
+		return
+	}
+
+	var exists bool
+	database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM deployment_runs WHERE id = $1 AND deployment_id = $2)`,
+		c.Param("runId"), c.Param("id")).Scan(&exists)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return
+	}
+
+	logs, err := build.LoadRunLogs(c.Param("runId"), format)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	byPhase := map[string]string{"init": logs.InitLog, "plan": logs.PlanLog, "apply": logs.ApplyLog, "hooks": logs.HookLog}
+	var content string
+	if phase == "all" {
+		// One section per phase that has output, headed by its name
+		var sections []string
+		for _, p := range runLogPhases {
+			if byPhase[p] != "" {
+				sections = append(sections, "==> "+p+" <==\n"+strings.TrimRight(byPhase[p], "\n")+"\n")
+			}
+		}
+		content = strings.Join(sections, "\n")
+	} else {
+		content = byPhase[phase]
+	}
+
+	filename := fmt.Sprintf("run-%s-%s.log", c.Param("runId"), phase)
+	if c.Query("gzip") != "true" {
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(content))
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`.gz"`)
+	c.Header("Content-Type", "application/gzip")
+	c.Status(http.StatusOK)
+	gz := gzip.NewWriter(c.Writer)
+	if _, err := io.WriteString(gz, content); err != nil {
+		log.Printf("Run %s: failed to send logs: %v", c.Param("runId"), err)
+	}
+	gz.Close()
+}
+
 // StreamDeploymentRunLogs streams real-time logs from the runner
 // GET /api/deployments/:id/runs/:runId/stream
 func StreamDeploymentRunLogs(c *gin.Context) {
@@ -674,14 +1752,23 @@ func StreamDeploymentRunLogs(c *gin.Context) {
 
 	runnerDeploymentID := workDir.String
 
-	// Get runner URL
-	runnerURL := os.Getenv("RUNNER_URL")
-	if runnerURL == "" {
-		runnerURL = "http://runner:8080"
+	// Proxy the SSE stream from runner until the client goes away or the server shuts
+	// down; clients reconnect to another instance then
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-server.ShuttingDown():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, build.RunRunnerURL(runID)+"/deploy/"+runnerDeploymentID+"/logs", nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-
-	// Proxy the SSE stream from runner
-	resp, err := http.Get(runnerURL + "/deploy/" + runnerDeploymentID + "/logs")
+	resp, err := build.RunnerClient().Do(req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to runner"})
 		return
@@ -711,7 +1798,7 @@ func StreamDeploymentRunLogs(c *gin.Context) {
 			flusher.Flush()
 		}
 		if err != nil {
-			if err != io.EOF {
+			if err != io.EOF && ctx.Err() == nil {
 				log.Printf("Stream error: %v", err)
 			}
 			break
@@ -719,7 +1806,8 @@ func StreamDeploymentRunLogs(c *gin.Context) {
 	}
 }
 
-// GetTfvarsFiles lists available .tfvars files in a deployment directory
+// GetTfvarsFiles lists the .tfvars files in a deployment directory with their contents and
+// the variables the directory's .tf files declare, for structured editing
 // GET /api/deployments/:id/tfvars?ref=main&path=/
 func GetTfvarsFiles(c *gin.Context) {
 	id := c.Param("id")
@@ -760,24 +1848,70 @@ func GetTfvarsFiles(c *gin.Context) {
 		}
 	}
 
-	// List directory
-	files, _, err := git.ListDirectory(gitURL, ref, path, auth)
+	// Read the .tfvars files and the .tf files declaring the variables in one fetch
+	isTfvars := func(name string) bool {
+		return strings.HasSuffix(name, ".tfvars") || strings.HasSuffix(name, ".tfvars.json")
+	}
+	contents, err := git.DirectoryFiles(gitURL, ref, path, auth, func(name string) bool {
+		return isTfvars(name) || strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".tofu")
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list directory: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read directory: " + err.Error()})
 		return
 	}
 
-	// Filter .tfvars and .tfvars.json files
+	configFiles := map[string]string{}
 	var tfvarsFiles []string
-	for _, file := range files {
-		isDir, _ := file["is_dir"].(bool)
-		name, _ := file["name"].(string)
-		if !isDir && (strings.HasSuffix(name, ".tfvars") || strings.HasSuffix(name, ".tfvars.json")) {
+	for name, content := range contents {
+		if isTfvars(name) {
 			tfvarsFiles = append(tfvarsFiles, name)
+		} else {
+			configFiles[name] = content
 		}
 	}
+	sort.Strings(tfvarsFiles)
+	variables := tfconfig.Variables(configFiles)
+
+	files := make([]models.TfvarsFile, 0, len(tfvarsFiles))
+	for _, name := range tfvarsFiles {
+		files = append(files, tfvarsFile(name, contents[name], variables))
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"tfvars_files": tfvarsFiles,
+		"files":        files,
+		"variables":    variables,
 	})
 }
+
+// tfvarsFile parses a .tfvars or .tfvars.json file and checks it against the declared
+// variables
+func tfvarsFile(name, content string, variables []tfconfig.Variable) models.TfvarsFile {
+	file := models.TfvarsFile{Name: name, Content: content, Values: map[string]string{}, Undeclared: []string{}, MissingRequired: []string{}}
+	if strings.HasSuffix(name, ".json") {
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(content), &values); err != nil {
+			file.ParseError = err.Error()
+		}
+		for k, v := range values {
+			file.Values[k] = string(v)
+		}
+	} else {
+		file.Values = tfconfig.Assignments(content)
+	}
+
+	declared := map[string]bool{}
+	for _, v := range variables {
+		declared[v.Name] = true
+		if _, ok := file.Values[v.Name]; v.Required && !ok {
+			file.MissingRequired = append(file.MissingRequired, v.Name)
+		}
+	}
+	for k := range file.Values {
+		if !declared[k] {
+			file.Undeclared = append(file.Undeclared, k)
+		}
+	}
+	sort.Strings(file.Undeclared)
+	return file
+}
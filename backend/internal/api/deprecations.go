@@ -0,0 +1,129 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// extendedVersions reports whether the registry protocol's version listings carry each
+// version's deprecation: REGISTRY_EXTENDED_VERSIONS=true. Terraform ignores the extra
+// field; wrapper tooling and CI can read it to warn about pinned deprecated versions.
+func extendedVersions() bool {
+	return os.Getenv("REGISTRY_EXTENDED_VERSIONS") == "true"
+}
+
+// parseDeprecation decodes a stored deprecation column, nil when the version is not
+// deprecated
+func parseDeprecation(deprecationJSON sql.NullString) *models.VersionDeprecation {
+	if !deprecationJSON.Valid {
+		return nil
+	}
+	var deprecation models.VersionDeprecation
+	if json.Unmarshal([]byte(deprecationJSON.String), &deprecation) != nil {
+		return nil
+	}
+	return &deprecation
+}
+
+// deprecationWarning is the line terraform init shows for a deprecated provider version
+func deprecationWarning(namespace, name, version string, deprecation *models.VersionDeprecation) string {
+	warning := fmt.Sprintf("Version %s of %s/%s is deprecated: %s", version, namespace, name, deprecation.Reason)
+	if deprecation.Replacement != "" {
+		warning += fmt.Sprintf(" Upgrade to %s.", deprecation.Replacement)
+	}
+	return warning
+}
+
+// setVersionDeprecation deprecates a version of a module or provider. table holds the
+// versions, ownerTable and ownerColumn the module or provider they belong to.
+func setVersionDeprecation(c *gin.Context, table, ownerTable, ownerColumn string) {
+	ownerID := c.Param("id")
+	versionID := c.Param("versionId")
+
+	var deprecation models.VersionDeprecation
+	if !bindJSON(c, &deprecation) {
+		return
+	}
+	deprecation.DeprecatedAt = time.Now()
+
+	if deprecation.Replacement != "" {
+		var exists int
+		err := database.DB.QueryRow(`SELECT 1 FROM `+table+` WHERE `+ownerColumn+` = $1 AND version = $2 AND id <> $3`,
+			ownerID, deprecation.Replacement, versionID).Scan(&exists)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Replacement version " + deprecation.Replacement + " not found"})
+			return
+		}
+	}
+
+	deprecationJSON, _ := json.Marshal(deprecation)
+	result, err := database.DB.Exec(`UPDATE `+table+` SET deprecation = $1 WHERE id = $2 AND `+ownerColumn+` = $3`,
+		string(deprecationJSON), versionID, ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return
+	}
+
+	// Registry responses carry the deprecation, so they must be revalidated
+	database.DB.Exec(`UPDATE `+ownerTable+` SET updated_at = $1 WHERE id = $2`, time.Now(), ownerID)
+	registryChanged(ownerID)
+
+	c.JSON(http.StatusOK, deprecation)
+}
+
+// deleteVersionDeprecation withdraws the deprecation of a module or provider version
+func deleteVersionDeprecation(c *gin.Context, table, ownerTable, ownerColumn string) {
+	ownerID := c.Param("id")
+	result, err := database.DB.Exec(`UPDATE `+table+` SET deprecation = NULL WHERE id = $1 AND `+ownerColumn+` = $2`,
+		c.Param("versionId"), ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return
+	}
+
+	database.DB.Exec(`UPDATE `+ownerTable+` SET updated_at = $1 WHERE id = $2`, time.Now(), ownerID)
+	registryChanged(ownerID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Deprecation removed"})
+}
+
+// DeprecateModuleVersion marks a module version as deprecated
+// PUT /api/modules/:id/versions/:versionId/deprecation
+func DeprecateModuleVersion(c *gin.Context) {
+	setVersionDeprecation(c, "module_versions", "modules", "module_id")
+}
+
+// UndeprecateModuleVersion withdraws the deprecation of a module version
+// DELETE /api/modules/:id/versions/:versionId/deprecation
+func UndeprecateModuleVersion(c *gin.Context) {
+	deleteVersionDeprecation(c, "module_versions", "modules", "module_id")
+}
+
+// DeprecateProviderVersion marks a provider version as deprecated
+// PUT /api/providers/:id/versions/:versionId/deprecation
+func DeprecateProviderVersion(c *gin.Context) {
+	setVersionDeprecation(c, "provider_versions", "providers", "provider_id")
+}
+
+// UndeprecateProviderVersion withdraws the deprecation of a provider version
+// DELETE /api/providers/:id/versions/:versionId/deprecation
+func UndeprecateProviderVersion(c *gin.Context) {
+	deleteVersionDeprecation(c, "provider_versions", "providers", "provider_id")
+}
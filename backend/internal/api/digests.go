@@ -0,0 +1,118 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/digest"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDigestSubscriptions lists who receives the activity digests
+// GET /api/digest-subscriptions
+func GetDigestSubscriptions(c *gin.Context) {
+	rows, err := database.Reader().Query(`
+		SELECT id, email, namespace_id, frequency, last_sent_at, created_at
+		FROM digest_subscriptions
+		ORDER BY email, created_at
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	subscriptions := []models.DigestSubscription{}
+	for rows.Next() {
+		var s models.DigestSubscription
+		var lastSentAt sql.NullTime
+		if err := rows.Scan(&s.ID, &s.Email, &s.NamespaceID, &s.Frequency, &lastSentAt, &s.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if lastSentAt.Valid {
+			s.LastSentAt = &lastSentAt.Time
+		}
+		subscriptions = append(subscriptions, s)
+	}
+
+	c.JSON(http.StatusOK, subscriptions)
+}
+
+// CreateDigestSubscription subscribes an email address to the daily or weekly digest of
+// one namespace, or of all namespaces without namespace_id
+// POST /api/digest-subscriptions
+func CreateDigestSubscription(c *gin.Context) {
+	var input models.DigestSubscriptionCreate
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	input.NamespaceID = nilIfEmpty(input.NamespaceID)
+	if input.NamespaceID != nil {
+		var exists bool
+		database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM namespaces WHERE id = $1)`, *input.NamespaceID).Scan(&exists)
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "namespace " + *input.NamespaceID + " not found"})
+			return
+		}
+	}
+
+	s := models.DigestSubscription{
+		ID:          generateID(),
+		Email:       strings.ToLower(input.Email),
+		NamespaceID: input.NamespaceID,
+		Frequency:   input.Frequency,
+		CreatedAt:   time.Now(),
+	}
+	_, err := database.DB.Exec(`
+		INSERT INTO digest_subscriptions (id, email, namespace_id, frequency, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, s.ID, s.Email, s.NamespaceID, s.Frequency, s.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, s)
+}
+
+// DeleteDigestSubscription unsubscribes from a digest
+// DELETE /api/digest-subscriptions/:id
+func DeleteDigestSubscription(c *gin.Context) {
+	result, err := database.DB.Exec("DELETE FROM digest_subscriptions WHERE id = $1", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Subscription deleted"})
+}
+
+// GetDigest returns the digest of the last day or week as it would be sent now
+// GET /api/digest?frequency=daily|weekly&namespace_id=
+func GetDigest(c *gin.Context) {
+	frequency := c.DefaultQuery("frequency", "daily")
+	period := digest.Period(frequency)
+	if period == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "frequency must be 'daily' or 'weekly'"})
+		return
+	}
+
+	until := time.Now()
+	d, err := digest.Build(c.Query("namespace_id"), until.Add(-period), until)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, d)
+}
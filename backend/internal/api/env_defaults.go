@@ -0,0 +1,122 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+
+	"iac-tool/internal/build"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redactEnvDefaults hides the values of default env vars, keeping the names
+func redactEnvDefaults(defaults *models.EnvDefaults) *models.EnvDefaults {
+	for name := range defaults.EnvVars {
+		defaults.EnvVars[name] = redactedValue
+	}
+	return defaults
+}
+
+// keepRedactedValues lets an update send back a redacted value to keep the current one
+func keepRedactedValues(update, current map[string]string) map[string]string {
+	envVars := make(map[string]string, len(update))
+	for name, value := range update {
+		if value == redactedValue {
+			stored, ok := current[name]
+			if !ok {
+				continue
+			}
+			value = stored
+		}
+		envVars[name] = value
+	}
+	return envVars
+}
+
+// GetPlatformEnvDefaults returns the names of the env vars given to every run
+// GET /api/admin/env-defaults
+func GetPlatformEnvDefaults(c *gin.Context) {
+	defaults, err := build.PlatformEnvDefaults()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, redactEnvDefaults(defaults))
+}
+
+// SetPlatformEnvDefaults replaces the env vars given to every run
+// PUT /api/admin/env-defaults
+func SetPlatformEnvDefaults(c *gin.Context) {
+	var input models.EnvDefaultsUpdate
+	if !bindJSON(c, &input) {
+		return
+	}
+	current, err := build.PlatformEnvDefaults()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	envVars := keepRedactedValues(input.EnvVars, current.EnvVars)
+	if err := build.SetPlatformEnvDefaults(envVars, c.GetString("api_key_name")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordAuditEvent("env_defaults.updated", c.GetString("api_key_name"), "platform", "env-defaults",
+		map[string]interface{}{"variables": envVarNames(envVars)})
+	GetPlatformEnvDefaults(c)
+}
+
+// GetNamespaceEnvDefaults returns the names of the env vars given to the runs of a
+// namespace's deployments
+// GET /api/namespaces/:id/env-defaults
+func GetNamespaceEnvDefaults(c *gin.Context) {
+	defaults, err := build.NamespaceEnvDefaults(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Namespace not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, redactEnvDefaults(defaults))
+}
+
+// SetNamespaceEnvDefaults replaces the env vars given to the runs of a namespace's
+// deployments
+// PUT /api/namespaces/:id/env-defaults
+func SetNamespaceEnvDefaults(c *gin.Context) {
+	var input models.EnvDefaultsUpdate
+	if !bindJSON(c, &input) {
+		return
+	}
+	current, err := build.NamespaceEnvDefaults(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Namespace not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	envVars := keepRedactedValues(input.EnvVars, current.EnvVars)
+	if err := build.SetNamespaceEnvDefaults(c.Param("id"), envVars); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordAuditEvent("env_defaults.updated", c.GetString("api_key_name"), "namespace", c.Param("id"),
+		map[string]interface{}{"variables": envVarNames(envVars)})
+	GetNamespaceEnvDefaults(c)
+}
+
+// envVarNames returns the names of env vars, for audit events
+func envVarNames(envVars map[string]string) []string {
+	names := make([]string, 0, len(envVars))
+	for name := range envVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
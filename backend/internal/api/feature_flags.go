@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/features"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireFeature answers 404 for routes of a capability whose feature flag is off for the
+// request's :namespace, as if the route did not exist
+func RequireFeature(key string) gin.HandlerFunc {
+	return RequireFeatureFor(key, func(c *gin.Context) string { return c.Param("namespace") })
+}
+
+// RequireFeatureFor is RequireFeature for routes that address a namespace otherwise:
+// namespaceOf returns the name of the namespace the request acts on
+func RequireFeatureFor(key string, namespaceOf func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !featureAllows(c, key, namespaceOf(c)) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// featureAllows checks a feature flag for a namespace inside a handler, writing the 404
+// response when it is off
+func featureAllows(c *gin.Context, key, namespace string) bool {
+	if !features.Enabled(key, namespace) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Feature " + key + " is not enabled"})
+		return false
+	}
+	return true
+}
+
+// GetFeatures returns which feature flags are on for a namespace, for the frontend
+// GET /api/features?namespace=
+func GetFeatures(c *gin.Context) {
+	namespace := c.Query("namespace")
+	enabled := map[string]bool{}
+	for _, f := range features.All() {
+		enabled[f.Key] = f.EnabledFor(namespace)
+	}
+	c.JSON(http.StatusOK, enabled)
+}
+
+// GetFeatureFlags lists the feature flags and their rollout
+// GET /api/admin/flags
+func GetFeatureFlags(c *gin.Context) {
+	c.JSON(http.StatusOK, features.All())
+}
+
+// UpdateFeatureFlag sets the rollout of a feature flag: on for everyone, for namespaces,
+// or for a percentage of namespaces
+// PUT /api/admin/flags/:key
+func UpdateFeatureFlag(c *gin.Context) {
+	key := c.Param("key")
+	if _, known := features.Definitions[key]; !known {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown feature flag " + key})
+		return
+	}
+	var input struct {
+		Enabled    bool     `json:"enabled"`
+		Namespaces []string `json:"namespaces" binding:"max=500,dive,required,max=255"`
+		Percentage int      `json:"percentage" binding:"min=0,max=100"`
+	}
+	if !bindJSON(c, &input) {
+		return
+	}
+	for _, ns := range input.Namespaces {
+		var exists bool
+		database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM namespaces WHERE name = $1)`, ns).Scan(&exists)
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Namespace " + ns + " not found"})
+			return
+		}
+	}
+
+	flag, err := features.Set(key, input.Enabled, input.Namespaces, input.Percentage, c.GetString("api_key_name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordAuditEvent("feature_flag.updated", c.GetString("api_key_name"), "feature_flag", key,
+		map[string]interface{}{"enabled": flag.Enabled, "namespaces": flag.Namespaces, "percentage": flag.Percentage})
+	c.JSON(http.StatusOK, flag)
+}
+
+// ResetFeatureFlag removes the stored rollout of a feature flag, so it has its default
+// DELETE /api/admin/flags/:key
+func ResetFeatureFlag(c *gin.Context) {
+	key := c.Param("key")
+	if _, known := features.Definitions[key]; !known {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown feature flag " + key})
+		return
+	}
+	if err := features.Reset(key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordAuditEvent("feature_flag.reset", c.GetString("api_key_name"), "feature_flag", key, nil)
+	c.JSON(http.StatusOK, features.Get(key))
+}
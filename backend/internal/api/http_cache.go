@@ -0,0 +1,94 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Registry protocol responses carry an ETag (a hash of the response) and a Last-Modified
+// date (the module's or provider's updated_at), so Terraform and caching proxies can
+// revalidate them with If-None-Match or If-Modified-Since and get a 304.
+
+// registryCacheMaxAge is how long registry responses may be reused without revalidating
+// (REGISTRY_CACHE_MAX_AGE, default 5m; 0 makes clients revalidate every time)
+func registryCacheMaxAge() time.Duration {
+	if value := os.Getenv("REGISTRY_CACHE_MAX_AGE"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			return d
+		}
+		log.Printf("Warning: invalid REGISTRY_CACHE_MAX_AGE %q, using 5m", value)
+	}
+	return 5 * time.Minute
+}
+
+// setRegistryCacheHeaders sets the validators and Cache-Control of a registry response
+// and reports whether the client's copy is still current
+func setRegistryCacheHeaders(c *gin.Context, lastModified time.Time, content []byte) bool {
+	sum := sha256.Sum256(content)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	lastModified = lastModified.UTC().Truncate(time.Second)
+
+	// Responses to authenticated requests must not be shared between clients
+	scope := "public"
+	if c.GetHeader("Authorization") != "" {
+		scope = "private"
+	}
+	cacheControl := scope + ", no-cache"
+	if maxAge := registryCacheMaxAge(); maxAge > 0 {
+		cacheControl = scope + ", max-age=" + strconv.Itoa(int(maxAge.Seconds())) + ", must-revalidate"
+	}
+
+	header := c.Writer.Header()
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", cacheControl)
+	header.Add("Vary", "Authorization")
+	if !lastModified.IsZero() {
+		header.Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since (RFC 9110, 13.2.2)
+	if inm := c.GetHeader("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag)
+	}
+	if ims := c.GetHeader("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil && !lastModified.After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// etagMatches compares an If-None-Match header with an ETag (weak comparison)
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// cachedJSON sends a registry protocol response, or 304 Not Modified when the client's
+// cached copy matches
+func cachedJSON(c *gin.Context, lastModified time.Time, response interface{}) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"errors": []string{err.Error()}})
+		return
+	}
+	if setRegistryCacheHeaders(c, lastModified, body) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
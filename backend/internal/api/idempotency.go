@@ -0,0 +1,75 @@
+package api
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"iac-tool/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Requests that start runs accept an Idempotency-Key header. The key is stored with the
+// run (or stack run) it created, together with a fingerprint of the request, and a retry
+// with the same key (a CI job retrying after a timeout, a redelivered webhook) gets the
+// original run back instead of starting a second one. Keys are scoped to a deployment.
+
+const idempotencyHeader = "Idempotency-Key"
+
+// errIdempotencyMismatch means a key was reused for a request with a different body
+var errIdempotencyMismatch = errors.New("Idempotency-Key was already used for a different request")
+
+// idempotencyKey returns the request's Idempotency-Key ("" when none was sent)
+func idempotencyKey(c *gin.Context) (string, error) {
+	key := strings.TrimSpace(c.GetHeader(idempotencyHeader))
+	if len(key) > 255 {
+		return "", errors.New("Idempotency-Key must be at most 255 characters")
+	}
+	for _, r := range key {
+		if r < 0x21 || r > 0x7e {
+			return "", errors.New("Idempotency-Key must be printable ASCII without spaces")
+		}
+	}
+	return key, nil
+}
+
+// requestFingerprint hashes a request's parsed body, so reusing a key for a different
+// request is detected
+func requestFingerprint(input interface{}) string {
+	body, _ := json.Marshal(input)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// findIdempotent returns the ID of the row in table ("deployment_runs" or "stack_runs")
+// an earlier request with key created for the deployment, or "" when the key is new
+func findIdempotent(table, deploymentID, key, fingerprint string) (string, error) {
+	var id string
+	var stored sql.NullString
+	err := database.DB.QueryRow(`SELECT id, idempotency_fingerprint FROM `+table+` WHERE deployment_id = $1 AND idempotency_key = $2`,
+		deploymentID, key).Scan(&id, &stored)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if stored.String != fingerprint {
+		return "", errIdempotencyMismatch
+	}
+	return id, nil
+}
+
+// nullableKey stores an empty key as NULL, which the unique index ignores
+func nullableKey(key string) sql.NullString {
+	return sql.NullString{String: key, Valid: key != ""}
+}
+
+// markReplayed flags a response that returns the result of an earlier request
+func markReplayed(c *gin.Context) {
+	c.Header("Idempotent-Replayed", "true")
+}
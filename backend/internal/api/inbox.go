@@ -0,0 +1,204 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"iac-tool/internal/credentials"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// credentialResourceSingular names a credential's resource type in inbox titles
+var credentialResourceSingular = map[string]string{
+	"modules":     "module",
+	"providers":   "provider",
+	"deployments": "deployment",
+}
+
+// loadInbox collects the items of the calling API key, newest first. Approver and admin
+// keys get the runs awaiting approval. Credential expirations are those of namespaces
+// listing the key's name among their owner emails, or of every namespace for admin keys.
+func loadInbox(c *gin.Context) ([]models.InboxItem, error) {
+	db := database.Reader()
+	keyName := c.GetString("api_key_name")
+	permissions := c.GetString("api_key_permissions")
+	items := []models.InboxItem{}
+
+	if roleRank[permissions] >= roleRank["approver"] {
+		rows, err := db.Query(`
+			SELECT r.id, r.deployment_id, d.name, COALESCE(r.path, ''), n.id, n.name, r.plan_expires_at, r.created_at
+			FROM deployment_runs r
+			JOIN deployments d ON r.deployment_id = d.id
+			JOIN namespaces n ON d.namespace_id = n.id
+			WHERE r.status = 'awaiting_approval'
+		`)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var item models.InboxItem
+			var deploymentID, deployment, path string
+			var planExpiresAt sql.NullTime
+			if err := rows.Scan(&item.TargetID, &deploymentID, &deployment, &path, &item.NamespaceID, &item.Namespace, &planExpiresAt, &item.CreatedAt); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			item.ID = "run:" + item.TargetID + ":approval"
+			item.Kind = "run_approval"
+			item.TargetType = "run"
+			item.ParentID = &deploymentID
+			item.Title = fmt.Sprintf("Run of %s (%s) is awaiting approval", deployment, path)
+			if planExpiresAt.Valid {
+				item.DueAt = &planExpiresAt.Time
+			}
+			items = append(items, item)
+		}
+		rows.Close()
+	}
+
+	var selects []string
+	for _, table := range []string{"modules", "providers", "deployments"} {
+		selects = append(selects, fmt.Sprintf(`
+			SELECT '%[1]s', t.id, t.name, n.id, n.name, t.credential_status, t.credential_expires_at, COALESCE(t.credential_checked_at, NOW())
+			FROM %[1]s t
+			JOIN namespaces n ON t.namespace_id = n.id
+			WHERE t.credential_status IN ('%[2]s', '%[3]s')
+			  AND ($1 OR EXISTS (
+				SELECT 1 FROM jsonb_array_elements_text(COALESCE(n.owner_emails, '[]')::jsonb) owner
+				WHERE lower(owner) = lower($2)))`,
+			table, credentials.StatusExpiring, credentials.StatusExpired))
+	}
+	rows, err := db.Query(strings.Join(selects, " UNION ALL "), permissions == "admin", keyName)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var item models.InboxItem
+		var name, status string
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&item.TargetType, &item.TargetID, &name, &item.NamespaceID, &item.Namespace, &status, &expiresAt, &item.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		// A credential that goes from expiring to expired shows up as a new, unread item
+		item.ID = "credential:" + item.TargetType + ":" + item.TargetID + ":" + status
+		item.Kind = "credential_expiration"
+		if status == credentials.StatusExpired {
+			item.Title = fmt.Sprintf("Git credentials of %s %s have expired", credentialResourceSingular[item.TargetType], name)
+		} else {
+			item.Title = fmt.Sprintf("Git credentials of %s %s are about to expire", credentialResourceSingular[item.TargetType], name)
+		}
+		if expiresAt.Valid {
+			item.DueAt = &expiresAt.Time
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+
+	rows, err = db.Query(`SELECT item_id FROM inbox_reads WHERE api_key_id = $1`, c.GetString("api_key_id"))
+	if err != nil {
+		return nil, err
+	}
+	read := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if rows.Scan(&id) == nil {
+			read[id] = true
+		}
+	}
+	rows.Close()
+
+	for i := range items {
+		items[i].Read = read[items[i].ID]
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].CreatedAt.After(items[j].CreatedAt) })
+	return items, nil
+}
+
+// GetInbox lists what waits for the caller: runs to approve and git credentials to renew
+// GET /api/inbox?unread=true
+func GetInbox(c *gin.Context) {
+	items, err := loadInbox(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	inbox := models.Inbox{Items: []models.InboxItem{}}
+	for _, item := range items {
+		if !item.Read {
+			inbox.Unread++
+		} else if c.Query("unread") == "true" {
+			continue
+		}
+		inbox.Items = append(inbox.Items, item)
+	}
+	c.JSON(http.StatusOK, inbox)
+}
+
+// MarkInboxRead marks inbox items read, or unread again with "read": false
+// POST /api/inbox/read
+func MarkInboxRead(c *gin.Context) {
+	var input models.InboxReadRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	if err := setInboxRead(c.GetString("api_key_id"), input.IDs, input.Read == nil || *input.Read); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Inbox updated", "updated": len(input.IDs)})
+}
+
+// MarkInboxAllRead marks every current inbox item read
+// POST /api/inbox/read-all
+func MarkInboxAllRead(c *gin.Context) {
+	items, err := loadInbox(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var ids []string
+	for _, item := range items {
+		if !item.Read {
+			ids = append(ids, item.ID)
+		}
+	}
+	if err := setInboxRead(c.GetString("api_key_id"), ids, true); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Inbox updated", "updated": len(ids)})
+}
+
+// setInboxRead stores the read state of items for an API key
+func setInboxRead(apiKeyID string, ids []string, read bool) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, id := range ids {
+		if read {
+			_, err = tx.Exec(`
+				INSERT INTO inbox_reads (api_key_id, item_id, read_at) VALUES ($1, $2, $3)
+				ON CONFLICT (api_key_id, item_id) DO NOTHING
+			`, apiKeyID, id, now)
+		} else {
+			_, err = tx.Exec(`DELETE FROM inbox_reads WHERE api_key_id = $1 AND item_id = $2`, apiKeyID, id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"iac-tool/internal/maintenance"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maintenanceExempt are the changing management API routes that keep working in
+// maintenance mode: signing in and out, and turning maintenance mode off
+var maintenanceExempt = map[string]bool{
+	"POST /api/auth/session":         true,
+	"POST /api/auth/session/refresh": true,
+	"DELETE /api/auth/session":       true,
+	"PUT /api/admin/maintenance":     true,
+}
+
+// RejectDuringMaintenance answers requests that change data with 503 while maintenance
+// mode is on. Reads, and everything outside the management API (the registry protocol and
+// downloads), are not affected.
+func RejectDuringMaintenance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if maintenanceExempt[c.Request.Method+" "+c.FullPath()] || strings.HasPrefix(c.FullPath(), "/api/internal/") {
+			c.Next()
+			return
+		}
+		state := maintenance.Current()
+		if !state.Enabled {
+			c.Next()
+			return
+		}
+
+		retryAfter := 300
+		if state.EndsAt != nil {
+			if remaining := int(time.Until(*state.EndsAt).Seconds()); remaining > 0 {
+				retryAfter = remaining
+			}
+		}
+		c.Header("Retry-After", fmt.Sprint(retryAfter))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": state.Message, "maintenance": state})
+		c.Abort()
+	}
+}
+
+// GetMaintenanceMode returns whether maintenance mode is on, for banners and clients
+// GET /api/maintenance
+func GetMaintenanceMode(c *gin.Context) {
+	c.JSON(http.StatusOK, maintenance.Current())
+}
+
+// SetMaintenanceMode turns maintenance mode on or off for all instances
+// PUT /api/admin/maintenance
+func SetMaintenanceMode(c *gin.Context) {
+	var input struct {
+		Enabled bool       `json:"enabled"`
+		Message string     `json:"message" binding:"max=1000"`
+		EndsAt  *time.Time `json:"ends_at,omitempty"`
+	}
+	if !bindJSON(c, &input) {
+		return
+	}
+	if maintenance.ForcedByEnv() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Maintenance mode is set by MAINTENANCE_MODE and cannot be changed through the API"})
+		return
+	}
+
+	actor := c.GetString("api_key_name")
+	state, err := maintenance.Set(input.Enabled, input.Message, input.EndsAt, actor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	action := "maintenance.disabled"
+	if state.Enabled {
+		action = "maintenance.enabled"
+	}
+	recordAuditEvent(action, actor, "platform", "maintenance", map[string]interface{}{"message": state.Message})
+	c.JSON(http.StatusOK, state)
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"time"
+
+	"iac-tool/internal/cache"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// resolvedModuleID is an SQL expression for the ID of the module at the address $1/$2/$3
+// (namespace, name, provider) or, when there is none, of the module an active alias of
+// the address points to
+const resolvedModuleID = `COALESCE(
+	(SELECT m2.id FROM modules m2 JOIN namespaces n2 ON m2.namespace_id = n2.id WHERE n2.name = $1 AND m2.name = $2 AND m2.provider = $3),
+	(SELECT a.module_id FROM module_aliases a WHERE a.namespace = $1 AND a.name = $2 AND a.provider = $3 AND (a.expires_at IS NULL OR a.expires_at > NOW()))
+)`
+
+// moduleAliasWindow is how long a module's previous address keeps working after a rename
+// or transfer (MODULE_ALIAS_WINDOW, default 30 days); 0 records no alias
+func moduleAliasWindow() time.Duration {
+	if v := os.Getenv("MODULE_ALIAS_WINDOW"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return 30 * 24 * time.Hour
+}
+
+// recordModuleAlias keeps the previous address of a renamed or moved module working for
+// the alias window
+func recordModuleAlias(tx *sql.Tx, moduleID, namespace, name, provider string) error {
+	window := moduleAliasWindow()
+	if window == 0 {
+		return nil
+	}
+	_, err := tx.Exec(`
+		INSERT INTO module_aliases (id, module_id, namespace, name, provider, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (namespace, name, provider) DO UPDATE SET module_id = EXCLUDED.module_id, expires_at = EXCLUDED.expires_at
+	`, generateID(), moduleID, namespace, name, provider, time.Now().Add(window), time.Now())
+	return err
+}
+
+// loadModuleAliases returns the aliases of a module, newest first
+func loadModuleAliases(moduleID string) ([]models.ModuleAlias, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, module_id, namespace, name, provider, expires_at, created_at
+		FROM module_aliases WHERE module_id = $1
+		ORDER BY created_at DESC
+	`, moduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := []models.ModuleAlias{}
+	now := time.Now()
+	for rows.Next() {
+		var a models.ModuleAlias
+		if err := rows.Scan(&a.ID, &a.ModuleID, &a.Namespace, &a.Name, &a.Provider, &a.ExpiresAt, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.Active = a.ExpiresAt == nil || a.ExpiresAt.After(now)
+		aliases = append(aliases, a)
+	}
+	return aliases, rows.Err()
+}
+
+// GetModuleAliases lists the other addresses a module is served under
+// GET /api/modules/:id/aliases
+func GetModuleAliases(c *gin.Context) {
+	aliases, err := loadModuleAliases(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, aliases)
+}
+
+// CreateModuleAlias serves a module under another address too, or changes when an alias
+// of the module expires
+// POST /api/modules/:id/aliases
+func CreateModuleAlias(c *gin.Context) {
+	moduleID := c.Param("id")
+	var input models.ModuleAliasCreate
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	var exists bool
+	database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM modules WHERE id = $1)`, moduleID).Scan(&exists)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Module not found"})
+		return
+	}
+	// A module at the address would always be served instead
+	var existingID string
+	if database.DB.QueryRow(`
+		SELECT m.id FROM modules m JOIN namespaces n ON m.namespace_id = n.id
+		WHERE n.name = $1 AND m.name = $2 AND m.provider = $3
+	`, input.Namespace, input.Name, input.Provider).Scan(&existingID) == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A module exists at " + input.Namespace + "/" + input.Name + "/" + input.Provider})
+		return
+	}
+
+	result, err := database.DB.Exec(`
+		INSERT INTO module_aliases (id, module_id, namespace, name, provider, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (namespace, name, provider) DO UPDATE SET expires_at = EXCLUDED.expires_at
+		WHERE module_aliases.module_id = EXCLUDED.module_id
+	`, generateID(), moduleID, input.Namespace, input.Name, input.Provider, input.ExpiresAt, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "The address is an alias of another module"})
+		return
+	}
+	cache.Registry.InvalidateGroup(moduleCacheGroup(input.Namespace, input.Name, input.Provider))
+
+	aliases, err := loadModuleAliases(moduleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, aliases)
+}
+
+// DeleteModuleAlias stops serving a module under an alias
+// DELETE /api/modules/:id/aliases/:aliasId
+func DeleteModuleAlias(c *gin.Context) {
+	var namespace, name, provider string
+	err := database.DB.QueryRow(`
+		DELETE FROM module_aliases WHERE id = $1 AND module_id = $2
+		RETURNING namespace, name, provider
+	`, c.Param("aliasId"), c.Param("id")).Scan(&namespace, &name, &provider)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alias not found"})
+		return
+	}
+	cache.Registry.InvalidateGroup(moduleCacheGroup(namespace, name, provider))
+	c.JSON(http.StatusOK, gin.H{"message": "Alias deleted"})
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"iac-tool/internal/crypto"
+	"iac-tool/internal/database"
+	"iac-tool/internal/git"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetModuleVersionExamples returns the usage examples of a module version: the main.tf of
+// every directory below the module's examples/ directory. Examples are extracted when the
+// version is synced; versions synced before that are extracted on the first request.
+// GET /api/modules/:id/versions/:versionId/examples
+func GetModuleVersionExamples(c *gin.Context) {
+	moduleID := c.Param("id")
+	versionID := c.Param("versionId")
+
+	var downloadURL string
+	var syncedAt sql.NullTime
+	err := database.DB.QueryRow(`SELECT download_url, examples_synced_at FROM module_versions WHERE id = $1 AND module_id = $2`, versionID, moduleID).
+		Scan(&downloadURL, &syncedAt)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return
+	}
+
+	if !syncedAt.Valid {
+		// Load auth config from database
+		var auth *git.AuthConfig
+		var authType, authData sql.NullString
+		err := database.DB.QueryRow("SELECT git_auth_type, git_auth_data FROM modules WHERE id = $1", moduleID).Scan(&authType, &authData)
+		if err == nil && authType.Valid && authData.Valid {
+			if decryptedData, err := crypto.DecryptJSON(authData.String); err == nil {
+				var authJSON map[string]string
+				if err := json.Unmarshal([]byte(decryptedData), &authJSON); err == nil {
+					auth = &git.AuthConfig{
+						Type:     authType.String,
+						Username: authJSON["username"],
+						Password: authJSON["password"],
+					}
+				}
+			}
+		}
+
+		if err := extractModuleExamples(versionID, downloadURL, auth); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to extract examples: " + err.Error()})
+			return
+		}
+	}
+
+	rows, err := database.DB.Query(`SELECT name, path, content FROM module_examples WHERE version_id = $1 ORDER BY name`, versionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	examples := []models.ModuleExample{}
+	for rows.Next() {
+		var example models.ModuleExample
+		if err := rows.Scan(&example.Name, &example.Path, &example.Content); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		examples = append(examples, example)
+	}
+
+	c.JSON(http.StatusOK, examples)
+}
+
+// extractModuleExamples replaces the stored examples of a version with the ones in the
+// repository at the version's tag. Versions that do not come from git have no examples.
+func extractModuleExamples(versionID, downloadURL string, auth *git.AuthConfig) error {
+	examples := []git.Example{}
+	if gitURL, ref, dir, ok := versionSource(downloadURL); ok {
+		var err error
+		if examples, err = git.Examples(gitURL, ref, path.Join(dir, "examples"), auth); err != nil {
+			return err
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM module_examples WHERE version_id = $1`, versionID); err != nil {
+		return err
+	}
+	for _, example := range examples {
+		_, err := tx.Exec(`INSERT INTO module_examples (version_id, name, path, content) VALUES ($1, $2, $3, $4)`,
+			versionID, example.Name, example.Path, example.Content)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE module_versions SET examples_synced_at = $1 WHERE id = $2`, time.Now(), versionID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// versionSource splits a version's download URL (git::<url>[//subdir]?ref=<tag>) into the
+// repository, the tag and the directory of the module ("" for the repository root)
+func versionSource(downloadURL string) (string, string, string, bool) {
+	if !strings.HasPrefix(downloadURL, "git::") {
+		return "", "", "", false
+	}
+	source, ref, ok := strings.Cut(strings.TrimPrefix(downloadURL, "git::"), "?ref=")
+	if !ok || ref == "" {
+		return "", "", "", false
+	}
+	gitURL, subdir := parseSourceURL(source)
+	dir := ""
+	if subdir != nil {
+		dir = *subdir
+	}
+	return gitURL, ref, dir, true
+}
+
+// refreshModuleExamples extracts the examples of the newest versions added by a tag sync
+func refreshModuleExamples(moduleID string, added []git.Tag, auth *git.AuthConfig) {
+	sort.Slice(added, func(i, j int) bool { return added[i].TagDate.After(added[j].TagDate) })
+	if len(added) > readmePrefetchLimit {
+		added = added[:readmePrefetchLimit]
+	}
+	for _, tag := range added {
+		var versionID, downloadURL string
+		err := database.DB.QueryRow(`SELECT id, download_url FROM module_versions WHERE module_id = $1 AND version = $2`, moduleID, tag.Version).
+			Scan(&versionID, &downloadURL)
+		if err != nil {
+			continue
+		}
+		if err := extractModuleExamples(versionID, downloadURL, auth); err != nil {
+			log.Printf("Module %s: failed to extract examples for %s: %v", moduleID, tag.Name, err)
+		}
+	}
+}
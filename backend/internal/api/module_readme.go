@@ -0,0 +1,164 @@
+package api
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"iac-tool/internal/crypto"
+	"iac-tool/internal/database"
+	"iac-tool/internal/git"
+	"iac-tool/internal/markdown"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// readmePrefetchLimit is how many newly synced versions get their README cached during a
+	// tag sync; older versions are cached the first time they are requested
+	readmePrefetchLimit = 10
+	// defaultBranchReadmeTTL is how long the default branch README is served from cache
+	// before it is fetched again; version READMEs do not change
+	defaultBranchReadmeTTL = time.Hour
+)
+
+// GetModuleReadme returns a module's README for a version (or the default branch without ref).
+// READMEs are cached per module and ref; responses carry an ETag and honour If-None-Match.
+// With format=html the sanitized HTML rendering is returned as well.
+// GET /api/modules/:id/readme?ref=1.2.0&format=html
+func GetModuleReadme(c *gin.Context) {
+	moduleID := c.Param("id")
+	ref := c.Query("ref") // Optional: specific version/tag
+	format := c.DefaultQuery("format", "markdown")
+	if format != "markdown" && format != "html" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be 'markdown' or 'html'"})
+		return
+	}
+
+	var content, etag string
+	var fetchedAt time.Time
+	err := database.DB.QueryRow(`SELECT content, etag, fetched_at FROM module_readmes WHERE module_id = $1 AND ref = $2`, moduleID, ref).
+		Scan(&content, &etag, &fetchedAt)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	cached := err == nil
+
+	if !cached || (ref == "" && time.Since(fetchedAt) > defaultBranchReadmeTTL) {
+		var sourceURL string
+		if err := database.DB.QueryRow("SELECT source_url FROM modules WHERE id = $1", moduleID).Scan(&sourceURL); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Module not found"})
+			return
+		}
+		gitURL, _ := parseSourceURL(sourceURL)
+
+		// Load auth config from database
+		var auth *git.AuthConfig
+		var authType, authData sql.NullString
+		err := database.DB.QueryRow("SELECT git_auth_type, git_auth_data FROM modules WHERE id = $1", moduleID).Scan(&authType, &authData)
+		if err == nil && authType.Valid && authData.Valid {
+			if decryptedData, err := crypto.DecryptJSON(authData.String); err == nil {
+				var authJSON map[string]string
+				if err := json.Unmarshal([]byte(decryptedData), &authJSON); err == nil {
+					auth = &git.AuthConfig{
+						Type:     authType.String,
+						Username: authJSON["username"],
+						Password: authJSON["password"],
+					}
+				}
+			}
+		}
+
+		fresh, freshETag, err := cacheModuleReadme(moduleID, gitURL, ref, readmeFetchRef(moduleID, ref), auth)
+		switch {
+		case err == nil:
+			content, etag, fetchedAt = fresh, freshETag, time.Now()
+		case !cached:
+			c.JSON(http.StatusNotFound, gin.H{"error": "README not found: " + err.Error()})
+			return
+		default:
+			// Serve the cached copy while the repository is unreachable
+			log.Printf("Module %s: failed to refresh README, serving cached copy: %v", moduleID, err)
+		}
+	}
+
+	if format == "html" {
+		etag += "-html"
+	}
+	etag = `"` + etag + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+	if match := c.GetHeader("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	response := gin.H{"content": content, "ref": ref, "fetched_at": fetchedAt}
+	if format == "html" {
+		response["html"] = markdown.ToHTML(content)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// cacheModuleReadme fetches the README at fetchRef and stores it as the module's README
+// for ref. The ETag is the content hash.
+func cacheModuleReadme(moduleID, gitURL, ref, fetchRef string, auth *git.AuthConfig) (string, string, error) {
+	content, err := git.GetReadmeWithAuth(gitURL, fetchRef, auth)
+	if err != nil {
+		return "", "", err
+	}
+
+	sum := sha256.Sum256([]byte(content))
+	etag := hex.EncodeToString(sum[:16])
+	_, err = database.DB.Exec(`
+		INSERT INTO module_readmes (module_id, ref, content, etag, fetched_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (module_id, ref) DO UPDATE SET content = EXCLUDED.content, etag = EXCLUDED.etag, fetched_at = EXCLUDED.fetched_at
+	`, moduleID, ref, content, etag, time.Now())
+	if err != nil {
+		log.Printf("Module %s: failed to cache README for %q: %v", moduleID, ref, err)
+	}
+	return content, etag, nil
+}
+
+// readmeFetchRef maps a version to the tag it was synced from, which may carry a "v"
+// prefix. Other refs (branches, tags) are fetched as given.
+func readmeFetchRef(moduleID, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	var downloadURL string
+	err := database.DB.QueryRow(`SELECT download_url FROM module_versions WHERE module_id = $1 AND version = $2`, moduleID, ref).Scan(&downloadURL)
+	if err != nil {
+		return ref
+	}
+	if i := strings.Index(downloadURL, "?ref="); i >= 0 {
+		return downloadURL[i+len("?ref="):]
+	}
+	return ref
+}
+
+// refreshModuleReadmes updates the cached default-branch README and caches the READMEs
+// of the newest versions added by a tag sync
+func refreshModuleReadmes(moduleID, gitURL string, added []git.Tag, auth *git.AuthConfig) {
+	if _, _, err := cacheModuleReadme(moduleID, gitURL, "", "", auth); err != nil {
+		log.Printf("Module %s: no README on the default branch: %v", moduleID, err)
+	}
+
+	sort.Slice(added, func(i, j int) bool { return added[i].TagDate.After(added[j].TagDate) })
+	if len(added) > readmePrefetchLimit {
+		added = added[:readmePrefetchLimit]
+	}
+	for _, tag := range added {
+		if _, _, err := cacheModuleReadme(moduleID, gitURL, tag.Version, tag.Name, auth); err != nil {
+			log.Printf("Module %s: no README for %s: %v", moduleID, tag.Name, err)
+		}
+	}
+}
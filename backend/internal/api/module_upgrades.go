@@ -0,0 +1,237 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"iac-tool/internal/build"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordModuleDownload counts a download served for a module version, like
+// recordProviderDownload does for providers
+func recordModuleDownload(moduleID, version, consumer string) {
+	go func() {
+		consumer := countedConsumer(consumer)
+		_, err := database.DB.Exec(`
+			INSERT INTO module_version_downloads (version_id, consumer, download_count, first_downloaded_at, last_downloaded_at)
+			SELECT id, $3, 1, $4, $4 FROM module_versions WHERE module_id = $1 AND version = $2
+			ON CONFLICT (version_id, consumer) DO UPDATE
+			SET download_count = module_version_downloads.download_count + 1, last_downloaded_at = EXCLUDED.last_downloaded_at
+		`, moduleID, version, consumer, time.Now())
+		if err != nil {
+			log.Printf("Failed to record download of module %s %s: %v", moduleID, version, err)
+		}
+	}()
+}
+
+// moduleVersionInfo is an enabled module version considered as an upgrade target
+type moduleVersionInfo struct {
+	version      string
+	parts        [3]int
+	prerelease   bool
+	downloadURL  string
+	hasChangelog bool
+}
+
+// compatibleVersions reports whether upgrading from one version to another keeps the
+// semver promise: the same major version, or the same minor version below 1.0
+func compatibleVersions(from, to [3]int) bool {
+	if from[0] != to[0] {
+		return false
+	}
+	return from[0] > 0 || from[1] == to[1]
+}
+
+// upgradeKind names the largest version component that changes between two versions
+func upgradeKind(from, to [3]int) string {
+	switch {
+	case from[0] != to[0]:
+		return "major"
+	case from[1] != to[1]:
+		return "minor"
+	case from[2] != to[2]:
+		return "patch"
+	}
+	return "prerelease"
+}
+
+// changelogURL links to CHANGELOG.md at a version's tag on GitHub and GitLab, where the
+// web address can be derived from the clone URL; other hosts get no link
+func changelogURL(downloadURL string) string {
+	gitURL, ref, dir, ok := versionSource(downloadURL)
+	if !ok {
+		return ""
+	}
+	// git@github.com:org/repo.git is the scp-like form of ssh://git@github.com/org/repo.git
+	if !strings.Contains(gitURL, "://") {
+		if userHost, repoPath, found := strings.Cut(gitURL, ":"); found {
+			gitURL = "ssh://" + userHost + "/" + repoPath
+		}
+	}
+	u, err := url.Parse(gitURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	host := u.Hostname()
+	repo := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	file := path.Join(dir, "CHANGELOG.md")
+	switch {
+	case host == "github.com":
+		return "https://" + host + "/" + repo + "/blob/" + ref + "/" + file
+	case strings.Contains(host, "gitlab"):
+		return "https://" + host + "/" + repo + "/-/blob/" + ref + "/" + file
+	}
+	return ""
+}
+
+// upgradeTarget describes a version a consumer can upgrade to
+func upgradeTarget(v *moduleVersionInfo) models.ModuleUpgradeTarget {
+	return models.ModuleUpgradeTarget{Version: v.version, HasChangelog: v.hasChangelog, ChangelogURL: changelogURL(v.downloadURL)}
+}
+
+// consumerName resolves the API key or deployment a consumer stands for
+func consumerName(db *sql.DB, consumer string) string {
+	var name string
+	if id, ok := strings.CutPrefix(consumer, "key:"); ok {
+		db.QueryRow(`SELECT name FROM api_keys WHERE id = $1`, id).Scan(&name)
+	} else if id, ok := strings.CutPrefix(consumer, "deployment:"); ok {
+		db.QueryRow(`SELECT name FROM deployments WHERE id = $1`, id).Scan(&name)
+	}
+	return name
+}
+
+// GetModuleUpgradeReport lists the consumers that downloaded the module within the active
+// window and are on an outdated version, furthest behind first, with the newest version
+// they can upgrade to without a breaking change and the newest version overall
+// GET /api/modules/:id/upgrade-report?active_days=30
+func GetModuleUpgradeReport(c *gin.Context) {
+	moduleID := c.Param("id")
+	days, ok := activeDays(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "active_days must be between 1 and 365"})
+		return
+	}
+
+	db := database.Reader()
+	var exists int
+	if err := db.QueryRow(`SELECT 1 FROM modules WHERE id = $1`, moduleID).Scan(&exists); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Module not found"})
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT version, download_url, changelog IS NOT NULL
+		FROM module_versions
+		WHERE module_id = $1 AND enabled = TRUE
+	`, moduleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var versions []*moduleVersionInfo
+	for rows.Next() {
+		v := &moduleVersionInfo{}
+		if rows.Scan(&v.version, &v.downloadURL, &v.hasChangelog) != nil {
+			continue
+		}
+		if v.parts, v.prerelease, ok = build.VersionParts(v.version); ok {
+			versions = append(versions, v)
+		}
+	}
+	rows.Close()
+	sort.Slice(versions, func(i, j int) bool {
+		cmp, _ := build.CompareVersions(versions[i].version, versions[j].version)
+		return cmp > 0
+	})
+
+	// Pre-releases are only recommended when there is nothing else
+	var latest *moduleVersionInfo
+	for _, v := range versions {
+		if !v.prerelease {
+			latest = v
+			break
+		}
+	}
+	if latest == nil && len(versions) > 0 {
+		latest = versions[0]
+	}
+	if latest == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No enabled version found"})
+		return
+	}
+
+	// The version a consumer is on is the one it downloaded last
+	rows, err = db.Query(`
+		SELECT DISTINCT ON (d.consumer) d.consumer, v.version, d.last_downloaded_at
+		FROM module_version_downloads d
+		JOIN module_versions v ON d.version_id = v.id
+		WHERE v.module_id = $1 AND d.last_downloaded_at > NOW() - $2 * INTERVAL '1 day'
+		ORDER BY d.consumer, d.last_downloaded_at DESC
+	`, moduleID, days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	report := models.ModuleUpgradeReport{
+		ModuleID:      moduleID,
+		LatestVersion: latest.version,
+		ActiveDays:    days,
+		Outdated:      []models.ModuleConsumerDrift{},
+	}
+	for rows.Next() {
+		var drift models.ModuleConsumerDrift
+		if err := rows.Scan(&drift.Consumer, &drift.CurrentVersion, &drift.LastDownloadedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		current, _, _ := build.VersionParts(drift.CurrentVersion)
+		cmp, comparable := build.CompareVersions(drift.CurrentVersion, latest.version)
+		if !comparable {
+			continue
+		}
+		if cmp >= 0 {
+			report.UpToDate++
+			continue
+		}
+
+		drift.Upgrade = upgradeKind(current, latest.parts)
+		drift.Latest = upgradeTarget(latest)
+		for _, v := range versions {
+			if v.prerelease || !compatibleVersions(current, v.parts) {
+				continue
+			}
+			if newer, _ := build.CompareVersions(v.version, drift.CurrentVersion); newer > 0 {
+				target := upgradeTarget(v)
+				drift.LatestCompatible = &target
+			}
+			break
+		}
+		report.Outdated = append(report.Outdated, drift)
+	}
+	rows.Close()
+
+	for i := range report.Outdated {
+		report.Outdated[i].Name = consumerName(db, report.Outdated[i].Consumer)
+	}
+	sort.SliceStable(report.Outdated, func(i, j int) bool {
+		cmp, _ := build.CompareVersions(report.Outdated[i].CurrentVersion, report.Outdated[j].CurrentVersion)
+		if cmp != 0 {
+			return cmp < 0
+		}
+		return report.Outdated[i].Consumer < report.Outdated[j].Consumer
+	})
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"iac-tool/internal/build"
+	"iac-tool/internal/crypto"
+	"iac-tool/internal/database"
+	"iac-tool/internal/git"
+	"iac-tool/internal/tfconfig"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	semverPattern       = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+	invalidLabelPattern = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+)
+
+// GetModuleUsage returns a module block to paste into a configuration: the registry source,
+// a version constraint and the required inputs with placeholders of their type.
+// Without version the highest enabled version by semantic version is used.
+// GET /api/modules/:id/usage?version=1.2.0
+func GetModuleUsage(c *gin.Context) {
+	moduleID := c.Param("id")
+
+	var namespace, name, provider string
+	err := database.DB.QueryRow(`
+		SELECT n.name, m.name, m.provider
+		FROM modules m
+		JOIN namespaces n ON m.namespace_id = n.id
+		WHERE m.id = $1
+	`, moduleID).Scan(&namespace, &name, &provider)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Module not found"})
+		return
+	}
+
+	version := c.Query("version")
+	if version == "" {
+		latest, err := newestModuleVersion(moduleID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		version = latest
+	}
+
+	var versionID, downloadURL string
+	var cachedVariables sql.NullString
+	err = database.DB.QueryRow(`
+		SELECT id, version, download_url, variables FROM module_versions
+		WHERE module_id = $1 AND version = $2 AND enabled = TRUE
+	`, moduleID, version).Scan(&versionID, &version, &downloadURL, &cachedVariables)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No enabled version found"})
+		return
+	}
+
+	variables := []tfconfig.Variable{}
+	if cachedVariables.Valid {
+		json.Unmarshal([]byte(cachedVariables.String), &variables)
+	} else {
+		// Load auth config from database
+		var auth *git.AuthConfig
+		var authType, authData sql.NullString
+		err := database.DB.QueryRow("SELECT git_auth_type, git_auth_data FROM modules WHERE id = $1", moduleID).Scan(&authType, &authData)
+		if err == nil && authType.Valid && authData.Valid {
+			if decryptedData, err := crypto.DecryptJSON(authData.String); err == nil {
+				var authJSON map[string]string
+				if err := json.Unmarshal([]byte(decryptedData), &authJSON); err == nil {
+					auth = &git.AuthConfig{
+						Type:     authType.String,
+						Username: authJSON["username"],
+						Password: authJSON["password"],
+					}
+				}
+			}
+		}
+
+		if gitURL, ref, dir, ok := versionSource(downloadURL); ok {
+			files, err := git.TerraformFiles(gitURL, ref, dir, auth)
+			if err != nil {
+				c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to read module variables: " + err.Error()})
+				return
+			}
+			variables = tfconfig.Variables(files)
+		}
+		if data, err := json.Marshal(variables); err == nil {
+			database.DB.Exec(`UPDATE module_versions SET variables = $1 WHERE id = $2`, string(data), versionID)
+		}
+	}
+
+	source := fmt.Sprintf("%s/%s/%s/%s", registryHostname(c), namespace, name, provider)
+	constraint := version
+	if semverPattern.MatchString(version) {
+		constraint = "~> " + version
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"source":     source,
+		"version":    version,
+		"constraint": constraint,
+		"hcl":        moduleUsageHCL(name, source, constraint, variables),
+		"inputs":     variables,
+	})
+}
+
+// moduleUsageHCL renders the module block with one line per required input
+func moduleUsageHCL(name, source, constraint string, variables []tfconfig.Variable) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "module %q {\n", invalidLabelPattern.ReplaceAllString(name, "_"))
+	fmt.Fprintf(&b, "  source  = %q\n", source)
+	fmt.Fprintf(&b, "  version = %q\n", constraint)
+
+	width := 0
+	var required []tfconfig.Variable
+	for _, v := range variables {
+		if v.Required {
+			required = append(required, v)
+			width = max(width, len(v.Name))
+		}
+	}
+	if len(required) > 0 {
+		b.WriteString("\n  # Required inputs\n")
+	}
+	for _, v := range required {
+		line := fmt.Sprintf("  %-*s = %s", width, v.Name, v.Placeholder())
+		comment := strings.SplitN(v.Description, "\n", 2)[0]
+		if v.Sensitive {
+			comment = strings.TrimSpace(comment + " (sensitive)")
+		}
+		if comment != "" {
+			line += " # " + comment
+		}
+		b.WriteString(line + "\n")
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// registryHostname returns the host (and port) module sources use to address this registry
+func registryHostname(c *gin.Context) string {
+	baseURL := getBaseURL(c)
+	if i := strings.Index(baseURL, "://"); i >= 0 {
+		return baseURL[i+3:]
+	}
+	return baseURL
+}
+
+// newestModuleVersion returns the highest enabled version of a module by semantic version,
+// or an empty string when it has none. Versions that are not semantic versions fall back
+// to the newest tag.
+func newestModuleVersion(moduleID string) (string, error) {
+	rows, err := database.DB.Query(`
+		SELECT version FROM module_versions
+		WHERE module_id = $1 AND enabled = TRUE
+		ORDER BY COALESCE(tag_date, created_at) DESC
+	`, moduleID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var versions []string
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return "", err
+		}
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if i := build.NewestVersion(versions); i >= 0 {
+		return versions[i], nil
+	}
+	return "", nil
+}
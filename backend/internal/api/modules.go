@@ -9,10 +9,13 @@ import (
 	"strings"
 	"time"
 
+	"iac-tool/internal/cache"
 	"iac-tool/internal/crypto"
 	"iac-tool/internal/database"
 	"iac-tool/internal/git"
 	"iac-tool/internal/models"
+	"iac-tool/internal/sourcehosts"
+	"iac-tool/internal/validation"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,6 +25,25 @@ import (
 // Docs: https://www.terraform.io/internals/module-registry-protocol
 // ============================================================================
 
+// moduleVersionsLookup is the cached result of TFListModuleVersions
+type moduleVersionsLookup struct {
+	UpdatedAt time.Time
+	Response  models.ModuleVersionsResponse
+}
+
+// moduleDownloadLookup is the cached result of TFDownloadModule
+type moduleDownloadLookup struct {
+	ModuleID    string
+	DownloadURL string
+	Enabled     bool
+	UpdatedAt   time.Time
+}
+
+// moduleCacheGroup is the registry cache group of a module (see cache.Registry)
+func moduleCacheGroup(namespace, name, provider string) string {
+	return "modules/" + namespace + "/" + name + "/" + provider
+}
+
 // TFListModuleVersions lists available versions for a specific module
 // GET /v1/modules/:namespace/:name/:provider/versions
 func TFListModuleVersions(c *gin.Context) {
@@ -29,50 +51,63 @@ func TFListModuleVersions(c *gin.Context) {
 	name := c.Param("name")
 	provider := c.Param("provider")
 
-	// Get module
-	var moduleID string
-	err := database.DB.QueryRow(`
-		SELECT m.id FROM modules m
-		JOIN namespaces n ON m.namespace_id = n.id
-		WHERE n.name = $1 AND m.name = $2 AND m.provider = $3
-	`, namespace, name, provider).Scan(&moduleID)
+	value, err := cache.Registry.Load(moduleCacheGroup(namespace, name, provider), "versions", readRegistry(func(db *sql.DB) (interface{}, string, error) {
+		// Get module, also when the address is an alias of it
+		var moduleID string
+		var updatedAt time.Time
+		err := db.QueryRow(`
+			SELECT m.id, COALESCE(m.updated_at, m.created_at) FROM modules m
+			WHERE m.id = `+resolvedModuleID, namespace, name, provider).Scan(&moduleID, &updatedAt)
+		if err != nil {
+			return nil, "", err
+		}
 
-	if err != nil {
+		// Get versions (only enabled ones for Terraform)
+		rows, err := db.Query(`
+			SELECT version, deprecation FROM module_versions
+			WHERE module_id = $1 AND enabled = TRUE
+			ORDER BY COALESCE(tag_date, created_at) DESC
+		`, moduleID)
+		if err != nil {
+			return nil, "", err
+		}
+		defer rows.Close()
+
+		versions := make([]models.ModuleVersionDTO, 0)
+		for rows.Next() {
+			var v models.ModuleVersionDTO
+			var deprecationJSON sql.NullString
+			if err := rows.Scan(&v.Version, &deprecationJSON); err != nil {
+				continue
+			}
+			if extendedVersions() {
+				v.Deprecation = parseDeprecation(deprecationJSON)
+			}
+			versions = append(versions, v)
+		}
+
+		// Return in Terraform protocol format
+		return &moduleVersionsLookup{
+			UpdatedAt: updatedAt,
+			Response: models.ModuleVersionsResponse{
+				Modules: []models.ModuleVersionsDTO{
+					{Versions: versions},
+				},
+			},
+		}, moduleID, nil
+	}))
+	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{
-			"errors": "no module found with given arguments (source " + namespace + "/" + provider + "/" + name + ")",
+			"errors": movedModuleError(namespace, name, provider, "no module found with given arguments (source "+namespace+"/"+provider+"/"+name+")"),
 		})
 		return
-	}
-
-	// Get versions (only enabled ones for Terraform)
-	rows, err := database.DB.Query(`
-		SELECT version FROM module_versions
-		WHERE module_id = $1 AND enabled = TRUE
-		ORDER BY COALESCE(tag_date, created_at) DESC
-	`, moduleID)
-	if err != nil {
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"errors": []string{err.Error()}})
 		return
 	}
-	defer rows.Close()
-
-	versions := make([]models.ModuleVersionDTO, 0)
-	for rows.Next() {
-		var v models.ModuleVersionDTO
-		if err := rows.Scan(&v.Version); err != nil {
-			continue
-		}
-		versions = append(versions, v)
-	}
 
-	// Return in Terraform protocol format
-	response := models.ModuleVersionsResponse{
-		Modules: []models.ModuleVersionsDTO{
-			{Versions: versions},
-		},
-	}
-
-	c.JSON(http.StatusOK, response)
+	lookup := value.(*moduleVersionsLookup)
+	cachedJSON(c, lookup.UpdatedAt, lookup.Response)
 }
 
 // TFDownloadModule returns the download URL for a specific module version
@@ -83,32 +118,40 @@ func TFDownloadModule(c *gin.Context) {
 	provider := c.Param("provider")
 	version := c.Param("version")
 
-	// Get download URL (only if version is enabled)
-	var downloadURL string
-	var enabled bool
-	err := database.DB.QueryRow(`
-		SELECT mv.download_url, mv.enabled FROM module_versions mv
-		JOIN modules m ON mv.module_id = m.id
-		JOIN namespaces n ON m.namespace_id = n.id
-		WHERE n.name = $1 AND m.name = $2 AND m.provider = $3 AND mv.version = $4
-	`, namespace, name, provider, version).Scan(&downloadURL, &enabled)
-
+	value, err := cache.Registry.Load(moduleCacheGroup(namespace, name, provider), "download/"+version, readRegistry(func(db *sql.DB) (interface{}, string, error) {
+		var lookup moduleDownloadLookup
+		err := db.QueryRow(`
+			SELECT m.id, mv.download_url, mv.enabled, COALESCE(m.updated_at, m.created_at) FROM module_versions mv
+			JOIN modules m ON mv.module_id = m.id
+			WHERE mv.version = $4 AND m.id = `+resolvedModuleID, namespace, name, provider, version).Scan(&lookup.ModuleID, &lookup.DownloadURL, &lookup.Enabled, &lookup.UpdatedAt)
+		if err != nil {
+			return nil, "", err
+		}
+		return &lookup, lookup.ModuleID, nil
+	}))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
-			"errors": []string{"Module version not found"},
+			"errors": []string{movedModuleError(namespace, name, provider, "Module version not found")},
 		})
 		return
 	}
 
-	if !enabled {
+	lookup := value.(*moduleDownloadLookup)
+	if !lookup.Enabled {
 		c.JSON(http.StatusNotFound, gin.H{
 			"errors": []string{"Module version is not available"},
 		})
 		return
 	}
 
+	recordModuleDownload(lookup.ModuleID, version, registryConsumer(c))
+
 	// Return download URL in X-Terraform-Get header
-	c.Header("X-Terraform-Get", downloadURL)
+	c.Header("X-Terraform-Get", lookup.DownloadURL)
+	if setRegistryCacheHeaders(c, lookup.UpdatedAt, []byte(lookup.DownloadURL)) {
+		c.Status(http.StatusNotModified)
+		return
+	}
 	c.Status(http.StatusNoContent)
 }
 
@@ -122,8 +165,9 @@ func GetModules(c *gin.Context) {
 	namespaceFilter := c.Query("namespace")
 
 	query := `
-		SELECT m.id, m.namespace_id, m.name, m.provider, m.description, m.source_url, 
-			   m.synced, m.sync_error, m.created_at, m.updated_at, n.name as namespace
+		SELECT m.id, m.namespace_id, m.name, m.provider, m.description, m.source_url,
+			   m.synced, m.sync_error, m.credential_status, m.created_at, m.updated_at, n.name as namespace,
+			   ` + namespaceContactColumns + `
 		FROM modules m
 		JOIN namespaces n ON m.namespace_id = n.id
 	`
@@ -136,7 +180,7 @@ func GetModules(c *gin.Context) {
 
 	query += " ORDER BY n.name, m.name, m.provider"
 
-	rows, err := database.DB.Query(query, args...)
+	rows, err := database.Reader().Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"errors": []string{err.Error()}})
 		return
@@ -146,11 +190,15 @@ func GetModules(c *gin.Context) {
 	modules := make([]models.ModuleWithNamespace, 0)
 	for rows.Next() {
 		var mod models.ModuleWithNamespace
-		if err := rows.Scan(&mod.ID, &mod.NamespaceID, &mod.Name, &mod.Provider, &mod.Description,
-			&mod.SourceURL, &mod.Synced, &mod.SyncError, &mod.CreatedAt, &mod.UpdatedAt, &mod.Namespace); err != nil {
+		var contacts namespaceContactsRow
+		if err := rows.Scan(append([]interface{}{&mod.ID, &mod.NamespaceID, &mod.Name, &mod.Provider, &mod.Description,
+			&mod.SourceURL, &mod.Synced, &mod.SyncError, &mod.CredentialStatus, &mod.CreatedAt, &mod.UpdatedAt, &mod.Namespace},
+			contacts.dest()...)...); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"errors": []string{err.Error()}})
 			return
 		}
+		maintainers := contacts.contacts()
+		mod.Maintainers = &maintainers
 		modules = append(modules, mod)
 	}
 
@@ -162,23 +210,44 @@ func GetModule(c *gin.Context) {
 	id := c.Param("id")
 
 	var mod models.ModuleWithNamespace
+	var contacts namespaceContactsRow
 	err := database.DB.QueryRow(`
-		SELECT m.id, m.namespace_id, m.name, m.provider, m.description, m.source_url, 
-			   m.synced, m.sync_error, m.created_at, m.updated_at, n.name as namespace
+		SELECT m.id, m.namespace_id, m.name, m.provider, m.description, m.source_url,
+			   m.synced, m.sync_error, m.credential_status, m.created_at, m.updated_at, n.name as namespace,
+			   `+namespaceContactColumns+`
 		FROM modules m
 		JOIN namespaces n ON m.namespace_id = n.id
 		WHERE m.id = $1
-	`, id).Scan(&mod.ID, &mod.NamespaceID, &mod.Name, &mod.Provider, &mod.Description,
-		&mod.SourceURL, &mod.Synced, &mod.SyncError, &mod.CreatedAt, &mod.UpdatedAt, &mod.Namespace)
+	`, id).Scan(append([]interface{}{&mod.ID, &mod.NamespaceID, &mod.Name, &mod.Provider, &mod.Description,
+		&mod.SourceURL, &mod.Synced, &mod.SyncError, &mod.CredentialStatus, &mod.CreatedAt, &mod.UpdatedAt, &mod.Namespace},
+		contacts.dest()...)...)
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"errors": []string{"Module not found"}})
 		return
 	}
+	maintainers := contacts.contacts()
+	mod.Maintainers = &maintainers
+	if aliases, err := loadModuleAliases(id); err == nil && len(aliases) > 0 {
+		mod.Aliases = aliases
+	}
 
 	c.JSON(http.StatusOK, mod)
 }
 
+// moduleAddressErrors checks a module's name and provider against Terraform's module
+// address grammar
+func moduleAddressErrors(name, provider string) []string {
+	var errs []string
+	if !validation.ValidModuleName(name) {
+		errs = append(errs, "name: "+validation.Message("tf_module_name"))
+	}
+	if !validation.ValidModuleProvider(provider) {
+		errs = append(errs, "provider: "+validation.Message("tf_module_provider"))
+	}
+	return errs
+}
+
 // CreateModule creates a new module (via API)
 // POST /api/modules/:namespace/:name/:provider
 func CreateModule(c *gin.Context) {
@@ -186,6 +255,10 @@ func CreateModule(c *gin.Context) {
 	namespace := c.Param("namespace")
 	name := c.Param("name")
 	provider := c.Param("provider")
+	if errs := moduleAddressErrors(name, provider); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"errors": errs})
+		return
+	}
 
 	// If no namespace in path, use from auth context
 	if namespace == "" {
@@ -202,6 +275,12 @@ func CreateModule(c *gin.Context) {
 		SourceURL   *string `json:"source_url,omitempty"`
 	}
 	c.ShouldBindJSON(&input)
+	if input.SourceURL != nil && *input.SourceURL != "" {
+		if err := sourcehosts.Check(sourcehosts.KindGit, *input.SourceURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": []string{err.Error()}})
+			return
+		}
+	}
 
 	// Get namespace ID
 	var namespaceID string
@@ -227,6 +306,7 @@ func CreateModule(c *gin.Context) {
 		}
 		return
 	}
+	registryChanged(id)
 
 	mod := models.ModuleWithNamespace{
 		Module: models.Module{
@@ -264,8 +344,7 @@ func UploadModuleVersion(c *gin.Context) {
 		Documentation *string           `json:"documentation,omitempty"`
 		Headers       map[string]string `json:"headers,omitempty"`
 	}
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"errors": []string{err.Error()}})
+	if !bindRegistryJSON(c, &input) {
 		return
 	}
 
@@ -279,6 +358,10 @@ func UploadModuleVersion(c *gin.Context) {
 
 	if err != nil {
 		// Create module first
+		if errs := moduleAddressErrors(name, provider); len(errs) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": errs})
+			return
+		}
 		var namespaceID string
 		err := database.DB.QueryRow("SELECT id FROM namespaces WHERE name = $1", namespace).Scan(&namespaceID)
 		if err != nil {
@@ -316,6 +399,10 @@ func UploadModuleVersion(c *gin.Context) {
 		return
 	}
 
+	// Update module updated_at
+	database.DB.Exec("UPDATE modules SET updated_at = $1 WHERE id = $2", now, moduleID)
+	registryChanged(moduleID)
+
 	c.JSON(http.StatusOK, gin.H{"errors": []string{}})
 }
 
@@ -323,8 +410,8 @@ func UploadModuleVersion(c *gin.Context) {
 func GetModuleVersions(c *gin.Context) {
 	id := c.Param("id")
 
-	rows, err := database.DB.Query(`
-		SELECT id, version, download_url, documentation, enabled, tag_date, created_at
+	rows, err := database.Reader().Query(`
+		SELECT id, version, download_url, documentation, enabled, tag_date, tag_message, changelog, deprecation, created_at
 		FROM module_versions
 		WHERE module_id = $1
 		ORDER BY COALESCE(tag_date, created_at) DESC
@@ -338,11 +425,12 @@ func GetModuleVersions(c *gin.Context) {
 	versions := make([]models.ModuleVersion, 0)
 	for rows.Next() {
 		var v models.ModuleVersion
-		var tagDateStr sql.NullString
-		if err := rows.Scan(&v.ID, &v.Version, &v.DownloadURL, &v.Documentation, &v.Enabled, &tagDateStr, &v.CreatedAt); err != nil {
+		var tagDateStr, deprecationJSON sql.NullString
+		if err := rows.Scan(&v.ID, &v.Version, &v.DownloadURL, &v.Documentation, &v.Enabled, &tagDateStr, &v.TagMessage, &v.Changelog, &deprecationJSON, &v.CreatedAt); err != nil {
 			log.Printf("Error scanning module version: %v", err)
 			continue
 		}
+		v.Deprecation = parseDeprecation(deprecationJSON)
 		if tagDateStr.Valid && tagDateStr.String != "" {
 			if t, err := time.Parse(time.RFC3339, tagDateStr.String); err == nil {
 				v.TagDate = &t
@@ -385,6 +473,7 @@ func DeleteModule(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"errors": []string{"Module not found"}})
 		return
 	}
+	cache.Registry.InvalidateGroup(moduleCacheGroup(fmt.Sprint(namespace), name, provider))
 
 	c.JSON(http.StatusOK, gin.H{"errors": []string{}})
 }
@@ -440,7 +529,17 @@ func DeleteModuleVersion(c *gin.Context) {
 				WHERE n.name = $1 AND m.name = $2 AND m.provider = $3
 			)
 		`, namespace, name, provider)
+	} else {
+		database.DB.Exec(`
+			UPDATE modules SET updated_at = $4
+			WHERE id IN (
+				SELECT m.id FROM modules m
+				JOIN namespaces n ON m.namespace_id = n.id
+				WHERE n.name = $1 AND m.name = $2 AND m.provider = $3
+			)
+		`, namespace, name, provider, time.Now())
 	}
+	cache.Registry.InvalidateGroup(moduleCacheGroup(fmt.Sprint(namespace), name, provider))
 
 	c.JSON(http.StatusOK, gin.H{"errors": []string{}})
 }
@@ -450,8 +549,18 @@ func UpdateModule(c *gin.Context) {
 	id := c.Param("id")
 
 	var input models.ModuleUpdate
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"errors": []string{err.Error()}})
+	if !bindRegistryJSON(c, &input) {
+		return
+	}
+
+	var namespace, name, provider string
+	err := database.DB.QueryRow(`
+		SELECT n.name, m.name, m.provider FROM modules m
+		JOIN namespaces n ON m.namespace_id = n.id
+		WHERE m.id = $1
+	`, id).Scan(&namespace, &name, &provider)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"errors": []string{"Module not found"}})
 		return
 	}
 
@@ -460,35 +569,79 @@ func UpdateModule(c *gin.Context) {
 	args := []interface{}{time.Now()}
 
 	if input.Name != nil {
-		query += ", name = ?"
 		args = append(args, *input.Name)
+		query += fmt.Sprintf(", name = $%d", len(args))
 	}
 	if input.Provider != nil {
-		query += ", provider = ?"
 		args = append(args, *input.Provider)
+		query += fmt.Sprintf(", provider = $%d", len(args))
 	}
 	if input.Description != nil {
-		query += ", description = ?"
 		args = append(args, *input.Description)
+		query += fmt.Sprintf(", description = $%d", len(args))
 	}
 	if input.SourceURL != nil {
-		query += ", source_url = ?"
+		if *input.SourceURL != "" {
+			if err := sourcehosts.Check(sourcehosts.KindGit, *input.SourceURL); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"errors": []string{err.Error()}})
+				return
+			}
+		}
 		args = append(args, *input.SourceURL)
+		query += fmt.Sprintf(", source_url = $%d", len(args))
 	}
 
-	query += " WHERE id = $1"
 	args = append(args, id)
+	query += fmt.Sprintf(" WHERE id = $%d", len(args))
 
-	result, err := database.DB.Exec(query, args...)
+	tx, err := database.DB.Begin()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"errors": []string{err.Error()}})
 		return
 	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(query, args...); err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			c.JSON(http.StatusConflict, gin.H{"errors": []string{"Module already exists"}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"errors": []string{err.Error()}})
+		return
+	}
 
-	if affected, _ := result.RowsAffected(); affected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"errors": []string{"Module not found"}})
+	// A renamed module stays available under its old address for the alias window, and
+	// the address points at the new one after that
+	renamed := (input.Name != nil && *input.Name != name) || (input.Provider != nil && *input.Provider != provider)
+	if renamed {
+		if err := recordModuleAlias(tx, id, namespace, name, provider); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"errors": []string{err.Error()}})
+			return
+		}
+		to := registryAddress{namespace, name, provider}
+		if input.Name != nil {
+			to.name = *input.Name
+		}
+		if input.Provider != nil {
+			to.provider = *input.Provider
+		}
+		if err := recordRedirect(tx, "module", id, registryAddress{namespace, name, provider}, to); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"errors": []string{err.Error()}})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"errors": []string{err.Error()}})
 		return
 	}
+	if renamed {
+		registryChanged(id)
+		cache.Registry.InvalidateGroup(moduleCacheGroup(namespace, name, provider))
+	}
+
+	// READMEs cached from the old repository no longer apply
+	if input.SourceURL != nil {
+		database.DB.Exec("DELETE FROM module_readmes WHERE module_id = $1", id)
+	}
 
 	GetModule(c)
 }
@@ -502,18 +655,17 @@ func UpdateModule(c *gin.Context) {
 func CreateModuleFromGit(c *gin.Context) {
 	var input struct {
 		NamespaceID string  `json:"namespace_id" binding:"required"`
-		Name        string  `json:"name" binding:"required"`
-		Provider    string  `json:"provider" binding:"required"`
+		Name        string  `json:"name" binding:"required,tf_module_name"`
+		Provider    string  `json:"provider" binding:"required,tf_module_provider"`
 		GitURL      string  `json:"git_url" binding:"required"`
 		Description *string `json:"description,omitempty"`
-		Subdir      *string `json:"subdir,omitempty"` // Subdirectory in repo containing the module
+		Subdir      *string `json:"subdir,omitempty" binding:"omitempty,relpath"` // Subdirectory in repo containing the module
 		IsPrivate   bool    `json:"is_private,omitempty"`
 		GitUsername string  `json:"git_username,omitempty"` // For HTTPS authentication
 		GitPassword string  `json:"git_password,omitempty"` // Personal Access Token
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
 		return
 	}
 
@@ -522,6 +674,9 @@ func CreateModuleFromGit(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Git URL. Must be a valid HTTPS git repository URL (e.g., https://github.com/org/repo.git)"})
 		return
 	}
+	if !checkSourceHost(c, sourcehosts.KindGit, input.GitURL) {
+		return
+	}
 
 	// Prepare auth config if repository is private (HTTPS only)
 	var authConfig *git.AuthConfig
@@ -594,6 +749,7 @@ func CreateModuleFromGit(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	registryChanged(moduleID)
 
 	// Automatically sync tags in background
 	go func() {
@@ -665,7 +821,9 @@ func SyncModuleTags(c *gin.Context) {
 	}
 
 	now := time.Now()
-	addedCount := 0
+	addedCount, enabledCount := 0, 0
+	rule := loadAutoEnableRule("modules", moduleID)
+	var addedTags []git.Tag
 
 	// Add each tag as a version (if not exists)
 	for _, tag := range tags {
@@ -683,24 +841,38 @@ func SyncModuleTags(c *gin.Context) {
 				tagDate = tag.TagDate
 			}
 
+			enabled := rule.enables(tag.Version)
 			_, err = database.DB.Exec(`
 				INSERT INTO module_versions (id, module_id, version, download_url, enabled, tag_date, created_at)
-				VALUES ($1, $2, $3, $4, FALSE, $5, $6)
-			`, versionID, moduleID, tag.Version, downloadURL, tagDate, now)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+			`, versionID, moduleID, tag.Version, downloadURL, enabled, tagDate, now)
 
 			if err == nil {
 				addedCount++
+				if enabled {
+					enabledCount++
+				}
+				addedTags = append(addedTags, tag)
 			}
 		}
 	}
 
 	// Update module: mark as synced and clear sync errors
 	database.DB.Exec("UPDATE modules SET updated_at = $1, synced = TRUE, sync_error = NULL WHERE id = $2", now, moduleID)
+	registryChanged(moduleID)
+
+	// Cache READMEs and examples in the background so the response does not wait for the clones
+	go func() {
+		refreshModuleReadmes(moduleID, gitURL, addedTags, auth)
+		refreshModuleExamples(moduleID, addedTags, auth)
+		refreshModuleReleaseNotes(moduleID, gitURL, subdir, addedTags, auth)
+	}()
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":    "Tags synced successfully",
-		"tags_found": len(tags),
-		"tags_added": addedCount,
+		"message":      "Tags synced successfully",
+		"tags_found":   len(tags),
+		"tags_added":   addedCount,
+		"tags_enabled": enabledCount,
 	})
 }
 
@@ -770,7 +942,9 @@ func syncModuleTagsBackgroundWithAuth(moduleID string, gitURL string, subdir *st
 	}
 
 	now := time.Now()
-	addedCount := 0
+	addedCount, enabledCount := 0, 0
+	rule := loadAutoEnableRule("modules", moduleID)
+	var addedTags []git.Tag
 
 	for _, tag := range tags {
 		var existingID string
@@ -787,21 +961,31 @@ func syncModuleTagsBackgroundWithAuth(moduleID string, gitURL string, subdir *st
 				tagDate = tag.TagDate
 			}
 
+			enabled := rule.enables(tag.Version)
 			_, err = database.DB.Exec(`
 				INSERT INTO module_versions (id, module_id, version, download_url, enabled, tag_date, created_at)
-				VALUES ($1, $2, $3, $4, FALSE, $5, $6)
-			`, versionID, moduleID, tag.Version, downloadURL, tagDate, now)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+			`, versionID, moduleID, tag.Version, downloadURL, enabled, tagDate, now)
 
 			if err == nil {
 				addedCount++
+				if enabled {
+					enabledCount++
+				}
+				addedTags = append(addedTags, tag)
 			}
 		}
 	}
 
 	// Update module: mark as synced and clear any previous errors
 	database.DB.Exec("UPDATE modules SET updated_at = $1, synced = TRUE, sync_error = NULL WHERE id = $2", now, moduleID)
+	registryChanged(moduleID)
+
+	refreshModuleReadmes(moduleID, gitURL, addedTags, auth)
+	refreshModuleExamples(moduleID, addedTags, auth)
+	refreshModuleReleaseNotes(moduleID, gitURL, subdir, addedTags, auth)
 
-	log.Printf("Background tag sync completed for module %s: %d tags found, %d added", moduleID, len(tags), addedCount)
+	log.Printf("Background tag sync completed for module %s: %d tags found, %d added, %d enabled", moduleID, len(tags), addedCount, enabledCount)
 }
 
 // GetModuleGitTags fetches available tags from the Git repository
@@ -840,8 +1024,7 @@ func ToggleModuleVersion(c *gin.Context) {
 		Enabled bool `json:"enabled"`
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
 		return
 	}
 
@@ -861,58 +1044,11 @@ func ToggleModuleVersion(c *gin.Context) {
 
 	// Update module updated_at
 	database.DB.Exec("UPDATE modules SET updated_at = $1 WHERE id = $2", time.Now(), moduleID)
+	registryChanged(moduleID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Version updated", "enabled": input.Enabled})
 }
 
-// GetModuleReadme fetches the README.md from the module's Git repository
-// GET /api/modules/:id/readme
-func GetModuleReadme(c *gin.Context) {
-	moduleID := c.Param("id")
-	ref := c.Query("ref") // Optional: specific version/tag
-
-	// Get module source URL
-	var sourceURL string
-	err := database.DB.QueryRow("SELECT source_url FROM modules WHERE id = $1", moduleID).Scan(&sourceURL)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Module not found"})
-		return
-	}
-
-	// Parse source URL to get git URL
-	gitURL, _ := parseSourceURL(sourceURL)
-
-	// Load auth config from database
-	var auth *git.AuthConfig
-	var authType sql.NullString
-	var authData sql.NullString
-	err = database.DB.QueryRow("SELECT git_auth_type, git_auth_data FROM modules WHERE id = $1", moduleID).Scan(&authType, &authData)
-	if err == nil && authType.Valid && authData.Valid {
-		// Decrypt auth data
-		decryptedData, err := crypto.DecryptJSON(authData.String)
-		if err == nil {
-			// Parse auth data
-			var authJSON map[string]string
-			if err := json.Unmarshal([]byte(decryptedData), &authJSON); err == nil {
-				auth = &git.AuthConfig{
-					Type:     authType.String,
-					Username: authJSON["username"],
-					Password: authJSON["password"],
-				}
-			}
-		}
-	}
-
-	// Fetch README with authentication
-	readme, err := git.GetReadmeWithAuth(gitURL, ref, auth)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "README not found: " + err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"content": readme})
-}
-
 // AddModuleVersion adds a new version to an existing module (kept for manual addition)
 // POST /api/modules/:id/versions
 func AddModuleVersion(c *gin.Context) {
@@ -921,11 +1057,10 @@ func AddModuleVersion(c *gin.Context) {
 	var input struct {
 		Version string  `json:"version" binding:"required"`
 		Enabled bool    `json:"enabled"`
-		Subdir  *string `json:"subdir,omitempty"`
+		Subdir  *string `json:"subdir,omitempty" binding:"omitempty,relpath"`
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
 		return
 	}
 
@@ -980,6 +1115,7 @@ func AddModuleVersion(c *gin.Context) {
 
 	// Update module updated_at
 	database.DB.Exec("UPDATE modules SET updated_at = $1 WHERE id = $2", now, moduleID)
+	registryChanged(moduleID)
 
 	version := models.ModuleVersion{
 		ID:          versionID,
@@ -1013,6 +1149,10 @@ func DeleteModuleVersionByID(c *gin.Context) {
 		return
 	}
 
+	// Update module updated_at
+	database.DB.Exec("UPDATE modules SET updated_at = $1 WHERE id = $2", time.Now(), moduleID)
+	registryChanged(moduleID)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Version deleted"})
 }
 
@@ -1039,6 +1179,7 @@ func DeleteModuleByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Module not found"})
 		return
 	}
+	registryChanged(moduleID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Module deleted"})
 }
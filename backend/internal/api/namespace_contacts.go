@@ -0,0 +1,104 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// namespaceContactColumns selects the contact columns of namespace n, in the order
+// namespaceContactsRow scans them
+const namespaceContactColumns = `n.owner_emails, n.support_contact, n.links, n.logo_url`
+
+// namespaceContactsRow holds the contact columns of a namespace while scanning
+type namespaceContactsRow struct {
+	ownerEmails, supportContact, links, logoURL sql.NullString
+}
+
+// dest returns the scan destinations for namespaceContactColumns
+func (r *namespaceContactsRow) dest() []interface{} {
+	return []interface{}{&r.ownerEmails, &r.supportContact, &r.links, &r.logoURL}
+}
+
+// contacts decodes the scanned columns; lists are never nil
+func (r *namespaceContactsRow) contacts() models.NamespaceContacts {
+	contacts := models.NamespaceContacts{OwnerEmails: []string{}, Links: []models.NamespaceLink{}}
+	if r.ownerEmails.Valid {
+		json.Unmarshal([]byte(r.ownerEmails.String), &contacts.OwnerEmails)
+	}
+	if r.links.Valid {
+		json.Unmarshal([]byte(r.links.String), &contacts.Links)
+	}
+	if r.supportContact.Valid && r.supportContact.String != "" {
+		contacts.SupportContact = &r.supportContact.String
+	}
+	if r.logoURL.Valid && r.logoURL.String != "" {
+		contacts.LogoURL = &r.logoURL.String
+	}
+	return contacts
+}
+
+// validateOwnerEmails checks that every owner is a plain email address
+func validateOwnerEmails(emails []string) error {
+	for _, email := range emails {
+		addr, err := mail.ParseAddress(email)
+		if err != nil || addr.Address != email {
+			return fmt.Errorf("owner email %q is not a valid email address", email)
+		}
+	}
+	return nil
+}
+
+// validateNamespaceLinks checks that every link has a title and an http(s) URL
+func validateNamespaceLinks(links []models.NamespaceLink) error {
+	for _, link := range links {
+		if link.Title == "" {
+			return fmt.Errorf("link %q needs a title", link.URL)
+		}
+		if !isHTTPURL(link.URL) {
+			return fmt.Errorf("link %q must be an http or https URL", link.Title)
+		}
+	}
+	return nil
+}
+
+// isHTTPURL reports whether s is an absolute http or https URL
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// GetNamespaceContacts returns who to contact about a namespace's modules and providers,
+// for notifications and the catalog
+// GET /api/namespaces/:id/contacts
+func GetNamespaceContacts(c *gin.Context) {
+	var name string
+	var row namespaceContactsRow
+	err := database.DB.QueryRow(`SELECT n.name, `+namespaceContactColumns+` FROM namespaces n WHERE n.id = $1`, c.Param("id")).
+		Scan(append([]interface{}{&name}, row.dest()...)...)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Namespace not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	contacts := row.contacts()
+	c.JSON(http.StatusOK, gin.H{
+		"namespace_id":    c.Param("id"),
+		"namespace":       name,
+		"owner_emails":    contacts.OwnerEmails,
+		"support_contact": contacts.SupportContact,
+		"links":           contacts.Links,
+		"logo_url":        contacts.LogoURL,
+	})
+}
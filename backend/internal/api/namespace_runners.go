@@ -0,0 +1,105 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"iac-tool/internal/build"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadNamespaceRunners returns the runner binding of a namespace; the error is
+// sql.ErrNoRows when the namespace does not exist
+func loadNamespaceRunners(namespaceID string) (*models.NamespaceRunnerAssignment, error) {
+	var stored sql.NullString
+	err := database.DB.QueryRow(`SELECT runner_assignment FROM namespaces WHERE id = $1`, namespaceID).Scan(&stored)
+	if err != nil {
+		return nil, err
+	}
+	runners := build.LoadNamespaceRunners(stored)
+	return &models.NamespaceRunnerAssignment{
+		NamespaceID:      namespaceID,
+		NamespaceRunners: runners,
+		Restricted:       build.RunnerRestricted(runners),
+		Eligible:         build.EligibleRunners(runners),
+	}, nil
+}
+
+// GetNamespaceRunners returns the runners a namespace's runs are bound to
+// GET /api/namespaces/:id/runners
+func GetNamespaceRunners(c *gin.Context) {
+	assignment, err := loadNamespaceRunners(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Namespace not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, assignment)
+}
+
+// SetNamespaceRunners binds a namespace's runs to runners of the pool or to runner labels;
+// empty lists let them use the whole pool again
+// PUT /api/namespaces/:id/runners
+func SetNamespaceRunners(c *gin.Context) {
+	var input models.NamespaceRunners
+	if !bindJSON(c, &input) {
+		return
+	}
+	if input.Runners == nil {
+		input.Runners = []string{}
+	}
+	if input.Labels == nil {
+		input.Labels = []string{}
+	}
+
+	// Bindings that no runner satisfies would stop every run of the namespace
+	pool := build.RunnerPool()
+	for i, runnerURL := range input.Runners {
+		input.Runners[i] = strings.TrimSuffix(runnerURL, "/")
+		if !slices.Contains(pool, input.Runners[i]) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Runner " + runnerURL + " is not in the runner pool"})
+			return
+		}
+	}
+	if len(input.Labels) > 0 {
+		labelled := false
+		for _, labels := range build.RunnerLabels() {
+			labelled = labelled || !slices.ContainsFunc(input.Labels, func(l string) bool { return !slices.Contains(labels, l) })
+		}
+		if !labelled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No runner has the labels " + strings.Join(input.Labels, ", ")})
+			return
+		}
+	}
+
+	var stored *string
+	if build.RunnerRestricted(input) {
+		data, _ := json.Marshal(input)
+		value := string(data)
+		stored = &value
+	}
+	result, err := database.DB.Exec(`UPDATE namespaces SET runner_assignment = $1, updated_at = $2 WHERE id = $3`,
+		stored, time.Now(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Namespace not found"})
+		return
+	}
+
+	recordAuditEvent("namespace.runners_updated", c.GetString("api_key_name"), "namespace", c.Param("id"),
+		map[string]interface{}{"runners": input.Runners, "labels": input.Labels})
+	GetNamespaceRunners(c)
+}
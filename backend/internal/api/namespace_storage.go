@@ -0,0 +1,104 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"iac-tool/internal/build"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultStorageQuota is the storage quota of namespaces without their own:
+// NAMESPACE_STORAGE_QUOTA (e.g. "20g"), unlimited when unset
+func defaultStorageQuota() int64 {
+	quota, err := sizeFromEnv("NAMESPACE_STORAGE_QUOTA", 0)
+	if err != nil {
+		log.Printf("Warning: %v, namespaces without a quota are unlimited", err)
+		return 0
+	}
+	return quota
+}
+
+// loadNamespaceStorage returns the storage use and quota of a namespace; the error is
+// sql.ErrNoRows when the namespace does not exist
+func loadNamespaceStorage(namespaceID string) (*models.NamespaceStorage, string, error) {
+	var name string
+	var quota sql.NullInt64
+	err := database.DB.QueryRow(`SELECT name, storage_quota_bytes FROM namespaces WHERE id = $1`, namespaceID).Scan(&name, &quota)
+	if err != nil {
+		return nil, "", err
+	}
+
+	storage := &models.NamespaceStorage{NamespaceID: namespaceID}
+	if quota.Valid {
+		storage.QuotaBytes, storage.QuotaSource = quota.Int64, "namespace"
+	} else if def := defaultStorageQuota(); def > 0 {
+		storage.QuotaBytes, storage.QuotaSource = def, "default"
+	}
+	storage.UsedBytes, err = build.NamespaceStorage(build.ArtifactDir(), name)
+	if err != nil {
+		return nil, "", err
+	}
+	return storage, name, nil
+}
+
+// checkStorageQuota returns why storing size more bytes in a namespace, replacing a file
+// of replaced bytes, would exceed its quota; empty when it fits
+func checkStorageQuota(namespaceID string, size, replaced int64) (string, error) {
+	storage, name, err := loadNamespaceStorage(namespaceID)
+	if err != nil {
+		return "", err
+	}
+	if storage.QuotaBytes == 0 {
+		return "", nil
+	}
+	if after := storage.UsedBytes - replaced + size; after > storage.QuotaBytes {
+		return fmt.Sprintf("Namespace %s would use %d of its %d bytes storage quota (%d in use)",
+			name, after, storage.QuotaBytes, storage.UsedBytes), nil
+	}
+	return "", nil
+}
+
+// GetNamespaceStorage returns how much provider file storage a namespace uses of its quota
+// GET /api/namespaces/:id/storage
+func GetNamespaceStorage(c *gin.Context) {
+	storage, _, err := loadNamespaceStorage(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Namespace not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, storage)
+}
+
+// SetNamespaceStorageQuota sets the storage quota of a namespace in bytes (0 for
+// unlimited, null for NAMESPACE_STORAGE_QUOTA)
+// PUT /api/namespaces/:id/storage-quota
+func SetNamespaceStorageQuota(c *gin.Context) {
+	var input models.NamespaceStorageQuota
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	result, err := database.DB.Exec(`UPDATE namespaces SET storage_quota_bytes = $1, updated_at = $2 WHERE id = $3`,
+		input.QuotaBytes, time.Now(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Namespace not found"})
+		return
+	}
+
+	GetNamespaceStorage(c)
+}
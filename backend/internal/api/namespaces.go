@@ -5,6 +5,8 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
@@ -13,6 +15,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"iac-tool/internal/cache"
 	"iac-tool/internal/database"
 	"iac-tool/internal/models"
 	"iac-tool/internal/registry"
@@ -131,10 +134,34 @@ func TerraformAuthMiddleware() gin.HandlerFunc {
 		}
 
 		token := parts[1]
+		if rejectLockedOut(c, token, true) {
+			return
+		}
+
+		// Runs get a scoped token covering only the namespaces their deployment may read
+		if registry.IsScopedToken(token) {
+			claims, err := registry.ParseScopedToken(token)
+			if err != nil {
+				recordAuthFailure(c, token)
+				c.JSON(http.StatusUnauthorized, gin.H{"errors": []string{err.Error()}})
+				c.Abort()
+				return
+			}
+			if !claims.Allows(namespace) {
+				c.JSON(http.StatusForbidden, gin.H{
+					"errors": []string{"Token of run " + claims.RunID + " does not grant access to namespace " + namespace},
+				})
+				c.Abort()
+				return
+			}
+			c.Set("registry_consumer", "run:"+claims.RunID)
+			c.Next()
+			return
+		}
 
-		// Check if it's the internal registry token (allows access to all private namespaces from runner)
-		registryToken := registry.GetToken()
-		if token == registryToken {
+		// The global registry token (all private namespaces) only when REGISTRY_GLOBAL_TOKEN=true
+		if registry.GlobalTokenEnabled() && token == registry.GetToken() {
+			c.Set("registry_consumer", "registry-token")
 			c.Next()
 			return
 		}
@@ -151,6 +178,7 @@ func TerraformAuthMiddleware() gin.HandlerFunc {
 		`, keyHash).Scan(&apiKey.ID, &apiKey.Name, &apiKey.Permissions, &expiresAt)
 
 		if err == sql.ErrNoRows {
+			recordAuthFailure(c, token)
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"errors": []string{"Invalid API key"},
 			})
@@ -166,6 +194,7 @@ func TerraformAuthMiddleware() gin.HandlerFunc {
 
 		// Check expiration
 		if expiresAt.Valid && expiresAt.Time.Before(time.Now()) {
+			recordAuthFailure(c, token)
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"errors": []string{"API key has expired"},
 			})
@@ -175,7 +204,9 @@ func TerraformAuthMiddleware() gin.HandlerFunc {
 
 		// Update last used timestamp
 		database.DB.Exec("UPDATE api_keys SET last_used_at = $1 WHERE id = $2", time.Now(), apiKey.ID)
+		recordAuthSuccess(c, apiKey.ID, apiKey.Name)
 
+		c.Set("registry_consumer", "key:"+apiKey.ID)
 		c.Next()
 	}
 }
@@ -187,9 +218,10 @@ func TerraformAuthMiddleware() gin.HandlerFunc {
 // GetNamespaces returns all namespaces with stats
 func GetNamespaces(c *gin.Context) {
 	rows, err := database.DB.Query(`
-		SELECT n.id, n.name, n.description, n.is_public, n.created_at, n.updated_at,
+		SELECT n.id, n.name, n.description, n.is_public, n.organization_id, n.created_at, n.updated_at,
 			   (SELECT COUNT(*) FROM modules WHERE namespace_id = n.id) as module_count,
-			   (SELECT COUNT(*) FROM providers WHERE namespace_id = n.id) as provider_count
+			   (SELECT COUNT(*) FROM providers WHERE namespace_id = n.id) as provider_count,
+			   ` + namespaceContactColumns + `
 		FROM namespaces n
 		ORDER BY n.name
 	`)
@@ -203,13 +235,16 @@ func GetNamespaces(c *gin.Context) {
 	for rows.Next() {
 		var ns models.NamespaceWithStats
 		var description sql.NullString
-		if err := rows.Scan(&ns.ID, &ns.Name, &description, &ns.IsPublic, &ns.CreatedAt, &ns.UpdatedAt, &ns.ModuleCount, &ns.ProviderCount); err != nil {
+		var contacts namespaceContactsRow
+		if err := rows.Scan(append([]interface{}{&ns.ID, &ns.Name, &description, &ns.IsPublic, &ns.OrganizationID, &ns.CreatedAt, &ns.UpdatedAt,
+			&ns.ModuleCount, &ns.ProviderCount}, contacts.dest()...)...); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 		if description.Valid {
 			ns.Description = &description.String
 		}
+		ns.NamespaceContacts = contacts.contacts()
 		namespaces = append(namespaces, ns)
 	}
 
@@ -222,12 +257,15 @@ func GetNamespace(c *gin.Context) {
 
 	var ns models.NamespaceWithStats
 	var description sql.NullString
+	var contacts namespaceContactsRow
 	err := database.DB.QueryRow(`
-		SELECT n.id, n.name, n.description, n.is_public, n.created_at, n.updated_at,
+		SELECT n.id, n.name, n.description, n.is_public, n.organization_id, n.created_at, n.updated_at,
 			   (SELECT COUNT(*) FROM modules WHERE namespace_id = n.id) as module_count,
-			   (SELECT COUNT(*) FROM providers WHERE namespace_id = n.id) as provider_count
+			   (SELECT COUNT(*) FROM providers WHERE namespace_id = n.id) as provider_count,
+			   `+namespaceContactColumns+`
 		FROM namespaces n WHERE n.id = $1
-	`, id).Scan(&ns.ID, &ns.Name, &description, &ns.IsPublic, &ns.CreatedAt, &ns.UpdatedAt, &ns.ModuleCount, &ns.ProviderCount)
+	`, id).Scan(append([]interface{}{&ns.ID, &ns.Name, &description, &ns.IsPublic, &ns.OrganizationID, &ns.CreatedAt, &ns.UpdatedAt,
+		&ns.ModuleCount, &ns.ProviderCount}, contacts.dest()...)...)
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Namespace not found"})
@@ -240,6 +278,7 @@ func GetNamespace(c *gin.Context) {
 	if description.Valid {
 		ns.Description = &description.String
 	}
+	ns.NamespaceContacts = contacts.contacts()
 
 	c.JSON(http.StatusOK, ns)
 }
@@ -247,18 +286,47 @@ func GetNamespace(c *gin.Context) {
 // CreateNamespace creates a new namespace
 func CreateNamespace(c *gin.Context) {
 	var input models.NamespaceCreate
-	if err := c.ShouldBindJSON(&input); err != nil {
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	if err := validateOwnerEmails(input.OwnerEmails); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateNamespaceLinks(input.Links); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if input.LogoURL != nil && *input.LogoURL != "" && !isHTTPURL(*input.LogoURL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "logo_url must be an http or https URL"})
+		return
+	}
+	if input.OwnerEmails == nil {
+		input.OwnerEmails = []string{}
+	}
+	if input.Links == nil {
+		input.Links = []models.NamespaceLink{}
+	}
+	if input.OrganizationID != nil && *input.OrganizationID == "" {
+		input.OrganizationID = nil
+	}
+	if input.OrganizationID != nil {
+		if status, msg := checkNamespaceQuota(*input.OrganizationID); msg != "" {
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+	}
+	ownerEmailsJSON, _ := json.Marshal(input.OwnerEmails)
+	linksJSON, _ := json.Marshal(input.Links)
 
 	id := uuid.New().String()
 	now := time.Now()
 
 	_, err := database.DB.Exec(`
-		INSERT INTO namespaces (id, name, description, is_public, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, id, input.Name, input.Description, input.IsPublic, now, now)
+		INSERT INTO namespaces (id, name, description, is_public, organization_id, owner_emails, support_contact, links, logo_url, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, id, input.Name, input.Description, input.IsPublic, input.OrganizationID, string(ownerEmailsJSON), input.SupportContact, string(linksJSON), input.LogoURL, now, now)
 
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE") {
@@ -270,12 +338,19 @@ func CreateNamespace(c *gin.Context) {
 	}
 
 	ns := models.Namespace{
-		ID:          id,
-		Name:        input.Name,
-		Description: input.Description,
-		IsPublic:    input.IsPublic,
-		CreatedAt:   now,
-		UpdatedAt:   now,
+		ID:             id,
+		Name:           input.Name,
+		Description:    input.Description,
+		IsPublic:       input.IsPublic,
+		OrganizationID: input.OrganizationID,
+		NamespaceContacts: models.NamespaceContacts{
+			OwnerEmails:    input.OwnerEmails,
+			SupportContact: input.SupportContact,
+			Links:          input.Links,
+			LogoURL:        input.LogoURL,
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
 
 	c.JSON(http.StatusCreated, ns)
@@ -286,26 +361,65 @@ func UpdateNamespace(c *gin.Context) {
 	id := c.Param("id")
 
 	var input models.NamespaceUpdate
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
 		return
 	}
 
 	// Build dynamic update query
 	updates := []string{}
 	args := []interface{}{}
+	addUpdate := func(column string, value interface{}) {
+		args = append(args, value)
+		updates = append(updates, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
 
 	if input.Name != nil {
-		updates = append(updates, "name = $1")
-		args = append(args, *input.Name)
+		addUpdate("name", *input.Name)
 	}
 	if input.Description != nil {
-		updates = append(updates, "description = $1")
-		args = append(args, *input.Description)
+		addUpdate("description", *input.Description)
 	}
 	if input.IsPublic != nil {
-		updates = append(updates, "is_public = $1")
-		args = append(args, *input.IsPublic)
+		addUpdate("is_public", *input.IsPublic)
+	}
+	if input.OwnerEmails != nil {
+		if err := validateOwnerEmails(*input.OwnerEmails); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ownerEmailsJSON, _ := json.Marshal(*input.OwnerEmails)
+		addUpdate("owner_emails", string(ownerEmailsJSON))
+	}
+	if input.SupportContact != nil {
+		addUpdate("support_contact", sql.NullString{String: *input.SupportContact, Valid: *input.SupportContact != ""})
+	}
+	if input.Links != nil {
+		if err := validateNamespaceLinks(*input.Links); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		linksJSON, _ := json.Marshal(*input.Links)
+		addUpdate("links", string(linksJSON))
+	}
+	if input.LogoURL != nil {
+		if *input.LogoURL != "" && !isHTTPURL(*input.LogoURL) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "logo_url must be an http or https URL"})
+			return
+		}
+		addUpdate("logo_url", sql.NullString{String: *input.LogoURL, Valid: *input.LogoURL != ""})
+	}
+	if input.OrganizationID != nil {
+		if *input.OrganizationID != "" {
+			var current sql.NullString
+			database.DB.QueryRow("SELECT organization_id FROM namespaces WHERE id = $1", id).Scan(&current)
+			if current.String != *input.OrganizationID {
+				if status, msg := checkNamespaceQuota(*input.OrganizationID); msg != "" {
+					c.JSON(status, gin.H{"error": msg})
+					return
+				}
+			}
+		}
+		addUpdate("organization_id", sql.NullString{String: *input.OrganizationID, Valid: *input.OrganizationID != ""})
 	}
 
 	if len(updates) == 0 {
@@ -313,11 +427,10 @@ func UpdateNamespace(c *gin.Context) {
 		return
 	}
 
-	updates = append(updates, "updated_at = $1")
-	args = append(args, time.Now())
+	addUpdate("updated_at", time.Now())
 	args = append(args, id)
 
-	query := "UPDATE namespaces SET " + strings.Join(updates, ", ") + " WHERE id = $1"
+	query := fmt.Sprintf("UPDATE namespaces SET %s WHERE id = $%d", strings.Join(updates, ", "), len(args))
 	result, err := database.DB.Exec(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -329,16 +442,22 @@ func UpdateNamespace(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Namespace not found"})
 		return
 	}
+	if input.Name != nil {
+		// Cached registry lookups are keyed by namespace name
+		cache.Registry.Flush()
+	}
 
 	// Fetch updated namespace
 	var ns models.Namespace
 	var description sql.NullString
-	database.DB.QueryRow("SELECT id, name, description, is_public, created_at, updated_at FROM namespaces WHERE id = $1", id).Scan(
-		&ns.ID, &ns.Name, &description, &ns.IsPublic, &ns.CreatedAt, &ns.UpdatedAt,
+	var contacts namespaceContactsRow
+	database.DB.QueryRow("SELECT n.id, n.name, n.description, n.is_public, n.organization_id, n.created_at, n.updated_at, "+namespaceContactColumns+" FROM namespaces n WHERE n.id = $1", id).Scan(
+		append([]interface{}{&ns.ID, &ns.Name, &description, &ns.IsPublic, &ns.OrganizationID, &ns.CreatedAt, &ns.UpdatedAt}, contacts.dest()...)...,
 	)
 	if description.Valid {
 		ns.Description = &description.String
 	}
+	ns.NamespaceContacts = contacts.contacts()
 
 	c.JSON(http.StatusOK, ns)
 }
@@ -416,13 +535,37 @@ func GetAPIKeys(c *gin.Context) {
 	c.JSON(http.StatusOK, keys)
 }
 
-// CreateAPIKey creates a new global API key (works for all namespaces)
+// CreateAPIKey creates a new global API key (works for all namespaces). It needs an admin
+// key, except for the very first key, which bootstraps an installation and must be admin.
+// POST /api/api-keys
 func CreateAPIKey(c *gin.Context) {
+	var bootstrap bool
+	err := database.DB.QueryRow(`SELECT NOT EXISTS(SELECT 1 FROM api_keys WHERE name <> '__runner__')`).Scan(&bootstrap)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !bootstrap && !authorizeRole(c, "admin") {
+		return
+	}
+
 	var input struct {
-		Name string `json:"name" binding:"required"`
+		Name        string `json:"name" binding:"required"`
+		Permissions string `json:"permissions,omitempty"` // Defaults to "admin"
 	}
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	if input.Permissions == "" {
+		input.Permissions = "admin"
+	}
+	if _, ok := roleRank[input.Permissions]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Permissions must be one of: read, write, approver, admin"})
+		return
+	}
+	if bootstrap && input.Permissions != "admin" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The first API key must have admin permission"})
 		return
 	}
 
@@ -437,22 +580,27 @@ func CreateAPIKey(c *gin.Context) {
 	id := uuid.New().String()
 	now := time.Now()
 
-	// Create global API key with admin permissions
-	_, err = database.DB.Exec(`
-		INSERT INTO api_keys (id, name, key_hash, permissions, created_at)
-		VALUES ($1, $2, $3, 'admin', $4)
-	`, id, input.Name, keyHash, now)
-
+	// Create global API key; a bootstrap insert only succeeds while there is still no key,
+	// so concurrent unauthenticated requests cannot both create one
+	query := `INSERT INTO api_keys (id, name, key_hash, permissions, created_at) SELECT $1, $2, $3, $4, $5`
+	if bootstrap {
+		query += ` WHERE NOT EXISTS (SELECT 1 FROM api_keys WHERE name <> '__runner__')`
+	}
+	result, err := database.DB.Exec(query, id, input.Name, keyHash, input.Permissions, now)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key with 'admin' permission required"})
+		return
+	}
 
 	apiKey := models.APIKey{
 		ID:          id,
 		Name:        input.Name,
 		Key:         key, // Only returned on creation
-		Permissions: "admin",
+		Permissions: input.Permissions,
 		CreatedAt:   now,
 	}
 
@@ -460,6 +608,7 @@ func CreateAPIKey(c *gin.Context) {
 }
 
 // DeleteAPIKey deletes an API key
+// DELETE /api/api-keys/:keyId
 func DeleteAPIKey(c *gin.Context) {
 	keyID := c.Param("keyId")
 
@@ -0,0 +1,364 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"iac-tool/internal/build"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// organizationSelect is the base query used by scanOrganization
+const organizationSelect = `
+	SELECT o.id, o.name, o.description, o.default_deployment_settings, o.vcs_connections, o.quotas, o.created_at, o.updated_at,
+		(SELECT COUNT(*) FROM namespaces n WHERE n.organization_id = o.id),
+		(SELECT COUNT(*) FROM deployments d JOIN namespaces n ON d.namespace_id = n.id WHERE n.organization_id = o.id),
+		(SELECT COUNT(*) FROM deployment_runs r JOIN deployments d ON r.deployment_id = d.id JOIN namespaces n ON d.namespace_id = n.id
+			WHERE n.organization_id = o.id AND r.completed_at IS NULL)
+	FROM organizations o`
+
+// storedVCSConnection is a VCS connection as stored, its credentials encrypted in the
+// same format as a deployment's git_auth_data
+type storedVCSConnection struct {
+	Host     string `json:"host"`
+	Username string `json:"username"`
+	AuthData string `json:"auth_data"`
+}
+
+// scanOrganization scans a row selected with organizationSelect, returning the stored
+// VCS connections alongside
+func scanOrganization(row rowScanner) (*models.Organization, []storedVCSConnection, error) {
+	var o models.Organization
+	var defaultsJSON, vcsJSON, quotasJSON sql.NullString
+	err := row.Scan(&o.ID, &o.Name, &o.Description, &defaultsJSON, &vcsJSON, &quotasJSON, &o.CreatedAt, &o.UpdatedAt,
+		&o.Usage.Namespaces, &o.Usage.Deployments, &o.Usage.ActiveRuns)
+	if err != nil {
+		return nil, nil, err
+	}
+	if defaultsJSON.Valid && defaultsJSON.String != "" {
+		json.Unmarshal([]byte(defaultsJSON.String), &o.DefaultDeploymentSettings)
+	}
+	if quotasJSON.Valid && quotasJSON.String != "" {
+		json.Unmarshal([]byte(quotasJSON.String), &o.Quotas)
+	}
+	var stored []storedVCSConnection
+	if vcsJSON.Valid && vcsJSON.String != "" {
+		json.Unmarshal([]byte(vcsJSON.String), &stored)
+	}
+	o.VCSConnections = make([]models.VCSConnection, 0, len(stored))
+	for _, conn := range stored {
+		o.VCSConnections = append(o.VCSConnections, models.VCSConnection{Host: conn.Host, Username: conn.Username})
+	}
+	return &o, stored, nil
+}
+
+// encryptVCSConnections encrypts the credentials of VCS connections. A connection given
+// without a password keeps the one stored for the same host and username.
+func encryptVCSConnections(conns []models.VCSConnection, existing []storedVCSConnection) ([]storedVCSConnection, error) {
+	stored := make([]storedVCSConnection, 0, len(conns))
+	seen := make(map[string]bool)
+	for _, conn := range conns {
+		host := strings.ToLower(conn.Host)
+		if strings.ContainsAny(host, "/@ ") {
+			return nil, fmt.Errorf("vcs connection host %q must be a host name (e.g., github.com)", conn.Host)
+		}
+		if seen[host] {
+			return nil, fmt.Errorf("vcs connection host %q is listed twice", conn.Host)
+		}
+		seen[host] = true
+
+		s := storedVCSConnection{Host: host, Username: conn.Username}
+		if conn.Password == "" {
+			for _, old := range existing {
+				if old.Host == host && old.Username == conn.Username {
+					s.AuthData = old.AuthData
+				}
+			}
+			if s.AuthData == "" {
+				return nil, fmt.Errorf("vcs connection %s needs a password", conn.Host)
+			}
+		} else {
+			_, authData, err := deploymentAuth(true, conn.Username, conn.Password)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encrypt authentication data")
+			}
+			s.AuthData = authData.String
+		}
+		stored = append(stored, s)
+	}
+	return stored, nil
+}
+
+// namespaceOrganization returns the organization a namespace belongs to, or nil
+func namespaceOrganization(namespaceID string) (*models.Organization, []storedVCSConnection, error) {
+	o, stored, err := scanOrganization(database.DB.QueryRow(organizationSelect+`
+		WHERE o.id = (SELECT organization_id FROM namespaces WHERE id = $1)`, namespaceID))
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	return o, stored, err
+}
+
+// inheritDeploymentSettings fills the settings a new deployment leaves unset with its
+// organization's defaults
+func inheritDeploymentSettings(s *models.DeploymentSettings, defaults models.DeploymentSettings) {
+	if s.TerraformWorkspace == nil {
+		s.TerraformWorkspace = defaults.TerraformWorkspace
+	}
+	if s.Hooks == nil {
+		s.Hooks = defaults.Hooks
+	}
+	if s.RunnerImage == nil {
+		s.RunnerImage = defaults.RunnerImage
+	}
+	if s.AutoDestroyAfter == nil {
+		s.AutoDestroyAfter = defaults.AutoDestroyAfter
+	}
+	if s.PlanValidity == nil {
+		s.PlanValidity = defaults.PlanValidity
+	}
+	if s.CloneOptions == nil {
+		s.CloneOptions = defaults.CloneOptions
+	}
+	if s.Pipeline == nil {
+		s.Pipeline = defaults.Pipeline
+	}
+	if s.Terragrunt == nil {
+		s.Terragrunt = defaults.Terragrunt
+	}
+	if len(s.WatchPaths) == 0 {
+		s.WatchPaths = defaults.WatchPaths
+	}
+	if len(s.RegistryNamespaces) == 0 {
+		s.RegistryNamespaces = defaults.RegistryNamespaces
+	}
+}
+
+// vcsConnectionAuth returns the encrypted credentials of the VCS connection for a
+// repository's host, if any
+func vcsConnectionAuth(conns []storedVCSConnection, gitURL string) (sql.NullString, bool) {
+	for _, conn := range conns {
+		if sameGitHost("https://"+conn.Host, gitURL) {
+			return sql.NullString{String: conn.AuthData, Valid: true}, true
+		}
+	}
+	return sql.NullString{}, false
+}
+
+// checkNamespaceQuota reports why a namespace may not join an organization, if it may not
+func checkNamespaceQuota(organizationID string) (int, string) {
+	o, _, err := scanOrganization(database.DB.QueryRow(organizationSelect+` WHERE o.id = $1`, organizationID))
+	if err != nil {
+		return http.StatusBadRequest, "Organization not found"
+	}
+	if q := o.Quotas.MaxNamespaces; q > 0 && o.Usage.Namespaces >= q {
+		return http.StatusConflict, fmt.Sprintf("Organization %s has reached its quota of %d namespaces", o.Name, q)
+	}
+	return 0, ""
+}
+
+// runQuotaAllows checks the organization's concurrent run quota before a handler creates
+// a run of a deployment, writing a 429 response when it is reached
+func runQuotaAllows(c *gin.Context, deploymentID string) bool {
+	if msg := build.CheckRunQuota(deploymentID, 1); msg != "" {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": msg})
+		return false
+	}
+	return true
+}
+
+// validateOrganizationSettings checks an organization's default deployment settings
+func validateOrganizationSettings(defaults *models.DeploymentSettings) error {
+	if err := validateDeploymentSettings(defaults); err != nil {
+		return fmt.Errorf("default_deployment_settings: %w", err)
+	}
+	return nil
+}
+
+// GetOrganizations lists organizations with their usage
+// GET /api/organizations
+func GetOrganizations(c *gin.Context) {
+	rows, err := database.DB.Query(organizationSelect + " ORDER BY o.name")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	organizations := []models.Organization{}
+	for rows.Next() {
+		o, _, err := scanOrganization(rows)
+		if err != nil {
+			continue
+		}
+		organizations = append(organizations, *o)
+	}
+	c.JSON(http.StatusOK, organizations)
+}
+
+// GetOrganization returns an organization with its usage
+// GET /api/organizations/:id
+func GetOrganization(c *gin.Context) {
+	o, _, err := scanOrganization(database.DB.QueryRow(organizationSelect+" WHERE o.id = $1", c.Param("id")))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+	c.JSON(http.StatusOK, o)
+}
+
+// CreateOrganization creates an organization
+// POST /api/organizations
+func CreateOrganization(c *gin.Context) {
+	var input models.OrganizationCreate
+	if !bindJSON(c, &input) {
+		return
+	}
+	if err := validateOrganizationSettings(&input.DefaultDeploymentSettings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	vcs, err := encryptVCSConnections(input.VCSConnections, nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	defaultsJSON, _ := json.Marshal(input.DefaultDeploymentSettings)
+	vcsJSON, _ := json.Marshal(vcs)
+	quotasJSON, _ := json.Marshal(input.Quotas)
+	id := generateID()
+	now := time.Now()
+	_, err = database.DB.Exec(`
+		INSERT INTO organizations (id, name, description, default_deployment_settings, vcs_connections, quotas, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+	`, id, input.Name, input.Description, string(defaultsJSON), string(vcsJSON), string(quotasJSON), now)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			c.JSON(http.StatusConflict, gin.H{"error": "Organization already exists"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	o, _, err := scanOrganization(database.DB.QueryRow(organizationSelect+" WHERE o.id = $1", id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, o)
+}
+
+// UpdateOrganization updates an organization. New defaults apply to deployments created
+// afterwards.
+// PATCH /api/organizations/:id
+func UpdateOrganization(c *gin.Context) {
+	id := c.Param("id")
+	var input models.OrganizationUpdate
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	o, stored, err := scanOrganization(database.DB.QueryRow(organizationSelect+" WHERE o.id = $1", id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+
+	// Build dynamic update query
+	updates := []string{}
+	args := []interface{}{}
+	addUpdate := func(column string, value interface{}) {
+		args = append(args, value)
+		updates = append(updates, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if input.Name != nil {
+		if *input.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name must not be empty"})
+			return
+		}
+		addUpdate("name", *input.Name)
+	}
+	if input.Description != nil {
+		addUpdate("description", sql.NullString{String: *input.Description, Valid: *input.Description != ""})
+	}
+	if input.DefaultDeploymentSettings != nil {
+		if err := validateOrganizationSettings(input.DefaultDeploymentSettings); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defaultsJSON, _ := json.Marshal(input.DefaultDeploymentSettings)
+		addUpdate("default_deployment_settings", string(defaultsJSON))
+	}
+	if input.VCSConnections != nil {
+		vcs, err := encryptVCSConnections(*input.VCSConnections, stored)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		vcsJSON, _ := json.Marshal(vcs)
+		addUpdate("vcs_connections", string(vcsJSON))
+	}
+	if input.Quotas != nil {
+		quotasJSON, _ := json.Marshal(input.Quotas)
+		addUpdate("quotas", string(quotasJSON))
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	addUpdate("updated_at", time.Now())
+	args = append(args, o.ID)
+
+	query := fmt.Sprintf("UPDATE organizations SET %s WHERE id = $%d", strings.Join(updates, ", "), len(args))
+	if _, err := database.DB.Exec(query, args...); err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			c.JSON(http.StatusConflict, gin.H{"error": "Organization already exists"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	o, _, err = scanOrganization(database.DB.QueryRow(organizationSelect+" WHERE o.id = $1", id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, o)
+}
+
+// DeleteOrganization deletes an organization that has no namespaces left
+// DELETE /api/organizations/:id
+func DeleteOrganization(c *gin.Context) {
+	id := c.Param("id")
+
+	var count int
+	database.DB.QueryRow("SELECT COUNT(*) FROM namespaces WHERE organization_id = $1", id).Scan(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Organization has namespaces. Move or delete them first."})
+		return
+	}
+
+	result, err := database.DB.Exec(`DELETE FROM organizations WHERE id = $1`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Organization deleted"})
+}
@@ -0,0 +1,536 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"iac-tool/internal/build"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+	"iac-tool/internal/server"
+	"iac-tool/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// providerBuildStartTimeout is how long a build may stay pending before a new build of the
+// version replaces it
+const providerBuildStartTimeout = 5 * time.Minute
+
+const providerBuildSelect = `
+	SELECT b.id, b.provider_id, b.version_id, v.version, b.status, b.platforms, b.log, b.go_version, b.error,
+		b.started_at, b.finished_at, b.created_at
+	FROM provider_builds b
+	JOIN provider_versions v ON b.version_id = v.id`
+
+func scanProviderBuild(row rowScanner) (*models.ProviderBuild, error) {
+	var b models.ProviderBuild
+	var platformsJSON, buildLog, buildError sql.NullString
+	var startedAt, finishedAt sql.NullTime
+	err := row.Scan(&b.ID, &b.ProviderID, &b.VersionID, &b.Version, &b.Status, &platformsJSON, &buildLog, &b.GoVersion, &buildError,
+		&startedAt, &finishedAt, &b.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if platformsJSON.Valid {
+		json.Unmarshal([]byte(platformsJSON.String), &b.Platforms)
+	}
+	if b.Platforms == nil {
+		b.Platforms = []models.ProviderBuildPlatform{}
+	}
+	if buildLog.Valid {
+		b.Log = &buildLog.String
+	}
+	if buildError.Valid {
+		b.Error = &buildError.String
+	}
+	if startedAt.Valid {
+		b.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		b.FinishedAt = &finishedAt.Time
+	}
+	return &b, nil
+}
+
+// parseBuildPlatforms validates requested platforms, defaulting to fallback when none are given
+func parseBuildPlatforms(requested []models.ProviderPlatformDTO, fallback []build.Platform) ([]build.Platform, error) {
+	if len(requested) == 0 {
+		return fallback, nil
+	}
+	seen := make(map[string]bool)
+	platforms := make([]build.Platform, 0, len(requested))
+	for _, p := range requested {
+		if !validation.ValidPlatform(p.OS, p.Arch) {
+			return nil, errors.New(validation.PlatformMessage(p.OS, p.Arch))
+		}
+		platform := build.Platform{OS: p.OS, Arch: p.Arch}
+		if seen[platform.String()] {
+			continue
+		}
+		seen[platform.String()] = true
+		platforms = append(platforms, platform)
+	}
+	return platforms, nil
+}
+
+// StartProviderBuild compiles a provider version from its Git source
+// POST /api/providers/:id/versions/:versionId/builds
+func StartProviderBuild(c *gin.Context) {
+	providerID := c.Param("id")
+	versionID := c.Param("versionId")
+
+	var input models.ProviderBuildCreate
+	if c.Request.ContentLength > 0 {
+		if !bindJSON(c, &input) {
+			return
+		}
+	}
+
+	platforms, err := parseBuildPlatforms(input.Platforms, build.DefaultPlatforms())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var sourceURL, goVersion sql.NullString
+	err = database.DB.QueryRow(`
+		SELECT p.source_url, p.build_go_version FROM providers p
+		JOIN provider_versions v ON v.provider_id = p.id
+		WHERE p.id = $1 AND v.id = $2
+	`, providerID, versionID).Scan(&sourceURL, &goVersion)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return
+	}
+	if !sourceURL.Valid || sourceURL.String == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provider has no Git source URL"})
+		return
+	}
+	if input.GoVersion != "" {
+		toolchain, err := build.ParseGoVersion(input.GoVersion)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		goVersion = sql.NullString{String: toolchain, Valid: true}
+	}
+
+	// A pending build that never started was lost with the process that created it
+	_, err = database.DB.Exec(`
+		UPDATE provider_builds SET status = 'failed', error = 'Build did not start', finished_at = $1
+		WHERE version_id = $2 AND status = 'pending' AND started_at IS NULL AND created_at < $3
+	`, time.Now(), versionID, time.Now().Add(-providerBuildStartTimeout))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	records := make([]models.ProviderBuildPlatform, len(platforms))
+	for i, p := range platforms {
+		records[i] = models.ProviderBuildPlatform{OS: p.OS, Arch: p.Arch, Status: "pending"}
+	}
+	platformsData, _ := json.Marshal(records)
+
+	// The provider_builds_in_progress index admits one pending or running build per version
+	buildID := generateID()
+	result, err := database.DB.Exec(`
+		INSERT INTO provider_builds (id, provider_id, version_id, status, platforms, go_version, created_at)
+		VALUES ($1, $2, $3, 'pending', $4, $5, $6)
+		ON CONFLICT (version_id) WHERE status IN ('pending', 'running') DO NOTHING
+	`, buildID, providerID, versionID, string(platformsData), goVersion, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create build: " + err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A build is already in progress for this version"})
+		return
+	}
+
+	build.StartProviderBuild(buildID, requestBaseURL(c), build.ArtifactDir(), platforms)
+
+	b, err := scanProviderBuild(database.DB.QueryRow(providerBuildSelect+" WHERE b.id = $1", buildID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, b)
+}
+
+// GetProviderBuilds lists the builds of a provider, newest first (logs omitted)
+// GET /api/providers/:id/builds
+func GetProviderBuilds(c *gin.Context) {
+	providerID := c.Param("id")
+
+	rows, err := database.DB.Query(providerBuildSelect+" WHERE b.provider_id = $1 ORDER BY b.created_at DESC", providerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	builds := []models.ProviderBuild{}
+	for rows.Next() {
+		b, err := scanProviderBuild(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		b.Log = nil
+		for i := range b.Platforms {
+			b.Platforms[i].Log = ""
+			b.Platforms[i].Provenance = nil
+			b.Platforms[i].ProvenanceSignature = ""
+		}
+		builds = append(builds, *b)
+	}
+
+	c.JSON(http.StatusOK, builds)
+}
+
+// GetProviderBuild returns a build with its per-platform logs
+// GET /api/providers/:id/builds/:buildId
+func GetProviderBuild(c *gin.Context) {
+	b, err := scanProviderBuild(database.DB.QueryRow(providerBuildSelect+" WHERE b.id = $1 AND b.provider_id = $2",
+		c.Param("buildId"), c.Param("id")))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Build not found"})
+		return
+	}
+	c.JSON(http.StatusOK, b)
+}
+
+// buildPlatformRecord loads the record of one platform of a build. It writes the error
+// response itself.
+func buildPlatformRecord(c *gin.Context) (*models.ProviderBuildPlatform, bool) {
+	b, err := scanProviderBuild(database.DB.QueryRow(providerBuildSelect+" WHERE b.id = $1 AND b.provider_id = $2",
+		c.Param("buildId"), c.Param("id")))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Build not found"})
+		return nil, false
+	}
+	for i := range b.Platforms {
+		if b.Platforms[i].OS == c.Param("os") && b.Platforms[i].Arch == c.Param("arch") {
+			if len(b.Platforms[i].Provenance) == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Platform has no provenance (not built successfully)"})
+				return nil, false
+			}
+			return &b.Platforms[i], true
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Platform is not part of this build"})
+	return nil, false
+}
+
+// GetProviderBuildProvenance returns the provenance statement of a built platform, as
+// the exact bytes its signature covers
+// GET /api/providers/:id/builds/:buildId/provenance/:os/:arch
+func GetProviderBuildProvenance(c *gin.Context) {
+	record, ok := buildPlatformRecord(c)
+	if !ok {
+		return
+	}
+	c.Data(http.StatusOK, "application/vnd.in-toto+json", record.Provenance)
+}
+
+// GetProviderBuildProvenanceSignature returns the detached GPG signature of a built
+// platform's provenance, verifiable with the registry's public key
+// GET /api/providers/:id/builds/:buildId/provenance/:os/:arch/signature
+func GetProviderBuildProvenanceSignature(c *gin.Context) {
+	record, ok := buildPlatformRecord(c)
+	if !ok {
+		return
+	}
+	signature, err := base64.StdEncoding.DecodeString(record.ProvenanceSignature)
+	if err != nil || len(signature) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Provenance is not signed"})
+		return
+	}
+	c.Data(http.StatusOK, "application/octet-stream", signature)
+}
+
+// StreamProviderBuildLogs streams build output as server-sent events. Each
+// "log" event carries a {platform, line} object; a final "status" event carries
+// the build status. Finished builds replay their stored logs.
+// GET /api/providers/:id/builds/:buildId/stream
+func StreamProviderBuildLogs(c *gin.Context) {
+	buildID := c.Param("buildId")
+
+	var exists bool
+	database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM provider_builds WHERE id = $1 AND provider_id = $2)`,
+		buildID, c.Param("id")).Scan(&exists)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Build not found"})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Streaming not supported"})
+		return
+	}
+
+	backlog, lines, unsubscribe, active := build.SubscribeProviderBuild(buildID)
+	if active {
+		defer unsubscribe()
+		for _, line := range backlog {
+			c.SSEvent("log", line)
+		}
+		flusher.Flush()
+
+	follow:
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					break follow
+				}
+				c.SSEvent("log", line)
+				flusher.Flush()
+			case <-c.Request.Context().Done():
+				return
+			case <-server.ShuttingDown():
+				// Do not hold up the shutdown; the client reconnects
+				return
+			}
+		}
+	}
+
+	b, err := scanProviderBuild(database.DB.QueryRow(providerBuildSelect+" WHERE b.id = $1", buildID))
+	if err != nil {
+		return
+	}
+
+	// Replay stored output for builds that finished before the client connected
+	if !active {
+		if b.Log != nil {
+			for _, line := range splitLogLines(*b.Log) {
+				c.SSEvent("log", build.BuildLogLine{Line: line})
+			}
+		}
+		for _, p := range b.Platforms {
+			platform := build.Platform{OS: p.OS, Arch: p.Arch}.String()
+			for _, line := range splitLogLines(p.Log) {
+				c.SSEvent("log", build.BuildLogLine{Platform: platform, Line: line})
+			}
+			if p.Error != "" {
+				c.SSEvent("log", build.BuildLogLine{Platform: platform, Line: "Error: " + p.Error})
+			}
+		}
+	}
+	c.SSEvent("status", gin.H{"status": b.Status})
+	flusher.Flush()
+}
+
+// RetryProviderBuild rebuilds some platforms of a build, by default the ones that failed
+// POST /api/providers/:id/builds/:buildId/retry
+func RetryProviderBuild(c *gin.Context) {
+	buildID := c.Param("buildId")
+
+	var input models.ProviderBuildCreate
+	if c.Request.ContentLength > 0 {
+		if !bindJSON(c, &input) {
+			return
+		}
+	}
+
+	b, err := scanProviderBuild(database.DB.QueryRow(providerBuildSelect+" WHERE b.id = $1 AND b.provider_id = $2",
+		buildID, c.Param("id")))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Build not found"})
+		return
+	}
+
+	// A build left "running" by a backend restart is no longer active and may be retried
+	if build.IsProviderBuildActive(buildID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Build is still in progress"})
+		return
+	}
+
+	var failed []build.Platform
+	known := make(map[string]bool)
+	for _, p := range b.Platforms {
+		platform := build.Platform{OS: p.OS, Arch: p.Arch}
+		known[platform.String()] = true
+		if p.Status != "success" {
+			failed = append(failed, platform)
+		}
+	}
+
+	platforms, err := parseBuildPlatforms(input.Platforms, failed)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(platforms) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No failed platforms to retry"})
+		return
+	}
+	for _, p := range platforms {
+		if !known[p.String()] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Platform " + p.String() + " is not part of this build"})
+			return
+		}
+	}
+
+	// Claim the build so a concurrent retry cannot start it twice, nor next to another
+	// build of the version
+	result, err := database.DB.Exec(`
+		UPDATE provider_builds b SET status = 'pending' WHERE id = $1 AND status <> 'pending'
+		AND NOT EXISTS (
+			SELECT 1 FROM provider_builds o
+			WHERE o.version_id = b.version_id AND o.id <> b.id AND o.status IN ('pending', 'running'))
+	`, buildID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A build is already in progress for this version"})
+		return
+	}
+	build.StartProviderBuild(buildID, requestBaseURL(c), build.ArtifactDir(), platforms)
+
+	retried := make([]models.ProviderPlatformDTO, len(platforms))
+	for i, p := range platforms {
+		retried[i] = models.ProviderPlatformDTO{OS: p.OS, Arch: p.Arch}
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":   "Build retry started",
+		"build_id":  buildID,
+		"platforms": retried,
+	})
+}
+
+// GetProviderBuildToolchain returns the Go toolchain a provider's builds use
+// GET /api/providers/:id/build-toolchain
+func GetProviderBuildToolchain(c *gin.Context) {
+	var goVersion sql.NullString
+	if err := database.DB.QueryRow(`SELECT build_go_version FROM providers WHERE id = $1`, c.Param("id")).Scan(&goVersion); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Provider not found"})
+		return
+	}
+	if !goVersion.Valid {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No build toolchain configured"})
+		return
+	}
+	c.JSON(http.StatusOK, models.ProviderBuildToolchain{GoVersion: goVersion.String})
+}
+
+// SetProviderBuildToolchain pins the Go toolchain of a provider's builds
+// PUT /api/providers/:id/build-toolchain
+func SetProviderBuildToolchain(c *gin.Context) {
+	var input models.ProviderBuildToolchain
+	if !bindJSON(c, &input) {
+		return
+	}
+	toolchain, err := build.ParseGoVersion(input.GoVersion)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := database.DB.Exec(`UPDATE providers SET build_go_version = $1, updated_at = $2 WHERE id = $3`,
+		toolchain, time.Now(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Provider not found"})
+		return
+	}
+	c.JSON(http.StatusOK, models.ProviderBuildToolchain{GoVersion: toolchain})
+}
+
+// DeleteProviderBuildToolchain unpins a provider's toolchain, so builds use the image's again
+// DELETE /api/providers/:id/build-toolchain
+func DeleteProviderBuildToolchain(c *gin.Context) {
+	result, err := database.DB.Exec(`UPDATE providers SET build_go_version = NULL, updated_at = $1 WHERE id = $2`,
+		time.Now(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Provider not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Build toolchain removed"})
+}
+
+// splitLogLines splits stored log text into lines for replay
+func splitLogLines(text string) []string {
+	text = strings.TrimRight(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// ImportProviderRelease registers a version's platforms from the goreleaser artifacts of
+// its GitHub release instead of building them
+// POST /api/providers/:id/versions/:versionId/import-release
+func ImportProviderRelease(c *gin.Context) {
+	providerID := c.Param("id")
+	versionID := c.Param("versionId")
+
+	var input models.ProviderReleaseImport
+	if c.Request.ContentLength > 0 {
+		if !bindJSON(c, &input) {
+			return
+		}
+	}
+	platforms, err := parseBuildPlatforms(input.Platforms, nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// The registry signs what it serves, so it only takes releases it could verify
+	if strings.TrimSpace(input.GPGPublicKey) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "gpg_public_key is required: the release's SHA256SUMS.sig must verify against the publisher's key"})
+		return
+	}
+
+	var sourceURL sql.NullString
+	err = database.DB.QueryRow(`
+		SELECT p.source_url FROM providers p
+		JOIN provider_versions v ON v.provider_id = p.id
+		WHERE p.id = $1 AND v.id = $2
+	`, providerID, versionID).Scan(&sourceURL)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return
+	}
+	if !sourceURL.Valid || sourceURL.String == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provider has no Git source URL"})
+		return
+	}
+
+	result, err := build.ImportRelease(providerID, versionID, requestBaseURL(c), build.ArtifactDir(), build.ReleaseImportOptions{
+		Tag:          strings.TrimSpace(input.Tag),
+		Platforms:    platforms,
+		GPGPublicKey: input.GPGPublicKey,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Release import failed: " + err.Error()})
+		return
+	}
+
+	status := http.StatusOK
+	if result.Imported() == 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, result)
+}
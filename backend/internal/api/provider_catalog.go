@@ -0,0 +1,80 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/git"
+	"iac-tool/internal/markdown"
+	"iac-tool/internal/models"
+)
+
+// maxAbstractLength is how much of a README's first paragraph catalog cards get
+const maxAbstractLength = 300
+
+// providerCatalogColumns selects the catalog columns of provider p, in the order
+// providerCatalogRow scans them
+const providerCatalogColumns = `p.readme_abstract, p.repository_description, p.topics, p.catalog_synced_at`
+
+// providerCatalogRow holds the catalog columns of a provider while scanning
+type providerCatalogRow struct {
+	abstract, description, topics sql.NullString
+	syncedAt                      sql.NullTime
+}
+
+// dest returns the scan destinations for providerCatalogColumns
+func (r *providerCatalogRow) dest() []interface{} {
+	return []interface{}{&r.abstract, &r.description, &r.topics, &r.syncedAt}
+}
+
+// catalog decodes the scanned columns; topics are never nil
+func (r *providerCatalogRow) catalog() models.ProviderCatalog {
+	catalog := models.ProviderCatalog{Topics: []string{}}
+	if r.abstract.Valid && r.abstract.String != "" {
+		catalog.Abstract = &r.abstract.String
+	}
+	if r.description.Valid && r.description.String != "" {
+		catalog.RepositoryDescription = &r.description.String
+	}
+	if r.topics.Valid {
+		json.Unmarshal([]byte(r.topics.String), &catalog.Topics)
+	}
+	if r.syncedAt.Valid {
+		catalog.CatalogSyncedAt = &r.syncedAt.Time
+	}
+	return catalog
+}
+
+// refreshProviderCatalog captures the README abstract and the repository's description
+// and topics of a provider for its catalog card. What cannot be fetched keeps its
+// previous value; failures do not fail the sync.
+func refreshProviderCatalog(providerID, sourceURL string, auth *git.AuthConfig) {
+	abstract := sql.NullString{}
+	if readme, err := git.GetReadmeWithAuth(sourceURL, "", auth); err == nil {
+		abstract = sql.NullString{String: markdown.Abstract(readme, maxAbstractLength), Valid: true}
+	} else {
+		log.Printf("Provider %s: README not available for the catalog: %v", providerID, err)
+	}
+
+	description, topics := sql.NullString{}, sql.NullString{}
+	if meta, err := git.GetRepoMetadata(sourceURL, auth); err == nil {
+		if meta.Topics == nil {
+			meta.Topics = []string{}
+		}
+		topicsJSON, _ := json.Marshal(meta.Topics)
+		description = sql.NullString{String: meta.Description, Valid: true}
+		topics = sql.NullString{String: string(topicsJSON), Valid: true}
+	}
+
+	database.DB.Exec(`
+		UPDATE providers
+		SET readme_abstract = COALESCE($1, readme_abstract),
+			repository_description = COALESCE($2, repository_description),
+			topics = COALESCE($3, topics),
+			catalog_synced_at = $4
+		WHERE id = $5
+	`, abstract, description, topics, time.Now(), providerID)
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+	"time"
+
+	"iac-tool/internal/build"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// latestChannel follows the highest enabled version (by semantic version) unless
+// explicitly pinned
+const latestChannel = "latest"
+
+var channelNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,49}$`)
+
+// loadProviderChannels returns the channels of a provider, including the
+// automatic "latest" channel when it has not been pinned
+func loadProviderChannels(providerID string) ([]models.ProviderChannel, error) {
+	rows, err := database.DB.Query(`
+		SELECT c.name, c.version_id, v.version, c.updated_at
+		FROM provider_channels c
+		JOIN provider_versions v ON c.version_id = v.id
+		WHERE c.provider_id = $1
+		ORDER BY c.name
+	`, providerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := make([]models.ProviderChannel, 0)
+	pinnedLatest := false
+	for rows.Next() {
+		var ch models.ProviderChannel
+		var updatedAt time.Time
+		if err := rows.Scan(&ch.Name, &ch.VersionID, &ch.Version, &updatedAt); err != nil {
+			return nil, err
+		}
+		ch.UpdatedAt = &updatedAt
+		if ch.Name == latestChannel {
+			pinnedLatest = true
+		}
+		channels = append(channels, ch)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if !pinnedLatest {
+		// Versions that are not semantic versions fall back to the newest tag
+		rows, err := database.DB.Query(`
+			SELECT id, version FROM provider_versions
+			WHERE provider_id = $1 AND COALESCE(enabled, TRUE)
+			ORDER BY COALESCE(tag_date, created_at) DESC
+		`, providerID)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var ids, versions []string
+		for rows.Next() {
+			var id, version string
+			if err := rows.Scan(&id, &version); err != nil {
+				return nil, err
+			}
+			ids, versions = append(ids, id), append(versions, version)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		if i := build.NewestVersion(versions); i >= 0 {
+			latest := models.ProviderChannel{Name: latestChannel, Automatic: true, VersionID: ids[i], Version: versions[i]}
+			channels = append([]models.ProviderChannel{latest}, channels...)
+		}
+	}
+
+	return channels, nil
+}
+
+// GetProviderChannels lists the channels of a provider
+// GET /api/providers/:id/channels
+func GetProviderChannels(c *gin.Context) {
+	providerID := c.Param("id")
+
+	var exists bool
+	database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM providers WHERE id = $1)", providerID).Scan(&exists)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Provider not found"})
+		return
+	}
+
+	channels, err := loadProviderChannels(providerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, channels)
+}
+
+// GetProviderChannel resolves a channel to its concrete version
+// GET /api/providers/:id/channels/:channel
+func GetProviderChannel(c *gin.Context) {
+	providerID := c.Param("id")
+	name := c.Param("channel")
+
+	channels, err := loadProviderChannels(providerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, ch := range channels {
+		if ch.Name == name {
+			c.JSON(http.StatusOK, ch)
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+}
+
+// SetProviderChannel creates or moves a channel to point at a version
+// PUT /api/providers/:id/channels/:channel
+func SetProviderChannel(c *gin.Context) {
+	providerID := c.Param("id")
+	name := c.Param("channel")
+
+	if !channelNamePattern.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Channel name must be lowercase alphanumeric (with . _ -), up to 50 characters"})
+		return
+	}
+
+	var input models.ProviderChannelSet
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	var versionID string
+	var enabled bool
+	err := database.DB.QueryRow(`
+		SELECT id, COALESCE(enabled, TRUE) FROM provider_versions WHERE provider_id = $1 AND version = $2
+	`, providerID, input.Version).Scan(&versionID, &enabled)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return
+	}
+	if !enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Version is disabled; enable it before assigning a channel"})
+		return
+	}
+
+	now := time.Now()
+	_, err = database.DB.Exec(`
+		INSERT INTO provider_channels (id, provider_id, name, version_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		ON CONFLICT (provider_id, name) DO UPDATE SET version_id = EXCLUDED.version_id, updated_at = EXCLUDED.updated_at
+	`, generateID(), providerID, name, versionID, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	database.DB.Exec("UPDATE providers SET updated_at = $1 WHERE id = $2", now, providerID)
+	registryChanged(providerID)
+
+	c.JSON(http.StatusOK, models.ProviderChannel{
+		Name:      name,
+		VersionID: versionID,
+		Version:   input.Version,
+		UpdatedAt: &now,
+	})
+}
+
+// DeleteProviderChannel removes a channel. Deleting "latest" makes it follow
+// the newest enabled version again.
+// DELETE /api/providers/:id/channels/:channel
+func DeleteProviderChannel(c *gin.Context) {
+	providerID := c.Param("id")
+	name := c.Param("channel")
+
+	result, err := database.DB.Exec("DELETE FROM provider_channels WHERE provider_id = $1 AND name = $2", providerID, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+
+	database.DB.Exec("UPDATE providers SET updated_at = $1 WHERE id = $2", time.Now(), providerID)
+	registryChanged(providerID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Channel deleted"})
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"iac-tool/internal/build"
+	"iac-tool/internal/database"
+	"iac-tool/internal/features"
+	"iac-tool/internal/models"
+	"iac-tool/internal/sourcehosts"
+	"iac-tool/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+const providerMirrorSelect = `
+	SELECT m.id, m.provider_id, n.name, p.name, m.upstream_source, m.version_constraint,
+		(SELECT COUNT(*) FROM provider_versions v WHERE v.provider_id = p.id),
+		m.last_synced_at, m.last_error, m.created_at
+	FROM provider_mirrors m
+	JOIN providers p ON m.provider_id = p.id
+	JOIN namespaces n ON p.namespace_id = n.id`
+
+func scanProviderMirror(row rowScanner) (*models.ProviderMirror, error) {
+	var m models.ProviderMirror
+	var lastSyncedAt sql.NullTime
+	var lastError sql.NullString
+	err := row.Scan(&m.ID, &m.ProviderID, &m.Namespace, &m.Name, &m.UpstreamSource, &m.VersionConstraint,
+		&m.VersionCount, &lastSyncedAt, &lastError, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastSyncedAt.Valid {
+		m.LastSyncedAt = &lastSyncedAt.Time
+	}
+	if lastError.Valid {
+		m.LastError = &lastError.String
+	}
+	return &m, nil
+}
+
+// ProviderMirrorNamespace returns the namespace of the mirror in :id, for
+// RequireFeatureFor; "" when there is no such mirror
+func ProviderMirrorNamespace(c *gin.Context) string {
+	var namespace string
+	database.DB.QueryRow(`
+		SELECT n.name FROM provider_mirrors m
+		JOIN providers p ON m.provider_id = p.id
+		JOIN namespaces n ON p.namespace_id = n.id
+		WHERE m.id = $1
+	`, c.Param("id")).Scan(&namespace)
+	return namespace
+}
+
+// GetProviderMirrors lists mirrored providers of the namespaces the network_mirror
+// feature is enabled for
+// GET /api/provider-mirrors
+func GetProviderMirrors(c *gin.Context) {
+	rows, err := database.DB.Query(providerMirrorSelect + " ORDER BY n.name, p.name")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	mirrors := []models.ProviderMirror{}
+	for rows.Next() {
+		m, err := scanProviderMirror(rows)
+		if err != nil || !features.Enabled(features.NetworkMirror, m.Namespace) {
+			continue
+		}
+		mirrors = append(mirrors, *m)
+	}
+	c.JSON(http.StatusOK, mirrors)
+}
+
+// GetProviderMirror returns a mirrored provider
+// GET /api/provider-mirrors/:id
+func GetProviderMirror(c *gin.Context) {
+	m, err := scanProviderMirror(database.DB.QueryRow(providerMirrorSelect+" WHERE m.id = $1", c.Param("id")))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mirror not found"})
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// CreateProviderMirror creates a local provider that mirrors an upstream one and starts
+// the first sync
+// POST /api/provider-mirrors
+func CreateProviderMirror(c *gin.Context) {
+	var input models.ProviderMirrorCreate
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	upstream, err := build.ParseUpstreamSource(input.UpstreamSource)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkSourceHost(c, sourcehosts.KindArtifact, "https://"+upstream.Host) {
+		return
+	}
+	if _, err := build.ParseVersionConstraint(input.VersionConstraint); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := input.Name
+	if name == "" {
+		name = upstream.Name
+	}
+	if !validation.ValidProviderName(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name: " + validation.Message("tf_provider_name")})
+		return
+	}
+
+	var namespaceName string
+	if err := database.DB.QueryRow("SELECT name FROM namespaces WHERE id = $1", input.NamespaceID).Scan(&namespaceName); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Namespace not found"})
+		return
+	}
+	if !featureAllows(c, features.NetworkMirror, namespaceName) {
+		return
+	}
+	var existingID string
+	if database.DB.QueryRow(`SELECT id FROM providers WHERE namespace_id = $1 AND name = $2`, input.NamespaceID, name).Scan(&existingID) == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Provider already exists"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	providerID := generateID()
+	mirrorID := generateID()
+	if _, err := tx.Exec(`
+		INSERT INTO providers (id, namespace_id, name, description, synced, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, FALSE, $5, $5)
+	`, providerID, input.NamespaceID, name, input.Description, now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO provider_mirrors (id, provider_id, upstream_source, version_constraint, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, mirrorID, providerID, upstream.String(), input.VersionConstraint, now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	registryChanged(providerID)
+
+	go syncProviderMirrorBackground(mirrorID, requestBaseURL(c))
+
+	m, err := scanProviderMirror(database.DB.QueryRow(providerMirrorSelect+" WHERE m.id = $1", mirrorID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, m)
+}
+
+// UpdateProviderMirror changes the version constraint of a mirror. Versions mirrored
+// before stay published.
+// PATCH /api/provider-mirrors/:id
+func UpdateProviderMirror(c *gin.Context) {
+	var input models.ProviderMirrorUpdate
+	if !bindJSON(c, &input) {
+		return
+	}
+	if _, err := build.ParseVersionConstraint(input.VersionConstraint); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := database.DB.Exec(`UPDATE provider_mirrors SET version_constraint = $1 WHERE id = $2`, input.VersionConstraint, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mirror not found"})
+		return
+	}
+
+	m, err := scanProviderMirror(database.DB.QueryRow(providerMirrorSelect+" WHERE m.id = $1", c.Param("id")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// DeleteProviderMirror stops mirroring; the local provider and its versions are kept
+// (delete the provider to remove them too)
+// DELETE /api/provider-mirrors/:id
+func DeleteProviderMirror(c *gin.Context) {
+	result, err := database.DB.Exec(`DELETE FROM provider_mirrors WHERE id = $1`, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mirror not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Mirror deleted"})
+}
+
+// SyncProviderMirror fetches new matching upstream versions now instead of waiting for
+// the scheduler
+// POST /api/provider-mirrors/:id/sync
+func SyncProviderMirror(c *gin.Context) {
+	mirrorID := c.Param("id")
+	var exists bool
+	database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM provider_mirrors WHERE id = $1)`, mirrorID).Scan(&exists)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mirror not found"})
+		return
+	}
+
+	go syncProviderMirrorBackground(mirrorID, requestBaseURL(c))
+	c.JSON(http.StatusAccepted, gin.H{"message": "Mirror sync started"})
+}
+
+func syncProviderMirrorBackground(mirrorID, baseURL string) {
+	result, err := build.SyncProviderMirror(mirrorID, baseURL, build.ArtifactDir())
+	if err != nil {
+		log.Printf("Provider mirror %s: sync failed: %v", mirrorID, err)
+		return
+	}
+	for _, v := range result.Versions {
+		log.Printf("Provider mirror %s: %s %s: %d platforms mirrored, %d errors", mirrorID, result.Source, v.Version, len(v.Platforms), len(v.Errors))
+	}
+}
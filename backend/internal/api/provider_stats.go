@@ -0,0 +1,153 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultActiveDays is how recently a consumer must have downloaded a version to count
+// as active, unless ?active_days= says otherwise
+const defaultActiveDays = 30
+
+// registryConsumer identifies who fetched a registry document: the API key, run token or
+// global token set by TerraformAuthMiddleware, or the client IP for public namespaces
+func registryConsumer(c *gin.Context) string {
+	if consumer := c.GetString("registry_consumer"); consumer != "" {
+		return consumer
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// countedConsumer is the consumer a download is counted for. Runs get a new token each
+// time, so the deployment they belong to is counted instead.
+func countedConsumer(consumer string) string {
+	if runID, ok := strings.CutPrefix(consumer, "run:"); ok {
+		var deploymentID string
+		if database.DB.QueryRow(`SELECT deployment_id FROM deployment_runs WHERE id = $1`, runID).Scan(&deploymentID) == nil {
+			return "deployment:" + deploymentID
+		}
+	}
+	return consumer
+}
+
+// recordProviderDownload counts a download document served for a provider version.
+// It runs in the background so the protocol response is not held up by the write.
+func recordProviderDownload(providerID, version, consumer string) {
+	go func() {
+		consumer := countedConsumer(consumer)
+		_, err := database.DB.Exec(`
+			INSERT INTO provider_version_downloads (version_id, consumer, download_count, first_downloaded_at, last_downloaded_at)
+			SELECT id, $3, 1, $4, $4 FROM provider_versions WHERE provider_id = $1 AND version = $2
+			ON CONFLICT (version_id, consumer) DO UPDATE
+			SET download_count = provider_version_downloads.download_count + 1, last_downloaded_at = EXCLUDED.last_downloaded_at
+		`, providerID, version, consumer, time.Now())
+		if err != nil {
+			log.Printf("Failed to record download of provider %s %s: %v", providerID, version, err)
+		}
+	}()
+}
+
+// activeDays reads ?active_days= (1-365)
+func activeDays(c *gin.Context) (int, bool) {
+	v := c.Query("active_days")
+	if v == "" {
+		return defaultActiveDays, true
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days < 1 || days > 365 {
+		return 0, false
+	}
+	return days, true
+}
+
+// loadProviderVersionStats returns the download statistics of every downloaded version
+// of a provider, by version ID
+func loadProviderVersionStats(db *sql.DB, providerID string, activeDays int) (map[string]*models.ProviderVersionStats, error) {
+	rows, err := db.Query(`
+		SELECT d.version_id, SUM(d.download_count), COUNT(*),
+			COUNT(*) FILTER (WHERE d.last_downloaded_at > NOW() - $2 * INTERVAL '1 day'),
+			MAX(d.last_downloaded_at)
+		FROM provider_version_downloads d
+		JOIN provider_versions v ON d.version_id = v.id
+		WHERE v.provider_id = $1
+		GROUP BY d.version_id
+	`, providerID, activeDays)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make(map[string]*models.ProviderVersionStats)
+	for rows.Next() {
+		var versionID string
+		var s models.ProviderVersionStats
+		var last sql.NullTime
+		if err := rows.Scan(&versionID, &s.Downloads, &s.Consumers, &s.ActiveConsumers, &last); err != nil {
+			continue
+		}
+		if last.Valid {
+			s.LastDownloadedAt = &last.Time
+		}
+		stats[versionID] = &s
+	}
+	return stats, nil
+}
+
+// GetProviderInstallStats returns per-version download statistics, newest version
+// first, so owners can tell which versions are safe to retire
+// GET /api/providers/:id/stats
+func GetProviderInstallStats(c *gin.Context) {
+	providerID := c.Param("id")
+	days, ok := activeDays(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "active_days must be between 1 and 365"})
+		return
+	}
+
+	db := database.Reader()
+	rows, err := db.Query(`
+		SELECT id, version, COALESCE(enabled, TRUE)
+		FROM provider_versions
+		WHERE provider_id = $1
+		ORDER BY COALESCE(tag_date, created_at) DESC
+	`, providerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	type versionStats struct {
+		VersionID string `json:"version_id"`
+		Version   string `json:"version"`
+		Enabled   bool   `json:"enabled"`
+		models.ProviderVersionStats
+	}
+	versions := []versionStats{}
+	for rows.Next() {
+		var v versionStats
+		if rows.Scan(&v.VersionID, &v.Version, &v.Enabled) == nil {
+			versions = append(versions, v)
+		}
+	}
+	rows.Close()
+
+	stats, err := loadProviderVersionStats(db, providerID, days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range versions {
+		if s := stats[versions[i].VersionID]; s != nil {
+			versions[i].ProviderVersionStats = *s
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"active_days": days, "versions": versions})
+}
@@ -1,12 +1,9 @@
 package api
 
 import (
-	"crypto/sha256"
 	"database/sql"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
@@ -14,11 +11,15 @@ import (
 	"strings"
 	"time"
 
+	"iac-tool/internal/build"
+	"iac-tool/internal/cache"
 	"iac-tool/internal/crypto"
 	"iac-tool/internal/database"
 	"iac-tool/internal/git"
 	"iac-tool/internal/gpg"
 	"iac-tool/internal/models"
+	"iac-tool/internal/sourcehosts"
+	"iac-tool/internal/validation"
 
 	"github.com/gin-gonic/gin"
 )
@@ -28,74 +29,112 @@ import (
 // Docs: https://www.terraform.io/internals/provider-registry-protocol
 // ============================================================================
 
+// providerVersionsLookup is the cached result of TFListProviderVersions
+type providerVersionsLookup struct {
+	UpdatedAt time.Time
+	Versions  []models.ProviderVersionDTO
+	Warnings  []string
+}
+
+// providerDownloadLookup is the cached platform row behind TFDownloadProvider; the
+// response itself depends on the request's host
+type providerDownloadLookup struct {
+	ProviderID    string
+	Platform      models.ProviderPlatform
+	ProtocolsJSON string
+	UpdatedAt     time.Time
+}
+
+// providerCacheGroup is the registry cache group of a provider (see cache.Registry)
+func providerCacheGroup(namespace, name string) string {
+	return "providers/" + namespace + "/" + name
+}
+
 // TFListProviderVersions lists available versions for a specific provider
 // GET /v1/providers/:namespace/:name/versions
 func TFListProviderVersions(c *gin.Context) {
 	namespace := c.Param("namespace")
 	name := c.Param("name")
 
-	// Get provider
-	var providerID string
-	err := database.DB.QueryRow(`
-		SELECT p.id FROM providers p
-		JOIN namespaces n ON p.namespace_id = n.id
-		WHERE n.name = $1 AND p.name = $2
-	`, namespace, name).Scan(&providerID)
-
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"errors": []string{"Provider not found"},
-		})
-		return
-	}
-
-	// Get versions with platforms
-	rows, err := database.DB.Query(`
-		SELECT pv.id, pv.version, pv.protocols
-		FROM provider_versions pv
-		WHERE pv.provider_id = $1
-		ORDER BY COALESCE(pv.tag_date, pv.created_at) DESC
-	`, providerID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"errors": []string{err.Error()}})
-		return
-	}
-	defer rows.Close()
-
-	versions := make([]models.ProviderVersionDTO, 0)
-	for rows.Next() {
-		var v models.ProviderVersionDTO
-		var versionID string
-		var protocolsJSON string
-		if err := rows.Scan(&versionID, &v.Version, &protocolsJSON); err != nil {
-			continue
+	value, err := cache.Registry.Load(providerCacheGroup(namespace, name), "versions", readRegistry(func(db *sql.DB) (interface{}, string, error) {
+		// Get provider
+		var providerID string
+		var updatedAt time.Time
+		err := db.QueryRow(`
+			SELECT p.id, COALESCE(p.updated_at, p.created_at) FROM providers p
+			JOIN namespaces n ON p.namespace_id = n.id
+			WHERE n.name = $1 AND p.name = $2
+		`, namespace, name).Scan(&providerID, &updatedAt)
+		if err != nil {
+			return nil, "", err
 		}
 
-		// Parse protocols
-		if protocolsJSON != "" {
-			json.Unmarshal([]byte(protocolsJSON), &v.Protocols)
-		}
-		if v.Protocols == nil {
-			v.Protocols = []string{"5.0"}
+		// Get versions with platforms
+		rows, err := db.Query(`
+			SELECT pv.id, pv.version, pv.protocols, pv.deprecation
+			FROM provider_versions pv
+			WHERE pv.provider_id = $1
+			ORDER BY COALESCE(pv.tag_date, pv.created_at) DESC
+		`, providerID)
+		if err != nil {
+			return nil, "", err
 		}
+		defer rows.Close()
+
+		versions := make([]models.ProviderVersionDTO, 0)
+		var warnings []string
+		for rows.Next() {
+			var v models.ProviderVersionDTO
+			var versionID string
+			var protocolsJSON string
+			var deprecationJSON sql.NullString
+			if err := rows.Scan(&versionID, &v.Version, &protocolsJSON, &deprecationJSON); err != nil {
+				continue
+			}
+			if deprecation := parseDeprecation(deprecationJSON); deprecation != nil {
+				warnings = append(warnings, deprecationWarning(namespace, name, v.Version, deprecation))
+				if extendedVersions() {
+					v.Deprecation = deprecation
+				}
+			}
 
-		// Get platforms
-		platformRows, _ := database.DB.Query(`
-			SELECT os, arch FROM provider_platforms WHERE version_id = $1
-		`, versionID)
-		v.Platforms = make([]models.ProviderPlatformDTO, 0)
-		for platformRows.Next() {
-			var p models.ProviderPlatformDTO
-			if err := platformRows.Scan(&p.OS, &p.Arch); err == nil {
-				v.Platforms = append(v.Platforms, p)
+			// Parse protocols
+			if protocolsJSON != "" {
+				json.Unmarshal([]byte(protocolsJSON), &v.Protocols)
+			}
+			if v.Protocols == nil {
+				v.Protocols = []string{"5.0"}
 			}
-		}
-		platformRows.Close()
 
-		versions = append(versions, v)
+			// Get platforms
+			platformRows, _ := db.Query(`
+				SELECT os, arch FROM provider_platforms WHERE version_id = $1
+			`, versionID)
+			v.Platforms = make([]models.ProviderPlatformDTO, 0)
+			for platformRows.Next() {
+				var p models.ProviderPlatformDTO
+				if err := platformRows.Scan(&p.OS, &p.Arch); err == nil {
+					v.Platforms = append(v.Platforms, p)
+				}
+			}
+			platformRows.Close()
+
+			versions = append(versions, v)
+		}
+		return &providerVersionsLookup{UpdatedAt: updatedAt, Versions: versions, Warnings: warnings}, providerID, nil
+	}))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"errors": []string{movedProviderError(namespace, name, "Provider not found")},
+		})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"errors": []string{err.Error()}})
+		return
 	}
 
-	c.JSON(http.StatusOK, models.ProviderVersionsResponse{Versions: versions})
+	lookup := value.(*providerVersionsLookup)
+	cachedJSON(c, lookup.UpdatedAt, models.ProviderVersionsResponse{Versions: lookup.Versions, Warnings: lookup.Warnings})
 }
 
 // TFDownloadProvider returns download info for a specific provider version and platform
@@ -107,40 +146,56 @@ func TFDownloadProvider(c *gin.Context) {
 	osParam := c.Param("os")
 	arch := c.Param("arch")
 
-	var pp models.ProviderPlatform
-	var protocolsJSON string
-	var shasumURL, shasumSigURL, dbSigningKeys sql.NullString
-	err := database.DB.QueryRow(`
-		SELECT pp.filename, pp.download_url, pp.shasums_url, pp.shasums_signature_url, 
-			   pp.shasum, pp.signing_keys, pv.protocols
-		FROM provider_platforms pp
-		JOIN provider_versions pv ON pp.version_id = pv.id
-		JOIN providers p ON pv.provider_id = p.id
-		JOIN namespaces n ON p.namespace_id = n.id
-		WHERE n.name = $1 AND p.name = $2 AND pv.version = $3 AND pp.os = $4 AND pp.arch = $5
-		  AND pv.enabled = true
-	`, namespace, name, version, osParam, arch).Scan(
-		&pp.Filename, &pp.DownloadURL, &shasumURL, &shasumSigURL,
-		&pp.SHASum, &dbSigningKeys, &protocolsJSON)
+	// Unknown platforms never have a binary; reject them before they reach the cache key
+	if !validation.ValidPlatform(osParam, arch) {
+		c.JSON(http.StatusNotFound, gin.H{"errors": []string{validation.PlatformMessage(osParam, arch)}})
+		return
+	}
+
+	value, err := cache.Registry.Load(providerCacheGroup(namespace, name), "download/"+version+"/"+osParam+"/"+arch, readRegistry(func(db *sql.DB) (interface{}, string, error) {
+		var lookup providerDownloadLookup
+		var shasumURL, shasumSigURL, dbSigningKeys sql.NullString
+		pp := &lookup.Platform
+		err := db.QueryRow(`
+			SELECT p.id, pp.filename, pp.download_url, pp.shasums_url, pp.shasums_signature_url, 
+				   pp.shasum, pp.signing_keys, pv.protocols, COALESCE(p.updated_at, p.created_at)
+			FROM provider_platforms pp
+			JOIN provider_versions pv ON pp.version_id = pv.id
+			JOIN providers p ON pv.provider_id = p.id
+			JOIN namespaces n ON p.namespace_id = n.id
+			WHERE n.name = $1 AND p.name = $2 AND pv.version = $3 AND pp.os = $4 AND pp.arch = $5
+			  AND pv.enabled = true
+		`, namespace, name, version, osParam, arch).Scan(
+			&lookup.ProviderID, &pp.Filename, &pp.DownloadURL, &shasumURL, &shasumSigURL,
+			&pp.SHASum, &dbSigningKeys, &lookup.ProtocolsJSON, &lookup.UpdatedAt)
+		if err != nil {
+			return nil, "", err
+		}
 
+		if shasumURL.Valid {
+			pp.SHASumsURL = shasumURL.String
+		}
+		if shasumSigURL.Valid {
+			pp.SHASumsSignature = shasumSigURL.String
+		}
+		if dbSigningKeys.Valid {
+			pp.SigningKeys = dbSigningKeys.String
+		}
+		return &lookup, lookup.ProviderID, nil
+	}))
 	if err != nil {
 		log.Printf("TFDownloadProvider error: namespace=%s name=%s version=%s os=%s arch=%s err=%v",
 			namespace, name, version, osParam, arch, err)
 		c.JSON(http.StatusNotFound, gin.H{
-			"errors": []string{"Provider version not found for this platform"},
+			"errors": []string{movedProviderError(namespace, name, "Provider version not found for this platform")},
 		})
 		return
 	}
 
-	if shasumURL.Valid {
-		pp.SHASumsURL = shasumURL.String
-	}
-	if shasumSigURL.Valid {
-		pp.SHASumsSignature = shasumSigURL.String
-	}
-	if dbSigningKeys.Valid {
-		pp.SigningKeys = dbSigningKeys.String
-	}
+	lookup := value.(*providerDownloadLookup)
+	pp := lookup.Platform
+	protocolsJSON := lookup.ProtocolsJSON
+	updatedAt := lookup.UpdatedAt
 
 	var protocols []string
 	if protocolsJSON != "" {
@@ -203,7 +258,8 @@ func TFDownloadProvider(c *gin.Context) {
 		SigningKeys:         signingKeys,
 	}
 
-	c.JSON(http.StatusOK, response)
+	recordProviderDownload(lookup.ProviderID, version, registryConsumer(c))
+	cachedJSON(c, updatedAt, response)
 }
 
 // GetProviderSHASums returns SHA256SUMS file for a provider version
@@ -300,8 +356,8 @@ func GetProviders(c *gin.Context) {
 	namespaceFilter := c.Query("namespace")
 
 	query := `
-		SELECT p.id, p.namespace_id, p.name, p.description, p.synced, p.created_at, p.updated_at, 
-			   n.name as namespace
+		SELECT p.id, p.namespace_id, p.name, p.description, p.synced, p.credential_status, p.created_at, p.updated_at,
+			   n.name as namespace, ` + namespaceContactColumns + `, ` + providerCatalogColumns + `
 		FROM providers p
 		JOIN namespaces n ON p.namespace_id = n.id
 	`
@@ -314,7 +370,7 @@ func GetProviders(c *gin.Context) {
 
 	query += " ORDER BY n.name, p.name"
 
-	rows, err := database.DB.Query(query, args...)
+	rows, err := database.Reader().Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"errors": []string{err.Error()}})
 		return
@@ -324,11 +380,16 @@ func GetProviders(c *gin.Context) {
 	providers := make([]models.ProviderWithNamespace, 0)
 	for rows.Next() {
 		var p models.ProviderWithNamespace
-		if err := rows.Scan(&p.ID, &p.NamespaceID, &p.Name, &p.Description, &p.Synced,
-			&p.CreatedAt, &p.UpdatedAt, &p.Namespace); err != nil {
+		var contacts namespaceContactsRow
+		var catalog providerCatalogRow
+		if err := rows.Scan(append(append([]interface{}{&p.ID, &p.NamespaceID, &p.Name, &p.Description, &p.Synced,
+			&p.CredentialStatus, &p.CreatedAt, &p.UpdatedAt, &p.Namespace}, contacts.dest()...), catalog.dest()...)...); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"errors": []string{err.Error()}})
 			return
 		}
+		maintainers := contacts.contacts()
+		p.Maintainers = &maintainers
+		p.ProviderCatalog = catalog.catalog()
 		providers = append(providers, p)
 	}
 
@@ -340,19 +401,31 @@ func GetProvider(c *gin.Context) {
 	id := c.Param("id")
 
 	var p models.ProviderWithNamespace
+	var contacts namespaceContactsRow
+	var catalog providerCatalogRow
 	err := database.DB.QueryRow(`
-		SELECT p.id, p.namespace_id, p.name, p.description, p.synced, p.created_at, p.updated_at,
-			   n.name as namespace
+		SELECT p.id, p.namespace_id, p.name, p.description, p.synced, p.credential_status, p.created_at, p.updated_at,
+			   n.name as namespace, `+namespaceContactColumns+`, `+providerCatalogColumns+`
 		FROM providers p
 		JOIN namespaces n ON p.namespace_id = n.id
 		WHERE p.id = $1
-	`, id).Scan(&p.ID, &p.NamespaceID, &p.Name, &p.Description, &p.Synced,
-		&p.CreatedAt, &p.UpdatedAt, &p.Namespace)
+	`, id).Scan(append(append([]interface{}{&p.ID, &p.NamespaceID, &p.Name, &p.Description, &p.Synced,
+		&p.CredentialStatus, &p.CreatedAt, &p.UpdatedAt, &p.Namespace}, contacts.dest()...), catalog.dest()...)...)
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"errors": []string{"Provider not found"}})
 		return
 	}
+	maintainers := contacts.contacts()
+	p.Maintainers = &maintainers
+	p.ProviderCatalog = catalog.catalog()
+
+	if channels, err := loadProviderChannels(id); err == nil && len(channels) > 0 {
+		p.Channels = make(map[string]string, len(channels))
+		for _, ch := range channels {
+			p.Channels[ch.Name] = ch.Version
+		}
+	}
 
 	c.JSON(http.StatusOK, p)
 }
@@ -374,14 +447,19 @@ func UploadProviderVersion(c *gin.Context) {
 		Protocols []string                        `json:"protocols"`
 		Platforms []models.ProviderPlatformCreate `json:"platforms" binding:"required"`
 	}
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"errors": []string{err.Error()}})
+	if !bindRegistryJSON(c, &input) {
 		return
 	}
 
 	if input.Protocols == nil {
 		input.Protocols = []string{"5.0"}
 	}
+	for _, platform := range input.Platforms {
+		if !validation.ValidPlatform(platform.OS, platform.Arch) {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": []string{validation.PlatformMessage(platform.OS, platform.Arch)}})
+			return
+		}
+	}
 
 	// Get or create provider
 	var providerID string
@@ -393,6 +471,10 @@ func UploadProviderVersion(c *gin.Context) {
 
 	if err != nil {
 		// Create provider first
+		if !validation.ValidProviderName(name) {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": []string{"name: " + validation.Message("tf_provider_name")}})
+			return
+		}
 		var namespaceID string
 		err := database.DB.QueryRow("SELECT id FROM namespaces WHERE name = $1", namespace).Scan(&namespaceID)
 		if err != nil {
@@ -453,15 +535,34 @@ func UploadProviderVersion(c *gin.Context) {
 		}
 	}
 
+	// Update provider updated_at
+	database.DB.Exec("UPDATE providers SET updated_at = $1 WHERE id = $2", now, providerID)
+	registryChanged(providerID)
+
 	c.JSON(http.StatusOK, gin.H{"errors": []string{}})
 }
 
-// GetProviderVersions returns all versions of a provider with their platforms
+// GetProviderVersions returns all versions of a provider with their platforms, and their
+// download statistics with ?include=stats (see GetProviderInstallStats)
 func GetProviderVersions(c *gin.Context) {
 	id := c.Param("id")
 
-	rows, err := database.DB.Query(`
-		SELECT id, version, protocols, COALESCE(enabled, TRUE) as enabled, tag_date, created_at
+	db := database.Reader()
+	var stats map[string]*models.ProviderVersionStats
+	if c.Query("include") == "stats" {
+		days, ok := activeDays(c)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": []string{"active_days must be between 1 and 365"}})
+			return
+		}
+		var err error
+		if stats, err = loadProviderVersionStats(db, id, days); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"errors": []string{err.Error()}})
+			return
+		}
+	}
+	rows, err := db.Query(`
+		SELECT id, version, protocols, COALESCE(enabled, TRUE) as enabled, tag_date, tag_message, changelog, deprecation, created_at
 		FROM provider_versions
 		WHERE provider_id = $1
 		ORDER BY COALESCE(tag_date, created_at) DESC
@@ -472,15 +573,24 @@ func GetProviderVersions(c *gin.Context) {
 	}
 	defer rows.Close()
 
+	// Channel names per version ID, so aliases show up next to the versions they point at
+	versionChannels := make(map[string][]string)
+	if channels, err := loadProviderChannels(id); err == nil {
+		for _, ch := range channels {
+			versionChannels[ch.VersionID] = append(versionChannels[ch.VersionID], ch.Name)
+		}
+	}
+
 	versions := make([]models.ProviderVersion, 0)
 	for rows.Next() {
 		var v models.ProviderVersion
 		var protocolsJSON string
-		var tagDateStr sql.NullString
-		if err := rows.Scan(&v.ID, &v.Version, &protocolsJSON, &v.Enabled, &tagDateStr, &v.CreatedAt); err != nil {
+		var tagDateStr, deprecationJSON sql.NullString
+		if err := rows.Scan(&v.ID, &v.Version, &protocolsJSON, &v.Enabled, &tagDateStr, &v.TagMessage, &v.Changelog, &deprecationJSON, &v.CreatedAt); err != nil {
 			log.Printf("Error scanning provider version: %v", err)
 			continue
 		}
+		v.Deprecation = parseDeprecation(deprecationJSON)
 		if tagDateStr.Valid && tagDateStr.String != "" {
 			if t, err := time.Parse(time.RFC3339, tagDateStr.String); err == nil {
 				v.TagDate = &t
@@ -490,9 +600,16 @@ func GetProviderVersions(c *gin.Context) {
 			json.Unmarshal([]byte(protocolsJSON), &v.Protocols)
 		}
 		v.ProviderID = id
+		v.Channels = versionChannels[v.ID]
+		if stats != nil {
+			v.Stats = stats[v.ID]
+			if v.Stats == nil {
+				v.Stats = &models.ProviderVersionStats{}
+			}
+		}
 
 		// Get platforms for this version
-		platformRows, err := database.DB.Query(`
+		platformRows, err := db.Query(`
 			SELECT id, os, arch, filename, shasum, download_url
 			FROM provider_platforms
 			WHERE version_id = $1
@@ -544,6 +661,7 @@ func DeleteProvider(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"errors": []string{"Provider not found"}})
 		return
 	}
+	cache.Registry.InvalidateGroup(providerCacheGroup(fmt.Sprint(namespace), name))
 
 	c.JSON(http.StatusOK, gin.H{"errors": []string{}})
 }
@@ -598,7 +716,17 @@ func DeleteProviderVersion(c *gin.Context) {
 				WHERE n.name = $1 AND p.name = $2
 			)
 		`, namespace, name)
+	} else {
+		database.DB.Exec(`
+			UPDATE providers SET updated_at = $3
+			WHERE id IN (
+				SELECT p.id FROM providers p
+				JOIN namespaces n ON p.namespace_id = n.id
+				WHERE n.name = $1 AND p.name = $2
+			)
+		`, namespace, name, time.Now())
 	}
+	cache.Registry.InvalidateGroup(providerCacheGroup(fmt.Sprint(namespace), name))
 
 	c.JSON(http.StatusOK, gin.H{"errors": []string{}})
 }
@@ -612,7 +740,7 @@ func DeleteProviderVersion(c *gin.Context) {
 func CreateProviderFromGit(c *gin.Context) {
 	var input struct {
 		NamespaceID string  `json:"namespace_id" binding:"required"`
-		Name        string  `json:"name" binding:"required"`
+		Name        string  `json:"name" binding:"required,tf_provider_name"`
 		GitURL      string  `json:"git_url" binding:"required"`
 		Description *string `json:"description,omitempty"`
 		IsPrivate   bool    `json:"is_private,omitempty"`
@@ -620,8 +748,7 @@ func CreateProviderFromGit(c *gin.Context) {
 		GitPassword string  `json:"git_password,omitempty"` // Personal Access Token
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
 		return
 	}
 
@@ -630,6 +757,9 @@ func CreateProviderFromGit(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Git URL. Must be a valid HTTPS git repository URL (e.g., https://github.com/org/repo.git)"})
 		return
 	}
+	if !checkSourceHost(c, sourcehosts.KindGit, input.GitURL) {
+		return
+	}
 
 	// Prepare auth config if repository is private (HTTPS only)
 	var authConfig *git.AuthConfig
@@ -696,6 +826,7 @@ func CreateProviderFromGit(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	registryChanged(providerID)
 
 	// Automatically sync tags and generate documentation
 	go func() {
@@ -750,6 +881,7 @@ func DeleteProviderByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Provider not found"})
 		return
 	}
+	registryChanged(providerID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Provider deleted"})
 }
@@ -764,8 +896,7 @@ func AddProviderVersion(c *gin.Context) {
 		Protocols []string `json:"protocols,omitempty"`
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
 		return
 	}
 
@@ -815,6 +946,7 @@ func AddProviderVersion(c *gin.Context) {
 
 	// Update provider updated_at
 	database.DB.Exec("UPDATE providers SET updated_at = $1 WHERE id = $2", now, providerID)
+	registryChanged(providerID)
 
 	version := models.ProviderVersion{
 		ID:         versionID,
@@ -855,6 +987,10 @@ func DeleteProviderVersionByID(c *gin.Context) {
 		return
 	}
 
+	// Update provider updated_at
+	database.DB.Exec("UPDATE providers SET updated_at = $1 WHERE id = $2", time.Now(), providerID)
+	registryChanged(providerID)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Version deleted"})
 }
 
@@ -929,7 +1065,9 @@ func syncProviderTagsBackgroundWithAuth(providerID string, sourceURL string, aut
 	}
 
 	now := time.Now()
-	addedCount := 0
+	addedCount, enabledCount := 0, 0
+	var addedTags []git.Tag
+	rule := loadAutoEnableRule("providers", providerID)
 
 	// Add each tag as a version (if not exists)
 	for _, tag := range tags {
@@ -947,21 +1085,32 @@ func syncProviderTagsBackgroundWithAuth(providerID string, sourceURL string, aut
 				tagDate = tag.TagDate
 			}
 
+			enabled := rule.enables(tag.Version)
 			_, err = database.DB.Exec(`
 				INSERT INTO provider_versions (id, provider_id, version, protocols, enabled, tag_date, created_at)
-				VALUES ($1, $2, $3, $4, FALSE, $5, $6)
-			`, versionID, providerID, tag.Version, string(protocolsJSON), tagDate, now)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+			`, versionID, providerID, tag.Version, string(protocolsJSON), enabled, tagDate, now)
 
 			if err == nil {
 				addedCount++
+				addedTags = append(addedTags, tag)
+				if enabled {
+					enabledCount++
+				}
 			}
 		}
 	}
 
+	// Catalog card metadata, so listings need no clone per provider
+	refreshProviderCatalog(providerID, sourceURL, auth)
+
 	// Update provider updated_at, mark as synced and clear errors
 	database.DB.Exec("UPDATE providers SET updated_at = $1, synced = TRUE, sync_error = NULL WHERE id = $2", now, providerID)
+	registryChanged(providerID)
 
-	log.Printf("Background tag sync completed for provider %s: %d tags found, %d added", providerID, len(tags), addedCount)
+	refreshProviderReleaseNotes(providerID, sourceURL, addedTags, auth)
+
+	log.Printf("Background tag sync completed for provider %s: %d tags found, %d added, %d enabled", providerID, len(tags), addedCount, enabledCount)
 }
 
 // SyncProviderTags fetches tags from the Git repository and syncs them with provider versions
@@ -1014,7 +1163,9 @@ func SyncProviderTags(c *gin.Context) {
 	}
 
 	now := time.Now()
-	addedCount := 0
+	addedCount, enabledCount := 0, 0
+	var addedTags []git.Tag
+	rule := loadAutoEnableRule("providers", providerID)
 
 	// Add each tag as a version (if not exists)
 	for _, tag := range tags {
@@ -1032,24 +1183,38 @@ func SyncProviderTags(c *gin.Context) {
 				tagDate = tag.TagDate
 			}
 
+			enabled := rule.enables(tag.Version)
 			_, err = database.DB.Exec(`
 				INSERT INTO provider_versions (id, provider_id, version, protocols, enabled, tag_date, created_at)
-				VALUES ($1, $2, $3, $4, FALSE, $5, $6)
-			`, versionID, providerID, tag.Version, string(protocolsJSON), tagDate, now)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+			`, versionID, providerID, tag.Version, string(protocolsJSON), enabled, tagDate, now)
 
 			if err == nil {
 				addedCount++
+				addedTags = append(addedTags, tag)
+				if enabled {
+					enabledCount++
+				}
 			}
 		}
 	}
 
 	// Update provider updated_at
 	database.DB.Exec("UPDATE providers SET updated_at = $1 WHERE id = $2", now, providerID)
+	registryChanged(providerID)
+
+	// Refresh the catalog card and release notes in the background so the response does
+	// not wait for the clones
+	go func() {
+		refreshProviderCatalog(providerID, *sourceURL, auth)
+		refreshProviderReleaseNotes(providerID, *sourceURL, addedTags, auth)
+	}()
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":    "Tags synced successfully",
-		"tags_found": len(tags),
-		"tags_added": addedCount,
+		"message":      "Tags synced successfully",
+		"tags_found":   len(tags),
+		"tags_added":   addedCount,
+		"tags_enabled": enabledCount,
 	})
 }
 
@@ -1141,8 +1306,7 @@ func ToggleProviderVersion(c *gin.Context) {
 		Enabled bool `json:"enabled"`
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
 		return
 	}
 
@@ -1162,6 +1326,7 @@ func ToggleProviderVersion(c *gin.Context) {
 
 	// Update provider updated_at
 	database.DB.Exec("UPDATE providers SET updated_at = $1 WHERE id = $2", time.Now(), providerID)
+	registryChanged(providerID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Version updated", "enabled": input.Enabled})
 }
@@ -1206,8 +1371,11 @@ func AddProviderPlatform(c *gin.Context) {
 	versionID := c.Param("versionId")
 
 	var input models.ProviderPlatformCreate
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
+		return
+	}
+	if !validation.ValidPlatform(input.OS, input.Arch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.PlatformMessage(input.OS, input.Arch)})
 		return
 	}
 
@@ -1246,6 +1414,7 @@ func AddProviderPlatform(c *gin.Context) {
 
 	// Update provider updated_at
 	database.DB.Exec("UPDATE providers SET updated_at = $1 WHERE id = $2", time.Now(), providerID)
+	registryChanged(providerID)
 
 	platform := models.ProviderPlatform{
 		ID:               platformID,
@@ -1272,14 +1441,15 @@ func DeleteProviderPlatform(c *gin.Context) {
 
 	// Get platform info before deleting (to delete the file)
 	var filename, namespace, providerName, version string
+	var shasum sql.NullString
 	err := database.DB.QueryRow(`
-		SELECT pp.filename, n.name, p.name, pv.version
+		SELECT pp.filename, pp.shasum, n.name, p.name, pv.version
 		FROM provider_platforms pp
 		JOIN provider_versions pv ON pp.version_id = pv.id
 		JOIN providers p ON pv.provider_id = p.id
 		JOIN namespaces n ON p.namespace_id = n.id
 		WHERE pp.id = $1 AND pp.version_id = $2 AND pv.provider_id = $3
-	`, platformID, versionID, providerID).Scan(&filename, &namespace, &providerName, &version)
+	`, platformID, versionID, providerID).Scan(&filename, &shasum, &namespace, &providerName, &version)
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Platform not found"})
@@ -1312,9 +1482,11 @@ func DeleteProviderPlatform(c *gin.Context) {
 	if err := os.Remove(filePath); err != nil {
 		log.Printf("Warning: Could not delete file %s: %v", filePath, err)
 	}
+	build.ReleaseBlob(buildDir, shasum.String)
 
 	// Update provider updated_at
 	database.DB.Exec("UPDATE providers SET updated_at = $1 WHERE id = $2", time.Now(), providerID)
+	registryChanged(providerID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Platform deleted"})
 }
@@ -1325,6 +1497,16 @@ func UploadProviderPlatform(c *gin.Context) {
 	providerID := c.Param("id")
 	versionID := c.Param("versionId")
 
+	// Read the form first, so an upload over MAX_UPLOAD_SIZE is reported as such
+	if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+		if msg := bodyLimitMessage(err); msg != "" {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": msg})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid multipart form: " + err.Error()})
+		return
+	}
+
 	// Get form values
 	osParam := c.PostForm("os")
 	arch := c.PostForm("arch")
@@ -1333,15 +1515,19 @@ func UploadProviderPlatform(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "os and arch are required"})
 		return
 	}
+	if !validation.ValidPlatform(osParam, arch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.PlatformMessage(osParam, arch)})
+		return
+	}
 
 	// Get provider info
-	var providerName, namespace string
+	var providerName, namespace, namespaceID string
 	err := database.DB.QueryRow(`
-		SELECT p.name, n.name
+		SELECT p.name, n.name, n.id
 		FROM providers p
 		JOIN namespaces n ON p.namespace_id = n.id
 		WHERE p.id = $1
-	`, providerID).Scan(&providerName, &namespace)
+	`, providerID).Scan(&providerName, &namespace, &namespaceID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Provider not found"})
 		return
@@ -1386,22 +1572,28 @@ func UploadProviderPlatform(c *gin.Context) {
 	filename := "terraform-provider-" + providerName + "_" + version + "_" + osParam + "_" + arch + ".zip"
 	filePath := filepath.Join(outputDir, filename)
 
-	// Save file
-	out, err := os.Create(filePath)
+	// The upload must fit the namespace's storage quota; a replaced zip no longer counts
+	var replaced int64
+	if info, err := os.Stat(filePath); err == nil {
+		replaced = info.Size()
+	}
+	msg, err := checkStorageQuota(namespaceID, header.Size, replaced)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if msg != "" {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": msg})
 		return
 	}
-	defer out.Close()
 
-	// Calculate SHA256 while copying
-	hash := sha256.New()
-	writer := io.MultiWriter(out, hash)
-	if _, err := io.Copy(writer, file); err != nil {
+	// Save file through the blob store, so identical zips are only stored once
+	shasum, _, err := build.StoreArtifact(buildDir, file, filePath)
+	if err != nil {
+		log.Printf("Failed to store provider upload %s: %v", filePath, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
 		return
 	}
-	shasum := hex.EncodeToString(hash.Sum(nil))
 
 	// Generate download URL - use X-Forwarded-Host/Host header or BASE_URL
 	baseURL := os.Getenv("BASE_URL")
@@ -1459,6 +1651,7 @@ func UploadProviderPlatform(c *gin.Context) {
 
 	// Update provider updated_at
 	database.DB.Exec("UPDATE providers SET updated_at = $1 WHERE id = $2", time.Now(), providerID)
+	registryChanged(providerID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":      "Platform uploaded successfully",
@@ -1470,3 +1663,24 @@ func UploadProviderPlatform(c *gin.Context) {
 		"download_url": downloadURL,
 	})
 }
+
+// DownloadBlob serves a provider artifact by its SHA256 digest. Blobs never change, so
+// the response can be cached forever.
+// GET /blobs/sha256/:digest
+func DownloadBlob(c *gin.Context) {
+	digest := c.Param("digest")
+	if !build.ValidDigest(digest) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid digest"})
+		return
+	}
+	path := build.BlobPath(build.ArtifactDir(), digest)
+	if _, err := os.Stat(path); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Blob not found"})
+		return
+	}
+
+	c.Header("ETag", `"sha256:`+digest+`"`)
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("Content-Type", "application/zip")
+	c.File(path)
+}
@@ -7,10 +7,16 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// GetRegistryToken returns the registry authentication token for internal use (runner)
+// GetRegistryToken returns the all-namespaces registry token for internal use (runner).
+// Runs receive scoped tokens instead, so it is only served with REGISTRY_GLOBAL_TOKEN=true.
 func GetRegistryToken(c *gin.Context) {
-	// This endpoint should only be accessible from the internal network
-	// In production, you might want to add IP whitelist or other security
+	// Only reachable from INTERNAL_ALLOWED_CIDRS; with RUNNER_SHARED_SECRET set the
+	// request must also be signed by the runner (see RequireInternalNetwork and
+	// RequireRunnerSignature)
+	if !registry.GlobalTokenEnabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "The global registry token is disabled; runs receive scoped tokens"})
+		return
+	}
 
 	token := registry.GetToken()
 	c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/git"
+	"iac-tool/internal/markdown"
+	"iac-tool/internal/notify"
+)
+
+// newestTags returns the newest tags added by a sync, at most readmePrefetchLimit
+func newestTags(added []git.Tag) []git.Tag {
+	newest := append([]git.Tag(nil), added...)
+	sort.Slice(newest, func(i, j int) bool { return newest[i].TagDate.After(newest[j].TagDate) })
+	if len(newest) > readmePrefetchLimit {
+		newest = newest[:readmePrefetchLimit]
+	}
+	return newest
+}
+
+// fetchReleaseNotes reads the annotated tag message of a tag and the section of its
+// CHANGELOG.md for the version; what is missing stays NULL
+func fetchReleaseNotes(gitURL, dir string, tag git.Tag, auth *git.AuthConfig) (tagMessage, changelog sql.NullString, err error) {
+	notes, err := git.GetReleaseNotes(gitURL, tag.Name, dir, auth)
+	if err != nil {
+		return tagMessage, changelog, err
+	}
+	if notes.TagMessage != "" {
+		tagMessage = sql.NullString{String: notes.TagMessage, Valid: true}
+	}
+	if section := markdown.ChangelogSection(notes.Changelog, tag.Version); section != "" {
+		changelog = sql.NullString{String: section, Valid: true}
+	}
+	return tagMessage, changelog, nil
+}
+
+// refreshModuleReleaseNotes stores the release notes of the newest versions added by a
+// tag sync and announces each of them with module.version_added
+func refreshModuleReleaseNotes(moduleID, gitURL string, subdir *string, added []git.Tag, auth *git.AuthConfig) {
+	var namespace, name, provider string
+	if err := database.DB.QueryRow(`
+		SELECT n.name, m.name, m.provider FROM modules m JOIN namespaces n ON m.namespace_id = n.id WHERE m.id = $1
+	`, moduleID).Scan(&namespace, &name, &provider); err != nil {
+		return
+	}
+	dir := ""
+	if subdir != nil {
+		dir = *subdir
+	}
+
+	for _, tag := range newestTags(added) {
+		tagMessage, changelog, err := fetchReleaseNotes(gitURL, dir, tag, auth)
+		if err != nil {
+			log.Printf("Module %s: no release notes for %s: %v", moduleID, tag.Name, err)
+		}
+		var versionID string
+		var enabled bool
+		if err := database.DB.QueryRow(`
+			UPDATE module_versions SET tag_message = $1, changelog = $2
+			WHERE module_id = $3 AND version = $4
+			RETURNING id, enabled
+		`, tagMessage, changelog, moduleID, tag.Version).Scan(&versionID, &enabled); err != nil {
+			continue
+		}
+
+		notify.Send("module.version_added",
+			fmt.Sprintf("Module %s/%s/%s %s was added", namespace, name, provider, tag.Version),
+			map[string]interface{}{
+				"module_id":   moduleID,
+				"namespace":   namespace,
+				"name":        name,
+				"provider":    provider,
+				"version_id":  versionID,
+				"version":     tag.Version,
+				"enabled":     enabled,
+				"tag_message": tagMessage.String,
+				"changelog":   changelog.String,
+			})
+	}
+}
+
+// refreshProviderReleaseNotes stores the release notes of the newest versions added by a
+// tag sync and announces each of them with provider.version_added
+func refreshProviderReleaseNotes(providerID, sourceURL string, added []git.Tag, auth *git.AuthConfig) {
+	var namespace, name string
+	if err := database.DB.QueryRow(`
+		SELECT n.name, p.name FROM providers p JOIN namespaces n ON p.namespace_id = n.id WHERE p.id = $1
+	`, providerID).Scan(&namespace, &name); err != nil {
+		return
+	}
+
+	for _, tag := range newestTags(added) {
+		tagMessage, changelog, err := fetchReleaseNotes(sourceURL, "", tag, auth)
+		if err != nil {
+			log.Printf("Provider %s: no release notes for %s: %v", providerID, tag.Name, err)
+		}
+		var versionID string
+		var enabled bool
+		if err := database.DB.QueryRow(`
+			UPDATE provider_versions SET tag_message = $1, changelog = $2
+			WHERE provider_id = $3 AND version = $4
+			RETURNING id, enabled
+		`, tagMessage, changelog, providerID, tag.Version).Scan(&versionID, &enabled); err != nil {
+			continue
+		}
+
+		notify.Send("provider.version_added",
+			fmt.Sprintf("Provider %s/%s %s was added", namespace, name, tag.Version),
+			map[string]interface{}{
+				"provider_id": providerID,
+				"namespace":   namespace,
+				"name":        name,
+				"version_id":  versionID,
+				"version":     tag.Version,
+				"enabled":     enabled,
+				"tag_message": tagMessage.String,
+				"changelog":   changelog.String,
+			})
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"iac-tool/internal/crypto"
+	"iac-tool/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redactedValue replaces env var values in API responses
+const redactedValue = "********"
+
+// redactEnvVars decodes a stored env_vars column and hides its values, keeping the
+// names so users can see what a run was given
+func redactEnvVars(stored string) map[string]string {
+	envVars, err := crypto.DecryptEnvVars(stored)
+	if err != nil {
+		return map[string]string{}
+	}
+	for name := range envVars {
+		envVars[name] = redactedValue
+	}
+	return envVars
+}
+
+// RevealRunEnvVars returns the env vars of a run in clear text. Every call is recorded
+// as a "run.env_vars_revealed" audit event.
+// GET /api/deployments/:id/runs/:runId/env-vars
+func RevealRunEnvVars(c *gin.Context) {
+	runID := c.Param("runId")
+
+	var stored sql.NullString
+	err := database.DB.QueryRow(`SELECT env_vars FROM deployment_runs WHERE id = $1 AND deployment_id = $2`, runID, c.Param("id")).Scan(&stored)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	envVars, err := crypto.DecryptEnvVars(stored.String)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decrypt env vars"})
+		return
+	}
+
+	names := make([]string, 0, len(envVars))
+	for name := range envVars {
+		names = append(names, name)
+	}
+	details := map[string]interface{}{"deployment_id": c.Param("id"), "variables": names}
+	if err := recordAuditEvent("run.env_vars_revealed", c.GetString("api_key_name"), "deployment_run", runID, details); err != nil {
+		// Secrets are only shown when the reveal is on record
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"run_id": runID, "env_vars": envVars})
+}
+
+// EncryptLegacyEnvVars encrypts env vars that runs and stack runs stored in plain JSON
+// before they were encrypted at rest
+func EncryptLegacyEnvVars() error {
+	for _, table := range []string{"deployment_runs", "stack_runs"} {
+		rows, err := database.DB.Query(`SELECT id, env_vars FROM ` + table + ` WHERE env_vars LIKE '{%' OR env_vars = 'null'`)
+		if err != nil {
+			return err
+		}
+		plain := map[string]string{}
+		for rows.Next() {
+			var id, stored string
+			if err := rows.Scan(&id, &stored); err != nil {
+				rows.Close()
+				return err
+			}
+			plain[id] = stored
+		}
+		rows.Close()
+
+		for id, stored := range plain {
+			envVars, err := crypto.DecryptEnvVars(stored)
+			if err != nil {
+				log.Printf("Warning: env vars of %s %s are not valid JSON: %v", table, id, err)
+				continue
+			}
+			encrypted, err := crypto.EncryptEnvVars(envVars)
+			if err != nil {
+				return err
+			}
+			if _, err := database.DB.Exec(`UPDATE `+table+` SET env_vars = $1 WHERE id = $2`, encrypted, id); err != nil {
+				return err
+			}
+		}
+		if len(plain) > 0 {
+			log.Printf("✓ Encrypted env vars of %d %s", len(plain), table)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"iac-tool/internal/build"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImportDeploymentRunResources imports existing infrastructure into the state of a
+// finished run's working directory, followed by a plan preview
+// POST /api/deployments/:id/runs/:runId/import
+func ImportDeploymentRunResources(c *gin.Context) {
+	var input models.ImportRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	if len(input.Imports) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one import is required"})
+		return
+	}
+	for _, imp := range input.Imports {
+		if strings.TrimSpace(imp.Address) == "" || strings.TrimSpace(imp.ID) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Each import needs an address and an id"})
+			return
+		}
+	}
+
+	parent, ok := getOperationParentRun(c)
+	if !ok || !runQuotaAllows(c, parent.DeploymentID) {
+		return
+	}
+
+	run, err := createOperationRun(parent, "import", input)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	go build.ExecuteRunOperation(run.ID, parent.WorkDir, "import", input)
+
+	c.JSON(http.StatusCreated, run)
+}
+
+// MoveDeploymentRunState runs `terraform state mv` in a finished run's working directory.
+// Requires an API key with the approver role; the key name is recorded as the approver.
+// POST /api/deployments/:id/runs/:runId/state/mv
+func MoveDeploymentRunState(c *gin.Context) {
+	var input models.StateMoveRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	if !isValidResourceAddress(input.Source) || !isValidResourceAddress(input.Destination) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid resource address"})
+		return
+	}
+
+	startStateOperation(c, "state_mv", "state/mv", input)
+}
+
+// RemoveDeploymentRunState runs `terraform state rm` in a finished run's working directory.
+// Requires an API key with the approver role; the key name is recorded as the approver.
+// POST /api/deployments/:id/runs/:runId/state/rm
+func RemoveDeploymentRunState(c *gin.Context) {
+	var input models.StateRemoveRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	if len(input.Addresses) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one address is required"})
+		return
+	}
+	for _, address := range input.Addresses {
+		if !isValidResourceAddress(address) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid resource address: " + address})
+			return
+		}
+	}
+
+	startStateOperation(c, "state_rm", "state/rm", input)
+}
+
+// ForceUnlockDeploymentRunState runs `terraform force-unlock` in the working directory of
+// a run that failed on a held state lock. The lock ID must match the one the run
+// reported, so a lock taken since is not released by mistake. Requires an API key with
+// the approver role; the release is audit logged.
+// POST /api/deployments/:id/runs/:runId/force-unlock
+func ForceUnlockDeploymentRunState(c *gin.Context) {
+	var input models.ForceUnlockRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	parent, ok := getOperationParentRun(c)
+	if !ok || !runQuotaAllows(c, parent.DeploymentID) {
+		return
+	}
+	if parent.StateLock == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Run did not fail on a state lock"})
+		return
+	}
+	if input.LockID != parent.StateLock.ID {
+		c.JSON(http.StatusConflict, gin.H{"error": "lock_id does not match the lock the run reported (" + parent.StateLock.ID + ")"})
+		return
+	}
+
+	details := map[string]interface{}{
+		"deployment_id": parent.DeploymentID,
+		"path":          parent.Path,
+		"lock_id":       parent.StateLock.ID,
+		"lock_who":      parent.StateLock.Who,
+		"lock_created":  parent.StateLock.Created,
+	}
+	if err := recordAuditEvent("run.state_force_unlocked", c.GetString("api_key_name"), "deployment_run", parent.ID, details); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+		return
+	}
+
+	startStateOperation(c, "force_unlock", "force-unlock", input)
+}
+
+// pipelineStages are the stage names of the runner pipeline, in order
+var pipelineStages = []string{"clone", "pre_hooks", "init", "validate", "plan", "policy", "approval", "apply", "outputs", "post_hooks"}
+
+// RetryDeploymentRun resumes a failed, cancelled, stale or expired run from the stage that did not
+// succeed (or an earlier from_stage) in the same working directory. Earlier stages are
+// not repeated; the retry is a new run whose parent is the retried run.
+// POST /api/deployments/:id/runs/:runId/retry
+func RetryDeploymentRun(c *gin.Context) {
+	var input models.DeploymentRunRetry
+	if c.Request.ContentLength > 0 {
+		if !bindJSON(c, &input) {
+			return
+		}
+	}
+
+	if input.FromStage != "" {
+		known := false
+		for _, name := range pipelineStages {
+			known = known || name == input.FromStage
+		}
+		if !known {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from_stage must be one of: " + strings.Join(pipelineStages, ", ")})
+			return
+		}
+	}
+
+	parent, ok := getOperationParentRun(c)
+	if !ok {
+		return
+	}
+	if parent.Operation != "apply" && parent.Operation != "destroy" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only apply and destroy runs can be retried"})
+		return
+	}
+	if parent.Status == "success" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only failed, cancelled, stale or expired runs can be retried"})
+		return
+	}
+	if !runQuotaAllows(c, parent.DeploymentID) {
+		return
+	}
+
+	run, err := createOperationRun(parent, parent.Operation, input)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	go build.RetryRun(run.ID, parent.DeploymentID, parent.WorkDir, input.FromStage)
+
+	c.JSON(http.StatusCreated, run)
+}
+
+// startStateOperation creates and starts an approved state operation run
+func startStateOperation(c *gin.Context, operation, runnerPath string, input interface{}) {
+	parent, ok := getOperationParentRun(c)
+	if !ok || !runQuotaAllows(c, parent.DeploymentID) {
+		return
+	}
+
+	run, err := createOperationRun(parent, operation, input)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The approver role is enforced by middleware; record who approved the operation
+	approvedBy := c.GetString("api_key_name")
+	database.DB.Exec(`UPDATE deployment_runs SET approved_by = $1, approved_at = $2 WHERE id = $3`, approvedBy, time.Now(), run.ID)
+
+	go build.ExecuteRunOperation(run.ID, parent.WorkDir, runnerPath, input)
+
+	run, _ = getDeploymentRun(run.ID)
+	c.JSON(http.StatusCreated, run)
+}
+
+// isValidResourceAddress rejects empty addresses and anything that could be parsed as a CLI flag
+func isValidResourceAddress(address string) bool {
+	address = strings.TrimSpace(address)
+	return address != "" && !strings.HasPrefix(address, "-")
+}
+
+// getOperationParentRun loads the run an operation will build on and checks that its
+// working directory can be reused. It writes the error response itself.
+func getOperationParentRun(c *gin.Context) (*models.DeploymentRun, bool) {
+	parent, err := getDeploymentRun(c.Param("runId"))
+	if err != nil || parent.DeploymentID != c.Param("id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return nil, false
+	}
+
+	if parent.WorkDir == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Run has not started on the runner"})
+		return nil, false
+	}
+
+	switch parent.Status {
+	case "success", "failed", "cancelled", "stale", "expired":
+		return parent, true
+	default:
+		c.JSON(http.StatusConflict, gin.H{"error": "Run must be finished before starting an operation on it"})
+		return nil, false
+	}
+}
+
+// createOperationRun inserts a run that reuses the settings of its parent run
+func createOperationRun(parent *models.DeploymentRun, operation string, args interface{}) (*models.DeploymentRun, error) {
+	runID := generateID()
+	now := time.Now()
+
+	tfvarsFilesJSON, _ := json.Marshal(parent.TfvarsFiles)
+	argsJSON, _ := json.Marshal(args)
+
+	_, err := database.DB.Exec(`
+		INSERT INTO deployment_runs (id, deployment_id, path, ref, commit_sha, tool, env_vars, tfvars_files, init_flags, plan_flags,
+		                             terraform_workspace, operation, operation_args, parent_run_id, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, 'pending', $15)
+	`, runID, parent.DeploymentID, parent.Path, parent.Ref, parent.CommitSHA, parent.Tool, parent.StoredEnvVars, string(tfvarsFilesJSON),
+		parent.InitFlags, parent.PlanFlags, parent.TerraformWorkspace, operation, string(argsJSON), parent.ID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return getDeploymentRun(runID)
+}
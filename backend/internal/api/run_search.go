@@ -0,0 +1,111 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchRuns lists runs across all deployments, newest first. Logs are left out; fetch
+// a run through its deployment for those.
+// GET /api/runs?status=failed,expired&namespace=&deployment_id=&path=&ref=&failure_category=&approved_by=&since=&until=&q=&limit=100&offset=0
+func SearchRuns(c *gin.Context) {
+	query := `
+		SELECT r.id, r.deployment_id, d.name, n.name, COALESCE(r.path, ''), COALESCE(r.ref, ''), r.commit_sha,
+		       COALESCE(r.tool, ''), r.operation, r.status,
+		       r.error_message, r.failure_category, r.approved_by, r.created_at, r.started_at, r.completed_at
+		FROM deployment_runs r
+		JOIN deployments d ON r.deployment_id = d.id
+		JOIN namespaces n ON d.namespace_id = n.id
+		WHERE TRUE`
+	args := []interface{}{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if status := c.Query("status"); status != "" {
+		var placeholders []string
+		for _, s := range strings.Split(status, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				placeholders = append(placeholders, arg(s))
+			}
+		}
+		if len(placeholders) > 0 {
+			query += ` AND r.status IN (` + strings.Join(placeholders, ", ") + `)`
+		}
+	}
+	if namespace := c.Query("namespace"); namespace != "" {
+		p := arg(namespace)
+		query += ` AND (n.name = ` + p + ` OR n.id = ` + p + `)`
+	}
+	if deploymentID := c.Query("deployment_id"); deploymentID != "" {
+		query += ` AND r.deployment_id = ` + arg(deploymentID)
+	}
+	if path := c.Query("path"); path != "" {
+		query += ` AND r.path = ` + arg(path)
+	}
+	if ref := c.Query("ref"); ref != "" {
+		query += ` AND (r.ref = ` + arg(ref) + ` OR r.commit_sha = ` + arg(strings.ToLower(ref)) + `)`
+	}
+	if category := c.Query("failure_category"); category != "" {
+		query += ` AND r.failure_category = ` + arg(category)
+	}
+	if approvedBy := c.Query("approved_by"); approvedBy != "" {
+		query += ` AND r.approved_by = ` + arg(approvedBy)
+	}
+	for _, bound := range []struct{ param, op string }{{"since", ">="}, {"until", "<"}} {
+		v := c.Query(bound.param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bound.param + " must be an RFC 3339 timestamp"})
+			return
+		}
+		query += ` AND r.created_at ` + bound.op + ` ` + arg(t)
+	}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		// Match the text literally, not as a LIKE pattern
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(q)
+		query += ` AND r.error_message ILIKE ` + arg("%"+escaped+"%")
+	}
+
+	limit := 100
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 1000 {
+		limit = l
+	}
+	offset := 0
+	if o, err := strconv.Atoi(c.Query("offset")); err == nil && o > 0 {
+		offset = o
+	}
+	query += ` ORDER BY r.created_at DESC, r.id LIMIT ` + arg(limit) + ` OFFSET ` + arg(offset)
+
+	rows, err := database.Reader().Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	runs := []models.RunSummary{}
+	for rows.Next() {
+		var r models.RunSummary
+		if err := rows.Scan(&r.ID, &r.DeploymentID, &r.DeploymentName, &r.Namespace, &r.Path, &r.Ref, &r.CommitSHA, &r.Tool,
+			&r.Operation, &r.Status, &r.ErrorMessage, &r.FailureCategory, &r.ApprovedBy, &r.CreatedAt, &r.StartedAt, &r.CompletedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		runs = append(runs, r)
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"iac-tool/internal/models"
+	"iac-tool/internal/scheduler"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scheduleLocation is the timezone given as ?tz= (an IANA name, default UTC). It writes a
+// 400 and returns false when the name is unknown.
+func scheduleLocation(c *gin.Context) (*time.Location, bool) {
+	loc, err := time.LoadLocation(c.DefaultQuery("tz", "UTC"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown timezone: " + c.Query("tz")})
+		return nil, false
+	}
+	return loc, true
+}
+
+// ListSchedules lists the timed work (the scheduler's periodic jobs and every deployment's
+// auto-destroy) with its last and next run in the ?tz= timezone
+// GET /api/schedules
+func ListSchedules(c *gin.Context) {
+	loc, ok := scheduleLocation(c)
+	if !ok {
+		return
+	}
+	schedules, err := scheduler.Schedules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range schedules {
+		if t := schedules[i].LastRun; t != nil {
+			local := t.In(loc)
+			schedules[i].LastRun = &local
+		}
+		if t := schedules[i].NextRun; t != nil {
+			local := t.In(loc)
+			schedules[i].NextRun = &local
+		}
+	}
+	c.JSON(http.StatusOK, schedules)
+}
+
+// GetScheduleOccurrences returns the next ?count= (default 5, at most 100) times a
+// schedule is due, in the ?tz= timezone
+// GET /api/schedules/:id/next-occurrences
+func GetScheduleOccurrences(c *gin.Context) {
+	loc, ok := scheduleLocation(c)
+	if !ok {
+		return
+	}
+	count := 5
+	if n, err := strconv.Atoi(c.Query("count")); err == nil && n > 0 && n <= 100 {
+		count = n
+	}
+
+	occurrences, err := scheduler.NextOccurrences(c.Param("id"), count)
+	if errors.Is(err, scheduler.ErrScheduleNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range occurrences {
+		occurrences[i] = occurrences[i].In(loc)
+	}
+	c.JSON(http.StatusOK, models.ScheduleOccurrences{ID: c.Param("id"), Timezone: loc.String(), Occurrences: occurrences})
+}
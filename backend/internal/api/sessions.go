@@ -0,0 +1,295 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"iac-tool/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Frontend sessions stand in for an API key: the browser trades a key for an HttpOnly
+// session cookie once, so the key does not have to stay in JavaScript. Requests
+// authenticated by the cookie must carry the session's CSRF token in X-CSRF-Token when
+// they change anything. API keys keep working for programmatic access.
+const (
+	sessionCookie = "iac_session"
+	csrfHeader    = "X-CSRF-Token"
+)
+
+// sessionInfo is a valid session and the API key it stands in for
+type sessionInfo struct {
+	ID          string
+	APIKeyID    string
+	KeyName     string
+	Permissions string
+	CSRFToken   string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// sessionDuration reads a duration setting, falling back to def
+func sessionDuration(env string, def time.Duration) time.Duration {
+	if value := os.Getenv(env); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("Warning: invalid %s %q, using %s", env, value, def)
+	}
+	return def
+}
+
+// sessionLifetime is the absolute lifetime of a session (SESSION_LIFETIME, default 12h)
+func sessionLifetime() time.Duration {
+	return sessionDuration("SESSION_LIFETIME", 12*time.Hour)
+}
+
+// sessionIdleTimeout ends sessions that are not used for a while (SESSION_IDLE_TIMEOUT,
+// default 1h); every authenticated request extends the session up to its lifetime
+func sessionIdleTimeout() time.Duration {
+	return sessionDuration("SESSION_IDLE_TIMEOUT", time.Hour)
+}
+
+// randomToken returns a random hex token
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// nextExpiry is when a session used now expires: after the idle timeout, but never
+// later than its absolute lifetime
+func nextExpiry(createdAt time.Time) time.Time {
+	expiry := time.Now().Add(sessionIdleTimeout())
+	if limit := createdAt.Add(sessionLifetime()); expiry.After(limit) {
+		return limit
+	}
+	return expiry
+}
+
+// setSessionCookie sends the session cookie; Secure unless the request came over plain
+// HTTP and SESSION_COOKIE_SECURE is not "true"
+func setSessionCookie(c *gin.Context, token string, maxAge int) {
+	secure := c.Request.TLS != nil || os.Getenv("SESSION_COOKIE_SECURE") == "true"
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/api",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// loadSession returns the session of the request's cookie, or nil when there is no valid
+// one. A valid session is extended (see nextExpiry).
+func loadSession(c *gin.Context) (*sessionInfo, error) {
+	token, err := c.Cookie(sessionCookie)
+	if err != nil || token == "" {
+		return nil, nil
+	}
+
+	s := sessionInfo{ID: hashAPIKey(token)}
+	var keyExpiresAt sql.NullTime
+	err = database.DB.QueryRow(`
+		SELECT s.api_key_id, s.csrf_token, s.created_at, s.expires_at, k.name, k.permissions, k.expires_at
+		FROM sessions s JOIN api_keys k ON k.id = s.api_key_id
+		WHERE s.id = $1
+	`, s.ID).Scan(&s.APIKeyID, &s.CSRFToken, &s.CreatedAt, &s.ExpiresAt, &s.KeyName, &s.Permissions, &keyExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if now.After(s.ExpiresAt) || (keyExpiresAt.Valid && keyExpiresAt.Time.Before(now)) {
+		database.DB.Exec("DELETE FROM sessions WHERE id = $1", s.ID)
+		return nil, nil
+	}
+
+	s.ExpiresAt = nextExpiry(s.CreatedAt)
+	database.DB.Exec("UPDATE sessions SET last_seen_at = $1, expires_at = $2 WHERE id = $3", now, s.ExpiresAt, s.ID)
+	database.DB.Exec("UPDATE api_keys SET last_used_at = $1 WHERE id = $2", now, s.APIKeyID)
+	return &s, nil
+}
+
+// sessionResponse is what the session endpoints return to the frontend
+func sessionResponse(s *sessionInfo) gin.H {
+	return gin.H{
+		"key_name":    s.KeyName,
+		"permissions": s.Permissions,
+		"csrf_token":  s.CSRFToken,
+		"created_at":  s.CreatedAt,
+		"expires_at":  s.ExpiresAt,
+	}
+}
+
+// startSession stores a new session for an API key and sets its cookie
+func startSession(c *gin.Context, apiKeyID string, createdAt time.Time) (*sessionInfo, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	csrfToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sessionInfo{ID: hashAPIKey(token), APIKeyID: apiKeyID, CSRFToken: csrfToken, CreatedAt: createdAt}
+	s.ExpiresAt = nextExpiry(createdAt)
+	_, err = database.DB.Exec(`
+		INSERT INTO sessions (id, api_key_id, csrf_token, created_at, last_seen_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, s.ID, s.APIKeyID, s.CSRFToken, s.CreatedAt, time.Now(), s.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	setSessionCookie(c, token, int(sessionLifetime().Seconds()))
+	return s, nil
+}
+
+// CreateSession logs the frontend in with an API key
+// POST /api/auth/session
+func CreateSession(c *gin.Context) {
+	var input struct {
+		APIKey string `json:"api_key" binding:"required"`
+	}
+	if !bindJSON(c, &input) {
+		return
+	}
+	if rejectLockedOut(c, input.APIKey, false) {
+		return
+	}
+
+	var keyID, name, permissions string
+	var expiresAt sql.NullTime
+	err := database.DB.QueryRow(`
+		SELECT id, name, permissions, expires_at FROM api_keys WHERE key_hash = $1
+	`, hashAPIKey(input.APIKey)).Scan(&keyID, &name, &permissions, &expiresAt)
+	if err == sql.ErrNoRows || (err == nil && expiresAt.Valid && expiresAt.Time.Before(time.Now())) {
+		recordAuthFailure(c, input.APIKey)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API key"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication error"})
+		return
+	}
+
+	// Expired sessions are swept whenever someone logs in
+	database.DB.Exec("DELETE FROM sessions WHERE expires_at < $1", time.Now())
+
+	session, err := startSession(c, keyID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	session.KeyName, session.Permissions = name, permissions
+	recordAuthSuccess(c, keyID, name)
+
+	if err := recordAuditEvent("session.created", name, "api_key", keyID, map[string]interface{}{"client_ip": c.ClientIP()}); err != nil {
+		log.Printf("Warning: failed to record audit event: %v", err)
+	}
+	c.JSON(http.StatusCreated, sessionResponse(session))
+}
+
+// GetSession returns the current session, including its CSRF token
+// GET /api/auth/session
+func GetSession(c *gin.Context) {
+	session, err := loadSession(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication error"})
+		return
+	}
+	if session == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not logged in"})
+		return
+	}
+	c.JSON(http.StatusOK, sessionResponse(session))
+}
+
+// RefreshSession replaces the session cookie and CSRF token; the absolute lifetime still
+// counts from the original login
+// POST /api/auth/session/refresh
+func RefreshSession(c *gin.Context) {
+	session, err := loadSession(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication error"})
+		return
+	}
+	if session == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not logged in"})
+		return
+	}
+
+	refreshed, err := startSession(c, session.APIKeyID, session.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+	database.DB.Exec("DELETE FROM sessions WHERE id = $1", session.ID)
+	refreshed.KeyName, refreshed.Permissions = session.KeyName, session.Permissions
+	c.JSON(http.StatusOK, sessionResponse(refreshed))
+}
+
+// DeleteSession logs the frontend out
+// DELETE /api/auth/session
+func DeleteSession(c *gin.Context) {
+	if token, err := c.Cookie(sessionCookie); err == nil && token != "" {
+		database.DB.Exec("DELETE FROM sessions WHERE id = $1", hashAPIKey(token))
+	}
+	setSessionCookie(c, "", -1)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// RequireCSRFToken rejects changing requests that carry a session cookie without the
+// session's CSRF token. Requests without the cookie (API keys, anonymous) are not
+// affected, and logging in is exempt so a stale cookie cannot block it.
+func RequireCSRFToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		token, err := c.Cookie(sessionCookie)
+		if err != nil || token == "" {
+			c.Next()
+			return
+		}
+		if c.Request.Method == http.MethodPost && c.FullPath() == "/api/auth/session" {
+			c.Next()
+			return
+		}
+
+		var csrfToken string
+		err = database.DB.QueryRow("SELECT csrf_token FROM sessions WHERE id = $1", hashAPIKey(token)).Scan(&csrfToken)
+		if err == sql.ErrNoRows {
+			// Unknown or expired session: nothing to protect, the cookie grants nothing
+			c.Next()
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication error"})
+			c.Abort()
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader(csrfHeader)), []byte(csrfToken)) != 1 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing or invalid " + csrfHeader + " header"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
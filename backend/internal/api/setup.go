@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyPlaceholder stands in for the key when the caller authenticated with a session
+// cookie, whose key is not known in plain text
+const apiKeyPlaceholder = "<your-api-key>"
+
+// CLISetup is the Terraform CLI configuration for using this registry
+type CLISetup struct {
+	Host           string            `json:"host"`
+	APIKeyIncluded bool              `json:"api_key_included"` // false: replace <your-api-key>
+	Terraformrc    string            `json:"terraformrc"`      // credentials block for ~/.terraformrc or terraform.rc
+	CredentialsTF  string            `json:"credentials_tfrc_json"`
+	Env            map[string]string `json:"env,omitempty"` // TF_TOKEN_<host>, unless the host has a port
+	Bash           string            `json:"bash"`
+	PowerShell     string            `json:"powershell"`
+}
+
+// GetCLISetup returns ready-made Terraform CLI credentials for this registry's host and
+// the caller's API key. ?format=terraformrc, bash or powershell returns just that
+// snippet as text.
+// GET /api/setup/cli
+func GetCLISetup(c *gin.Context) {
+	u, err := url.Parse(requestBaseURL(c))
+	if err != nil || u.Host == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot determine the registry host; set BASE_URL"})
+		return
+	}
+
+	token := requestAPIKey(c)
+	setup := cliSetup(u.Host, token)
+
+	// The response may contain the key
+	c.Header("Cache-Control", "no-store")
+	switch c.Query("format") {
+	case "":
+		c.JSON(http.StatusOK, setup)
+	case "terraformrc":
+		c.String(http.StatusOK, setup.Terraformrc)
+	case "bash":
+		c.String(http.StatusOK, setup.Bash)
+	case "powershell":
+		c.String(http.StatusOK, setup.PowerShell)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be terraformrc, bash or powershell"})
+	}
+}
+
+func cliSetup(host, token string) CLISetup {
+	setup := CLISetup{Host: host, APIKeyIncluded: token != ""}
+	if token == "" {
+		token = apiKeyPlaceholder
+	}
+
+	setup.Terraformrc = fmt.Sprintf("credentials %q {\n  token = %q\n}\n", host, token)
+	credentials, _ := json.MarshalIndent(map[string]interface{}{
+		"credentials": map[string]interface{}{host: map[string]string{"token": token}},
+	}, "", "  ")
+	setup.CredentialsTF = string(credentials) + "\n"
+
+	// Terraform reads TF_TOKEN_<host> with dots as underscores and dashes doubled;
+	// host names with a port cannot be expressed that way
+	var envName string
+	if !strings.Contains(host, ":") {
+		envName = "TF_TOKEN_" + strings.NewReplacer(".", "_", "-", "__").Replace(host)
+		setup.Env = map[string]string{envName: token}
+	}
+
+	var bash strings.Builder
+	bash.WriteString("# Adds the registry credentials to ~/.terraformrc\n")
+	fmt.Fprintf(&bash, "cat >> ~/.terraformrc <<'EOF'\n%sEOF\n", setup.Terraformrc)
+	if envName != "" {
+		fmt.Fprintf(&bash, "\n# Or, for the current shell only:\n# export %s='%s'\n", envName, token)
+	}
+	setup.Bash = bash.String()
+
+	var ps strings.Builder
+	ps.WriteString("# Adds the registry credentials to %APPDATA%\\terraform.rc\n")
+	fmt.Fprintf(&ps, "Add-Content -Path \"$env:APPDATA\\terraform.rc\" -Value @'\n%s'@\n", setup.Terraformrc)
+	if envName != "" {
+		fmt.Fprintf(&ps, "\n# Or, for the current session only:\n# $env:%s = '%s'\n", envName, token)
+	}
+	setup.PowerShell = ps.String()
+	return setup
+}
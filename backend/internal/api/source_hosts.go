@@ -0,0 +1,118 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+	"iac-tool/internal/sourcehosts"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkSourceHost responds with 400 and returns false when the host of rawURL is not in
+// the allowlist of kind
+func checkSourceHost(c *gin.Context, kind, rawURL string) bool {
+	err := sourcehosts.Check(kind, rawURL)
+	if err == nil {
+		return true
+	}
+	var notAllowed *sourcehosts.NotAllowedError
+	if errors.As(err, &notAllowed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+	return false
+}
+
+// GetSourceHosts lists the allowlisted git and artifact hosts
+// GET /api/admin/source-hosts
+func GetSourceHosts(c *gin.Context) {
+	rows, err := database.Reader().Query(`
+		SELECT id, kind, pattern, COALESCE(description, ''), created_at
+		FROM source_hosts
+		ORDER BY kind, pattern
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	hosts := []models.SourceHost{}
+	for rows.Next() {
+		var h models.SourceHost
+		if err := rows.Scan(&h.ID, &h.Kind, &h.Pattern, &h.Description, &h.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		hosts = append(hosts, h)
+	}
+
+	c.JSON(http.StatusOK, hosts)
+}
+
+// CreateSourceHost adds a host to the git or artifact allowlist. The first entry of a
+// kind turns its allowlist on.
+// POST /api/admin/source-hosts
+func CreateSourceHost(c *gin.Context) {
+	var input models.SourceHostCreate
+	if !bindJSON(c, &input) {
+		return
+	}
+	pattern, err := sourcehosts.NormalizePattern(input.Pattern)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h := models.SourceHost{
+		ID:          generateID(),
+		Kind:        input.Kind,
+		Pattern:     pattern,
+		Description: input.Description,
+		CreatedAt:   time.Now(),
+	}
+	_, err = database.DB.Exec(`
+		INSERT INTO source_hosts (id, kind, pattern, description, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, h.ID, h.Kind, h.Pattern, nilIfEmpty(&h.Description), h.CreatedAt)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			c.JSON(http.StatusConflict, gin.H{"error": "Host " + pattern + " is already allowlisted"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordAuditEvent("source_host.added", c.GetString("api_key_name"), "source_host", h.ID,
+		map[string]interface{}{"kind": h.Kind, "pattern": h.Pattern})
+	c.JSON(http.StatusCreated, h)
+}
+
+// DeleteSourceHost removes a host from the allowlist. Removing the last entry of a kind
+// allows any host again.
+// DELETE /api/admin/source-hosts/:id
+func DeleteSourceHost(c *gin.Context) {
+	var kind, pattern string
+	err := database.DB.QueryRow(`DELETE FROM source_hosts WHERE id = $1 RETURNING kind, pattern`, c.Param("id")).
+		Scan(&kind, &pattern)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Source host not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordAuditEvent("source_host.removed", c.GetString("api_key_name"), "source_host", c.Param("id"),
+		map[string]interface{}{"kind": kind, "pattern": pattern})
+	c.JSON(http.StatusOK, gin.H{"message": "Source host removed"})
+}
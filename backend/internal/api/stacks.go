@@ -0,0 +1,288 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"iac-tool/internal/build"
+	"iac-tool/internal/crypto"
+	"iac-tool/internal/database"
+	"iac-tool/internal/git"
+	"iac-tool/internal/models"
+	"iac-tool/internal/stack"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// replayStackRun answers a request whose Idempotency-Key already created a stack run with
+// that stack run, and reports whether it did
+func replayStackRun(c *gin.Context, deploymentID, key, fingerprint string) bool {
+	stackRunID, err := findIdempotent("stack_runs", deploymentID, key, fingerprint)
+	if err == errIdempotencyMismatch {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+	if stackRunID == "" {
+		return false
+	}
+	stackRun, err := getStackRun(stackRunID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+	markReplayed(c)
+	c.JSON(http.StatusOK, stackRun)
+	return true
+}
+
+// CreateStackRun runs several paths of a deployment in dependency order at one commit.
+// Paths and their dependencies come from the request or from a stack file in the repository.
+// POST /api/deployments/:id/stacks
+func CreateStackRun(c *gin.Context) {
+	id := c.Param("id")
+	var input models.StackRunCreate
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	// A retried request with the same Idempotency-Key gets the stack run the first one created
+	key, err := idempotencyKey(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	fingerprint := requestFingerprint(input)
+	if key != "" && replayStackRun(c, id, key, fingerprint) {
+		return
+	}
+
+	if input.CommitSHA != "" {
+		input.CommitSHA = strings.ToLower(input.CommitSHA)
+		if !commitSHAPattern.MatchString(input.CommitSHA) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "commit_sha must be a full 40 or 64 character commit SHA"})
+			return
+		}
+		if input.Ref == "" {
+			input.Ref = input.CommitSHA
+		}
+	}
+	if input.Ref == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ref or commit_sha is required"})
+		return
+	}
+
+	var gitURL string
+	var authType, authDataStr, defaultWorkspace sql.NullString
+	err = database.DB.QueryRow(`SELECT git_url, git_auth_type, git_auth_data, terraform_workspace FROM deployments WHERE id = $1`, id).
+		Scan(&gitURL, &authType, &authDataStr, &defaultWorkspace)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found"})
+		return
+	}
+	if !runQuotaAllows(c, id) {
+		return
+	}
+
+	var auth *git.AuthConfig
+	if authType.Valid && authDataStr.Valid {
+		if decryptedData, err := crypto.DecryptJSON(authDataStr.String); err == nil {
+			var authJSON map[string]string
+			if err := json.Unmarshal([]byte(decryptedData), &authJSON); err == nil {
+				auth = &git.AuthConfig{
+					Type:     authType.String,
+					Username: authJSON["username"],
+					Password: authJSON["password"],
+				}
+			}
+		}
+	}
+
+	// Every path runs at the same commit, even if the ref moves while the stack runs
+	if input.CommitSHA == "" {
+		input.CommitSHA, err = git.ResolveRef(gitURL, input.Ref, auth)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to resolve ref: " + err.Error()})
+			return
+		}
+	}
+
+	var configFile sql.NullString
+	if len(input.Paths) == 0 {
+		if input.ConfigFile == "" {
+			input.ConfigFile = stack.DefaultConfigFile
+		}
+		if strings.HasPrefix(input.ConfigFile, "/") || strings.Contains(input.ConfigFile, "..") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "config_file must be relative to the repository root"})
+			return
+		}
+		content, err := git.FileAtCommit(gitURL, input.CommitSHA, input.ConfigFile, auth)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No paths given and the stack file could not be read: " + err.Error()})
+			return
+		}
+		var config models.StackConfig
+		if err := yaml.Unmarshal([]byte(content), &config); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stack file: " + err.Error()})
+			return
+		}
+		input.Paths = config.Paths
+		configFile = sql.NullString{String: input.ConfigFile, Valid: true}
+	}
+
+	input.Paths = stack.Clean(input.Paths)
+	if err := stack.Validate(input.Paths); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	workspace := input.TerraformWorkspace
+	if workspace == "" && defaultWorkspace.Valid {
+		workspace = defaultWorkspace.String
+	}
+	operation := "apply"
+	if input.Destroy {
+		operation = "destroy"
+	}
+
+	stackRunID := generateID()
+	envVars, err := crypto.EncryptEnvVars(input.EnvVars)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt env vars"})
+		return
+	}
+	tfvarsFilesJSON, _ := json.Marshal(input.TfvarsFiles)
+	pathsJSON, _ := json.Marshal(input.Paths)
+	result, err := database.DB.Exec(`
+		INSERT INTO stack_runs (id, deployment_id, ref, commit_sha, tool, env_vars, tfvars_files, init_flags, plan_flags,
+		                        terraform_workspace, operation, paths, config_file, idempotency_key, idempotency_fingerprint, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, 'pending', $16)
+		ON CONFLICT (deployment_id, idempotency_key) WHERE idempotency_key IS NOT NULL DO NOTHING
+	`, stackRunID, id, input.Ref, input.CommitSHA, input.Tool, envVars, string(tfvarsFilesJSON), input.InitFlags, input.PlanFlags,
+		workspace, operation, string(pathsJSON), configFile, nullableKey(key), fingerprint, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		// A concurrent request with the same key created the stack run first
+		if !replayStackRun(c, id, key, fingerprint) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Stack run was not created, retry the request"})
+		}
+		return
+	}
+
+	go build.ExecuteStackRun(stackRunID)
+
+	stackRun, err := getStackRun(stackRunID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, stackRun)
+}
+
+// ListStackRuns lists the stack runs of a deployment, newest first
+// GET /api/deployments/:id/stacks
+func ListStackRuns(c *gin.Context) {
+	rows, err := database.DB.Query(`SELECT id FROM stack_runs WHERE deployment_id = $1 ORDER BY created_at DESC`, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var stackRunID string
+		if rows.Scan(&stackRunID) == nil {
+			ids = append(ids, stackRunID)
+		}
+	}
+	rows.Close()
+
+	stackRuns := []models.StackRun{}
+	for _, stackRunID := range ids {
+		if stackRun, err := getStackRun(stackRunID); err == nil {
+			stackRuns = append(stackRuns, *stackRun)
+		}
+	}
+
+	c.JSON(http.StatusOK, stackRuns)
+}
+
+// GetStackRun returns a stack run with the status of every path and the graph layout
+// GET /api/deployments/:id/stacks/:stackId
+func GetStackRun(c *gin.Context) {
+	stackRun, err := getStackRun(c.Param("stackId"))
+	if err != nil || stackRun.DeploymentID != c.Param("id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stack run not found"})
+		return
+	}
+	c.JSON(http.StatusOK, stackRun)
+}
+
+// CancelStackRun stops a stack run: no further paths are started and running paths are cancelled
+// POST /api/deployments/:id/stacks/:stackId/cancel
+func CancelStackRun(c *gin.Context) {
+	result, err := database.DB.Exec(`
+		UPDATE stack_runs
+		SET status = 'cancelled', error_message = 'Cancelled by user', completed_at = $1
+		WHERE id = $2 AND deployment_id = $3 AND status IN ('pending', 'running', 'awaiting_approval')
+	`, time.Now(), c.Param("stackId"), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Stack run not found or already finished"})
+		return
+	}
+
+	stackRun, _ := getStackRun(c.Param("stackId"))
+	c.JSON(http.StatusOK, stackRun)
+}
+
+func getStackRun(stackRunID string) (*models.StackRun, error) {
+	var s models.StackRun
+	var envVarsJSON, tfvarsJSON, initFlags, planFlags, workspace sql.NullString
+	var pathsJSON string
+	err := database.DB.QueryRow(`
+		SELECT id, deployment_id, ref, commit_sha, tool, env_vars, tfvars_files, init_flags, plan_flags, terraform_workspace,
+		       operation, paths, config_file, status, error_message, created_at, started_at, completed_at
+		FROM stack_runs
+		WHERE id = $1
+	`, stackRunID).Scan(&s.ID, &s.DeploymentID, &s.Ref, &s.CommitSHA, &s.Tool, &envVarsJSON, &tfvarsJSON, &initFlags, &planFlags, &workspace,
+		&s.Operation, &pathsJSON, &s.ConfigFile, &s.Status, &s.ErrorMessage, &s.CreatedAt, &s.StartedAt, &s.CompletedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	s.EnvVars = redactEnvVars(envVarsJSON.String)
+	if tfvarsJSON.Valid && tfvarsJSON.String != "" {
+		json.Unmarshal([]byte(tfvarsJSON.String), &s.TfvarsFiles)
+	}
+	if s.TfvarsFiles == nil {
+		s.TfvarsFiles = make([]string, 0)
+	}
+	s.InitFlags = initFlags.String
+	s.PlanFlags = planFlags.String
+	s.TerraformWorkspace = workspace.String
+	json.Unmarshal([]byte(pathsJSON), &s.Paths)
+
+	runs, err := build.StackRunStates(s.ID)
+	if err != nil {
+		return nil, err
+	}
+	destroy := s.Operation == "destroy"
+	s.Nodes = stack.Nodes(s.Paths, runs, destroy)
+	s.Edges, s.Levels = stack.Graph(s.Paths, destroy)
+	s.Counts = stack.Counts(s.Nodes)
+
+	return &s, nil
+}
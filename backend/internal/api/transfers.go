@@ -0,0 +1,306 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"iac-tool/internal/build"
+	"iac-tool/internal/cache"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A module or provider moved to another namespace keeps its ID, versions and settings. Its
+// previous address is recorded in registry_redirects, so the registry protocol can tell
+// terraform users of the old address where it went instead of only "not found". A moved
+// module is also served under its old address until its alias expires (see module_aliases.go).
+
+// registryAddress is the address of a module or provider; provider is empty for providers
+type registryAddress struct {
+	namespace, name, provider string
+}
+
+// recordRedirect records the previous address of a moved module or provider and drops
+// redirects of the address it now has, which is in use again
+func recordRedirect(tx *sql.Tx, kind, targetID string, from, to registryAddress) error {
+	if _, err := tx.Exec(`DELETE FROM registry_redirects WHERE kind = $1 AND namespace = $2 AND name = $3 AND provider = $4`,
+		kind, to.namespace, to.name, to.provider); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		INSERT INTO registry_redirects (id, kind, namespace, name, provider, target_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (kind, namespace, name, provider) DO UPDATE SET target_id = EXCLUDED.target_id, created_at = EXCLUDED.created_at
+	`, generateID(), kind, from.namespace, from.name, from.provider, targetID, time.Now())
+	return err
+}
+
+// movedModuleAddress returns the current address of a module that was moved away from
+// namespace/name/provider; empty when it was not moved or no longer exists
+func movedModuleAddress(db *sql.DB, namespace, name, provider string) string {
+	var address string
+	db.QueryRow(`
+		SELECT n.name || '/' || m.name || '/' || m.provider
+		FROM registry_redirects r
+		JOIN modules m ON m.id = r.target_id
+		JOIN namespaces n ON n.id = m.namespace_id
+		WHERE r.kind = 'module' AND r.namespace = $1 AND r.name = $2 AND r.provider = $3
+	`, namespace, name, provider).Scan(&address)
+	return address
+}
+
+// movedProviderAddress returns the current address of a provider that was moved away from
+// namespace/name; empty when it was not moved or no longer exists
+func movedProviderAddress(db *sql.DB, namespace, name string) string {
+	var address string
+	db.QueryRow(`
+		SELECT n.name || '/' || p.name
+		FROM registry_redirects r
+		JOIN providers p ON p.id = r.target_id
+		JOIN namespaces n ON n.id = p.namespace_id
+		WHERE r.kind = 'provider' AND r.namespace = $1 AND r.name = $2 AND r.provider = ''
+	`, namespace, name).Scan(&address)
+	return address
+}
+
+// movedModuleError is the registry protocol error for a module address that does not exist:
+// the new address when the module was moved, notFound otherwise
+func movedModuleError(namespace, name, provider, notFound string) string {
+	if address := movedModuleAddress(database.Replica(), namespace, name, provider); address != "" {
+		return fmt.Sprintf("module %s/%s/%s has moved to %s; update the module source address", namespace, name, provider, address)
+	}
+	return notFound
+}
+
+// movedProviderError is the registry protocol error for a provider address that does not
+// exist: the new address when the provider was moved, notFound otherwise
+func movedProviderError(namespace, name, notFound string) string {
+	if address := movedProviderAddress(database.Replica(), namespace, name); address != "" {
+		return fmt.Sprintf("provider %s/%s has moved to %s; update the source in required_providers", namespace, name, address)
+	}
+	return notFound
+}
+
+// loadTransferTarget returns the name of the namespace a transfer goes to, answering the
+// request itself when the input is invalid or the namespace does not exist
+func loadTransferTarget(c *gin.Context, input *models.TransferRequest) (string, bool) {
+	if !bindJSON(c, input) {
+		return "", false
+	}
+	var namespace string
+	if err := database.DB.QueryRow(`SELECT name FROM namespaces WHERE id = $1`, input.NamespaceID).Scan(&namespace); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Namespace not found"})
+		return "", false
+	}
+	return namespace, true
+}
+
+// TransferModule moves a module to another namespace; its old address is recorded so the
+// registry points terraform users at the new one
+// POST /api/modules/:id/transfer
+func TransferModule(c *gin.Context) {
+	moduleID := c.Param("id")
+	var input models.TransferRequest
+	toNamespace, ok := loadTransferTarget(c, &input)
+	if !ok {
+		return
+	}
+
+	var fromNamespaceID, fromNamespace, name, provider string
+	err := database.DB.QueryRow(`
+		SELECT m.namespace_id, n.name, m.name, m.provider FROM modules m
+		JOIN namespaces n ON m.namespace_id = n.id
+		WHERE m.id = $1
+	`, moduleID).Scan(&fromNamespaceID, &fromNamespace, &name, &provider)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Module not found"})
+		return
+	}
+	if fromNamespaceID == input.NamespaceID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Module is already in namespace " + toNamespace})
+		return
+	}
+	var existingID string
+	if database.DB.QueryRow(`SELECT id FROM modules WHERE namespace_id = $1 AND name = $2 AND provider = $3`,
+		input.NamespaceID, name, provider).Scan(&existingID) == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Namespace %s already has a module %s/%s", toNamespace, name, provider)})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`UPDATE modules SET namespace_id = $1, updated_at = $2 WHERE id = $3`, input.NamespaceID, time.Now(), moduleID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := recordRedirect(tx, "module", moduleID, registryAddress{fromNamespace, name, provider}, registryAddress{toNamespace, name, provider}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// The old address keeps working for the alias window
+	if err := recordModuleAlias(tx, moduleID, fromNamespace, name, provider); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	registryChanged(moduleID)
+	cache.Registry.InvalidateGroup(moduleCacheGroup(fromNamespace, name, provider))
+	cache.Registry.InvalidateGroup(moduleCacheGroup(toNamespace, name, provider))
+
+	from, to := fromNamespace+"/"+name+"/"+provider, toNamespace+"/"+name+"/"+provider
+	recordAuditEvent("module.transferred", c.GetString("api_key_name"), "module", moduleID,
+		map[string]interface{}{"from": from, "to": to})
+	c.JSON(http.StatusOK, gin.H{"message": "Module moved to " + to, "from": from, "to": to})
+}
+
+// TransferProvider moves a provider to another namespace, along with its locally hosted
+// files; its old address is recorded so the registry points terraform users at the new one
+// POST /api/providers/:id/transfer
+func TransferProvider(c *gin.Context) {
+	providerID := c.Param("id")
+	var input models.TransferRequest
+	toNamespace, ok := loadTransferTarget(c, &input)
+	if !ok {
+		return
+	}
+
+	var fromNamespaceID, fromNamespace, name string
+	err := database.DB.QueryRow(`
+		SELECT p.namespace_id, n.name, p.name FROM providers p
+		JOIN namespaces n ON p.namespace_id = n.id
+		WHERE p.id = $1
+	`, providerID).Scan(&fromNamespaceID, &fromNamespace, &name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Provider not found"})
+		return
+	}
+	if fromNamespaceID == input.NamespaceID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provider is already in namespace " + toNamespace})
+		return
+	}
+	var existingID string
+	if database.DB.QueryRow(`SELECT id FROM providers WHERE namespace_id = $1 AND name = $2`, input.NamespaceID, name).Scan(&existingID) == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Namespace %s already has a provider %s", toNamespace, name)})
+		return
+	}
+
+	// The files move with the provider and count against the new namespace's quota
+	buildDir := build.ArtifactDir()
+	fromDir := filepath.Join(buildDir, "providers", fromNamespace, name)
+	toDir := filepath.Join(buildDir, "providers", toNamespace, name)
+	if _, err := os.Stat(toDir); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Files of a provider %s/%s are still stored; run the artifact GC first", toNamespace, name)})
+		return
+	}
+	size, err := directorySize(fromDir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	msg, err := checkStorageQuota(input.NamespaceID, size, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if msg != "" {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": msg})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`UPDATE providers SET namespace_id = $1, updated_at = $2 WHERE id = $3`, input.NamespaceID, time.Now(), providerID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Locally hosted platforms link to their files and checksums by address
+	if _, err := tx.Exec(`
+		UPDATE provider_platforms SET
+			download_url = REPLACE(download_url, $1, $2),
+			shasums_url = REPLACE(shasums_url, $3, $4),
+			shasums_signature_url = REPLACE(shasums_signature_url, $3, $4)
+		WHERE version_id IN (SELECT id FROM provider_versions WHERE provider_id = $5)
+	`, "/downloads/providers/"+fromNamespace+"/"+name+"/", "/downloads/providers/"+toNamespace+"/"+name+"/",
+		"/shasums/providers/"+fromNamespace+"/"+name+"/", "/shasums/providers/"+toNamespace+"/"+name+"/", providerID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := recordRedirect(tx, "provider", providerID, registryAddress{fromNamespace, name, ""}, registryAddress{toNamespace, name, ""}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Files are moved last and moved back if the commit fails, so the database and
+	// BUILD_DIR agree either way. Renaming keeps the hard links into the blob store.
+	movedFiles := false
+	if _, err := os.Stat(fromDir); err == nil {
+		if err := os.MkdirAll(filepath.Dir(toDir), 0755); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move provider files: " + err.Error()})
+			return
+		}
+		if err := os.Rename(fromDir, toDir); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move provider files: " + err.Error()})
+			return
+		}
+		movedFiles = true
+	}
+	if err := tx.Commit(); err != nil {
+		if movedFiles {
+			if err := os.Rename(toDir, fromDir); err != nil {
+				log.Printf("Failed to move files of provider %s back to %s: %v", providerID, fromDir, err)
+			}
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	registryChanged(providerID)
+	cache.Registry.InvalidateGroup(providerCacheGroup(fromNamespace, name))
+	cache.Registry.InvalidateGroup(providerCacheGroup(toNamespace, name))
+
+	from, to := fromNamespace+"/"+name, toNamespace+"/"+name
+	recordAuditEvent("provider.transferred", c.GetString("api_key_name"), "provider", providerID,
+		map[string]interface{}{"from": from, "to": to, "moved_bytes": size})
+	c.JSON(http.StatusOK, gin.H{"message": "Provider moved to " + to, "from": from, "to": to})
+}
+
+// directorySize returns the bytes of the files below dir; 0 when it does not exist
+func directorySize(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
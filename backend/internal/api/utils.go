@@ -1,8 +1,17 @@
 package api
 
 import (
+	"database/sql"
+	"net/http"
+	"os"
 	"strings"
+	"time"
 
+	"iac-tool/internal/cache"
+	"iac-tool/internal/database"
+	"iac-tool/internal/validation"
+
+	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
@@ -19,3 +28,106 @@ func isValidGitURL(url string) bool {
 	}
 	return false
 }
+
+// isValidImageRef performs a basic sanity check on a container image reference
+// (e.g., "ghcr.io/org/toolchain:1.2", "alpine@sha256:...")
+func isValidImageRef(ref string) bool {
+	if ref == "" || len(ref) > 255 || strings.HasPrefix(ref, "-") {
+		return false
+	}
+	for _, r := range ref {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && !strings.ContainsRune("._-/:@", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidTTL checks that a duration string (e.g., "72h") parses to a positive duration
+func isValidTTL(ttl string) bool {
+	d, err := time.ParseDuration(ttl)
+	return err == nil && d > 0
+}
+
+// requestBaseURL returns BASE_URL, or derives the public base URL from the
+// request headers (set by the nginx proxy) when it is not configured
+func requestBaseURL(c *gin.Context) string {
+	if baseURL := os.Getenv("BASE_URL"); baseURL != "" {
+		return baseURL
+	}
+	host := c.GetHeader("X-Forwarded-Host")
+	if host == "" {
+		host = c.GetHeader("Host")
+	}
+	if host == "" {
+		backendHost := os.Getenv("BACKEND_HOST")
+		if backendHost == "" {
+			backendHost = "localhost"
+		}
+		backendPort := os.Getenv("PORT")
+		if backendPort == "" {
+			backendPort = "9080"
+		}
+		host = backendHost + ":" + backendPort
+	}
+	scheme := c.GetHeader("X-Forwarded-Proto")
+	if scheme == "" {
+		scheme = "http"
+	}
+	return scheme + "://" + host
+}
+
+// registryChanged drops the cached registry lookups of a module or provider and reads its
+// rows from the primary database until a read replica has caught up
+func registryChanged(id string) {
+	cache.Registry.InvalidateOwner(id)
+	database.MarkWritten(id)
+}
+
+// readRegistry runs a registry lookup against the read replica, repeating it on the
+// primary when the row was not found (it may not have replicated yet) or belongs to a
+// module or provider this instance changed recently. load returns the owner's ID.
+func readRegistry(load func(db *sql.DB) (interface{}, string, error)) func() (interface{}, string, error) {
+	return func() (interface{}, string, error) {
+		db := database.Replica()
+		value, owner, err := load(db)
+		if db != database.DB && (err == sql.ErrNoRows || (err == nil && database.RecentlyWritten(owner))) {
+			return load(database.DB)
+		}
+		return value, owner, err
+	}
+}
+
+// bindJSON binds a request body and validates it. Invalid requests get a 400 listing
+// each rejected field, e.g. {"error": "name: is required", "errors": [{"field": "name", ...}]}.
+func bindJSON(c *gin.Context, input interface{}) bool {
+	if err := c.ShouldBindJSON(input); err != nil {
+		if msg := bodyLimitMessage(err); msg != "" {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": msg})
+			return false
+		}
+		fields := validation.Errors(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.Summary(fields), "errors": fields})
+		return false
+	}
+	return true
+}
+
+// bindRegistryJSON is bindJSON for endpoints that answer errors the registry protocol
+// way, as a list of messages ({"errors": ["name: is required"]})
+func bindRegistryJSON(c *gin.Context, input interface{}) bool {
+	if err := c.ShouldBindJSON(input); err != nil {
+		if msg := bodyLimitMessage(err); msg != "" {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"errors": []string{msg}})
+			return false
+		}
+		fields := validation.Errors(err)
+		messages := make([]string, 0, len(fields))
+		for _, f := range fields {
+			messages = append(messages, validation.Summary([]validation.FieldError{f}))
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"errors": messages})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"iac-tool/internal/build"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// autoEnableRule is a parsed models.VersionAutoEnableRule
+type autoEnableRule struct {
+	constraint         build.VersionConstraint
+	includePrereleases bool
+}
+
+// loadAutoEnableRule returns the auto-enable rule of a module or provider (table is
+// "modules" or "providers"), nil when it has none
+func loadAutoEnableRule(table, id string) *autoEnableRule {
+	var ruleJSON sql.NullString
+	if database.DB.QueryRow(`SELECT auto_enable_rule FROM `+table+` WHERE id = $1`, id).Scan(&ruleJSON) != nil || !ruleJSON.Valid {
+		return nil
+	}
+	var rule models.VersionAutoEnableRule
+	if json.Unmarshal([]byte(ruleJSON.String), &rule) != nil {
+		return nil
+	}
+	constraint, err := build.ParseVersionConstraint(rule.Constraint)
+	if err != nil {
+		return nil
+	}
+	return &autoEnableRule{constraint: constraint, includePrereleases: rule.IncludePrereleases}
+}
+
+// enables reports whether a newly synced version is enabled right away
+func (r *autoEnableRule) enables(version string) bool {
+	if r == nil {
+		return false
+	}
+	release, _, _ := strings.Cut(version, "+")
+	release, pre, _ := strings.Cut(release, "-")
+	if pre != "" {
+		if !r.includePrereleases {
+			return false
+		}
+		version = release
+	}
+	return r.constraint.Matches(version)
+}
+
+// getAutoEnableRule returns the stored rule of a module or provider
+func getAutoEnableRule(c *gin.Context, table, notFound string) {
+	var ruleJSON sql.NullString
+	if err := database.DB.QueryRow(`SELECT auto_enable_rule FROM `+table+` WHERE id = $1`, c.Param("id")).Scan(&ruleJSON); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return
+	}
+	if !ruleJSON.Valid {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No auto-enable rule configured"})
+		return
+	}
+	var rule models.VersionAutoEnableRule
+	json.Unmarshal([]byte(ruleJSON.String), &rule)
+	c.JSON(http.StatusOK, rule)
+}
+
+// setAutoEnableRule validates and stores the rule of a module or provider
+func setAutoEnableRule(c *gin.Context, table, notFound string) {
+	var rule models.VersionAutoEnableRule
+	if !bindJSON(c, &rule) {
+		return
+	}
+	if _, err := build.ParseVersionConstraint(rule.Constraint); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ruleBytes, _ := json.Marshal(rule)
+	result, err := database.DB.Exec(`UPDATE `+table+` SET auto_enable_rule = $1, updated_at = $2 WHERE id = $3`,
+		string(ruleBytes), time.Now(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// deleteAutoEnableRule removes the rule of a module or provider, so synced versions
+// arrive disabled again
+func deleteAutoEnableRule(c *gin.Context, table, notFound string) {
+	result, err := database.DB.Exec(`UPDATE `+table+` SET auto_enable_rule = NULL, updated_at = $1 WHERE id = $2`,
+		time.Now(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Auto-enable rule removed"})
+}
+
+// GetModuleAutoEnableRule returns the rule enabling a module's newly synced versions
+// GET /api/modules/:id/auto-enable
+func GetModuleAutoEnableRule(c *gin.Context) {
+	getAutoEnableRule(c, "modules", "Module not found")
+}
+
+// SetModuleAutoEnableRule sets the rule enabling a module's newly synced versions
+// PUT /api/modules/:id/auto-enable
+func SetModuleAutoEnableRule(c *gin.Context) {
+	setAutoEnableRule(c, "modules", "Module not found")
+}
+
+// DeleteModuleAutoEnableRule removes a module's auto-enable rule
+// DELETE /api/modules/:id/auto-enable
+func DeleteModuleAutoEnableRule(c *gin.Context) {
+	deleteAutoEnableRule(c, "modules", "Module not found")
+}
+
+// GetProviderAutoEnableRule returns the rule enabling a provider's newly synced versions
+// GET /api/providers/:id/auto-enable
+func GetProviderAutoEnableRule(c *gin.Context) {
+	getAutoEnableRule(c, "providers", "Provider not found")
+}
+
+// SetProviderAutoEnableRule sets the rule enabling a provider's newly synced versions
+// PUT /api/providers/:id/auto-enable
+func SetProviderAutoEnableRule(c *gin.Context) {
+	setAutoEnableRule(c, "providers", "Provider not found")
+}
+
+// DeleteProviderAutoEnableRule removes a provider's auto-enable rule
+// DELETE /api/providers/:id/auto-enable
+func DeleteProviderAutoEnableRule(c *gin.Context) {
+	deleteAutoEnableRule(c, "providers", "Provider not found")
+}
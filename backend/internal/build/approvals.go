@@ -0,0 +1,81 @@
+package build
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/notify"
+)
+
+// runExecutionTimeout bounds how long a followed run may take, not counting the time it
+// waits for approval
+const runExecutionTimeout = 2 * time.Hour
+
+// ApprovalReminderBefore is how long before the approval deadline approvers are reminded:
+// APPROVAL_REMINDER_BEFORE (default 1h, 0 disables)
+func ApprovalReminderBefore() time.Duration {
+	if v := os.Getenv("APPROVAL_REMINDER_BEFORE"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return time.Hour
+}
+
+// checkApprovalDeadline returns the approval deadline of a waiting run (zero if it has
+// none) and sends the run.approval_expiring reminder once it is near
+func checkApprovalDeadline(runID string) time.Time {
+	var expiresAt, remindedAt sql.NullTime
+	var deploymentID, deploymentName, namespace, path string
+	err := database.DB.QueryRow(`
+		SELECT r.plan_expires_at, r.approval_reminder_sent_at, d.id, d.name, n.name, r.path
+		FROM deployment_runs r
+		JOIN deployments d ON r.deployment_id = d.id
+		JOIN namespaces n ON d.namespace_id = n.id
+		WHERE r.id = $1
+	`, runID).Scan(&expiresAt, &remindedAt, &deploymentID, &deploymentName, &namespace, &path)
+	if err != nil || !expiresAt.Valid {
+		return time.Time{}
+	}
+
+	before := ApprovalReminderBefore()
+	if before > 0 && !remindedAt.Valid && time.Until(expiresAt.Time) <= before && time.Now().Before(expiresAt.Time) {
+		database.DB.Exec(`UPDATE deployment_runs SET approval_reminder_sent_at = $1 WHERE id = $2`, time.Now(), runID)
+		notify.Send("run.approval_expiring",
+			fmt.Sprintf("Run %s of deployment %s (%s) awaits approval until %s", runID, deploymentName, path, expiresAt.Time.Format(time.RFC3339)),
+			map[string]interface{}{
+				"run_id":        runID,
+				"deployment_id": deploymentID,
+				"deployment":    deploymentName,
+				"namespace":     namespace,
+				"path":          path,
+				"expires_at":    expiresAt.Time,
+			})
+	}
+	return expiresAt.Time
+}
+
+// expireRun ends a run whose plan was not approved in time
+func expireRun(runID, message string) {
+	if message == "" {
+		message = "Approval timed out; re-plan required"
+	}
+	result, err := database.DB.Exec(`
+		UPDATE deployment_runs
+		SET status = 'expired', error_message = $1, completed_at = $2
+		WHERE id = $3 AND completed_at IS NULL
+	`, message, time.Now(), runID)
+	if err != nil {
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return
+	}
+	notify.Send("run.expired", fmt.Sprintf("Run %s expired: %s", runID, message), map[string]interface{}{
+		"run_id": runID,
+		"error":  message,
+	})
+}
@@ -0,0 +1,285 @@
+package build
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"iac-tool/internal/database"
+)
+
+// ArtifactDir returns the directory provider binaries are stored in (BUILD_DIR)
+func ArtifactDir() string {
+	buildDir := os.Getenv("BUILD_DIR")
+	if buildDir == "" {
+		buildDir = "/app/data/builds"
+	}
+	return buildDir
+}
+
+// OrphanedArtifact is a file under BUILD_DIR that no provider platform references
+type OrphanedArtifact struct {
+	Path       string    `json:"path"` // relative to BUILD_DIR
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Removed    bool      `json:"removed"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// MissingArtifact is a provider platform whose locally hosted file does not exist
+type MissingArtifact struct {
+	PlatformID string `json:"platform_id"`
+	ProviderID string `json:"provider_id"`
+	Namespace  string `json:"namespace"`
+	Provider   string `json:"provider"`
+	Version    string `json:"version"`
+	OS         string `json:"os"`
+	Arch       string `json:"arch"`
+	Path       string `json:"path"` // relative to BUILD_DIR
+}
+
+// ArtifactReport is the outcome of reconciling BUILD_DIR against the database
+type ArtifactReport struct {
+	DryRun         bool               `json:"dry_run"`
+	Scanned        int                `json:"scanned"`
+	Orphaned       []OrphanedArtifact `json:"orphaned"`
+	Missing        []MissingArtifact  `json:"missing"`
+	Removed        int                `json:"removed"`
+	ReclaimedBytes int64              `json:"reclaimed_bytes"`
+	SkippedRecent  int                `json:"skipped_recent"`
+
+	// Blob store: files moved into it (or replaced by a link to an identical blob) by this
+	// run, and the space the stored blobs save compared to one copy per artifact path
+	Deduplicated int   `json:"deduplicated"`
+	Blobs        int   `json:"blobs"`
+	BlobBytes    int64 `json:"blob_bytes"`
+	SavedBytes   int64 `json:"saved_bytes"`
+}
+
+// ArtifactGCMinAge is how old an unreferenced file must be before it counts as
+// orphaned, so binaries of builds still being registered are left alone
+func ArtifactGCMinAge() time.Duration {
+	if v := os.Getenv("ARTIFACT_GC_MIN_AGE"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return time.Hour
+}
+
+// CollectArtifacts compares the provider files under buildDir with provider_platforms.
+// Unreferenced files are reported and, unless dryRun is set, deleted along with any
+// directories left empty. Platforms hosted locally whose file is missing are reported.
+// Unless dryRun is set, referenced files not yet in the blob store are moved into it
+// (see StoreArtifact), and blobs no file links to any more are deleted.
+func CollectArtifacts(buildDir string, dryRun bool) (*ArtifactReport, error) {
+	report := &ArtifactReport{DryRun: dryRun, Orphaned: []OrphanedArtifact{}, Missing: []MissingArtifact{}}
+
+	rows, err := database.DB.Query(`
+		SELECT pp.id, p.id, n.name, p.name, v.version, pp.os, pp.arch, pp.filename, pp.download_url
+		FROM provider_platforms pp
+		JOIN provider_versions v ON pp.version_id = v.id
+		JOIN providers p ON v.provider_id = p.id
+		JOIN namespaces n ON p.namespace_id = n.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list provider platforms: %w", err)
+	}
+	defer rows.Close()
+
+	referenced := make(map[string]bool)
+	for rows.Next() {
+		var m MissingArtifact
+		var filename, downloadURL string
+		if err := rows.Scan(&m.PlatformID, &m.ProviderID, &m.Namespace, &m.Provider, &m.Version, &m.OS, &m.Arch, &filename, &downloadURL); err != nil {
+			return nil, err
+		}
+		m.Path = filepath.Join("providers", m.Namespace, m.Provider, m.Version, filename)
+		referenced[m.Path] = true
+
+		// Platforms added by URL may point at external hosts; only local files can go missing
+		if !strings.Contains(downloadURL, "/downloads/providers/") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(buildDir, m.Path)); os.IsNotExist(err) {
+			report.Missing = append(report.Missing, m)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	providersDir := filepath.Join(buildDir, "providers")
+	cutoff := time.Now().Add(-ArtifactGCMinAge())
+	err = filepath.WalkDir(providersDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == providersDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		report.Scanned++
+
+		rel, err := filepath.Rel(buildDir, path)
+		if err != nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if referenced[rel] {
+			if !dryRun && !isBlobLinked(info) {
+				if _, deduped, err := DedupeArtifact(buildDir, path); err == nil && deduped {
+					report.Deduplicated++
+					report.ReclaimedBytes += info.Size()
+				}
+			}
+			return nil
+		}
+		if info.ModTime().After(cutoff) {
+			report.SkippedRecent++
+			return nil
+		}
+
+		orphan := OrphanedArtifact{Path: rel, Size: info.Size(), ModifiedAt: info.ModTime()}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				orphan.Error = err.Error()
+			} else {
+				orphan.Removed = true
+				report.Removed++
+				report.ReclaimedBytes += info.Size()
+			}
+		}
+		report.Orphaned = append(report.Orphaned, orphan)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", providersDir, err)
+	}
+
+	if !dryRun && report.Removed > 0 {
+		removeEmptyDirs(providersDir)
+	}
+
+	if err := collectBlobs(buildDir, cutoff, dryRun, report); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// isBlobLinked reports whether an artifact file is a hard link to a blob rather than a
+// file of its own
+func isBlobLinked(info os.FileInfo) bool {
+	return blobRefs(info) > 0
+}
+
+// collectBlobs adds the blob store to a report, deleting blobs with no references that
+// are older than cutoff unless dryRun is set
+func collectBlobs(buildDir string, cutoff time.Time, dryRun bool, report *ArtifactReport) error {
+	root := blobRoot(buildDir)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		if refs := blobRefs(info); refs > 0 {
+			report.Blobs++
+			report.BlobBytes += info.Size()
+			report.SavedBytes += int64(refs-1) * info.Size()
+			return nil
+		}
+		if info.ModTime().After(cutoff) {
+			report.SkippedRecent++
+			return nil
+		}
+
+		rel, _ := filepath.Rel(buildDir, path)
+		orphan := OrphanedArtifact{Path: rel, Size: info.Size(), ModifiedAt: info.ModTime()}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				orphan.Error = err.Error()
+			} else {
+				orphan.Removed = true
+				report.Removed++
+				report.ReclaimedBytes += info.Size()
+			}
+		}
+		report.Orphaned = append(report.Orphaned, orphan)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+	if !dryRun {
+		removeEmptyDirs(root)
+	}
+	return nil
+}
+
+// removeEmptyDirs deletes empty directories below root, deepest first
+func removeEmptyDirs(root string) {
+	var dirs []string
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() && path != root {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	for i := len(dirs) - 1; i >= 0; i-- {
+		// os.Remove fails on non-empty directories, which is what we want
+		os.Remove(dirs[i])
+	}
+}
+
+// OrphanedBytes sums the sizes of the orphaned artifacts in a report
+func (r *ArtifactReport) OrphanedBytes() int64 {
+	var total int64
+	for _, o := range r.Orphaned {
+		total += o.Size
+	}
+	return total
+}
+
+// NamespaceStorage returns the bytes of provider files stored for a namespace. Files
+// shared with other namespaces through the blob store count for each of them.
+func NamespaceStorage(buildDir, namespace string) (int64, error) {
+	var total int64
+	root := filepath.Join(buildDir, "providers", namespace)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,189 @@
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Provider zips are stored once per content under BUILD_DIR/blobs/sha256/<aa>/<digest>.
+// The paths under BUILD_DIR/providers that the registry serves are hard links to these
+// blobs, so the same zip uploaded to several versions or namespaces takes its space once.
+// A blob's reference count is its link count minus the blob itself; blobs nothing links
+// to any more are removed by ReleaseBlob or the artifact GC.
+
+// blobRoot is the directory holding the content-addressed blobs
+func blobRoot(buildDir string) string {
+	return filepath.Join(buildDir, "blobs", "sha256")
+}
+
+// BlobPath returns where the blob with a SHA256 digest is stored
+func BlobPath(buildDir, digest string) string {
+	return filepath.Join(blobRoot(buildDir), digest[:2], digest)
+}
+
+// ValidDigest reports whether s is a lowercase hex SHA256 digest
+func ValidDigest(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// blobRefs returns how many paths besides the blob itself link to it
+func blobRefs(info os.FileInfo) int {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int(st.Nlink) - 1
+	}
+	return 0
+}
+
+// StoreArtifact writes r to dest through the blob store: the content is stored once under
+// its SHA256 digest and dest becomes a hard link to it. It returns the digest and size.
+func StoreArtifact(buildDir string, r io.Reader, dest string) (string, int64, error) {
+	root := blobRoot(buildDir)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return "", 0, fmt.Errorf("failed to create blob store: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(root, ".upload-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to write artifact: %w", err)
+	}
+	os.Chmod(tmp.Name(), 0644)
+	digest := hex.EncodeToString(hash.Sum(nil))
+
+	if err := adoptBlob(buildDir, digest, tmp.Name(), dest); err != nil {
+		return "", 0, err
+	}
+	return digest, size, nil
+}
+
+// DedupeArtifact moves an existing file under BUILD_DIR into the blob store, or replaces
+// it with a link to an identical blob. It returns the file's digest and whether the file
+// was already stored elsewhere (so its space was reclaimed).
+func DedupeArtifact(buildDir, path string) (string, bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", false, err
+	}
+	digest, err := calculateSHA256(path)
+	if err != nil {
+		return "", false, err
+	}
+
+	blob := BlobPath(buildDir, digest)
+	if blobInfo, err := os.Stat(blob); err == nil {
+		if os.SameFile(info, blobInfo) {
+			return digest, false, nil
+		}
+		if err := linkInto(blob, path); err != nil {
+			return "", false, err
+		}
+		return digest, true, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+		return "", false, fmt.Errorf("failed to create blob store: %w", err)
+	}
+	if err := os.Link(path, blob); err != nil && !os.IsExist(err) {
+		return "", false, fmt.Errorf("failed to store blob: %w", err)
+	}
+	return digest, false, nil
+}
+
+// adoptBlob links dest to the blob for digest, storing the file at src as that blob
+// when there is none yet
+func adoptBlob(buildDir, digest, src, dest string) error {
+	blob := BlobPath(buildDir, digest)
+	if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+		return fmt.Errorf("failed to create blob store: %w", err)
+	}
+
+	if _, err := os.Stat(blob); err == nil {
+		err = linkInto(blob, dest)
+		if err == nil || !os.IsNotExist(err) {
+			return err
+		}
+		// The blob was released between the check and the link; store it again
+	}
+	if err := os.Rename(src, blob); err != nil {
+		return fmt.Errorf("failed to store blob: %w", err)
+	}
+	return linkInto(blob, dest)
+}
+
+// linkInto atomically replaces dest with a hard link to blob, copying it instead when
+// the filesystem does not support hard links
+func linkInto(blob, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	tmp := dest + ".link"
+	os.Remove(tmp)
+	if err := os.Link(blob, tmp); err != nil {
+		if os.IsNotExist(err) {
+			return err
+		}
+		if err := copyFile(blob, tmp); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to link artifact: %w", err)
+		}
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to link artifact: %w", err)
+	}
+	return nil
+}
+
+// copyFile copies src to a new file at dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// ReleaseBlob removes the blob for digest once no artifact links to it any more. Call it
+// after deleting an artifact path.
+func ReleaseBlob(buildDir, digest string) {
+	if !ValidDigest(digest) {
+		return
+	}
+	blob := BlobPath(buildDir, digest)
+	if info, err := os.Stat(blob); err == nil && blobRefs(info) == 0 {
+		os.Remove(blob)
+		os.Remove(filepath.Dir(blob))
+	}
+}
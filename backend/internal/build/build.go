@@ -1,14 +1,17 @@
 package build
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"iac-tool/internal/git"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // Platform represents a target platform for compilation
@@ -24,9 +27,23 @@ type BuildResult struct {
 	FilePath    string
 	SHA256      string
 	DownloadURL string
+	Log         string
+	Command     []string // go command line, with the output path relative
+	Env         []string // Variables set for the go command
+	StartedAt   time.Time
+	Duration    time.Duration
 	Error       error
 }
 
+// reproducibleModTime is the modification time of every packaged binary, so the zip of
+// a rebuild from the same commit with the same toolchain is byte-identical
+var reproducibleModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// String returns the platform in "os/arch" form
+func (p Platform) String() string {
+	return p.OS + "/" + p.Arch
+}
+
 // DefaultPlatforms returns the default platforms to build for
 func DefaultPlatforms() []Platform {
 	return []Platform{
@@ -35,6 +52,9 @@ func DefaultPlatforms() []Platform {
 		{OS: "darwin", Arch: "amd64"},
 		{OS: "darwin", Arch: "arm64"},
 		{OS: "windows", Arch: "amd64"},
+		{OS: "windows", Arch: "arm64"},
+		{OS: "freebsd", Arch: "amd64"},
+		{OS: "freebsd", Arch: "arm64"},
 	}
 }
 
@@ -47,24 +67,8 @@ func BuildProvider(gitURL, version, providerName, namespace, providerID, version
 	}
 	defer os.RemoveAll(tempDir)
 
-	// Clone the repository at the specific tag
-	tag := "v" + version
-	if !strings.HasPrefix(version, "v") {
-		tag = "v" + version
-	} else {
-		tag = version
-	}
-
-	cloneCmd := exec.Command("git", "clone", "--depth", "1", "--branch", tag, gitURL, tempDir)
-	cloneCmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
-	if output, err := cloneCmd.CombinedOutput(); err != nil {
-		// Try without v prefix
-		tag = strings.TrimPrefix(version, "v")
-		cloneCmd = exec.Command("git", "clone", "--depth", "1", "--branch", tag, gitURL, tempDir)
-		cloneCmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
-		if output2, err2 := cloneCmd.CombinedOutput(); err2 != nil {
-			return nil, fmt.Errorf("failed to clone repository: %s / %s", string(output), string(output2))
-		}
+	if _, err := cloneProviderSource(gitURL, version, nil, tempDir); err != nil {
+		return nil, err
 	}
 
 	// Create output directory for binaries
@@ -78,15 +82,37 @@ func BuildProvider(gitURL, version, providerName, namespace, providerID, version
 	results := make([]BuildResult, 0, len(platforms))
 
 	for _, platform := range platforms {
-		result := buildForPlatform(tempDir, outputDir, platform, providerName, version, namespace, versionID, baseURL)
+		var out bytes.Buffer
+		result := buildForPlatform(tempDir, outputDir, platform, providerName, version, namespace, baseURL, "", &out)
+		result.Log = out.String()
 		results = append(results, result)
 	}
 
 	return results, nil
 }
 
-func buildForPlatform(sourceDir, outputDir string, platform Platform, providerName, version, namespace, versionID, baseURL string) BuildResult {
-	result := BuildResult{Platform: platform}
+// cloneProviderSource clones the provider repository at the tag for version,
+// trying the "v"-prefixed tag first. It returns the tag that was checked out.
+func cloneProviderSource(gitURL, version string, auth *git.AuthConfig, destDir string) (string, error) {
+	tag := "v" + strings.TrimPrefix(version, "v")
+	err := git.Clone(gitURL, tag, destDir, auth)
+	if err == nil {
+		return tag, nil
+	}
+
+	// Try without v prefix
+	tag = strings.TrimPrefix(version, "v")
+	if err2 := git.Clone(gitURL, tag, destDir, auth); err2 != nil {
+		return "", fmt.Errorf("failed to clone repository: %v / %v", err, err2)
+	}
+	return tag, nil
+}
+
+// buildForPlatform compiles and packages the provider for one platform with the given
+// Go toolchain (the image's if empty), writing compiler output to out as it is produced
+func buildForPlatform(sourceDir, outputDir string, platform Platform, providerName, version, namespace, baseURL, toolchain string, out io.Writer) (result BuildResult) {
+	result = BuildResult{Platform: platform, StartedAt: time.Now()}
+	defer func() { result.Duration = time.Since(result.StartedAt) }()
 
 	// Determine output filename
 	ext := ""
@@ -98,19 +124,25 @@ func buildForPlatform(sourceDir, outputDir string, platform Platform, providerNa
 	filename := fmt.Sprintf("terraform-provider-%s_%s_%s_%s%s", providerName, version, platform.OS, platform.Arch, ext)
 	outputPath := filepath.Join(outputDir, filename)
 
-	// Build command
-	buildCmd := exec.Command("go", "build", "-o", outputPath, ".")
-	buildCmd.Dir = sourceDir
-	buildCmd.Env = append(os.Environ(),
+	// Build command; -trimpath keeps the temporary checkout path out of the binary
+	result.Env = append([]string{
 		"CGO_ENABLED=0",
 		fmt.Sprintf("GOOS=%s", platform.OS),
 		fmt.Sprintf("GOARCH=%s", platform.Arch),
-	)
+	}, goToolchainEnv(toolchain)...)
+	result.Command = []string{"go", "build", "-trimpath", "-o", filepath.Base(outputPath), "."}
+	buildCmd := exec.Command("go", "build", "-trimpath", "-o", outputPath, ".")
+	buildCmd.Dir = sourceDir
+	buildCmd.Env = append(os.Environ(), result.Env...)
+	buildCmd.Stdout = out
+	buildCmd.Stderr = out
 
-	if output, err := buildCmd.CombinedOutput(); err != nil {
-		result.Error = fmt.Errorf("build failed for %s/%s: %s - %w", platform.OS, platform.Arch, string(output), err)
+	fmt.Fprintf(out, "$ GOOS=%s GOARCH=%s go build -trimpath -o %s .\n", platform.OS, platform.Arch, filepath.Base(outputPath))
+	if err := buildCmd.Run(); err != nil {
+		result.Error = fmt.Errorf("build failed for %s: %w", platform, err)
 		return result
 	}
+	os.Chtimes(outputPath, reproducibleModTime, reproducibleModTime)
 
 	// Create zip file
 	zipFilename := fmt.Sprintf("terraform-provider-%s_%s_%s_%s.zip", providerName, version, platform.OS, platform.Arch)
@@ -135,6 +167,7 @@ func buildForPlatform(sourceDir, outputDir string, platform Platform, providerNa
 	result.FilePath = zipPath
 	result.SHA256 = zipSha
 	result.DownloadURL = fmt.Sprintf("%s/downloads/providers/%s/%s/%s/%s", baseURL, namespace, providerName, version, zipFilename)
+	fmt.Fprintf(out, "Packaged %s (sha256 %s)\n", zipFilename, zipSha)
 
 	return result
 }
@@ -155,8 +188,8 @@ func calculateSHA256(filePath string) (string, error) {
 }
 
 func createZip(sourcePath, nameInZip, zipPath string) error {
-	// Use zip command for simplicity
-	cmd := exec.Command("zip", "-j", zipPath, sourcePath)
+	// Use zip command for simplicity; -X leaves out the owner and extra timestamps
+	cmd := exec.Command("zip", "-j", "-X", zipPath, sourcePath)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("zip command failed: %s - %w", string(output), err)
 	}
@@ -0,0 +1,51 @@
+package build
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/git"
+	"iac-tool/internal/models"
+)
+
+// recordRunCodeChanges stores the files changed between the last successful apply of a
+// run's path and workspace and the commit the run checked out. Runs without such an
+// earlier apply, or with an unknown commit, get no annotation.
+func recordRunCodeChanges(runID, commitSHA string) {
+	var deploymentID, path string
+	var workspace sql.NullString
+	err := database.DB.QueryRow(`SELECT deployment_id, path, terraform_workspace FROM deployment_runs WHERE id = $1`, runID).
+		Scan(&deploymentID, &path, &workspace)
+	if err != nil || commitSHA == "" {
+		return
+	}
+
+	changes := models.RunCodeChanges{CommitSHA: commitSHA, ChangedFiles: []string{}}
+	err = database.DB.QueryRow(`
+		SELECT id, commit_sha FROM deployment_runs
+		WHERE deployment_id = $1 AND path = $2 AND COALESCE(terraform_workspace, '') = $3
+		  AND id <> $4 AND operation = 'apply' AND status = 'success' AND commit_sha IS NOT NULL
+		ORDER BY completed_at DESC
+		LIMIT 1
+	`, deploymentID, path, workspace.String, runID).Scan(&changes.BaseRunID, &changes.BaseCommitSHA)
+	if err != nil {
+		return
+	}
+
+	if changes.BaseCommitSHA != commitSHA {
+		gitURL, auth, err := deploymentRepository(deploymentID)
+		if err == nil {
+			changes.ChangedFiles, err = git.ChangedFiles(gitURL, changes.BaseCommitSHA, commitSHA, auth)
+		}
+		if err != nil {
+			log.Printf("Failed to diff run %s against run %s: %v", runID, changes.BaseRunID, err)
+			changes.ChangedFiles = []string{}
+			changes.Error = err.Error()
+		}
+	}
+
+	changesJSON, _ := json.Marshal(changes)
+	database.DB.Exec(`UPDATE deployment_runs SET code_changes = $1 WHERE id = $2`, string(changesJSON), runID)
+}
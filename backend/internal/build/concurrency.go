@@ -0,0 +1,81 @@
+package build
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+
+	"iac-tool/internal/cluster"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+)
+
+// groupApplyStatuses are the statuses of runs that hold their concurrency group. A run
+// that lost its runner (runner_unreachable) after it was approved holds it too: its apply
+// may still be running there.
+const groupApplyStatuses = `'applying', 'destroying'`
+
+// autoApprover records the approval of runs that would have applied without one but wait
+// for their concurrency group instead
+const autoApprover = "auto-approve"
+
+// concurrencyGroup returns the concurrency group of a deployment's runs in a workspace,
+// "" when they apply independently
+func concurrencyGroup(concurrencyJSON sql.NullString, workspace string) string {
+	if !concurrencyJSON.Valid || concurrencyJSON.String == "" {
+		return ""
+	}
+	var opts models.ConcurrencyOptions
+	if err := json.Unmarshal([]byte(concurrencyJSON.String), &opts); err != nil {
+		return ""
+	}
+	if workspace == "" {
+		workspace = "default"
+	}
+	if group, ok := opts.Workspaces[workspace]; ok {
+		return group
+	}
+	return opts.Group
+}
+
+// startGroupApply marks an approved run as applying unless its concurrency group is
+// busy: another run of the group is applying, or was approved earlier and waits too.
+// It returns false and the run to wait for while the run has to queue.
+func startGroupApply(runID string) (bool, string) {
+	var group sql.NullString
+	database.DB.QueryRow(`SELECT concurrency_group FROM deployment_runs WHERE id = $1`, runID).Scan(&group)
+	if !group.Valid || group.String == "" {
+		database.DB.Exec(`UPDATE deployment_runs SET status = 'applying' WHERE id = $1`, runID)
+		return true, ""
+	}
+
+	// The lock makes checking the group and taking it one step across instances
+	release, ok := cluster.TryLock("concurrency_group:" + group.String)
+	if !ok {
+		return false, ""
+	}
+	defer release()
+
+	var blocker string
+	err := database.DB.QueryRow(`
+		SELECT r.id FROM deployment_runs r
+		WHERE r.concurrency_group = $1 AND r.id <> $2
+		  AND (r.status IN (`+groupApplyStatuses+`)
+		       OR (r.status = 'runner_unreachable' AND r.approved_by IS NOT NULL AND r.approved_by <> 'REJECTED')
+		       OR (r.status = 'awaiting_approval' AND r.approved_by IS NOT NULL AND r.approved_by <> 'REJECTED'
+		           AND (r.apply_not_before IS NULL OR r.apply_not_before <= NOW())
+		           AND r.approved_at < (SELECT approved_at FROM deployment_runs WHERE id = $2)))
+		ORDER BY r.approved_at
+		LIMIT 1
+	`, group.String, runID).Scan(&blocker)
+	if err == nil {
+		return false, blocker
+	}
+	if err != sql.ErrNoRows {
+		log.Printf("Run %s: failed to check concurrency group %s: %v", runID, group.String, err)
+		return false, ""
+	}
+
+	database.DB.Exec(`UPDATE deployment_runs SET status = 'applying' WHERE id = $1`, runID)
+	return true, ""
+}
@@ -0,0 +1,111 @@
+package build
+
+import (
+	"database/sql"
+	"time"
+
+	"iac-tool/internal/crypto"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+)
+
+// envDefaultsSetting is the platform_settings key of the env vars given to every run,
+// stored encrypted like run env vars
+const envDefaultsSetting = "default_env_vars"
+
+// PlatformEnvDefaults returns the env vars given to every run
+func PlatformEnvDefaults() (*models.EnvDefaults, error) {
+	defaults := &models.EnvDefaults{Scope: "platform", EnvVars: map[string]string{}}
+	var value string
+	var updatedAt time.Time
+	err := database.DB.QueryRow(`SELECT value, updated_by, updated_at FROM platform_settings WHERE key = $1`, envDefaultsSetting).
+		Scan(&value, &defaults.UpdatedBy, &updatedAt)
+	if err == sql.ErrNoRows {
+		return defaults, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defaults.UpdatedAt = &updatedAt
+	if defaults.EnvVars, err = crypto.DecryptEnvVars(value); err != nil {
+		return nil, err
+	}
+	return defaults, nil
+}
+
+// SetPlatformEnvDefaults replaces the env vars given to every run
+func SetPlatformEnvDefaults(envVars map[string]string, updatedBy string) error {
+	value, err := crypto.EncryptEnvVars(envVars)
+	if err != nil {
+		return err
+	}
+	_, err = database.DB.Exec(`
+		INSERT INTO platform_settings (key, value, updated_by, updated_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at
+	`, envDefaultsSetting, value, updatedBy, time.Now())
+	return err
+}
+
+// NamespaceEnvDefaults returns the env vars given to the runs of a namespace's deployments;
+// the error is sql.ErrNoRows when the namespace does not exist
+func NamespaceEnvDefaults(namespaceID string) (*models.EnvDefaults, error) {
+	var stored sql.NullString
+	err := database.DB.QueryRow(`SELECT default_env_vars FROM namespaces WHERE id = $1`, namespaceID).Scan(&stored)
+	if err != nil {
+		return nil, err
+	}
+	envVars, err := crypto.DecryptEnvVars(stored.String)
+	if err != nil {
+		return nil, err
+	}
+	return &models.EnvDefaults{Scope: "namespace", NamespaceID: namespaceID, EnvVars: envVars}, nil
+}
+
+// SetNamespaceEnvDefaults replaces the env vars given to the runs of a namespace's
+// deployments; the error is sql.ErrNoRows when the namespace does not exist
+func SetNamespaceEnvDefaults(namespaceID string, envVars map[string]string) error {
+	var value *string
+	if len(envVars) > 0 {
+		encrypted, err := crypto.EncryptEnvVars(envVars)
+		if err != nil {
+			return err
+		}
+		value = &encrypted
+	}
+	result, err := database.DB.Exec(`UPDATE namespaces SET default_env_vars = $1, updated_at = $2 WHERE id = $3`, value, time.Now(), namespaceID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// mergeRunEnv returns the env vars a run is given, each level overriding the ones before:
+// the platform's defaults, its namespace's defaults (stored encrypted), the run's own env
+// vars and the outputs of other deployments it takes as inputs. It also returns where each
+// env var came from, for the run manifest.
+func mergeRunEnv(namespaceDefaults string, runEnv, inputEnv map[string]string) (map[string]string, map[string]string, error) {
+	platform, err := PlatformEnvDefaults()
+	if err != nil {
+		return nil, nil, err
+	}
+	namespace, err := crypto.DecryptEnvVars(namespaceDefaults)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merged := map[string]string{}
+	sources := map[string]string{}
+	for _, level := range []struct {
+		source  string
+		envVars map[string]string
+	}{{"platform", platform.EnvVars}, {"namespace", namespace}, {"run", runEnv}, {"input", inputEnv}} {
+		for name, value := range level.envVars {
+			merged[name] = value
+			sources[name] = level.source
+		}
+	}
+	return merged, sources, nil
+}
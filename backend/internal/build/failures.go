@@ -0,0 +1,179 @@
+package build
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"iac-tool/internal/ansi"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+	"iac-tool/internal/notify"
+)
+
+// failureClass is a kind of run failure recognized by its error output
+type failureClass struct {
+	category string
+	pattern  *regexp.Regexp
+	hint     string
+}
+
+// failureClasses are checked in order; the first match wins. A held lock is checked
+// first because lock errors quote the backend's own (e.g., DynamoDB) error codes.
+var failureClasses = []failureClass{
+	{
+		category: "state_lock",
+		pattern:  regexp.MustCompile(`(?i)error acquiring the state lock|state (is )?locked|lock info:`),
+		hint:     "Another run or a local terraform holds the state lock. Wait for it to finish; if it died, an approver can release the lock shown in state_lock with POST .../force-unlock.",
+	},
+	{
+		category: "provider_auth",
+		pattern:  regexp.MustCompile(`(?i)expiredtoken|token (has )?expired|credentials? (have|has) expired|invalidclienttokenid|unrecognizedclientexception|signaturedoesnotmatch|authfailure|invalid_grant|no valid credential sources|could not find default credentials|aadsts\d+|401 unauthorized`),
+		hint:     "The provider rejected its credentials. Renew the cloud credentials in the run's environment variables or the deployment's secrets and retry.",
+	},
+	{
+		category: "quota_exceeded",
+		pattern:  regexp.MustCompile(`(?i)quota.{0,40}exceeded|exceeded.{0,40}quota|limitexceeded|throttl|rate exceeded|too many requests`),
+		hint:     "The cloud account hit a quota or rate limit. Request a quota increase or free capacity, then retry; rate limits usually clear after a few minutes.",
+	},
+	{
+		category: "syntax_error",
+		pattern:  regexp.MustCompile(`(?i)argument or block definition required|unsupported (argument|block type|attribute)|invalid (expression|block definition|character|reference)|missing required argument|reference to undeclared|unclosed configuration block|error: invalid .* syntax`),
+		hint:     "The configuration does not parse or validate. Run `terraform validate` locally at the run's commit and fix the reported file and line.",
+	},
+	{
+		category: "timeout",
+		pattern:  regexp.MustCompile(`(?i)deployment timeout|context deadline exceeded|timeout while waiting`),
+		hint:     "The run or a resource operation took too long. Check the resource in the cloud console before retrying; it may still be in progress.",
+	},
+}
+
+// exitClasses categorize failures by how the failing command ended, ahead of its output
+var exitClasses = map[string]failureClass{
+	"timeout": {
+		category: "timeout",
+		hint:     "The command ran past the runner's timeout and was killed. Check the resources it was changing in the cloud console before retrying; they may still be in progress.",
+	},
+	"oom_killed": {
+		category: "out_of_memory",
+		hint:     "The command was killed for exceeding the runner's memory limit. Raise RUNNER_SANDBOX_MEMORY, or split the configuration into smaller states, and retry.",
+	},
+}
+
+// ClassifyFailure returns the failure category of a run's error output and a hint on how
+// to fix it, or "other" and no hint for failures it does not recognize
+func ClassifyFailure(output string) (category, hint string) {
+	for _, class := range failureClasses {
+		if class.pattern.MatchString(output) {
+			return class.category, class.hint
+		}
+	}
+	return "other", ""
+}
+
+var (
+	// lockInfoPattern matches a field of the "Lock Info:" block of a state lock error
+	lockInfoPattern = regexp.MustCompile(`^(ID|Path|Operation|Who|Version|Created):\s*(.*)$`)
+)
+
+// ParseStateLock reads the lock held by someone else from terraform's "Error acquiring
+// the state lock" output; it returns nil when the output has no lock ID
+func ParseStateLock(output string) *models.StateLock {
+	output = ansi.Strip(output)
+	var lock *models.StateLock
+	for _, line := range strings.Split(output, "\n") {
+		// Diagnostics are framed with box-drawing characters
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "│"))
+		if line == "Lock Info:" {
+			lock = &models.StateLock{}
+			continue
+		}
+		if lock == nil {
+			continue
+		}
+		m := lockInfoPattern.FindStringSubmatch(line)
+		if m == nil {
+			if lock.ID != "" {
+				break
+			}
+			continue
+		}
+		value := strings.TrimSpace(m[2])
+		switch m[1] {
+		case "ID":
+			lock.ID = value
+		case "Path":
+			lock.Path = value
+		case "Operation":
+			lock.Operation = value
+		case "Who":
+			lock.Who = value
+		case "Version":
+			lock.Version = value
+		case "Created":
+			lock.Created = value
+		}
+	}
+	if lock == nil || lock.ID == "" {
+		return nil
+	}
+	return lock
+}
+
+// classifyRunFailure tags a failed run with its failure category and hint, and sends the
+// run.failed notification, so alerts can be routed by category
+func classifyRunFailure(runID string) {
+	var errorMessage, initLog, planLog, applyLog, hookLog, commandExit sql.NullString
+	var deploymentID, deploymentName, namespace, path string
+	err := database.DB.QueryRow(`
+		SELECT r.error_message, r.init_log, r.plan_log, r.apply_log, r.hook_log, r.command_exit, d.id, d.name, n.name, COALESCE(r.path, '')
+		FROM deployment_runs r
+		JOIN deployments d ON r.deployment_id = d.id
+		JOIN namespaces n ON d.namespace_id = n.id
+		WHERE r.id = $1 AND r.status = 'failed'
+	`, runID).Scan(&errorMessage, &initLog, &planLog, &applyLog, &hookLog, &commandExit, &deploymentID, &deploymentName, &namespace, &path)
+	if err != nil {
+		return
+	}
+
+	// The error message is checked on its own first; it names the failure more reliably
+	// than warnings earlier in the logs
+	logs := OpenArtifact(initLog) + "\n" + OpenArtifact(planLog) + "\n" + OpenArtifact(applyLog) + "\n" + OpenArtifact(hookLog)
+	category, hint := ClassifyFailure(errorMessage.String)
+	if category == "other" {
+		category, hint = ClassifyFailure(logs)
+	}
+	// A command killed for its timeout or memory use is known for certain
+	var exit models.CommandExit
+	if json.Unmarshal([]byte(commandExit.String), &exit) == nil {
+		if class, ok := exitClasses[exit.Reason]; ok {
+			category, hint = class.category, class.hint
+		}
+	}
+
+	// A held lock is recorded so an approver can release it (see force-unlock)
+	var stateLock sql.NullString
+	if category == "state_lock" {
+		if lock := ParseStateLock(errorMessage.String + "\n" + logs); lock != nil {
+			data, _ := json.Marshal(lock)
+			stateLock = sql.NullString{String: string(data), Valid: true}
+		}
+	}
+	database.DB.Exec(`UPDATE deployment_runs SET failure_category = $1, failure_hint = NULLIF($2, ''), state_lock = $3 WHERE id = $4`,
+		category, hint, stateLock, runID)
+
+	notify.Send("run.failed", fmt.Sprintf("Run %s of deployment %s (%s) failed: %s", runID, deploymentName, path, category),
+		map[string]interface{}{
+			"run_id":           runID,
+			"deployment_id":    deploymentID,
+			"deployment":       deploymentName,
+			"namespace":        namespace,
+			"path":             path,
+			"error":            ansi.Strip(errorMessage.String),
+			"failure_category": category,
+			"failure_hint":     hint,
+			"log_tail":         logTail(applyLog.String, planLog.String, initLog.String),
+		})
+}
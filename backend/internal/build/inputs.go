@@ -0,0 +1,207 @@
+package build
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+)
+
+// variableNamePattern matches names terraform accepts for input variables
+var variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// runOutput is one entry of `terraform output -json`
+type runOutput struct {
+	Value     json.RawMessage `json:"value"`
+	Sensitive bool            `json:"sensitive"`
+}
+
+// ResolveRunInputs finds the latest successful apply of every input's deployment (and path)
+// that produced the requested output. The returned inputs are pinned to those runs. Runs of
+// deploymentID may only read deployments in its namespace or its registry_namespaces, and
+// never sensitive outputs.
+func ResolveRunInputs(deploymentID string, inputs []models.RunInput) ([]models.DeploymentRunInput, error) {
+	resolved := make([]models.DeploymentRunInput, 0, len(inputs))
+	if len(inputs) == 0 {
+		return resolved, nil
+	}
+	var namespace string
+	var registryJSON sql.NullString
+	err := database.DB.QueryRow(`
+		SELECT n.name, d.registry_namespaces
+		FROM deployments d
+		JOIN namespaces n ON n.id = d.namespace_id
+		WHERE d.id = $1
+	`, deploymentID).Scan(&namespace, &registryJSON)
+	if err != nil {
+		return nil, err
+	}
+	allowed := []string{namespace}
+	if registryJSON.Valid && registryJSON.String != "" {
+		var extra []string
+		json.Unmarshal([]byte(registryJSON.String), &extra)
+		allowed = append(allowed, extra...)
+	}
+
+	seen := map[string]bool{}
+	for _, input := range inputs {
+		if input.DeploymentID == "" || input.Output == "" {
+			return nil, fmt.Errorf("every input needs a deployment_id and an output")
+		}
+		variable := input.Variable
+		if variable == "" {
+			variable = input.Output
+		}
+		if !variableNamePattern.MatchString(variable) {
+			return nil, fmt.Errorf("input variable %q is not a valid variable name", variable)
+		}
+		if seen[variable] {
+			return nil, fmt.Errorf("input variable %q is set more than once", variable)
+		}
+		seen[variable] = true
+
+		var sourceNamespace string
+		err := database.DB.QueryRow(`
+			SELECT n.name FROM deployments d JOIN namespaces n ON n.id = d.namespace_id WHERE d.id = $1
+		`, input.DeploymentID).Scan(&sourceNamespace)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("input deployment %s not found", input.DeploymentID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(allowed, sourceNamespace) {
+			return nil, fmt.Errorf("deployment %s is in namespace %s, which runs of this deployment may not read (add it to registry_namespaces)",
+				input.DeploymentID, sourceNamespace)
+		}
+
+		query := `
+			SELECT r.id, r.path, r.apply_output, d.name
+			FROM deployment_runs r
+			JOIN deployments d ON d.id = r.deployment_id
+			WHERE r.deployment_id = $1 AND r.operation = 'apply' AND r.status = 'success'
+			  AND r.apply_output IS NOT NULL AND r.apply_output <> ''`
+		args := []interface{}{input.DeploymentID}
+		if input.Path != "" {
+			query += ` AND r.path = $2`
+			args = append(args, input.Path)
+		}
+		query += ` ORDER BY r.completed_at DESC`
+
+		rows, err := database.DB.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for rows.Next() && !found {
+			var runID, path, name string
+			var applyOutput sql.NullString
+			if err := rows.Scan(&runID, &path, &applyOutput, &name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			var outputs map[string]runOutput
+			if json.Unmarshal([]byte(OpenArtifact(applyOutput)), &outputs) != nil {
+				continue
+			}
+			output, ok := outputs[input.Output]
+			if !ok {
+				continue
+			}
+			if output.Sensitive {
+				rows.Close()
+				return nil, fmt.Errorf("output %q of deployment %s is sensitive and cannot be passed to other deployments", input.Output, input.DeploymentID)
+			}
+			resolved = append(resolved, models.DeploymentRunInput{
+				Variable:             variable,
+				SourceDeploymentID:   input.DeploymentID,
+				SourceDeploymentName: name,
+				SourceRunID:          runID,
+				SourcePath:           path,
+				Output:               input.Output,
+				Sensitive:            output.Sensitive,
+			})
+			found = true
+		}
+		rows.Close()
+		if !found {
+			return nil, fmt.Errorf("deployment %s has no successful apply with output %q", input.DeploymentID, input.Output)
+		}
+	}
+	return resolved, nil
+}
+
+// SaveRunInputs records the inputs of a run, which are also the edges of the deployment graph
+func SaveRunInputs(runID string, inputs []models.DeploymentRunInput) error {
+	now := time.Now()
+	for _, input := range inputs {
+		_, err := database.DB.Exec(`
+			INSERT INTO deployment_run_inputs (run_id, variable, source_deployment_id, source_run_id, source_path, output_name, sensitive, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, runID, input.Variable, input.SourceDeploymentID, input.SourceRunID, input.SourcePath, input.Output, input.Sensitive, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyRunInputs gives a run the inputs of the run it was created from, pinned to the same
+// producing runs so a re-plan or destroy sees the values the original run used
+func CopyRunInputs(fromRunID, toRunID string) error {
+	_, err := database.DB.Exec(`
+		INSERT INTO deployment_run_inputs (run_id, variable, source_deployment_id, source_run_id, source_path, output_name, sensitive, created_at)
+		SELECT $1, variable, source_deployment_id, source_run_id, source_path, output_name, sensitive, $2
+		FROM deployment_run_inputs
+		WHERE run_id = $3
+	`, toRunID, time.Now(), fromRunID)
+	return err
+}
+
+// runInputEnv reads the values of a run's inputs from the runs that produced them and
+// returns them as TF_VAR_ environment variables. Strings are passed as is; other values
+// as JSON, which terraform parses for complex variable types.
+func runInputEnv(runID string) (map[string]string, error) {
+	rows, err := database.DB.Query(`
+		SELECT variable, source_run_id, output_name
+		FROM deployment_run_inputs
+		WHERE run_id = $1
+	`, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	env := map[string]string{}
+	for rows.Next() {
+		var variable, sourceRunID, outputName string
+		if err := rows.Scan(&variable, &sourceRunID, &outputName); err != nil {
+			return nil, err
+		}
+
+		var applyOutput sql.NullString
+		if err := database.DB.QueryRow(`SELECT apply_output FROM deployment_runs WHERE id = $1`, sourceRunID).Scan(&applyOutput); err != nil {
+			return nil, fmt.Errorf("input %s: run %s that produced output %q no longer exists", variable, sourceRunID, outputName)
+		}
+		var outputs map[string]runOutput
+		if err := json.Unmarshal([]byte(OpenArtifact(applyOutput)), &outputs); err != nil {
+			return nil, fmt.Errorf("input %s: outputs of run %s cannot be read: %v", variable, sourceRunID, err)
+		}
+		output, ok := outputs[outputName]
+		if !ok {
+			return nil, fmt.Errorf("input %s: run %s has no output %q", variable, sourceRunID, outputName)
+		}
+
+		var value string
+		if json.Unmarshal(output.Value, &value) != nil {
+			value = string(output.Value)
+		}
+		env["TF_VAR_"+variable] = value
+	}
+	return env, rows.Err()
+}
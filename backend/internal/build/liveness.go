@@ -0,0 +1,216 @@
+package build
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/notify"
+)
+
+// unreachablePollInterval is how often a run whose runner stopped answering is polled,
+// instead of every 500ms
+const unreachablePollInterval = 5 * time.Second
+
+// healthTimeout bounds the liveness probe of a runner
+const healthTimeout = 5 * time.Second
+
+// RunnerUnreachableThreshold is how many status polls in a row may fail before a run is
+// marked runner_unreachable: RUNNER_UNREACHABLE_THRESHOLD, default 10 (about 5 seconds)
+func RunnerUnreachableThreshold() int {
+	if v := os.Getenv("RUNNER_UNREACHABLE_THRESHOLD"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 10
+}
+
+// RunRunnerURL returns the runner a run executes on; runs started before runners were
+// recorded are on the default runner
+func RunRunnerURL(runID string) string {
+	var runnerURL sql.NullString
+	database.DB.QueryRow(`SELECT runner_url FROM deployment_runs WHERE id = $1`, runID).Scan(&runnerURL)
+	if runnerURL.String != "" {
+		return runnerURL.String
+	}
+	return RunnerURL()
+}
+
+// workDirRunnerURL returns the runner holding the working directory of a runner
+// deployment, for operations that reuse it
+func workDirRunnerURL(runnerDeploymentID string) string {
+	var runnerURL sql.NullString
+	database.DB.QueryRow(`SELECT runner_url FROM deployment_runs WHERE work_dir = $1 AND runner_url IS NOT NULL LIMIT 1`,
+		runnerDeploymentID).Scan(&runnerURL)
+	if runnerURL.String != "" {
+		return runnerURL.String
+	}
+	return RunnerURL()
+}
+
+// runnerAlive reports whether a runner answers its health check
+func runnerAlive(runnerURL string) bool {
+	client := RunnerClient()
+	client.Timeout = healthTimeout
+	resp, err := client.Get(runnerURL + "/health")
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// cancelOnRunner asks a runner to cancel a runner deployment, without retrying
+func cancelOnRunner(runnerURL, runnerDeploymentID string) error {
+	client := RunnerClient()
+	client.Timeout = healthTimeout
+	resp, err := client.Post(runnerURL+"/deploy/"+runnerDeploymentID+"/cancel", "application/json", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// pickRunner returns the first runner of pool, other than exclude, that answers its
+// health check; empty when there is none. A single runner is not probed: failing to
+// reach it fails the run with the connection error.
+func pickRunner(pool []string, exclude string) string {
+	if len(pool) == 1 && exclude == "" {
+		return pool[0]
+	}
+	for _, runnerURL := range pool {
+		if runnerURL != exclude && runnerAlive(runnerURL) {
+			return runnerURL
+		}
+	}
+	return ""
+}
+
+// assignRunner returns the runner a run starts on: the one it was rescheduled onto, or
+// the first live runner of the pool its namespace may use that has the run's tools
+func assignRunner(runID, tool string, terragrunt *runnerTerragrunt, image string) (string, error) {
+	pool, err := runRunnerPool(runID)
+	if err != nil {
+		return "", err
+	}
+	if pool, err = checkRunnerTools(pool, tool, terragrunt, image); err != nil {
+		return "", err
+	}
+	var assigned sql.NullString
+	database.DB.QueryRow(`SELECT runner_url FROM deployment_runs WHERE id = $1`, runID).Scan(&assigned)
+	if assigned.String != "" && slices.Contains(pool, assigned.String) {
+		return assigned.String, nil
+	}
+	if runnerURL := pickRunner(pool, ""); runnerURL != "" {
+		return runnerURL, nil
+	}
+	// No runner answers; the request to the first eligible runner reports why
+	return pool[0], nil
+}
+
+// markRunnerUnreachable moves a run to runner_unreachable and notifies
+func markRunnerUnreachable(runID, runnerURL string, failures int, err error) {
+	log.Printf("Run %s: runner %s unreachable after %d failed status polls: %v", runID, runnerURL, failures, err)
+	database.DB.Exec(`UPDATE deployment_runs SET status = 'runner_unreachable' WHERE id = $1`, runID)
+	notify.Send("run.runner_unreachable", fmt.Sprintf("Run %s lost contact with runner %s: %v", runID, runnerURL, err), map[string]interface{}{
+		"run_id": runID,
+		"runner": runnerURL,
+		"error":  err.Error(),
+	})
+}
+
+// reschedulableStatuses are the statuses of a run before anything was applied, when it
+// can start over on another runner
+var reschedulableStatuses = map[string]bool{
+	"pending":           true,
+	"initializing":      true,
+	"planning":          true,
+	"awaiting_approval": true,
+}
+
+// rescheduleRun moves a run whose runner died onto another live runner of the pool. Only
+// apply and destroy runs that had not started applying (lastStatus) start over: they plan
+// again from scratch, so an approval of the old plan is discarded. A run the runner had
+// accepted (work_dir set; initializing covers its clone, hooks, init and validate) is only
+// moved when the old runner fails its health check, and the old runner is sent a cancel
+// first, so it cannot go on to apply the same configuration if it comes back. It returns the function that starts the run, to be called once the caller
+// released the run's lease, or nil when the run cannot be rescheduled.
+func rescheduleRun(runID, deadRunner, lastStatus string) func() {
+	if !reschedulableStatuses[lastStatus] {
+		return nil
+	}
+
+	var deploymentID, operation string
+	var path, ref, tool, tfvarsJSON, initFlags, planFlags, workspace, operationArgs, workDir sql.NullString
+	err := database.DB.QueryRow(`
+		SELECT deployment_id, operation, path, ref, tool, tfvars_files, init_flags, plan_flags, terraform_workspace, operation_args, work_dir
+		FROM deployment_runs WHERE id = $1
+	`, runID).Scan(&deploymentID, &operation, &path, &ref, &tool, &tfvarsJSON, &initFlags, &planFlags, &workspace, &operationArgs, &workDir)
+	if err != nil {
+		return nil
+	}
+	// Retries and state operations continue in the dead runner's working directory
+	if (operation != "apply" && operation != "destroy") || operationArgs.Valid {
+		return nil
+	}
+
+	if workDir.String != "" {
+		if runnerAlive(deadRunner) {
+			// Only the status polls fail; the run may still be executing there
+			log.Printf("Run %s: runner %s answers its health check, not rescheduling", runID, deadRunner)
+			return nil
+		}
+		if err := cancelOnRunner(deadRunner, workDir.String); err != nil {
+			log.Printf("Run %s: cancel sent to runner %s before rescheduling failed: %v", runID, deadRunner, err)
+		}
+	}
+
+	pool, err := runRunnerPool(runID)
+	if err != nil {
+		return nil
+	}
+	runnerURL := pickRunner(pool, deadRunner)
+	if runnerURL == "" {
+		return nil
+	}
+
+	result, err := database.DB.Exec(`
+		UPDATE deployment_runs
+		SET status = 'pending', runner_url = $1, work_dir = NULL, started_at = $2, init_log = NULL, plan_log = NULL,
+		    plan_output = NULL, plan_json = NULL, plan_expires_at = NULL, approval_reminder_sent_at = NULL, approved_by = NULL,
+		    approved_at = NULL, apply_log = NULL, apply_output = NULL, hook_log = NULL, error_message = NULL, command_exit = NULL, plain_logs = NULL
+		WHERE id = $3 AND status = 'runner_unreachable'
+	`, runnerURL, time.Now(), runID)
+	if err != nil {
+		log.Printf("Run %s: failed to reschedule: %v", runID, err)
+		return nil
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		// Cancelled meanwhile
+		return nil
+	}
+	database.DB.Exec(`DELETE FROM deployment_run_stages WHERE run_id = $1`, runID)
+
+	log.Printf("Run %s: rescheduled from runner %s onto %s", runID, deadRunner, runnerURL)
+	notify.Send("run.rescheduled", fmt.Sprintf("Run %s was rescheduled from unreachable runner %s onto %s", runID, deadRunner, runnerURL), map[string]interface{}{
+		"run_id":      runID,
+		"from_runner": deadRunner,
+		"to_runner":   runnerURL,
+	})
+
+	var tfvarsFiles []string
+	json.Unmarshal([]byte(tfvarsJSON.String), &tfvarsFiles)
+	return func() {
+		ExecuteDeploymentRun(runID, deploymentID, path.String, ref.String, tool.String, tfvarsFiles,
+			initFlags.String, planFlags.String, workspace.String)
+	}
+}
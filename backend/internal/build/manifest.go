@@ -0,0 +1,179 @@
+package build
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"iac-tool/internal/crypto"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+)
+
+// recordRunManifest stores the manifest of a run about to start on runnerURL with req. The
+// env vars it receives, defaults and inputs included, are stored encrypted in
+// manifest_env_vars so a reproduction does not depend on the producing runs still existing
+// or the defaults staying the same; envSources records where each came from.
+func recordRunManifest(runID, operation, reproducesRunID string, req *RunnerDeploymentRequest, envSources map[string]string, runnerURL string, platformConfig bool) error {
+	manifest := models.RunManifest{
+		RunID:               runID,
+		RecordedAt:          time.Now(),
+		ReproducesRunID:     reproducesRunID,
+		GitURL:              req.GitURL,
+		Ref:                 req.GitRef,
+		CommitSHA:           req.Commit,
+		Path:                req.Path,
+		Workspace:           req.Workspace,
+		Operation:           operation,
+		Tool:                req.Tool,
+		ToolVersion:         req.ToolVersion,
+		Image:               req.Image,
+		InitFlags:           req.InitFlags,
+		PlanFlags:           req.PlanFlags,
+		TfvarsFiles:         req.TfvarsFiles,
+		EnvVars:             make([]string, 0, len(req.EnvVars)),
+		EnvVarSources:       envSources,
+		PreHooks:            manifestHooks(req.PreHooks),
+		PostHooks:           manifestHooks(req.PostHooks),
+		Validate:            req.Validate,
+		PolicyChecks:        manifestHooks(req.PolicyChecks),
+		Clone:               models.CloneOptions{Sparse: req.Sparse, ExtraPaths: req.SparsePaths, Submodules: req.Submodules},
+		PlanValidityMinutes: req.PlanValidity,
+		AutoApprove:         req.AutoApprove,
+		PlatformConfig:      platformConfig,
+		RunnerURL:           runnerURL,
+	}
+	if req.Terragrunt != nil {
+		manifest.Terragrunt = &models.TerragruntOptions{RunAll: req.Terragrunt.RunAll, TFBinary: req.Terragrunt.TFBinary}
+	}
+	if manifest.TfvarsFiles == nil {
+		manifest.TfvarsFiles = []string{}
+	}
+	for name := range req.EnvVars {
+		manifest.EnvVars = append(manifest.EnvVars, name)
+	}
+	sort.Strings(manifest.EnvVars)
+
+	rows, err := database.DB.Query(`SELECT variable, source_run_id, output_name FROM deployment_run_inputs WHERE run_id = $1 ORDER BY variable`, runID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var input models.RunManifestInput
+		if err := rows.Scan(&input.Variable, &input.SourceRunID, &input.Output); err != nil {
+			return err
+		}
+		manifest.Inputs = append(manifest.Inputs, input)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	manifestJSON, _ := json.Marshal(manifest)
+	envVars, err := crypto.EncryptEnvVars(req.EnvVars)
+	if err != nil {
+		return err
+	}
+	_, err = database.DB.Exec(`UPDATE deployment_runs SET run_manifest = $1, manifest_env_vars = $2 WHERE id = $3`,
+		string(manifestJSON), envVars, runID)
+	return err
+}
+
+// completeRunManifest adds what the runner resolved after the clone to a run's manifest:
+// the tool and version, the commit, the tfvars hashes and the runner's hostname
+func completeRunManifest(runID string, status *RunnerDeploymentStatus) {
+	manifest, err := LoadRunManifest(runID)
+	if err != nil || manifest == nil {
+		return
+	}
+	manifest.Tool = status.Tool
+	manifest.ToolVersion = status.ToolVersion
+	if status.CommitSHA != "" {
+		manifest.CommitSHA = status.CommitSHA
+	}
+	manifest.TfvarsSHA256 = status.TfvarsSHA256
+	manifest.Runner = status.Runner
+
+	manifestJSON, _ := json.Marshal(manifest)
+	if _, err := database.DB.Exec(`UPDATE deployment_runs SET run_manifest = $1 WHERE id = $2`, string(manifestJSON), runID); err != nil {
+		log.Printf("Run %s: failed to update manifest: %v", runID, err)
+	}
+}
+
+// LoadRunManifest returns the manifest of a run; nil when the run has not started since
+// manifests are recorded
+func LoadRunManifest(runID string) (*models.RunManifest, error) {
+	var stored sql.NullString
+	if err := database.DB.QueryRow(`SELECT run_manifest FROM deployment_runs WHERE id = $1`, runID).Scan(&stored); err != nil {
+		return nil, err
+	}
+	if stored.String == "" {
+		return nil, nil
+	}
+	var manifest models.RunManifest
+	if err := json.Unmarshal([]byte(stored.String), &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// applyRunManifest makes a runner request replay a recorded manifest instead of the
+// deployment's current settings. Credentials, the registry token and the git allowlist
+// stay current.
+func applyRunManifest(req *RunnerDeploymentRequest, manifest *models.RunManifest, envVars map[string]string) {
+	req.GitURL = manifest.GitURL
+	req.GitRef = manifest.Ref
+	req.Commit = manifest.CommitSHA
+	req.Path = manifest.Path
+	req.Workspace = manifest.Workspace
+	req.Tool = manifest.Tool
+	req.ToolVersion = manifest.ToolVersion
+	req.Terragrunt = nil
+	if manifest.Terragrunt != nil {
+		req.Terragrunt = &runnerTerragrunt{RunAll: manifest.Terragrunt.RunAll, TFBinary: manifest.Terragrunt.TFBinary}
+	}
+	req.Image = manifest.Image
+	req.InitFlags = manifest.InitFlags
+	req.PlanFlags = manifest.PlanFlags
+	req.TfvarsFiles = manifest.TfvarsFiles
+	req.EnvVars = envVars
+	req.PreHooks = runnerHooksOf(manifest.PreHooks)
+	req.PostHooks = runnerHooksOf(manifest.PostHooks)
+	req.Validate = manifest.Validate
+	req.PolicyChecks = runnerHooksOf(manifest.PolicyChecks)
+	req.Sparse = manifest.Clone.Sparse
+	req.SparsePaths = manifest.Clone.ExtraPaths
+	req.Submodules = manifest.Clone.Submodules
+	req.PlanValidity = manifest.PlanValidityMinutes
+	req.AutoApprove = manifest.AutoApprove
+}
+
+// manifestEnvVars returns the env vars a run received, as recorded with its manifest
+func manifestEnvVars(runID string) (map[string]string, error) {
+	var stored sql.NullString
+	if err := database.DB.QueryRow(`SELECT manifest_env_vars FROM deployment_runs WHERE id = $1`, runID).Scan(&stored); err != nil {
+		return nil, err
+	}
+	return crypto.DecryptEnvVars(stored.String)
+}
+
+// manifestHooks converts hooks of a runner request to the API models
+func manifestHooks(hooks []RunnerHook) []models.RunHook {
+	converted := make([]models.RunHook, len(hooks))
+	for i, h := range hooks {
+		converted[i] = models.RunHook{Name: h.Name, Command: h.Command, Timeout: h.Timeout, OnFailure: h.OnFailure}
+	}
+	return converted
+}
+
+// runnerHooksOf converts hooks of the API models to the runner's
+func runnerHooksOf(hooks []models.RunHook) []RunnerHook {
+	converted := make([]RunnerHook, len(hooks))
+	for i, h := range hooks {
+		converted[i] = RunnerHook{Name: h.Name, Command: h.Command, Timeout: h.Timeout, OnFailure: h.OnFailure}
+	}
+	return converted
+}
@@ -0,0 +1,88 @@
+package build
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"iac-tool/internal/database"
+)
+
+// ExecuteRunOperation starts a follow-up operation (e.g., "import", "state/mv") on the runner,
+// reusing the working directory of the runner deployment sourceRunnerID, and tracks it like a run
+func ExecuteRunOperation(runID, sourceRunnerID, runnerPath string, payload interface{}) {
+	executeRunOperation(runID, sourceRunnerID, runnerPath, payload, 0)
+}
+
+// RetryRun resumes the runner deployment sourceRunnerID from a stage (the failed one
+// if fromStage is empty) and tracks the retry as the run runID. The retry may plan
+// again, so it may await approval for the deployment's plan validity.
+func RetryRun(runID, deploymentID, sourceRunnerID, fromStage string) {
+	var planValidity sql.NullString
+	database.DB.QueryRow(`SELECT plan_validity FROM deployments WHERE id = $1`, deploymentID).Scan(&planValidity)
+	validity := PlanValidity(planValidity.String)
+
+	payload := map[string]interface{}{
+		"from_stage":    fromStage,
+		"plan_validity": int((validity + time.Minute - 1) / time.Minute),
+	}
+	executeRunOperation(runID, sourceRunnerID, "retry", payload, validity)
+}
+
+func executeRunOperation(runID, sourceRunnerID, runnerPath string, payload interface{}, planValidity time.Duration) {
+	now := time.Now()
+	database.DB.Exec(`
+UPDATE deployment_runs
+SET status = 'initializing', started_at = $1
+WHERE id = $2
+`, now, runID)
+
+	// The source run's registry token may have expired, so the operation gets its own
+	registryToken, err := runRegistryToken(runID, planValidity)
+	if err != nil {
+		failRun(runID, "Failed to issue registry token: "+err.Error())
+		return
+	}
+
+	// The operation runs where the source run's working directory is, which must still be a
+	// runner the namespace may use
+	runnerURL := workDirRunnerURL(sourceRunnerID)
+	pool, err := runRunnerPool(runID)
+	if err != nil {
+		failRun(runID, "Failed to assign a runner: "+err.Error())
+		return
+	}
+	if !slices.Contains(pool, runnerURL) {
+		failRun(runID, fmt.Sprintf("The working directory is on runner %s, which the namespace may no longer use; start a new run", runnerURL))
+		return
+	}
+
+	reqBody, _ := json.Marshal(payload)
+	resp, err := runnerPost(fmt.Sprintf("%s/deploy/%s/%s", runnerURL, sourceRunnerID, runnerPath), reqBody,
+		http.Header{"X-Registry-Token": {registryToken}})
+	if err != nil {
+		failRun(runID, "Failed to contact runner: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 202 {
+		body, _ := io.ReadAll(resp.Body)
+		failRun(runID, fmt.Sprintf("Runner returned error: %s", string(body)))
+		return
+	}
+
+	var deployResp RunnerDeploymentResponse
+	if err := json.NewDecoder(resp.Body).Decode(&deployResp); err != nil {
+		failRun(runID, "Failed to parse runner response: "+err.Error())
+		return
+	}
+
+	database.DB.Exec(`UPDATE deployment_runs SET work_dir = $1, runner_url = $2 WHERE id = $3`, deployResp.DeploymentID, runnerURL, runID)
+
+	pollRunnerStatus(runID, deployResp.DeploymentID, runnerURL, planValidity)
+}
@@ -0,0 +1,63 @@
+package build
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+)
+
+// LatestOutputs returns the non-sensitive outputs of the latest successful apply of
+// every path of a deployment (or only of path, if given). Paths whose latest successful
+// run destroyed the infrastructure have no outputs and are left out.
+func LatestOutputs(deploymentID, path string) ([]models.DeploymentOutputs, error) {
+	query := `
+		SELECT DISTINCT ON (path) id, path, operation, commit_sha, apply_output, completed_at
+		FROM deployment_runs
+		WHERE deployment_id = $1 AND status = 'success' AND operation IN ('apply', 'destroy')
+		  AND completed_at IS NOT NULL`
+	args := []interface{}{deploymentID}
+	if path != "" {
+		query += ` AND path = $2`
+		args = append(args, path)
+	}
+	query += ` ORDER BY path, completed_at DESC`
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []models.DeploymentOutputs{}
+	for rows.Next() {
+		var o models.DeploymentOutputs
+		var operation string
+		var applyOutput sql.NullString
+		if err := rows.Scan(&o.RunID, &o.Path, &operation, &o.CommitSHA, &applyOutput, &o.AppliedAt); err != nil {
+			return nil, err
+		}
+		if operation == "destroy" {
+			continue
+		}
+
+		var outputs map[string]runOutput
+		if applyOutput.Valid && applyOutput.String != "" {
+			json.Unmarshal([]byte(OpenArtifact(applyOutput)), &outputs)
+		}
+		o.Outputs = make(map[string]json.RawMessage, len(outputs))
+		o.SensitiveOutputs = []string{}
+		for name, output := range outputs {
+			if output.Sensitive {
+				o.SensitiveOutputs = append(o.SensitiveOutputs, name)
+				continue
+			}
+			o.Outputs[name] = output.Value
+		}
+		sort.Strings(o.SensitiveOutputs)
+		result = append(result, o)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,152 @@
+package build
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"iac-tool/internal/crypto"
+	"iac-tool/internal/database"
+	"iac-tool/internal/git"
+	"iac-tool/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PlatformConfigFile is the run configuration read from the root of a deployment's repository
+const PlatformConfigFile = "platform.yaml"
+
+var platformImagePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/:@-]{0,254}$`)
+
+var toolVersionPattern = regexp.MustCompile(`^v?\d+(\.\d+){0,2}(-[0-9A-Za-z.]+)?$`)
+
+// ParsePlatformConfig parses and checks a platform.yaml; unknown keys are errors so
+// typos do not silently drop settings
+func ParsePlatformConfig(content string) (*models.PlatformConfig, error) {
+	var config models.PlatformConfig
+	decoder := yaml.NewDecoder(strings.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid %s: %v", PlatformConfigFile, err)
+	}
+
+	switch config.Tool {
+	case "", "terraform", "tofu", "terragrunt", "auto":
+	default:
+		return nil, fmt.Errorf("%s: tool must be terraform, tofu, terragrunt or auto", PlatformConfigFile)
+	}
+	if config.ToolVersion != "" && !toolVersionPattern.MatchString(config.ToolVersion) {
+		return nil, fmt.Errorf("%s: tool_version must be a version such as 1.9.5", PlatformConfigFile)
+	}
+	if config.RunnerImage != "" && !platformImagePattern.MatchString(config.RunnerImage) {
+		return nil, fmt.Errorf("%s: invalid runner_image reference", PlatformConfigFile)
+	}
+	for _, f := range config.VarFiles {
+		if f == "" || strings.HasPrefix(f, "/") || strings.Contains(f, "..") {
+			return nil, fmt.Errorf("%s: var_files must be relative to the run path", PlatformConfigFile)
+		}
+	}
+	if v := config.Apply.PlanValidity; v != "" {
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			return nil, fmt.Errorf("%s: apply.plan_validity must be a positive duration (e.g., 24h)", PlatformConfigFile)
+		}
+	}
+	hooks := append(append(append([]models.RunHook{}, config.Hooks.PreInit...), config.Hooks.PostApply...), config.Apply.PolicyChecks...)
+	for _, hook := range hooks {
+		if strings.TrimSpace(hook.Command) == "" {
+			return nil, fmt.Errorf("%s: hook command is required", PlatformConfigFile)
+		}
+		if hook.OnFailure != "" && hook.OnFailure != "fail" && hook.OnFailure != "warn" {
+			return nil, fmt.Errorf("%s: hook on_failure must be 'fail' or 'warn'", PlatformConfigFile)
+		}
+		if hook.Timeout < 0 {
+			return nil, fmt.Errorf("%s: hook timeout must be a positive number of seconds", PlatformConfigFile)
+		}
+	}
+	return &config, nil
+}
+
+// LoadPlatformConfig reads the platform.yaml of a deployment's repository at ref (a
+// branch, tag or commit). It returns nil without error when the repository has none.
+func LoadPlatformConfig(deploymentID, ref string) (*models.PlatformConfig, error) {
+	gitURL, auth, err := deploymentRepository(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := git.FileAtCommit(gitURL, ref, PlatformConfigFile, auth)
+	if errors.Is(err, git.ErrFileNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", PlatformConfigFile, err)
+	}
+	return ParsePlatformConfig(content)
+}
+
+// DefaultBranchRef is the ref LoadPlatformConfig reads the default branch of a repository at
+const DefaultBranchRef = "HEAD"
+
+// RestrictPlatformConfig drops what the platform.yaml read at a run's ref may not decide,
+// since anyone able to push a branch controls that file:
+//   - apply.auto_approve only holds when the platform.yaml on the repository's default branch
+//     also sets it, so a branch cannot lift the approval requirement
+//   - runner_image and tool_version are ignored when the deployment has its own
+//     runner_image, which pins the tool versions
+//
+// Dropped settings are logged with the run.
+func RestrictPlatformConfig(runID, deploymentID, deploymentImage string, config *models.PlatformConfig) {
+	if config.Apply.AutoApprove {
+		trusted, err := LoadPlatformConfig(deploymentID, DefaultBranchRef)
+		if err != nil || trusted == nil || !trusted.Apply.AutoApprove {
+			log.Printf("Run %s: ignoring apply.auto_approve in %s, the default branch's %s does not set it",
+				runID, PlatformConfigFile, PlatformConfigFile)
+			config.Apply.AutoApprove = false
+		}
+	}
+	if deploymentImage != "" && (config.RunnerImage != "" || config.ToolVersion != "") {
+		log.Printf("Run %s: ignoring runner_image and tool_version in %s, the deployment's runner_image %s takes precedence",
+			runID, PlatformConfigFile, deploymentImage)
+		config.RunnerImage, config.ToolVersion = "", ""
+	}
+}
+
+// deploymentRepository returns the repository URL of a deployment and the credentials
+// to read it with
+func deploymentRepository(deploymentID string) (string, *git.AuthConfig, error) {
+	var gitURL string
+	var authType, authData sql.NullString
+	err := database.DB.QueryRow(`SELECT git_url, git_auth_type, git_auth_data FROM deployments WHERE id = $1`, deploymentID).
+		Scan(&gitURL, &authType, &authData)
+	if err != nil {
+		return "", nil, err
+	}
+	var auth *git.AuthConfig
+	if authType.Valid && authData.Valid {
+		if decryptedData, err := crypto.DecryptJSON(authData.String); err == nil {
+			var authJSON map[string]string
+			if err := json.Unmarshal([]byte(decryptedData), &authJSON); err == nil {
+				auth = &git.AuthConfig{Type: authType.String, Username: authJSON["username"], Password: authJSON["password"]}
+			}
+		}
+	}
+	return gitURL, auth, nil
+}
+
+// applyPlatformConfig adds the hooks, policy checks and apply policy of a repository's
+// platform.yaml to a runner request. Hooks and policy checks run after the deployment's
+// own, which the file cannot remove.
+func applyPlatformConfig(req *RunnerDeploymentRequest, config *models.PlatformConfig) {
+	req.PreHooks = append(req.PreHooks, runnerHooksOf(config.Hooks.PreInit)...)
+	req.PostHooks = append(req.PostHooks, runnerHooksOf(config.Hooks.PostApply)...)
+	req.PolicyChecks = append(req.PolicyChecks, runnerHooksOf(config.Apply.PolicyChecks)...)
+	req.Validate = req.Validate || config.Apply.Validate
+	req.AutoApprove = config.Apply.AutoApprove && !req.Destroy
+	req.ToolVersion = config.ToolVersion
+}
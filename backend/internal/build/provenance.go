@@ -0,0 +1,123 @@
+package build
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"iac-tool/internal/gpg"
+)
+
+// provenanceBuildType identifies how the registry builds providers; the parameters
+// below are only meaningful together with it
+const provenanceBuildType = "urn:iac-tool:provider-build:v1"
+
+// ProvenanceStatement is an in-toto statement carrying the SLSA v1 provenance of one
+// built artifact
+type ProvenanceStatement struct {
+	Type          string              `json:"_type"`
+	Subject       []ProvenanceSubject `json:"subject"`
+	PredicateType string              `json:"predicateType"`
+	Predicate     SLSAProvenance      `json:"predicate"`
+}
+
+// ProvenanceSubject is an artifact the provenance is about
+type ProvenanceSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// SLSAProvenance describes how an artifact was built and by whom
+type SLSAProvenance struct {
+	BuildDefinition struct {
+		BuildType            string                 `json:"buildType"`
+		ExternalParameters   map[string]interface{} `json:"externalParameters"`
+		InternalParameters   map[string]interface{} `json:"internalParameters"`
+		ResolvedDependencies []ProvenanceSubject    `json:"resolvedDependencies"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID      string            `json:"id"`
+			Version map[string]string `json:"version"`
+		} `json:"builder"`
+		Metadata struct {
+			InvocationID string    `json:"invocationId"`
+			StartedOn    time.Time `json:"startedOn"`
+			FinishedOn   time.Time `json:"finishedOn"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+// SignBuildProvenance reports whether provenance documents are signed with the registry's
+// GPG key: BUILD_PROVENANCE_SIGNING=true
+func SignBuildProvenance() bool {
+	return os.Getenv("BUILD_PROVENANCE_SIGNING") == "true"
+}
+
+// builderVersion is the commit the backend was built from, as stamped by the go command
+func builderVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+		if info.Main.Version != "" {
+			return info.Main.Version
+		}
+	}
+	return "devel"
+}
+
+// buildProvenance returns the provenance statement of a built platform and, when
+// signing is enabled, its base64 detached GPG signature. The statement is returned as
+// the exact bytes that were signed.
+func buildProvenance(src *providerSource, tag, commit, toolchain, buildID, baseURL string, result BuildResult) (json.RawMessage, string, error) {
+	var statement ProvenanceStatement
+	statement.Type = "https://in-toto.io/Statement/v1"
+	statement.PredicateType = "https://slsa.dev/provenance/v1"
+	statement.Subject = []ProvenanceSubject{{Name: result.Filename, Digest: map[string]string{"sha256": result.SHA256}}}
+
+	definition := &statement.Predicate.BuildDefinition
+	definition.BuildType = provenanceBuildType
+	definition.ExternalParameters = map[string]interface{}{
+		"source":   map[string]string{"uri": src.GitURL, "tag": tag},
+		"provider": fmt.Sprintf("%s/%s", src.Namespace, src.Name),
+		"version":  src.Version,
+		"platform": result.Platform.String(),
+	}
+	definition.InternalParameters = map[string]interface{}{
+		"go_version": toolchain,
+		"command":    result.Command,
+		"env":        result.Env,
+	}
+	definition.ResolvedDependencies = []ProvenanceSubject{{
+		Name:   "git+" + strings.TrimSuffix(src.GitURL, ".git") + "@refs/tags/" + tag,
+		Digest: map[string]string{"gitCommit": commit},
+	}}
+
+	run := &statement.Predicate.RunDetails
+	run.Builder.ID = baseURL
+	run.Builder.Version = map[string]string{"iac-tool": builderVersion(), "go": runtime.Version()}
+	run.Metadata.InvocationID = buildID
+	run.Metadata.StartedOn = result.StartedAt.UTC()
+	run.Metadata.FinishedOn = result.StartedAt.Add(result.Duration).UTC()
+
+	document, err := json.Marshal(statement)
+	if err != nil {
+		return nil, "", err
+	}
+	if !SignBuildProvenance() {
+		return document, "", nil
+	}
+	signature, err := gpg.Sign(string(document))
+	if err != nil {
+		return document, "", fmt.Errorf("failed to sign provenance: %w", err)
+	}
+	return document, base64.StdEncoding.EncodeToString(signature), nil
+}
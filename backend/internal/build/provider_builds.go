@@ -0,0 +1,388 @@
+package build
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"iac-tool/internal/cache"
+	"iac-tool/internal/crypto"
+	"iac-tool/internal/database"
+	"iac-tool/internal/git"
+	"iac-tool/internal/models"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BuildLogLine is a single line of provider build output
+type BuildLogLine struct {
+	Platform string `json:"platform,omitempty"` // "os/arch", empty for clone/setup output
+	Line     string `json:"line"`
+}
+
+// activeBuild holds the output of a build running in this process so that
+// late subscribers can catch up before following new lines
+type activeBuild struct {
+	mu     sync.Mutex
+	buffer []BuildLogLine
+	subs   map[chan BuildLogLine]struct{}
+}
+
+var (
+	activeBuilds   = make(map[string]*activeBuild)
+	activeBuildsMu sync.Mutex
+)
+
+// SubscribeProviderBuild returns the output logged so far by a build running in
+// this process and a channel that receives new lines. The channel is closed when
+// the build finishes. ok is false if the build is not running here.
+func SubscribeProviderBuild(buildID string) (backlog []BuildLogLine, lines <-chan BuildLogLine, unsubscribe func(), ok bool) {
+	activeBuildsMu.Lock()
+	b, exists := activeBuilds[buildID]
+	activeBuildsMu.Unlock()
+	if !exists {
+		return nil, nil, nil, false
+	}
+
+	ch := make(chan BuildLogLine, 256)
+	b.mu.Lock()
+	backlog = make([]BuildLogLine, len(b.buffer))
+	copy(backlog, b.buffer)
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	unsubscribe = func() {
+		b.mu.Lock()
+		if _, subscribed := b.subs[ch]; subscribed {
+			delete(b.subs, ch)
+			close(ch)
+		}
+		b.mu.Unlock()
+	}
+	return backlog, ch, unsubscribe, true
+}
+
+// IsProviderBuildActive reports whether a build is currently running in this process
+func IsProviderBuildActive(buildID string) bool {
+	activeBuildsMu.Lock()
+	defer activeBuildsMu.Unlock()
+	_, exists := activeBuilds[buildID]
+	return exists
+}
+
+func (b *activeBuild) publish(platform, line string) {
+	entry := BuildLogLine{Platform: platform, Line: line}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buffer = append(b.buffer, entry)
+	for ch := range b.subs {
+		select {
+		case ch <- entry:
+		default:
+			// Slow subscriber, drop the line rather than stall the build
+		}
+	}
+}
+
+func (b *activeBuild) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		close(ch)
+		delete(b.subs, ch)
+	}
+}
+
+// lineWriter splits written output into lines and hands each one to onLine
+type lineWriter struct {
+	buf    []byte
+	onLine func(string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.onLine(strings.TrimRight(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush emits any trailing output that was not newline-terminated
+func (w *lineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.onLine(string(w.buf))
+		w.buf = nil
+	}
+}
+
+// providerSource is what a build needs to know about the provider being built
+type providerSource struct {
+	ProviderID string
+	VersionID  string
+	Name       string
+	Namespace  string
+	Version    string
+	GitURL     string
+	Auth       *git.AuthConfig
+}
+
+func loadProviderSource(providerID, versionID string) (*providerSource, error) {
+	src := &providerSource{ProviderID: providerID, VersionID: versionID}
+	var sourceURL, authType, authData sql.NullString
+	err := database.DB.QueryRow(`
+		SELECT p.name, n.name, p.source_url, p.git_auth_type, p.git_auth_data, v.version
+		FROM providers p
+		JOIN namespaces n ON p.namespace_id = n.id
+		JOIN provider_versions v ON v.provider_id = p.id
+		WHERE p.id = $1 AND v.id = $2
+	`, providerID, versionID).Scan(&src.Name, &src.Namespace, &sourceURL, &authType, &authData, &src.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load provider: %w", err)
+	}
+	if !sourceURL.Valid || sourceURL.String == "" {
+		return nil, fmt.Errorf("provider has no Git source URL")
+	}
+	src.GitURL = sourceURL.String
+
+	if authType.Valid && authData.Valid {
+		decryptedData, err := crypto.DecryptJSON(authData.String)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt authentication data: %w", err)
+		}
+		var authJSON map[string]string
+		if err := json.Unmarshal([]byte(decryptedData), &authJSON); err == nil {
+			src.Auth = &git.AuthConfig{
+				Type:     authType.String,
+				Username: authJSON["username"],
+				Password: authJSON["password"],
+			}
+		}
+	}
+	return src, nil
+}
+
+// StartProviderBuild compiles the given platforms of a provider build in the
+// background, streaming output to subscribers and recording per-platform results
+// in provider_builds. Successfully built platforms are registered in
+// provider_platforms. The build is subscribable as soon as this returns.
+func StartProviderBuild(buildID, baseURL, buildDir string, platforms []Platform) {
+	b := &activeBuild{subs: make(map[chan BuildLogLine]struct{})}
+	activeBuildsMu.Lock()
+	activeBuilds[buildID] = b
+	activeBuildsMu.Unlock()
+
+	go runProviderBuild(b, buildID, baseURL, buildDir, platforms)
+}
+
+func runProviderBuild(b *activeBuild, buildID, baseURL, buildDir string, platforms []Platform) {
+	defer func() {
+		activeBuildsMu.Lock()
+		delete(activeBuilds, buildID)
+		activeBuildsMu.Unlock()
+		b.close()
+	}()
+
+	var providerID, versionID string
+	var platformsJSON, previousLog, goVersion sql.NullString
+	err := database.DB.QueryRow(`
+		SELECT provider_id, version_id, platforms, log, go_version FROM provider_builds WHERE id = $1
+	`, buildID).Scan(&providerID, &versionID, &platformsJSON, &previousLog, &goVersion)
+	if err != nil {
+		log.Printf("Provider build %s not found: %v", buildID, err)
+		return
+	}
+
+	var records []models.ProviderBuildPlatform
+	if platformsJSON.Valid {
+		json.Unmarshal([]byte(platformsJSON.String), &records)
+	}
+	indexOf := func(p Platform) int {
+		for i, r := range records {
+			if r.OS == p.OS && r.Arch == p.Arch {
+				return i
+			}
+		}
+		records = append(records, models.ProviderBuildPlatform{OS: p.OS, Arch: p.Arch})
+		return len(records) - 1
+	}
+	for _, p := range platforms {
+		i := indexOf(p)
+		records[i].Status = "pending"
+		records[i].Log = ""
+		records[i].Error = ""
+		records[i].DurationSeconds = 0
+		records[i].GoVersion = ""
+		records[i].Provenance = nil
+		records[i].ProvenanceSignature = ""
+	}
+
+	// Setup output accumulates across retries so the clone of each attempt is kept
+	var setupLog strings.Builder
+	if previousLog.Valid && previousLog.String != "" {
+		setupLog.WriteString(previousLog.String)
+	}
+	logf := func(format string, args ...interface{}) {
+		line := fmt.Sprintf(format, args...)
+		setupLog.WriteString(line + "\n")
+		b.publish("", line)
+	}
+
+	platformsData, _ := json.Marshal(records)
+	database.DB.Exec(`
+		UPDATE provider_builds SET status = 'running', platforms = $1, error = NULL, started_at = $2, finished_at = NULL
+		WHERE id = $3
+	`, string(platformsData), time.Now(), buildID)
+
+	fail := func(err error) {
+		logf("Error: %v", err)
+		for _, p := range platforms {
+			i := indexOf(p)
+			records[i].Status = "failed"
+			records[i].Error = err.Error()
+		}
+		platformsData, _ := json.Marshal(records)
+		database.DB.Exec(`
+			UPDATE provider_builds SET status = 'failed', platforms = $1, log = $2, error = $3, finished_at = $4
+			WHERE id = $5
+		`, string(platformsData), setupLog.String(), err.Error(), time.Now(), buildID)
+		log.Printf("Provider build %s failed: %v", buildID, err)
+	}
+
+	src, err := loadProviderSource(providerID, versionID)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	tempDir, err := os.MkdirTemp("", "provider-build-*")
+	if err != nil {
+		fail(fmt.Errorf("failed to create temp dir: %w", err))
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	logf("Cloning %s (version %s)", src.GitURL, src.Version)
+	tag, err := cloneProviderSource(src.GitURL, src.Version, src.Auth, tempDir)
+	if err != nil {
+		fail(err)
+		return
+	}
+	commit, err := git.HeadCommit(tempDir)
+	if err != nil {
+		fail(err)
+		return
+	}
+	logf("Checked out tag %s (commit %s)", tag, commit)
+
+	// The toolchain is pinned so retries of the build compile with the same one
+	if goVersion.String != "" {
+		logf("Setting up Go toolchain %s", goVersion.String)
+	}
+	toolchain, err := resolveGoToolchain(tempDir, goVersion.String)
+	if err != nil {
+		fail(err)
+		return
+	}
+	logf("Using Go toolchain %s", toolchain)
+	database.DB.Exec(`UPDATE provider_builds SET go_version = $1 WHERE id = $2`, toolchain, buildID)
+
+	outputDir := filepath.Join(buildDir, "providers", src.Namespace, src.Name, src.Version)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		fail(fmt.Errorf("failed to create output dir: %w", err))
+		return
+	}
+
+	for _, p := range platforms {
+		i := indexOf(p)
+		records[i].Status = "running"
+		saveBuildPlatforms(buildID, records)
+
+		var out strings.Builder
+		w := &lineWriter{onLine: func(line string) {
+			out.WriteString(line + "\n")
+			b.publish(p.String(), line)
+		}}
+		result := buildForPlatform(tempDir, outputDir, p, src.Name, src.Version, src.Namespace, baseURL, toolchain, w)
+		w.Flush()
+
+		records[i].Log = out.String()
+		records[i].DurationSeconds = result.Duration.Seconds()
+		if result.Error == nil {
+			if err := registerBuiltPlatform(src, result); err != nil {
+				result.Error = fmt.Errorf("failed to register platform: %w", err)
+			}
+		}
+		if result.Error != nil {
+			records[i].Status = "failed"
+			records[i].Error = result.Error.Error()
+			b.publish(p.String(), "Error: "+result.Error.Error())
+		} else {
+			records[i].Status = "success"
+			records[i].Filename = result.Filename
+			records[i].SHASum = result.SHA256
+			records[i].GoVersion = toolchain
+			provenance, signature, err := buildProvenance(src, tag, commit, toolchain, buildID, baseURL, result)
+			if err != nil {
+				b.publish(p.String(), "Warning: "+err.Error())
+			}
+			records[i].Provenance = provenance
+			records[i].ProvenanceSignature = signature
+		}
+		saveBuildPlatforms(buildID, records)
+	}
+
+	succeeded, failed := 0, 0
+	for _, r := range records {
+		switch r.Status {
+		case "success":
+			succeeded++
+		case "failed":
+			failed++
+		}
+	}
+	status := "partial"
+	if failed == 0 {
+		status = "success"
+	} else if succeeded == 0 {
+		status = "failed"
+	}
+	logf("Build finished: %d succeeded, %d failed", succeeded, failed)
+
+	platformsData, _ = json.Marshal(records)
+	database.DB.Exec(`
+		UPDATE provider_builds SET status = $1, platforms = $2, log = $3, finished_at = $4
+		WHERE id = $5
+	`, status, string(platformsData), setupLog.String(), time.Now(), buildID)
+	database.DB.Exec("UPDATE providers SET updated_at = $1 WHERE id = $2", time.Now(), providerID)
+	cache.Registry.InvalidateOwner(providerID)
+	database.MarkWritten(providerID)
+
+	log.Printf("Provider build %s finished with status %s", buildID, status)
+}
+
+func saveBuildPlatforms(buildID string, records []models.ProviderBuildPlatform) {
+	platformsData, _ := json.Marshal(records)
+	database.DB.Exec("UPDATE provider_builds SET platforms = $1 WHERE id = $2", string(platformsData), buildID)
+}
+
+// registerBuiltPlatform creates or replaces the provider_platforms row for a built binary
+func registerBuiltPlatform(src *providerSource, result BuildResult) error {
+	_, err := database.DB.Exec(`
+		INSERT INTO provider_platforms (id, version_id, os, arch, filename, download_url, shasum)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (version_id, os, arch) DO UPDATE
+		SET filename = EXCLUDED.filename, download_url = EXCLUDED.download_url, shasum = EXCLUDED.shasum
+	`, uuid.New().String(), src.VersionID, result.Platform.OS, result.Platform.Arch, result.Filename, result.DownloadURL, result.SHA256)
+	return err
+}
@@ -0,0 +1,697 @@
+package build
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"iac-tool/internal/cache"
+	"iac-tool/internal/cluster"
+	"iac-tool/internal/database"
+	"iac-tool/internal/features"
+	"iac-tool/internal/models"
+	"iac-tool/internal/outbound"
+	"iac-tool/internal/retry"
+	"iac-tool/internal/sourcehosts"
+	"iac-tool/internal/validation"
+
+	"github.com/google/uuid"
+)
+
+// A mirrored provider is a local provider whose versions are copied from an upstream
+// registry (e.g. registry.terraform.io/hashicorp/aws) instead of being built or uploaded.
+// SyncProviderMirror follows the provider registry protocol like terraform init does:
+// service discovery, the version list, then per platform the download document, the
+// SHA256SUMS it points to (checked against the upstream signing keys) and the zip.
+
+// defaultUpstreamHost is used for sources given as namespace/name
+const defaultUpstreamHost = "registry.terraform.io"
+
+// upstreamClient fetches discovery, version and download documents
+var upstreamClient = newUpstreamClient(60 * time.Second)
+
+// upstreamDownloadClient downloads zips, which may take a while for large providers
+var upstreamDownloadClient = newUpstreamClient(10 * time.Minute)
+
+// errRedirectRefused is returned by the upstream clients for a redirect they do not follow
+var errRedirectRefused = errors.New("redirect refused")
+
+// newUpstreamClient is an outbound client that applies the checks of fetchUpstream to
+// every redirect, so an allowed host cannot send the mirror on to one that is not
+func newUpstreamClient(timeout time.Duration) *http.Client {
+	client := outbound.NewClient(timeout)
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return fmt.Errorf("%w: stopped after 10 redirects", errRedirectRefused)
+		}
+		if req.URL.Scheme != "https" {
+			return fmt.Errorf("%w: %q is not https", errRedirectRefused, req.URL)
+		}
+		if err := sourcehosts.Check(sourcehosts.KindArtifact, req.URL.String()); err != nil {
+			return fmt.Errorf("%w: %q: %v", errRedirectRefused, req.URL, err)
+		}
+		return nil
+	}
+	return client
+}
+
+// mirrorMaxVersions bounds how many new versions one sync downloads, newest first, so a
+// broad constraint backfills over several runs; PROVIDER_MIRROR_MAX_VERSIONS overrides it
+func mirrorMaxVersions() int {
+	if v, err := strconv.Atoi(os.Getenv("PROVIDER_MIRROR_MAX_VERSIONS")); err == nil && v > 0 {
+		return v
+	}
+	return 5
+}
+
+// UpstreamSource is a provider address on another registry
+type UpstreamSource struct {
+	Host      string
+	Namespace string
+	Name      string
+}
+
+func (s UpstreamSource) String() string {
+	return s.Host + "/" + s.Namespace + "/" + s.Name
+}
+
+// ParseUpstreamSource parses [host/]namespace/name; the host defaults to registry.terraform.io
+func ParseUpstreamSource(source string) (UpstreamSource, error) {
+	parts := strings.Split(strings.Trim(strings.TrimSpace(source), "/"), "/")
+	if len(parts) == 2 {
+		parts = append([]string{defaultUpstreamHost}, parts...)
+	}
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return UpstreamSource{}, fmt.Errorf("upstream source must be [host/]namespace/name, e.g. registry.terraform.io/hashicorp/aws")
+	}
+	for _, p := range parts[1:] {
+		if strings.ContainsAny(p, ".?#% ") {
+			return UpstreamSource{}, fmt.Errorf("invalid upstream source segment %q", p)
+		}
+	}
+	return UpstreamSource{Host: strings.ToLower(parts[0]), Namespace: parts[1], Name: parts[2]}, nil
+}
+
+// mirrorVersion is a parsed semantic version
+type mirrorVersion struct {
+	parts [3]int
+	pre   string
+}
+
+func parseMirrorVersion(s string) (mirrorVersion, bool) {
+	var v mirrorVersion
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	s, _, _ = strings.Cut(s, "+")
+	core, pre, _ := strings.Cut(s, "-")
+	v.pre = pre
+	fields := strings.Split(core, ".")
+	if len(fields) > 3 {
+		return v, false
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v.parts[i] = n
+	}
+	return v, true
+}
+
+func (v mirrorVersion) compare(o mirrorVersion) int {
+	for i := range v.parts {
+		if v.parts[i] != o.parts[i] {
+			if v.parts[i] < o.parts[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.pre == o.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case o.pre == "":
+		return -1
+	case v.pre < o.pre:
+		return -1
+	}
+	return 1
+}
+
+// CompareVersions orders two semantic versions (-1, 0 or 1). ok is false when either
+// does not parse.
+func CompareVersions(a, b string) (result int, ok bool) {
+	va, okA := parseMirrorVersion(a)
+	vb, okB := parseMirrorVersion(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	return va.compare(vb), true
+}
+
+// VersionParts returns the major, minor and patch of a semantic version and whether it is
+// a pre-release, parsed as CompareVersions parses it. ok is false when it does not parse.
+func VersionParts(version string) (parts [3]int, prerelease bool, ok bool) {
+	v, ok := parseMirrorVersion(version)
+	return v.parts, v.pre != "", ok
+}
+
+// NewestVersion returns the index of the highest semantic version in versions, -1 when
+// it is empty. Versions that do not parse only win when none does; among those the first
+// is kept, so callers list them in their fallback order.
+func NewestVersion(versions []string) int {
+	newest := -1
+	newestParses := false
+	for i, v := range versions {
+		_, parses := parseMirrorVersion(v)
+		switch {
+		case newest == -1, parses && !newestParses:
+			newest, newestParses = i, parses
+		case parses:
+			if cmp, _ := CompareVersions(v, versions[newest]); cmp > 0 {
+				newest = i
+			}
+		}
+	}
+	return newest
+}
+
+// versionCondition is one comparison of a constraint such as ">= 5.0"
+type versionCondition struct {
+	op       string
+	version  mirrorVersion
+	segments int // number of version segments given, for ~>
+}
+
+// VersionConstraint is a terraform version constraint: comma-separated conditions with
+// the operators =, !=, >, >=, <, <= and ~>. Pre-releases only match an exact "=".
+type VersionConstraint []versionCondition
+
+// ParseVersionConstraint parses a constraint such as ">= 5.0, < 6.0" or "~> 5.31"
+func ParseVersionConstraint(s string) (VersionConstraint, error) {
+	var constraint VersionConstraint
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("empty condition in version constraint %q", s)
+		}
+		op := "="
+		for _, candidate := range []string{"~>", ">=", "<=", "!=", ">", "<", "="} {
+			if strings.HasPrefix(part, candidate) {
+				op = candidate
+				part = strings.TrimSpace(strings.TrimPrefix(part, candidate))
+				break
+			}
+		}
+		v, ok := parseMirrorVersion(part)
+		if !ok {
+			return nil, fmt.Errorf("invalid version %q in constraint %q", part, s)
+		}
+		core, _, _ := strings.Cut(part, "-")
+		constraint = append(constraint, versionCondition{op: op, version: v, segments: len(strings.Split(core, "."))})
+	}
+	return constraint, nil
+}
+
+// Matches reports whether version satisfies every condition
+func (vc VersionConstraint) Matches(version string) bool {
+	v, ok := parseMirrorVersion(version)
+	if !ok {
+		return false
+	}
+	if v.pre != "" {
+		// As in terraform, a pre-release is only selected when asked for exactly
+		for _, c := range vc {
+			if c.op == "=" && c.version.compare(v) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	for _, c := range vc {
+		cmp := v.compare(c.version)
+		var ok bool
+		switch c.op {
+		case "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case "~>":
+			// ~> 5.31 allows 5.x from 5.31; ~> 5.31.2 allows 5.31.x from 5.31.2
+			upper := c.version
+			upper.pre = ""
+			i := c.segments - 2
+			if i < 0 {
+				i = 0
+			}
+			upper.parts[i]++
+			for j := i + 1; j < len(upper.parts); j++ {
+				upper.parts[j] = 0
+			}
+			ok = cmp >= 0 && v.compare(upper) < 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// MirroredVersion is what a sync did for one upstream version
+type MirroredVersion struct {
+	Version   string   `json:"version"`
+	Platforms []string `json:"platforms"` // os_arch stored by this sync
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// MirrorSync is the outcome of SyncProviderMirror
+type MirrorSync struct {
+	MirrorID string            `json:"mirror_id"`
+	Source   string            `json:"source"`
+	Matching int               `json:"matching"` // upstream versions satisfying the constraint
+	Pending  int               `json:"pending"`  // versions left for later syncs (see PROVIDER_MIRROR_MAX_VERSIONS)
+	Versions []MirroredVersion `json:"versions"`
+}
+
+// SyncProviderMirror copies the upstream versions matching the mirror's constraint that
+// are not (completely) published locally yet. Failures of single platforms are recorded
+// in the result and in last_error; an error is returned when the upstream registry cannot
+// be used at all.
+func SyncProviderMirror(mirrorID, baseURL, buildDir string) (*MirrorSync, error) {
+	release, ok := cluster.TryLock("provider_mirror:" + mirrorID)
+	if !ok {
+		return nil, fmt.Errorf("a sync of this mirror is already running")
+	}
+	defer release()
+
+	result, err := syncProviderMirror(mirrorID, baseURL, buildDir)
+	var lastError sql.NullString
+	if err != nil {
+		lastError = sql.NullString{String: err.Error(), Valid: true}
+	} else {
+		var errs []string
+		for _, v := range result.Versions {
+			for _, e := range v.Errors {
+				errs = append(errs, v.Version+": "+e)
+			}
+		}
+		if len(errs) > 0 {
+			lastError = sql.NullString{String: strings.Join(errs, "\n"), Valid: true}
+		}
+	}
+	database.DB.Exec(`UPDATE provider_mirrors SET last_synced_at = $1, last_error = $2 WHERE id = $3`, time.Now(), lastError, mirrorID)
+	return result, err
+}
+
+func syncProviderMirror(mirrorID, baseURL, buildDir string) (*MirrorSync, error) {
+	var providerID, namespace, name, source, constraintText string
+	err := database.DB.QueryRow(`
+		SELECT m.provider_id, n.name, p.name, m.upstream_source, m.version_constraint
+		FROM provider_mirrors m
+		JOIN providers p ON m.provider_id = p.id
+		JOIN namespaces n ON p.namespace_id = n.id
+		WHERE m.id = $1
+	`, mirrorID).Scan(&providerID, &namespace, &name, &source, &constraintText)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load mirror: %w", err)
+	}
+	upstream, err := ParseUpstreamSource(source)
+	if err != nil {
+		return nil, err
+	}
+	constraint, err := ParseVersionConstraint(constraintText)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := discoverProviders(upstream.Host)
+	if err != nil {
+		return nil, err
+	}
+	var list models.ProviderVersionsResponse
+	if err := upstreamJSON(resolveUpstream(base, upstream.Namespace+"/"+upstream.Name+"/versions"), &list); err != nil {
+		return nil, err
+	}
+
+	result := &MirrorSync{MirrorID: mirrorID, Source: upstream.String(), Versions: []MirroredVersion{}}
+	var matching []models.ProviderVersionDTO
+	for _, v := range list.Versions {
+		if constraint.Matches(v.Version) {
+			matching = append(matching, v)
+		}
+	}
+	result.Matching = len(matching)
+	sort.Slice(matching, func(i, j int) bool {
+		a, _ := parseMirrorVersion(matching[i].Version)
+		b, _ := parseMirrorVersion(matching[j].Version)
+		return a.compare(b) > 0
+	})
+
+	outputRoot := filepath.Join(buildDir, "providers", namespace, name)
+	synced := 0
+	for _, v := range matching {
+		have := mirroredPlatforms(providerID, v.Version)
+		var missing []models.ProviderPlatformDTO
+		for _, p := range v.Platforms {
+			if !have[p.OS+"_"+p.Arch] && validation.ValidPlatform(p.OS, p.Arch) {
+				missing = append(missing, p)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		if synced == mirrorMaxVersions() {
+			result.Pending++
+			continue
+		}
+		synced++
+
+		mv := MirroredVersion{Version: v.Version, Platforms: []string{}}
+		src, err := ensureMirrorVersion(providerID, namespace, name, v)
+		if err != nil {
+			mv.Errors = append(mv.Errors, err.Error())
+			result.Versions = append(result.Versions, mv)
+			continue
+		}
+		outputDir := filepath.Join(outputRoot, v.Version)
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return result, fmt.Errorf("failed to create directory: %w", err)
+		}
+
+		// Every platform of a version shares one SHA256SUMS; fetch and verify it once
+		var checksums map[string]string
+		for _, p := range missing {
+			u := resolveUpstream(base, upstream.Namespace+"/"+upstream.Name+"/"+v.Version+"/download/"+p.OS+"/"+p.Arch)
+			if err := mirrorPlatform(src, u, p, &checksums, outputDir, baseURL, buildDir); err != nil {
+				mv.Errors = append(mv.Errors, p.OS+"_"+p.Arch+": "+err.Error())
+				log.Printf("Mirroring %s %s %s_%s failed: %v", upstream, v.Version, p.OS, p.Arch, err)
+				continue
+			}
+			mv.Platforms = append(mv.Platforms, p.OS+"_"+p.Arch)
+		}
+		result.Versions = append(result.Versions, mv)
+	}
+
+	if synced > 0 {
+		database.DB.Exec("UPDATE providers SET updated_at = $1 WHERE id = $2", time.Now(), providerID)
+		cache.Registry.InvalidateOwner(providerID)
+		database.MarkWritten(providerID)
+	}
+	return result, nil
+}
+
+// mirroredPlatforms returns the os_arch pairs already published for a version
+func mirroredPlatforms(providerID, version string) map[string]bool {
+	have := map[string]bool{}
+	rows, err := database.DB.Query(`
+		SELECT pp.os, pp.arch
+		FROM provider_platforms pp
+		JOIN provider_versions pv ON pp.version_id = pv.id
+		WHERE pv.provider_id = $1 AND pv.version = $2
+	`, providerID, version)
+	if err != nil {
+		return have
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var goos, goarch string
+		if rows.Scan(&goos, &goarch) == nil {
+			have[goos+"_"+goarch] = true
+		}
+	}
+	return have
+}
+
+// ensureMirrorVersion creates the local version of an upstream version if needed
+func ensureMirrorVersion(providerID, namespace, name string, v models.ProviderVersionDTO) (*providerSource, error) {
+	protocols, _ := json.Marshal(v.Protocols)
+	_, err := database.DB.Exec(`
+		INSERT INTO provider_versions (id, provider_id, version, protocols, enabled, created_at)
+		VALUES ($1, $2, $3, $4, TRUE, $5)
+		ON CONFLICT (provider_id, version) DO NOTHING
+	`, uuid.New().String(), providerID, v.Version, string(protocols), time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create version: %w", err)
+	}
+	src := &providerSource{ProviderID: providerID, Namespace: namespace, Name: name, Version: v.Version}
+	err = database.DB.QueryRow(`SELECT id FROM provider_versions WHERE provider_id = $1 AND version = $2`, providerID, v.Version).Scan(&src.VersionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load version: %w", err)
+	}
+	return src, nil
+}
+
+// mirrorPlatform downloads one platform zip named by the upstream download document,
+// checks it against the upstream SHA256SUMS and publishes it
+func mirrorPlatform(src *providerSource, downloadURL string, platform models.ProviderPlatformDTO, checksums *map[string]string, outputDir, baseURL, buildDir string) error {
+	var doc models.ProviderDownloadResponse
+	if err := upstreamJSON(downloadURL, &doc); err != nil {
+		return err
+	}
+	filename := filepath.Base(doc.Filename)
+	if filename != doc.Filename || !strings.HasSuffix(filename, ".zip") {
+		return fmt.Errorf("upstream returned an unusable filename %q", doc.Filename)
+	}
+	if *checksums == nil {
+		sums, err := verifiedUpstreamSums(downloadURL, doc)
+		if err != nil {
+			return err
+		}
+		*checksums = sums
+	}
+	want := (*checksums)[filename]
+	if want == "" || !strings.EqualFold(want, doc.SHASum) {
+		return fmt.Errorf("%s is not listed in the signed SHA256SUMS with checksum %s", filename, doc.SHASum)
+	}
+
+	// Download to a temporary file first, so a bad download never replaces a served zip
+	tmp, err := os.CreateTemp(buildDir, ".mirror-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = upstreamDownload(resolveAgainst(downloadURL, doc.DownloadURL), tmp, maxReleaseAssetSize)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if sum, err := calculateSHA256(tmp.Name()); err != nil {
+		return err
+	} else if sum != want {
+		return fmt.Errorf("checksum %s does not match SHA256SUMS (%s)", sum, want)
+	}
+
+	file, err := os.Open(tmp.Name())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	shasum, _, err := StoreArtifact(buildDir, file, filepath.Join(outputDir, filename))
+	if err != nil {
+		return err
+	}
+
+	// Keep the upstream keys that vouched for the zip alongside the platform
+	var signingKeys sql.NullString
+	if doc.SigningKeys != nil {
+		keys, _ := json.Marshal(doc.SigningKeys)
+		signingKeys = sql.NullString{String: string(keys), Valid: true}
+	}
+	localURL := baseURL + "/downloads/providers/" + src.Namespace + "/" + src.Name + "/" + src.Version + "/" + filename
+	_, err = database.DB.Exec(`
+		INSERT INTO provider_platforms (id, version_id, os, arch, filename, download_url, shasum, signing_keys)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (version_id, os, arch) DO UPDATE
+		SET filename = EXCLUDED.filename, download_url = EXCLUDED.download_url, shasum = EXCLUDED.shasum, signing_keys = EXCLUDED.signing_keys
+	`, uuid.New().String(), src.VersionID, platform.OS, platform.Arch, filename, localURL, shasum, signingKeys)
+	if err != nil {
+		return fmt.Errorf("failed to register platform: %w", err)
+	}
+	return nil
+}
+
+// verifiedUpstreamSums downloads the SHA256SUMS named by a download document and checks
+// its signature against one of the signing keys the upstream registry lists
+func verifiedUpstreamSums(downloadURL string, doc models.ProviderDownloadResponse) (map[string]string, error) {
+	if doc.SHASumsURL == "" || doc.SHASumsSignatureURL == "" {
+		return nil, fmt.Errorf("upstream does not publish SHA256SUMS and its signature")
+	}
+	if doc.SigningKeys == nil || len(doc.SigningKeys.GPGPublicKeys) == 0 {
+		return nil, fmt.Errorf("upstream lists no signing keys")
+	}
+	var sums, sig bytes.Buffer
+	if err := upstreamDownload(resolveAgainst(downloadURL, doc.SHASumsURL), &sums, maxReleaseMetadataSize); err != nil {
+		return nil, err
+	}
+	if err := upstreamDownload(resolveAgainst(downloadURL, doc.SHASumsSignatureURL), &sig, maxReleaseMetadataSize); err != nil {
+		return nil, err
+	}
+	for _, key := range doc.SigningKeys.GPGPublicKeys {
+		if verifyDetachedSignature(key.ASCIIArmor, sums.Bytes(), sig.Bytes()) == nil {
+			return parseSHA256Sums(sums.Bytes()), nil
+		}
+	}
+	return nil, fmt.Errorf("SHA256SUMS signature does not verify against the upstream signing keys")
+}
+
+// discoverProviders returns the providers.v1 base URL advertised by host
+func discoverProviders(host string) (*url.URL, error) {
+	u := "https://" + host + "/.well-known/terraform.json"
+	var services map[string]interface{}
+	if err := upstreamJSON(u, &services); err != nil {
+		return nil, err
+	}
+	raw, _ := services["providers.v1"].(string)
+	if raw == "" {
+		return nil, fmt.Errorf("%s does not advertise providers.v1", host)
+	}
+	base, _ := url.Parse(u)
+	ref, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid providers.v1 URL: %v", host, err)
+	}
+	resolved := base.ResolveReference(ref)
+	if !strings.HasSuffix(resolved.Path, "/") {
+		resolved.Path += "/"
+	}
+	return resolved, nil
+}
+
+func resolveUpstream(base *url.URL, path string) string {
+	return base.ResolveReference(&url.URL{Path: path}).String()
+}
+
+// resolveAgainst resolves a URL from a document relative to the document's URL
+func resolveAgainst(docURL, ref string) string {
+	base, err := url.Parse(docURL)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(r).String()
+}
+
+func upstreamJSON(u string, out interface{}) error {
+	var body bytes.Buffer
+	if err := fetchUpstream(upstreamClient, u, &body, maxReleaseMetadataSize); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body.Bytes(), out); err != nil {
+		return fmt.Errorf("%s: invalid JSON: %v", u, err)
+	}
+	return nil
+}
+
+func upstreamDownload(u string, w io.Writer, limit int64) error {
+	return fetchUpstream(upstreamDownloadClient, u, w, limit)
+}
+
+func fetchUpstream(client *http.Client, u string, w io.Writer, limit int64) error {
+	if parsed, err := url.Parse(u); err != nil || parsed.Scheme != "https" {
+		return fmt.Errorf("refusing to fetch %q: only https URLs are mirrored", u)
+	}
+	if err := sourcehosts.Check(sourcehosts.KindArtifact, u); err != nil {
+		return fmt.Errorf("refusing to fetch %q: %w", u, err)
+	}
+	// Only the request is retried: nothing was written to w before the body is copied
+	var resp *http.Response
+	err := retry.Do("GET "+u, func() error {
+		var err error
+		if resp, err = client.Get(u); err != nil {
+			if errors.Is(err, errRedirectRefused) {
+				return retry.Permanent(err)
+			}
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			err = fmt.Errorf("%s: HTTP %d", u, resp.StatusCode)
+			if !retry.TransientStatus(resp.StatusCode) {
+				return retry.Permanent(err)
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	n, err := io.Copy(w, io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return fmt.Errorf("%s: %w", u, err)
+	}
+	if n > limit {
+		return fmt.Errorf("%s is larger than %d bytes", u, limit)
+	}
+	return nil
+}
+
+// SyncAllProviderMirrors syncs every mirror and returns how many synced; used by the
+// scheduler
+func SyncAllProviderMirrors(baseURL, buildDir string) (int, error) {
+	rows, err := database.DB.Query(`
+		SELECT m.id, n.name FROM provider_mirrors m
+		JOIN providers p ON m.provider_id = p.id
+		JOIN namespaces n ON p.namespace_id = n.id
+		ORDER BY m.created_at
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list mirrors: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id, namespace string
+		// Mirrors of namespaces without the network_mirror feature are not synced
+		if rows.Scan(&id, &namespace) == nil && features.Enabled(features.NetworkMirror, namespace) {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	synced, failed := 0, 0
+	var lastErr error
+	for _, id := range ids {
+		result, err := SyncProviderMirror(id, baseURL, buildDir)
+		if err != nil {
+			log.Printf("Provider mirrors: sync of %s failed: %v", id, err)
+			failed, lastErr = failed+1, err
+			continue
+		}
+		synced++
+		for _, v := range result.Versions {
+			log.Printf("Provider mirrors: %s %s: %d platforms mirrored, %d errors", result.Source, v.Version, len(v.Platforms), len(v.Errors))
+		}
+	}
+	if failed > 0 {
+		return synced, fmt.Errorf("%d of %d mirrors failed to sync, last: %v", failed, len(ids), lastErr)
+	}
+	return synced, nil
+}
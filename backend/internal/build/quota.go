@@ -0,0 +1,39 @@
+package build
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+)
+
+// CheckRunQuota reports why a deployment may not start n more runs, if it may not: its
+// organization's max_concurrent_runs counts the unfinished runs of all its deployments.
+// Every path that creates runs checks it first.
+func CheckRunQuota(deploymentID string, n int) string {
+	var organization string
+	var quotasJSON sql.NullString
+	var active int
+	err := database.DB.QueryRow(`
+		SELECT o.name, o.quotas,
+			(SELECT COUNT(*) FROM deployment_runs r
+			 JOIN deployments rd ON r.deployment_id = rd.id
+			 JOIN namespaces rn ON rd.namespace_id = rn.id
+			 WHERE rn.organization_id = o.id AND r.completed_at IS NULL)
+		FROM deployments d
+		JOIN namespaces n ON d.namespace_id = n.id
+		JOIN organizations o ON n.organization_id = o.id
+		WHERE d.id = $1
+	`, deploymentID).Scan(&organization, &quotasJSON, &active)
+	if err != nil || !quotasJSON.Valid || quotasJSON.String == "" {
+		return ""
+	}
+	var quotas models.OrganizationQuotas
+	json.Unmarshal([]byte(quotasJSON.String), &quotas)
+	if q := quotas.MaxConcurrentRuns; q > 0 && active+n > q {
+		return fmt.Sprintf("Organization %s has reached its quota of %d concurrent runs", organization, q)
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package build
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"iac-tool/internal/cluster"
+	"iac-tool/internal/database"
+)
+
+// activeRunStatuses are the statuses of runs that have not finished yet
+const activeRunStatuses = `'pending', 'initializing', 'planning', 'planned', 'awaiting_approval', 'applying',
+	'importing', 'modifying_state', 'destroying', 'runner_unreachable'`
+
+// runStartGrace is how long a run may take to be handed to the runner. Runs still not
+// on the runner after that were interrupted by a backend restart.
+const runStartGrace = 15 * time.Minute
+
+// RunUnreachableTimeout is how long the runner may be unreachable while a run is followed
+// before the run is given up (RUN_UNREACHABLE_TIMEOUT, default 10m)
+func RunUnreachableTimeout() time.Duration {
+	if v := os.Getenv("RUN_UNREACHABLE_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return 10 * time.Minute
+}
+
+// failRunUnknown fails a run whose outcome cannot be determined any more
+func failRunUnknown(runID, reason string) {
+	log.Printf("Run %s: outcome unknown: %s", runID, reason)
+	failRun(runID, "Outcome unknown: "+reason+". Check the deployment's state before running it again.")
+}
+
+// ReconcileRuns brings unfinished runs nobody follows back in line with the runner: runs
+// on the runner are followed again (pollRunnerStatus fails them when the runner lost them
+// or stays unreachable), and runs that never reached the runner are failed. Runs followed
+// in this process are skipped: their lease is this instance's, so the query cannot tell
+// them from runs of an earlier process with the same INSTANCE_ID. It returns the number
+// of runs resumed or failed.
+func ReconcileRuns() (int, error) {
+	rows, err := database.DB.Query(`
+		SELECT r.id, COALESCE(r.work_dir, ''), COALESCE(r.runner_url, ''), d.plan_validity
+		FROM deployment_runs r
+		JOIN deployments d ON d.id = r.deployment_id
+		WHERE r.status IN (`+activeRunStatuses+`)
+		  AND (COALESCE(r.work_dir, '') <> '' OR COALESCE(r.started_at, r.created_at) < NOW() - $1 * INTERVAL '1 second')
+		  AND NOT EXISTS (
+		      SELECT 1 FROM leases l WHERE l.name = 'run:' || r.id AND l.expires_at > NOW() AND l.owner <> $2
+		  )
+	`, runStartGrace.Seconds(), cluster.InstanceID())
+	if err != nil {
+		return 0, fmt.Errorf("failed to load orphaned runs: %w", err)
+	}
+	type orphan struct {
+		id, workDir, runnerURL string
+		planValidity           sql.NullString
+	}
+	var runs []orphan
+	for rows.Next() {
+		var o orphan
+		if err := rows.Scan(&o.id, &o.workDir, &o.runnerURL, &o.planValidity); err == nil && !cluster.Holds("run:"+o.id) {
+			runs = append(runs, o)
+		}
+	}
+	rows.Close()
+
+	for _, o := range runs {
+		if o.workDir == "" {
+			failRunUnknown(o.id, fmt.Sprintf("the run was not handed to the runner within %s (the backend was probably restarted)", runStartGrace))
+			continue
+		}
+		if o.runnerURL == "" {
+			o.runnerURL = RunnerURL()
+		}
+		log.Printf("Resuming run %s (runner deployment %s on %s)", o.id, o.workDir, o.runnerURL)
+		go pollRunnerStatus(o.id, o.workDir, o.runnerURL, PlanValidity(o.planValidity.String))
+	}
+	return len(runs), nil
+}
@@ -0,0 +1,258 @@
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"iac-tool/internal/cache"
+	"iac-tool/internal/database"
+	"iac-tool/internal/git"
+	"iac-tool/internal/validation"
+
+	"golang.org/x/crypto/openpgp" //nolint:staticcheck // terraform verifies provider signatures with the same package
+)
+
+// Providers released with goreleaser (the layout of the HashiCorp provider template)
+// publish, per version:
+//
+//	terraform-provider-<name>_<version>_<os>_<arch>.zip
+//	terraform-provider-<name>_<version>_SHA256SUMS
+//	terraform-provider-<name>_<version>_SHA256SUMS.sig
+//	terraform-provider-<name>_<version>_manifest.json (protocol versions)
+//
+// ImportRelease takes these from a GitHub release instead of building the provider.
+
+// maxReleaseMetadataSize bounds SHA256SUMS, its signature and the manifest
+const maxReleaseMetadataSize = 1 << 20
+
+// maxReleaseAssetSize bounds each provider zip
+const maxReleaseAssetSize = 1 << 30
+
+// ReleaseImportOptions selects what ImportRelease takes from a release
+type ReleaseImportOptions struct {
+	Tag          string     // Release tag (default: v<version>)
+	Platforms    []Platform // Platforms to import (default: every zip in the release)
+	GPGPublicKey string     // Publisher's ASCII-armored key (required); SHA256SUMS.sig must verify against it
+}
+
+// ReleasePlatform is the outcome of importing one platform
+type ReleasePlatform struct {
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	Filename string `json:"filename"`
+	SHASum   string `json:"shasum,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ReleaseImport is the outcome of ImportRelease
+type ReleaseImport struct {
+	Tag               string            `json:"tag"`
+	SignatureVerified bool              `json:"signature_verified"`
+	Protocols         []string          `json:"protocols,omitempty"`
+	Platforms         []ReleasePlatform `json:"platforms"`
+}
+
+// Imported returns how many platforms were registered
+func (r *ReleaseImport) Imported() int {
+	n := 0
+	for _, p := range r.Platforms {
+		if p.Error == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// ImportRelease downloads the goreleaser artifacts of a provider version from the GitHub
+// release of its source repository, checks SHA256SUMS against the publisher's signature
+// and every zip against SHA256SUMS, stores them like uploads and registers their
+// platforms. The registry re-signs SHA256SUMS with its own key, so a release whose
+// signature was not verified is never imported. A platform that fails is reported and skipped; an error is
+// returned when the release itself cannot be used.
+func ImportRelease(providerID, versionID, baseURL, buildDir string, opts ReleaseImportOptions) (*ReleaseImport, error) {
+	if strings.TrimSpace(opts.GPGPublicKey) == "" {
+		return nil, fmt.Errorf("the publisher's GPG public key is required to verify the release")
+	}
+	src, err := loadProviderSource(providerID, versionID)
+	if err != nil {
+		return nil, err
+	}
+	tag := opts.Tag
+	if tag == "" {
+		tag = "v" + src.Version
+	}
+	release, err := git.GitHubRelease(src.GitURL, tag, src.Auth)
+	if err != nil {
+		return nil, err
+	}
+	result := &ReleaseImport{Tag: release.TagName, Platforms: []ReleasePlatform{}}
+	prefix := "terraform-provider-" + src.Name + "_" + src.Version + "_"
+
+	// SHA256SUMS (and its signature) vouch for the zips
+	sumsAsset := release.Asset(prefix + "SHA256SUMS")
+	if sumsAsset == nil {
+		return nil, fmt.Errorf("release %s has no %sSHA256SUMS asset", tag, prefix)
+	}
+	var sums bytes.Buffer
+	if err := release.Download(sumsAsset, &sums, maxReleaseMetadataSize); err != nil {
+		return nil, err
+	}
+	sigAsset := release.Asset(prefix + "SHA256SUMS.sig")
+	if sigAsset == nil {
+		return nil, fmt.Errorf("release %s has no %sSHA256SUMS.sig asset to verify", tag, prefix)
+	}
+	var sig bytes.Buffer
+	if err := release.Download(sigAsset, &sig, maxReleaseMetadataSize); err != nil {
+		return nil, err
+	}
+	if err := verifyDetachedSignature(opts.GPGPublicKey, sums.Bytes(), sig.Bytes()); err != nil {
+		return nil, err
+	}
+	result.SignatureVerified = true
+	checksums := parseSHA256Sums(sums.Bytes())
+
+	// The manifest tells which plugin protocols the provider speaks
+	if manifest := release.Asset(prefix + "manifest.json"); manifest != nil {
+		var buf bytes.Buffer
+		var doc struct {
+			Metadata struct {
+				ProtocolVersions []string `json:"protocol_versions"`
+			} `json:"metadata"`
+		}
+		if release.Download(manifest, &buf, maxReleaseMetadataSize) == nil && json.Unmarshal(buf.Bytes(), &doc) == nil {
+			result.Protocols = doc.Metadata.ProtocolVersions
+		}
+	}
+
+	outputDir := filepath.Join(buildDir, "providers", src.Namespace, src.Name, src.Version)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	for _, platform := range releasePlatforms(release, prefix, opts.Platforms) {
+		filename := prefix + platform.OS + "_" + platform.Arch + ".zip"
+		p := ReleasePlatform{OS: platform.OS, Arch: platform.Arch, Filename: filename}
+		p.SHASum, err = importReleaseAsset(release, src, filename, checksums[filename], outputDir, baseURL, buildDir, platform)
+		if err != nil {
+			p.Error = err.Error()
+			log.Printf("Importing %s from release %s failed: %v", filename, tag, err)
+		}
+		result.Platforms = append(result.Platforms, p)
+	}
+	if len(result.Platforms) == 0 {
+		return nil, fmt.Errorf("release %s has no %s<os>_<arch>.zip assets", tag, prefix)
+	}
+
+	if len(result.Protocols) > 0 && result.Imported() > 0 {
+		protocols, _ := json.Marshal(result.Protocols)
+		database.DB.Exec("UPDATE provider_versions SET protocols = $1 WHERE id = $2", string(protocols), versionID)
+	}
+	database.DB.Exec("UPDATE providers SET updated_at = $1 WHERE id = $2", time.Now(), providerID)
+	cache.Registry.InvalidateOwner(providerID)
+	database.MarkWritten(providerID)
+	return result, nil
+}
+
+// releasePlatforms returns the requested platforms, or every platform the release has a
+// zip for
+func releasePlatforms(release *git.Release, prefix string, requested []Platform) []Platform {
+	if len(requested) > 0 {
+		return requested
+	}
+	var platforms []Platform
+	for _, asset := range release.Assets {
+		if !strings.HasPrefix(asset.Name, prefix) || !strings.HasSuffix(asset.Name, ".zip") {
+			continue
+		}
+		osArch := strings.TrimSuffix(strings.TrimPrefix(asset.Name, prefix), ".zip")
+		goos, goarch, ok := strings.Cut(osArch, "_")
+		if ok && validation.ValidPlatform(goos, goarch) {
+			platforms = append(platforms, Platform{OS: goos, Arch: goarch})
+		}
+	}
+	return platforms
+}
+
+// importReleaseAsset stores one zip through the blob store, checks it against its
+// SHA256SUMS entry and registers the platform. It returns the zip's checksum.
+func importReleaseAsset(release *git.Release, src *providerSource, filename, want, outputDir, baseURL, buildDir string, platform Platform) (string, error) {
+	asset := release.Asset(filename)
+	if asset == nil {
+		return "", fmt.Errorf("the release has no %s asset", filename)
+	}
+	if want == "" {
+		return "", fmt.Errorf("%s is not listed in SHA256SUMS", filename)
+	}
+
+	// Download to a temporary file first, so a bad download never replaces a served zip
+	tmp, err := os.CreateTemp(buildDir, ".release-*.zip")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	err = release.Download(asset, tmp, maxReleaseAssetSize)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if sum, err := calculateSHA256(tmp.Name()); err != nil {
+		return "", err
+	} else if sum != want {
+		return "", fmt.Errorf("checksum %s does not match SHA256SUMS (%s)", sum, want)
+	}
+
+	file, err := os.Open(tmp.Name())
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	shasum, _, err := StoreArtifact(buildDir, file, filepath.Join(outputDir, filename))
+	if err != nil {
+		return "", err
+	}
+
+	downloadURL := baseURL + "/downloads/providers/" + src.Namespace + "/" + src.Name + "/" + src.Version + "/" + filename
+	if err := registerBuiltPlatform(src, BuildResult{Platform: platform, Filename: filename, SHA256: shasum, DownloadURL: downloadURL}); err != nil {
+		return "", fmt.Errorf("failed to register platform: %w", err)
+	}
+	return shasum, nil
+}
+
+// parseSHA256Sums maps file names to checksums in a SHA256SUMS document
+func parseSHA256Sums(doc []byte) map[string]string {
+	sums := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(doc))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && ValidDigest(strings.ToLower(fields[0])) {
+			sums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+		}
+	}
+	return sums
+}
+
+// verifyDetachedSignature checks a binary or armored detached signature of doc against
+// an armored public key
+func verifyDetachedSignature(armoredKey string, doc, signature []byte) error {
+	keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(armoredKey))
+	if err != nil {
+		return fmt.Errorf("invalid GPG public key: %v", err)
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(signature), []byte("-----BEGIN")) {
+		_, err = openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(doc), bytes.NewReader(signature))
+	} else {
+		_, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(doc), bytes.NewReader(signature))
+	}
+	if err != nil {
+		return fmt.Errorf("SHA256SUMS signature does not verify against the given key: %v", err)
+	}
+	return nil
+}
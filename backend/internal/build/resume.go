@@ -0,0 +1,46 @@
+package build
+
+import (
+	"fmt"
+	"log"
+
+	"iac-tool/internal/cluster"
+	"iac-tool/internal/database"
+)
+
+// ResumeOrphanedWork takes over runs and stack runs whose backend instance stopped
+// following them (it crashed, restarted or was scaled down), so their lease expired.
+// Leases of an earlier process with the same INSTANCE_ID are taken over at once. It
+// returns the number of runs and stack runs taken over or failed.
+func ResumeOrphanedWork() (int, error) {
+	runs, err := ReconcileRuns()
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT s.id FROM stack_runs s
+		WHERE s.status IN ('pending', 'running', 'awaiting_approval')
+		  AND NOT EXISTS (
+		      SELECT 1 FROM leases l WHERE l.name = 'stack:' || s.id AND l.expires_at > NOW() AND l.owner <> $1
+		  )
+	`, cluster.InstanceID())
+	if err != nil {
+		return runs, fmt.Errorf("failed to load orphaned stack runs: %w", err)
+	}
+	var stackRuns []string
+	for rows.Next() {
+		var id string
+		// Stack runs this process follows hold their lease already
+		if err := rows.Scan(&id); err == nil && !cluster.Holds("stack:"+id) {
+			stackRuns = append(stackRuns, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range stackRuns {
+		log.Printf("Resuming stack run %s", id)
+		go ExecuteStackRun(id)
+	}
+	return runs + len(stackRuns), nil
+}
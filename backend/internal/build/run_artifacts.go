@@ -0,0 +1,73 @@
+package build
+
+import (
+	"database/sql"
+	"log"
+
+	"iac-tool/internal/crypto"
+	"iac-tool/internal/database"
+)
+
+// runArtifactColumns are the deployment_runs columns encrypted at rest: the plan JSON, the
+// plan and apply outputs and the init, plan, apply and hook logs (and their plain copy in
+// plain_logs), which can hold provider configuration and sensitive values in clear text
+var runArtifactColumns = []string{"plan_json", "plan_output", "apply_output", "init_log", "plan_log", "apply_log", "hook_log", "plain_logs"}
+
+// sealArtifact encrypts a run artifact for storage. An artifact that cannot be encrypted
+// is not stored in clear text; it is left out (NULL) and the error logged.
+func sealArtifact(runID, name, value string) sql.NullString {
+	if value == "" {
+		return sql.NullString{}
+	}
+	sealed, err := crypto.EncryptArtifact(value)
+	if err != nil {
+		log.Printf("Run %s: failed to encrypt %s, not storing it: %v", runID, name, err)
+		return sql.NullString{}
+	}
+	return sql.NullString{String: sealed, Valid: true}
+}
+
+// OpenArtifact decrypts a stored run artifact; one that cannot be decrypted reads as empty
+func OpenArtifact(stored sql.NullString) string {
+	value, err := crypto.DecryptArtifact(stored.String)
+	if err != nil {
+		log.Printf("Failed to decrypt run artifact: %v", err)
+		return ""
+	}
+	return value
+}
+
+// EncryptLegacyRunArtifacts encrypts run artifacts stored in clear text before they were
+// encrypted at rest
+func EncryptLegacyRunArtifacts() error {
+	for _, column := range runArtifactColumns {
+		rows, err := database.DB.Query(`SELECT id, ` + column + ` FROM deployment_runs WHERE ` + column + ` <> '' AND ` + column + ` NOT LIKE 'enc:%'`)
+		if err != nil {
+			return err
+		}
+		plain := map[string]string{}
+		for rows.Next() {
+			var id, stored string
+			if err := rows.Scan(&id, &stored); err != nil {
+				rows.Close()
+				return err
+			}
+			plain[id] = stored
+		}
+		rows.Close()
+
+		for id, stored := range plain {
+			sealed, err := crypto.EncryptArtifact(stored)
+			if err != nil {
+				return err
+			}
+			if _, err := database.DB.Exec(`UPDATE deployment_runs SET `+column+` = $1 WHERE id = $2`, sealed, id); err != nil {
+				return err
+			}
+		}
+		if len(plain) > 0 {
+			log.Printf("✓ Encrypted %s of %d runs", column, len(plain))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package build
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"iac-tool/internal/ansi"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+)
+
+// logTailLines is how many lines of output the run.failed notification carries
+const logTailLines = 20
+
+// StorePlainLogs reports whether runs keep an ANSI-stripped copy of their logs next to the
+// raw ones (RUN_LOGS_STORE_PLAIN), so plain logs are served without converting them
+func StorePlainLogs() bool {
+	return os.Getenv("RUN_LOGS_STORE_PLAIN") == "true"
+}
+
+// plainLogs returns the ANSI-stripped copy of the logs in a runner status to store in
+// plain_logs; NULL unless RUN_LOGS_STORE_PLAIN is set
+func plainLogs(runID string, status *RunnerDeploymentStatus) sql.NullString {
+	if !StorePlainLogs() {
+		return sql.NullString{}
+	}
+	logs, _ := json.Marshal(models.RunLogs{
+		Format:   "plain",
+		InitLog:  ansi.Strip(status.InitLog),
+		PlanLog:  ansi.Strip(status.PlanLog),
+		ApplyLog: ansi.Strip(status.ApplyLog),
+		HookLog:  ansi.Strip(status.HookLog),
+	})
+	return sealArtifact(runID, "plain_logs", string(logs))
+}
+
+// LoadRunLogs returns the logs of a run as stored ("raw"), without escape sequences
+// ("plain") or rendered to HTML ("html")
+func LoadRunLogs(runID, format string) (*models.RunLogs, error) {
+	var initLog, planLog, applyLog, hookLog, storedPlain sql.NullString
+	if err := database.DB.QueryRow(`SELECT init_log, plan_log, apply_log, hook_log, plain_logs FROM deployment_runs WHERE id = $1`,
+		runID).Scan(&initLog, &planLog, &applyLog, &hookLog, &storedPlain); err != nil {
+		return nil, err
+	}
+	logs := &models.RunLogs{Format: format, InitLog: OpenArtifact(initLog), PlanLog: OpenArtifact(planLog), ApplyLog: OpenArtifact(applyLog),
+		HookLog: OpenArtifact(hookLog)}
+
+	var convert func(string) string
+	switch format {
+	case "raw":
+		return logs, nil
+	case "plain":
+		if storedPlain.Valid {
+			var plain models.RunLogs
+			if err := json.Unmarshal([]byte(OpenArtifact(storedPlain)), &plain); err == nil {
+				plain.Format = format
+				return &plain, nil
+			}
+		}
+		convert = ansi.Strip
+	case "html":
+		convert = ansi.ToHTML
+	default:
+		return nil, fmt.Errorf("unknown log format %q (raw, plain or html)", format)
+	}
+	logs.InitLog = convert(logs.InitLog)
+	logs.PlanLog = convert(logs.PlanLog)
+	logs.ApplyLog = convert(logs.ApplyLog)
+	logs.HookLog = convert(logs.HookLog)
+	return logs, nil
+}
+
+// logTail returns the last lines of the first non-empty log, as plain text; callers pass
+// the logs of the latest stage first
+func logTail(logs ...string) string {
+	for _, output := range logs {
+		output = strings.TrimRight(ansi.Strip(output), "\n")
+		if output == "" {
+			continue
+		}
+		lines := strings.Split(output, "\n")
+		if len(lines) > logTailLines {
+			lines = lines[len(lines)-logTailLines:]
+		}
+		return strings.Join(lines, "\n")
+	}
+	return ""
+}
@@ -0,0 +1,264 @@
+package build
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/registry"
+	"iac-tool/internal/retry"
+	"iac-tool/internal/signing"
+)
+
+// runTokenBase is how long a run's registry token lives on top of its plan validity,
+// matching how long pollRunnerStatus follows a run
+const runTokenBase = 2 * time.Hour
+
+// capabilitiesTTL is how long a runner's capabilities are reused before asking again
+const capabilitiesTTL = time.Minute
+
+// RunnerTool matches the runner's ToolCapability
+type RunnerTool struct {
+	Installed bool     `json:"installed"`
+	Version   string   `json:"version,omitempty"`
+	Path      string   `json:"path,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	Versions  []string `json:"versions,omitempty"` // Every installed version, newest first
+}
+
+// RunnerCapabilities matches the runner's Capabilities
+type RunnerCapabilities struct {
+	Status   string                `json:"status"`
+	Executor string                `json:"executor"`
+	Tools    map[string]RunnerTool `json:"tools"`
+	Disk     *struct {
+		Path       string `json:"path"`
+		FreeBytes  uint64 `json:"free_bytes"`
+		TotalBytes uint64 `json:"total_bytes"`
+	} `json:"disk,omitempty"`
+	PTY       bool      `json:"pty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+var (
+	runnerTransportOnce sync.Once
+	runnerTransport     http.RoundTripper
+
+	capabilitiesMu     sync.Mutex
+	cachedCapabilities = map[string]cachedRunnerCapabilities{} // By runner URL
+)
+
+// cachedRunnerCapabilities is what a runner reported and when
+type cachedRunnerCapabilities struct {
+	caps      *RunnerCapabilities
+	fetchedAt time.Time
+}
+
+// RunnerURL returns the base URL of the default runner: RUNNER_URL, else the first of
+// RUNNER_URLS
+func RunnerURL() string {
+	return RunnerPool()[0]
+}
+
+// RunnerPool returns the base URLs of the runners runs are scheduled on: RUNNER_URL
+// followed by the comma-separated RUNNER_URLS, or the default runner when neither is set
+func RunnerPool() []string {
+	var pool []string
+	for _, runnerURL := range append([]string{os.Getenv("RUNNER_URL")}, strings.Split(os.Getenv("RUNNER_URLS"), ",")...) {
+		runnerURL = strings.TrimSuffix(strings.TrimSpace(runnerURL), "/")
+		if runnerURL != "" && !slices.Contains(pool, runnerURL) {
+			pool = append(pool, runnerURL)
+		}
+	}
+	if len(pool) == 0 {
+		pool = []string{"http://runner:8080"}
+	}
+	return pool
+}
+
+// runRegistryToken mints the registry token passed to the runner for a run: read access
+// to the deployment's namespace and its registry_namespaces until the run times out
+func runRegistryToken(runID string, planValidity time.Duration) (string, error) {
+	var namespace string
+	var extraJSON sql.NullString
+	err := database.DB.QueryRow(`
+		SELECT n.name, d.registry_namespaces
+		FROM deployment_runs r
+		JOIN deployments d ON d.id = r.deployment_id
+		JOIN namespaces n ON n.id = d.namespace_id
+		WHERE r.id = $1
+	`, runID).Scan(&namespace, &extraJSON)
+	if err != nil {
+		return "", err
+	}
+
+	namespaces := []string{namespace}
+	if extraJSON.Valid && extraJSON.String != "" {
+		var extra []string
+		json.Unmarshal([]byte(extraJSON.String), &extra)
+		namespaces = append(namespaces, extra...)
+	}
+	return registry.MintScopedToken(runID, namespaces, runTokenBase+planValidity)
+}
+
+// failingTransport rejects every request, so a broken TLS setup never falls back to plain HTTP
+type failingTransport struct{ err error }
+
+func (t failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, t.err
+}
+
+// RunnerClient returns a client for calls to the runner. Requests are signed with
+// RUNNER_SHARED_SECRET and use mutual TLS when RUNNER_TLS_* is configured. The client
+// has no timeout because log streams stay open for the whole run.
+func RunnerClient() *http.Client {
+	runnerTransportOnce.Do(func() {
+		base := http.DefaultTransport.(*http.Transport).Clone()
+		tlsConfig, err := signing.TLSConfig()
+		if err != nil {
+			log.Printf("Runner TLS configuration is invalid, runner calls will fail: %v", err)
+			runnerTransport = failingTransport{err: fmt.Errorf("runner TLS configuration: %w", err)}
+			return
+		}
+		if tlsConfig != nil {
+			base.TLSClientConfig = tlsConfig
+		}
+		if signing.Secret() == "" && tlsConfig == nil {
+			log.Printf("Warning: RUNNER_SHARED_SECRET and RUNNER_TLS_* are not set, runner traffic is unauthenticated")
+		}
+		runnerTransport = &signing.Transport{Base: base, Secret: signing.Secret()}
+	})
+	return &http.Client{Transport: runnerTransport}
+}
+
+// runnerPost sends a request to the runner, sending it again (see internal/retry) while the
+// runner cannot be reached or answers that it is unavailable. A request that may have reached
+// the runner is not resent, so a deployment is never started twice. After the last attempt
+// the runner's answer is returned, even if it is an error status.
+func runnerPost(url string, body []byte, header http.Header) (*http.Response, error) {
+	var resp *http.Response
+	err := retry.Do("runner POST "+url, func() error {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return retry.Permanent(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		resp, err = RunnerClient().Do(req)
+		if err != nil {
+			if !retry.Unsent(err) {
+				return retry.Permanent(err)
+			}
+			return err
+		}
+		if retry.TransientStatus(resp.StatusCode) {
+			return fmt.Errorf("runner answered HTTP %d", resp.StatusCode)
+		}
+		return nil
+	})
+	if resp != nil {
+		return resp, nil
+	}
+	return nil, err
+}
+
+// signalRunner posts an approval or rejection to the runner, logging when it fails
+func signalRunner(url string) {
+	resp, err := runnerPost(url, nil, nil)
+	if err != nil {
+		log.Printf("Failed to reach runner at %s: %v", url, err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// GetRunnerCapabilities returns what the runner at runnerURL can execute, cached per
+// runner for capabilitiesTTL unless refresh is set
+func GetRunnerCapabilities(runnerURL string, refresh bool) (*RunnerCapabilities, error) {
+	capabilitiesMu.Lock()
+	cached, ok := cachedCapabilities[runnerURL]
+	capabilitiesMu.Unlock()
+	if !refresh && ok && time.Since(cached.fetchedAt) < capabilitiesTTL {
+		return cached.caps, nil
+	}
+
+	client := RunnerClient()
+	client.Timeout = 30 * time.Second
+	resp, err := client.Get(runnerURL + "/capabilities")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("runner returned status %d", resp.StatusCode)
+	}
+
+	var caps RunnerCapabilities
+	if err := json.NewDecoder(resp.Body).Decode(&caps); err != nil {
+		return nil, err
+	}
+	capabilitiesMu.Lock()
+	cachedCapabilities[runnerURL] = cachedRunnerCapabilities{caps: &caps, fetchedAt: time.Now()}
+	capabilitiesMu.Unlock()
+	return &caps, nil
+}
+
+// checkRunnerTools returns the runners of pool that have the binaries a run needs. Runs
+// in a custom image on the docker executor bring their own tools, and a runner that
+// cannot report its capabilities is not excluded. It fails, naming what each runner
+// misses, when no runner of the pool qualifies.
+func checkRunnerTools(pool []string, tool string, terragrunt *runnerTerragrunt, image string) ([]string, error) {
+	if tool == "auto" {
+		// The runner picks an installed tool for "auto", or explains why none fits
+		return pool, nil
+	}
+
+	binaries := []string{tool}
+	if tool == "terragrunt" {
+		tfBinary := "terraform"
+		if terragrunt != nil && terragrunt.TFBinary != "" {
+			tfBinary = terragrunt.TFBinary
+		}
+		binaries = append(binaries, tfBinary)
+	}
+
+	var usable, problems []string
+	for _, runnerURL := range pool {
+		caps, err := GetRunnerCapabilities(runnerURL, false)
+		if err != nil || (caps.Executor == "docker" && image != "") {
+			usable = append(usable, runnerURL)
+			continue
+		}
+		missing := ""
+		for _, binary := range binaries {
+			if t, ok := caps.Tools[binary]; ok && !t.Installed {
+				missing = fmt.Sprintf("%s is not available on runner %s: %s", binary, runnerURL, t.Error)
+				break
+			}
+		}
+		if missing != "" {
+			problems = append(problems, missing)
+			continue
+		}
+		usable = append(usable, runnerURL)
+	}
+	if len(usable) == 0 {
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+	return usable, nil
+}
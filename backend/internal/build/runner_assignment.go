@@ -0,0 +1,110 @@
+package build
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+)
+
+// RunnerLabels returns the labels of the runners of the pool, from RUNNER_LABELS:
+// "url=label,label;url=label", e.g. "https://runner-secure:8080=hardened,pci"
+func RunnerLabels() map[string][]string {
+	labels := map[string][]string{}
+	for _, entry := range strings.Split(os.Getenv("RUNNER_LABELS"), ";") {
+		runnerURL, list, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		runnerURL = strings.TrimSuffix(strings.TrimSpace(runnerURL), "/")
+		for _, label := range strings.Split(list, ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				labels[runnerURL] = append(labels[runnerURL], label)
+			}
+		}
+	}
+	return labels
+}
+
+// RunnerRestricted reports whether a namespace's runner binding limits its runs
+func RunnerRestricted(assignment models.NamespaceRunners) bool {
+	return len(assignment.Runners) > 0 || len(assignment.Labels) > 0
+}
+
+// EligibleRunners returns the runners of the pool a namespace's runs may execute on: all
+// of them without a binding, otherwise those listed or having all the labels
+func EligibleRunners(assignment models.NamespaceRunners) []string {
+	pool := RunnerPool()
+	if !RunnerRestricted(assignment) {
+		return pool
+	}
+	labels := RunnerLabels()
+	eligible := []string{}
+	for _, runnerURL := range pool {
+		if slices.Contains(assignment.Runners, runnerURL) {
+			eligible = append(eligible, runnerURL)
+			continue
+		}
+		if len(assignment.Labels) == 0 {
+			continue
+		}
+		matches := true
+		for _, label := range assignment.Labels {
+			if !slices.Contains(labels[runnerURL], label) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			eligible = append(eligible, runnerURL)
+		}
+	}
+	return eligible
+}
+
+// LoadNamespaceRunners returns the runner binding stored for a namespace
+func LoadNamespaceRunners(stored sql.NullString) models.NamespaceRunners {
+	assignment := models.NamespaceRunners{Runners: []string{}, Labels: []string{}}
+	if stored.Valid && stored.String != "" {
+		json.Unmarshal([]byte(stored.String), &assignment)
+	}
+	return assignment
+}
+
+// runRunnerPool returns the runners a run may execute on (see DeploymentRunnerPool)
+func runRunnerPool(runID string) ([]string, error) {
+	var deploymentID string
+	if err := database.DB.QueryRow(`SELECT deployment_id FROM deployment_runs WHERE id = $1`, runID).Scan(&deploymentID); err != nil {
+		return nil, err
+	}
+	return DeploymentRunnerPool(deploymentID)
+}
+
+// DeploymentRunnerPool returns the runners a deployment's runs may execute on, from the
+// binding of its namespace. It fails when the namespace is bound to runners and none of
+// the pool qualifies, so such runs never fall back to another runner.
+func DeploymentRunnerPool(deploymentID string) ([]string, error) {
+	var namespace string
+	var stored sql.NullString
+	err := database.DB.QueryRow(`
+		SELECT n.name, n.runner_assignment
+		FROM deployments d
+		JOIN namespaces n ON n.id = d.namespace_id
+		WHERE d.id = $1
+	`, deploymentID).Scan(&namespace, &stored)
+	if err != nil {
+		return nil, err
+	}
+	assignment := LoadNamespaceRunners(stored)
+	eligible := EligibleRunners(assignment)
+	if len(eligible) == 0 {
+		return nil, fmt.Errorf("namespace %s may only run on runners %v or labelled %v, and no runner of the pool qualifies",
+			namespace, assignment.Runners, assignment.Labels)
+	}
+	return eligible, nil
+}
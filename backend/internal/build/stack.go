@@ -0,0 +1,183 @@
+package build
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"iac-tool/internal/cluster"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+	"iac-tool/internal/notify"
+	"iac-tool/internal/stack"
+
+	"github.com/google/uuid"
+)
+
+// ExecuteStackRun starts the runs of a stack's paths as their prerequisites succeed and
+// keeps the stack's aggregate status up to date until every path has finished or been skipped
+func ExecuteStackRun(stackRunID string) {
+	var deploymentID, ref, commitSHA, tool, operation, pathsJSON string
+	var envVarsJSON, tfvarsJSON, initFlags, planFlags, workspace sql.NullString
+	err := database.DB.QueryRow(`
+		SELECT deployment_id, ref, commit_sha, tool, env_vars, tfvars_files, init_flags, plan_flags, terraform_workspace, operation, paths
+		FROM stack_runs WHERE id = $1
+	`, stackRunID).Scan(&deploymentID, &ref, &commitSHA, &tool, &envVarsJSON, &tfvarsJSON, &initFlags, &planFlags, &workspace, &operation, &pathsJSON)
+	if err != nil {
+		log.Printf("Stack run %s: failed to load: %v", stackRunID, err)
+		return
+	}
+
+	var paths []models.StackPath
+	var tfvarsFiles []string
+	json.Unmarshal([]byte(pathsJSON), &paths)
+	json.Unmarshal([]byte(tfvarsJSON.String), &tfvarsFiles)
+	destroy := operation == "destroy"
+
+	lease := cluster.Hold("stack:" + stackRunID)
+	if lease == nil {
+		if cluster.Draining() {
+			log.Printf("Stack run %s is left to another instance: shutting down", stackRunID)
+		} else {
+			log.Printf("Stack run %s is orchestrated by another instance", stackRunID)
+		}
+		return
+	}
+	defer lease.Release()
+
+	database.DB.Exec(`UPDATE stack_runs SET status = 'running', started_at = COALESCE(started_at, $1) WHERE id = $2`, time.Now(), stackRunID)
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		if !lease.Keep() {
+			if cluster.Draining() {
+				log.Printf("Stack run %s is handed over to another instance: shutting down", stackRunID)
+			} else {
+				log.Printf("Stack run %s was taken over by another instance", stackRunID)
+			}
+			return
+		}
+
+		var current string
+		if err := database.DB.QueryRow(`SELECT status FROM stack_runs WHERE id = $1`, stackRunID).Scan(&current); err != nil {
+			// The stack run (or its deployment) was deleted
+			return
+		}
+
+		runs, err := StackRunStates(stackRunID)
+		if err != nil {
+			log.Printf("Stack run %s: failed to load runs: %v", stackRunID, err)
+			continue
+		}
+
+		if current == "cancelled" {
+			for _, run := range runs {
+				if !stack.IsFinished(run.Status) {
+					cancelRun(run.ID)
+				}
+			}
+			return
+		}
+
+		nodes := stack.Nodes(paths, runs, destroy)
+		for _, path := range stack.Ready(paths, nodes, destroy) {
+			// Ready paths wait while the organization's concurrent run quota is reached
+			if CheckRunQuota(deploymentID, 1) != "" {
+				break
+			}
+			runID := uuid.New().String()
+			_, err := database.DB.Exec(`
+				INSERT INTO deployment_runs (id, deployment_id, path, ref, commit_sha, tool, env_vars, tfvars_files, init_flags, plan_flags,
+				                             terraform_workspace, operation, stack_run_id, status, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, 'pending', $14)
+			`, runID, deploymentID, path, ref, commitSHA, tool, envVarsJSON.String, tfvarsJSON.String, initFlags.String, planFlags.String,
+				workspace.String, operation, stackRunID, time.Now())
+			if err != nil {
+				log.Printf("Stack run %s: failed to create run for %s: %v", stackRunID, path, err)
+				continue
+			}
+			log.Printf("Stack run %s: starting %s for %s", stackRunID, operation, path)
+			go ExecuteDeploymentRun(runID, deploymentID, path, ref, tool, tfvarsFiles, initFlags.String, planFlags.String, workspace.String)
+			runs[path] = stack.RunState{ID: runID, Status: "pending"}
+		}
+
+		nodes = stack.Nodes(paths, runs, destroy)
+		status := stack.Status(nodes)
+		if status != "success" && status != "failed" {
+			database.DB.Exec(`UPDATE stack_runs SET status = $1 WHERE id = $2 AND status <> 'cancelled'`, status, stackRunID)
+			continue
+		}
+
+		var errorMessage sql.NullString
+		if status == "failed" {
+			counts := stack.Counts(nodes)
+			errorMessage = sql.NullString{String: fmt.Sprintf("%d of %d paths succeeded", counts["success"], len(nodes)), Valid: true}
+		}
+		database.DB.Exec(`
+			UPDATE stack_runs SET status = $1, error_message = $2, completed_at = $3
+			WHERE id = $4 AND status <> 'cancelled'
+		`, status, errorMessage, time.Now(), stackRunID)
+		notify.Send("stack."+status, fmt.Sprintf("Stack run %s finished: %s", stackRunID, status), map[string]interface{}{
+			"stack_run_id":  stackRunID,
+			"deployment_id": deploymentID,
+			"status":        status,
+		})
+		return
+	}
+}
+
+// StackRunStates returns the run started for each path of a stack run
+func StackRunStates(stackRunID string) (map[string]stack.RunState, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, path, status, started_at, completed_at
+		FROM deployment_runs
+		WHERE stack_run_id = $1
+		ORDER BY created_at
+	`, stackRunID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := map[string]stack.RunState{}
+	for rows.Next() {
+		var run stack.RunState
+		var path string
+		var startedAt, completedAt sql.NullTime
+		if err := rows.Scan(&run.ID, &path, &run.Status, &startedAt, &completedAt); err != nil {
+			return nil, err
+		}
+		if startedAt.Valid {
+			run.StartedAt = &startedAt.Time
+		}
+		if completedAt.Valid {
+			run.CompletedAt = &completedAt.Time
+		}
+		runs[path] = run
+	}
+	return runs, rows.Err()
+}
+
+// cancelRun stops a run on the runner (if it has started there) and marks it cancelled
+func cancelRun(runID string) {
+	var workDir sql.NullString
+	if err := database.DB.QueryRow(`SELECT work_dir FROM deployment_runs WHERE id = $1`, runID).Scan(&workDir); err != nil {
+		return
+	}
+
+	if workDir.Valid && workDir.String != "" {
+		if resp, err := RunnerClient().Post(RunRunnerURL(runID)+"/deploy/"+workDir.String+"/cancel", "application/json", nil); err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	database.DB.Exec(`
+		UPDATE deployment_runs
+		SET status = 'cancelled', error_message = 'Stack run cancelled', completed_at = $1
+		WHERE id = $2
+	`, time.Now(), runID)
+}
@@ -1,12 +1,16 @@
 package build
 
 import (
-	"bytes"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"iac-tool/internal/ansi"
+	"iac-tool/internal/cluster"
 	"iac-tool/internal/crypto"
 	"iac-tool/internal/database"
+	"iac-tool/internal/features"
+	"iac-tool/internal/notify"
+	"iac-tool/internal/sourcehosts"
 	"io"
 	"log"
 	"net/http"
@@ -16,17 +20,66 @@ import (
 
 // RunnerDeploymentRequest matches the runner's DeploymentRequest
 type RunnerDeploymentRequest struct {
-	Tool        string            `json:"tool"`
-	GitURL      string            `json:"git_url"`
-	GitRef      string            `json:"git_ref"`
-	Path        string            `json:"path"`
-	EnvVars     map[string]string `json:"env_vars"`
-	TfvarsFiles []string          `json:"tfvars_files"`
-	InitFlags   string            `json:"init_flags,omitempty"`
-	PlanFlags   string            `json:"plan_flags,omitempty"`
-	Timeout     int               `json:"timeout"`
-	GitAuth     *RunnerGitAuth    `json:"git_auth,omitempty"`
-	AutoApprove bool              `json:"auto_approve"`
+	Tool          string            `json:"tool"`                   // "auto" lets the runner detect it
+	ToolVersion   string            `json:"tool_version,omitempty"` // Exact terraform/tofu version (default: chosen by the runner)
+	Terragrunt    *runnerTerragrunt `json:"terragrunt,omitempty"`
+	GitURL        string            `json:"git_url"`
+	GitRef        string            `json:"git_ref"`
+	Commit        string            `json:"commit,omitempty"`
+	Path          string            `json:"path"`
+	EnvVars       map[string]string `json:"env_vars"`
+	TfvarsFiles   []string          `json:"tfvars_files"`
+	InitFlags     string            `json:"init_flags,omitempty"`
+	PlanFlags     string            `json:"plan_flags,omitempty"`
+	Workspace     string            `json:"workspace,omitempty"`
+	PreHooks      []RunnerHook      `json:"pre_hooks,omitempty"`
+	PostHooks     []RunnerHook      `json:"post_hooks,omitempty"`
+	Validate      bool              `json:"validate,omitempty"`
+	PolicyChecks  []RunnerHook      `json:"policy_checks,omitempty"`
+	Image         string            `json:"image,omitempty"`
+	Destroy       bool              `json:"destroy,omitempty"`
+	Timeout       int               `json:"timeout"`
+	GitAuth       *RunnerGitAuth    `json:"git_auth,omitempty"`
+	AutoApprove   bool              `json:"auto_approve"`
+	PlanValidity  int               `json:"plan_validity,omitempty"` // minutes
+	Sparse        bool              `json:"sparse,omitempty"`
+	SparsePaths   []string          `json:"sparse_paths,omitempty"`
+	Submodules    bool              `json:"submodules,omitempty"`
+	RegistryToken string            `json:"registry_token,omitempty"` // Scoped token for the private registry
+	GitAllowlist  []string          `json:"git_allowlist,omitempty"`  // Hosts the runner may clone from (empty: any)
+}
+
+// RunnerHook matches the runner's Hook
+type RunnerHook struct {
+	Name      string `json:"name,omitempty"`
+	Command   string `json:"command"`
+	Timeout   int    `json:"timeout,omitempty"`
+	OnFailure string `json:"on_failure,omitempty"`
+}
+
+// runnerHooks mirrors the JSON stored in deployments.hooks
+type runnerHooks struct {
+	PreInit   []RunnerHook `json:"pre_init"`
+	PostApply []RunnerHook `json:"post_apply"`
+}
+
+// runnerPipeline mirrors the JSON stored in deployments.pipeline
+type runnerPipeline struct {
+	Validate     bool         `json:"validate"`
+	PolicyChecks []RunnerHook `json:"policy_checks"`
+}
+
+// runnerTerragrunt mirrors the JSON stored in deployments.terragrunt
+type runnerTerragrunt struct {
+	RunAll   bool   `json:"run_all"`
+	TFBinary string `json:"tf_binary,omitempty"`
+}
+
+// runnerCloneOptions matches the clone_options JSON stored on deployments
+type runnerCloneOptions struct {
+	Sparse     bool     `json:"sparse"`
+	ExtraPaths []string `json:"extra_paths"`
+	Submodules bool     `json:"submodules"`
 }
 
 type RunnerGitAuth struct {
@@ -42,21 +95,56 @@ type RunnerDeploymentResponse struct {
 }
 
 type RunnerDeploymentStatus struct {
-	DeploymentID string     `json:"deployment_id"`
-	Status       string     `json:"status"`
-	Phase        string     `json:"phase"`
-	StartedAt    time.Time  `json:"started_at"`
-	EndedAt      *time.Time `json:"ended_at,omitempty"`
-	Error        string     `json:"error,omitempty"`
-	InitLog      string     `json:"init_log,omitempty"`
-	PlanLog      string     `json:"plan_log,omitempty"`
-	PlanOutput   string     `json:"plan_output,omitempty"`
-	ApplyLog     string     `json:"apply_log,omitempty"`
-	ApplyOutput  string     `json:"apply_output,omitempty"`
+	DeploymentID    string            `json:"deployment_id"`
+	Status          string            `json:"status"`
+	Phase           string            `json:"phase"`
+	StartedAt       time.Time         `json:"started_at"`
+	EndedAt         *time.Time        `json:"ended_at,omitempty"`
+	Error           string            `json:"error,omitempty"`
+	InitLog         string            `json:"init_log,omitempty"`
+	PlanLog         string            `json:"plan_log,omitempty"`
+	PlanOutput      string            `json:"plan_output,omitempty"`
+	ApplyLog        string            `json:"apply_log,omitempty"`
+	ApplyOutput     string            `json:"apply_output,omitempty"`
+	HookLog         string            `json:"hook_log,omitempty"`
+	ApplyReport     json.RawMessage   `json:"apply_report,omitempty"`
+	OperationResult json.RawMessage   `json:"operation_result,omitempty"`
+	CommitSHA       string            `json:"commit_sha,omitempty"`
+	PlanJSON        json.RawMessage   `json:"plan_json,omitempty"`
+	Stages          []RunnerStage     `json:"stages,omitempty"`
+	Tool            string            `json:"tool,omitempty"` // Resolved after the clone, e.g. for tool "auto"
+	ToolVersion     string            `json:"tool_version,omitempty"`
+	TfvarsSHA256    map[string]string `json:"tfvars_sha256,omitempty"`
+	Runner          string            `json:"runner,omitempty"` // Hostname of the runner
+	Exit            json.RawMessage   `json:"exit,omitempty"`   // How the command that failed the deployment ended
+}
+
+// RunnerStage matches the runner's StageResult
+type RunnerStage struct {
+	Name            string     `json:"name"`
+	Status          string     `json:"status"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	EndedAt         *time.Time `json:"ended_at,omitempty"`
+	DurationSeconds float64    `json:"duration_seconds,omitempty"`
+	Log             string     `json:"log,omitempty"`
+	Error           string     `json:"error,omitempty"`
+	Reused          bool       `json:"reused,omitempty"`
+}
+
+// PlanValidity is how long a plan may await approval before the run expires:
+// the deployment's plan_validity if set, otherwise PLAN_VALIDITY (default 24h)
+func PlanValidity(deploymentValue string) time.Duration {
+	for _, v := range []string{deploymentValue, os.Getenv("PLAN_VALIDITY")} {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return 24 * time.Hour
 }
 
-// ExecuteDeploymentRun executes a deployment run via the runner HTTP API
-func ExecuteDeploymentRun(runID, deploymentID, path, ref, tool string, envVars map[string]string, tfvarsFiles []string, initFlags, planFlags string) {
+// ExecuteDeploymentRun executes a deployment run via the runner HTTP API. The run's env
+// vars are read from the run and decrypted only here, for the runner request.
+func ExecuteDeploymentRun(runID, deploymentID, path, ref, tool string, tfvarsFiles []string, initFlags, planFlags, workspace string) {
 	// Mark as initializing
 	now := time.Now()
 	database.DB.Exec(`
@@ -66,13 +154,14 @@ WHERE id = $2
 `, now, runID)
 
 	// Get deployment info
-	var gitURL string
-	var authType, authDataStr sql.NullString
+	var gitURL, namespace string
+	var authType, authDataStr, hooksJSON, runnerImage, cloneJSON, pipelineJSON, terragruntJSON, planValidity, concurrencyJSON, namespaceEnv sql.NullString
 	err := database.DB.QueryRow(`
-SELECT git_url, git_auth_type, git_auth_data 
-FROM deployments 
-WHERE id = $1
-`, deploymentID).Scan(&gitURL, &authType, &authDataStr)
+SELECT d.git_url, d.git_auth_type, d.git_auth_data, d.hooks, d.runner_image, d.clone_options, d.pipeline, d.terragrunt, d.plan_validity, d.concurrency, n.name, n.default_env_vars
+FROM deployments d
+JOIN namespaces n ON d.namespace_id = n.id
+WHERE d.id = $1
+`, deploymentID).Scan(&gitURL, &authType, &authDataStr, &hooksJSON, &runnerImage, &cloneJSON, &pipelineJSON, &terragruntJSON, &planValidity, &concurrencyJSON, &namespace, &namespaceEnv)
 	if err != nil {
 		failRun(runID, "Failed to get deployment info: "+err.Error())
 		return
@@ -94,30 +183,172 @@ WHERE id = $1
 		}
 	}
 
+	// Destroy runs plan with -destroy; a pinned commit is checked out instead of the tip of the ref
+	var operation string
+	var commitSHA, storedEnvVars, reproducesRunID sql.NullString
+	database.DB.QueryRow(`SELECT operation, commit_sha, env_vars, reproduces_run_id FROM deployment_runs WHERE id = $1`, runID).
+		Scan(&operation, &commitSHA, &storedEnvVars, &reproducesRunID)
+
+	envVars, err := crypto.DecryptEnvVars(storedEnvVars.String)
+	if err != nil {
+		failRun(runID, "Failed to decrypt env vars: "+err.Error())
+		return
+	}
+
+	// Load hooks
+	var hooks runnerHooks
+	if hooksJSON.Valid && hooksJSON.String != "" {
+		if err := json.Unmarshal([]byte(hooksJSON.String), &hooks); err != nil {
+			failRun(runID, "Failed to parse deployment hooks: "+err.Error())
+			return
+		}
+	}
+
+	var cloneOptions runnerCloneOptions
+	if cloneJSON.Valid && cloneJSON.String != "" {
+		json.Unmarshal([]byte(cloneJSON.String), &cloneOptions)
+	}
+
+	var pipeline runnerPipeline
+	if pipelineJSON.Valid && pipelineJSON.String != "" {
+		json.Unmarshal([]byte(pipelineJSON.String), &pipeline)
+	}
+
+	// The repository's platform.yaml, as of the commit that runs, adds to the deployment's settings
+	configRef := ref
+	if commitSHA.String != "" {
+		configRef = commitSHA.String
+	}
+	platformConfig, err := LoadPlatformConfig(deploymentID, configRef)
+	if err != nil {
+		failRun(runID, err.Error())
+		return
+	}
+	if platformConfig != nil {
+		RestrictPlatformConfig(runID, deploymentID, runnerImage.String, platformConfig)
+		if platformConfig.RunnerImage != "" {
+			runnerImage = sql.NullString{String: platformConfig.RunnerImage, Valid: true}
+		}
+		if platformConfig.Apply.PlanValidity != "" {
+			planValidity = sql.NullString{String: platformConfig.Apply.PlanValidity, Valid: true}
+		}
+	}
+
+	// Outputs of other deployments are passed as TF_VAR_ variables; a reproduction gets
+	// them with the rest of the recorded env vars
+	var inputEnv map[string]string
+	if !reproducesRunID.Valid {
+		inputEnv, err = runInputEnv(runID)
+		if err != nil {
+			failRun(runID, "Failed to resolve inputs: "+err.Error())
+			return
+		}
+	}
+	// Platform and namespace defaults apply under the run's own env vars
+	envVars, envSources, err := mergeRunEnv(namespaceEnv.String, envVars, inputEnv)
+	if err != nil {
+		failRun(runID, "Failed to load the default env vars: "+err.Error())
+		return
+	}
+
+	var terragrunt *runnerTerragrunt
+	if tool == "terragrunt" {
+		terragrunt = &runnerTerragrunt{}
+		if terragruntJSON.Valid && terragruntJSON.String != "" {
+			json.Unmarshal([]byte(terragruntJSON.String), terragrunt)
+		}
+	}
+
 	// Create deployment request
 	runnerReq := RunnerDeploymentRequest{
-		Tool:        tool,
-		GitURL:      gitURL,
-		GitRef:      ref,
-		Path:        path,
-		EnvVars:     envVars,
-		TfvarsFiles: tfvarsFiles,
-		InitFlags:   initFlags,
-		PlanFlags:   planFlags,
-		Timeout:     60,
-		GitAuth:     gitAuth,
-		AutoApprove: false, // Manual approval required
+		Tool:         tool,
+		Terragrunt:   terragrunt,
+		GitURL:       gitURL,
+		GitRef:       ref,
+		Commit:       commitSHA.String,
+		Path:         path,
+		EnvVars:      envVars,
+		TfvarsFiles:  tfvarsFiles,
+		InitFlags:    initFlags,
+		PlanFlags:    planFlags,
+		Workspace:    workspace,
+		PreHooks:     hooks.PreInit,
+		PostHooks:    hooks.PostApply,
+		Validate:     pipeline.Validate,
+		PolicyChecks: pipeline.PolicyChecks,
+		Image:        runnerImage.String,
+		Destroy:      operation == "destroy",
+		Timeout:      60,
+		GitAuth:      gitAuth,
+		AutoApprove:  false, // Manual approval required
+		Sparse:       cloneOptions.Sparse,
+		SparsePaths:  cloneOptions.ExtraPaths,
+		Submodules:   cloneOptions.Submodules,
+	}
+	if platformConfig != nil {
+		applyPlatformConfig(&runnerReq, platformConfig)
+	}
+	validity := PlanValidity(planValidity.String)
+	runnerReq.PlanValidity = int((validity + time.Minute - 1) / time.Minute)
+
+	// A reproduction replays the manifest of the run it reproduces
+	if reproducesRunID.Valid {
+		manifest, err := LoadRunManifest(reproducesRunID.String)
+		if err != nil || manifest == nil {
+			failRun(runID, fmt.Sprintf("Failed to load the manifest of run %s: %v", reproducesRunID.String, err))
+			return
+		}
+		manifestEnv, err := manifestEnvVars(reproducesRunID.String)
+		if err != nil {
+			failRun(runID, "Failed to decrypt the recorded env vars: "+err.Error())
+			return
+		}
+		applyRunManifest(&runnerReq, manifest, manifestEnv)
+		envSources = manifest.EnvVarSources
+		validity = time.Duration(runnerReq.PlanValidity) * time.Minute
 	}
 
-	// Get runner URL from environment
-	runnerURL := os.Getenv("RUNNER_URL")
-	if runnerURL == "" {
-		runnerURL = "http://runner:8080"
+	// Applying without approval is rolled out with the auto_apply feature flag
+	if runnerReq.AutoApprove && !features.Enabled(features.AutoApply, namespace) {
+		runnerReq.AutoApprove = false
+	}
+
+	// Runs in a concurrency group apply one at a time, so the runner waits for the backend's
+	// approval even when the run needs none; it is approved up front and queues when ready
+	group := concurrencyGroup(concurrencyJSON, runnerReq.Workspace)
+	database.DB.Exec(`UPDATE deployment_runs SET concurrency_group = NULLIF($1, '') WHERE id = $2`, group, runID)
+	if group != "" && runnerReq.AutoApprove {
+		runnerReq.AutoApprove = false
+		database.DB.Exec(`UPDATE deployment_runs SET approved_by = $1, approved_at = $2 WHERE id = $3`, autoApprover, time.Now(), runID)
+	}
+
+	runnerReq.RegistryToken, err = runRegistryToken(runID, validity)
+	if err != nil {
+		failRun(runID, "Failed to issue registry token: "+err.Error())
+		return
+	}
+
+	// The runner refuses to clone repositories, including submodules, from other hosts
+	runnerReq.GitAllowlist, err = sourcehosts.Patterns(sourcehosts.KindGit)
+	if err != nil {
+		failRun(runID, "Failed to read the git source allowlist: "+err.Error())
+		return
+	}
+
+	runnerURL, err := assignRunner(runID, runnerReq.Tool, runnerReq.Terragrunt, runnerReq.Image)
+	if err != nil {
+		failRun(runID, "Failed to assign a runner: "+err.Error())
+		return
+	}
+
+	if err := recordRunManifest(runID, operation, reproducesRunID.String, &runnerReq, envSources, runnerURL, platformConfig != nil); err != nil {
+		failRun(runID, "Failed to record the run manifest: "+err.Error())
+		return
 	}
 
 	// Start deployment on runner
 	reqBody, _ := json.Marshal(runnerReq)
-	resp, err := http.Post(runnerURL+"/deploy", "application/json", bytes.NewBuffer(reqBody))
+	resp, err := runnerPost(runnerURL+"/deploy", reqBody, nil)
 	if err != nil {
 		failRun(runID, "Failed to contact runner: "+err.Error())
 		return
@@ -138,32 +369,114 @@ WHERE id = $1
 
 	runnerDeploymentID := deployResp.DeploymentID
 
-	// Store runner deployment ID
-	database.DB.Exec(`UPDATE deployment_runs SET work_dir = $1 WHERE id = $2`, runnerDeploymentID, runID)
+	// Store runner deployment ID and the runner it runs on
+	database.DB.Exec(`UPDATE deployment_runs SET work_dir = $1, runner_url = $2 WHERE id = $3`, runnerDeploymentID, runnerURL, runID)
 
 	// Poll runner for status updates
-	pollRunnerStatus(runID, runnerDeploymentID, runnerURL)
+	pollRunnerStatus(runID, runnerDeploymentID, runnerURL, validity)
 }
 
-func pollRunnerStatus(runID, runnerDeploymentID, runnerURL string) {
+// pollRunnerStatus mirrors runner progress into the run until it finishes. planValidity
+// is how long the run may wait for approval; that wait does not count against the
+// execution timeout.
+func pollRunnerStatus(runID, runnerDeploymentID, runnerURL string, planValidity time.Duration) {
+	// Only one backend instance follows a run; the others take over if it goes away
+	lease := cluster.Hold("run:" + runID)
+	if lease == nil {
+		if cluster.Draining() {
+			log.Printf("Run %s is left to another instance: shutting down", runID)
+		} else {
+			log.Printf("Run %s is followed by another instance", runID)
+		}
+		return
+	}
+	defer lease.Release()
+
 	ticker := time.NewTicker(500 * time.Millisecond) // Poll every 500ms for near-real-time updates
 	defer ticker.Stop()
 
-	timeout := time.After(2 * time.Hour)
+	// Runs may take runExecutionTimeout outside of the approval wait, which has its own
+	// deadline (plan_expires_at)
+	deadline := time.Now().Add(runExecutionTimeout)
 	firstUpdate := true
+	codeChangesRecorded := false
+	toolRecorded := false
 	waitingForApproval := false
+	queuedBehind := "" // Run of the concurrency group this run waits for
+
+	// Liveness: failed status polls in a row, and since when. After
+	// RunnerUnreachableThreshold the run is runner_unreachable and polled less often; after
+	// RunUnreachableTimeout it is rescheduled onto another runner or failed.
+	var lastStatus string
+	database.DB.QueryRow(`SELECT status FROM deployment_runs WHERE id = $1`, runID).Scan(&lastStatus)
+	unreachable := lastStatus == "runner_unreachable"
+	failures := 0
+	var unreachableSince, lastPoll time.Time
 
 	log.Printf("Starting polling for run %s, runner deployment %s", runID, runnerDeploymentID)
 
 	for {
 		select {
 		case <-ticker.C:
+			if !lease.Keep() {
+				if cluster.Draining() {
+					log.Printf("Run %s is handed over to another instance: shutting down", runID)
+				} else {
+					log.Printf("Run %s was taken over by another instance", runID)
+				}
+				return
+			}
+			if !waitingForApproval && time.Now().After(deadline) {
+				failRun(runID, "Deployment timeout")
+				return
+			}
+
+			if unreachable && time.Since(lastPoll) < unreachablePollInterval {
+				continue
+			}
+			lastPoll = time.Now()
+
 			// Get status from runner
-			resp, err := http.Get(fmt.Sprintf("%s/deploy/%s/status", runnerURL, runnerDeploymentID))
+			resp, err := RunnerClient().Get(fmt.Sprintf("%s/deploy/%s/status", runnerURL, runnerDeploymentID))
+			if err == nil && resp.StatusCode == http.StatusNotFound {
+				// The runner keeps runs in memory, so it was restarted during the run
+				resp.Body.Close()
+				failRunUnknown(runID, "the runner no longer has this run (it was restarted while the run was in progress)")
+				return
+			}
+			if err == nil && resp.StatusCode != http.StatusOK {
+				resp.Body.Close()
+				err = fmt.Errorf("runner returned %s", resp.Status)
+			}
 			if err != nil {
-				log.Printf("Error getting status from runner: %v", err)
+				failures++
+				if failures == 1 {
+					log.Printf("Run %s: error getting status from runner %s: %v", runID, runnerURL, err)
+					unreachableSince = time.Now()
+				}
+				if failures == RunnerUnreachableThreshold() && !unreachable {
+					unreachable = true
+					markRunnerUnreachable(runID, runnerURL, failures, err)
+				}
+				if timeout := RunUnreachableTimeout(); time.Since(unreachableSince) > timeout {
+					if start := rescheduleRun(runID, runnerURL, lastStatus); start != nil {
+						lease.Release()
+						go start()
+						return
+					}
+					failRunUnknown(runID, fmt.Sprintf("the runner was unreachable for %s (%v)", timeout, err))
+					return
+				}
 				continue
 			}
+			if unreachable {
+				log.Printf("Run %s: runner %s is reachable again after %d failed status polls", runID, runnerURL, failures)
+				if lastStatus != "runner_unreachable" {
+					database.DB.Exec(`UPDATE deployment_runs SET status = $1 WHERE id = $2 AND status = 'runner_unreachable'`, lastStatus, runID)
+				}
+				unreachable = false
+			}
+			failures = 0
 
 			var status RunnerDeploymentStatus
 			if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
@@ -181,30 +494,71 @@ func pollRunnerStatus(runID, runnerDeploymentID, runnerURL string) {
 				firstUpdate = false
 			}
 
-			// Always update logs - this ensures logs are visible while waiting for approval
+			// Always update logs - this ensures logs are visible while waiting for approval.
+			// The plan JSON, outputs and logs are encrypted at rest.
+			var applyReport, operationResult, planJSON, commandExit sql.NullString
+			if len(status.ApplyReport) > 0 {
+				applyReport = sql.NullString{String: string(status.ApplyReport), Valid: true}
+			}
+			if len(status.OperationResult) > 0 {
+				operationResult = sql.NullString{String: string(status.OperationResult), Valid: true}
+			}
+			if len(status.PlanJSON) > 0 {
+				planJSON = sealArtifact(runID, "plan_json", string(status.PlanJSON))
+			}
+			if len(status.Exit) > 0 {
+				commandExit = sql.NullString{String: string(status.Exit), Valid: true}
+			}
 			result, err := database.DB.Exec(`
 				UPDATE deployment_runs 
-				SET init_log = $1, plan_log = $2, plan_output = $3, apply_log = $4, apply_output = $5
-				WHERE id = $6
-			`, status.InitLog, status.PlanLog, status.PlanOutput, status.ApplyLog, status.ApplyOutput, runID)
+				SET init_log = $1, plan_log = $2, plan_output = $3, apply_log = $4, apply_output = $5, hook_log = $6,
+				    apply_report = COALESCE($7, apply_report), operation_result = COALESCE($8, operation_result),
+				    commit_sha = COALESCE(NULLIF($9, ''), commit_sha), plan_json = COALESCE($10, plan_json),
+				    command_exit = COALESCE($11, command_exit), plain_logs = $12
+				WHERE id = $13
+			`, sealArtifact(runID, "init_log", status.InitLog), sealArtifact(runID, "plan_log", status.PlanLog),
+				sealArtifact(runID, "plan_output", status.PlanOutput), sealArtifact(runID, "apply_log", status.ApplyLog),
+				sealArtifact(runID, "apply_output", status.ApplyOutput), sealArtifact(runID, "hook_log", status.HookLog),
+				applyReport, operationResult, status.CommitSHA, planJSON, commandExit, plainLogs(runID, &status), runID)
 			if err != nil {
 				log.Printf("Error updating logs: %v", err)
 			} else {
 				rows, _ := result.RowsAffected()
 				log.Printf("Updated logs, rows affected: %d", rows)
 			}
+			saveRunStages(runID, status.Stages)
+
+			// The tool (for "auto") and its version are settled after the clone
+			if !toolRecorded && status.Tool != "" {
+				toolRecorded = true
+				database.DB.Exec(`UPDATE deployment_runs SET tool = $1, tool_version = NULLIF($2, '') WHERE id = $3`,
+					status.Tool, status.ToolVersion, runID)
+				completeRunManifest(runID, &status)
+			}
+
+			// The checked out commit is known once the clone is done
+			if !codeChangesRecorded && status.CommitSHA != "" {
+				codeChangesRecorded = true
+				go recordRunCodeChanges(runID, status.CommitSHA)
+			}
 
 			// Update status based on phase (if not waiting for approval)
 			if !waitingForApproval && status.Phase != "" {
 				// Map runner phase names to database status names
 				dbStatus := status.Phase
 				switch status.Phase {
-				case "init":
+				case "cloning", "init", "pre_hooks", "validate":
 					dbStatus = "initializing"
-				case "plan":
+				case "plan", "policy":
 					dbStatus = "planning"
-				case "apply":
+				case "apply", "post_hooks":
 					dbStatus = "applying"
+				case "import":
+					dbStatus = "importing"
+				case "state":
+					dbStatus = "modifying_state"
+				case "destroy":
+					dbStatus = "destroying"
 				}
 
 				log.Printf("Updating status to phase: %s (mapped to: %s)", status.Phase, dbStatus)
@@ -212,19 +566,42 @@ func pollRunnerStatus(runID, runnerDeploymentID, runnerURL string) {
 				if err != nil {
 					log.Printf("Error updating status to phase: %v", err)
 				} else {
+					lastStatus = dbStatus
 					rows, _ := result.RowsAffected()
 					log.Printf("Updated status to %s, rows affected: %d", dbStatus, rows)
 				}
 			}
 
+			// Nobody approved the plan in time
+			if status.Status == "expired" {
+				expireRun(runID, status.Error)
+				return
+			}
+
+			// The state changed under a saved plan
+			if status.Status == "stale" {
+				database.DB.Exec(`
+					UPDATE deployment_runs 
+					SET status = 'stale', error_message = $1, completed_at = $2 
+					WHERE id = $3
+				`, status.Error, time.Now(), runID)
+				notify.Send("run.stale", fmt.Sprintf("Run %s needs a fresh plan: %s", runID, ansi.Strip(status.Error)), map[string]interface{}{
+					"run_id": runID,
+					"error":  ansi.Strip(status.Error),
+				})
+				return
+			}
+
 			// Check if waiting for approval
 			if status.Status == "awaiting_approval" && !waitingForApproval {
 				waitingForApproval = true
 				log.Printf("Deployment is awaiting approval, updating status")
-				result, err := database.DB.Exec(`UPDATE deployment_runs SET status = 'awaiting_approval' WHERE id = $1`, runID)
+				result, err := database.DB.Exec(`UPDATE deployment_runs SET status = 'awaiting_approval', plan_expires_at = COALESCE(plan_expires_at, $1) WHERE id = $2`,
+					time.Now().Add(planValidity), runID)
 				if err != nil {
 					log.Printf("Error updating status to awaiting_approval: %v", err)
 				} else {
+					lastStatus = "awaiting_approval"
 					rows, _ := result.RowsAffected()
 					log.Printf("Updated status to awaiting_approval, rows affected: %d", rows)
 				}
@@ -233,22 +610,44 @@ func pollRunnerStatus(runID, runnerDeploymentID, runnerURL string) {
 			// If waiting for approval, check database for approval decision
 			if waitingForApproval {
 				var approvedBy sql.NullString
-				err := database.DB.QueryRow(`SELECT approved_by FROM deployment_runs WHERE id = $1`, runID).Scan(&approvedBy)
-
+				var applyNotBefore sql.NullTime
+				err := database.DB.QueryRow(`SELECT approved_by, apply_not_before FROM deployment_runs WHERE id = $1`, runID).Scan(&approvedBy, &applyNotBefore)
+
+				if err == nil && !approvedBy.Valid {
+					// Remind approvers before the deadline; past it (the runner normally
+					// reports first) the backend expires the run itself
+					expiresAt := checkApprovalDeadline(runID)
+					if !expiresAt.IsZero() && time.Now().After(expiresAt.Add(time.Minute)) {
+						signalRunner(fmt.Sprintf("%s/deploy/%s/reject", runnerURL, runnerDeploymentID))
+						expireRun(runID, "Approval timed out at "+expiresAt.Format(time.RFC3339)+"; re-plan required")
+						return
+					}
+				}
 				if err == nil && approvedBy.Valid {
 					if approvedBy.String == "REJECTED" {
 						// Send rejection to runner
 						log.Printf("Approval rejected, sending to runner")
-						http.Post(fmt.Sprintf("%s/deploy/%s/reject", runnerURL, runnerDeploymentID), "application/json", nil)
+						signalRunner(fmt.Sprintf("%s/deploy/%s/reject", runnerURL, runnerDeploymentID))
 						waitingForApproval = false
 						// Continue polling to get final status
 						continue
+					} else if applyNotBefore.Valid && time.Now().Before(applyNotBefore.Time) {
+						// Approved for a later apply window; keep the runner waiting
+						continue
+					} else if started, blocker := startGroupApply(runID); !started {
+						// Another run of the concurrency group applies or is ahead in line
+						if blocker != "" && blocker != queuedBehind {
+							log.Printf("Run %s queued behind run %s in its concurrency group", runID, blocker)
+							queuedBehind = blocker
+						}
+						continue
 					} else {
 						// Send approval to runner
 						log.Printf("Approval granted, sending to runner")
-						http.Post(fmt.Sprintf("%s/deploy/%s/approve", runnerURL, runnerDeploymentID), "application/json", nil)
-						database.DB.Exec(`UPDATE deployment_runs SET status = 'applying' WHERE id = $1`, runID)
+						signalRunner(fmt.Sprintf("%s/deploy/%s/approve", runnerURL, runnerDeploymentID))
+						lastStatus = "applying"
 						waitingForApproval = false
+						deadline = time.Now().Add(runExecutionTimeout)
 						// Continue polling for apply phase
 						continue
 					}
@@ -274,12 +673,26 @@ func pollRunnerStatus(runID, runnerDeploymentID, runnerURL string) {
 					SET status = $1, error_message = $2, completed_at = $3 
 					WHERE id = $4
 				`, status.Status, status.Error, time.Now(), runID)
+				if status.Status == "failed" {
+					classifyRunFailure(runID)
+				}
 				return
 			}
+		}
+	}
+}
 
-		case <-timeout:
-			failRun(runID, "Deployment timeout")
-			return
+// saveRunStages stores the runner's per-stage results of a run
+func saveRunStages(runID string, stages []RunnerStage) {
+	for i, stage := range stages {
+		_, err := database.DB.Exec(`
+			INSERT INTO deployment_run_stages (run_id, name, position, status, started_at, completed_at, duration_seconds, log, error, reused)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (run_id, name) DO UPDATE
+			SET position = $3, status = $4, started_at = $5, completed_at = $6, duration_seconds = $7, log = $8, error = $9, reused = $10
+		`, runID, stage.Name, i, stage.Status, stage.StartedAt, stage.EndedAt, stage.DurationSeconds, stage.Log, stage.Error, stage.Reused)
+		if err != nil {
+			log.Printf("Error updating stage %s of run %s: %v", stage.Name, runID, err)
 		}
 	}
 }
@@ -290,4 +703,5 @@ UPDATE deployment_runs
 SET status = 'failed', error_message = $1, completed_at = $2 
 WHERE id = $3
 `, errorMsg, time.Now(), runID)
+	classifyRunFailure(runID)
 }
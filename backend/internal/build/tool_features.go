@@ -0,0 +1,134 @@
+package build
+
+import (
+	"fmt"
+	"strings"
+
+	"iac-tool/internal/git"
+	"iac-tool/internal/tfconfig"
+)
+
+// LoadToolFeatures returns the version-dependent language features the configuration at
+// path in a deployment's repository uses, as of ref. Terragrunt configurations are not
+// inspected: their modules are fetched by terragrunt.
+func LoadToolFeatures(deploymentID, ref, path string) ([]tfconfig.Feature, error) {
+	gitURL, auth, err := deploymentRepository(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	files, err := git.DirectoryFiles(gitURL, ref, path, auth, func(name string) bool {
+		return name == "terragrunt.hcl" || strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".tofu")
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := files["terragrunt.hcl"]; ok {
+		return nil, nil
+	}
+	return tfconfig.Features(files), nil
+}
+
+// featureVersion returns the lowest version of tool supporting a feature, "" if none does
+func featureVersion(tool string, feature tfconfig.Feature) string {
+	if tool == "tofu" {
+		return feature.Tofu
+	}
+	return feature.Terraform
+}
+
+// otherTool returns the other one of terraform and tofu
+func otherTool(tool string) string {
+	if tool == "tofu" {
+		return "terraform"
+	}
+	return "tofu"
+}
+
+// CheckToolFeatures checks that tool can run a configuration using features, so a run
+// fails at creation with the feature and file at fault instead of deep inside init. It
+// fails when the tool does not support a feature, when toolVersion (pinned, may be empty)
+// is older than a feature needs, or when none of runners (those the run may execute on)
+// has a recent enough version of the tool installed; the installed versions are not
+// checked for runs in a custom image. For tool "auto" it returns the tool the run has to
+// use when only one of terraform and tofu supports every feature, since the runner's
+// detection would not know.
+func CheckToolFeatures(tool, toolVersion, image string, runners []string, features []tfconfig.Feature) (string, error) {
+	if len(features) == 0 || (tool != "terraform" && tool != "tofu" && tool != "auto") {
+		return tool, nil
+	}
+
+	unsupported := func(tool string) *tfconfig.Feature {
+		for i := range features {
+			if featureVersion(tool, features[i]) == "" {
+				return &features[i]
+			}
+		}
+		return nil
+	}
+	if tool == "auto" {
+		terraformMissing, tofuMissing := unsupported("terraform"), unsupported("tofu")
+		switch {
+		case terraformMissing != nil && tofuMissing != nil:
+			return "", fmt.Errorf("no tool supports the configuration: %s uses %s, which only tofu supports, and %s uses %s, which only terraform supports",
+				terraformMissing.File, terraformMissing.Description, tofuMissing.File, tofuMissing.Description)
+		case terraformMissing != nil:
+			tool = "tofu"
+		case tofuMissing != nil:
+			tool = "terraform"
+		default:
+			// Either tool runs it; the runner picks one and its version
+			return tool, nil
+		}
+	} else if f := unsupported(tool); f != nil {
+		return "", fmt.Errorf("%s uses %s, which %s does not support; run it with tool %q %s or later",
+			f.File, f.Description, tool, otherTool(tool), featureVersion(otherTool(tool), *f))
+	}
+
+	// The newest feature sets the lowest version that runs the configuration
+	var minimum string
+	var needed tfconfig.Feature
+	for _, f := range features {
+		if cmp, ok := CompareVersions(featureVersion(tool, f), minimum); minimum == "" || (ok && cmp > 0) {
+			minimum, needed = featureVersion(tool, f), f
+		}
+	}
+
+	if toolVersion != "" {
+		if cmp, ok := CompareVersions(toolVersion, minimum); ok && cmp < 0 {
+			return "", fmt.Errorf("%s uses %s, which needs %s %s or later, but tool_version is %s",
+				needed.File, needed.Description, tool, minimum, toolVersion)
+		}
+		return tool, nil
+	}
+	if image != "" {
+		return tool, nil
+	}
+	var found []string
+	for _, runnerURL := range runners {
+		caps, err := GetRunnerCapabilities(runnerURL, false)
+		if err != nil {
+			// A runner that cannot report its capabilities is not held against the run
+			return tool, nil
+		}
+		installed := caps.Tools[tool].Versions
+		if len(installed) == 0 && caps.Tools[tool].Version != "" {
+			installed = []string{caps.Tools[tool].Version}
+		}
+		if len(installed) == 0 {
+			// The run is not assigned to this runner; checkRunnerTools reports a tool no
+			// runner has when the run starts
+			continue
+		}
+		for _, version := range installed {
+			if cmp, ok := CompareVersions(version, minimum); !ok || cmp >= 0 {
+				return tool, nil
+			}
+		}
+		found = append(found, fmt.Sprintf("runner %s has %s %s", runnerURL, tool, strings.Join(installed, ", ")))
+	}
+	if len(found) == 0 {
+		return tool, nil
+	}
+	return "", fmt.Errorf("%s uses %s, which needs %s %s or later; %s",
+		needed.File, needed.Description, tool, minimum, strings.Join(found, "; "))
+}
@@ -0,0 +1,57 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// goVersionPattern matches the Go releases the go command can switch to (1.21 and later
+// name their first release 1.N.0)
+var goVersionPattern = regexp.MustCompile(`^1\.(2[1-9]|[3-9][0-9])\.[0-9]+(rc[0-9]+)?$`)
+
+// ParseGoVersion checks a Go toolchain version given as "1.22.5" or "go1.22.5" and
+// returns it in toolchain form ("go1.22.5")
+func ParseGoVersion(version string) (string, error) {
+	v := strings.TrimPrefix(strings.TrimSpace(version), "go")
+	if !goVersionPattern.MatchString(v) {
+		return "", fmt.Errorf("go_version must be a Go release of 1.21 or later with its patch version (e.g., 1.22.5)")
+	}
+	return "go" + v, nil
+}
+
+// goToolchainEnv selects the toolchain of a build. The go command downloads a toolchain
+// it does not have from the module proxy on first use and keeps it in the module cache,
+// so later builds with the same version reuse it. Without a version, the image's
+// toolchain is used as before.
+func goToolchainEnv(toolchain string) []string {
+	if toolchain == "" {
+		return nil
+	}
+	return []string{"GOTOOLCHAIN=" + toolchain}
+}
+
+// resolveGoToolchain makes sure the toolchain of a build is available, downloading it
+// if needed, and returns the exact version that will compile the provider
+func resolveGoToolchain(sourceDir, toolchain string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "go", "env", "GOVERSION")
+	cmd.Dir = sourceDir
+	cmd.Env = append(os.Environ(), goToolchainEnv(toolchain)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to set up Go toolchain %s: %v: %s", toolchain, err, strings.TrimSpace(string(output)))
+	}
+	// Experiments are reported after the version (e.g., "go1.22.5 X:rangefunc")
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("go env GOVERSION returned nothing")
+	}
+	return fields[0], nil
+}
@@ -0,0 +1,254 @@
+// Package cache keeps hot registry lookups in memory so bursts of terraform init (many
+// CI jobs resolving the same modules and providers) do not all reach the database.
+// Entries expire after a TTL and are grouped per module or provider, so a change to one
+// drops everything cached for it. Each instance has its own cache; other instances
+// pick up a change when their entries expire.
+package cache
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Cache is a TTL cache of lookups, grouped per module or provider
+type Cache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu       sync.Mutex
+	groups   map[string]*group
+	entries  int
+	inflight map[string]*call
+	// generation changes with every invalidation, so loads that raced with one are not stored
+	generation uint64
+
+	hits, misses, loads, evictions, invalidations uint64
+}
+
+// group holds the entries of one module or provider (e.g. "providers/hashicorp/aws")
+type group struct {
+	owner   string // module or provider ID
+	entries map[string]entry
+}
+
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// call is a load in progress; concurrent misses for the same key wait for it
+type call struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// Stats reports the cache's size and hit rate since start (or the last reset)
+type Stats struct {
+	Enabled       bool    `json:"enabled"`
+	TTLSeconds    float64 `json:"ttl_seconds"`
+	MaxEntries    int     `json:"max_entries"`
+	Entries       int     `json:"entries"`
+	Groups        int     `json:"groups"`
+	Hits          uint64  `json:"hits"`
+	Misses        uint64  `json:"misses"`
+	Loads         uint64  `json:"loads"`
+	Evictions     uint64  `json:"evictions"`
+	Invalidations uint64  `json:"invalidations"`
+	HitRate       float64 `json:"hit_rate"`
+}
+
+// New creates a cache; a ttl of 0 disables it (every lookup is loaded)
+func New(ttl time.Duration, maxEntries int) *Cache {
+	return &Cache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		groups:     make(map[string]*group),
+		inflight:   make(map[string]*call),
+	}
+}
+
+// Registry caches the Terraform registry protocol lookups (REGISTRY_LOOKUP_CACHE_TTL,
+// default 30s; REGISTRY_LOOKUP_CACHE_MAX_ENTRIES, default 10000)
+var Registry = New(envDuration("REGISTRY_LOOKUP_CACHE_TTL", 30*time.Second), envInt("REGISTRY_LOOKUP_CACHE_MAX_ENTRIES", 10000))
+
+func envDuration(name string, def time.Duration) time.Duration {
+	if value := os.Getenv(name); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			return d
+		}
+		log.Printf("Warning: invalid %s %q, using %s", name, value, def)
+	}
+	return def
+}
+
+func envInt(name string, def int) int {
+	if value := os.Getenv(name); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+		log.Printf("Warning: invalid %s %q, using %d", name, value, def)
+	}
+	return def
+}
+
+// Load returns the cached value for key in groupKey, or calls load and caches its result.
+// load also returns the ID of the module or provider the value belongs to, for
+// InvalidateOwner. Errors are not cached.
+func (c *Cache) Load(groupKey, key string, load func() (value interface{}, owner string, err error)) (interface{}, error) {
+	if c.ttl == 0 {
+		value, _, err := load()
+		return value, err
+	}
+
+	id := groupKey + "\x00" + key
+	c.mu.Lock()
+	if g, ok := c.groups[groupKey]; ok {
+		if e, ok := g.entries[key]; ok && time.Now().Before(e.expires) {
+			c.hits++
+			c.mu.Unlock()
+			return e.value, nil
+		}
+	}
+	if pending, ok := c.inflight[id]; ok {
+		// Served by another request's load, so it counts as a hit
+		c.hits++
+		c.mu.Unlock()
+		<-pending.done
+		return pending.value, pending.err
+	}
+	c.misses++
+	pending := &call{done: make(chan struct{})}
+	c.inflight[id] = pending
+	generation := c.generation
+	c.mu.Unlock()
+
+	value, owner, err := load()
+	pending.value, pending.err = value, err
+
+	c.mu.Lock()
+	delete(c.inflight, id)
+	c.loads++
+	// A load that raced with an invalidation may have read old data; then it is not stored
+	if err == nil && generation == c.generation {
+		c.store(groupKey, key, owner, value)
+	}
+	c.mu.Unlock()
+	close(pending.done)
+	return value, err
+}
+
+// store adds an entry, making room first when the cache is full. Caller holds c.mu.
+func (c *Cache) store(groupKey, key, owner string, value interface{}) {
+	if c.entries >= c.maxEntries {
+		c.evict()
+	}
+	g, ok := c.groups[groupKey]
+	if !ok {
+		g = &group{entries: make(map[string]entry)}
+		c.groups[groupKey] = g
+	}
+	if owner != "" {
+		g.owner = owner
+	}
+	if _, exists := g.entries[key]; !exists {
+		c.entries++
+	}
+	g.entries[key] = entry{value: value, expires: time.Now().Add(c.ttl)}
+}
+
+// evict drops expired entries, or a whole group when none have expired. Caller holds c.mu.
+func (c *Cache) evict() {
+	now := time.Now()
+	for groupKey, g := range c.groups {
+		for key, e := range g.entries {
+			if now.After(e.expires) {
+				delete(g.entries, key)
+				c.entries--
+				c.evictions++
+			}
+		}
+		if len(g.entries) == 0 {
+			delete(c.groups, groupKey)
+		}
+	}
+	if c.entries < c.maxEntries {
+		return
+	}
+	for groupKey, g := range c.groups {
+		c.entries -= len(g.entries)
+		c.evictions += uint64(len(g.entries))
+		delete(c.groups, groupKey)
+		if c.entries < c.maxEntries {
+			return
+		}
+	}
+}
+
+// InvalidateGroup drops everything cached for one module or provider
+func (c *Cache) InvalidateGroup(groupKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	if g, ok := c.groups[groupKey]; ok {
+		c.entries -= len(g.entries)
+		c.invalidations++
+		delete(c.groups, groupKey)
+	}
+}
+
+// InvalidateOwner drops everything cached for the module or provider with an ID
+func (c *Cache) InvalidateOwner(owner string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for groupKey, g := range c.groups {
+		if g.owner == owner {
+			c.entries -= len(g.entries)
+			c.invalidations++
+			delete(c.groups, groupKey)
+		}
+	}
+}
+
+// Flush drops all entries, e.g. after a namespace was renamed or deleted
+func (c *Cache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.invalidations += uint64(len(c.groups))
+	c.groups = make(map[string]*group)
+	c.entries = 0
+}
+
+// Stats returns the cache's counters
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := Stats{
+		Enabled:       c.ttl > 0,
+		TTLSeconds:    c.ttl.Seconds(),
+		MaxEntries:    c.maxEntries,
+		Entries:       c.entries,
+		Groups:        len(c.groups),
+		Hits:          c.hits,
+		Misses:        c.misses,
+		Loads:         c.loads,
+		Evictions:     c.evictions,
+		Invalidations: c.invalidations,
+	}
+	if total := c.hits + c.misses; total > 0 {
+		s.HitRate = float64(c.hits) / float64(total)
+	}
+	return s
+}
+
+// ResetStats zeroes the hit, miss and eviction counters
+func (c *Cache) ResetStats() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hits, c.misses, c.loads, c.evictions, c.invalidations = 0, 0, 0, 0, 0
+}
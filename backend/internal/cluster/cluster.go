@@ -0,0 +1,259 @@
+// Package cluster coordinates background work between backend instances sharing a
+// database, so several replicas can run behind a load balancer. Periodic jobs run under
+// a Postgres advisory lock with their last run recorded in job_runs, so each runs once
+// per interval across all instances. Long-running work that belongs to one instance
+// (following a run on the runner, orchestrating a stack) holds a lease that it renews;
+// when an instance dies its leases expire and another instance takes the work over.
+// An instance that shuts down drains: it stops taking leases and its work gives up the
+// ones it holds, so other instances take the work over at once.
+package cluster
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"iac-tool/internal/database"
+
+	"github.com/google/uuid"
+)
+
+var instanceID = newInstanceID()
+
+// newInstanceID names this process: INSTANCE_ID, or the hostname plus a random suffix
+func newInstanceID() string {
+	if id := os.Getenv("INSTANCE_ID"); id != "" {
+		return id
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "backend"
+	}
+	return host + "-" + uuid.New().String()[:8]
+}
+
+// InstanceID returns the name this instance uses for leases
+func InstanceID() string {
+	return instanceID
+}
+
+// lockKey maps a lock name to a Postgres advisory lock key
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("iac-tool:" + name))
+	return int64(h.Sum64())
+}
+
+// TryLock takes the advisory lock name if no other session holds it. The lock lives on
+// a dedicated connection until release is called.
+func TryLock(name string) (release func(), ok bool) {
+	ctx := context.Background()
+	conn, err := database.DB.Conn(ctx)
+	if err != nil {
+		log.Printf("Cluster: failed to get a connection for lock %s: %v", name, err)
+		return nil, false
+	}
+
+	key := lockKey(name)
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil || !locked {
+		if err != nil {
+			log.Printf("Cluster: failed to take lock %s: %v", name, err)
+		}
+		conn.Close()
+		return nil, false
+	}
+	return func() {
+		conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, key)
+		conn.Close()
+	}, true
+}
+
+// RunJob runs fn if no instance has run the job name within interval (by the database
+// clock). tick is how often callers try the job: a run within half a tick of interval
+// ago counts as due, so an interval equal to the tick does not skip every other tick
+// when the ticks drift. An interval of 0 disables the job. fn returns how many items it
+// processed and its error, recorded with the run (see RecordJob).
+func RunJob(name string, interval, tick time.Duration, fn func() (int, error)) {
+	if interval == 0 {
+		return
+	}
+	release, ok := TryLock("job:" + name)
+	if !ok {
+		// Another instance is running it right now
+		return
+	}
+	defer release()
+
+	var recent bool
+	err := database.DB.QueryRow(`SELECT last_run_at > NOW() - $2 * INTERVAL '1 second' FROM job_runs WHERE name = $1`,
+		name, (interval - tick/2).Seconds()).Scan(&recent)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Cluster: failed to load last run of job %s: %v", name, err)
+		return
+	}
+	if recent {
+		return
+	}
+
+	_, err = database.DB.Exec(`
+		INSERT INTO job_runs (name, last_run_at, instance) VALUES ($1, NOW(), $2)
+		ON CONFLICT (name) DO UPDATE SET last_run_at = EXCLUDED.last_run_at, instance = EXCLUDED.instance
+	`, name, instanceID)
+	if err != nil {
+		log.Printf("Cluster: failed to record run of job %s: %v", name, err)
+		return
+	}
+	started := time.Now()
+	processed, err := fn()
+	if err != nil {
+		log.Printf("Cluster: job %s failed: %v", name, err)
+	}
+	finishJob(name, started, processed, err)
+}
+
+// AcquireLease takes the lease name for ttl if it is free, expired or already ours.
+// Expiry uses the database clock, so instances with skewed clocks agree on it.
+func AcquireLease(name string, ttl time.Duration) bool {
+	var owner string
+	err := database.DB.QueryRow(`
+		INSERT INTO leases (name, owner, expires_at) VALUES ($1, $2, NOW() + $3 * INTERVAL '1 second')
+		ON CONFLICT (name) DO UPDATE SET owner = EXCLUDED.owner, expires_at = EXCLUDED.expires_at
+		WHERE leases.expires_at < NOW() OR leases.owner = EXCLUDED.owner
+		RETURNING owner
+	`, name, instanceID, ttl.Seconds()).Scan(&owner)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Cluster: failed to acquire lease %s: %v", name, err)
+	}
+	return err == nil && owner == instanceID
+}
+
+// RenewLease extends a lease we hold; false means another instance has taken it over
+func RenewLease(name string, ttl time.Duration) bool {
+	result, err := database.DB.Exec(`UPDATE leases SET expires_at = NOW() + $1 * INTERVAL '1 second' WHERE name = $2 AND owner = $3`,
+		ttl.Seconds(), name, instanceID)
+	if err != nil {
+		// A database hiccup is not a lost lease; try again on the next renewal
+		log.Printf("Cluster: failed to renew lease %s: %v", name, err)
+		return true
+	}
+	affected, _ := result.RowsAffected()
+	return affected == 1
+}
+
+// ReleaseLease gives up a lease we hold
+func ReleaseLease(name string) {
+	database.DB.Exec(`DELETE FROM leases WHERE name = $1 AND owner = $2`, name, instanceID)
+}
+
+// Lease is a lease held by long-running work, renewed as the work makes progress
+type Lease struct {
+	name      string
+	ttl       time.Duration
+	renewedAt time.Time
+	released  bool
+}
+
+var (
+	heldMu   sync.Mutex
+	held     = map[string]bool{}
+	draining bool
+)
+
+// LeaseTTL is how long a lease survives without renewal, i.e. how long work of a dead
+// instance waits before another instance takes it over
+const LeaseTTL = 30 * time.Second
+
+// Hold acquires the lease name, or returns nil when another instance (or other work in
+// this instance) holds it or this instance is draining
+func Hold(name string) *Lease {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	if draining || held[name] || !AcquireLease(name, LeaseTTL) {
+		return nil
+	}
+	held[name] = true
+	return &Lease{name: name, ttl: LeaseTTL, renewedAt: time.Now()}
+}
+
+// Holds reports whether work in this process holds the lease name
+func Holds(name string) bool {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	return held[name]
+}
+
+// Keep renews the lease once a third of its TTL has passed; false means it was lost, or
+// is being handed over because this instance is draining, and the work must stop
+func (l *Lease) Keep() bool {
+	if Draining() {
+		return false
+	}
+	if time.Since(l.renewedAt) < l.ttl/3 {
+		return true
+	}
+	if !RenewLease(l.name, l.ttl) {
+		return false
+	}
+	l.renewedAt = time.Now()
+	return true
+}
+
+// Release gives up the lease; releasing it again does nothing, so work can hand the lease
+// on before its deferred Release runs
+func (l *Lease) Release() {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	if l.released {
+		return
+	}
+	l.released = true
+	delete(held, l.name)
+	ReleaseLease(l.name)
+}
+
+// Draining reports whether this instance is shutting down and handing its work over
+func Draining() bool {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	return draining
+}
+
+// Drain stops this instance from taking leases and waits until its work has released
+// the ones it holds (work checks Keep between steps, so it stops at a consistent point).
+// Leases still held when ctx is done are released anyway so that other instances do not
+// wait for them to expire.
+func Drain(ctx context.Context) {
+	heldMu.Lock()
+	draining = true
+	heldMu.Unlock()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		heldMu.Lock()
+		remaining := len(held)
+		heldMu.Unlock()
+		if remaining == 0 {
+			log.Printf("Cluster: all leases handed over")
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			heldMu.Lock()
+			defer heldMu.Unlock()
+			for name := range held {
+				log.Printf("Cluster: releasing lease %s of work that did not stop in time", name)
+				ReleaseLease(name)
+				delete(held, name)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package cluster
+
+import (
+	"log"
+	"time"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+)
+
+// finishJob records the outcome of a job run whose start is already in job_runs
+func finishJob(name string, started time.Time, processed int, jobErr error) {
+	var lastError *string
+	if jobErr != nil {
+		msg := jobErr.Error()
+		lastError = &msg
+	}
+	_, err := database.DB.Exec(`
+		UPDATE job_runs
+		SET finished_at = $2, duration_ms = $3, processed = $4, last_error = $5,
+		    last_success_at = CASE WHEN $5::TEXT IS NULL THEN $2 ELSE last_success_at END,
+		    consecutive_failures = CASE WHEN $5::TEXT IS NULL THEN 0 ELSE consecutive_failures + 1 END
+		WHERE name = $1
+	`, name, time.Now(), time.Since(started).Milliseconds(), processed, lastError)
+	if err != nil {
+		log.Printf("Cluster: failed to record the outcome of job %s: %v", name, err)
+	}
+}
+
+// RecordJob records a run of background work that does not go through RunJob, e.g. work
+// every instance does or event-driven deliveries, so it is reported with the jobs
+func RecordJob(name string, started time.Time, processed int, jobErr error) {
+	_, err := database.DB.Exec(`
+		INSERT INTO job_runs (name, last_run_at, instance) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET last_run_at = EXCLUDED.last_run_at, instance = EXCLUDED.instance
+	`, name, started, instanceID)
+	if err != nil {
+		log.Printf("Cluster: failed to record run of job %s: %v", name, err)
+		return
+	}
+	finishJob(name, started, processed, jobErr)
+}
+
+// JobRuns returns the recorded runs of background jobs by name
+func JobRuns() (map[string]models.BackgroundJob, error) {
+	rows, err := database.DB.Query(`
+		SELECT name, last_run_at, instance, finished_at, duration_ms, processed, last_error, last_success_at, consecutive_failures
+		FROM job_runs
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := map[string]models.BackgroundJob{}
+	for rows.Next() {
+		var j models.BackgroundJob
+		var lastRunAt time.Time
+		if err := rows.Scan(&j.Name, &lastRunAt, &j.Instance, &j.LastFinishedAt, &j.LastDurationMs, &j.Processed,
+			&j.LastError, &j.LastSuccessAt, &j.ConsecutiveFailures); err != nil {
+			return nil, err
+		}
+		j.LastRunAt = &lastRunAt
+		runs[j.Name] = j
+	}
+	return runs, rows.Err()
+}
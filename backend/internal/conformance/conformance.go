@@ -0,0 +1,481 @@
+// Package conformance walks the module and provider registry protocols the way the
+// Terraform CLI does (service discovery, versions, download, SHA256SUMS and signature
+// verification) against a running registry. Response bodies are compared with golden
+// shapes of the protocol documents, so a renamed or retyped field is caught before
+// terraform init breaks on it.
+package conformance
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"iac-tool/internal/outbound"
+
+	"golang.org/x/crypto/openpgp" //nolint:staticcheck // terraform verifies provider signatures with the same package
+)
+
+//go:embed golden/*.json
+var golden embed.FS
+
+// Checker runs protocol flows against one registry
+type Checker struct {
+	BaseURL string // e.g. https://registry.example.com
+	Token   string // API key sent as a bearer token, as terraform does with a credentials block
+	Client  *http.Client
+}
+
+// Step is the outcome of one request of a flow
+type Step struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	Err  string `json:"error,omitempty"`
+}
+
+// Report is the outcome of a flow. Failed tells whether any step failed.
+type Report struct {
+	Flow   string `json:"flow"`
+	Steps  []Step `json:"steps"`
+	Failed bool   `json:"failed"`
+}
+
+func (r *Report) pass(name, u string) {
+	r.Steps = append(r.Steps, Step{Name: name, URL: u})
+}
+
+func (r *Report) fail(name, u string, err error) {
+	r.Steps = append(r.Steps, Step{Name: name, URL: u, Err: err.Error()})
+	r.Failed = true
+}
+
+// New returns a checker for the registry at baseURL
+func New(baseURL, token string) *Checker {
+	return &Checker{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Token:   token,
+		Client:  outbound.NewClient(60 * time.Second),
+	}
+}
+
+// discover reads the service discovery document and returns the absolute base URL of
+// service (modules.v1 or providers.v1)
+func (c *Checker) discover(r *Report, service string) (*url.URL, bool) {
+	u := c.BaseURL + "/.well-known/terraform.json"
+	body, _, err := c.get(u, http.StatusOK, false)
+	if err == nil {
+		err = matchGolden("discovery", body)
+	}
+	var services map[string]interface{}
+	if err == nil {
+		err = json.Unmarshal(body, &services)
+	}
+	if err != nil {
+		r.fail("discovery", u, err)
+		return nil, false
+	}
+
+	raw, _ := services[service].(string)
+	if raw == "" {
+		r.fail("discovery", u, fmt.Errorf("service %s is not advertised", service))
+		return nil, false
+	}
+	// Terraform resolves service URLs relative to the discovery document
+	base, _ := url.Parse(u)
+	ref, err := url.Parse(raw)
+	if err != nil {
+		r.fail("discovery", u, fmt.Errorf("%s: %v", service, err))
+		return nil, false
+	}
+	resolved := base.ResolveReference(ref)
+	if !strings.HasSuffix(resolved.Path, "/") {
+		r.fail("discovery", u, fmt.Errorf("%s URL %q must end with a slash", service, raw))
+		return nil, false
+	}
+	r.pass("discovery", u)
+	return resolved, true
+}
+
+// CheckModule runs the flow of terraform init for a module source
+// <host>/namespace/name/provider. An empty version selects the newest one.
+func (c *Checker) CheckModule(namespace, name, provider, version string) *Report {
+	r := &Report{Flow: "module " + namespace + "/" + name + "/" + provider}
+	base, ok := c.discover(r, "modules.v1")
+	if !ok {
+		return r
+	}
+
+	// Versions
+	u := resolve(base, namespace+"/"+name+"/"+provider+"/versions")
+	body, _, err := c.get(u, http.StatusOK, true)
+	if err == nil {
+		err = matchGolden("module_versions", body)
+	}
+	var versions struct {
+		Modules []struct {
+			Versions []struct {
+				Version string `json:"version"`
+			} `json:"versions"`
+		} `json:"modules"`
+	}
+	if err == nil {
+		err = json.Unmarshal(body, &versions)
+	}
+	if err == nil && (len(versions.Modules) == 0 || len(versions.Modules[0].Versions) == 0) {
+		err = fmt.Errorf("no versions listed")
+	}
+	if err != nil {
+		r.fail("versions", u, err)
+		return r
+	}
+	listed := make([]string, 0, len(versions.Modules[0].Versions))
+	for _, v := range versions.Modules[0].Versions {
+		listed = append(listed, v.Version)
+	}
+	if version == "" {
+		version = newest(listed)
+	} else if !contains(listed, version) {
+		r.fail("versions", u, fmt.Errorf("version %s is not listed (listed: %s)", version, strings.Join(listed, ", ")))
+		return r
+	}
+	r.pass("versions", u)
+
+	// Download: the location comes in X-Terraform-Get (204) or, as terraform also
+	// accepts, in a JSON body with a location (200)
+	u = resolve(base, namespace+"/"+name+"/"+provider+"/"+version+"/download")
+	body, header, err := c.get(u, 0, true)
+	location := header.Get("X-Terraform-Get")
+	if err == nil && location == "" && len(body) > 0 {
+		var doc struct {
+			Location string `json:"location"`
+		}
+		if json.Unmarshal(body, &doc) == nil {
+			location = doc.Location
+		}
+	}
+	if err == nil && location == "" {
+		err = fmt.Errorf("neither an X-Terraform-Get header nor a location was returned")
+	}
+	if err != nil {
+		r.fail("download", u, err)
+		return r
+	}
+	r.pass("download", u)
+
+	// Sources terraform fetches over HTTP itself must be reachable; go-getter forced
+	// sources (git::, s3::, ...) are fetched by their own protocol and are not checked
+	if strings.HasPrefix(location, "./") || strings.HasPrefix(location, "../") || strings.HasPrefix(location, "/") ||
+		strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		src, _ := url.Parse(u)
+		ref, err := url.Parse(location)
+		if err != nil {
+			r.fail("source", location, err)
+			return r
+		}
+		archive := src.ResolveReference(ref).String()
+		if _, _, err := c.get(archive, http.StatusOK, true); err != nil {
+			r.fail("source", archive, err)
+			return r
+		}
+		r.pass("source", archive)
+	}
+	return r
+}
+
+// CheckProvider runs the flow of terraform init for a provider source
+// <host>/namespace/name on one platform, including the signature check. An empty
+// version selects the newest one available on the platform.
+func (c *Checker) CheckProvider(namespace, name, version, goos, goarch string) *Report {
+	r := &Report{Flow: "provider " + namespace + "/" + name + " (" + goos + "_" + goarch + ")"}
+	base, ok := c.discover(r, "providers.v1")
+	if !ok {
+		return r
+	}
+
+	// Versions
+	u := resolve(base, namespace+"/"+name+"/versions")
+	body, _, err := c.get(u, http.StatusOK, true)
+	if err == nil {
+		err = matchGolden("provider_versions", body)
+	}
+	var versions struct {
+		Versions []struct {
+			Version   string `json:"version"`
+			Platforms []struct {
+				OS   string `json:"os"`
+				Arch string `json:"arch"`
+			} `json:"platforms"`
+		} `json:"versions"`
+	}
+	if err == nil {
+		err = json.Unmarshal(body, &versions)
+	}
+	if err != nil {
+		r.fail("versions", u, err)
+		return r
+	}
+	var available []string
+	for _, v := range versions.Versions {
+		for _, p := range v.Platforms {
+			if p.OS == goos && p.Arch == goarch {
+				available = append(available, v.Version)
+				break
+			}
+		}
+	}
+	if version == "" {
+		version = newest(available)
+	}
+	if version == "" || !contains(available, version) {
+		r.fail("versions", u, fmt.Errorf("no listed version is available for %s_%s", goos, goarch))
+		return r
+	}
+	r.pass("versions", u)
+
+	// Download metadata
+	u = resolve(base, namespace+"/"+name+"/"+version+"/download/"+goos+"/"+goarch)
+	body, _, err = c.get(u, http.StatusOK, true)
+	if err == nil {
+		err = matchGolden("provider_download", body)
+	}
+	var download struct {
+		OS                  string `json:"os"`
+		Arch                string `json:"arch"`
+		Filename            string `json:"filename"`
+		DownloadURL         string `json:"download_url"`
+		SHASumsURL          string `json:"shasums_url"`
+		SHASumsSignatureURL string `json:"shasums_signature_url"`
+		SHASum              string `json:"shasum"`
+		SigningKeys         struct {
+			GPGPublicKeys []struct {
+				KeyID      string `json:"key_id"`
+				ASCIIArmor string `json:"ascii_armor"`
+			} `json:"gpg_public_keys"`
+		} `json:"signing_keys"`
+	}
+	if err == nil {
+		err = json.Unmarshal(body, &download)
+	}
+	if err == nil && (download.OS != goos || download.Arch != goarch) {
+		err = fmt.Errorf("returned platform %s_%s, requested %s_%s", download.OS, download.Arch, goos, goarch)
+	}
+	if err == nil && len(download.SigningKeys.GPGPublicKeys) == 0 {
+		err = fmt.Errorf("no signing keys returned; terraform refuses unsigned providers")
+	}
+	if err != nil {
+		r.fail("download", u, err)
+		return r
+	}
+	r.pass("download", u)
+	downloadURL := resolveFrom(u, download.DownloadURL)
+	shasumsURL := resolveFrom(u, download.SHASumsURL)
+	signatureURL := resolveFrom(u, download.SHASumsSignatureURL)
+
+	// SHA256SUMS must list the package with the advertised checksum
+	shasums, _, err := c.get(shasumsURL, http.StatusOK, true)
+	if err == nil {
+		err = checkSHASums(shasums, download.Filename, download.SHASum)
+	}
+	if err != nil {
+		r.fail("shasums", shasumsURL, err)
+		return r
+	}
+	r.pass("shasums", shasumsURL)
+
+	// The signature must verify against one of the advertised keys
+	signature, _, err := c.get(signatureURL, http.StatusOK, true)
+	if err == nil {
+		var armored strings.Builder
+		for _, key := range download.SigningKeys.GPGPublicKeys {
+			armored.WriteString(key.ASCIIArmor + "\n")
+		}
+		err = verifySignature(armored.String(), shasums, signature)
+	}
+	if err != nil {
+		r.fail("signature", signatureURL, err)
+		return r
+	}
+	r.pass("signature", signatureURL)
+
+	// The package itself must match the checksum
+	sum, err := c.sha256(downloadURL)
+	if err == nil && sum != download.SHASum {
+		err = fmt.Errorf("package checksum %s does not match shasum %s", sum, download.SHASum)
+	}
+	if err != nil {
+		r.fail("package", downloadURL, err)
+		return r
+	}
+	r.pass("package", downloadURL)
+	return r
+}
+
+// request builds a GET request; registry requests carry the token, as terraform sends
+// credentials to every URL on the registry host
+func (c *Checker) request(u string, auth bool) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if auth && c.Token != "" && sameHost(c.BaseURL, u) {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	return req, nil
+}
+
+// get fetches u and checks the status (any 2xx when status is 0)
+func (c *Checker) get(u string, status int, auth bool) ([]byte, http.Header, error) {
+	req, err := c.request(u, auth)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, nil, err
+	}
+	if (status != 0 && resp.StatusCode != status) || (status == 0 && resp.StatusCode/100 != 2) {
+		return nil, nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, resp.Header, nil
+}
+
+// sha256 streams u and returns its hex SHA-256
+func (c *Checker) sha256(u string) (string, error) {
+	req, err := c.request(u, true)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkSHASums looks for filename in a SHA256SUMS document and compares its checksum
+func checkSHASums(doc []byte, filename, shasum string) error {
+	scanner := bufio.NewScanner(bytes.NewReader(doc))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[1] != filename {
+			continue
+		}
+		if fields[0] != shasum {
+			return fmt.Errorf("%s is listed with checksum %s, the download endpoint returned %s", filename, fields[0], shasum)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s is not listed", filename)
+}
+
+// verifySignature checks a detached (binary or armored) signature of doc against the
+// armored public keys
+func verifySignature(armoredKeys string, doc, signature []byte) error {
+	keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(armoredKeys))
+	if err != nil {
+		return fmt.Errorf("reading signing keys: %v", err)
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(signature), []byte("-----BEGIN")) {
+		_, err = openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(doc), bytes.NewReader(signature))
+	} else {
+		_, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(doc), bytes.NewReader(signature))
+	}
+	if err != nil {
+		return fmt.Errorf("signature does not verify: %v", err)
+	}
+	return nil
+}
+
+// resolve joins a protocol path to a service base URL
+func resolve(base *url.URL, p string) string {
+	ref, _ := url.Parse(p)
+	return base.ResolveReference(ref).String()
+}
+
+// resolveFrom resolves a URL returned in the response to from
+func resolveFrom(from, u string) string {
+	base, err := url.Parse(from)
+	if err != nil {
+		return u
+	}
+	ref, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	return base.ResolveReference(ref).String()
+}
+
+func sameHost(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	return errA == nil && errB == nil && strings.EqualFold(ua.Host, ub.Host)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// newest returns the highest version, preferring releases over pre-releases as
+// terraform does without an explicit constraint
+func newest(versions []string) string {
+	best := ""
+	for _, v := range versions {
+		release := !strings.Contains(v, "-")
+		bestRelease := best != "" && !strings.Contains(best, "-")
+		if best == "" || (release && !bestRelease) || (release == bestRelease && versionLess(best, v)) {
+			best = v
+		}
+	}
+	return best
+}
+
+// versionLess orders semantic versions; a pre-release sorts before its release
+func versionLess(a, b string) bool {
+	coreA, preA, _ := strings.Cut(strings.TrimPrefix(a, "v"), "-")
+	coreB, preB, _ := strings.Cut(strings.TrimPrefix(b, "v"), "-")
+	partsA := strings.Split(coreA, ".")
+	partsB := strings.Split(coreB, ".")
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var x, y int
+		if i < len(partsA) {
+			x, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			y, _ = strconv.Atoi(partsB[i])
+		}
+		if x != y {
+			return x < y
+		}
+	}
+	if (preA == "") != (preB == "") {
+		return preA != ""
+	}
+	return preA < preB
+}
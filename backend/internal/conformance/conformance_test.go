@@ -0,0 +1,80 @@
+package conformance
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"iac-tool/internal/gpg"
+)
+
+func TestMatchGolden(t *testing.T) {
+	tests := []struct {
+		golden  string
+		body    string
+		problem string // empty when the body conforms
+	}{
+		{"discovery", `{"modules.v1": "/v1/modules/", "providers.v1": "/v1/providers/", "login.v1": {}}`, ""},
+		{"discovery", `{"modules.v1": "/v1/modules/"}`, "providers.v1 is missing"},
+		{"module_versions", `{"modules": [{"versions": [{"version": "1.0.0"}, {"version": "1.1.0"}]}]}`, ""},
+		{"module_versions", `{"modules": [{"versions": [{"version": 1}]}]}`, "modules[0].versions[0].version is number, want string"},
+		{"provider_versions", `{"versions": [{"version": "1.0.0", "protocols": ["5.0"], "platforms": [{"os": "linux", "arch": "amd64"}]}]}`, ""},
+		{"provider_versions", `{"versions": [{"version": "1.0.0", "protocols": "5.0", "platforms": []}]}`, "versions[0].protocols is string, want array"},
+		{"provider_download", `{"protocols": ["5.0"], "os": "linux", "arch": "amd64", "filename": "p.zip",
+			"download_url": "/p.zip", "shasums_url": "/s", "shasums_signature_url": "/s/sig", "shasum": "00",
+			"signing_keys": {"gpg_public_keys": [{"key_id": "ABC", "ascii_armor": "-----BEGIN"}]}}`, ""},
+		{"provider_download", `{"protocols": ["5.0"], "os": "linux", "arch": "amd64", "filename": "p.zip",
+			"download_url": "/p.zip", "shasums_url": "/s", "shasums_signature_url": "/s/sig", "shasum": "00",
+			"signing_keys": null}`, "signing_keys is null, want object"},
+		{"discovery", `not json`, "response is not JSON"},
+	}
+	for _, tt := range tests {
+		err := matchGolden(tt.golden, []byte(tt.body))
+		switch {
+		case tt.problem == "" && err != nil:
+			t.Errorf("%s: %s: unexpected error %v", tt.golden, tt.body, err)
+		case tt.problem != "" && (err == nil || !strings.Contains(err.Error(), tt.problem)):
+			t.Errorf("%s: %s: got %v, want %q", tt.golden, tt.body, err, tt.problem)
+		}
+	}
+}
+
+func TestCheckSHASums(t *testing.T) {
+	doc := []byte("aaaa  p_linux_amd64.zip\nbbbb  p_darwin_arm64.zip\n")
+	if err := checkSHASums(doc, "p_darwin_arm64.zip", "bbbb"); err != nil {
+		t.Errorf("listed package: %v", err)
+	}
+	if err := checkSHASums(doc, "p_darwin_arm64.zip", "aaaa"); err == nil {
+		t.Error("mismatched checksum was accepted")
+	}
+	if err := checkSHASums(doc, "p_windows_amd64.zip", "aaaa"); err == nil {
+		t.Error("unlisted package was accepted")
+	}
+}
+
+// TestGeneratedKeySignature signs SHA256SUMS with the key gpg.Init generates on first
+// start and verifies it the way terraform does
+func TestGeneratedKeySignature(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+	t.Setenv("GPG_HOME", t.TempDir())
+	if err := gpg.Init(); err != nil {
+		t.Fatalf("gpg: %v", err)
+	}
+	if gpg.GetKeyID() == "" || gpg.GetPublicKey() == "" {
+		t.Fatal("gpg.Init did not generate a signing key")
+	}
+
+	shasums := []byte("aaaa  p_linux_amd64.zip\n")
+	signature, err := gpg.Sign(string(shasums))
+	if err != nil {
+		t.Fatalf("signing: %v", err)
+	}
+	if err := verifySignature(gpg.GetPublicKey(), shasums, signature); err != nil {
+		t.Errorf("signature of the generated key does not verify: %v", err)
+	}
+	if err := verifySignature(gpg.GetPublicKey(), []byte("bbbb  p_linux_amd64.zip\n"), signature); err == nil {
+		t.Error("signature verified for a different document")
+	}
+}
@@ -0,0 +1,109 @@
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Golden files describe the shape of a protocol document: every value is replaced by
+// the name of its JSON type ("string", "number", "boolean"), and an array holds one
+// element describing its items. A response conforms when it has every field of the
+// golden file with the same type; additional fields are allowed, as terraform ignores
+// them.
+
+// matchGolden compares a response body with golden/<name>.json
+func matchGolden(name string, body []byte) error {
+	want, err := golden.ReadFile("golden/" + name + ".json")
+	if err != nil {
+		return err
+	}
+	var shape, doc interface{}
+	if err := json.Unmarshal(want, &shape); err != nil {
+		return fmt.Errorf("golden/%s.json: %v", name, err)
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Errorf("response is not JSON: %v", err)
+	}
+	if problems := matchShape(shape, doc, ""); len(problems) > 0 {
+		return fmt.Errorf("response does not match the protocol: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// matchShape lists the differences between a document and a golden shape
+func matchShape(shape, doc interface{}, path string) []string {
+	at := path
+	if at == "" {
+		at = "(root)"
+	}
+	switch s := shape.(type) {
+	case string:
+		if got := jsonType(doc); got != s {
+			return []string{fmt.Sprintf("%s is %s, want %s", at, got, s)}
+		}
+		return nil
+	case map[string]interface{}:
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s is %s, want object", at, jsonType(doc))}
+		}
+		keys := make([]string, 0, len(s))
+		for k := range s {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var problems []string
+		for _, k := range keys {
+			value, ok := obj[k]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s is missing", join(path, k)))
+				continue
+			}
+			problems = append(problems, matchShape(s[k], value, join(path, k))...)
+		}
+		return problems
+	case []interface{}:
+		arr, ok := doc.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s is %s, want array", at, jsonType(doc))}
+		}
+		if len(s) == 0 {
+			return nil
+		}
+		var problems []string
+		for i, item := range arr {
+			problems = append(problems, matchShape(s[0], item, path+"["+strconv.Itoa(i)+"]")...)
+		}
+		return problems
+	}
+	return []string{fmt.Sprintf("%s: unsupported golden value %v", at, shape)}
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
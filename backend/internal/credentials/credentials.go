@@ -0,0 +1,281 @@
+package credentials
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"iac-tool/internal/crypto"
+	"iac-tool/internal/database"
+	"iac-tool/internal/git"
+	"iac-tool/internal/notify"
+)
+
+// Credential statuses stored in the credential_status column
+const (
+	StatusValid    = "valid"
+	StatusExpiring = "expiring"
+	StatusExpired  = "expired"
+	StatusInvalid  = "invalid"
+)
+
+// resourceTables maps resource types to their table and repository URL column
+var resourceTables = map[string]struct{ table, urlColumn string }{
+	"modules":     {"modules", "COALESCE(NULLIF(git_url, ''), source_url)"},
+	"providers":   {"providers", "source_url"},
+	"deployments": {"deployments", "git_url"},
+}
+
+// IsResourceType reports whether t is a resource type that can hold git credentials
+func IsResourceType(t string) bool {
+	_, ok := resourceTables[t]
+	return ok
+}
+
+// Health is the credential state of one module, provider or deployment
+type Health struct {
+	ResourceType string     `json:"resource_type"` // modules, providers, deployments
+	ResourceID   string     `json:"resource_id"`
+	Name         string     `json:"name"`
+	URL          string     `json:"url"`
+	Status       *string    `json:"status,omitempty"` // valid, expiring, expired, invalid; unset until checked
+	Error        *string    `json:"error,omitempty"`
+	CheckedAt    *time.Time `json:"checked_at,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+}
+
+// ExpiryWarning is how long before a recorded expiry date a credential is reported as expiring
+func ExpiryWarning() time.Duration {
+	if v := os.Getenv("CREDENTIAL_EXPIRY_WARNING"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return 7 * 24 * time.Hour
+}
+
+// List returns the credential health of every resource with stored git credentials
+func List() ([]Health, error) {
+	all := make([]Health, 0)
+	for _, resourceType := range []string{"modules", "providers", "deployments"} {
+		t := resourceTables[resourceType]
+		rows, err := database.DB.Query(fmt.Sprintf(`
+			SELECT id, name, %s, credential_status, credential_error, credential_checked_at, credential_expires_at
+			FROM %s
+			WHERE git_auth_data IS NOT NULL AND git_auth_data != ''
+			ORDER BY name
+		`, t.urlColumn, t.table))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			h := Health{ResourceType: resourceType}
+			var repoURL, status, checkError sql.NullString
+			var checkedAt, expiresAt sql.NullTime
+			if err := rows.Scan(&h.ResourceID, &h.Name, &repoURL, &status, &checkError, &checkedAt, &expiresAt); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			h.URL = repoURL.String
+			if status.Valid {
+				h.Status = &status.String
+			}
+			if checkError.Valid {
+				h.Error = &checkError.String
+			}
+			if checkedAt.Valid {
+				h.CheckedAt = &checkedAt.Time
+			}
+			if expiresAt.Valid {
+				h.ExpiresAt = &expiresAt.Time
+			}
+			all = append(all, h)
+		}
+		rows.Close()
+	}
+	return all, nil
+}
+
+// CheckAll validates every stored credential and records the result
+func CheckAll() ([]Health, error) {
+	all, err := List()
+	if err != nil {
+		return nil, err
+	}
+	jobs := make(chan *Health)
+	var wg sync.WaitGroup
+	for w := 0; w < min(checkConcurrency(), len(all)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for h := range jobs {
+				Check(h)
+			}
+		}()
+	}
+	for i := range all {
+		jobs <- &all[i]
+	}
+	close(jobs)
+	wg.Wait()
+	return all, nil
+}
+
+// checkConcurrency is how many credentials CheckAll validates at once
+// (CREDENTIAL_CHECK_CONCURRENCY, default 4)
+func checkConcurrency() int {
+	if v := os.Getenv("CREDENTIAL_CHECK_CONCURRENCY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 4
+}
+
+// checking is set while a CheckAll started by StartCheckAll runs
+var checking atomic.Bool
+
+// StartCheckAll runs CheckAll in the background unless one started this way is still
+// running; it reports whether a check was started
+func StartCheckAll() bool {
+	if !checking.CompareAndSwap(false, true) {
+		return false
+	}
+	go func() {
+		defer checking.Store(false)
+		if _, err := CheckAll(); err != nil {
+			log.Printf("Credential check failed: %v", err)
+		}
+	}()
+	return true
+}
+
+// Check validates one credential with git ls-remote, stores the resulting status and
+// sends a notification when a credential becomes invalid, expiring or expired
+func Check(h *Health) {
+	t := resourceTables[h.ResourceType]
+
+	status, checkErr := StatusValid, ""
+	if auth, err := loadAuth(t.table, h.ResourceID); err != nil {
+		status, checkErr = StatusInvalid, err.Error()
+	} else if err := git.CheckAccess(h.URL, auth); err != nil {
+		status, checkErr = StatusInvalid, err.Error()
+	} else if h.ExpiresAt != nil {
+		if time.Now().After(*h.ExpiresAt) {
+			status = StatusExpired
+		} else if time.Until(*h.ExpiresAt) < ExpiryWarning() {
+			status = StatusExpiring
+		}
+	}
+
+	previous := ""
+	if h.Status != nil {
+		previous = *h.Status
+	}
+
+	now := time.Now()
+	var errValue interface{}
+	if checkErr != "" {
+		errValue = checkErr
+		h.Error = &checkErr
+	} else {
+		h.Error = nil
+	}
+	h.Status = &status
+	h.CheckedAt = &now
+
+	database.DB.Exec(fmt.Sprintf(`
+		UPDATE %s SET credential_status = $1, credential_error = $2, credential_checked_at = $3 WHERE id = $4
+	`, t.table), status, errValue, now, h.ResourceID)
+
+	if status == previous || status == StatusValid {
+		return
+	}
+
+	data := map[string]interface{}{
+		"resource_type": h.ResourceType,
+		"resource_id":   h.ResourceID,
+		"name":          h.Name,
+		"url":           h.URL,
+	}
+	switch status {
+	case StatusInvalid:
+		data["error"] = checkErr
+		notify.Send("credential.invalid",
+			fmt.Sprintf("Git credentials for %s %s are no longer valid: %s", singular(h.ResourceType), h.Name, checkErr), data)
+	case StatusExpiring:
+		data["expires_at"] = h.ExpiresAt
+		notify.Send("credential.expiring",
+			fmt.Sprintf("Git credentials for %s %s expire at %s", singular(h.ResourceType), h.Name, h.ExpiresAt.Format(time.RFC3339)), data)
+	case StatusExpired:
+		data["expires_at"] = h.ExpiresAt
+		notify.Send("credential.expired",
+			fmt.Sprintf("Git credentials for %s %s expired at %s", singular(h.ResourceType), h.Name, h.ExpiresAt.Format(time.RFC3339)), data)
+	}
+	log.Printf("Credential check: %s %s is %s", singular(h.ResourceType), h.Name, status)
+}
+
+// SetExpiry records when the stored credential (e.g., a PAT) expires; nil clears it
+func SetExpiry(resourceType, resourceID string, expiresAt *time.Time) (bool, error) {
+	t, ok := resourceTables[resourceType]
+	if !ok {
+		return false, fmt.Errorf("unknown resource type %q", resourceType)
+	}
+	result, err := database.DB.Exec(fmt.Sprintf(`
+		UPDATE %s SET credential_expires_at = $1 WHERE id = $2 AND git_auth_data IS NOT NULL AND git_auth_data != ''
+	`, t.table), expiresAt, resourceID)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+// Get returns the credential health of a single resource
+func Get(resourceType, resourceID string) (*Health, error) {
+	all, err := List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range all {
+		if all[i].ResourceType == resourceType && all[i].ResourceID == resourceID {
+			return &all[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func loadAuth(table, id string) (*git.AuthConfig, error) {
+	var authType, authData sql.NullString
+	err := database.DB.QueryRow(fmt.Sprintf("SELECT git_auth_type, git_auth_data FROM %s WHERE id = $1", table), id).Scan(&authType, &authData)
+	if err != nil {
+		return nil, err
+	}
+	if !authData.Valid || authData.String == "" {
+		return nil, nil
+	}
+
+	decryptedData, err := crypto.DecryptJSON(authData.String)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt authentication data")
+	}
+	var authJSON map[string]string
+	if err := json.Unmarshal([]byte(decryptedData), &authJSON); err != nil {
+		return nil, fmt.Errorf("failed to parse authentication data")
+	}
+	return &git.AuthConfig{
+		Type:     authType.String,
+		Username: authJSON["username"],
+		Password: authJSON["password"],
+	}, nil
+}
+
+func singular(resourceType string) string {
+	return resourceType[:len(resourceType)-1]
+}
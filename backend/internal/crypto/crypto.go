@@ -5,9 +5,11 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 )
 
 var gcm cipher.AEAD
@@ -119,3 +121,74 @@ func EncryptJSON(jsonStr string) (string, error) {
 func DecryptJSON(encryptedJSON string) (string, error) {
 	return Decrypt(encryptedJSON)
 }
+
+// EncryptEnvVars serializes run environment variables and encrypts them for storage
+func EncryptEnvVars(envVars map[string]string) (string, error) {
+	if envVars == nil {
+		envVars = map[string]string{}
+	}
+	data, err := json.Marshal(envVars)
+	if err != nil {
+		return "", err
+	}
+	return Encrypt(string(data))
+}
+
+// DecryptEnvVars reverses EncryptEnvVars. Values stored before env vars were encrypted
+// are plain JSON and are read as is.
+func DecryptEnvVars(stored string) (map[string]string, error) {
+	envVars := map[string]string{}
+	if stored == "" {
+		return envVars, nil
+	}
+	if !IsPlainJSON(stored) {
+		decrypted, err := Decrypt(stored)
+		if err != nil {
+			return envVars, err
+		}
+		stored = decrypted
+	}
+	if err := json.Unmarshal([]byte(stored), &envVars); err != nil {
+		return envVars, err
+	}
+	if envVars == nil {
+		envVars = map[string]string{}
+	}
+	return envVars, nil
+}
+
+// IsPlainJSON reports whether a stored value is unencrypted JSON (base64 ciphertext
+// never starts with '{' or "null")
+func IsPlainJSON(stored string) bool {
+	return strings.HasPrefix(stored, "{") || stored == "null"
+}
+
+// artifactPrefix marks run artifacts (plan JSON, outputs, hook logs) encrypted at rest.
+// Logs are free text, so unlike env vars their plain form cannot be told apart by shape.
+const artifactPrefix = "enc:"
+
+// EncryptArtifact encrypts a run artifact for storage; empty values stay empty
+func EncryptArtifact(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	ciphertext, err := Encrypt(plaintext)
+	if err != nil {
+		return "", err
+	}
+	return artifactPrefix + ciphertext, nil
+}
+
+// DecryptArtifact reverses EncryptArtifact. Artifacts stored before they were encrypted
+// are returned as is.
+func DecryptArtifact(stored string) (string, error) {
+	if !IsEncryptedArtifact(stored) {
+		return stored, nil
+	}
+	return Decrypt(strings.TrimPrefix(stored, artifactPrefix))
+}
+
+// IsEncryptedArtifact reports whether a stored artifact was encrypted by EncryptArtifact
+func IsEncryptedArtifact(stored string) bool {
+	return strings.HasPrefix(stored, artifactPrefix)
+}
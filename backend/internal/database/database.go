@@ -11,6 +11,12 @@ import (
 
 var DB *sql.DB
 
+// runStatuses are the allowed values of deployment_runs.status
+const runStatuses = `'pending', 'initializing', 'planning', 'planned', 'awaiting_approval', 'applying', 'applied', 'importing', 'modifying_state', 'destroying', 'destroyed', 'runner_unreachable', 'success', 'failed', 'cancelled', 'stale', 'expired'`
+
+// apiKeyPermissions are the allowed values of api_keys.permissions
+const apiKeyPermissions = `'read', 'write', 'approver', 'admin'`
+
 func Init() error {
 	host := os.Getenv("POSTGRES_HOST")
 	if host == "" {
@@ -50,11 +56,28 @@ func Init() error {
 		return err
 	}
 
+	if err = initReplica(); err != nil {
+		return err
+	}
+
 	log.Printf("Database initialized successfully (PostgreSQL at %s:%s)", host, port)
 	return nil
 }
 
 func createTables() error {
+	// Organizations (business units grouping namespaces under shared settings)
+	organizationsTable := `
+	CREATE TABLE IF NOT EXISTS organizations (
+		id VARCHAR(255) PRIMARY KEY,
+		name VARCHAR(255) NOT NULL UNIQUE,
+		description TEXT,
+		default_deployment_settings TEXT,
+		vcs_connections TEXT,
+		quotas TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
 	// Namespaces table (authorities/organizations)
 	namespacesTable := `
 	CREATE TABLE IF NOT EXISTS namespaces (
@@ -62,6 +85,14 @@ func createTables() error {
 		name VARCHAR(255) NOT NULL UNIQUE,
 		description TEXT,
 		is_public BOOLEAN DEFAULT FALSE,
+		organization_id VARCHAR(255) REFERENCES organizations(id) ON DELETE SET NULL,
+		owner_emails TEXT,
+		support_contact TEXT,
+		links TEXT,
+		logo_url TEXT,
+		storage_quota_bytes BIGINT,
+		runner_assignment TEXT,
+		default_env_vars TEXT,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);`
@@ -73,7 +104,7 @@ func createTables() error {
 		name VARCHAR(255) NOT NULL,
 		key_hash VARCHAR(255) NOT NULL UNIQUE,
 		key_encrypted TEXT,
-		permissions VARCHAR(50) NOT NULL CHECK(permissions IN ('read', 'write', 'admin')),
+		permissions VARCHAR(50) NOT NULL CHECK(permissions IN (` + apiKeyPermissions + `)),
 		expires_at TIMESTAMP,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		last_used_at TIMESTAMP
@@ -92,8 +123,13 @@ func createTables() error {
 		git_ref VARCHAR(255),
 		git_auth_type VARCHAR(50),
 		git_auth_data TEXT,
+		credential_status VARCHAR(20),
+		credential_error TEXT,
+		credential_checked_at TIMESTAMP,
+		credential_expires_at TIMESTAMP,
 		synced BOOLEAN DEFAULT FALSE,
 		sync_error TEXT,
+		auto_enable_rule TEXT,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (namespace_id) REFERENCES namespaces(id) ON DELETE CASCADE,
@@ -110,6 +146,11 @@ func createTables() error {
 		documentation TEXT,
 		enabled BOOLEAN DEFAULT TRUE,
 		tag_date TIMESTAMP,
+		examples_synced_at TIMESTAMP,
+		variables TEXT,
+		tag_message TEXT,
+		changelog TEXT,
+		deprecation TEXT,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (module_id) REFERENCES modules(id) ON DELETE CASCADE,
 		UNIQUE(module_id, version)
@@ -127,6 +168,16 @@ func createTables() error {
 		sync_error TEXT,
 		git_auth_type VARCHAR(50),
 		git_auth_data TEXT,
+		credential_status VARCHAR(20),
+		credential_error TEXT,
+		credential_checked_at TIMESTAMP,
+		credential_expires_at TIMESTAMP,
+		readme_abstract TEXT,
+		repository_description TEXT,
+		topics TEXT,
+		catalog_synced_at TIMESTAMP,
+		auto_enable_rule TEXT,
+		build_go_version VARCHAR(64),
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (namespace_id) REFERENCES namespaces(id) ON DELETE CASCADE,
@@ -142,6 +193,9 @@ func createTables() error {
 		protocols TEXT,
 		enabled BOOLEAN DEFAULT TRUE,
 		tag_date TIMESTAMP,
+		tag_message TEXT,
+		changelog TEXT,
+		deprecation TEXT,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (provider_id) REFERENCES providers(id) ON DELETE CASCADE,
 		UNIQUE(provider_id, version)
@@ -164,6 +218,73 @@ func createTables() error {
 		UNIQUE(version_id, os, arch)
 	);`
 
+	// Provider Channels table (named aliases such as latest/stable/beta pointing at a version)
+	providerChannelsTable := `
+	CREATE TABLE IF NOT EXISTS provider_channels (
+		id VARCHAR(255) PRIMARY KEY,
+		provider_id VARCHAR(255) NOT NULL,
+		name VARCHAR(50) NOT NULL,
+		version_id VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (provider_id) REFERENCES providers(id) ON DELETE CASCADE,
+		FOREIGN KEY (version_id) REFERENCES provider_versions(id) ON DELETE CASCADE,
+		UNIQUE(provider_id, name)
+	);`
+
+	// Provider Builds table (compiling a provider version from its Git source)
+	providerBuildsTable := `
+	CREATE TABLE IF NOT EXISTS provider_builds (
+		id VARCHAR(255) PRIMARY KEY,
+		provider_id VARCHAR(255) NOT NULL,
+		version_id VARCHAR(255) NOT NULL,
+		status VARCHAR(50) NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'running', 'success', 'partial', 'failed')),
+		platforms TEXT,
+		log TEXT,
+		go_version VARCHAR(64),
+		error TEXT,
+		started_at TIMESTAMP,
+		finished_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (provider_id) REFERENCES providers(id) ON DELETE CASCADE,
+		FOREIGN KEY (version_id) REFERENCES provider_versions(id) ON DELETE CASCADE
+	);`
+
+	// Provider Mirrors table (providers copied from an upstream registry on a schedule)
+	providerMirrorsTable := `
+	CREATE TABLE IF NOT EXISTS provider_mirrors (
+		id VARCHAR(255) PRIMARY KEY,
+		provider_id VARCHAR(255) NOT NULL UNIQUE,
+		upstream_source VARCHAR(500) NOT NULL,
+		version_constraint VARCHAR(255) NOT NULL,
+		last_synced_at TIMESTAMP,
+		last_error TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (provider_id) REFERENCES providers(id) ON DELETE CASCADE
+	);`
+
+	// Provider Version Downloads table (download analytics per version and consumer)
+	providerVersionDownloadsTable := `
+	CREATE TABLE IF NOT EXISTS provider_version_downloads (
+		version_id VARCHAR(255) NOT NULL REFERENCES provider_versions(id) ON DELETE CASCADE,
+		consumer VARCHAR(255) NOT NULL,
+		download_count INTEGER NOT NULL DEFAULT 0,
+		first_downloaded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_downloaded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (version_id, consumer)
+	);`
+
+	// Module Version Downloads table (download analytics per version and consumer)
+	moduleVersionDownloadsTable := `
+	CREATE TABLE IF NOT EXISTS module_version_downloads (
+		version_id VARCHAR(255) NOT NULL REFERENCES module_versions(id) ON DELETE CASCADE,
+		consumer VARCHAR(255) NOT NULL,
+		download_count INTEGER NOT NULL DEFAULT 0,
+		first_downloaded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_downloaded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (version_id, consumer)
+	);`
+
 	// Deployments table
 	deploymentsTable := `
 	CREATE TABLE IF NOT EXISTS deployments (
@@ -179,12 +300,43 @@ func createTables() error {
 		git_auth_data TEXT,
 		working_directory VARCHAR(500) DEFAULT '.',
 		terraform_vars TEXT,
+		terraform_workspace VARCHAR(255),
+		hooks TEXT,
+		runner_image VARCHAR(255),
+		auto_destroy_after VARCHAR(50),
+		auto_destroy_notified_at TIMESTAMP,
+		auto_destroy_attempted_at TIMESTAMP,
+		auto_destroy_attempts INTEGER DEFAULT 0,
+		auto_destroy_failed_at TIMESTAMP,
+		clone_options TEXT,
+		pipeline TEXT,
+		terragrunt TEXT,
+		plan_validity VARCHAR(50),
+		watch_paths TEXT,
+		registry_namespaces TEXT,
+		concurrency TEXT,
+		credential_status VARCHAR(20),
+		credential_error TEXT,
+		credential_checked_at TIMESTAMP,
+		credential_expires_at TIMESTAMP,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (namespace_id) REFERENCES namespaces(id) ON DELETE CASCADE,
 		UNIQUE(namespace_id, name)
 	);`
 
+	// Deployment templates (standard settings new deployments are created with)
+	deploymentTemplatesTable := `
+	CREATE TABLE IF NOT EXISTS deployment_templates (
+		id VARCHAR(255) PRIMARY KEY,
+		name VARCHAR(255) NOT NULL UNIQUE,
+		description TEXT,
+		git_url_pattern TEXT NOT NULL,
+		settings TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
 	// Deployment Runs table
 	deploymentRunsTable := `
 	CREATE TABLE IF NOT EXISTS deployment_runs (
@@ -192,30 +344,328 @@ func createTables() error {
 		deployment_id VARCHAR(255) NOT NULL,
 		path TEXT,
 		ref VARCHAR(255),
+		commit_sha VARCHAR(64),
 		tool VARCHAR(50),
+		tool_version VARCHAR(50),
 		env_vars TEXT,
 		tfvars_files TEXT,
 		init_flags TEXT,
 		plan_flags TEXT,
+		terraform_workspace VARCHAR(255),
 		status VARCHAR(50) NOT NULL DEFAULT 'pending',
 		init_log TEXT,
 		plan_log TEXT,
 		plan_output TEXT,
+		plan_json TEXT,
+		plan_expires_at TIMESTAMP,
+		approval_reminder_sent_at TIMESTAMP,
+		approval_comment TEXT,
+		change_ticket VARCHAR(255),
+		apply_not_before TIMESTAMP,
 		plan_file_path TEXT,
 		apply_log TEXT,
 		apply_output TEXT,
+		hook_log TEXT,
+		apply_report TEXT,
+		operation VARCHAR(50) NOT NULL DEFAULT 'apply',
+		operation_args TEXT,
+		parent_run_id VARCHAR(255),
+		reproduces_run_id VARCHAR(255),
+		stack_run_id VARCHAR(255),
+		operation_result TEXT,
+		code_changes TEXT,
 		error_message TEXT,
+		failure_category VARCHAR(50),
+		failure_hint TEXT,
+		state_lock TEXT,
+		command_exit TEXT,
+		plain_logs TEXT,
+		concurrency_group VARCHAR(100),
+		required_features TEXT,
 		work_dir TEXT,
+		runner_url TEXT,
+		run_manifest TEXT,
+		manifest_env_vars TEXT,
 		approved_by VARCHAR(255),
 		approved_at TIMESTAMP,
+		idempotency_key VARCHAR(255),
+		idempotency_fingerprint VARCHAR(64),
 		started_at TIMESTAMP,
 		completed_at TIMESTAMP,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (deployment_id) REFERENCES deployments(id) ON DELETE CASCADE,
-		CHECK(status IN ('pending', 'initializing', 'planning', 'planned', 'awaiting_approval', 'applying', 'applied', 'destroying', 'destroyed', 'success', 'failed', 'cancelled'))
+		CHECK(status IN (` + runStatuses + `))
+	);`
+
+	// Stack Runs table (runs of several paths of a deployment in dependency order)
+	stackRunsTable := `
+	CREATE TABLE IF NOT EXISTS stack_runs (
+		id VARCHAR(255) PRIMARY KEY,
+		deployment_id VARCHAR(255) NOT NULL,
+		ref VARCHAR(255) NOT NULL,
+		commit_sha VARCHAR(64) NOT NULL,
+		tool VARCHAR(50) NOT NULL,
+		env_vars TEXT,
+		tfvars_files TEXT,
+		init_flags TEXT,
+		plan_flags TEXT,
+		terraform_workspace VARCHAR(255),
+		operation VARCHAR(50) NOT NULL DEFAULT 'apply',
+		paths TEXT NOT NULL,
+		config_file VARCHAR(500),
+		status VARCHAR(50) NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'running', 'awaiting_approval', 'success', 'failed', 'cancelled')),
+		error_message TEXT,
+		idempotency_key VARCHAR(255),
+		idempotency_fingerprint VARCHAR(64),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		started_at TIMESTAMP,
+		completed_at TIMESTAMP,
+		FOREIGN KEY (deployment_id) REFERENCES deployments(id) ON DELETE CASCADE
+	);`
+
+	// Deployment Run Stages table (per-stage results of the runner pipeline)
+	deploymentRunStagesTable := `
+	CREATE TABLE IF NOT EXISTS deployment_run_stages (
+		run_id VARCHAR(255) NOT NULL,
+		name VARCHAR(50) NOT NULL,
+		position INTEGER NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		started_at TIMESTAMP,
+		completed_at TIMESTAMP,
+		duration_seconds DOUBLE PRECISION,
+		log TEXT,
+		error TEXT,
+		reused BOOLEAN NOT NULL DEFAULT false,
+		PRIMARY KEY (run_id, name),
+		FOREIGN KEY (run_id) REFERENCES deployment_runs(id) ON DELETE CASCADE
+	);`
+
+	// Module READMEs table (README content cached per module and ref; ref '' is the default branch)
+	moduleReadmesTable := `
+	CREATE TABLE IF NOT EXISTS module_readmes (
+		module_id VARCHAR(255) NOT NULL,
+		ref VARCHAR(255) NOT NULL,
+		content TEXT NOT NULL,
+		etag VARCHAR(64) NOT NULL,
+		fetched_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (module_id, ref),
+		FOREIGN KEY (module_id) REFERENCES modules(id) ON DELETE CASCADE
+	);`
+
+	// Module Examples table (main.tf of every example below a version's examples/ directory)
+	moduleExamplesTable := `
+	CREATE TABLE IF NOT EXISTS module_examples (
+		version_id VARCHAR(255) NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		path TEXT NOT NULL,
+		content TEXT NOT NULL,
+		PRIMARY KEY (version_id, name),
+		FOREIGN KEY (version_id) REFERENCES module_versions(id) ON DELETE CASCADE
+	);`
+
+	// Announcements table (banners, global or attached to one namespace, module or provider)
+	announcementsTable := `
+	CREATE TABLE IF NOT EXISTS announcements (
+		id VARCHAR(255) PRIMARY KEY,
+		title VARCHAR(255) NOT NULL,
+		message TEXT NOT NULL DEFAULT '',
+		severity VARCHAR(20) NOT NULL DEFAULT 'info' CHECK(severity IN ('info', 'warning', 'critical')),
+		namespace_id VARCHAR(255),
+		module_id VARCHAR(255),
+		provider_id VARCHAR(255),
+		starts_at TIMESTAMP NOT NULL,
+		ends_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		CHECK(num_nonnulls(namespace_id, module_id, provider_id) <= 1),
+		FOREIGN KEY (namespace_id) REFERENCES namespaces(id) ON DELETE CASCADE,
+		FOREIGN KEY (module_id) REFERENCES modules(id) ON DELETE CASCADE,
+		FOREIGN KEY (provider_id) REFERENCES providers(id) ON DELETE CASCADE
+	);`
+
+	// Deployment Run Inputs table (outputs of other deployments consumed by a run)
+	deploymentRunInputsTable := `
+	CREATE TABLE IF NOT EXISTS deployment_run_inputs (
+		run_id VARCHAR(255) NOT NULL,
+		variable VARCHAR(255) NOT NULL,
+		source_deployment_id VARCHAR(255) NOT NULL,
+		source_run_id VARCHAR(255) NOT NULL,
+		source_path VARCHAR(500) NOT NULL,
+		output_name VARCHAR(255) NOT NULL,
+		sensitive BOOLEAN NOT NULL DEFAULT false,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (run_id, variable),
+		FOREIGN KEY (run_id) REFERENCES deployment_runs(id) ON DELETE CASCADE,
+		FOREIGN KEY (source_deployment_id) REFERENCES deployments(id) ON DELETE CASCADE
+	);`
+
+	// Audit Events table (security-relevant actions such as revealing run secrets)
+	auditEventsTable := `
+	CREATE TABLE IF NOT EXISTS audit_events (
+		id VARCHAR(255) PRIMARY KEY,
+		action VARCHAR(100) NOT NULL,
+		actor VARCHAR(255) NOT NULL,
+		target_type VARCHAR(50) NOT NULL,
+		target_id VARCHAR(255) NOT NULL,
+		details TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Frontend sessions: a cookie standing in for an API key, with its CSRF token
+	sessionsTable := `
+	CREATE TABLE IF NOT EXISTS sessions (
+		id VARCHAR(255) PRIMARY KEY,
+		api_key_id VARCHAR(255) NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+		csrf_token VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMP NOT NULL
+	);`
+
+	// Authentication anomalies for security review
+	securityAlertsTable := `
+	CREATE TABLE IF NOT EXISTS security_alerts (
+		id VARCHAR(255) PRIMARY KEY,
+		type VARCHAR(50) NOT NULL,
+		api_key_id VARCHAR(255),
+		api_key_name VARCHAR(255),
+		client_ip VARCHAR(100) NOT NULL,
+		location VARCHAR(100),
+		details TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		acknowledged_at TIMESTAMP,
+		acknowledged_by VARCHAR(255)
+	);`
+
+	// Where each API key has been used from (country or IP network)
+	apiKeyLocationsTable := `
+	CREATE TABLE IF NOT EXISTS api_key_locations (
+		api_key_id VARCHAR(255) NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+		location VARCHAR(100) NOT NULL,
+		first_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		request_count INTEGER DEFAULT 0,
+		PRIMARY KEY (api_key_id, location)
+	);`
+
+	jobRunsTable := `
+	CREATE TABLE IF NOT EXISTS job_runs (
+		name VARCHAR(100) PRIMARY KEY,
+		last_run_at TIMESTAMP NOT NULL,
+		instance VARCHAR(255),
+		finished_at TIMESTAMP,
+		duration_ms BIGINT,
+		processed INTEGER,
+		last_error TEXT,
+		last_success_at TIMESTAMP,
+		consecutive_failures INTEGER NOT NULL DEFAULT 0
+	);`
+
+	leasesTable := `
+	CREATE TABLE IF NOT EXISTS leases (
+		name VARCHAR(255) PRIMARY KEY,
+		owner VARCHAR(255) NOT NULL,
+		expires_at TIMESTAMP NOT NULL
+	);`
+
+	// Digest subscriptions (an email address receiving the activity digest of a namespace,
+	// or of all namespaces when namespace_id is NULL)
+	digestSubscriptionsTable := `
+	CREATE TABLE IF NOT EXISTS digest_subscriptions (
+		id VARCHAR(255) PRIMARY KEY,
+		email VARCHAR(255) NOT NULL,
+		namespace_id VARCHAR(255) REFERENCES namespaces(id) ON DELETE CASCADE,
+		frequency VARCHAR(10) NOT NULL CHECK(frequency IN ('daily', 'weekly')),
+		last_sent_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Inbox items an API key has read (see GET /api/inbox)
+	inboxReadsTable := `
+	CREATE TABLE IF NOT EXISTS inbox_reads (
+		api_key_id VARCHAR(255) NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+		item_id VARCHAR(512) NOT NULL,
+		read_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (api_key_id, item_id)
+	);`
+
+	// Hosts that git repositories (kind git) and mirrored artifacts (kind artifact) may
+	// come from; an empty list for a kind allows any host
+	sourceHostsTable := `
+	CREATE TABLE IF NOT EXISTS source_hosts (
+		id VARCHAR(255) PRIMARY KEY,
+		kind VARCHAR(20) NOT NULL CHECK(kind IN ('git', 'artifact')),
+		pattern VARCHAR(255) NOT NULL,
+		description TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(kind, pattern)
+	);`
+
+	// Previous registry addresses of modules and providers moved to another namespace;
+	// provider is empty for providers
+	registryRedirectsTable := `
+	CREATE TABLE IF NOT EXISTS registry_redirects (
+		id VARCHAR(255) PRIMARY KEY,
+		kind VARCHAR(20) NOT NULL CHECK(kind IN ('module', 'provider')),
+		namespace VARCHAR(255) NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		provider VARCHAR(255) NOT NULL DEFAULT '',
+		target_id VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(kind, namespace, name, provider)
+	);`
+
+	// Other addresses the registry protocol serves a module under, during a migration window
+	moduleAliasesTable := `
+	CREATE TABLE IF NOT EXISTS module_aliases (
+		id VARCHAR(255) PRIMARY KEY,
+		module_id VARCHAR(255) NOT NULL,
+		namespace VARCHAR(255) NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		provider VARCHAR(255) NOT NULL,
+		expires_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (module_id) REFERENCES modules(id) ON DELETE CASCADE,
+		UNIQUE(namespace, name, provider)
+	);`
+
+	// Platform-wide settings changed at runtime, as JSON by key (e.g. maintenance mode)
+	platformSettingsTable := `
+	CREATE TABLE IF NOT EXISTS platform_settings (
+		key VARCHAR(100) PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_by VARCHAR(255),
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Stored rollout of feature flags; namespaces is a JSON array of namespace names
+	featureFlagsTable := `
+	CREATE TABLE IF NOT EXISTS feature_flags (
+		key VARCHAR(100) PRIMARY KEY,
+		enabled BOOLEAN NOT NULL DEFAULT FALSE,
+		namespaces TEXT NOT NULL DEFAULT '[]',
+		percentage INTEGER NOT NULL DEFAULT 0 CHECK(percentage BETWEEN 0 AND 100),
+		updated_by VARCHAR(255),
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Notifications the webhook did not accept after all retries, kept for redelivery;
+	// payload is the event as it was posted
+	deadLettersTable := `
+	CREATE TABLE IF NOT EXISTS dead_letters (
+		id VARCHAR(255) PRIMARY KEY,
+		event_type VARCHAR(100) NOT NULL,
+		payload TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		redelivered_at TIMESTAMP,
+		redelivered_by VARCHAR(255)
 	);`
 
 	tables := []string{
+		organizationsTable,
 		namespacesTable,
 		apiKeysTable,
 		modulesTable,
@@ -223,8 +673,34 @@ func createTables() error {
 		providersTable,
 		providerVersionsTable,
 		providerPlatformsTable,
+		providerChannelsTable,
+		providerBuildsTable,
+		providerMirrorsTable,
+		providerVersionDownloadsTable,
+		moduleVersionDownloadsTable,
 		deploymentsTable,
+		deploymentTemplatesTable,
 		deploymentRunsTable,
+		deploymentRunStagesTable,
+		stackRunsTable,
+		deploymentRunInputsTable,
+		moduleReadmesTable,
+		moduleExamplesTable,
+		announcementsTable,
+		auditEventsTable,
+		sessionsTable,
+		securityAlertsTable,
+		apiKeyLocationsTable,
+		jobRunsTable,
+		leasesTable,
+		digestSubscriptionsTable,
+		inboxReadsTable,
+		sourceHostsTable,
+		registryRedirectsTable,
+		moduleAliasesTable,
+		platformSettingsTable,
+		featureFlagsTable,
+		deadLettersTable,
 	}
 
 	for _, table := range tables {
@@ -233,6 +709,120 @@ func createTables() error {
 		}
 	}
 
+	// Columns added after the initial schema. CREATE TABLE IF NOT EXISTS does not
+	// touch existing tables, so upgrade them in place.
+	migrations := []string{
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS terraform_workspace VARCHAR(255)`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS terraform_workspace VARCHAR(255)`,
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS hooks TEXT`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS hook_log TEXT`,
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS runner_image VARCHAR(255)`,
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS auto_destroy_after VARCHAR(50)`,
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS auto_destroy_notified_at TIMESTAMP`,
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS auto_destroy_attempted_at TIMESTAMP`,
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS auto_destroy_attempts INTEGER DEFAULT 0`,
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS auto_destroy_failed_at TIMESTAMP`,
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS clone_options TEXT`,
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS watch_paths TEXT`,
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS pipeline TEXT`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS commit_sha VARCHAR(64)`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS plan_json TEXT`,
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS plan_validity VARCHAR(50)`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS plan_expires_at TIMESTAMP`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS approval_comment TEXT`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS change_ticket VARCHAR(255)`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS apply_not_before TIMESTAMP`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS apply_report TEXT`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS operation VARCHAR(50) NOT NULL DEFAULT 'apply'`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS operation_args TEXT`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS parent_run_id VARCHAR(255)`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS stack_run_id VARCHAR(255)`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS operation_result TEXT`,
+		`ALTER TABLE deployment_runs DROP CONSTRAINT IF EXISTS deployment_runs_status_check`,
+		`ALTER TABLE deployment_runs ADD CONSTRAINT deployment_runs_status_check CHECK(status IN (` + runStatuses + `))`,
+		`ALTER TABLE api_keys DROP CONSTRAINT IF EXISTS api_keys_permissions_check`,
+		`ALTER TABLE api_keys ADD CONSTRAINT api_keys_permissions_check CHECK(permissions IN (` + apiKeyPermissions + `))`,
+		`ALTER TABLE modules ADD COLUMN IF NOT EXISTS credential_status VARCHAR(20)`,
+		`ALTER TABLE modules ADD COLUMN IF NOT EXISTS credential_error TEXT`,
+		`ALTER TABLE modules ADD COLUMN IF NOT EXISTS credential_checked_at TIMESTAMP`,
+		`ALTER TABLE modules ADD COLUMN IF NOT EXISTS credential_expires_at TIMESTAMP`,
+		`ALTER TABLE providers ADD COLUMN IF NOT EXISTS credential_status VARCHAR(20)`,
+		`ALTER TABLE providers ADD COLUMN IF NOT EXISTS credential_error TEXT`,
+		`ALTER TABLE providers ADD COLUMN IF NOT EXISTS credential_checked_at TIMESTAMP`,
+		`ALTER TABLE providers ADD COLUMN IF NOT EXISTS credential_expires_at TIMESTAMP`,
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS credential_status VARCHAR(20)`,
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS credential_error TEXT`,
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS credential_checked_at TIMESTAMP`,
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS credential_expires_at TIMESTAMP`,
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS terragrunt TEXT`,
+		`ALTER TABLE module_versions ADD COLUMN IF NOT EXISTS examples_synced_at TIMESTAMP`,
+		`ALTER TABLE module_versions ADD COLUMN IF NOT EXISTS variables TEXT`,
+		`ALTER TABLE namespaces ADD COLUMN IF NOT EXISTS owner_emails TEXT`,
+		`ALTER TABLE namespaces ADD COLUMN IF NOT EXISTS support_contact TEXT`,
+		`ALTER TABLE namespaces ADD COLUMN IF NOT EXISTS links TEXT`,
+		`ALTER TABLE namespaces ADD COLUMN IF NOT EXISTS logo_url TEXT`,
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS registry_namespaces TEXT`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(255)`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS idempotency_fingerprint VARCHAR(64)`,
+		`ALTER TABLE stack_runs ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(255)`,
+		`ALTER TABLE stack_runs ADD COLUMN IF NOT EXISTS idempotency_fingerprint VARCHAR(64)`,
+		// Idempotency-Key is unique per deployment, so concurrent retries cannot both insert
+		`CREATE UNIQUE INDEX IF NOT EXISTS deployment_runs_idempotency_key ON deployment_runs (deployment_id, idempotency_key) WHERE idempotency_key IS NOT NULL`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS stack_runs_idempotency_key ON stack_runs (deployment_id, idempotency_key) WHERE idempotency_key IS NOT NULL`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS approval_reminder_sent_at TIMESTAMP`,
+		`ALTER TABLE namespaces ADD COLUMN IF NOT EXISTS organization_id VARCHAR(255) REFERENCES organizations(id) ON DELETE SET NULL`,
+		`ALTER TABLE providers ADD COLUMN IF NOT EXISTS readme_abstract TEXT`,
+		`ALTER TABLE providers ADD COLUMN IF NOT EXISTS repository_description TEXT`,
+		`ALTER TABLE providers ADD COLUMN IF NOT EXISTS topics TEXT`,
+		`ALTER TABLE providers ADD COLUMN IF NOT EXISTS catalog_synced_at TIMESTAMP`,
+		`ALTER TABLE modules ADD COLUMN IF NOT EXISTS auto_enable_rule TEXT`,
+		`ALTER TABLE providers ADD COLUMN IF NOT EXISTS auto_enable_rule TEXT`,
+		`ALTER TABLE module_versions ADD COLUMN IF NOT EXISTS tag_message TEXT`,
+		`ALTER TABLE module_versions ADD COLUMN IF NOT EXISTS changelog TEXT`,
+		`ALTER TABLE provider_versions ADD COLUMN IF NOT EXISTS tag_message TEXT`,
+		`ALTER TABLE provider_versions ADD COLUMN IF NOT EXISTS changelog TEXT`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS code_changes TEXT`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS failure_category VARCHAR(50)`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS failure_hint TEXT`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS state_lock TEXT`,
+		`ALTER TABLE providers ADD COLUMN IF NOT EXISTS build_go_version VARCHAR(64)`,
+		`ALTER TABLE provider_builds ADD COLUMN IF NOT EXISTS go_version VARCHAR(64)`,
+		`ALTER TABLE module_versions ADD COLUMN IF NOT EXISTS deprecation TEXT`,
+		`ALTER TABLE provider_versions ADD COLUMN IF NOT EXISTS deprecation TEXT`,
+		`ALTER TABLE namespaces ADD COLUMN IF NOT EXISTS storage_quota_bytes BIGINT`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS runner_url TEXT`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS tool_version VARCHAR(50)`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS run_manifest TEXT`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS manifest_env_vars TEXT`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS reproduces_run_id VARCHAR(255)`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS command_exit TEXT`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS plain_logs TEXT`,
+		`ALTER TABLE deployments ADD COLUMN IF NOT EXISTS concurrency TEXT`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS concurrency_group VARCHAR(100)`,
+		`ALTER TABLE deployment_runs ADD COLUMN IF NOT EXISTS required_features TEXT`,
+		`ALTER TABLE job_runs ADD COLUMN IF NOT EXISTS finished_at TIMESTAMP`,
+		`ALTER TABLE job_runs ADD COLUMN IF NOT EXISTS duration_ms BIGINT`,
+		`ALTER TABLE job_runs ADD COLUMN IF NOT EXISTS processed INTEGER`,
+		`ALTER TABLE job_runs ADD COLUMN IF NOT EXISTS last_error TEXT`,
+		`ALTER TABLE job_runs ADD COLUMN IF NOT EXISTS last_success_at TIMESTAMP`,
+		`ALTER TABLE job_runs ADD COLUMN IF NOT EXISTS consecutive_failures INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE namespaces ADD COLUMN IF NOT EXISTS runner_assignment TEXT`,
+		`ALTER TABLE namespaces ADD COLUMN IF NOT EXISTS default_env_vars TEXT`,
+		// One build in progress per provider version, so concurrent requests cannot both start
+		// one; older duplicates from before the index are failed first
+		`UPDATE provider_builds b SET status = 'failed', error = 'Superseded by a newer build', finished_at = NOW()
+		 WHERE status IN ('pending', 'running') AND EXISTS (
+			SELECT 1 FROM provider_builds o
+			WHERE o.version_id = b.version_id AND o.status IN ('pending', 'running') AND (o.created_at, o.id) > (b.created_at, b.id))`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS provider_builds_in_progress ON provider_builds (version_id) WHERE status IN ('pending', 'running')`,
+	}
+
+	for _, migration := range migrations {
+		if _, err := DB.Exec(migration); err != nil {
+			return err
+		}
+	}
+
 	// Create default namespace if not exists
 	_, err := DB.Exec(`
 		INSERT INTO namespaces (id, name, description, is_public)
@@ -0,0 +1,187 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// With POSTGRES_REPLICA_DSN set, registry protocol reads and list endpoints go to a
+// read-only replica while everything else uses DB (the primary). Reads fall back to
+// the primary when the replica lags more than REPLICA_MAX_LAG, and rows this instance
+// changed recently (see MarkWritten) are read from the primary until the replica has
+// caught up.
+
+var (
+	replica *sql.DB
+
+	replicaMu      sync.RWMutex
+	replicaLag     time.Duration
+	replicaHealthy bool
+	lastWrite      time.Time
+	recentWrites   = map[string]time.Time{}
+)
+
+// replicaLagInterval is how often the replica's replication lag is measured
+const replicaLagInterval = 5 * time.Second
+
+func replicaDuration(env string, def time.Duration) time.Duration {
+	if value := os.Getenv(env); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			return d
+		}
+		log.Printf("Warning: invalid %s %q, using %s", env, value, def)
+	}
+	return def
+}
+
+// replicaMaxLag is the replication lag beyond which all reads use the primary
+// (REPLICA_MAX_LAG, default 10s)
+func replicaMaxLag() time.Duration {
+	return replicaDuration("REPLICA_MAX_LAG", 10*time.Second)
+}
+
+// replicaStickyWindow is how long rows written by this instance are read from the
+// primary (REPLICA_STICKY_WINDOW, default 5s, and never less than the current lag plus
+// a second)
+func replicaStickyWindow() time.Duration {
+	window := replicaDuration("REPLICA_STICKY_WINDOW", 5*time.Second)
+	replicaMu.RLock()
+	lag := replicaLag
+	replicaMu.RUnlock()
+	if lag+time.Second > window {
+		return lag + time.Second
+	}
+	return window
+}
+
+// initReplica connects to the replica when POSTGRES_REPLICA_DSN is set. An unreachable
+// replica is not fatal: reads use the primary until it responds.
+func initReplica() error {
+	dsn := os.Getenv("POSTGRES_REPLICA_DSN")
+	if dsn == "" {
+		return nil
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return err
+	}
+	replica = db
+	checkReplicaLag()
+	go func() {
+		for range time.Tick(replicaLagInterval) {
+			checkReplicaLag()
+		}
+	}()
+	log.Printf("Read replica configured (max lag %s)", replicaMaxLag())
+	return nil
+}
+
+// checkReplicaLag measures how far the replica is behind; a replica that has replayed
+// everything it received counts as caught up even when the primary has been idle
+func checkReplicaLag() {
+	var seconds float64
+	err := replica.QueryRow(`
+		SELECT CASE
+			WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+		END
+	`).Scan(&seconds)
+	lag := time.Duration(seconds * float64(time.Second))
+	healthy := err == nil && lag <= replicaMaxLag()
+
+	replicaMu.Lock()
+	wasHealthy := replicaHealthy
+	replicaLag, replicaHealthy = lag, healthy
+	replicaMu.Unlock()
+
+	switch {
+	case err != nil && wasHealthy:
+		log.Printf("Warning: read replica unavailable, reading from the primary: %v", err)
+	case err == nil && !healthy && wasHealthy:
+		log.Printf("Warning: read replica is %s behind, reading from the primary", lag.Round(time.Millisecond))
+	case healthy && !wasHealthy:
+		log.Printf("Read replica caught up (lag %s)", lag.Round(time.Millisecond))
+	}
+}
+
+// Replica returns the replica when one is configured and within REPLICA_MAX_LAG, and the
+// primary otherwise. Callers must check RecentlyWritten for the rows they read.
+func Replica() *sql.DB {
+	if replica == nil {
+		return DB
+	}
+	replicaMu.RLock()
+	defer replicaMu.RUnlock()
+	if !replicaHealthy {
+		return DB
+	}
+	return replica
+}
+
+// Reader returns the database list endpoints read from: the replica, unless this
+// instance wrote registry rows within the sticky window
+func Reader() *sql.DB {
+	db := Replica()
+	if db == DB {
+		return DB
+	}
+	replicaMu.RLock()
+	written := lastWrite
+	replicaMu.RUnlock()
+	if time.Since(written) < replicaStickyWindow() {
+		return DB
+	}
+	return db
+}
+
+// MarkWritten records that rows belonging to ids (module, provider or version IDs)
+// were just changed, so reads of them use the primary for a while
+func MarkWritten(ids ...string) {
+	if replica == nil {
+		return
+	}
+	now := time.Now()
+	window := replicaStickyWindow()
+	replicaMu.Lock()
+	defer replicaMu.Unlock()
+	lastWrite = now
+	for _, id := range ids {
+		recentWrites[id] = now
+	}
+	for id, at := range recentWrites {
+		if now.Sub(at) > window {
+			delete(recentWrites, id)
+		}
+	}
+}
+
+// RecentlyWritten reports whether MarkWritten was called for id within the sticky window
+func RecentlyWritten(id string) bool {
+	if replica == nil {
+		return false
+	}
+	replicaMu.RLock()
+	at, ok := recentWrites[id]
+	replicaMu.RUnlock()
+	return ok && time.Since(at) < replicaStickyWindow()
+}
+
+// ReplicaStatus describes the replica for health reporting
+type ReplicaStatus struct {
+	Configured bool    `json:"configured"`
+	Healthy    bool    `json:"healthy"`
+	LagSeconds float64 `json:"lag_seconds"`
+}
+
+// GetReplicaStatus returns whether a replica is configured, in use and how far behind it is
+func GetReplicaStatus() ReplicaStatus {
+	if replica == nil {
+		return ReplicaStatus{}
+	}
+	replicaMu.RLock()
+	defer replicaMu.RUnlock()
+	return ReplicaStatus{Configured: true, Healthy: replicaHealthy, LagSeconds: replicaLag.Seconds()}
+}
@@ -0,0 +1,212 @@
+// Package digest summarizes platform activity per namespace (new module and provider
+// versions, failed runs, expiring git credentials) and sends it to the subscribers of
+// the daily and weekly digests through the notification webhook.
+package digest
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"iac-tool/internal/credentials"
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+	"iac-tool/internal/notify"
+)
+
+// Periods covered by each frequency
+var periods = map[string]time.Duration{
+	"daily":  24 * time.Hour,
+	"weekly": 7 * 24 * time.Hour,
+}
+
+// Period returns how much activity a digest of the given frequency covers
+func Period(frequency string) time.Duration {
+	return periods[frequency]
+}
+
+// builder collects the activity of each namespace while the queries are scanned
+type builder struct {
+	byID map[string]*models.NamespaceDigest
+}
+
+// namespace returns the digest of a namespace, adding it on first use
+func (b *builder) namespace(id, name string) *models.NamespaceDigest {
+	ns := b.byID[id]
+	if ns == nil {
+		ns = &models.NamespaceDigest{
+			NamespaceID:         id,
+			Namespace:           name,
+			NewVersions:         []models.DigestVersion{},
+			FailedRuns:          []models.DigestRun{},
+			ExpiringCredentials: []models.DigestCredential{},
+		}
+		b.byID[id] = ns
+	}
+	return ns
+}
+
+// Build summarizes the activity between since and until, of one namespace or, with an
+// empty namespaceID, of all of them. Credentials are reported by their current status.
+func Build(namespaceID string, since, until time.Time) (*models.Digest, error) {
+	db := database.Reader()
+	b := &builder{byID: make(map[string]*models.NamespaceDigest)}
+
+	rows, err := db.Query(`
+		SELECT n.id, n.name, 'module', m.id, m.name || '/' || m.provider, v.version, v.enabled, v.created_at
+		FROM module_versions v
+		JOIN modules m ON v.module_id = m.id
+		JOIN namespaces n ON m.namespace_id = n.id
+		WHERE v.created_at >= $1 AND v.created_at < $2 AND ($3 = '' OR n.id = $3)
+		UNION ALL
+		SELECT n.id, n.name, 'provider', p.id, p.name, v.version, COALESCE(v.enabled, TRUE), v.created_at
+		FROM provider_versions v
+		JOIN providers p ON v.provider_id = p.id
+		JOIN namespaces n ON p.namespace_id = n.id
+		WHERE v.created_at >= $1 AND v.created_at < $2 AND ($3 = '' OR n.id = $3)
+		ORDER BY 8
+	`, since, until, namespaceID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var nsID, nsName string
+		var v models.DigestVersion
+		if err := rows.Scan(&nsID, &nsName, &v.Kind, &v.ID, &v.Name, &v.Version, &v.Enabled, &v.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ns := b.namespace(nsID, nsName)
+		ns.NewVersions = append(ns.NewVersions, v)
+	}
+	rows.Close()
+
+	rows, err = db.Query(`
+		SELECT n.id, n.name, r.id, d.id, d.name, COALESCE(r.path, ''), r.operation, r.failure_category, r.completed_at
+		FROM deployment_runs r
+		JOIN deployments d ON r.deployment_id = d.id
+		JOIN namespaces n ON d.namespace_id = n.id
+		WHERE r.status = 'failed' AND r.completed_at >= $1 AND r.completed_at < $2 AND ($3 = '' OR n.id = $3)
+		ORDER BY r.completed_at
+	`, since, until, namespaceID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var nsID, nsName string
+		var r models.DigestRun
+		if err := rows.Scan(&nsID, &nsName, &r.RunID, &r.DeploymentID, &r.Deployment, &r.Path, &r.Operation, &r.FailureCategory, &r.CompletedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ns := b.namespace(nsID, nsName)
+		ns.FailedRuns = append(ns.FailedRuns, r)
+	}
+	rows.Close()
+
+	var selects []string
+	for _, table := range []string{"modules", "providers", "deployments"} {
+		selects = append(selects, fmt.Sprintf(`
+			SELECT n.id, n.name, '%[1]s', t.id, t.name, t.credential_status, t.credential_expires_at
+			FROM %[1]s t
+			JOIN namespaces n ON t.namespace_id = n.id
+			WHERE t.credential_status IN ('%[2]s', '%[3]s') AND ($1 = '' OR n.id = $1)`,
+			table, credentials.StatusExpiring, credentials.StatusExpired))
+	}
+	rows, err = db.Query(strings.Join(selects, " UNION ALL ")+" ORDER BY 7", namespaceID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var nsID, nsName string
+		var cred models.DigestCredential
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&nsID, &nsName, &cred.ResourceType, &cred.ResourceID, &cred.Name, &cred.Status, &expiresAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if expiresAt.Valid {
+			cred.ExpiresAt = &expiresAt.Time
+		}
+		ns := b.namespace(nsID, nsName)
+		ns.ExpiringCredentials = append(ns.ExpiringCredentials, cred)
+	}
+	rows.Close()
+
+	digest := &models.Digest{Since: since, Until: until, Namespaces: []models.NamespaceDigest{}}
+	for _, ns := range b.byID {
+		digest.Namespaces = append(digest.Namespaces, *ns)
+	}
+	sort.Slice(digest.Namespaces, func(i, j int) bool { return digest.Namespaces[i].Namespace < digest.Namespaces[j].Namespace })
+	return digest, nil
+}
+
+// summary is the one-line message of a digest notification
+func summary(frequency string, d *models.Digest) string {
+	var versions, failed, creds int
+	for _, ns := range d.Namespaces {
+		versions += len(ns.NewVersions)
+		failed += len(ns.FailedRuns)
+		creds += len(ns.ExpiringCredentials)
+	}
+	return fmt.Sprintf("%s digest: %d new versions, %d failed runs, %d expiring credentials in %d namespaces",
+		strings.ToUpper(frequency[:1])+frequency[1:], versions, failed, creds, len(d.Namespaces))
+}
+
+// SendDue sends the digest of every subscription whose period has elapsed since it was
+// last sent (or created) as a digest notification addressed to the subscriber. Digests
+// without any activity are skipped, but still count as sent. It returns the number of
+// digests sent.
+func SendDue() (int, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, email, COALESCE(namespace_id, ''), frequency, COALESCE(last_sent_at, created_at)
+		FROM digest_subscriptions
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list digest subscriptions: %w", err)
+	}
+	type subscription struct {
+		id, email, namespaceID, frequency string
+		since                             time.Time
+	}
+	var due []subscription
+	now := time.Now()
+	for rows.Next() {
+		var s subscription
+		if err := rows.Scan(&s.id, &s.email, &s.namespaceID, &s.frequency, &s.since); err != nil {
+			continue
+		}
+		if period := Period(s.frequency); period > 0 && !s.since.Add(period).After(now) {
+			due = append(due, s)
+		}
+	}
+	rows.Close()
+
+	sent := 0
+	var lastErr error
+	for _, s := range due {
+		d, err := Build(s.namespaceID, s.since, now)
+		if err != nil {
+			log.Printf("Digest: failed to build digest for subscription %s: %v", s.id, err)
+			lastErr = err
+			continue
+		}
+		if len(d.Namespaces) > 0 {
+			notify.Send("digest", summary(s.frequency, d), map[string]interface{}{
+				"subscription_id": s.id,
+				"email":           s.email,
+				"frequency":       s.frequency,
+				"digest":          d,
+			})
+		}
+		database.DB.Exec(`UPDATE digest_subscriptions SET last_sent_at = $1 WHERE id = $2`, now, s.id)
+		sent++
+	}
+	if lastErr != nil {
+		return sent, fmt.Errorf("%d of %d digests could not be built, last: %w", len(due)-sent, len(due), lastErr)
+	}
+	return sent, nil
+}
@@ -0,0 +1,195 @@
+// Package features holds the feature flags that roll risky capabilities out gradually. A
+// flag is on for everyone, for the namespaces listed, or for a percentage of namespaces
+// picked by a stable hash, so a namespace keeps its answer as the percentage grows. Flags
+// are stored in feature_flags and changed at runtime through the admin API; a flag without
+// a stored row has its default.
+package features
+
+import (
+	"database/sql"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"iac-tool/internal/database"
+)
+
+// Known flags
+const (
+	NetworkMirror = "network_mirror" // Mirrors of upstream providers (/api/provider-mirrors)
+	AutoApply     = "auto_apply"     // apply.auto_approve in platform.yaml
+)
+
+// Definition describes a known flag
+type Definition struct {
+	Description string
+	Default     bool // State without a stored row
+}
+
+// Definitions are the flags that can be set; auto_apply defaults to on because
+// platform.yaml could turn it on before it was a flag
+var Definitions = map[string]Definition{
+	NetworkMirror: {Description: "Mirror upstream providers into the namespace and sync them on a schedule"},
+	AutoApply:     {Description: "Apply plans without approval when platform.yaml sets apply.auto_approve", Default: true},
+}
+
+// refreshInterval is how long an instance uses the flags it read last
+const refreshInterval = 5 * time.Second
+
+// Flag is the rollout of a feature flag
+type Flag struct {
+	Key         string     `json:"key"`
+	Description string     `json:"description"`
+	Enabled     bool       `json:"enabled"`              // On for everyone
+	Namespaces  []string   `json:"namespaces"`           // On for these namespaces
+	Percentage  int        `json:"percentage"`           // On for this share of the other namespaces
+	Stored      bool       `json:"stored"`               // false while the flag has its default
+	UpdatedBy   string     `json:"updated_by,omitempty"` // API key that changed it last
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+var (
+	mu       sync.Mutex
+	stored   map[string]Flag
+	loadedAt time.Time
+)
+
+// defaultFlag returns a known flag in its default state
+func defaultFlag(key string) Flag {
+	def := Definitions[key]
+	return Flag{Key: key, Description: def.Description, Enabled: def.Default, Namespaces: []string{}}
+}
+
+// load returns the stored flags. They are read again at most every few seconds; while the
+// database cannot be read, the flags read last are kept.
+func load() map[string]Flag {
+	mu.Lock()
+	defer mu.Unlock()
+	if stored != nil && time.Since(loadedAt) < refreshInterval {
+		return stored
+	}
+
+	rows, err := database.DB.Query(`SELECT key, enabled, namespaces, percentage, updated_by, updated_at FROM feature_flags`)
+	if err != nil {
+		log.Printf("Features: failed to read feature flags, keeping the last ones: %v", err)
+		return stored
+	}
+	defer rows.Close()
+
+	flags := map[string]Flag{}
+	for rows.Next() {
+		var f Flag
+		var namespaces string
+		var updatedBy sql.NullString
+		var updatedAt time.Time
+		if err := rows.Scan(&f.Key, &f.Enabled, &namespaces, &f.Percentage, &updatedBy, &updatedAt); err != nil {
+			log.Printf("Features: failed to read feature flags, keeping the last ones: %v", err)
+			return stored
+		}
+		if _, known := Definitions[f.Key]; !known {
+			continue
+		}
+		f.Description = Definitions[f.Key].Description
+		f.Namespaces = []string{}
+		json.Unmarshal([]byte(namespaces), &f.Namespaces)
+		f.Stored = true
+		f.UpdatedBy = updatedBy.String
+		f.UpdatedAt = &updatedAt
+		flags[f.Key] = f
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Features: failed to read feature flags, keeping the last ones: %v", err)
+		return stored
+	}
+	stored, loadedAt = flags, time.Now()
+	return stored
+}
+
+// Get returns a known flag, stored or default
+func Get(key string) Flag {
+	if f, ok := load()[key]; ok {
+		return f
+	}
+	return defaultFlag(key)
+}
+
+// All returns the known flags, sorted by key
+func All() []Flag {
+	flags := make([]Flag, 0, len(Definitions))
+	for key := range Definitions {
+		flags = append(flags, Get(key))
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Key < flags[j].Key })
+	return flags
+}
+
+// EnabledFor reports whether the flag is on for a namespace (by name); an empty namespace
+// only gets flags that are on for everyone
+func (f Flag) EnabledFor(namespace string) bool {
+	if f.Enabled || f.Percentage >= 100 {
+		return true
+	}
+	if namespace == "" {
+		return false
+	}
+	for _, ns := range f.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return f.Percentage > 0 && bucket(f.Key, namespace) < f.Percentage
+}
+
+// bucket places a namespace in 0-99 for a flag, so each flag rolls out to a different
+// first share of namespaces
+func bucket(key, namespace string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key + "/" + namespace))
+	return int(h.Sum32() % 100)
+}
+
+// Enabled reports whether a known flag is on for a namespace; unknown flags are off
+func Enabled(key, namespace string) bool {
+	if _, known := Definitions[key]; !known {
+		return false
+	}
+	return Get(key).EnabledFor(namespace)
+}
+
+// Set stores the rollout of a known flag for all instances
+func Set(key string, enabled bool, namespaces []string, percentage int, actor string) (Flag, error) {
+	if namespaces == nil {
+		namespaces = []string{}
+	}
+	value, _ := json.Marshal(namespaces)
+	now := time.Now()
+	_, err := database.DB.Exec(`
+		INSERT INTO feature_flags (key, enabled, namespaces, percentage, updated_by, updated_at) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (key) DO UPDATE SET enabled = EXCLUDED.enabled, namespaces = EXCLUDED.namespaces,
+			percentage = EXCLUDED.percentage, updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at
+	`, key, enabled, string(value), percentage, actor, now)
+	if err != nil {
+		return Flag{}, err
+	}
+	invalidate()
+	return Get(key), nil
+}
+
+// Reset removes the stored rollout of a flag, so it has its default again
+func Reset(key string) error {
+	if _, err := database.DB.Exec(`DELETE FROM feature_flags WHERE key = $1`, key); err != nil {
+		return err
+	}
+	invalidate()
+	return nil
+}
+
+// invalidate makes the next lookup read the flags again
+func invalidate() {
+	mu.Lock()
+	loadedAt = time.Time{}
+	mu.Unlock()
+}
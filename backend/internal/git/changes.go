@@ -0,0 +1,217 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"iac-tool/internal/retry"
+)
+
+// ErrFileNotFound is returned by FileAtCommit when the commit has no such file
+var ErrFileNotFound = errors.New("file not found")
+
+// IsZeroSHA reports whether sha is the all-zero ID git hosts send for created or deleted branches
+func IsZeroSHA(sha string) bool {
+	return sha != "" && strings.Trim(sha, "0") == ""
+}
+
+// ChangedFiles lists the paths that differ between two commits. Only the two commits'
+// trees are fetched (depth 1, no blobs), so this stays cheap for large monorepos.
+func ChangedFiles(repoURL, from, to string, auth *AuthConfig) ([]string, error) {
+	var output string
+	err := withCommits(repoURL, auth, true, []string{from, to}, func(run func(args ...string) (string, error)) error {
+		// Renames are reported as a delete plus an add so both paths count as changed,
+		// and rename detection would otherwise download the blobs we skipped
+		var err error
+		output, err = run("diff", "--name-only", "--no-renames", from, to)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0)
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
+
+// FileAtCommit reads a file as of an exact commit (or the tip of a branch or tag)
+func FileAtCommit(repoURL, commit, filePath string, auth *AuthConfig) (string, error) {
+	var content string
+	err := withCommits(repoURL, auth, false, []string{commit}, func(run func(args ...string) (string, error)) error {
+		var err error
+		if content, err = run("show", "FETCH_HEAD:"+strings.TrimPrefix(filePath, "./")); err != nil {
+			return fmt.Errorf("%w: %s", ErrFileNotFound, filePath)
+		}
+		return nil
+	})
+	return content, err
+}
+
+// Example is a usage example shipped with a module
+type Example struct {
+	Name    string // Directory below the examples directory, e.g. "complete"
+	Path    string // Path of the example's main.tf in the repository
+	Content string
+}
+
+// Examples reads the main.tf of every example below dir (e.g. "examples" or
+// "modules/vpc/examples") as of ref. A missing examples directory is not an error.
+func Examples(repoURL, ref, dir string, auth *AuthConfig) ([]Example, error) {
+	dir = strings.Trim(path.Clean("/"+dir), "/")
+	examples := make([]Example, 0)
+	err := withCommits(repoURL, auth, false, []string{ref}, func(run func(args ...string) (string, error)) error {
+		files, err := run("ls-tree", "-r", "--name-only", "FETCH_HEAD", "--", dir)
+		if err != nil {
+			return err
+		}
+		for _, file := range strings.Split(files, "\n") {
+			if path.Base(file) != "main.tf" || !strings.HasPrefix(file, dir+"/") {
+				continue
+			}
+			name := strings.TrimPrefix(path.Dir(file), dir+"/")
+			if name == dir {
+				continue
+			}
+			content, err := run("show", "FETCH_HEAD:"+file)
+			if err != nil {
+				return err
+			}
+			examples = append(examples, Example{Name: name, Path: file, Content: content})
+		}
+		return nil
+	})
+	return examples, err
+}
+
+// TerraformFiles reads the .tf files directly in dir ("" for the repository root) as of
+// ref, keyed by file name
+func TerraformFiles(repoURL, ref, dir string, auth *AuthConfig) (map[string]string, error) {
+	return DirectoryFiles(repoURL, ref, dir, auth, func(name string) bool { return strings.HasSuffix(name, ".tf") })
+}
+
+// DirectoryFiles reads the files directly in dir ("" for the repository root) as of ref
+// whose names match, keyed by file name
+func DirectoryFiles(repoURL, ref, dir string, auth *AuthConfig, match func(name string) bool) (map[string]string, error) {
+	dir = strings.Trim(path.Clean("/"+dir), "/")
+	tree, prefix := "FETCH_HEAD", "FETCH_HEAD:"
+	if dir != "" {
+		tree, prefix = "FETCH_HEAD:"+dir, "FETCH_HEAD:"+dir+"/"
+	}
+	files := map[string]string{}
+	err := withCommits(repoURL, auth, false, []string{ref}, func(run func(args ...string) (string, error)) error {
+		names, err := run("ls-tree", "--name-only", tree)
+		if err != nil {
+			return err
+		}
+		for _, name := range strings.Split(names, "\n") {
+			if name == "" || !match(name) {
+				continue
+			}
+			content, err := run("show", prefix+name)
+			if err != nil {
+				return err
+			}
+			files[name] = content
+		}
+		return nil
+	})
+	return files, err
+}
+
+// withCommits fetches the given commits (depth 1, without blobs if treesOnly) into a
+// temporary repository and calls fn with a function that runs git inside it
+func withCommits(repoURL string, auth *AuthConfig, treesOnly bool, commits []string, fn func(run func(args ...string) (string, error)) error) error {
+	tmpDir, err := os.MkdirTemp("", "git-commits-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Ensure URL format
+	remote := repoURL
+	if !strings.HasSuffix(remote, ".git") && !strings.Contains(remote, "dev.azure.com") && !strings.Contains(remote, "/_git/") {
+		remote = remote + ".git"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	run := func(args ...string) (string, error) {
+		output, err := remoteOutput(repoURL, args[0], func() *exec.Cmd {
+			cmd := exec.CommandContext(ctx, "git", append([]string{"-C", tmpDir}, args...)...)
+			cmd.Env = gitEnv(repoURL, auth)
+			return cmd
+		})
+		if err != nil {
+			message := ScrubCredentials(strings.TrimSpace(string(output)), auth)
+			return "", fmt.Errorf("git %s failed: %s", args[0], message)
+		}
+		return string(output), nil
+	}
+
+	if _, err := run("init", "-q"); err != nil {
+		return err
+	}
+	fetchArgs := []string{"fetch", "-q", "--depth", "1"}
+	if treesOnly {
+		fetchArgs = append(fetchArgs, "--filter=blob:none")
+	}
+	if _, err := run(append(append(fetchArgs, remote), commits...)...); err != nil {
+		return err
+	}
+
+	return fn(run)
+}
+
+// ResolveRef returns the commit a branch or tag currently points to
+func ResolveRef(repoURL, ref string, auth *AuthConfig) (string, error) {
+	// Ensure URL format
+	remote := repoURL
+	if !strings.HasSuffix(remote, ".git") && !strings.Contains(remote, "dev.azure.com") && !strings.Contains(remote, "/_git/") {
+		remote = remote + ".git"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var output []byte
+	err := retry.Do("git ls-remote "+redactURL(repoURL), func() error {
+		cmd := exec.CommandContext(ctx, "git", "ls-remote", remote, "refs/heads/"+ref, "refs/tags/"+ref, "refs/tags/"+ref+"^{}")
+		cmd.Env = gitEnv(repoURL, auth)
+		var err error
+		output, err = cmd.Output()
+		if exitErr, ok := err.(*exec.ExitError); ok && !retry.TransientGit(string(exitErr.Stderr)) {
+			return retry.Permanent(err)
+		}
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("git ls-remote failed for %s", redactURL(repoURL))
+	}
+
+	// Prefer the branch, then the commit an annotated tag points to, then the tag itself
+	found := map[string]string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := strings.Fields(line)
+		if len(parts) == 2 {
+			found[parts[1]] = parts[0]
+		}
+	}
+	for _, name := range []string{"refs/heads/" + ref, "refs/tags/" + ref + "^{}", "refs/tags/" + ref} {
+		if sha, ok := found[name]; ok {
+			return sha, nil
+		}
+	}
+	return "", fmt.Errorf("ref %s not found", ref)
+}
@@ -2,10 +2,8 @@ package git
 
 import (
 	"fmt"
-	"net/url"
 	"os"
 	"os/exec"
-	"regexp"
 	"sort"
 	"strings"
 	"time"
@@ -30,18 +28,29 @@ func GetTags(repoURL string) ([]Tag, error) {
 	return GetTagsWithAuth(repoURL, nil)
 }
 
-// GetTagsWithAuth fetches all tags from a Git repository URL with authentication
+// GetTagsWithAuth fetches all tags from a Git repository URL with authentication.
+// Known hosts are queried through their REST API; other hosts are cloned.
 func GetTagsWithAuth(repoURL string, auth *AuthConfig) ([]Tag, error) {
-	// Ensure URL ends with .git (except for Azure DevOps which uses _git/ path)
-	url := repoURL
-	if !strings.HasSuffix(url, ".git") && !strings.Contains(url, "dev.azure.com") && !strings.Contains(url, "/_git/") {
-		url = url + ".git"
-	}
+	var tags []Tag
+	fromAPI := withHostAPI(repoURL, auth, "tag listing", func(client hostClient) error {
+		var err error
+		tags, err = client.Tags()
+		return err
+	})
 
-	// Clone the repo and get all tags with their dates
-	tags, err := getTagsViaGitClone(url, auth)
-	if err != nil {
-		return nil, err
+	if !fromAPI {
+		// Ensure URL ends with .git (except for Azure DevOps which uses _git/ path)
+		url := repoURL
+		if !strings.HasSuffix(url, ".git") && !strings.Contains(url, "dev.azure.com") && !strings.Contains(url, "/_git/") {
+			url = url + ".git"
+		}
+
+		// Clone the repo and get all tags with their dates
+		var err error
+		tags, err = getTagsViaGitClone(url, auth)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Sort by tag date (newest first), falling back to version comparison
@@ -64,22 +73,17 @@ func getTagsViaGitClone(repoURL string, auth *AuthConfig) ([]Tag, error) {
 	}
 	defer os.RemoveAll(tmpDir)
 
-	// Prepare environment and credentials
-	env := os.Environ()
-	env = append(env, "GIT_TERMINAL_PROMPT=0")
-
-	// Inject HTTPS credentials if provided
-	if auth != nil && auth.Username != "" {
-		repoURL = injectHTTPSCredentials(repoURL, auth.Username, auth.Password)
-	}
+	// Prepare environment (credentials are answered through askpass)
+	env := gitEnv(repoURL, auth)
 
 	// Do a bare clone with minimal data
-	cmd := exec.Command("git", "clone", "--bare", "--filter=blob:none", repoURL, tmpDir)
-	cmd.Env = env
-
-	output, err := cmd.CombinedOutput()
+	output, err := remoteOutput(repoURL, "clone", func() *exec.Cmd {
+		cmd := exec.Command("git", "clone", "--bare", "--filter=blob:none", repoURL, tmpDir)
+		cmd.Env = env
+		return cmd
+	})
 	if err != nil {
-		return nil, fmt.Errorf("git clone failed: %v: %s", err, string(output))
+		return nil, fmt.Errorf("git clone failed: %v: %s", err, ScrubCredentials(string(output), auth))
 	}
 
 	// Use git for-each-ref to get all tags with their dates
@@ -93,9 +97,6 @@ func getTagsViaGitClone(repoURL string, auth *AuthConfig) ([]Tag, error) {
 		return nil, fmt.Errorf("git for-each-ref failed: %w", err)
 	}
 
-	// Regex to match version-like tags
-	versionRegex := regexp.MustCompile(`^v?(\d+\.\d+(\.\d+)?(-[\w.]+)?)$`)
-
 	tags := make([]Tag, 0)
 	lines := strings.Split(strings.TrimSpace(string(refOutput)), "\n")
 
@@ -113,20 +114,11 @@ func getTagsViaGitClone(repoURL string, auth *AuthConfig) ([]Tag, error) {
 		dateStr := strings.TrimSpace(parts[1])
 
 		// Check if it looks like a version
-		if !versionRegex.MatchString(tagName) {
+		tag, ok := tagFromName(tagName, time.Time{})
+		if !ok {
 			continue
 		}
 
-		version := tagName
-		if strings.HasPrefix(version, "v") {
-			version = version[1:]
-		}
-
-		tag := Tag{
-			Name:    tagName,
-			Version: version,
-		}
-
 		// Parse the date
 		if dateStr != "" {
 			if t, err := time.Parse(time.RFC3339, dateStr); err == nil {
@@ -203,12 +195,11 @@ func ValidateGitRepository(repoURL string) error {
 	}
 
 	// Try to do a minimal ls-remote to verify the repository exists and is accessible
-	cmd := exec.Command("git", "ls-remote", "--heads", url)
-	cmd.Env = append(os.Environ(),
-		"GIT_TERMINAL_PROMPT=0",
-	)
-
-	output, err := cmd.CombinedOutput()
+	output, err := remoteOutput(url, "ls-remote", func() *exec.Cmd {
+		cmd := exec.Command("git", "ls-remote", "--heads", url)
+		cmd.Env = gitEnv(url, nil)
+		return cmd
+	})
 	if err != nil {
 		// For URLs with embedded credentials (e.g., Azure DevOps), ls-remote might fail
 		// but the actual clone with credentials might work. Return a warning but don't fail.
@@ -216,7 +207,7 @@ func ValidateGitRepository(repoURL string) error {
 			// This looks like a URL with embedded credentials, allow it
 			return nil
 		}
-		return fmt.Errorf("repository validation failed: %v: %s", err, string(output))
+		return fmt.Errorf("repository validation failed: %v: %s", err, ScrubCredentials(string(output), nil))
 	}
 
 	// If we get here, the repository is valid and accessible
@@ -229,8 +220,18 @@ func GetReadme(repoURL string, ref string) (string, error) {
 	return GetReadmeWithAuth(repoURL, ref, nil)
 }
 
-// GetReadmeWithAuth fetches the README.md content from a Git repository with authentication
+// GetReadmeWithAuth fetches the README.md content from a Git repository with authentication.
+// Known hosts are queried through their REST API; other hosts are cloned.
 func GetReadmeWithAuth(repoURL string, ref string, auth *AuthConfig) (string, error) {
+	var readme string
+	if withHostAPI(repoURL, auth, "README fetch", func(client hostClient) error {
+		var err error
+		readme, err = readmeFromHost(client, ref)
+		return err
+	}) {
+		return readme, nil
+	}
+
 	// Create a temporary directory for the clone
 	tmpDir, err := os.MkdirTemp("", "git-readme-*")
 	if err != nil {
@@ -249,36 +250,32 @@ func GetReadmeWithAuth(repoURL string, ref string, auth *AuthConfig) (string, er
 		ref = "HEAD"
 	}
 
-	// Prepare environment and credentials
-	env := os.Environ()
-	env = append(env, "GIT_TERMINAL_PROMPT=0")
-
-	// Inject HTTPS credentials if provided
-	if auth != nil && auth.Username != "" {
-		url = injectHTTPSCredentials(url, auth.Username, auth.Password)
-	}
+	// Prepare environment (credentials are answered through askpass)
+	env := gitEnv(repoURL, auth)
 
 	// Do a shallow clone with depth 1 for the specific ref
-	cmd := exec.Command("git", "clone", "--depth", "1", "--branch", ref, url, tmpDir)
-	cmd.Env = env
-
-	output, err := cmd.CombinedOutput()
+	output, err := remoteOutput(repoURL, "clone", func() *exec.Cmd {
+		cmd := exec.Command("git", "clone", "--depth", "1", "--branch", ref, url, tmpDir)
+		cmd.Env = env
+		return cmd
+	})
 	if err != nil {
 		// If branch doesn't exist, try without --branch flag (uses default branch)
 		if ref == "HEAD" || strings.Contains(string(output), "Remote branch") {
-			cmd = exec.Command("git", "clone", "--depth", "1", url, tmpDir)
-			cmd.Env = env
-			output, err = cmd.CombinedOutput()
+			output, err = remoteOutput(repoURL, "clone", func() *exec.Cmd {
+				cmd := exec.Command("git", "clone", "--depth", "1", url, tmpDir)
+				cmd.Env = env
+				return cmd
+			})
 			if err != nil {
-				return "", fmt.Errorf("git clone failed: %v: %s", err, string(output))
+				return "", fmt.Errorf("git clone failed: %v: %s", err, ScrubCredentials(string(output), auth))
 			}
 		} else {
-			return "", fmt.Errorf("git clone failed: %v: %s", err, string(output))
+			return "", fmt.Errorf("git clone failed: %v: %s", err, ScrubCredentials(string(output), auth))
 		}
 	}
 
 	// Try to read README.md (case variations)
-	readmeNames := []string{"README.md", "readme.md", "Readme.md", "README.MD", "README"}
 	for _, name := range readmeNames {
 		readmePath := tmpDir + "/" + name
 		if content, err := os.ReadFile(readmePath); err == nil {
@@ -288,23 +285,3 @@ func GetReadmeWithAuth(repoURL string, ref string, auth *AuthConfig) (string, er
 
 	return "", fmt.Errorf("README not found in repository")
 }
-
-// injectHTTPSCredentials injects username and password into an HTTPS URL
-func injectHTTPSCredentials(repoURL, username, password string) string {
-	// Parse the URL
-	parsedURL, err := url.Parse(repoURL)
-	if err != nil {
-		// If parsing fails, fall back to original URL
-		return repoURL
-	}
-
-	// Only process HTTPS URLs
-	if parsedURL.Scheme != "https" {
-		return repoURL
-	}
-
-	// Set the credentials using url.UserPassword which handles proper encoding
-	parsedURL.User = url.UserPassword(username, password)
-
-	return parsedURL.String()
-}
@@ -1,15 +1,53 @@
 package git
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
+// CheckAccess verifies that the repository can be read with the given credentials
+// by running a minimal ls-remote. Credentials are scrubbed from the returned error.
+func CheckAccess(repoURL string, auth *AuthConfig) error {
+	// Ensure URL format
+	remote := repoURL
+	if !strings.HasSuffix(remote, ".git") && !strings.Contains(remote, "dev.azure.com") && !strings.Contains(remote, "/_git/") {
+		remote = remote + ".git"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	output, err := remoteOutput(repoURL, "ls-remote", func() *exec.Cmd {
+		cmd := exec.CommandContext(ctx, "git", "ls-remote", "--heads", remote, "HEAD")
+		cmd.Env = gitEnv(repoURL, auth)
+		return cmd
+	})
+	if err != nil {
+		message := ScrubCredentials(strings.TrimSpace(string(output)), auth)
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("git ls-remote timed out")
+		}
+		return fmt.Errorf("git ls-remote failed: %s", message)
+	}
+
+	return nil
+}
+
 // ListBranches lists all branches in a repository
 func ListBranches(repoURL string, auth *AuthConfig) ([]string, error) {
+	var branches []string
+	if withHostAPI(repoURL, auth, "branch listing", func(client hostClient) error {
+		var err error
+		branches, err = client.Branches()
+		return err
+	}) {
+		return branches, nil
+	}
 	return listReferences(repoURL, auth, "refs/heads/")
 }
 
@@ -26,22 +64,17 @@ func listReferences(repoURL string, auth *AuthConfig, refPrefix string) ([]strin
 		url = url + ".git"
 	}
 
-	// Inject HTTPS credentials if provided
-	if auth != nil && auth.Username != "" {
-		url = injectHTTPSCredentials(url, auth.Username, auth.Password)
-	}
-
-	// Prepare environment
-	env := os.Environ()
-	env = append(env, "GIT_TERMINAL_PROMPT=0")
+	// Prepare environment (credentials are answered through askpass)
+	env := gitEnv(repoURL, auth)
 
 	// Run git ls-remote
-	cmd := exec.Command("git", "ls-remote", "--heads", "--tags", url)
-	cmd.Env = env
-
-	output, err := cmd.CombinedOutput()
+	output, err := remoteOutput(repoURL, "ls-remote", func() *exec.Cmd {
+		cmd := exec.Command("git", "ls-remote", "--heads", "--tags", url)
+		cmd.Env = env
+		return cmd
+	})
 	if err != nil {
-		return nil, fmt.Errorf("git ls-remote failed: %v: %s", err, string(output))
+		return nil, fmt.Errorf("git ls-remote failed: %v: %s", err, ScrubCredentials(string(output), auth))
 	}
 
 	// Parse output
@@ -65,13 +98,30 @@ func listReferences(repoURL string, auth *AuthConfig, refPrefix string) ([]strin
 	return refs, nil
 }
 
-// ListDirectory lists files and directories at a specific path in a repository
-// Returns files and an optional README content if found
-func ListDirectory(repoURL string, ref string, path string, auth *AuthConfig) ([]map[string]interface{}, *string, error) {
+// DirectoryEntry is a file or directory listed by ListDirectory
+type DirectoryEntry struct {
+	Name        string
+	Path        string
+	IsDir       bool
+	Size        int64
+	IaCType     string // Directories: tool its IaC files are for (see DetectIaC), "" if none
+	ContainsIaC bool   // Directories: a directory directly below it holds IaC files
+}
+
+// Directory is the content of a repository directory
+type Directory struct {
+	Entries []DirectoryEntry
+	Readme  *string
+	IaCType string // Tool the directory's own IaC files are for, "" if none
+}
+
+// ListDirectory lists files and directories at a specific path in a repository, with
+// the README found there and which directories hold IaC files
+func ListDirectory(repoURL string, ref string, path string, auth *AuthConfig) (*Directory, error) {
 	// Create a temporary directory for the clone
 	tmpDir, err := os.MkdirTemp("", "git-ls-*")
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create temp dir: %w", err)
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
 	}
 	defer os.RemoveAll(tmpDir)
 
@@ -81,37 +131,32 @@ func ListDirectory(repoURL string, ref string, path string, auth *AuthConfig) ([
 		url = url + ".git"
 	}
 
-	// Inject HTTPS credentials if provided
-	if auth != nil && auth.Username != "" {
-		url = injectHTTPSCredentials(url, auth.Username, auth.Password)
-	}
-
 	// If no ref specified, use HEAD
 	if ref == "" {
 		ref = "HEAD"
 	}
 
-	// Prepare environment
-	env := os.Environ()
-	env = append(env, "GIT_TERMINAL_PROMPT=0")
+	// Prepare environment (credentials are answered through askpass)
+	env := gitEnv(repoURL, auth)
 
 	// Clone repository
-	cmd := exec.Command("git", "clone", "--depth", "1", "--branch", ref, url, tmpDir)
-	cmd.Env = env
-
-	output, err := cmd.CombinedOutput()
+	output, err := remoteOutput(repoURL, "clone", func() *exec.Cmd {
+		cmd := exec.Command("git", "clone", "--depth", "1", "--branch", ref, url, tmpDir)
+		cmd.Env = env
+		return cmd
+	})
 	if err != nil {
-		return nil, nil, fmt.Errorf("git clone failed: %v: %s", err, string(output))
+		return nil, fmt.Errorf("git clone failed: %v: %s", err, ScrubCredentials(string(output), auth))
 	}
 
 	// List directory contents
 	fullPath := filepath.Join(tmpDir, path)
 	entries, err := os.ReadDir(fullPath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read directory: %w", err)
+		return nil, fmt.Errorf("failed to read directory: %w", err)
 	}
 
-	var files []map[string]interface{}
+	dir := &Directory{Entries: []DirectoryEntry{}, IaCType: DetectIaC(fullPath)}
 	for _, entry := range entries {
 		info, err := entry.Info()
 		if err != nil {
@@ -124,22 +169,15 @@ func ListDirectory(repoURL string, ref string, path string, auth *AuthConfig) ([
 		}
 		entryPath += entry.Name()
 
-		fileType := "file"
-		if entry.IsDir() {
-			fileType = "dir"
+		e := DirectoryEntry{Name: entry.Name(), Path: entryPath, IsDir: entry.IsDir(), Size: info.Size()}
+		if entry.IsDir() && entry.Name() != ".git" {
+			e.IaCType = DetectIaC(filepath.Join(fullPath, entry.Name()))
+			e.ContainsIaC = containsIaC(filepath.Join(fullPath, entry.Name()))
 		}
-
-		files = append(files, map[string]interface{}{
-			"name":   entry.Name(),
-			"path":   entryPath,
-			"type":   fileType,
-			"is_dir": entry.IsDir(),
-			"size":   info.Size(),
-		})
+		dir.Entries = append(dir.Entries, e)
 	}
 
 	// Try to read README from the same clone (case-insensitive)
-	var readme *string
 	for _, entry := range entries {
 		// Check if the filename matches "readme.md" (case-insensitive)
 		entryNameLower := strings.ToLower(entry.Name())
@@ -148,13 +186,13 @@ func ListDirectory(repoURL string, ref string, path string, auth *AuthConfig) ([
 			content, err := os.ReadFile(readmeFullPath)
 			if err == nil {
 				contentStr := string(content)
-				readme = &contentStr
+				dir.Readme = &contentStr
 				break
 			}
 		}
 	}
 
-	return files, readme, nil
+	return dir, nil
 }
 
 // GetFileContent reads the content of a specific file from a repository
@@ -172,27 +210,22 @@ func GetFileContent(repoURL string, ref string, filePath string, auth *AuthConfi
 		url = url + ".git"
 	}
 
-	// Inject HTTPS credentials if provided
-	if auth != nil && auth.Username != "" {
-		url = injectHTTPSCredentials(url, auth.Username, auth.Password)
-	}
-
 	// If no ref specified, use HEAD
 	if ref == "" {
 		ref = "HEAD"
 	}
 
-	// Prepare environment
-	env := os.Environ()
-	env = append(env, "GIT_TERMINAL_PROMPT=0")
+	// Prepare environment (credentials are answered through askpass)
+	env := gitEnv(repoURL, auth)
 
 	// Clone the repository
-	cmd := exec.Command("git", "clone", "--depth", "1", "--branch", ref, url, tmpDir)
-	cmd.Env = env
-
-	output, err := cmd.CombinedOutput()
+	output, err := remoteOutput(repoURL, "clone", func() *exec.Cmd {
+		cmd := exec.Command("git", "clone", "--depth", "1", "--branch", ref, url, tmpDir)
+		cmd.Env = env
+		return cmd
+	})
 	if err != nil {
-		return "", fmt.Errorf("git clone failed: %v: %s", err, string(output))
+		return "", fmt.Errorf("git clone failed: %v: %s", err, ScrubCredentials(string(output), auth))
 	}
 
 	// Read the file
@@ -213,23 +246,29 @@ func Clone(repoURL, ref, destDir string, auth *AuthConfig) error {
 		url = url + ".git"
 	}
 
-	// Inject HTTPS credentials if provided
-	if auth != nil && auth.Username != "" {
-		url = injectHTTPSCredentials(url, auth.Username, auth.Password)
-	}
-
-	// Prepare environment
-	env := os.Environ()
-	env = append(env, "GIT_TERMINAL_PROMPT=0")
+	// Prepare environment (credentials are answered through askpass)
+	env := gitEnv(repoURL, auth)
 
 	// Clone the repository
-	cmd := exec.Command("git", "clone", "--depth", "1", "--branch", ref, url, destDir)
-	cmd.Env = env
-
-	output, err := cmd.CombinedOutput()
+	output, err := remoteOutput(repoURL, "clone", func() *exec.Cmd {
+		cmd := exec.Command("git", "clone", "--depth", "1", "--branch", ref, url, destDir)
+		cmd.Env = env
+		return cmd
+	})
 	if err != nil {
-		return fmt.Errorf("git clone failed: %v: %s", err, string(output))
+		return fmt.Errorf("git clone failed: %v: %s", err, ScrubCredentials(string(output), auth))
 	}
 
 	return nil
 }
+
+// HeadCommit returns the SHA of the commit checked out in a clone
+func HeadCommit(dir string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse failed: %v", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,741 @@
+package git
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"iac-tool/internal/outbound"
+)
+
+// versionTagRegex matches version-like tag names (e.g., v1.2.3, 1.2, 2.0.0-rc.1)
+var versionTagRegex = regexp.MustCompile(`^v?(\d+\.\d+(\.\d+)?(-[\w.]+)?)$`)
+
+// readmeNames are tried in order when looking for a repository README
+var readmeNames = []string{"README.md", "readme.md", "Readme.md", "README.MD", "README"}
+
+// errNotFound is returned by host clients when a ref or file does not exist
+var errNotFound = fmt.Errorf("not found")
+
+// hostClient reads refs and files through a Git hosting provider's REST API,
+// which avoids cloning the repository
+type hostClient interface {
+	// Tags returns all tags with their dates (zero when the API does not provide one)
+	Tags() ([]Tag, error)
+	Branches() ([]string, error)
+	// File returns the content of path at ref; an empty ref means the default branch
+	File(ref, path string) (string, error)
+}
+
+var apiHTTPClient = outbound.NewClient(30 * time.Second)
+
+// hostKinds returns the API flavour per hostname. Well-known SaaS hosts are
+// built in; self-hosted instances are added with GIT_API_HOSTS
+// (e.g., "git.example.com=gitlab,code.example.com=gitea,ghe.example.com=github").
+func hostKinds() map[string]string {
+	kinds := map[string]string{
+		"github.com":    "github",
+		"gitlab.com":    "gitlab",
+		"bitbucket.org": "bitbucket",
+		"dev.azure.com": "azure",
+		"gitea.com":     "gitea",
+		"codeberg.org":  "gitea",
+	}
+	for _, entry := range strings.Split(os.Getenv("GIT_API_HOSTS"), ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) == 2 && parts[0] != "" {
+			kinds[strings.ToLower(parts[0])] = strings.ToLower(strings.TrimSpace(parts[1]))
+		}
+	}
+	return kinds
+}
+
+// hostClientFor returns an API client for repositories on a known host, or nil when
+// the host is unknown (callers then fall back to git). GIT_HOST_API=false disables
+// API access entirely.
+func hostClientFor(repoURL string, auth *AuthConfig) hostClient {
+	if os.Getenv("GIT_HOST_API") == "false" {
+		return nil
+	}
+
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Scheme != "https" {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	repoPath := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	segments := strings.Split(repoPath, "/")
+
+	kind := hostKinds()[host]
+	if kind == "" && strings.HasSuffix(host, ".visualstudio.com") {
+		kind = "azure"
+	}
+
+	switch kind {
+	case "github":
+		if len(segments) < 2 {
+			return nil
+		}
+		apiBase := "https://api.github.com"
+		if host != "github.com" {
+			apiBase = "https://" + u.Host + "/api/v3"
+		}
+		return &githubClient{apiBase: apiBase, repo: segments[0] + "/" + segments[1], auth: auth}
+	case "gitlab":
+		if i := strings.Index(repoPath, "/-/"); i >= 0 {
+			repoPath = repoPath[:i]
+		}
+		if !strings.Contains(repoPath, "/") {
+			return nil
+		}
+		return &gitlabClient{apiBase: "https://" + u.Host + "/api/v4/projects/" + url.PathEscape(repoPath), auth: auth}
+	case "bitbucket":
+		if len(segments) < 2 {
+			return nil
+		}
+		return &bitbucketClient{apiBase: "https://api.bitbucket.org/2.0/repositories/" + segments[0] + "/" + segments[1], auth: auth}
+	case "gitea":
+		if len(segments) < 2 {
+			return nil
+		}
+		return &giteaClient{apiBase: "https://" + u.Host + "/api/v1/repos/" + segments[0] + "/" + segments[1], auth: auth}
+	case "azure":
+		// https://dev.azure.com/{org}/{project}/_git/{repo} or https://{org}.visualstudio.com/{project}/_git/{repo}
+		for i, s := range segments {
+			if s == "_git" && i+1 < len(segments) && i >= 1 {
+				base := "https://" + u.Host + "/" + strings.Join(segments[:i], "/")
+				return &azureClient{apiBase: base + "/_apis/git/repositories/" + segments[i+1], auth: auth}
+			}
+		}
+	}
+	return nil
+}
+
+// withHostAPI runs fn against the repository's hosting API when available.
+// ok is false when no client exists or the API call failed, in which case the
+// caller should fall back to git.
+func withHostAPI(repoURL string, auth *AuthConfig, what string, fn func(hostClient) error) bool {
+	client := hostClientFor(repoURL, auth)
+	if client == nil {
+		return false
+	}
+	if err := fn(client); err != nil {
+		log.Printf("Git host API %s for %s failed, falling back to git: %v", what, redactURL(repoURL), err)
+		return false
+	}
+	return true
+}
+
+// redactURL removes any user info from a repository URL for logging
+func redactURL(repoURL string) string {
+	if u, err := url.Parse(repoURL); err == nil {
+		u.User = nil
+		return u.String()
+	}
+	return repoURL
+}
+
+// tagFromName builds a Tag for version-like tag names; ok is false for other tags
+func tagFromName(name string, date time.Time) (Tag, bool) {
+	if !versionTagRegex.MatchString(name) {
+		return Tag{}, false
+	}
+	return Tag{Name: name, Version: strings.TrimPrefix(name, "v"), TagDate: date}, true
+}
+
+// apiRequest performs an API call and decodes the JSON response into out (if
+// non-nil), returning the response headers for pagination
+func apiRequest(method, endpoint string, body []byte, authorize func(*http.Request), out interface{}) (http.Header, error) {
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if authorize != nil {
+		authorize(req)
+	}
+
+	resp, err := apiHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return resp.Header, errNotFound
+	}
+	if resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return resp.Header, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(snippet)))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.Header, fmt.Errorf("invalid response: %w", err)
+		}
+	}
+	return resp.Header, nil
+}
+
+func apiGet(endpoint string, authorize func(*http.Request), out interface{}) (http.Header, error) {
+	return apiRequest(http.MethodGet, endpoint, nil, authorize, out)
+}
+
+// basicAuth authorizes with the configured username and password/token
+func basicAuth(auth *AuthConfig) func(*http.Request) {
+	return func(req *http.Request) {
+		if auth != nil && auth.Password != "" {
+			req.SetBasicAuth(auth.Username, auth.Password)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// GitHub
+// ---------------------------------------------------------------------------
+
+type githubClient struct {
+	apiBase string
+	repo    string
+	auth    *AuthConfig
+}
+
+func (g *githubClient) authorize(req *http.Request) {
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if g.auth != nil && g.auth.Password != "" {
+		req.Header.Set("Authorization", "Bearer "+g.auth.Password)
+	}
+}
+
+// githubNextLink extracts the rel="next" URL from a Link header
+func githubNextLink(header http.Header) string {
+	for _, link := range strings.Split(header.Get("Link"), ",") {
+		parts := strings.Split(link, ";")
+		if len(parts) == 2 && strings.TrimSpace(parts[1]) == `rel="next"` {
+			return strings.Trim(strings.TrimSpace(parts[0]), "<>")
+		}
+	}
+	return ""
+}
+
+func (g *githubClient) Tags() ([]Tag, error) {
+	// With a token, GraphQL returns every tag with its date in a few requests
+	if g.auth != nil && g.auth.Password != "" {
+		return g.tagsGraphQL()
+	}
+
+	tags := make([]Tag, 0)
+	next := g.apiBase + "/repos/" + g.repo + "/tags?per_page=100"
+	for next != "" {
+		var page []struct {
+			Name string `json:"name"`
+		}
+		header, err := apiGet(next, g.authorize, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range page {
+			if tag, ok := tagFromName(t.Name, time.Time{}); ok {
+				tags = append(tags, tag)
+			}
+		}
+		next = githubNextLink(header)
+	}
+	return tags, nil
+}
+
+func (g *githubClient) tagsGraphQL() ([]Tag, error) {
+	const query = `query($owner: String!, $name: String!, $after: String) {
+  repository(owner: $owner, name: $name) {
+    refs(refPrefix: "refs/tags/", first: 100, after: $after) {
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        name
+        target {
+          ... on Commit { committedDate }
+          ... on Tag { tagger { date } target { ... on Commit { committedDate } } }
+        }
+      }
+    }
+  }
+}`
+	endpoint := "https://api.github.com/graphql"
+	if g.apiBase != "https://api.github.com" {
+		endpoint = strings.TrimSuffix(g.apiBase, "/v3") + "/graphql"
+	}
+	owner, name, _ := strings.Cut(g.repo, "/")
+
+	tags := make([]Tag, 0)
+	var after *string
+	for {
+		body, _ := json.Marshal(map[string]interface{}{
+			"query":     query,
+			"variables": map[string]interface{}{"owner": owner, "name": name, "after": after},
+		})
+		var result struct {
+			Data struct {
+				Repository *struct {
+					Refs struct {
+						PageInfo struct {
+							HasNextPage bool   `json:"hasNextPage"`
+							EndCursor   string `json:"endCursor"`
+						} `json:"pageInfo"`
+						Nodes []struct {
+							Name   string `json:"name"`
+							Target struct {
+								CommittedDate string `json:"committedDate"`
+								Tagger        *struct {
+									Date string `json:"date"`
+								} `json:"tagger"`
+								Target *struct {
+									CommittedDate string `json:"committedDate"`
+								} `json:"target"`
+							} `json:"target"`
+						} `json:"nodes"`
+					} `json:"refs"`
+				} `json:"repository"`
+			} `json:"data"`
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		if _, err := apiRequest(http.MethodPost, endpoint, body, g.authorize, &result); err != nil {
+			return nil, err
+		}
+		if len(result.Errors) > 0 {
+			return nil, fmt.Errorf("graphql: %s", result.Errors[0].Message)
+		}
+		if result.Data.Repository == nil {
+			return nil, errNotFound
+		}
+
+		refs := result.Data.Repository.Refs
+		for _, n := range refs.Nodes {
+			date := n.Target.CommittedDate
+			if n.Target.Tagger != nil && n.Target.Tagger.Date != "" {
+				date = n.Target.Tagger.Date
+			} else if date == "" && n.Target.Target != nil {
+				date = n.Target.Target.CommittedDate
+			}
+			if tag, ok := tagFromName(n.Name, parseAPITime(date)); ok {
+				tags = append(tags, tag)
+			}
+		}
+		if !refs.PageInfo.HasNextPage {
+			break
+		}
+		cursor := refs.PageInfo.EndCursor
+		after = &cursor
+	}
+	return tags, nil
+}
+
+func (g *githubClient) Branches() ([]string, error) {
+	branches := make([]string, 0)
+	next := g.apiBase + "/repos/" + g.repo + "/branches?per_page=100"
+	for next != "" {
+		var page []struct {
+			Name string `json:"name"`
+		}
+		header, err := apiGet(next, g.authorize, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range page {
+			branches = append(branches, b.Name)
+		}
+		next = githubNextLink(header)
+	}
+	return branches, nil
+}
+
+func (g *githubClient) File(ref, path string) (string, error) {
+	endpoint := g.apiBase + "/repos/" + g.repo + "/contents/" + escapePath(path)
+	if ref != "" {
+		endpoint += "?ref=" + url.QueryEscape(ref)
+	}
+	var content struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	if _, err := apiGet(endpoint, g.authorize, &content); err != nil {
+		return "", err
+	}
+	return decodeContent(content.Content, content.Encoding)
+}
+
+// ---------------------------------------------------------------------------
+// GitLab
+// ---------------------------------------------------------------------------
+
+type gitlabClient struct {
+	apiBase string
+	auth    *AuthConfig
+}
+
+func (g *gitlabClient) authorize(req *http.Request) {
+	if g.auth != nil && g.auth.Password != "" {
+		req.Header.Set("PRIVATE-TOKEN", g.auth.Password)
+	}
+}
+
+func (g *gitlabClient) Tags() ([]Tag, error) {
+	tags := make([]Tag, 0)
+	for page := "1"; page != ""; {
+		var items []struct {
+			Name      string  `json:"name"`
+			CreatedAt *string `json:"created_at"`
+			Commit    struct {
+				CommittedDate string `json:"committed_date"`
+			} `json:"commit"`
+		}
+		header, err := apiGet(g.apiBase+"/repository/tags?per_page=100&page="+page, g.authorize, &items)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range items {
+			date := t.Commit.CommittedDate
+			if t.CreatedAt != nil && *t.CreatedAt != "" {
+				date = *t.CreatedAt
+			}
+			if tag, ok := tagFromName(t.Name, parseAPITime(date)); ok {
+				tags = append(tags, tag)
+			}
+		}
+		page = header.Get("X-Next-Page")
+	}
+	return tags, nil
+}
+
+func (g *gitlabClient) Branches() ([]string, error) {
+	branches := make([]string, 0)
+	for page := "1"; page != ""; {
+		var items []struct {
+			Name string `json:"name"`
+		}
+		header, err := apiGet(g.apiBase+"/repository/branches?per_page=100&page="+page, g.authorize, &items)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range items {
+			branches = append(branches, b.Name)
+		}
+		page = header.Get("X-Next-Page")
+	}
+	return branches, nil
+}
+
+func (g *gitlabClient) File(ref, path string) (string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	var content struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	endpoint := g.apiBase + "/repository/files/" + url.PathEscape(path) + "?ref=" + url.QueryEscape(ref)
+	if _, err := apiGet(endpoint, g.authorize, &content); err != nil {
+		return "", err
+	}
+	return decodeContent(content.Content, content.Encoding)
+}
+
+// ---------------------------------------------------------------------------
+// Bitbucket Cloud
+// ---------------------------------------------------------------------------
+
+type bitbucketClient struct {
+	apiBase string
+	auth    *AuthConfig
+}
+
+type bitbucketRefPage struct {
+	Next   string `json:"next"`
+	Values []struct {
+		Name   string `json:"name"`
+		Date   string `json:"date"`
+		Target struct {
+			Date string `json:"date"`
+		} `json:"target"`
+	} `json:"values"`
+}
+
+func (b *bitbucketClient) Tags() ([]Tag, error) {
+	tags := make([]Tag, 0)
+	next := b.apiBase + "/refs/tags?pagelen=100"
+	for next != "" {
+		var page bitbucketRefPage
+		if _, err := apiGet(next, basicAuth(b.auth), &page); err != nil {
+			return nil, err
+		}
+		for _, t := range page.Values {
+			date := t.Target.Date
+			if t.Date != "" {
+				date = t.Date
+			}
+			if tag, ok := tagFromName(t.Name, parseAPITime(date)); ok {
+				tags = append(tags, tag)
+			}
+		}
+		next = page.Next
+	}
+	return tags, nil
+}
+
+func (b *bitbucketClient) Branches() ([]string, error) {
+	branches := make([]string, 0)
+	next := b.apiBase + "/refs/branches?pagelen=100"
+	for next != "" {
+		var page bitbucketRefPage
+		if _, err := apiGet(next, basicAuth(b.auth), &page); err != nil {
+			return nil, err
+		}
+		for _, br := range page.Values {
+			branches = append(branches, br.Name)
+		}
+		next = page.Next
+	}
+	return branches, nil
+}
+
+func (b *bitbucketClient) File(ref, path string) (string, error) {
+	if ref == "" {
+		var repo struct {
+			MainBranch struct {
+				Name string `json:"name"`
+			} `json:"mainbranch"`
+		}
+		if _, err := apiGet(b.apiBase, basicAuth(b.auth), &repo); err != nil {
+			return "", err
+		}
+		ref = repo.MainBranch.Name
+	}
+	return apiGetRaw(b.apiBase+"/src/"+url.PathEscape(ref)+"/"+escapePath(path), basicAuth(b.auth))
+}
+
+// ---------------------------------------------------------------------------
+// Gitea / Forgejo
+// ---------------------------------------------------------------------------
+
+type giteaClient struct {
+	apiBase string
+	auth    *AuthConfig
+}
+
+func (g *giteaClient) Tags() ([]Tag, error) {
+	tags := make([]Tag, 0)
+	for page := 1; ; page++ {
+		var items []struct {
+			Name   string `json:"name"`
+			Commit struct {
+				Created string `json:"created"`
+			} `json:"commit"`
+		}
+		if _, err := apiGet(g.apiBase+"/tags?limit=50&page="+strconv.Itoa(page), basicAuth(g.auth), &items); err != nil {
+			return nil, err
+		}
+		if len(items) == 0 {
+			break
+		}
+		for _, t := range items {
+			if tag, ok := tagFromName(t.Name, parseAPITime(t.Commit.Created)); ok {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags, nil
+}
+
+func (g *giteaClient) Branches() ([]string, error) {
+	branches := make([]string, 0)
+	for page := 1; ; page++ {
+		var items []struct {
+			Name string `json:"name"`
+		}
+		if _, err := apiGet(g.apiBase+"/branches?limit=50&page="+strconv.Itoa(page), basicAuth(g.auth), &items); err != nil {
+			return nil, err
+		}
+		if len(items) == 0 {
+			break
+		}
+		for _, b := range items {
+			branches = append(branches, b.Name)
+		}
+	}
+	return branches, nil
+}
+
+func (g *giteaClient) File(ref, path string) (string, error) {
+	endpoint := g.apiBase + "/contents/" + escapePath(path)
+	if ref != "" {
+		endpoint += "?ref=" + url.QueryEscape(ref)
+	}
+	var content struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	if _, err := apiGet(endpoint, basicAuth(g.auth), &content); err != nil {
+		return "", err
+	}
+	return decodeContent(content.Content, content.Encoding)
+}
+
+// ---------------------------------------------------------------------------
+// Azure DevOps
+// ---------------------------------------------------------------------------
+
+type azureClient struct {
+	apiBase string
+	auth    *AuthConfig
+}
+
+func (a *azureClient) refs(filter string) ([]string, error) {
+	var result struct {
+		Value []struct {
+			Name string `json:"name"`
+		} `json:"value"`
+	}
+	endpoint := a.apiBase + "/refs?filter=" + url.QueryEscape(filter) + "&api-version=7.0"
+	if _, err := apiGet(endpoint, basicAuth(a.auth), &result); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(result.Value))
+	for _, r := range result.Value {
+		names = append(names, strings.TrimPrefix(r.Name, "refs/"+filter))
+	}
+	return names, nil
+}
+
+// Tags returns tags without dates; the refs API does not expose them
+func (a *azureClient) Tags() ([]Tag, error) {
+	names, err := a.refs("tags/")
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]Tag, 0, len(names))
+	for _, name := range names {
+		if tag, ok := tagFromName(name, time.Time{}); ok {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+func (a *azureClient) Branches() ([]string, error) {
+	return a.refs("heads/")
+}
+
+func (a *azureClient) File(ref, path string) (string, error) {
+	endpoint := a.apiBase + "/items?path=" + url.QueryEscape("/"+path) + "&includeContent=true&api-version=7.0"
+	if ref == "" {
+		return a.item(endpoint)
+	}
+	// The ref may be a branch or a tag
+	content, err := a.item(endpoint + "&versionDescriptor.versionType=branch&versionDescriptor.version=" + url.QueryEscape(ref))
+	if err == errNotFound {
+		content, err = a.item(endpoint + "&versionDescriptor.versionType=tag&versionDescriptor.version=" + url.QueryEscape(ref))
+	}
+	return content, err
+}
+
+func (a *azureClient) item(endpoint string) (string, error) {
+	var item struct {
+		Content string `json:"content"`
+	}
+	if _, err := apiGet(endpoint, basicAuth(a.auth), &item); err != nil {
+		return "", err
+	}
+	return item.Content, nil
+}
+
+// ---------------------------------------------------------------------------
+// Helpers
+// ---------------------------------------------------------------------------
+
+// apiGetRaw fetches a raw file body
+func apiGetRaw(endpoint string, authorize func(*http.Request)) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	if authorize != nil {
+		authorize(req)
+	}
+	resp, err := apiHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", errNotFound
+	}
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	return string(body), err
+}
+
+// decodeContent decodes file content returned by contents APIs
+func decodeContent(content, encoding string) (string, error) {
+	if encoding != "base64" {
+		return content, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(content, "\n", ""))
+	if err != nil {
+		return "", fmt.Errorf("invalid base64 content: %w", err)
+	}
+	return string(decoded), nil
+}
+
+// escapePath escapes each segment of a repository file path
+func escapePath(path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+func parseAPITime(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	if t, err := time.Parse("2006-01-02T15:04:05.000-07:00", s); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+// readmeFromHost fetches the README through the hosting API, trying the usual file names
+func readmeFromHost(client hostClient, ref string) (string, error) {
+	if ref == "HEAD" {
+		ref = ""
+	}
+	for _, name := range readmeNames {
+		content, err := client.File(ref, name)
+		if err == nil {
+			return content, nil
+		}
+		if err != errNotFound {
+			return "", err
+		}
+	}
+	return "", errNotFound
+}
@@ -0,0 +1,47 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DetectIaC returns the tool a checked-out directory is written for, from the files
+// directly in it: "terragrunt" (terragrunt.hcl), "tofu" (.tofu files) or "terraform"
+// (.tf files); "" if it holds none
+func DetectIaC(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	kind := ""
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		switch {
+		case name == "terragrunt.hcl":
+			return "terragrunt"
+		case strings.HasSuffix(name, ".tofu") || strings.HasSuffix(name, ".tofu.json"):
+			kind = "tofu"
+		case kind == "" && (strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".tf.json")):
+			kind = "terraform"
+		}
+	}
+	return kind
+}
+
+// containsIaC reports whether a directory directly below dir holds IaC files
+func containsIaC(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && DetectIaC(filepath.Join(dir, entry.Name())) != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package git
+
+import "fmt"
+
+// RepoMetadata is how a hosting provider describes a repository
+type RepoMetadata struct {
+	Description string
+	Topics      []string
+}
+
+// metadataClient is implemented by host clients whose API describes the repository
+type metadataClient interface {
+	Metadata() (*RepoMetadata, error)
+}
+
+// GetRepoMetadata returns the description and topics of a repository from its hosting
+// API. Hosts without such an API (or with GIT_HOST_API=false) return an error; git
+// itself has no notion of either.
+func GetRepoMetadata(repoURL string, auth *AuthConfig) (*RepoMetadata, error) {
+	client, ok := hostClientFor(repoURL, auth).(metadataClient)
+	if !ok {
+		return nil, fmt.Errorf("repository metadata is not available for %s", redactURL(repoURL))
+	}
+	return client.Metadata()
+}
+
+func (g *githubClient) Metadata() (*RepoMetadata, error) {
+	var repo struct {
+		Description *string  `json:"description"`
+		Topics      []string `json:"topics"`
+	}
+	if _, err := apiGet(g.apiBase+"/repos/"+g.repo, g.authorize, &repo); err != nil {
+		return nil, err
+	}
+	m := &RepoMetadata{Topics: repo.Topics}
+	if repo.Description != nil {
+		m.Description = *repo.Description
+	}
+	return m, nil
+}
+
+func (g *gitlabClient) Metadata() (*RepoMetadata, error) {
+	var project struct {
+		Description *string  `json:"description"`
+		Topics      []string `json:"topics"`
+	}
+	if _, err := apiGet(g.apiBase, g.authorize, &project); err != nil {
+		return nil, err
+	}
+	m := &RepoMetadata{Topics: project.Topics}
+	if project.Description != nil {
+		m.Description = *project.Description
+	}
+	return m, nil
+}
+
+func (b *bitbucketClient) Metadata() (*RepoMetadata, error) {
+	// Bitbucket repositories have no topics
+	var repo struct {
+		Description string `json:"description"`
+	}
+	if _, err := apiGet(b.apiBase, basicAuth(b.auth), &repo); err != nil {
+		return nil, err
+	}
+	return &RepoMetadata{Description: repo.Description}, nil
+}
+
+func (g *giteaClient) Metadata() (*RepoMetadata, error) {
+	var repo struct {
+		Description string `json:"description"`
+	}
+	if _, err := apiGet(g.apiBase, basicAuth(g.auth), &repo); err != nil {
+		return nil, err
+	}
+	m := &RepoMetadata{Description: repo.Description}
+
+	// Older Gitea versions do not have topics
+	var topics struct {
+		Topics []string `json:"topics"`
+	}
+	if _, err := apiGet(g.apiBase+"/topics", basicAuth(g.auth), &topics); err == nil {
+		m.Topics = topics.Topics
+	}
+	return m, nil
+}
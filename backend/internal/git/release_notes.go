@@ -0,0 +1,46 @@
+package git
+
+import (
+	"path"
+	"strings"
+)
+
+// ReleaseNotes is what a repository says about one tagged release
+type ReleaseNotes struct {
+	TagMessage string // Message of an annotated tag; "" for lightweight tags
+	Changelog  string // CHANGELOG.md as of the tag; "" if there is none
+}
+
+// GetReleaseNotes reads the annotated tag message and the CHANGELOG.md of a tag. The
+// changelog is looked for in dir (a module's subdirectory, may be "") and then the
+// repository root.
+func GetReleaseNotes(repoURL, tagName, dir string, auth *AuthConfig) (*ReleaseNotes, error) {
+	ref := "refs/tags/" + tagName
+	notes := &ReleaseNotes{}
+	err := withCommits(repoURL, auth, false, []string{"+" + ref + ":" + ref}, func(run func(args ...string) (string, error)) error {
+		if kind, err := run("cat-file", "-t", ref); err == nil && strings.TrimSpace(kind) == "tag" {
+			// subject and body leave out a signature
+			message, err := run("for-each-ref", "--format=%(contents:subject)%0a%0a%(contents:body)", ref)
+			if err != nil {
+				return err
+			}
+			notes.TagMessage = strings.TrimSpace(message)
+		}
+
+		candidates := []string{"CHANGELOG.md"}
+		if dir = strings.Trim(path.Clean("/"+dir), "/"); dir != "" {
+			candidates = append([]string{dir + "/CHANGELOG.md"}, candidates...)
+		}
+		for _, file := range candidates {
+			if content, err := run("show", ref+":"+file); err == nil {
+				notes.Changelog = content
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
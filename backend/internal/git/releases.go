@@ -0,0 +1,92 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"iac-tool/internal/outbound"
+)
+
+// ReleaseAsset is a file attached to a GitHub release
+type ReleaseAsset struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	URL  string `json:"url"` // API URL; downloads with Accept: application/octet-stream
+}
+
+// Release is a GitHub release and its assets
+type Release struct {
+	TagName string         `json:"tag_name"`
+	Name    string         `json:"name"`
+	Draft   bool           `json:"draft"`
+	Assets  []ReleaseAsset `json:"assets"`
+
+	client *githubClient
+}
+
+// releaseHTTPClient downloads release assets, which may take a while for large binaries
+var releaseHTTPClient = outbound.NewClient(10 * time.Minute)
+
+// GitHubRelease returns the release of a GitHub (or GitHub Enterprise, see GIT_API_HOSTS)
+// repository with the given tag
+func GitHubRelease(repoURL, tag string, auth *AuthConfig) (*Release, error) {
+	client, ok := hostClientFor(repoURL, auth).(*githubClient)
+	if !ok {
+		return nil, fmt.Errorf("releases can only be imported from GitHub repositories (GIT_HOST_API must not be false)")
+	}
+	release := &Release{client: client}
+	_, err := apiGet(client.apiBase+"/repos/"+client.repo+"/releases/tags/"+url.PathEscape(tag), client.authorize, release)
+	if err == errNotFound {
+		return nil, fmt.Errorf("no release with tag %s in %s", tag, client.repo)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// Asset returns the asset with the given name, or nil
+func (r *Release) Asset(name string) *ReleaseAsset {
+	for i := range r.Assets {
+		if r.Assets[i].Name == name {
+			return &r.Assets[i]
+		}
+	}
+	return nil
+}
+
+// Download streams an asset to w. At most limit bytes are accepted (0: no limit).
+func (r *Release) Download(asset *ReleaseAsset, w io.Writer, limit int64) error {
+	req, err := http.NewRequest(http.MethodGet, asset.URL, nil)
+	if err != nil {
+		return err
+	}
+	r.client.authorize(req)
+	req.Header.Set("Accept", "application/octet-stream")
+
+	// GitHub redirects to a signed storage URL; net/http does not forward the token there
+	resp, err := releaseHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading %s: HTTP %d", asset.Name, resp.StatusCode)
+	}
+
+	body := io.Reader(resp.Body)
+	if limit > 0 {
+		body = io.LimitReader(resp.Body, limit+1)
+	}
+	n, err := io.Copy(w, body)
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", asset.Name, err)
+	}
+	if limit > 0 && n > limit {
+		return fmt.Errorf("%s is larger than %d bytes", asset.Name, limit)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+// Package maintenance holds the platform's maintenance mode. While it is on, the backend
+// answers requests that change data, such as creating runs and uploading providers, with
+// 503 and the scheduler starts no runs, while the registry protocol and downloads keep
+// serving terraform. It is turned on with MAINTENANCE_MODE=true, which the API cannot
+// turn off, or at runtime through the admin API, which stores it in platform_settings so
+// every instance follows.
+package maintenance
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"iac-tool/internal/database"
+)
+
+// settingKey is the platform_settings key of the maintenance mode
+const settingKey = "maintenance"
+
+// defaultMessage is shown when maintenance mode was turned on without a message
+const defaultMessage = "The platform is undergoing maintenance. Registry downloads keep working; changes are paused until it is over."
+
+// refreshInterval is how long an instance uses the state it read last
+const refreshInterval = 5 * time.Second
+
+// State is the maintenance mode as reported by the API
+type State struct {
+	Enabled   bool       `json:"enabled"`
+	Message   string     `json:"message,omitempty"`
+	EndsAt    *time.Time `json:"ends_at,omitempty"`    // Expected end, for clients to retry after
+	Source    string     `json:"source,omitempty"`     // "env" (MAINTENANCE_MODE) or "api"
+	EnabledBy string     `json:"enabled_by,omitempty"` // API key that turned it on
+	EnabledAt *time.Time `json:"enabled_at,omitempty"`
+}
+
+var (
+	mu       sync.Mutex
+	current  State
+	loadedAt time.Time
+)
+
+// fromEnv returns the maintenance mode forced by MAINTENANCE_MODE, if any
+func fromEnv() (State, bool) {
+	if os.Getenv("MAINTENANCE_MODE") != "true" {
+		return State{}, false
+	}
+	message := os.Getenv("MAINTENANCE_MESSAGE")
+	if message == "" {
+		message = defaultMessage
+	}
+	return State{Enabled: true, Message: message, Source: "env"}, true
+}
+
+// Current returns the maintenance mode. The stored state is read again at most every few
+// seconds; while the database cannot be read, the last state read is kept.
+func Current() State {
+	if state, ok := fromEnv(); ok {
+		return state
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if time.Since(loadedAt) < refreshInterval {
+		return current
+	}
+	var value string
+	var updatedBy sql.NullString
+	err := database.DB.QueryRow(`SELECT value, updated_by FROM platform_settings WHERE key = $1`, settingKey).Scan(&value, &updatedBy)
+	switch {
+	case err == sql.ErrNoRows:
+		current = State{}
+	case err != nil:
+		log.Printf("Maintenance: failed to read the maintenance mode, keeping the last one: %v", err)
+		return current
+	default:
+		var state State
+		if err := json.Unmarshal([]byte(value), &state); err != nil {
+			log.Printf("Maintenance: invalid stored maintenance mode: %v", err)
+			return current
+		}
+		current = state
+	}
+	loadedAt = time.Now()
+	return current
+}
+
+// Enabled reports whether maintenance mode is on
+func Enabled() bool {
+	return Current().Enabled
+}
+
+// ForcedByEnv reports whether MAINTENANCE_MODE turns maintenance mode on, so the API
+// cannot change it
+func ForcedByEnv() bool {
+	_, ok := fromEnv()
+	return ok
+}
+
+// Set turns maintenance mode on or off for all instances
+func Set(enabled bool, message string, endsAt *time.Time, actor string) (State, error) {
+	state := State{}
+	if enabled {
+		now := time.Now()
+		if message == "" {
+			message = defaultMessage
+		}
+		state = State{Enabled: true, Message: message, EndsAt: endsAt, Source: "api", EnabledBy: actor, EnabledAt: &now}
+	}
+	value, _ := json.Marshal(state)
+	_, err := database.DB.Exec(`
+		INSERT INTO platform_settings (key, value, updated_by, updated_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at
+	`, settingKey, string(value), actor, time.Now())
+	if err != nil {
+		return State{}, err
+	}
+
+	mu.Lock()
+	current, loadedAt = state, time.Now()
+	mu.Unlock()
+	return state, nil
+}
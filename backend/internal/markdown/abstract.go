@@ -0,0 +1,81 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	plainImagePattern = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+	plainLinkPattern  = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	plainRefPattern   = regexp.MustCompile(`\[([^\]]+)\]\[[^\]]*\]`)
+	spacePattern      = regexp.MustCompile(`\s+`)
+)
+
+// Abstract returns the first paragraph of a README as plain text, cut to about max
+// characters on a word boundary. Headings, badges, code, lists, tables and quotes are
+// skipped, so the result is the prose a catalog card can show.
+func Abstract(source string, max int) string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = commentPattern.ReplaceAllString(source, "")
+	source = scriptPattern.ReplaceAllString(source, "")
+	lines := strings.Split(source, "\n")
+
+	var paragraph []string
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			if text := plainText(strings.Join(paragraph, " ")); text != "" {
+				return truncate(text, max)
+			}
+			paragraph = nil
+
+		case fencePattern.MatchString(line):
+			m := fencePattern.FindStringSubmatch(line)
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), m[1]); i++ {
+			}
+			paragraph = nil
+
+		case len(paragraph) > 0 && setextPattern.MatchString(line):
+			// The paragraph was a heading
+			paragraph = nil
+
+		case headingPattern.MatchString(line), rulePattern.MatchString(line), quotePattern.MatchString(line),
+			listItemPattern.MatchString(line), strings.HasPrefix(trimmed, "|"),
+			len(paragraph) == 0 && (strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")):
+			paragraph = nil
+
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	return truncate(plainText(strings.Join(paragraph, " ")), max)
+}
+
+// plainText strips the inline markup of a paragraph; images and raw HTML are dropped,
+// links are replaced by their text
+func plainText(text string) string {
+	text = plainImagePattern.ReplaceAllString(text, "")
+	text = plainLinkPattern.ReplaceAllString(text, "$1")
+	text = plainRefPattern.ReplaceAllString(text, "$1")
+	text = rawTagPattern.ReplaceAllString(text, "")
+	text = strings.NewReplacer("`", "", "**", "", "__", "", "~~", "").Replace(text)
+	text = italicPattern.ReplaceAllString(text, "$1$2")
+	return strings.TrimSpace(spacePattern.ReplaceAllString(text, " "))
+}
+
+// truncate cuts text to at most max characters, at the last word boundary
+func truncate(text string, max int) string {
+	runes := []rune(text)
+	if max <= 0 || len(runes) <= max {
+		return text
+	}
+	cut := string(runes[:max])
+	if i := strings.LastIndex(cut, " "); i > max/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,;:.") + "…"
+}
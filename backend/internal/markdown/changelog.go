@@ -0,0 +1,46 @@
+package markdown
+
+import "strings"
+
+// ChangelogSection returns the section of a changelog (e.g. "## [1.2.0] - 2024-05-01"
+// or "## v1.2.0") for version, without its heading; "" if there is none. The section
+// ends at the next heading of the same or a higher level.
+func ChangelogSection(changelog, version string) string {
+	version = strings.TrimPrefix(version, "v")
+	lines := strings.Split(strings.ReplaceAll(changelog, "\r\n", "\n"), "\n")
+
+	start, level := -1, 0
+	var section []string
+	for i, line := range lines {
+		m := headingPattern.FindStringSubmatch(line)
+		if start >= 0 {
+			if m != nil && len(m[1]) <= level {
+				break
+			}
+			section = append(section, line)
+			continue
+		}
+		if m != nil && headingNamesVersion(m[2], version) {
+			start, level = i, len(m[1])
+		}
+	}
+	return strings.TrimSpace(strings.Join(section, "\n"))
+}
+
+// headingNamesVersion reports whether a heading's first word is version, allowing a
+// "v" prefix and brackets or links around it
+func headingNamesVersion(heading, version string) bool {
+	fields := strings.Fields(plainLinkPattern.ReplaceAllString(heading, "$1"))
+	if len(fields) == 0 {
+		return false
+	}
+	word := strings.Trim(fields[0], "[]()")
+	if strings.EqualFold(word, "version") || strings.EqualFold(word, "release") {
+		if len(fields) < 2 {
+			return false
+		}
+		word = strings.Trim(fields[1], "[]()")
+	}
+	word = strings.TrimSuffix(word, ":")
+	return strings.TrimPrefix(word, "v") == version
+}
@@ -0,0 +1,413 @@
+// Package markdown renders README markdown to HTML that is safe to embed in the frontend.
+//
+// The output is sanitized by construction: all text is HTML-escaped, raw HTML in the
+// source is dropped (its text is kept), only a fixed set of tags is emitted and link
+// and image URLs are limited to http, https, mailto and relative URLs.
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	commentPattern   = regexp.MustCompile(`(?s)<!--.*?-->`)
+	scriptPattern    = regexp.MustCompile(`(?is)<script\b.*?</script\s*>|<style\b.*?</style\s*>`)
+	fencePattern     = regexp.MustCompile("^ {0,3}(```+|~~~+)\\s*([\\w+#.-]*)")
+	headingPattern   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:\s+(.*?))?(?:\s+#+)?\s*$`)
+	rulePattern      = regexp.MustCompile(`^ {0,3}((\*\s*){3,}|(-\s*){3,}|(_\s*){3,})$`)
+	listItemPattern  = regexp.MustCompile(`^(\s*)([-*+]|\d{1,9}[.)])(\s+|$)(.*)$`)
+	setextPattern    = regexp.MustCompile(`^ {0,3}(=+|-+)\s*$`)
+	tableSepPattern  = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+	quotePattern     = regexp.MustCompile(`^ {0,3}> ?`)
+	rawTagPattern    = regexp.MustCompile(`</?[A-Za-z][A-Za-z0-9-]*(\s[^<>]*)?/?>`)
+	imagePattern     = regexp.MustCompile(`!\[([^\]]*)\]\(\s*([^)\s]+)(?:\s+&#34;[^)]*?&#34;)?\s*\)`)
+	linkPattern      = regexp.MustCompile(`\[([^\]]+)\]\(\s*([^)\s]*)(?:\s+&#34;[^)]*?&#34;)?\s*\)`)
+	autolinkPattern  = regexp.MustCompile(`&lt;((?:https?://|mailto:)[^\s&]+)&gt;`)
+	bareURLPattern   = regexp.MustCompile(`https?://[^\s<>"\x00]+[^\s<>"\x00.,;:!?)]`)
+	boldPattern      = regexp.MustCompile(`\*\*([^*\s](?:.*?[^*\s])?)\*\*|__([^_\s](?:.*?[^_\s])?)__`)
+	italicPattern    = regexp.MustCompile(`\*([^*\s](?:[^*]*[^*\s])?)\*|\b_([^_\s](?:[^_]*[^_\s])?)_\b`)
+	strikePattern    = regexp.MustCompile(`~~([^~]+)~~`)
+	placeholderRegex = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// ToHTML renders markdown (CommonMark with GitHub tables, fenced code and strikethrough)
+func ToHTML(source string) string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = commentPattern.ReplaceAllString(source, "")
+	source = scriptPattern.ReplaceAllString(source, "")
+	var b strings.Builder
+	renderBlocks(&b, strings.Split(source, "\n"))
+	return b.String()
+}
+
+// renderBlocks renders a sequence of lines as block elements
+func renderBlocks(b *strings.Builder, lines []string) {
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			fmt.Fprintf(b, "<p>%s</p>\n", inline(strings.Join(paragraph, "\n")))
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			flush()
+
+		case fencePattern.MatchString(line):
+			flush()
+			m := fencePattern.FindStringSubmatch(line)
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), m[1]); i++ {
+				code = append(code, lines[i])
+			}
+			class := ""
+			if m[2] != "" {
+				class = fmt.Sprintf(` class="language-%s"`, html.EscapeString(m[2]))
+			}
+			fmt.Fprintf(b, "<pre><code%s>%s</code></pre>\n", class, html.EscapeString(strings.Join(code, "\n")))
+
+		case headingPattern.MatchString(line):
+			flush()
+			m := headingPattern.FindStringSubmatch(line)
+			level := len(m[1])
+			fmt.Fprintf(b, "<h%d id=\"%s\">%s</h%d>\n", level, slug(m[2]), inline(m[2]), level)
+
+		case len(paragraph) > 0 && setextPattern.MatchString(line) && !listItemPattern.MatchString(paragraph[0]):
+			level := 1
+			if strings.HasPrefix(trimmed, "-") {
+				level = 2
+			}
+			text := strings.Join(paragraph, " ")
+			paragraph = nil
+			fmt.Fprintf(b, "<h%d id=\"%s\">%s</h%d>\n", level, slug(text), inline(text), level)
+
+		case rulePattern.MatchString(line):
+			flush()
+			b.WriteString("<hr>\n")
+
+		case quotePattern.MatchString(line):
+			flush()
+			var quoted []string
+			for ; i < len(lines) && quotePattern.MatchString(lines[i]); i++ {
+				quoted = append(quoted, quotePattern.ReplaceAllString(lines[i], ""))
+			}
+			i--
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, quoted)
+			b.WriteString("</blockquote>\n")
+
+		case listItemPattern.MatchString(line) && (len(paragraph) == 0 || !strings.HasPrefix(line, " ")):
+			flush()
+			i = renderList(b, lines, i) - 1
+
+		case len(paragraph) == 0 && strings.Contains(line, "|") && i+1 < len(lines) && tableSepPattern.MatchString(lines[i+1]):
+			i = renderTable(b, lines, i) - 1
+
+		case len(paragraph) == 0 && (strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")):
+			var code []string
+			for ; i < len(lines) && (strings.HasPrefix(lines[i], "    ") || strings.HasPrefix(lines[i], "\t") || strings.TrimSpace(lines[i]) == ""); i++ {
+				code = append(code, strings.TrimPrefix(strings.TrimPrefix(lines[i], "\t"), "    "))
+			}
+			i--
+			for len(code) > 0 && strings.TrimSpace(code[len(code)-1]) == "" {
+				code = code[:len(code)-1]
+			}
+			fmt.Fprintf(b, "<pre><code>%s</code></pre>\n", html.EscapeString(strings.Join(code, "\n")))
+
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+}
+
+// renderList renders the list starting at lines[start] and returns the index of the
+// first line after it. Items are the lines indented further than their marker.
+func renderList(b *strings.Builder, lines []string, start int) int {
+	first := listItemPattern.FindStringSubmatch(lines[start])
+	indent := len(first[1])
+	ordered := first[2] != "-" && first[2] != "*" && first[2] != "+"
+
+	if ordered {
+		n, _ := strconv.Atoi(strings.TrimRight(first[2], ".)"))
+		if n != 1 {
+			fmt.Fprintf(b, "<ol start=\"%d\">\n", n)
+		} else {
+			b.WriteString("<ol>\n")
+		}
+	} else {
+		b.WriteString("<ul>\n")
+	}
+
+	i := start
+	for i < len(lines) {
+		m := listItemPattern.FindStringSubmatch(lines[i])
+		if m == nil || len(m[1]) != indent {
+			break
+		}
+		itemOrdered := m[2] != "-" && m[2] != "*" && m[2] != "+"
+		if itemOrdered != ordered {
+			break
+		}
+
+		// The item's content starts after the marker; continuation lines must be indented
+		contentIndent := indent + len(m[2]) + len(m[3])
+		item := []string{m[4]}
+		loose := false
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if strings.TrimSpace(line) == "" {
+				// A blank line continues the item only if indented content follows
+				if i+1 < len(lines) && leadingSpaces(lines[i+1]) > indent && strings.TrimSpace(lines[i+1]) != "" {
+					item = append(item, "")
+					loose = true
+					continue
+				}
+				break
+			}
+			if leadingSpaces(line) <= indent && (listItemPattern.MatchString(line) || item[len(item)-1] == "" ||
+				headingPattern.MatchString(line) || fencePattern.MatchString(line)) {
+				break
+			}
+			item = append(item, strings.TrimPrefix(line, strings.Repeat(" ", min(contentIndent, leadingSpaces(line)))))
+		}
+
+		var content strings.Builder
+		renderBlocks(&content, item)
+		rendered := content.String()
+		// Tight items render their single paragraph without <p>
+		if !loose && strings.HasPrefix(rendered, "<p>") {
+			if end := strings.Index(rendered, "</p>\n"); end >= 0 {
+				rendered = rendered[3:end] + rendered[end+5:]
+			}
+		}
+		fmt.Fprintf(b, "<li>%s</li>\n", strings.TrimSuffix(rendered, "\n"))
+
+		// Skip blank lines between items of the same list
+		for i < len(lines) && strings.TrimSpace(lines[i]) == "" && i+1 < len(lines) {
+			if next := listItemPattern.FindStringSubmatch(lines[i+1]); next != nil && len(next[1]) == indent {
+				i++
+				continue
+			}
+			break
+		}
+	}
+
+	if ordered {
+		b.WriteString("</ol>\n")
+	} else {
+		b.WriteString("</ul>\n")
+	}
+	return i
+}
+
+// renderTable renders a GitHub table whose header is lines[start] and returns the index
+// of the first line after it
+func renderTable(b *strings.Builder, lines []string, start int) int {
+	header := tableCells(lines[start])
+	var aligns []string
+	for _, cell := range tableCells(lines[start+1]) {
+		switch {
+		case strings.HasPrefix(cell, ":") && strings.HasSuffix(cell, ":"):
+			aligns = append(aligns, "center")
+		case strings.HasSuffix(cell, ":"):
+			aligns = append(aligns, "right")
+		case strings.HasPrefix(cell, ":"):
+			aligns = append(aligns, "left")
+		default:
+			aligns = append(aligns, "")
+		}
+	}
+
+	row := func(tag string, cells []string) {
+		b.WriteString("<tr>")
+		for i := range header {
+			cell := ""
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			if i < len(aligns) && aligns[i] != "" {
+				fmt.Fprintf(b, "<%s align=\"%s\">%s</%s>", tag, aligns[i], inline(cell), tag)
+			} else {
+				fmt.Fprintf(b, "<%s>%s</%s>", tag, inline(cell), tag)
+			}
+		}
+		b.WriteString("</tr>\n")
+	}
+
+	b.WriteString("<table>\n<thead>\n")
+	row("th", header)
+	b.WriteString("</thead>\n<tbody>\n")
+	i := start + 2
+	for ; i < len(lines) && strings.TrimSpace(lines[i]) != "" && strings.Contains(lines[i], "|"); i++ {
+		row("td", tableCells(lines[i]))
+	}
+	b.WriteString("</tbody>\n</table>\n")
+	return i
+}
+
+// tableCells splits a table row on unescaped pipes outside code spans
+func tableCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+
+	var cells []string
+	var cell strings.Builder
+	inCode := false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case c == '`':
+			inCode = !inCode
+			cell.WriteByte(c)
+		case c == '|' && !inCode:
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(c)
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// inline renders the inline elements of a block's text
+func inline(text string) string {
+	var stash []string
+	keep := func(s string) string {
+		stash = append(stash, s)
+		return fmt.Sprintf("\x00%d\x00", len(stash)-1)
+	}
+
+	// Code spans and backslash escapes are literal
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && strings.IndexByte("\\`*_{}[]()#+-.!|~<>", text[i+1]) >= 0:
+			b.WriteString(keep(html.EscapeString(text[i+1 : i+2])))
+			i++
+		case c == '`':
+			n := 1
+			for i+n < len(text) && text[i+n] == '`' {
+				n++
+			}
+			fence := strings.Repeat("`", n)
+			if end := strings.Index(text[i+n:], fence); end >= 0 {
+				code := strings.TrimSpace(text[i+n : i+n+end])
+				b.WriteString(keep("<code>" + html.EscapeString(code) + "</code>"))
+				i += n + end + n - 1
+			} else {
+				b.WriteString(fence)
+				i += n - 1
+			}
+		case c == '<' && (strings.HasPrefix(text[i:], "<http://") || strings.HasPrefix(text[i:], "<https://") || strings.HasPrefix(text[i:], "<mailto:")):
+			b.WriteByte(c)
+		case c == '<':
+			// Raw HTML is dropped; the text between tags is kept
+			if loc := rawTagPattern.FindStringIndex(text[i:]); loc != nil && loc[0] == 0 {
+				if tag := strings.ToLower(text[i : i+loc[1]]); strings.HasPrefix(tag, "<br") {
+					b.WriteString(keep("<br>"))
+				}
+				i += loc[1] - 1
+				continue
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	out := html.EscapeString(b.String())
+
+	out = imagePattern.ReplaceAllStringFunc(out, func(s string) string {
+		m := imagePattern.FindStringSubmatch(s)
+		src, ok := safeURL(m[2])
+		if !ok {
+			return m[1]
+		}
+		return keep(fmt.Sprintf(`<img src="%s" alt="%s">`, src, m[1]))
+	})
+	out = linkPattern.ReplaceAllStringFunc(out, func(s string) string {
+		m := linkPattern.FindStringSubmatch(s)
+		href, ok := safeURL(m[2])
+		if !ok {
+			return m[1]
+		}
+		return keep(fmt.Sprintf(`<a href="%s" rel="nofollow">%s</a>`, href, emphasis(m[1])))
+	})
+	out = autolinkPattern.ReplaceAllStringFunc(out, func(s string) string {
+		m := autolinkPattern.FindStringSubmatch(s)
+		return keep(fmt.Sprintf(`<a href="%s" rel="nofollow">%s</a>`, m[1], m[1]))
+	})
+	out = bareURLPattern.ReplaceAllStringFunc(out, func(s string) string {
+		return keep(fmt.Sprintf(`<a href="%s" rel="nofollow">%s</a>`, s, s))
+	})
+
+	out = emphasis(out)
+
+	// Placeholders can nest (a link around an image), so expand until none are left
+	for placeholderRegex.MatchString(out) {
+		out = placeholderRegex.ReplaceAllStringFunc(out, func(s string) string {
+			n, _ := strconv.Atoi(strings.Trim(s, "\x00"))
+			return stash[n]
+		})
+	}
+	return out
+}
+
+// emphasis renders bold, italic and strikethrough text
+func emphasis(s string) string {
+	s = boldPattern.ReplaceAllString(s, "<strong>$1$2</strong>")
+	s = italicPattern.ReplaceAllString(s, "<em>$1$2</em>")
+	return strikePattern.ReplaceAllString(s, "<del>$1</del>")
+}
+
+// safeURL checks an escaped URL from the source and returns it for use in an attribute.
+// Only http, https, mailto and relative URLs are allowed.
+func safeURL(escaped string) (string, bool) {
+	raw := strings.TrimSpace(html.UnescapeString(escaped))
+	if colon := strings.Index(raw, ":"); colon >= 0 {
+		// A colon after the first slash, ? or # is part of a relative URL
+		if cut := strings.IndexAny(raw, "/?#"); cut < 0 || colon < cut {
+			scheme := strings.ToLower(raw[:colon])
+			if scheme != "http" && scheme != "https" && scheme != "mailto" {
+				return "", false
+			}
+		}
+	}
+	return html.EscapeString(raw), true
+}
+
+// slug returns the anchor id GitHub gives a heading
+func slug(text string) string {
+	text = rawTagPattern.ReplaceAllString(text, "")
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(text)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('-')
+		case r > 127:
+			b.WriteRune(r)
+		}
+	}
+	return html.EscapeString(b.String())
+}
+
+func leadingSpaces(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
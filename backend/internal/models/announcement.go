@@ -0,0 +1,45 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Announcement is a banner the frontend shows, such as a maintenance window or a deprecation
+// notice. It is global or attached to one namespace, module or provider, and is shown
+// between StartsAt and EndsAt (either may be open).
+type Announcement struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Message     string     `json:"message"`
+	Severity    string     `json:"severity"` // "info", "warning" or "critical"
+	NamespaceID *string    `json:"namespace_id,omitempty"`
+	ModuleID    *string    `json:"module_id,omitempty"`
+	ProviderID  *string    `json:"provider_id,omitempty"`
+	StartsAt    time.Time  `json:"starts_at"`
+	EndsAt      *time.Time `json:"ends_at,omitempty"`
+	Active      bool       `json:"active"` // Shown right now
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// AnnouncementCreate is used for publishing an announcement
+type AnnouncementCreate struct {
+	Title       string     `json:"title" binding:"required"`
+	Message     string     `json:"message"`
+	Severity    string     `json:"severity"` // Default: "info"
+	NamespaceID *string    `json:"namespace_id,omitempty"`
+	ModuleID    *string    `json:"module_id,omitempty"`
+	ProviderID  *string    `json:"provider_id,omitempty"`
+	StartsAt    *time.Time `json:"starts_at,omitempty"` // Default: now
+	EndsAt      *time.Time `json:"ends_at,omitempty"`   // Default: until deleted
+}
+
+// AnnouncementUpdate is used for editing an announcement. The target cannot change.
+type AnnouncementUpdate struct {
+	Title    *string         `json:"title,omitempty"`
+	Message  *string         `json:"message,omitempty"`
+	Severity *string         `json:"severity,omitempty"`
+	StartsAt *time.Time      `json:"starts_at,omitempty"`
+	EndsAt   json.RawMessage `json:"ends_at,omitempty"` // A time, or null to show the announcement until deleted
+}
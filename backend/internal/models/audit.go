@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// AuditEvent records a security-relevant action and who performed it
+type AuditEvent struct {
+	ID         string                 `json:"id"`
+	Action     string                 `json:"action"`      // e.g., "run.env_vars_revealed"
+	Actor      string                 `json:"actor"`       // Name of the API key used
+	TargetType string                 `json:"target_type"` // e.g., "deployment_run"
+	TargetID   string                 `json:"target_id"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// DeadLetter is a notification NOTIFICATION_WEBHOOK_URL did not accept after all retries,
+// kept so it can be redelivered once the receiver is back
+type DeadLetter struct {
+	ID            string                 `json:"id"`
+	EventType     string                 `json:"event_type"`
+	Payload       map[string]interface{} `json:"payload"` // The event as it was posted
+	Attempts      int                    `json:"attempts"`
+	LastError     string                 `json:"last_error"`
+	CreatedAt     time.Time              `json:"created_at"`
+	LastAttemptAt time.Time              `json:"last_attempt_at"`
+	RedeliveredAt *time.Time             `json:"redelivered_at,omitempty"`
+	RedeliveredBy *string                `json:"redelivered_by,omitempty"`
+}
@@ -1,16 +1,31 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Deployment represents an IaC deployment repository
 type Deployment struct {
-	ID          string    `json:"id"`
-	NamespaceID string    `json:"namespace_id"`
-	Name        string    `json:"name"`
-	Description *string   `json:"description,omitempty"`
-	GitURL      string    `json:"git_url"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID                 string             `json:"id"`
+	NamespaceID        string             `json:"namespace_id"`
+	Name               string             `json:"name"`
+	Description        *string            `json:"description,omitempty"`
+	GitURL             string             `json:"git_url"`
+	TerraformWorkspace *string            `json:"terraform_workspace,omitempty"` // Default CLI workspace for runs
+	Hooks              DeploymentHooks    `json:"hooks"`                         // Custom commands run around terraform
+	RunnerImage        *string            `json:"runner_image,omitempty"`        // Container image runs execute in
+	AutoDestroyAfter   *string            `json:"auto_destroy_after,omitempty"`  // TTL since last apply (e.g., "72h")
+	PlanValidity       *string            `json:"plan_validity,omitempty"`       // How long a plan may await approval (default: PLAN_VALIDITY)
+	CloneOptions       CloneOptions       `json:"clone_options"`                 // How the runner checks out the repository
+	Pipeline           PipelineOptions    `json:"pipeline"`                      // Optional pipeline stages
+	Terragrunt         TerragruntOptions  `json:"terragrunt"`                    // How runs with tool "terragrunt" invoke terragrunt
+	WatchPaths         []string           `json:"watch_paths"`                   // Extra globs whose changes affect the deployment (e.g., "modules/**")
+	RegistryNamespaces []string           `json:"registry_namespaces"`           // Private namespaces runs may read besides the deployment's own
+	Concurrency        ConcurrencyOptions `json:"concurrency"`                   // Concurrency groups the deployment's runs apply in
+	CredentialStatus   *string            `json:"credential_status,omitempty"`   // valid, expiring, expired, invalid (private repos only)
+	CreatedAt          time.Time          `json:"created_at"`
+	UpdatedAt          time.Time          `json:"updated_at"`
 }
 
 // DeploymentWithNamespace includes namespace information
@@ -21,15 +36,134 @@ type DeploymentWithNamespace struct {
 
 // DeploymentCreate is used for creating a new deployment
 type DeploymentCreate struct {
+	NamespaceID string              `json:"namespace_id" binding:"required"`
+	Name        string              `json:"name" binding:"required"`
+	Description *string             `json:"description,omitempty"`
+	GitURL      string              `json:"git_url" binding:"required"`
+	IsPrivate   bool                `json:"is_private,omitempty"`
+	GitUsername string              `json:"git_username,omitempty"`
+	GitPassword string              `json:"git_password,omitempty"`
+	Concurrency *ConcurrencyOptions `json:"concurrency,omitempty"`
+	DeploymentSettings
+}
+
+// DeploymentSettings are the optional settings of a deployment, shared with the
+// deployment templates new deployments can be created from
+type DeploymentSettings struct {
+	TerraformWorkspace *string            `json:"terraform_workspace,omitempty"` // Default CLI workspace for runs
+	Hooks              *DeploymentHooks   `json:"hooks,omitempty"`               // Custom commands run around terraform
+	RunnerImage        *string            `json:"runner_image,omitempty"`        // Container image runs execute in
+	AutoDestroyAfter   *string            `json:"auto_destroy_after,omitempty"`  // TTL since last apply (e.g., "72h")
+	PlanValidity       *string            `json:"plan_validity,omitempty"`       // How long a plan may await approval (e.g., "24h")
+	CloneOptions       *CloneOptions      `json:"clone_options,omitempty"`       // How the runner checks out the repository
+	Pipeline           *PipelineOptions   `json:"pipeline,omitempty"`            // Optional pipeline stages, including policy checks
+	Terragrunt         *TerragruntOptions `json:"terragrunt,omitempty"`          // How runs with tool "terragrunt" invoke terragrunt
+	WatchPaths         []string           `json:"watch_paths,omitempty"`         // Extra globs whose changes affect the deployment
+	RegistryNamespaces []string           `json:"registry_namespaces,omitempty"` // Private namespaces runs may read besides the deployment's own
+}
+
+// DeploymentClone is used for creating a deployment with the settings of another
+type DeploymentClone struct {
+	Name        string  `json:"name" binding:"required"`
+	NamespaceID string  `json:"namespace_id,omitempty"` // Defaults to the source deployment's namespace
+	Description *string `json:"description,omitempty"`  // Defaults to the source deployment's description
+	GitURL      string  `json:"git_url,omitempty"`      // Defaults to the source repository; credentials are only copied for the same host
+}
+
+// DeploymentTemplate is a standard deployment shape to create new deployments from
+type DeploymentTemplate struct {
+	ID            string             `json:"id"`
+	Name          string             `json:"name"`
+	Description   *string            `json:"description,omitempty"`
+	GitURLPattern string             `json:"git_url_pattern"` // {namespace} and {name} are replaced by the new deployment's
+	Settings      DeploymentSettings `json:"settings"`
+	CreatedAt     time.Time          `json:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at"`
+}
+
+// DeploymentTemplateCreate is used for creating a deployment template
+type DeploymentTemplateCreate struct {
+	Name          string             `json:"name" binding:"required"`
+	Description   *string            `json:"description,omitempty"`
+	GitURLPattern string             `json:"git_url_pattern" binding:"required"`
+	Settings      DeploymentSettings `json:"settings"`
+}
+
+// DeploymentTemplateUpdate is used for updating a deployment template; settings are
+// replaced as a whole
+type DeploymentTemplateUpdate struct {
+	Description   *string             `json:"description,omitempty"`
+	GitURLPattern *string             `json:"git_url_pattern,omitempty"`
+	Settings      *DeploymentSettings `json:"settings,omitempty"`
+}
+
+// DeploymentFromTemplate is used for creating a deployment from a template
+type DeploymentFromTemplate struct {
 	NamespaceID string  `json:"namespace_id" binding:"required"`
 	Name        string  `json:"name" binding:"required"`
 	Description *string `json:"description,omitempty"`
-	GitURL      string  `json:"git_url" binding:"required"`
+	GitURL      string  `json:"git_url,omitempty"` // Overrides the template's git_url_pattern
 	IsPrivate   bool    `json:"is_private,omitempty"`
 	GitUsername string  `json:"git_username,omitempty"`
 	GitPassword string  `json:"git_password,omitempty"`
 }
 
+// DeploymentUpdate is used for updating a deployment
+type DeploymentUpdate struct {
+	Description        *string             `json:"description,omitempty"`
+	TerraformWorkspace *string             `json:"terraform_workspace,omitempty"`
+	Hooks              *DeploymentHooks    `json:"hooks,omitempty"`
+	RunnerImage        *string             `json:"runner_image,omitempty"`       // Empty string resets to the default runner toolchain
+	AutoDestroyAfter   *string             `json:"auto_destroy_after,omitempty"` // Empty string disables auto-destroy
+	PlanValidity       *string             `json:"plan_validity,omitempty"`      // Empty string resets to PLAN_VALIDITY
+	CloneOptions       *CloneOptions       `json:"clone_options,omitempty"`
+	Pipeline           *PipelineOptions    `json:"pipeline,omitempty"`
+	Terragrunt         *TerragruntOptions  `json:"terragrunt,omitempty"`
+	WatchPaths         *[]string           `json:"watch_paths,omitempty"`         // Empty list clears the globs
+	RegistryNamespaces *[]string           `json:"registry_namespaces,omitempty"` // Empty list limits runs to the deployment's namespace
+	Concurrency        *ConcurrencyOptions `json:"concurrency,omitempty"`         // Replaced as a whole; {} removes the groups
+}
+
+// ConcurrencyOptions puts the runs of a deployment in named concurrency groups. Across all
+// deployments, only one run of a group applies at a time; approved runs wait for their turn.
+type ConcurrencyOptions struct {
+	Group      string            `json:"group,omitempty"`      // Group of the deployment's runs
+	Workspaces map[string]string `json:"workspaces,omitempty"` // Group of runs in a workspace, instead of Group ("default" for runs without one)
+}
+
+// CloneOptions controls how the runner checks out a deployment repository
+type CloneOptions struct {
+	Sparse     bool     `json:"sparse"`                                       // Sparse, blob-filtered checkout of only the run path (plus ExtraPaths)
+	ExtraPaths []string `json:"extra_paths" binding:"omitempty,dive,relpath"` // Additional directories to check out, e.g. shared local modules
+	Submodules bool     `json:"submodules"`                                   // Initialise git submodules after cloning
+}
+
+// PipelineOptions enables the optional stages of the runner pipeline
+type PipelineOptions struct {
+	Validate     bool      `json:"validate"`      // Run terraform validate between init and plan
+	PolicyChecks []RunHook `json:"policy_checks"` // Commands run against the plan (TFPLAN_JSON) before approval
+}
+
+// TerragruntOptions configures runs that use terragrunt as their tool
+type TerragruntOptions struct {
+	RunAll   bool   `json:"run_all"`   // Run every command with run-all across all units below the run path
+	TFBinary string `json:"tf_binary"` // Binary terragrunt wraps: "terraform" (default) or "tofu"
+}
+
+// DeploymentHooks groups the custom commands executed by the runner during a run
+type DeploymentHooks struct {
+	PreInit   []RunHook `json:"pre_init" yaml:"pre_init"`     // Executed after clone, before terraform init
+	PostApply []RunHook `json:"post_apply" yaml:"post_apply"` // Executed after a successful terraform apply
+}
+
+// RunHook is a custom shell command executed inside the run's working directory
+type RunHook struct {
+	Name      string `json:"name,omitempty" yaml:"name"`
+	Command   string `json:"command" yaml:"command"`
+	Timeout   int    `json:"timeout,omitempty" yaml:"timeout"`       // Timeout in seconds (default: 300)
+	OnFailure string `json:"on_failure,omitempty" yaml:"on_failure"` // "fail" (default) or "warn"
+}
+
 // GitReference represents a branch or tag
 type GitReference struct {
 	Name string `json:"name"`
@@ -39,63 +173,373 @@ type GitReference struct {
 
 // FileNode represents a file or directory in the repository
 type FileNode struct {
-	Name  string `json:"name"`
-	Path  string `json:"path"`
-	Type  string `json:"type"` // "file" or "dir"
-	Size  int64  `json:"size,omitempty"`
-	IsDir bool   `json:"is_dir"`
+	Name               string `json:"name"`
+	Path               string `json:"path"`
+	Type               string `json:"type"` // "file" or "dir"
+	Size               int64  `json:"size,omitempty"`
+	IsDir              bool   `json:"is_dir"`
+	Deployable         bool   `json:"deployable,omitempty"`          // Directory holds IaC files, so runs can target it
+	IaCType            string `json:"iac_type,omitempty"`            // "terraform", "tofu" or "terragrunt" for deployable directories
+	ContainsDeployable bool   `json:"contains_deployable,omitempty"` // A directory directly below is deployable
+}
+
+// TfvarsFile is a .tfvars or .tfvars.json file of a deployment directory, checked against
+// the variables the directory declares
+type TfvarsFile struct {
+	Name            string            `json:"name"`
+	Content         string            `json:"content"`
+	Values          map[string]string `json:"values"`                // Variable name to the value's source text
+	Undeclared      []string          `json:"undeclared"`            // Set but not declared by the directory
+	MissingRequired []string          `json:"missing_required"`      // Declared without default but not set here
+	ParseError      string            `json:"parse_error,omitempty"` // .tfvars.json that is not a JSON object
 }
 
 // DirectoryListing represents the contents of a directory
 type DirectoryListing struct {
-	Path      string     `json:"path"`
-	Files     []FileNode `json:"files"`
-	Readme    *string    `json:"readme,omitempty"`
-	HasGitOps bool       `json:"has_gitops"` // If directory contains IaC files
+	Path                string          `json:"path"`
+	Files               []FileNode      `json:"files"`
+	Readme              *string         `json:"readme,omitempty"`
+	HasGitOps           bool            `json:"has_gitops"`         // If directory contains IaC files
+	IaCType             string          `json:"iac_type,omitempty"` // Tool the directory's IaC files are for
+	PlatformConfig      *PlatformConfig `json:"platform_config,omitempty"`
+	PlatformConfigError string          `json:"platform_config_error,omitempty"`
 }
 
 // DeploymentRun represents an execution of a deployment
 type DeploymentRun struct {
-	ID           string            `json:"id"`
-	DeploymentID string            `json:"deployment_id"`
-	Path         string            `json:"path"`
-	Ref          string            `json:"ref"`
-	Tool         string            `json:"tool"`         // "tofu" or "terraform"
-	EnvVars      map[string]string `json:"env_vars"`     // Environment variables
-	TfvarsFiles  []string          `json:"tfvars_files"` // List of .tfvars files to use
-	InitFlags    string            `json:"init_flags"`   // Additional flags for init command
-	PlanFlags    string            `json:"plan_flags"`   // Additional flags for plan command
-	Status       string            `json:"status"`       // "pending", "initializing", "planning", "awaiting_approval", "applying", "success", "failed", "cancelled"
-	InitLog      string            `json:"init_log"`     // Init command output
-	PlanLog      string            `json:"plan_log"`     // Plan command output
-	PlanOutput   string            `json:"plan_output"`  // Plan outputs (terraform output)
-	ApplyLog     string            `json:"apply_log"`    // Apply command output
-	ApplyOutput  string            `json:"apply_output"` // Apply outputs (terraform output)
-	ErrorMessage *string           `json:"error_message,omitempty"`
-	WorkDir      string            `json:"work_dir"` // Temporary work directory
-	ApprovedBy   *string           `json:"approved_by,omitempty"`
-	ApprovedAt   *time.Time        `json:"approved_at,omitempty"`
-	CreatedAt    time.Time         `json:"created_at"`
-	StartedAt    *time.Time        `json:"started_at,omitempty"`
-	CompletedAt  *time.Time        `json:"completed_at,omitempty"`
+	ID                 string                `json:"id"`
+	DeploymentID       string                `json:"deployment_id"`
+	Path               string                `json:"path"`
+	Ref                string                `json:"ref"`
+	CommitSHA          *string               `json:"commit_sha,omitempty"`          // Commit the run checked out (pinned or resolved at clone time)
+	Tool               string                `json:"tool"`                          // "tofu", "terraform" or "terragrunt"; "auto" until the runner resolved it
+	ToolVersion        *string               `json:"tool_version,omitempty"`        // Version the runner selected
+	EnvVars            map[string]string     `json:"env_vars"`                      // Environment variables, values redacted in responses
+	StoredEnvVars      string                `json:"-"`                             // env_vars column as stored (encrypted), copied to child runs
+	TfvarsFiles        []string              `json:"tfvars_files"`                  // List of .tfvars files to use
+	InitFlags          string                `json:"init_flags"`                    // Additional flags for init command
+	PlanFlags          string                `json:"plan_flags"`                    // Additional flags for plan command
+	TerraformWorkspace string                `json:"terraform_workspace,omitempty"` // CLI workspace selected before plan
+	Status             string                `json:"status"`                        // "pending", "initializing", "planning", "awaiting_approval", "applying", "success", "failed", "cancelled", "stale", "expired"
+	InitLog            string                `json:"init_log"`                      // Init command output
+	PlanLog            string                `json:"plan_log"`                      // Plan command output
+	PlanOutput         string                `json:"plan_output"`                   // Plan outputs (terraform output)
+	ApplyLog           string                `json:"apply_log"`                     // Apply command output
+	ApplyOutput        string                `json:"apply_output"`                  // Apply outputs (terraform output)
+	HookLog            string                `json:"hook_log"`                      // Pre-init and post-apply hook output
+	ApplyReport        []ApplyResourceResult `json:"apply_report"`                  // Per-resource apply results
+	Operation          string                `json:"operation"`                     // "apply" or a follow-up operation such as "import"
+	OperationArgs      json.RawMessage       `json:"operation_args,omitempty"`      // Operation input (e.g., import pairs)
+	ParentRunID        *string               `json:"parent_run_id,omitempty"`       // Run whose working directory the operation reused
+	ReproducesRunID    *string               `json:"reproduces_run_id,omitempty"`   // Run whose manifest the run replays
+	StackRunID         *string               `json:"stack_run_id,omitempty"`        // Stack run the run is part of
+	OperationResult    *OperationResult      `json:"operation_result,omitempty"`    // Command and state versions of state operations
+	CodeChanges        *RunCodeChanges       `json:"code_changes,omitempty"`        // Files changed since the path's last successful apply
+	ErrorMessage       *string               `json:"error_message,omitempty"`
+	FailureCategory    *string               `json:"failure_category,omitempty"` // e.g. "state_lock", "provider_auth"; set when the run failed
+	FailureHint        *string               `json:"failure_hint,omitempty"`     // Suggested remediation for the category
+	StateLock          *StateLock            `json:"state_lock,omitempty"`       // Lock held by someone else when the run failed on it
+	CommandExit        *CommandExit          `json:"command_exit,omitempty"`     // How the command that failed the run ended
+	WorkDir            string                `json:"work_dir"`                   // Temporary work directory
+	RunnerURL          *string               `json:"runner_url,omitempty"`       // Runner the run executes on
+	ApprovedBy         *string               `json:"approved_by,omitempty"`
+	ApprovedAt         *time.Time            `json:"approved_at,omitempty"`
+	PlanExpiresAt      *time.Time            `json:"plan_expires_at,omitempty"` // Approval deadline; afterwards the run expires
+	ApprovalComment    *string               `json:"approval_comment,omitempty"`
+	ChangeTicket       *string               `json:"change_ticket,omitempty"`
+	ApplyNotBefore     *time.Time            `json:"apply_not_before,omitempty"`  // Approved apply waits until this time
+	ConcurrencyGroup   *string               `json:"concurrency_group,omitempty"` // Group the run applies in, one run at a time
+	RequiredFeatures   []string              `json:"required_features,omitempty"` // Version-dependent language features the configuration uses
+	CreatedAt          time.Time             `json:"created_at"`
+	StartedAt          *time.Time            `json:"started_at,omitempty"`
+	CompletedAt        *time.Time            `json:"completed_at,omitempty"`
+}
+
+// RunSummary is a run as listed by the run search, without logs
+type RunSummary struct {
+	ID              string     `json:"id"`
+	DeploymentID    string     `json:"deployment_id"`
+	DeploymentName  string     `json:"deployment_name"`
+	Namespace       string     `json:"namespace"`
+	Path            string     `json:"path"`
+	Ref             string     `json:"ref"`
+	CommitSHA       *string    `json:"commit_sha,omitempty"`
+	Tool            string     `json:"tool"`
+	Operation       string     `json:"operation"`
+	Status          string     `json:"status"`
+	ErrorMessage    *string    `json:"error_message,omitempty"`
+	FailureCategory *string    `json:"failure_category,omitempty"`
+	ApprovedBy      *string    `json:"approved_by,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+}
+
+// RunCodeChanges is the code a run changes compared to the last successful apply of the
+// same path and workspace, so approvers can review it next to the plan
+type RunCodeChanges struct {
+	BaseRunID     string   `json:"base_run_id"`
+	BaseCommitSHA string   `json:"base_commit_sha"`
+	CommitSHA     string   `json:"commit_sha"`
+	ChangedFiles  []string `json:"changed_files"`
+	Error         string   `json:"error,omitempty"` // Set when the diff could not be computed
+}
+
+// DeploymentRunStage is the result of one stage of a run's pipeline
+type DeploymentRunStage struct {
+	Name            string     `json:"name"`   // "clone", "pre_hooks", "init", "validate", "plan", "policy", "approval", "apply", "outputs", "post_hooks"
+	Status          string     `json:"status"` // "pending", "running", "success", "failed", "skipped", "cancelled", "stale", "expired"
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+	DurationSeconds float64    `json:"duration_seconds,omitempty"`
+	Log             string     `json:"log,omitempty"`
+	Error           string     `json:"error,omitempty"`
+	Reused          bool       `json:"reused,omitempty"` // Carried over from the retried run
+}
+
+// DeploymentRunRetry is used for retrying a failed run
+type DeploymentRunRetry struct {
+	FromStage string `json:"from_stage,omitempty"` // Stage to resume from (default: the stage that failed)
+}
+
+// ApplyResourceResult describes what happened to a single resource during apply
+type ApplyResourceResult struct {
+	Address        string  `json:"address"`
+	Action         string  `json:"action"` // "create", "update", "delete", "replace", "read", ...
+	Status         string  `json:"status"` // "pending" (started, never finished), "complete", "errored"
+	IDValue        string  `json:"id_value,omitempty"`
+	ElapsedSeconds float64 `json:"elapsed_seconds,omitempty"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// ApplyReport summarizes the per-resource results of a run's apply
+type ApplyReport struct {
+	RunID     string                `json:"run_id"`
+	Status    string                `json:"status"`
+	Complete  int                   `json:"complete"`
+	Errored   int                   `json:"errored"`
+	Pending   int                   `json:"pending"`
+	Resources []ApplyResourceResult `json:"resources"`
+}
+
+// PlanSummary is the human-readable change list of a run's plan
+type PlanSummary struct {
+	RunID            string             `json:"run_id"`
+	Status           string             `json:"status"`
+	Available        bool               `json:"available"` // False until the plan has finished (or for runs planned before summaries existed)
+	TerraformVersion string             `json:"terraform_version,omitempty"`
+	Counts           map[string]int     `json:"counts"` // Changes per action
+	Groups           []PlanChangeGroup  `json:"groups"`
+	Outputs          []PlanOutputChange `json:"outputs"`
+}
+
+// PlanChangeGroup holds the changes of one action, e.g. all replacements
+type PlanChangeGroup struct {
+	Action  string       `json:"action"` // "create", "update", "replace", "delete", "read", "import", "move"
+	Changes []PlanChange `json:"changes"`
+}
+
+// PlanChange describes what the plan does to a single resource instance
+type PlanChange struct {
+	Address         string   `json:"address"`
+	Action          string   `json:"action"`
+	Summary         string   `json:"summary"`          // e.g. "aws_instance.web will be replaced (forces: ami)"
+	Forces          []string `json:"forces,omitempty"` // Attributes that force a replacement
+	Reason          string   `json:"reason,omitempty"`
+	PreviousAddress string   `json:"previous_address,omitempty"`
+	Deposed         string   `json:"deposed,omitempty"`
+}
+
+// PlanOutputChange describes a root module output the plan changes
+type PlanOutputChange struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
 }
 
 // DeploymentRunCreate is used for creating a new deployment run
 type DeploymentRunCreate struct {
-	DeploymentID string            `json:"deployment_id" binding:"required"`
-	Path         string            `json:"path"` // Working directory path (optional, defaults to deployment working_directory)
-	Ref          string            `json:"ref" binding:"required"`
-	Tool         string            `json:"tool" binding:"required"` // "tofu" or "terraform"
-	EnvVars      map[string]string `json:"env_vars,omitempty"`      // Environment variables
-	TfvarsFiles  []string          `json:"tfvars_files,omitempty"`  // List of .tfvars files to use
-	InitFlags    string            `json:"init_flags,omitempty"`    // Additional flags for init command
-	PlanFlags    string            `json:"plan_flags,omitempty"`    // Additional flags for plan command
+	DeploymentID       string            `json:"deployment_id" binding:"required"`
+	Path               string            `json:"path" binding:"omitempty,relpath"`                                      // Working directory path (optional, defaults to deployment working_directory)
+	Ref                string            `json:"ref"`                                                                   // Branch or tag (required unless commit_sha is set)
+	CommitSHA          string            `json:"commit_sha,omitempty"`                                                  // Exact commit to run, for reproducible re-runs
+	Tool               string            `json:"tool" binding:"omitempty,oneof=terraform tofu terragrunt auto"`         // "tofu", "terraform", "terragrunt" or "auto" (default: tool in platform.yaml, else auto)
+	EnvVars            map[string]string `json:"env_vars,omitempty" binding:"omitempty,dive,keys,env_var_name,endkeys"` // Environment variables
+	TfvarsFiles        []string          `json:"tfvars_files,omitempty" binding:"omitempty,dive,relpath"`               // List of .tfvars files to use (default: var_files in platform.yaml)
+	InitFlags          string            `json:"init_flags,omitempty"`                                                  // Additional flags for init command
+	PlanFlags          string            `json:"plan_flags,omitempty"`                                                  // Additional flags for plan command
+	TerraformWorkspace string            `json:"terraform_workspace,omitempty"`                                         // CLI workspace (optional, defaults to deployment terraform_workspace)
+	Destroy            bool              `json:"destroy,omitempty"`                                                     // Plan and apply a destroy instead of changes
+	Inputs             []RunInput        `json:"inputs,omitempty"`                                                      // Outputs of other deployments passed in as TF_VAR_ variables
+}
+
+// RunInput declares that a run consumes an output of another deployment
+type RunInput struct {
+	DeploymentID string `json:"deployment_id"`      // Deployment that produces the output
+	Path         string `json:"path,omitempty"`     // Only use runs of this path (default: any path)
+	Output       string `json:"output"`             // Output name
+	Variable     string `json:"variable,omitempty"` // Variable the value is passed as (default: the output name)
+}
+
+// DeploymentRunInput is an output a run consumes, resolved to the run that produced it.
+// Values are never returned; they are read from the producing run when the run starts.
+type DeploymentRunInput struct {
+	Variable             string    `json:"variable"`
+	SourceDeploymentID   string    `json:"source_deployment_id"`
+	SourceDeploymentName string    `json:"source_deployment_name,omitempty"`
+	SourceRunID          string    `json:"source_run_id"`
+	SourcePath           string    `json:"source_path"`
+	Output               string    `json:"output"`
+	Sensitive            bool      `json:"sensitive"`
+	CreatedAt            time.Time `json:"created_at"`
+}
+
+// RunManifest is a snapshot of every effective input of a run, recorded when it starts so
+// the run can be reproduced after the deployment's settings changed. Env var values are
+// stored encrypted beside the manifest; only their names are listed.
+type RunManifest struct {
+	RunID               string             `json:"run_id"`
+	RecordedAt          time.Time          `json:"recorded_at"`
+	ReproducesRunID     string             `json:"reproduces_run_id,omitempty"` // Run whose manifest this run replayed
+	GitURL              string             `json:"git_url"`
+	Ref                 string             `json:"ref"`
+	CommitSHA           string             `json:"commit_sha,omitempty"` // Pinned commit, or the one checked out once cloned
+	Path                string             `json:"path"`
+	Workspace           string             `json:"workspace,omitempty"`
+	Operation           string             `json:"operation"`
+	Tool                string             `json:"tool"`                   // As resolved by the runner
+	ToolVersion         string             `json:"tool_version,omitempty"` // As resolved by the runner
+	Terragrunt          *TerragruntOptions `json:"terragrunt,omitempty"`
+	Image               string             `json:"image,omitempty"`
+	InitFlags           string             `json:"init_flags,omitempty"`
+	PlanFlags           string             `json:"plan_flags,omitempty"`
+	TfvarsFiles         []string           `json:"tfvars_files"`
+	TfvarsSHA256        map[string]string  `json:"tfvars_sha256,omitempty"`   // Reported by the runner after the clone
+	EnvVars             []string           `json:"env_vars"`                  // Names of the run's env vars, including inputs
+	EnvVarSources       map[string]string  `json:"env_var_sources,omitempty"` // Where each env var came from: platform, namespace, run or input
+	Inputs              []RunManifestInput `json:"inputs,omitempty"`
+	PreHooks            []RunHook          `json:"pre_hooks,omitempty"`
+	PostHooks           []RunHook          `json:"post_hooks,omitempty"`
+	Validate            bool               `json:"validate,omitempty"`
+	PolicyChecks        []RunHook          `json:"policy_checks,omitempty"`
+	Clone               CloneOptions       `json:"clone"`
+	PlanValidityMinutes int                `json:"plan_validity_minutes"`
+	AutoApprove         bool               `json:"auto_approve"`
+	PlatformConfig      bool               `json:"platform_config"` // Whether the repository's platform.yaml contributed settings
+	RunnerURL           string             `json:"runner_url"`
+	Runner              string             `json:"runner,omitempty"` // Hostname the runner reported
+}
+
+// RunManifestInput is an input of a run as resolved when it started
+type RunManifestInput struct {
+	Variable    string `json:"variable"`
+	SourceRunID string `json:"source_run_id"`
+	Output      string `json:"output"`
+}
+
+// DeploymentDependency is an edge of the deployment graph: outputs of one deployment
+// consumed by runs of another
+type DeploymentDependency struct {
+	DeploymentID string    `json:"deployment_id"`
+	Name         string    `json:"name"`
+	Namespace    string    `json:"namespace"`
+	Outputs      []string  `json:"outputs"`
+	LastRunID    string    `json:"last_run_id"` // Most recent consuming run
+	LastUsedAt   time.Time `json:"last_used_at"`
+}
+
+// DeploymentDependencies lists the deployments a deployment consumes outputs from and
+// the deployments that consume its outputs
+type DeploymentDependencies struct {
+	Upstream   []DeploymentDependency `json:"upstream"`
+	Downstream []DeploymentDependency `json:"downstream"`
+}
+
+// DeploymentOutputs are the outputs of a deployment path as of its latest successful
+// apply. Sensitive values are left out; only their names are listed.
+type DeploymentOutputs struct {
+	Path             string                     `json:"path"`
+	RunID            string                     `json:"run_id"`
+	CommitSHA        *string                    `json:"commit_sha,omitempty"`
+	AppliedAt        time.Time                  `json:"applied_at"`
+	Outputs          map[string]json.RawMessage `json:"outputs"`
+	SensitiveOutputs []string                   `json:"sensitive_outputs"`
+}
+
+// ImportRequest lists existing infrastructure objects to import into a run's state
+type ImportRequest struct {
+	Imports []ImportPair `json:"imports" binding:"required"`
+}
+
+// ImportPair maps a resource address to the ID of an existing infrastructure object
+type ImportPair struct {
+	Address string `json:"address"`
+	ID      string `json:"id"`
+}
+
+// StateMoveRequest is used for moving a resource within a run's state
+type StateMoveRequest struct {
+	Source      string `json:"source" binding:"required"`
+	Destination string `json:"destination" binding:"required"`
+}
+
+// StateRemoveRequest is used for removing resources from a run's state
+type StateRemoveRequest struct {
+	Addresses []string `json:"addresses" binding:"required"`
+}
+
+// StateLock is a state lock as reported by terraform when it could not acquire it
+type StateLock struct {
+	ID        string `json:"id"`
+	Path      string `json:"path,omitempty"`
+	Operation string `json:"operation,omitempty"` // e.g. "OperationTypeApply"
+	Who       string `json:"who,omitempty"`       // Holder, as user@host
+	Version   string `json:"version,omitempty"`
+	Created   string `json:"created,omitempty"`
+}
+
+// CommandExit is how the command that failed a run ended, as the runner reported it
+type CommandExit struct {
+	Command  string `json:"command"`             // e.g. "terraform plan", "hook lint", "git fetch"
+	Reason   string `json:"reason"`              // "exit", "signal", "timeout", "oom_killed" or "start_failed"
+	ExitCode *int   `json:"exit_code,omitempty"` // Exit status, when the process exited
+	Signal   string `json:"signal,omitempty"`    // Signal that killed the process, e.g. "SIGKILL"
+	Message  string `json:"message,omitempty"`
+}
+
+// RunLogs are the logs of a run in one format (GET .../runs/:runId/logs)
+type RunLogs struct {
+	Format   string `json:"format"` // "raw", "plain" or "html"
+	InitLog  string `json:"init_log"`
+	PlanLog  string `json:"plan_log"`
+	ApplyLog string `json:"apply_log"`
+	HookLog  string `json:"hook_log"`
+}
+
+// ForceUnlockRequest is used for releasing the state lock a run failed on; the lock ID
+// must match the one the run reported
+type ForceUnlockRequest struct {
+	LockID string `json:"lock_id" binding:"required"`
+}
+
+// OperationResult records what a state operation ran and the state it changed
+type OperationResult struct {
+	Command     string        `json:"command"`
+	StateBefore *StateVersion `json:"state_before,omitempty"`
+	StateAfter  *StateVersion `json:"state_after,omitempty"`
+}
+
+// StateVersion identifies a version of a Terraform state
+type StateVersion struct {
+	Serial  int64  `json:"serial"`
+	Lineage string `json:"lineage"`
 }
 
 // DeploymentRunApproval is used for approving/rejecting a plan
 type DeploymentRunApproval struct {
-	Approved   bool   `json:"approved"`
-	ApprovedBy string `json:"approved_by,omitempty"`
+	Approved       bool       `json:"approved"`
+	Comment        string     `json:"comment,omitempty"`          // Required when APPROVAL_REQUIRE_COMMENT is set
+	ChangeTicket   string     `json:"change_ticket,omitempty"`    // Change-management ticket ID, required when APPROVAL_REQUIRE_CHANGE_TICKET is set
+	ApplyNotBefore *time.Time `json:"apply_not_before,omitempty"` // Schedule the apply; must fall before the plan expires
 }
 
 // DirectoryStatus represents the deployment status for a directory
@@ -105,3 +549,28 @@ type DirectoryStatus struct {
 	Status      string         `json:"status"`       // "none", "success", "running", "failed"
 	StatusColor string         `json:"status_color"` // "blue", "green", "yellow", "red"
 }
+
+// RepositoryChanges describes a push to a repository, identified by the commits before and after it
+type RepositoryChanges struct {
+	GitURL string `json:"git_url" binding:"required"`
+	Before string `json:"before" binding:"required"` // All zeros for a newly created branch
+	After  string `json:"after" binding:"required"`
+}
+
+// AffectedDeployment is a deployment whose paths intersect a change set
+type AffectedDeployment struct {
+	DeploymentID string   `json:"deployment_id"`
+	Name         string   `json:"name"`
+	Namespace    string   `json:"namespace"`
+	Paths        []string `json:"paths"`         // Run paths that contain changed files
+	MatchedFiles []string `json:"matched_files"` // Changed files under those paths or matching watch_paths
+}
+
+// ChangeSet is the result of matching a push against the deployments of a repository
+type ChangeSet struct {
+	Before       string               `json:"before"`
+	After        string               `json:"after"`
+	ChangedFiles []string             `json:"changed_files"`
+	AllChanged   bool                 `json:"all_changed"` // No base commit (new branch); every deployment is affected
+	Deployments  []AffectedDeployment `json:"deployments"`
+}
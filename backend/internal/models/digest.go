@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// DigestSubscription subscribes an email address to the activity digest of one
+// namespace, or of every namespace
+type DigestSubscription struct {
+	ID          string     `json:"id"`
+	Email       string     `json:"email"`
+	NamespaceID *string    `json:"namespace_id,omitempty"` // unset: every namespace
+	Frequency   string     `json:"frequency"`              // daily or weekly
+	LastSentAt  *time.Time `json:"last_sent_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// DigestSubscriptionCreate is used for subscribing to the digest
+type DigestSubscriptionCreate struct {
+	Email       string  `json:"email" binding:"required,email,max=255"`
+	NamespaceID *string `json:"namespace_id,omitempty"`
+	Frequency   string  `json:"frequency" binding:"required,oneof=daily weekly"`
+}
+
+// Digest summarizes the platform activity of a period, per namespace. Namespaces
+// without activity are left out.
+type Digest struct {
+	Since      time.Time         `json:"since"`
+	Until      time.Time         `json:"until"`
+	Namespaces []NamespaceDigest `json:"namespaces"`
+}
+
+// NamespaceDigest is the activity of one namespace
+type NamespaceDigest struct {
+	NamespaceID         string             `json:"namespace_id"`
+	Namespace           string             `json:"namespace"`
+	NewVersions         []DigestVersion    `json:"new_versions"`
+	FailedRuns          []DigestRun        `json:"failed_runs"`
+	ExpiringCredentials []DigestCredential `json:"expiring_credentials"`
+}
+
+// DigestVersion is a module or provider version added during the period
+type DigestVersion struct {
+	Kind      string    `json:"kind"` // module or provider
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Version   string    `json:"version"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DigestRun is a run that failed during the period
+type DigestRun struct {
+	RunID           string    `json:"run_id"`
+	DeploymentID    string    `json:"deployment_id"`
+	Deployment      string    `json:"deployment"`
+	Path            string    `json:"path"`
+	Operation       string    `json:"operation"`
+	FailureCategory *string   `json:"failure_category,omitempty"`
+	CompletedAt     time.Time `json:"completed_at"`
+}
+
+// DigestCredential is a stored git credential that is expiring or has expired
+type DigestCredential struct {
+	ResourceType string     `json:"resource_type"` // modules, providers or deployments
+	ResourceID   string     `json:"resource_id"`
+	Name         string     `json:"name"`
+	Status       string     `json:"status"` // expiring or expired
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// EnvDefaults are env vars every run of the platform, or of a namespace's deployments, is
+// given under its own env vars (e.g. TF_IN_AUTOMATION, proxy settings, TF_CLI_ARGS)
+type EnvDefaults struct {
+	Scope       string            `json:"scope"` // platform or namespace
+	NamespaceID string            `json:"namespace_id,omitempty"`
+	EnvVars     map[string]string `json:"env_vars"` // Values redacted in responses
+	UpdatedBy   *string           `json:"updated_by,omitempty"`
+	UpdatedAt   *time.Time        `json:"updated_at,omitempty"`
+}
+
+// EnvDefaultsUpdate replaces default env vars; a value of "********" keeps the current one
+type EnvDefaultsUpdate struct {
+	EnvVars map[string]string `json:"env_vars" binding:"max=100,dive,keys,env_var_name,endkeys"`
+}
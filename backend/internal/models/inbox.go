@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// InboxItem is something waiting for the caller: a run to approve or a git credential
+// to renew
+type InboxItem struct {
+	ID          string     `json:"id"`   // Stable across requests; used to mark the item read
+	Kind        string     `json:"kind"` // "run_approval" or "credential_expiration"
+	Title       string     `json:"title"`
+	TargetType  string     `json:"target_type"` // "run", or the credential's resource type (modules, providers, deployments)
+	TargetID    string     `json:"target_id"`
+	ParentID    *string    `json:"parent_id,omitempty"` // Deployment of a run
+	NamespaceID string     `json:"namespace_id"`
+	Namespace   string     `json:"namespace"`
+	DueAt       *time.Time `json:"due_at,omitempty"` // Approval deadline or credential expiry
+	Read        bool       `json:"read"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Inbox lists the caller's items, newest first
+type Inbox struct {
+	Items  []InboxItem `json:"items"`
+	Unread int         `json:"unread"`
+}
+
+// InboxReadRequest marks inbox items read, or unread again
+type InboxReadRequest struct {
+	IDs  []string `json:"ids" binding:"required,min=1,max=500,dive,max=512"`
+	Read *bool    `json:"read,omitempty"` // Default true
+}
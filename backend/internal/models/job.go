@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// BackgroundJob is the state of a background worker as reported to operators
+type BackgroundJob struct {
+	Name                string     `json:"name"`
+	Description         string     `json:"description"`
+	Trigger             string     `json:"trigger"`                    // "interval" (one instance per interval), "tick" (every instance, every scheduler tick) or "event"
+	IntervalSeconds     int        `json:"interval_seconds,omitempty"` // How often it is due; 0 for event-driven work
+	Status              string     `json:"status"`                     // ok, running, failing, overdue, paused, disabled or idle
+	LastRunAt           *time.Time `json:"last_run_at,omitempty"`      // When the last run started
+	LastFinishedAt      *time.Time `json:"last_finished_at,omitempty"`
+	LastDurationMs      *int64     `json:"last_duration_ms,omitempty"`
+	Processed           *int       `json:"processed,omitempty"` // Items the last run processed
+	LastError           *string    `json:"last_error,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Instance            *string    `json:"instance,omitempty"` // Backend instance of the last run
+}
+
+// Schedule is timed work: a periodic scheduler job, or the auto-destroy of a deployment
+type Schedule struct {
+	ID              string     `json:"id"`   // Job name, or auto_destroy:<deployment id>
+	Kind            string     `json:"kind"` // "job" or "auto_destroy"
+	Description     string     `json:"description"`
+	Status          string     `json:"status"`                     // As in BackgroundJob or AutoDestroySchedule
+	IntervalSeconds int        `json:"interval_seconds,omitempty"` // Jobs only
+	LastRun         *time.Time `json:"last_run,omitempty"`
+	NextRun         *time.Time `json:"next_run,omitempty"` // Unset when nothing is due (disabled, paused, idle or exhausted)
+}
+
+// ScheduleOccurrences are the next times a schedule is due, in the requested timezone
+type ScheduleOccurrences struct {
+	ID          string      `json:"id"`
+	Timezone    string      `json:"timezone"`
+	Occurrences []time.Time `json:"occurrences"`
+}
+
+// AutoDestroySchedule is when the scheduler last destroyed, and will next destroy, a
+// deployment with auto_destroy_after
+type AutoDestroySchedule struct {
+	DeploymentID     string     `json:"deployment_id"`
+	Deployment       string     `json:"deployment"`
+	AutoDestroyAfter string     `json:"auto_destroy_after"`
+	Status           string     `json:"status"`                  // idle (nothing applied), waiting, notified, retrying or exhausted
+	LastApplyAt      *time.Time `json:"last_apply_at,omitempty"` // Most recent successful apply of a path still applied
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`    // LastApplyAt plus auto_destroy_after
+	LastRun          *time.Time `json:"last_run,omitempty"`      // Last auto-destroy attempt
+	NextRun          *time.Time `json:"next_run,omitempty"`      // When the next destroy is due (started on the following scheduler tick)
+	Attempts         int        `json:"attempts"`                // Attempts for the current expiry
+}
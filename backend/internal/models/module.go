@@ -4,42 +4,68 @@ import "time"
 
 // Module represents a Terraform module in the registry
 type Module struct {
-	ID          string    `json:"id"`
-	NamespaceID string    `json:"namespace_id"`
-	Name        string    `json:"name"`
-	Provider    string    `json:"provider"` // e.g., "aws", "azure", "gcp"
-	Description *string   `json:"description,omitempty"`
-	SourceURL   *string   `json:"source_url,omitempty"` // Optional source repository
-	Synced      bool      `json:"synced"`
-	SyncError   *string   `json:"sync_error,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID               string    `json:"id"`
+	NamespaceID      string    `json:"namespace_id"`
+	Name             string    `json:"name"`
+	Provider         string    `json:"provider"` // e.g., "aws", "azure", "gcp"
+	Description      *string   `json:"description,omitempty"`
+	SourceURL        *string   `json:"source_url,omitempty"` // Optional source repository
+	Synced           bool      `json:"synced"`
+	SyncError        *string   `json:"sync_error,omitempty"`
+	CredentialStatus *string   `json:"credential_status,omitempty"` // valid, expiring, expired, invalid (private repos only)
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// VersionAutoEnableRule decides which versions found by a sync of a module or provider
+// are enabled right away; the others arrive disabled
+type VersionAutoEnableRule struct {
+	Constraint         string `json:"constraint" binding:"required,max=255"` // e.g. ">= 1.0.0"
+	IncludePrereleases bool   `json:"include_prereleases"`                   // Pre-releases are matched by their release version
+}
+
+// VersionDeprecation marks a module or provider version as deprecated. Deprecated
+// versions stay installable; consumers are told to move to Replacement.
+type VersionDeprecation struct {
+	Reason       string    `json:"reason" binding:"required,max=1000"`
+	Replacement  string    `json:"replacement,omitempty"` // version to upgrade to
+	DeprecatedAt time.Time `json:"deprecated_at"`
 }
 
 // ModuleVersion represents a version of a module
 type ModuleVersion struct {
-	ID            string     `json:"id"`
-	ModuleID      string     `json:"module_id"`
-	Version       string     `json:"version"`
-	DownloadURL   string     `json:"download_url"`
-	Documentation *string    `json:"documentation,omitempty"`
-	Enabled       bool       `json:"enabled"`
-	TagDate       *time.Time `json:"tag_date,omitempty"`
-	CreatedAt     time.Time  `json:"created_at"`
+	ID            string              `json:"id"`
+	ModuleID      string              `json:"module_id"`
+	Version       string              `json:"version"`
+	DownloadURL   string              `json:"download_url"`
+	Documentation *string             `json:"documentation,omitempty"`
+	Enabled       bool                `json:"enabled"`
+	TagDate       *time.Time          `json:"tag_date,omitempty"`
+	TagMessage    *string             `json:"tag_message,omitempty"` // Annotated tag message
+	Changelog     *string             `json:"changelog,omitempty"`   // CHANGELOG.md section of the version
+	Deprecation   *VersionDeprecation `json:"deprecation,omitempty"`
+	CreatedAt     time.Time           `json:"created_at"`
+}
+
+// ModuleExample is the main.tf of a directory below a module version's examples/ directory
+type ModuleExample struct {
+	Name    string `json:"name"` // Directory relative to examples/, e.g. "complete"
+	Path    string `json:"path"` // Path of the file in the repository
+	Content string `json:"content"`
 }
 
 // ModuleCreate is used for creating a new module
 type ModuleCreate struct {
-	Name        string  `json:"name" binding:"required"`
-	Provider    string  `json:"provider" binding:"required"`
+	Name        string  `json:"name" binding:"required,tf_module_name"`
+	Provider    string  `json:"provider" binding:"required,tf_module_provider"`
 	Description *string `json:"description,omitempty"`
 	SourceURL   *string `json:"source_url,omitempty"`
 }
 
 // ModuleUpdate is used for updating a module
 type ModuleUpdate struct {
-	Name        *string `json:"name,omitempty"`
-	Provider    *string `json:"provider,omitempty"`
+	Name        *string `json:"name,omitempty" binding:"omitempty,tf_module_name"`
+	Provider    *string `json:"provider,omitempty" binding:"omitempty,tf_module_provider"`
 	Description *string `json:"description,omitempty"`
 	SourceURL   *string `json:"source_url,omitempty"`
 }
@@ -61,7 +87,59 @@ type ModuleVersionUpload struct {
 // ModuleWithNamespace includes namespace information
 type ModuleWithNamespace struct {
 	Module
-	Namespace string `json:"namespace"`
+	Namespace   string             `json:"namespace"`
+	Maintainers *NamespaceContacts `json:"maintainers,omitempty"`
+	Aliases     []ModuleAlias      `json:"aliases,omitempty"` // Previous addresses the registry still serves it under
+}
+
+// ModuleAlias is another address the registry protocol serves a module under, typically
+// its address before a rename or transfer, until ExpiresAt
+type ModuleAlias struct {
+	ID        string     `json:"id"`
+	ModuleID  string     `json:"module_id"`
+	Namespace string     `json:"namespace"`
+	Name      string     `json:"name"`
+	Provider  string     `json:"provider"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Never expires when nil
+	Active    bool       `json:"active"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// ModuleAliasCreate is used for adding an alias to a module, or changing the expiry of one
+type ModuleAliasCreate struct {
+	Namespace string     `json:"namespace" binding:"required,tf_namespace"`
+	Name      string     `json:"name" binding:"required,tf_module_name"`
+	Provider  string     `json:"provider" binding:"required,tf_module_provider"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// ModuleUpgradeReport lists the consumers of a module that are behind its newest
+// enabled version, for driving upgrade campaigns
+type ModuleUpgradeReport struct {
+	ModuleID      string                `json:"module_id"`
+	LatestVersion string                `json:"latest_version"`
+	ActiveDays    int                   `json:"active_days"`
+	UpToDate      int                   `json:"up_to_date"` // active consumers already on the latest version
+	Outdated      []ModuleConsumerDrift `json:"outdated"`
+}
+
+// ModuleConsumerDrift is a consumer on an outdated version and where it can upgrade to.
+// Consumers are API keys, deployments (run tokens) or client IPs.
+type ModuleConsumerDrift struct {
+	Consumer         string               `json:"consumer"`
+	Name             string               `json:"name,omitempty"` // API key or deployment name
+	CurrentVersion   string               `json:"current_version"`
+	LastDownloadedAt time.Time            `json:"last_downloaded_at"`
+	Upgrade          string               `json:"upgrade"`                     // "major", "minor", "patch" or "prerelease" to reach the latest version
+	LatestCompatible *ModuleUpgradeTarget `json:"latest_compatible,omitempty"` // newest version of the same major (minor for 0.x); nil when already on it
+	Latest           ModuleUpgradeTarget  `json:"latest"`
+}
+
+// ModuleUpgradeTarget is a version to upgrade to and where to read what changed
+type ModuleUpgradeTarget struct {
+	Version      string `json:"version"`
+	HasChangelog bool   `json:"has_changelog"`           // the version's CHANGELOG.md section was captured (see the versions endpoint)
+	ChangelogURL string `json:"changelog_url,omitempty"` // CHANGELOG.md at the version's tag, for GitHub and GitLab repositories
 }
 
 // Terraform Protocol DTOs
@@ -76,5 +154,6 @@ type ModuleVersionsDTO struct {
 }
 
 type ModuleVersionDTO struct {
-	Version string `json:"version"`
+	Version     string              `json:"version"`
+	Deprecation *VersionDeprecation `json:"deprecation,omitempty"` // with REGISTRY_EXTENDED_VERSIONS
 }
@@ -4,26 +4,57 @@ import "time"
 
 // Namespace (Authority) represents an organization/user that owns modules and providers
 type Namespace struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	Description *string   `json:"description,omitempty"`
-	IsPublic    bool      `json:"is_public"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID             string  `json:"id"`
+	Name           string  `json:"name"`
+	Description    *string `json:"description,omitempty"`
+	IsPublic       bool    `json:"is_public"`
+	OrganizationID *string `json:"organization_id,omitempty"` // Organization whose settings and quotas apply
+	NamespaceContacts
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NamespaceContacts tells consumers who maintains the content of a namespace
+type NamespaceContacts struct {
+	OwnerEmails    []string        `json:"owner_emails"`
+	SupportContact *string         `json:"support_contact,omitempty"` // Email, chat channel or URL
+	Links          []NamespaceLink `json:"links"`                     // Team pages, runbooks, chat channels
+	LogoURL        *string         `json:"logo_url,omitempty"`
+}
+
+// NamespaceLink is a titled link shown with a namespace
+type NamespaceLink struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
 }
 
 // NamespaceCreate is used for creating a new namespace
 type NamespaceCreate struct {
-	Name        string  `json:"name" binding:"required"`
-	Description *string `json:"description,omitempty"`
-	IsPublic    bool    `json:"is_public"`
+	Name           string          `json:"name" binding:"required,tf_namespace"`
+	Description    *string         `json:"description,omitempty"`
+	IsPublic       bool            `json:"is_public"`
+	OwnerEmails    []string        `json:"owner_emails,omitempty"`
+	SupportContact *string         `json:"support_contact,omitempty"`
+	Links          []NamespaceLink `json:"links,omitempty"`
+	LogoURL        *string         `json:"logo_url,omitempty"`
+	OrganizationID *string         `json:"organization_id,omitempty"`
 }
 
 // NamespaceUpdate is used for updating a namespace
 type NamespaceUpdate struct {
-	Name        *string `json:"name,omitempty"`
-	Description *string `json:"description,omitempty"`
-	IsPublic    *bool   `json:"is_public,omitempty"`
+	Name           *string          `json:"name,omitempty" binding:"omitempty,tf_namespace"`
+	Description    *string          `json:"description,omitempty"`
+	IsPublic       *bool            `json:"is_public,omitempty"`
+	OwnerEmails    *[]string        `json:"owner_emails,omitempty"`
+	SupportContact *string          `json:"support_contact,omitempty"` // Empty string clears
+	Links          *[]NamespaceLink `json:"links,omitempty"`
+	LogoURL        *string          `json:"logo_url,omitempty"`        // Empty string clears
+	OrganizationID *string          `json:"organization_id,omitempty"` // Empty string removes the namespace from its organization
+}
+
+// TransferRequest is used for moving a module or provider to another namespace
+type TransferRequest struct {
+	NamespaceID string `json:"namespace_id" binding:"required"`
 }
 
 // APIKey represents an API key for authenticating with the registry
@@ -32,7 +63,7 @@ type APIKey struct {
 	Name        string     `json:"name"`
 	Key         string     `json:"key,omitempty"` // Only shown on creation
 	KeyHash     string     `json:"-"`             // Stored in DB
-	Permissions string     `json:"permissions"`   // "read", "write", "admin"
+	Permissions string     `json:"permissions"`   // "read", "write", "approver", "admin"
 	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
 	CreatedAt   time.Time  `json:"created_at"`
 	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
@@ -41,7 +72,7 @@ type APIKey struct {
 // APIKeyCreate is used for creating a new API key
 type APIKeyCreate struct {
 	Name        string     `json:"name" binding:"required"`
-	Permissions string     `json:"permissions" binding:"required"`
+	Permissions string     `json:"permissions" binding:"required,oneof=read write approver admin"`
 	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
 }
 
@@ -51,3 +82,33 @@ type NamespaceWithStats struct {
 	ModuleCount   int `json:"module_count"`
 	ProviderCount int `json:"provider_count"`
 }
+
+// NamespaceStorage is the provider file storage a namespace uses and may use
+type NamespaceStorage struct {
+	NamespaceID string `json:"namespace_id"`
+	UsedBytes   int64  `json:"used_bytes"`
+	QuotaBytes  int64  `json:"quota_bytes"`            // 0: unlimited
+	QuotaSource string `json:"quota_source,omitempty"` // namespace or default (NAMESPACE_STORAGE_QUOTA)
+}
+
+// NamespaceStorageQuota sets a namespace's storage quota; null falls back to the default
+type NamespaceStorageQuota struct {
+	QuotaBytes *int64 `json:"quota_bytes" binding:"omitempty,min=0"` // 0: unlimited
+}
+
+// NamespaceRunners binds the runs of a namespace's deployments to runners: a runner of the
+// pool is eligible when it is listed or has all the labels (RUNNER_LABELS). Without
+// either, runs use the whole pool.
+type NamespaceRunners struct {
+	Runners []string `json:"runners" binding:"max=50,dive,required,max=500"` // Runner base URLs
+	Labels  []string `json:"labels" binding:"max=20,dive,required,max=100"`
+}
+
+// NamespaceRunnerAssignment is the runner binding of a namespace with the runners it
+// currently allows
+type NamespaceRunnerAssignment struct {
+	NamespaceID string `json:"namespace_id"`
+	NamespaceRunners
+	Restricted bool     `json:"restricted"` // false: any runner of the pool
+	Eligible   []string `json:"eligible"`   // Runners of the pool runs may execute on
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Organization groups namespaces, e.g. of one business unit, under shared settings
+type Organization struct {
+	ID                        string             `json:"id"`
+	Name                      string             `json:"name"`
+	Description               *string            `json:"description,omitempty"`
+	DefaultDeploymentSettings DeploymentSettings `json:"default_deployment_settings"` // Used by new deployments that do not set them
+	VCSConnections            []VCSConnection    `json:"vcs_connections"`             // Git credentials new deployments use for their host
+	Quotas                    OrganizationQuotas `json:"quotas"`
+	Usage                     OrganizationUsage  `json:"usage"`
+	CreatedAt                 time.Time          `json:"created_at"`
+	UpdatedAt                 time.Time          `json:"updated_at"`
+}
+
+// VCSConnection is a git credential shared by the deployments of an organization
+type VCSConnection struct {
+	Host     string `json:"host" binding:"required"` // e.g., "github.com"
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password,omitempty"` // Write-only; kept when omitted on update
+}
+
+// OrganizationQuotas limits what an organization may use; 0 is unlimited
+type OrganizationQuotas struct {
+	MaxNamespaces     int `json:"max_namespaces,omitempty" binding:"min=0"`
+	MaxDeployments    int `json:"max_deployments,omitempty" binding:"min=0"`
+	MaxConcurrentRuns int `json:"max_concurrent_runs,omitempty" binding:"min=0"` // Unfinished runs across all deployments
+}
+
+// OrganizationUsage is what an organization currently uses of its quotas
+type OrganizationUsage struct {
+	Namespaces  int `json:"namespaces"`
+	Deployments int `json:"deployments"`
+	ActiveRuns  int `json:"active_runs"`
+}
+
+// OrganizationCreate is used for creating an organization
+type OrganizationCreate struct {
+	Name                      string             `json:"name" binding:"required"`
+	Description               *string            `json:"description,omitempty"`
+	DefaultDeploymentSettings DeploymentSettings `json:"default_deployment_settings"`
+	VCSConnections            []VCSConnection    `json:"vcs_connections,omitempty" binding:"dive"`
+	Quotas                    OrganizationQuotas `json:"quotas"`
+}
+
+// OrganizationUpdate is used for updating an organization; lists and settings are
+// replaced as a whole
+type OrganizationUpdate struct {
+	Name                      *string             `json:"name,omitempty"`
+	Description               *string             `json:"description,omitempty"`
+	DefaultDeploymentSettings *DeploymentSettings `json:"default_deployment_settings,omitempty"`
+	VCSConnections            *[]VCSConnection    `json:"vcs_connections,omitempty" binding:"omitempty,dive"`
+	Quotas                    *OrganizationQuotas `json:"quotas,omitempty"`
+}
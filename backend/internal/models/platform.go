@@ -0,0 +1,21 @@
+package models
+
+// PlatformConfig is the platform.yaml a deployment's repository may carry at its root,
+// so repository owners manage run settings through git. Runs read it at their ref.
+type PlatformConfig struct {
+	Tool        string              `json:"tool,omitempty" yaml:"tool"`                 // Tool of runs that do not name one
+	ToolVersion string              `json:"tool_version,omitempty" yaml:"tool_version"` // Exact terraform/tofu version runs use (default: chosen by the runner)
+	RunnerImage string              `json:"runner_image,omitempty" yaml:"runner_image"` // Image runs execute in, pinning the tool versions
+	Workspaces  []string            `json:"workspaces,omitempty" yaml:"workspaces"`     // Workspaces runs may use; the first is the default
+	VarFiles    []string            `json:"var_files,omitempty" yaml:"var_files"`       // .tfvars files of runs that list none
+	Hooks       DeploymentHooks     `json:"hooks" yaml:"hooks"`                         // Run after the deployment's own hooks
+	Apply       PlatformApplyPolicy `json:"apply" yaml:"apply"`
+}
+
+// PlatformApplyPolicy is how plans of a repository get applied
+type PlatformApplyPolicy struct {
+	AutoApprove  bool      `json:"auto_approve" yaml:"auto_approve"`             // Apply without approval; destroys still need it
+	PlanValidity string    `json:"plan_validity,omitempty" yaml:"plan_validity"` // How long a plan may await approval (e.g., "24h")
+	Validate     bool      `json:"validate" yaml:"validate"`                     // Run terraform validate before planning
+	PolicyChecks []RunHook `json:"policy_checks" yaml:"policy_checks"`           // Run after the deployment's own policy checks
+}
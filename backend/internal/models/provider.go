@@ -1,29 +1,58 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Provider represents a Terraform provider in the registry
 type Provider struct {
-	ID          string    `json:"id"`
-	NamespaceID string    `json:"namespace_id"`
-	Name        string    `json:"name"`
-	Description *string   `json:"description,omitempty"`
-	SourceURL   *string   `json:"source_url,omitempty"`
-	Synced      bool      `json:"synced"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID               string            `json:"id"`
+	NamespaceID      string            `json:"namespace_id"`
+	Name             string            `json:"name"`
+	Description      *string           `json:"description,omitempty"`
+	SourceURL        *string           `json:"source_url,omitempty"`
+	Synced           bool              `json:"synced"`
+	CredentialStatus *string           `json:"credential_status,omitempty"` // valid, expiring, expired, invalid (private repos only)
+	Channels         map[string]string `json:"channels,omitempty"`          // channel name -> version
+	CreatedAt        time.Time         `json:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at"`
+	ProviderCatalog
+}
+
+// ProviderCatalog is what catalog cards show about a provider, captured from its
+// repository when it syncs
+type ProviderCatalog struct {
+	Abstract              *string    `json:"abstract,omitempty"`               // First paragraph of the README
+	RepositoryDescription *string    `json:"repository_description,omitempty"` // From the git host
+	Topics                []string   `json:"topics"`                           // From the git host
+	CatalogSyncedAt       *time.Time `json:"catalog_synced_at,omitempty"`
 }
 
 // ProviderVersion represents a version of a provider
 type ProviderVersion struct {
-	ID         string             `json:"id"`
-	ProviderID string             `json:"provider_id"`
-	Version    string             `json:"version"`
-	Protocols  []string           `json:"protocols"`
-	Enabled    bool               `json:"enabled"`
-	Platforms  []ProviderPlatform `json:"platforms,omitempty"`
-	TagDate    *time.Time         `json:"tag_date,omitempty"`
-	CreatedAt  time.Time          `json:"created_at"`
+	ID          string                `json:"id"`
+	ProviderID  string                `json:"provider_id"`
+	Version     string                `json:"version"`
+	Protocols   []string              `json:"protocols"`
+	Enabled     bool                  `json:"enabled"`
+	Platforms   []ProviderPlatform    `json:"platforms,omitempty"`
+	Channels    []string              `json:"channels,omitempty"`
+	TagDate     *time.Time            `json:"tag_date,omitempty"`
+	TagMessage  *string               `json:"tag_message,omitempty"` // Annotated tag message
+	Changelog   *string               `json:"changelog,omitempty"`   // CHANGELOG.md section of the version
+	Stats       *ProviderVersionStats `json:"stats,omitempty"`       // with ?include=stats
+	Deprecation *VersionDeprecation   `json:"deprecation,omitempty"`
+	CreatedAt   time.Time             `json:"created_at"`
+}
+
+// ProviderVersionStats summarizes the downloads of a provider version through the
+// registry protocol. Consumers are API keys, deployments (run tokens) or client IPs.
+type ProviderVersionStats struct {
+	Downloads        int        `json:"downloads"`
+	Consumers        int        `json:"consumers"`
+	ActiveConsumers  int        `json:"active_consumers"` // consumers that downloaded it within the active window
+	LastDownloadedAt *time.Time `json:"last_downloaded_at,omitempty"`
 }
 
 // ProviderPlatform represents a platform-specific binary for a provider version
@@ -40,9 +69,105 @@ type ProviderPlatform struct {
 	SigningKeys      string `json:"signing_keys,omitempty"`
 }
 
+// ProviderChannel is a named alias (e.g., latest, stable, beta) pointing at a concrete
+// provider version. "latest" follows the newest enabled version unless it is pinned.
+type ProviderChannel struct {
+	Name      string     `json:"name"`
+	VersionID string     `json:"version_id"`
+	Version   string     `json:"version"`
+	Automatic bool       `json:"automatic"` // true for the implicit "latest" channel
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// ProviderChannelSet is used for pointing a channel at a version
+type ProviderChannelSet struct {
+	Version string `json:"version" binding:"required"`
+}
+
+// ProviderBuild represents a compilation of a provider version from its Git source
+type ProviderBuild struct {
+	ID         string                  `json:"id"`
+	ProviderID string                  `json:"provider_id"`
+	VersionID  string                  `json:"version_id"`
+	Version    string                  `json:"version"`
+	Status     string                  `json:"status"` // pending, running, success, partial, failed
+	Platforms  []ProviderBuildPlatform `json:"platforms"`
+	Log        *string                 `json:"log,omitempty"`        // clone/setup output shared by all platforms
+	GoVersion  *string                 `json:"go_version,omitempty"` // Go toolchain requested, then the exact one used (e.g., "go1.22.5")
+	Error      *string                 `json:"error,omitempty"`
+	StartedAt  *time.Time              `json:"started_at,omitempty"`
+	FinishedAt *time.Time              `json:"finished_at,omitempty"`
+	CreatedAt  time.Time               `json:"created_at"`
+}
+
+// ProviderBuildPlatform is the outcome of building one OS/arch target
+type ProviderBuildPlatform struct {
+	OS              string  `json:"os"`
+	Arch            string  `json:"arch"`
+	Status          string  `json:"status"` // pending, running, success, failed
+	Log             string  `json:"log,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Filename        string  `json:"filename,omitempty"`
+	SHASum          string  `json:"shasum,omitempty"`
+	GoVersion       string  `json:"go_version,omitempty"` // Toolchain that compiled the artifact
+	Error           string  `json:"error,omitempty"`
+	// SLSA provenance of the artifact (in-toto statement: source commit, toolchain, command,
+	// builder and timestamps) and its base64 detached GPG signature, if signing is enabled
+	Provenance          json.RawMessage `json:"provenance,omitempty"`
+	ProvenanceSignature string          `json:"provenance_signature,omitempty"`
+}
+
+// ProviderBuildCreate is used for starting a build or retrying some of its platforms
+type ProviderBuildCreate struct {
+	Platforms []ProviderPlatformDTO `json:"platforms,omitempty"`
+	GoVersion string                `json:"go_version,omitempty" binding:"max=32"` // Go toolchain (e.g., "1.22.5"); default: the provider's, else the image's
+}
+
+// ProviderBuildToolchain is the Go toolchain a provider's builds use unless a build asks
+// for another
+type ProviderBuildToolchain struct {
+	GoVersion string `json:"go_version" binding:"required,max=32"`
+}
+
+// ProviderReleaseImport is used for importing a version's platforms from its GitHub release
+type ProviderReleaseImport struct {
+	Tag          string                `json:"tag,omitempty" binding:"max=255"` // Release tag (default: v<version>)
+	Platforms    []ProviderPlatformDTO `json:"platforms,omitempty"`             // Platforms to import (default: all in the release)
+	GPGPublicKey string                `json:"gpg_public_key,omitempty"`        // Publisher's key to verify SHA256SUMS.sig with (required)
+}
+
+// ProviderMirror copies the versions of an upstream provider matching a constraint into
+// a local provider on a schedule
+type ProviderMirror struct {
+	ID                string     `json:"id"`
+	ProviderID        string     `json:"provider_id"`
+	Namespace         string     `json:"namespace"`
+	Name              string     `json:"name"`
+	UpstreamSource    string     `json:"upstream_source"`    // e.g. registry.terraform.io/hashicorp/aws
+	VersionConstraint string     `json:"version_constraint"` // e.g. ">= 5.0, < 6.0"
+	VersionCount      int        `json:"version_count"`
+	LastSyncedAt      *time.Time `json:"last_synced_at,omitempty"`
+	LastError         *string    `json:"last_error,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// ProviderMirrorCreate is used for mirroring an upstream provider into a namespace
+type ProviderMirrorCreate struct {
+	NamespaceID       string  `json:"namespace_id" binding:"required"`
+	Name              string  `json:"name,omitempty" binding:"omitempty,tf_provider_name"` // Local name (default: the upstream name)
+	UpstreamSource    string  `json:"upstream_source" binding:"required,max=500"`
+	VersionConstraint string  `json:"version_constraint" binding:"required,max=255"`
+	Description       *string `json:"description,omitempty"`
+}
+
+// ProviderMirrorUpdate is used for changing which upstream versions are mirrored
+type ProviderMirrorUpdate struct {
+	VersionConstraint string `json:"version_constraint" binding:"required,max=255"`
+}
+
 // ProviderCreate is used for creating a new provider
 type ProviderCreate struct {
-	Name        string  `json:"name" binding:"required"`
+	Name        string  `json:"name" binding:"required,tf_provider_name"`
 	Description *string `json:"description,omitempty"`
 }
 
@@ -67,7 +192,8 @@ type ProviderPlatformCreate struct {
 // ProviderWithNamespace includes namespace information
 type ProviderWithNamespace struct {
 	Provider
-	Namespace string `json:"namespace"`
+	Namespace   string             `json:"namespace"`
+	Maintainers *NamespaceContacts `json:"maintainers,omitempty"`
 }
 
 // Terraform Protocol DTOs
@@ -75,12 +201,14 @@ type ProviderWithNamespace struct {
 // ProviderVersionsResponse is the response for listing provider versions (Terraform protocol)
 type ProviderVersionsResponse struct {
 	Versions []ProviderVersionDTO `json:"versions"`
+	Warnings []string             `json:"warnings,omitempty"` // shown by terraform init
 }
 
 type ProviderVersionDTO struct {
-	Version   string                `json:"version"`
-	Protocols []string              `json:"protocols"`
-	Platforms []ProviderPlatformDTO `json:"platforms"`
+	Version     string                `json:"version"`
+	Protocols   []string              `json:"protocols"`
+	Platforms   []ProviderPlatformDTO `json:"platforms"`
+	Deprecation *VersionDeprecation   `json:"deprecation,omitempty"` // with REGISTRY_EXTENDED_VERSIONS
 }
 
 type ProviderPlatformDTO struct {
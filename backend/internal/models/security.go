@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// SecurityAlert flags authentication activity for security review: brute-force
+// lockouts, API keys used from a new location, or sudden spikes in a key's usage
+type SecurityAlert struct {
+	ID             string                 `json:"id"`
+	Type           string                 `json:"type"` // "brute_force", "new_location" or "volume_spike"
+	APIKeyID       *string                `json:"api_key_id,omitempty"`
+	APIKeyName     *string                `json:"api_key_name,omitempty"`
+	ClientIP       string                 `json:"client_ip"`
+	Location       *string                `json:"location,omitempty"` // Country (AUTH_COUNTRY_HEADER) or IP network
+	Details        map[string]interface{} `json:"details,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+	AcknowledgedAt *time.Time             `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy *string                `json:"acknowledged_by,omitempty"`
+}
+
+// AuthLockout is a client IP or presented key that is temporarily refused after
+// repeated failed authentication attempts
+type AuthLockout struct {
+	Subject     string    `json:"subject"` // "ip:<address>" or "key:<hash prefix>"
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// SourceHost allows git repositories or mirrored artifacts from a host: "git.corp.com",
+// or every subdomain with ".corp.com" or "*.corp.com"
+type SourceHost struct {
+	ID          string    `json:"id"`
+	Kind        string    `json:"kind"` // git or artifact
+	Pattern     string    `json:"pattern"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// SourceHostCreate is used for adding a host to the allowlist
+type SourceHostCreate struct {
+	Kind        string `json:"kind" binding:"required,oneof=git artifact"`
+	Pattern     string `json:"pattern" binding:"required,max=255"`
+	Description string `json:"description" binding:"max=1000"`
+}
@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// StackPath is one path of a stack run, started once the paths it depends on have succeeded
+type StackPath struct {
+	Path      string   `json:"path" yaml:"path"`
+	DependsOn []string `json:"depends_on,omitempty" yaml:"depends_on"`
+}
+
+// StackConfig is the stack file read from the repository
+type StackConfig struct {
+	Paths []StackPath `yaml:"paths"`
+}
+
+// StackRunCreate is used for starting a stack run
+type StackRunCreate struct {
+	Ref                string            `json:"ref"`                                                                   // Branch or tag (required unless commit_sha is set)
+	CommitSHA          string            `json:"commit_sha,omitempty"`                                                  // Exact commit all paths run at
+	Tool               string            `json:"tool" binding:"required,oneof=terraform tofu terragrunt auto"`          // "tofu", "terraform", "terragrunt" or "auto" (detected by the runner)
+	EnvVars            map[string]string `json:"env_vars,omitempty" binding:"omitempty,dive,keys,env_var_name,endkeys"` // Environment variables shared by all paths
+	TfvarsFiles        []string          `json:"tfvars_files,omitempty" binding:"omitempty,dive,relpath"`               // .tfvars files, relative to each path
+	InitFlags          string            `json:"init_flags,omitempty"`                                                  // Additional flags for init command
+	PlanFlags          string            `json:"plan_flags,omitempty"`                                                  // Additional flags for plan command
+	TerraformWorkspace string            `json:"terraform_workspace,omitempty"`                                         // CLI workspace (optional, defaults to deployment terraform_workspace)
+	Destroy            bool              `json:"destroy,omitempty"`                                                     // Destroy the paths, dependents first
+	Paths              []StackPath       `json:"paths,omitempty"`                                                       // Paths and dependencies; read from config_file when empty
+	ConfigFile         string            `json:"config_file,omitempty" binding:"omitempty,relpath"`                     // Stack file in the repository (default: stack.yaml)
+}
+
+// StackRun is a set of runs of one deployment executed in dependency order
+type StackRun struct {
+	ID                 string            `json:"id"`
+	DeploymentID       string            `json:"deployment_id"`
+	Ref                string            `json:"ref"`
+	CommitSHA          string            `json:"commit_sha"` // Every path runs at this commit
+	Tool               string            `json:"tool"`
+	EnvVars            map[string]string `json:"env_vars"`
+	TfvarsFiles        []string          `json:"tfvars_files"`
+	InitFlags          string            `json:"init_flags"`
+	PlanFlags          string            `json:"plan_flags"`
+	TerraformWorkspace string            `json:"terraform_workspace,omitempty"`
+	Operation          string            `json:"operation"` // "apply" or "destroy"
+	Paths              []StackPath       `json:"paths"`
+	ConfigFile         *string           `json:"config_file,omitempty"`
+	Status             string            `json:"status"` // "pending", "running", "awaiting_approval", "success", "failed", "cancelled"
+	ErrorMessage       *string           `json:"error_message,omitempty"`
+	Counts             map[string]int    `json:"counts"` // Paths per node status
+	Nodes              []StackNode       `json:"nodes"`
+	Edges              []StackEdge       `json:"edges"`
+	Levels             [][]string        `json:"levels"` // Paths grouped by execution depth, for fan-out/fan-in layouts
+	CreatedAt          time.Time         `json:"created_at"`
+	StartedAt          *time.Time        `json:"started_at,omitempty"`
+	CompletedAt        *time.Time        `json:"completed_at,omitempty"`
+}
+
+// StackNode is the progress of one path of a stack run
+type StackNode struct {
+	Path        string     `json:"path"`
+	DependsOn   []string   `json:"depends_on"`
+	Level       int        `json:"level"`
+	RunID       *string    `json:"run_id,omitempty"`
+	Status      string     `json:"status"` // The run's status, "waiting" before it starts, "skipped" if a prerequisite did not succeed
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// StackEdge orders two paths: To starts after From has succeeded
+type StackEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrAlreadyRedelivered is returned when redelivering a dead letter that was delivered
+var ErrAlreadyRedelivered = errors.New("dead letter was already redelivered")
+
+// storeDeadLetter keeps an event the webhook did not accept, so it is not lost
+func storeDeadLetter(eventType string, body []byte, attempts int, deliveryErr error) {
+	_, err := database.DB.Exec(`
+		INSERT INTO dead_letters (id, event_type, payload, attempts, last_error, created_at, last_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+	`, uuid.New().String(), eventType, string(body), attempts, deliveryErr.Error(), time.Now())
+	if err != nil {
+		log.Printf("[notify] Failed to store dead letter for %s, the event is lost: %v", eventType, err)
+	}
+}
+
+const deadLetterColumns = `id, event_type, payload, attempts, last_error, created_at, last_attempt_at, redelivered_at, redelivered_by`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDeadLetter(row rowScanner) (*models.DeadLetter, error) {
+	var d models.DeadLetter
+	var payload string
+	var redeliveredAt sql.NullTime
+	if err := row.Scan(&d.ID, &d.EventType, &payload, &d.Attempts, &d.LastError, &d.CreatedAt, &d.LastAttemptAt,
+		&redeliveredAt, &d.RedeliveredBy); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(payload), &d.Payload)
+	if redeliveredAt.Valid {
+		d.RedeliveredAt = &redeliveredAt.Time
+	}
+	return &d, nil
+}
+
+// DeadLetters lists dead letters, newest first; pending selects those not yet redelivered
+// (true), redelivered ones (false) or all (nil)
+func DeadLetters(eventType string, pending *bool, limit int) ([]models.DeadLetter, error) {
+	query := `SELECT ` + deadLetterColumns + ` FROM dead_letters WHERE TRUE`
+	args := []interface{}{}
+	if eventType != "" {
+		args = append(args, eventType)
+		query += fmt.Sprintf(` AND event_type = $%d`, len(args))
+	}
+	if pending != nil && *pending {
+		query += ` AND redelivered_at IS NULL`
+	} else if pending != nil {
+		query += ` AND redelivered_at IS NOT NULL`
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(` ORDER BY created_at DESC LIMIT $%d`, len(args))
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	letters := []models.DeadLetter{}
+	for rows.Next() {
+		d, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, *d)
+	}
+	return letters, rows.Err()
+}
+
+// Redeliver posts a dead letter to the webhook again, as it was first sent. On success it
+// is marked as redelivered by redeliveredBy; on failure its attempts and error are updated
+// and the delivery error is returned. The error is sql.ErrNoRows when there is no such
+// dead letter.
+func Redeliver(id, redeliveredBy string) (*models.DeadLetter, error) {
+	var eventType, payload string
+	var redeliveredAt sql.NullTime
+	err := database.DB.QueryRow(`SELECT event_type, payload, redelivered_at FROM dead_letters WHERE id = $1`, id).
+		Scan(&eventType, &payload, &redeliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	if redeliveredAt.Valid {
+		return nil, ErrAlreadyRedelivered
+	}
+
+	attempts, deliveryErr := deliver(eventType, []byte(payload))
+	if deliveryErr == ErrNoWebhook {
+		return nil, deliveryErr
+	}
+	now := time.Now()
+	if deliveryErr != nil {
+		_, err = database.DB.Exec(`UPDATE dead_letters SET attempts = attempts + $1, last_error = $2, last_attempt_at = $3 WHERE id = $4`,
+			attempts, deliveryErr.Error(), now, id)
+	} else {
+		_, err = database.DB.Exec(`UPDATE dead_letters SET attempts = attempts + $1, last_attempt_at = $2, redelivered_at = $2, redelivered_by = $3 WHERE id = $4`,
+			attempts, now, redeliveredBy, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := scanDeadLetter(database.DB.QueryRow(`SELECT `+deadLetterColumns+` FROM dead_letters WHERE id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+	if deliveryErr != nil {
+		return d, deliveryErr
+	}
+	return d, nil
+}
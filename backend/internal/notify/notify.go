@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"iac-tool/internal/cluster"
+	"iac-tool/internal/outbound"
+	"iac-tool/internal/retry"
+)
+
+// DeliveryJob is the background job webhook deliveries are recorded under
+const DeliveryJob = "webhook_delivery"
+
+// ErrNoWebhook is returned when delivering without NOTIFICATION_WEBHOOK_URL
+var ErrNoWebhook = errors.New("NOTIFICATION_WEBHOOK_URL is not set")
+
+// Event is a platform notification (e.g., an upcoming auto-destroy)
+type Event struct {
+	Type      string                 `json:"type"`
+	Message   string                 `json:"message"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+// Send logs the event and, if NOTIFICATION_WEBHOOK_URL is set, posts it there as JSON.
+// Delivery happens in the background and never blocks the caller; an event the webhook
+// does not accept after all retries is kept as a dead letter.
+func Send(eventType, message string, data map[string]interface{}) {
+	event := Event{
+		Type:      eventType,
+		Message:   message,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+
+	log.Printf("[notify] %s: %s", eventType, message)
+
+	if os.Getenv("NOTIFICATION_WEBHOOK_URL") == "" {
+		return
+	}
+
+	go func() {
+		started := time.Now()
+		body, _ := json.Marshal(event)
+		attempts, err := deliver(eventType, body)
+		if err != nil {
+			log.Printf("[notify] Failed to deliver %s: %v", eventType, err)
+			cluster.RecordJob(DeliveryJob, started, 0, fmt.Errorf("delivering %s: %w", eventType, err))
+			storeDeadLetter(eventType, body, attempts, err)
+			return
+		}
+		cluster.RecordJob(DeliveryJob, started, 1, nil)
+	}()
+}
+
+// deliver posts an event to NOTIFICATION_WEBHOOK_URL, retrying while the receiver cannot
+// be reached or fails, and returns how many attempts were made
+func deliver(eventType string, body []byte) (int, error) {
+	webhookURL := os.Getenv("NOTIFICATION_WEBHOOK_URL")
+	if webhookURL == "" {
+		return 0, ErrNoWebhook
+	}
+	client := outbound.NewClient(10 * time.Second)
+	attempts := 0
+	err := retry.Do("webhook delivery of "+eventType, func() error {
+		attempts++
+		resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			err := fmt.Errorf("webhook returned status %d", resp.StatusCode)
+			// The receiver rejected the event itself; sending it again does not help
+			if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != 408 && resp.StatusCode != 429 {
+				return retry.Permanent(err)
+			}
+			return err
+		}
+		return nil
+	})
+	return attempts, err
+}
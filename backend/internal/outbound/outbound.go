@@ -0,0 +1,149 @@
+// Package outbound configures the backend's calls to external hosts (git servers, host
+// APIs, upstream registries, the notification webhook) for enterprise networks:
+// OUTBOUND_CA_BUNDLE adds the CAs of a PEM file to the system roots, and the standard
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables route the calls through a proxy. The
+// same settings are passed to git commands through their environment.
+package outbound
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// systemBundles are the usual locations of the system CA bundle, which git would read
+// when GIT_SSL_CAINFO is not set
+var systemBundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",                // Debian, Ubuntu, Alpine
+	"/etc/pki/tls/certs/ca-bundle.crt",                  // Fedora, RHEL
+	"/etc/ssl/ca-bundle.pem",                            // openSUSE
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", // CentOS, RHEL 7
+	"/etc/ssl/cert.pem",                                 // macOS, Alpine
+}
+
+var (
+	transportOnce sync.Once
+	transport     http.RoundTripper
+
+	bundleOnce sync.Once
+	bundlePath string
+)
+
+// CABundle returns the path of the custom CA bundle, empty when OUTBOUND_CA_BUNDLE is unset
+func CABundle() string {
+	return os.Getenv("OUTBOUND_CA_BUNDLE")
+}
+
+// Validate checks that the custom CA bundle, if any, can be read and holds certificates
+func Validate() error {
+	_, err := rootCAs()
+	return err
+}
+
+// rootCAs returns the system roots plus the custom CA bundle, nil without a bundle
+func rootCAs() (*x509.CertPool, error) {
+	path := CABundle()
+	if path == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("OUTBOUND_CA_BUNDLE: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("OUTBOUND_CA_BUNDLE: no PEM certificates in %s", path)
+	}
+	return pool, nil
+}
+
+// Transport returns the transport shared by outbound clients: proxies from the
+// environment and the custom CA bundle on top of the system roots. An unusable bundle is
+// logged and the system roots are used alone.
+func Transport() http.RoundTripper {
+	transportOnce.Do(func() {
+		base := http.DefaultTransport.(*http.Transport).Clone()
+		base.Proxy = http.ProxyFromEnvironment
+		pool, err := rootCAs()
+		if err != nil {
+			log.Printf("Warning: %v, outbound calls use the system CAs only", err)
+		}
+		if pool != nil {
+			base.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+		}
+		transport = base
+	})
+	return transport
+}
+
+// NewClient returns a client for outbound calls with the given timeout (0 for none)
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: Transport(), Timeout: timeout}
+}
+
+// gitBundle writes the system CA bundle followed by the custom one to a private temp
+// file on first use. GIT_SSL_CAINFO replaces git's default bundle, so the system CAs
+// have to be part of it for public hosts to keep working.
+func gitBundle() string {
+	bundleOnce.Do(func() {
+		custom, err := os.ReadFile(CABundle())
+		if err != nil {
+			log.Printf("Warning: OUTBOUND_CA_BUNDLE: %v, git uses the system CAs only", err)
+			return
+		}
+		var combined []byte
+		candidates := systemBundles
+		if file := os.Getenv("SSL_CERT_FILE"); file != "" {
+			candidates = append([]string{file}, candidates...)
+		}
+		for _, file := range candidates {
+			if system, err := os.ReadFile(file); err == nil {
+				combined = append(system, '\n')
+				break
+			}
+		}
+		combined = append(combined, custom...)
+
+		dir, err := os.MkdirTemp("", "outbound-ca-*")
+		if err != nil {
+			log.Printf("Warning: failed to write git CA bundle, git uses the system CAs only: %v", err)
+			return
+		}
+		path := filepath.Join(dir, "ca-bundle.pem")
+		if err := os.WriteFile(path, combined, 0644); err != nil {
+			log.Printf("Warning: failed to write git CA bundle, git uses the system CAs only: %v", err)
+			return
+		}
+		bundlePath = path
+	})
+	return bundlePath
+}
+
+// GitEnv returns the variables that give git commands the same CAs and proxies as the
+// backend's own calls. curl, which git uses for HTTPS, only reads the lower-case
+// http_proxy, so upper-case proxy variables are mirrored to lower case.
+func GitEnv() []string {
+	var env []string
+	if CABundle() != "" {
+		if path := gitBundle(); path != "" {
+			env = append(env, "GIT_SSL_CAINFO="+path)
+		}
+	}
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"} {
+		lower := strings.ToLower(name)
+		if value := os.Getenv(name); value != "" && os.Getenv(lower) == "" {
+			env = append(env, lower+"="+value)
+		}
+	}
+	return env
+}
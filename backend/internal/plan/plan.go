@@ -0,0 +1,199 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"iac-tool/internal/models"
+)
+
+// actionOrder is the order change groups are listed in; actions of newer terraform versions
+// that are not listed follow in alphabetical order
+var actionOrder = []string{"create", "update", "replace", "delete", "forget", "read", "import", "move"}
+
+// reasons turns terraform's action_reason values into short explanations
+var reasons = map[string]string{
+	"replace_because_tainted":           "tainted",
+	"replace_by_request":                "replacement requested",
+	"replace_by_triggers":               "replace_triggered_by",
+	"delete_because_no_resource_config": "no longer in configuration",
+	"delete_because_no_module":          "module removed from configuration",
+	"delete_because_wrong_repetition":   "count/for_each changed",
+	"delete_because_count_index":        "count index out of range",
+	"delete_because_each_key":           "for_each key removed",
+	"delete_because_no_move_target":     "moved target does not exist",
+	"read_because_config_unknown":       "configuration depends on values known after apply",
+	"read_because_dependency_pending":   "depends on a pending change",
+}
+
+// planJSON is the part of `terraform show -json` output the summary needs
+type planJSON struct {
+	TerraformVersion string `json:"terraform_version"`
+	ResourceChanges  []struct {
+		Address         string `json:"address"`
+		PreviousAddress string `json:"previous_address"`
+		Deposed         string `json:"deposed"`
+		ActionReason    string `json:"action_reason"`
+		Change          struct {
+			Actions      []string         `json:"actions"`
+			ReplacePaths [][]interface{}  `json:"replace_paths"`
+			Importing    *json.RawMessage `json:"importing"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+	OutputChanges map[string]struct {
+		Actions []string `json:"actions"`
+	} `json:"output_changes"`
+}
+
+// Summarize converts plan JSON into changes grouped by action. No-op changes are
+// left out unless the resource is being moved or imported.
+func Summarize(data []byte) (*models.PlanSummary, error) {
+	var p planJSON
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid plan JSON: %w", err)
+	}
+
+	summary := &models.PlanSummary{
+		Available:        true,
+		TerraformVersion: p.TerraformVersion,
+		Counts:           make(map[string]int),
+		Groups:           []models.PlanChangeGroup{},
+		Outputs:          []models.PlanOutputChange{},
+	}
+
+	groups := make(map[string][]models.PlanChange)
+	for _, rc := range p.ResourceChanges {
+		change := models.PlanChange{
+			Address:         rc.Address,
+			Action:          action(rc.Change.Actions),
+			Reason:          reasons[rc.ActionReason],
+			PreviousAddress: rc.PreviousAddress,
+			Deposed:         rc.Deposed,
+		}
+		if change.Action == "no-op" {
+			switch {
+			case rc.Change.Importing != nil:
+				change.Action = "import"
+			case rc.PreviousAddress != "" && rc.PreviousAddress != rc.Address:
+				change.Action = "move"
+			default:
+				continue
+			}
+		}
+		if change.Action == "replace" {
+			for _, path := range rc.Change.ReplacePaths {
+				change.Forces = append(change.Forces, formatPath(path))
+			}
+		}
+		change.Summary = describe(change)
+
+		groups[change.Action] = append(groups[change.Action], change)
+		summary.Counts[change.Action]++
+	}
+
+	for _, a := range actionOrder {
+		if changes, ok := groups[a]; ok {
+			summary.Groups = append(summary.Groups, models.PlanChangeGroup{Action: a, Changes: changes})
+			delete(groups, a)
+		}
+	}
+	unknown := make([]string, 0, len(groups))
+	for a := range groups {
+		unknown = append(unknown, a)
+	}
+	sort.Strings(unknown)
+	for _, a := range unknown {
+		summary.Groups = append(summary.Groups, models.PlanChangeGroup{Action: a, Changes: groups[a]})
+	}
+
+	names := make([]string, 0, len(p.OutputChanges))
+	for name, oc := range p.OutputChanges {
+		if action(oc.Actions) != "no-op" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		summary.Outputs = append(summary.Outputs, models.PlanOutputChange{Name: name, Action: action(p.OutputChanges[name].Actions)})
+	}
+
+	return summary, nil
+}
+
+// action collapses terraform's action list into a single action name
+func action(actions []string) string {
+	switch {
+	case len(actions) == 2:
+		return "replace" // ["delete","create"] or ["create","delete"] (create_before_destroy)
+	case len(actions) == 1:
+		return actions[0]
+	default:
+		return "no-op"
+	}
+}
+
+// describe renders the one-line summary of a change, in the wording of terraform's plan output
+func describe(change models.PlanChange) string {
+	subject := change.Address
+	if change.Deposed != "" {
+		subject = fmt.Sprintf("%s (deposed object %s)", change.Address, change.Deposed)
+	}
+
+	var text string
+	switch change.Action {
+	case "create":
+		text = subject + " will be created"
+	case "update":
+		text = subject + " will be updated in-place"
+	case "replace":
+		text = subject + " will be replaced"
+	case "delete":
+		text = subject + " will be destroyed"
+	case "forget":
+		text = subject + " will no longer be managed by Terraform"
+	case "read":
+		text = subject + " will be read during apply"
+	case "import":
+		text = subject + " will be imported"
+	case "move":
+		text = fmt.Sprintf("%s has moved to %s", change.PreviousAddress, change.Address)
+	default:
+		text = fmt.Sprintf("%s: %s", subject, change.Action)
+	}
+
+	var details []string
+	if len(change.Forces) > 0 {
+		details = append(details, "forces: "+strings.Join(change.Forces, ", "))
+	}
+	if change.Reason != "" {
+		details = append(details, change.Reason)
+	}
+	if change.PreviousAddress != "" && change.Action != "move" && change.PreviousAddress != change.Address {
+		details = append(details, "moved from "+change.PreviousAddress)
+	}
+	if len(details) > 0 {
+		text += " (" + strings.Join(details, "; ") + ")"
+	}
+	return text
+}
+
+// formatPath renders a replace path such as ["network_interface", 0, "subnet_id"]
+func formatPath(path []interface{}) string {
+	var b strings.Builder
+	for i, step := range path {
+		switch s := step.(type) {
+		case string:
+			if i > 0 {
+				b.WriteString(".")
+			}
+			b.WriteString(s)
+		case float64:
+			fmt.Fprintf(&b, "[%d]", int(s))
+		default:
+			fmt.Fprintf(&b, "[%v]", s)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+// scopedTokenPrefix marks tokens minted by MintScopedToken
+const scopedTokenPrefix = "rst."
+
+// ScopedClaims is what a scoped token grants: read access to the listed private
+// namespaces, for one run, until ExpiresAt
+type ScopedClaims struct {
+	RunID      string   `json:"run"`
+	Namespaces []string `json:"ns"`
+	ExpiresAt  int64    `json:"exp"`
+}
+
+// Allows reports whether the claims cover the namespace
+func (c ScopedClaims) Allows(namespace string) bool {
+	for _, ns := range c.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// IsScopedToken reports whether a bearer token looks like a scoped token
+func IsScopedToken(token string) bool {
+	return strings.HasPrefix(token, scopedTokenPrefix)
+}
+
+// GlobalTokenEnabled reports whether the all-namespaces registry token is still
+// accepted (REGISTRY_GLOBAL_TOKEN=true), for runners that do not receive scoped tokens
+func GlobalTokenEnabled() bool {
+	return os.Getenv("REGISTRY_GLOBAL_TOKEN") == "true"
+}
+
+// scopedSignature signs a token payload with the registry token, so rotating the
+// registry token revokes every scoped token
+func scopedSignature(payload string) string {
+	mac := hmac.New(sha256.New, []byte(GetToken()))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// MintScopedToken issues a token that lets a run read the given namespaces for ttl.
+// The token is self-contained: "rst.<claims>.<signature>".
+func MintScopedToken(runID string, namespaces []string, ttl time.Duration) (string, error) {
+	claims, err := json.Marshal(ScopedClaims{RunID: runID, Namespaces: namespaces, ExpiresAt: time.Now().Add(ttl).Unix()})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	return scopedTokenPrefix + payload + "." + scopedSignature(payload), nil
+}
+
+// ParseScopedToken verifies a scoped token and returns its claims
+func ParseScopedToken(token string) (*ScopedClaims, error) {
+	parts := strings.Split(strings.TrimPrefix(token, scopedTokenPrefix), ".")
+	if !IsScopedToken(token) || len(parts) != 2 {
+		return nil, errors.New("malformed scoped token")
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(scopedSignature(parts[0]))) {
+		return nil, errors.New("invalid scoped token")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("malformed scoped token")
+	}
+	var claims ScopedClaims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, errors.New("malformed scoped token")
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errors.New("scoped token has expired")
+	}
+	return &claims, nil
+}
@@ -0,0 +1,181 @@
+// Package retry retries operations that fail on transient network errors, such as calls to
+// the runner and git clones, with exponential backoff and jitter. Attempts and delays are
+// configured with RETRY_ATTEMPTS, RETRY_BACKOFF, RETRY_MAX_BACKOFF and RETRY_JITTER, and
+// every retry is logged with the error that caused it.
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy is how often and how fast a failing operation is retried
+type Policy struct {
+	Attempts  int           // Including the first; 1 disables retries
+	BaseDelay time.Duration // Before the first retry, doubled for each further one
+	MaxDelay  time.Duration
+	Jitter    float64 // Fraction of each delay that is randomized, 0 to 1
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultPolicy Policy
+)
+
+// Default returns the policy configured by the environment, read once
+func Default() Policy {
+	defaultOnce.Do(func() {
+		defaultPolicy = Policy{
+			Attempts:  envInt("RETRY_ATTEMPTS", 3),
+			BaseDelay: envDuration("RETRY_BACKOFF", time.Second),
+			MaxDelay:  envDuration("RETRY_MAX_BACKOFF", 30*time.Second),
+			Jitter:    0.2,
+		}
+		if value := os.Getenv("RETRY_JITTER"); value != "" {
+			if j, err := strconv.ParseFloat(value, 64); err == nil && j >= 0 && j <= 1 {
+				defaultPolicy.Jitter = j
+			} else {
+				log.Printf("Warning: invalid RETRY_JITTER %q, using %.1f", value, defaultPolicy.Jitter)
+			}
+		}
+	})
+	return defaultPolicy
+}
+
+// permanentError is an error retrying cannot fix
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error that is returned without retrying, e.g. a rejected credential
+// or a missing branch
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Do runs fn under the default policy; see Policy.Do
+func Do(name string, fn func() error) error {
+	return Default().Do(name, fn)
+}
+
+// Do runs fn until it succeeds, returns a Permanent error or runs out of attempts. name
+// describes the operation in the logs. The last error is returned, unwrapped from Permanent.
+func (p Policy) Do(name string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			if attempt > 1 {
+				log.Printf("Retry: %s succeeded on attempt %d", name, attempt)
+			}
+			return nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		if attempt >= p.Attempts {
+			if attempt > 1 {
+				return fmt.Errorf("%w (after %d attempts)", err, attempt)
+			}
+			return err
+		}
+		delay := p.delay(attempt)
+		log.Printf("Retry: %s failed (attempt %d/%d), retrying in %s: %v", name, attempt, p.Attempts, delay, err)
+		time.Sleep(delay)
+	}
+}
+
+// delay returns the backoff before retry number attempt
+func (p Policy) delay(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay > p.MaxDelay || delay <= 0 {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		spread := float64(delay) * p.Jitter
+		delay = time.Duration(float64(delay) - spread + rand.Float64()*2*spread)
+	}
+	return delay.Round(time.Millisecond)
+}
+
+// Unsent reports whether a failed HTTP request never reached the server (the connection
+// or the name lookup failed), so even a request that is not idempotent can be resent
+func Unsent(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// TransientStatus reports whether an HTTP status is worth retrying: the server or a proxy
+// in front of it is overloaded or restarting
+func TransientStatus(status int) bool {
+	return status == 502 || status == 503 || status == 504 || status == 429
+}
+
+// transientGitOutput are messages of git failures caused by the network or an overloaded
+// server, rather than by credentials or a missing repository or ref
+var transientGitOutput = []string{
+	"could not resolve host",
+	"connection timed out",
+	"connection reset",
+	"connection refused",
+	"operation timed out",
+	"early eof",
+	"the remote end hung up unexpectedly",
+	"rpc failed",
+	"unexpected disconnect",
+	"tls connection was non-properly terminated",
+	"gnutls recv error",
+	"the requested url returned error: 429",
+	"the requested url returned error: 502",
+	"the requested url returned error: 503",
+	"the requested url returned error: 504",
+	"temporary failure in name resolution",
+}
+
+// TransientGit reports whether the output of a failed git command points to a transient
+// network error
+func TransientGit(output string) bool {
+	output = strings.ToLower(output)
+	for _, message := range transientGitOutput {
+		if strings.Contains(output, message) {
+			return true
+		}
+	}
+	return false
+}
+
+func envInt(name string, def int) int {
+	if value := os.Getenv(name); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+		log.Printf("Warning: invalid %s %q, using %d", name, value, def)
+	}
+	return def
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	if value := os.Getenv(name); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			return d
+		}
+		log.Printf("Warning: invalid %s %q, using %s", name, value, def)
+	}
+	return def
+}
@@ -0,0 +1,51 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"iac-tool/internal/build"
+)
+
+// artifactGCInterval is how often BUILD_DIR is reconciled against the database;
+// ARTIFACT_GC_INTERVAL=0 disables the job
+func artifactGCInterval() time.Duration {
+	if v := os.Getenv("ARTIFACT_GC_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return 24 * time.Hour
+}
+
+// checkArtifacts reports orphaned and missing provider artifacts, every
+// artifactGCInterval. Orphaned files are only deleted when ARTIFACT_GC_DELETE=true. It
+// returns the number of orphaned and deduplicated files.
+func checkArtifacts() (int, error) {
+	dryRun := os.Getenv("ARTIFACT_GC_DELETE") != "true"
+	report, err := build.CollectArtifacts(build.ArtifactDir(), dryRun)
+	if err != nil {
+		return 0, fmt.Errorf("artifact GC failed: %w", err)
+	}
+	processed := len(report.Orphaned) + report.Deduplicated
+
+	if report.Deduplicated > 0 {
+		log.Printf("Scheduler: artifact GC moved %d duplicate provider files into the blob store", report.Deduplicated)
+	}
+	if len(report.Orphaned) == 0 && len(report.Missing) == 0 {
+		return processed, nil
+	}
+	if dryRun {
+		log.Printf("Scheduler: artifact GC found %d orphaned files (%d bytes) and %d platforms with missing files; set ARTIFACT_GC_DELETE=true or POST /api/admin/gc to remove orphans",
+			len(report.Orphaned), report.OrphanedBytes(), len(report.Missing))
+	} else {
+		log.Printf("Scheduler: artifact GC removed %d orphaned files (%d bytes); %d platforms have missing files",
+			report.Removed, report.ReclaimedBytes, len(report.Missing))
+	}
+	for _, m := range report.Missing {
+		log.Printf("Scheduler: provider %s/%s %s %s/%s is missing %s", m.Namespace, m.Provider, m.Version, m.OS, m.Arch, m.Path)
+	}
+	return processed, nil
+}
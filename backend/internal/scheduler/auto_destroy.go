@@ -0,0 +1,104 @@
+package scheduler
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"iac-tool/internal/database"
+	"iac-tool/internal/models"
+)
+
+// AutoDestroySchedules reports, for every deployment with auto_destroy_after (or only
+// deploymentID when it is not empty), the last and next auto-destroy as checkAutoDestroy
+// will carry it out. Quotas and maintenance mode may postpone a due destroy further.
+func AutoDestroySchedules(deploymentID string) ([]models.AutoDestroySchedule, error) {
+	query := `
+		SELECT id, name, auto_destroy_after, auto_destroy_notified_at, auto_destroy_attempted_at,
+		       COALESCE(auto_destroy_attempts, 0)
+		FROM deployments
+		WHERE auto_destroy_after IS NOT NULL AND auto_destroy_after != ''`
+	args := []interface{}{}
+	if deploymentID != "" {
+		query += ` AND id = $1`
+		args = append(args, deploymentID)
+	}
+	rows, err := database.DB.Query(query+` ORDER BY name`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list auto-destroy deployments: %w", err)
+	}
+
+	type entry struct {
+		schedule    models.AutoDestroySchedule
+		ttl         time.Duration
+		notifiedAt  sql.NullTime
+		attemptedAt sql.NullTime
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.schedule.DeploymentID, &e.schedule.Deployment, &e.schedule.AutoDestroyAfter,
+			&e.notifiedAt, &e.attemptedAt, &e.schedule.Attempts); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		d, err := time.ParseDuration(e.schedule.AutoDestroyAfter)
+		if err != nil || d <= 0 {
+			continue
+		}
+		e.ttl = d
+		entries = append(entries, e)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	schedules := []models.AutoDestroySchedule{}
+	for _, e := range entries {
+		s := e.schedule
+		if e.attemptedAt.Valid {
+			s.LastRun = &e.attemptedAt.Time
+		}
+
+		lastApply, paths, err := appliedPaths(s.DeploymentID)
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			s.Status = "idle"
+			schedules = append(schedules, s)
+			continue
+		}
+		expiresAt := lastApply.Add(e.ttl)
+		s.LastApplyAt, s.ExpiresAt = &lastApply, &expiresAt
+
+		// The same stages as checkAutoDestroy: notify at expiry, destroy after the grace
+		// period, retry failed destroys with backoff
+		var next time.Time
+		switch {
+		case !e.notifiedAt.Valid || e.notifiedAt.Time.Before(lastApply):
+			s.Status, s.Attempts = "waiting", 0
+			next = expiresAt
+			if now := time.Now(); next.Before(now) {
+				next = now
+			}
+			next = next.Add(autoDestroyGracePeriod())
+		case e.attemptedAt.Valid && e.attemptedAt.Time.After(lastApply):
+			if s.Attempts >= autoDestroyMaxAttempts() {
+				s.Status = "exhausted"
+				schedules = append(schedules, s)
+				continue
+			}
+			s.Status = "retrying"
+			next = e.attemptedAt.Time.Add(autoDestroyRetryDelay(s.Attempts))
+		default:
+			s.Status, s.Attempts = "notified", 0
+			next = e.notifiedAt.Time.Add(autoDestroyGracePeriod())
+		}
+		s.NextRun = &next
+		schedules = append(schedules, s)
+	}
+	return schedules, nil
+}
@@ -0,0 +1,42 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"iac-tool/internal/credentials"
+)
+
+// credentialCheckInterval is how often stored git credentials are validated;
+// CREDENTIAL_CHECK_INTERVAL=0 disables the job
+func credentialCheckInterval() time.Duration {
+	if v := os.Getenv("CREDENTIAL_CHECK_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return 6 * time.Hour
+}
+
+// checkCredentials validates stored git credentials so expired tokens are flagged
+// (and notified) before syncs and runs start failing; it runs every credentialCheckInterval
+// and returns the number of credentials checked
+func checkCredentials() (int, error) {
+	all, err := credentials.CheckAll()
+	if err != nil {
+		return 0, fmt.Errorf("credential check failed: %w", err)
+	}
+
+	unhealthy := 0
+	for _, h := range all {
+		if h.Status != nil && *h.Status != credentials.StatusValid {
+			unhealthy++
+		}
+	}
+	if unhealthy > 0 {
+		log.Printf("Scheduler: %d of %d stored git credentials need attention", unhealthy, len(all))
+	}
+	return len(all), nil
+}
@@ -0,0 +1,24 @@
+package scheduler
+
+import (
+	"os"
+	"time"
+
+	"iac-tool/internal/digest"
+)
+
+// digestCheckInterval is how often due activity digests are sent; DIGEST_CHECK_INTERVAL=0
+// disables the job
+func digestCheckInterval() time.Duration {
+	if v := os.Getenv("DIGEST_CHECK_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return time.Hour
+}
+
+// sendDigests sends the daily and weekly digests whose period has elapsed
+func sendDigests() (int, error) {
+	return digest.SendDue()
+}
@@ -0,0 +1,26 @@
+package scheduler
+
+import (
+	"os"
+	"time"
+
+	"iac-tool/internal/build"
+)
+
+// providerMirrorInterval is how often mirrored providers look for new upstream versions;
+// PROVIDER_MIRROR_INTERVAL=0 disables the job
+func providerMirrorInterval() time.Duration {
+	if v := os.Getenv("PROVIDER_MIRROR_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return 6 * time.Hour
+}
+
+// syncProviderMirrors copies new upstream versions of every mirrored provider, every
+// providerMirrorInterval. Download URLs are derived from BASE_URL; the registry rebuilds
+// them from the request when serving, so an unset BASE_URL only affects the stored value.
+func syncProviderMirrors() (int, error) {
+	return build.SyncAllProviderMirrors(os.Getenv("BASE_URL"), build.ArtifactDir())
+}
@@ -0,0 +1,360 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"iac-tool/internal/build"
+	"iac-tool/internal/cluster"
+	"iac-tool/internal/database"
+	"iac-tool/internal/maintenance"
+	"iac-tool/internal/notify"
+
+	"github.com/google/uuid"
+)
+
+var (
+	stop    = make(chan struct{})
+	stopped = make(chan struct{})
+
+	backgroundJobs sync.WaitGroup
+	runningJobs    sync.Map // Names of background jobs still running
+)
+
+// schedulerInterval is how often the scheduler loop runs (SCHEDULER_INTERVAL, default 1m)
+func schedulerInterval() time.Duration {
+	if v := os.Getenv("SCHEDULER_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return time.Minute
+}
+
+// job is a periodic job of the scheduler
+type job struct {
+	name        string
+	description string
+	interval    time.Duration
+	run         func() (int, error)
+	changes     bool // Starts runs or changes stored artifacts, so it waits for maintenance mode to end
+	background  bool // Slow, so it runs off the loop; a tick while it is still running skips it
+}
+
+// jobs are the periodic jobs, each run on one instance per interval (see cluster.RunJob)
+func jobs() []job {
+	return []job{
+		{"auto_destroy", "Notifies about and destroys deployments past auto_destroy_after", schedulerInterval(), checkAutoDestroy, true, false},
+		{"artifact_gc", "Reconciles BUILD_DIR against the database", artifactGCInterval(), checkArtifacts, true, false},
+		{"provider_mirror", "Copies new upstream versions of mirrored providers", providerMirrorInterval(), syncProviderMirrors, true, false},
+		{"credential_check", "Validates stored git credentials", credentialCheckInterval(), checkCredentials, false, true},
+		{"activity_digest", "Sends due activity digests", digestCheckInterval(), sendDigests, false, false},
+	}
+}
+
+// reconcilerJob is the name runs of build.ResumeOrphanedWork are recorded under
+const reconcilerJob = "run_reconciler"
+
+// resumeOrphanedWork takes over runs and stacks followed by an instance that went away
+// (see build.ReconcileRuns) and records the outcome with the jobs
+func resumeOrphanedWork() {
+	started := time.Now()
+	resumed, err := build.ResumeOrphanedWork()
+	cluster.RecordJob(reconcilerJob, started, resumed, err)
+}
+
+// Start runs the background scheduler loop
+func Start() {
+	interval := schedulerInterval()
+
+	go func() {
+		defer close(stopped)
+		defer backgroundJobs.Wait()
+
+		// Reconcile runs left unfinished by the previous process before waiting a full interval
+		resumeOrphanedWork()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+
+			// Jobs that start runs or change stored artifacts wait for maintenance mode to end
+			inMaintenance := maintenance.Enabled()
+			for _, j := range jobs() {
+				if j.changes && inMaintenance {
+					continue
+				}
+				if j.background {
+					runInBackground(j, interval)
+					continue
+				}
+				cluster.RunJob(j.name, j.interval, interval, j.run)
+			}
+
+			// Runs and stacks followed by an instance that went away are taken over or,
+			// when the runner lost them, failed (see build.ReconcileRuns)
+			resumeOrphanedWork()
+		}
+	}()
+
+	log.Printf("✓ Scheduler started (interval %s)", interval)
+}
+
+// runInBackground runs a background job off the scheduler loop unless it is still running
+// from an earlier tick
+func runInBackground(j job, tick time.Duration) {
+	if _, running := runningJobs.LoadOrStore(j.name, struct{}{}); running {
+		return
+	}
+	backgroundJobs.Add(1)
+	go func() {
+		defer backgroundJobs.Done()
+		defer runningJobs.Delete(j.name)
+		cluster.RunJob(j.name, j.interval, tick, j.run)
+	}()
+}
+
+// Stop ends the scheduler loop, waiting until ctx is done for the jobs of the current
+// iteration to finish
+func Stop(ctx context.Context) {
+	close(stop)
+	select {
+	case <-stopped:
+		log.Printf("Scheduler stopped")
+	case <-ctx.Done():
+		log.Printf("Warning: scheduler jobs still running at shutdown")
+	}
+}
+
+// autoDestroyGracePeriod is the time between the expiry notification and the destroy run
+func autoDestroyGracePeriod() time.Duration {
+	if v := os.Getenv("AUTO_DESTROY_GRACE_PERIOD"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return time.Hour
+}
+
+// autoDestroyMaxAttempts is how often a failing auto-destroy is tried before the scheduler
+// gives up on the expiry (AUTO_DESTROY_MAX_ATTEMPTS, default 3)
+func autoDestroyMaxAttempts() int {
+	if v := os.Getenv("AUTO_DESTROY_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 3
+}
+
+// autoDestroyRetryDelay is the wait before retrying an auto-destroy that failed attempts
+// times: AUTO_DESTROY_RETRY_BACKOFF (default 1h), doubled for every further failure
+func autoDestroyRetryDelay(attempts int) time.Duration {
+	backoff := time.Hour
+	if v := os.Getenv("AUTO_DESTROY_RETRY_BACKOFF"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			backoff = d
+		}
+	}
+	return backoff << (attempts - 1)
+}
+
+// checkAutoDestroy notifies about, and after the grace period destroys, deployments whose
+// auto_destroy_after TTL has elapsed since their last successful apply. A destroy that
+// leaves paths applied is notified and retried with backoff, up to autoDestroyMaxAttempts
+// times per expiry. It returns the number of deployments notified or destroyed.
+func checkAutoDestroy() (int, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, name, auto_destroy_after, auto_destroy_notified_at, auto_destroy_attempted_at,
+		       COALESCE(auto_destroy_attempts, 0), auto_destroy_failed_at
+		FROM deployments
+		WHERE auto_destroy_after IS NOT NULL AND auto_destroy_after != ''
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list auto-destroy deployments: %w", err)
+	}
+
+	type candidate struct {
+		id, name    string
+		ttl         time.Duration
+		notifiedAt  sql.NullTime
+		attemptedAt sql.NullTime
+		attempts    int
+		failedAt    sql.NullTime
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		var ttl string
+		if err := rows.Scan(&c.id, &c.name, &ttl, &c.notifiedAt, &c.attemptedAt, &c.attempts, &c.failedAt); err != nil {
+			continue
+		}
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			continue
+		}
+		c.ttl = d
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+
+	processed := 0
+	var lastErr error
+	for _, c := range candidates {
+		lastApply, paths, err := appliedPaths(c.id)
+		if err != nil {
+			log.Printf("Scheduler: failed to load runs for deployment %s: %v", c.id, err)
+			lastErr = err
+			continue
+		}
+		if len(paths) == 0 {
+			continue
+		}
+
+		expiresAt := lastApply.Add(c.ttl)
+		if time.Now().Before(expiresAt) {
+			continue
+		}
+
+		// Notify once per expiry; a newer apply resets the clock
+		if !c.notifiedAt.Valid || c.notifiedAt.Time.Before(lastApply) {
+			destroyAt := time.Now().Add(autoDestroyGracePeriod())
+			notify.Send("deployment.auto_destroy_scheduled",
+				fmt.Sprintf("Deployment %s will be destroyed at %s (auto_destroy_after %s elapsed)", c.name, destroyAt.Format(time.RFC3339), c.ttl),
+				map[string]interface{}{"deployment_id": c.id, "deployment": c.name, "destroy_at": destroyAt, "paths": paths})
+			database.DB.Exec(`UPDATE deployments SET auto_destroy_notified_at = $1 WHERE id = $2`, time.Now(), c.id)
+			processed++
+			continue
+		}
+
+		if time.Since(c.notifiedAt.Time) < autoDestroyGracePeriod() {
+			continue
+		}
+
+		// Paths still applied after an attempt for this expiry mean its destroy runs failed
+		if c.attemptedAt.Valid && c.attemptedAt.Time.After(lastApply) {
+			retryAt := c.attemptedAt.Time.Add(autoDestroyRetryDelay(c.attempts))
+			if !c.failedAt.Valid || c.failedAt.Time.Before(c.attemptedAt.Time) {
+				data := map[string]interface{}{"deployment_id": c.id, "deployment": c.name, "attempts": c.attempts, "paths": paths}
+				message := fmt.Sprintf("Auto-destroy of deployment %s failed (attempt %d of %d)", c.name, c.attempts, autoDestroyMaxAttempts())
+				if c.attempts < autoDestroyMaxAttempts() {
+					data["retry_at"] = retryAt
+					message += ", retrying at " + retryAt.Format(time.RFC3339)
+				} else {
+					message += ", giving up until the next apply"
+				}
+				notify.Send("deployment.auto_destroy_failed", message, data)
+				database.DB.Exec(`UPDATE deployments SET auto_destroy_failed_at = $1 WHERE id = $2`, time.Now(), c.id)
+				processed++
+			}
+			if c.attempts >= autoDestroyMaxAttempts() || time.Now().Before(retryAt) {
+				continue
+			}
+		} else {
+			c.attempts = 0
+		}
+
+		// A destroy waits for the organization's concurrent run quota; it is not an attempt
+		if msg := build.CheckRunQuota(c.id, len(paths)); msg != "" {
+			log.Printf("Scheduler: auto-destroy of deployment %s postponed: %s", c.id, msg)
+			continue
+		}
+
+		c.attempts++
+		database.DB.Exec(`UPDATE deployments SET auto_destroy_attempted_at = $1, auto_destroy_attempts = $2 WHERE id = $3`,
+			time.Now(), c.attempts, c.id)
+		for _, runID := range paths {
+			if err := startDestroyRun(runID); err != nil {
+				log.Printf("Scheduler: failed to start destroy run for deployment %s: %v", c.id, err)
+				lastErr = err
+			}
+		}
+		notify.Send("deployment.auto_destroy_started",
+			fmt.Sprintf("Auto-destroy started for deployment %s (attempt %d)", c.name, c.attempts),
+			map[string]interface{}{"deployment_id": c.id, "deployment": c.name, "attempt": c.attempts})
+		processed++
+	}
+	return processed, lastErr
+}
+
+// appliedPaths returns, per path, the last successful apply run whose resources have not
+// been destroyed since, along with the most recent of those apply times. Paths with an
+// active run are skipped.
+func appliedPaths(deploymentID string) (time.Time, []string, error) {
+	rows, err := database.DB.Query(`
+		SELECT DISTINCT ON (path) id, operation, status, completed_at
+		FROM deployment_runs
+		WHERE deployment_id = $1 AND operation IN ('apply', 'destroy')
+		  AND status NOT IN ('failed', 'cancelled')
+		ORDER BY path, created_at DESC
+	`, deploymentID)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	defer rows.Close()
+
+	var lastApply time.Time
+	var runIDs []string
+	for rows.Next() {
+		var id, operation, status string
+		var completedAt sql.NullTime
+		if err := rows.Scan(&id, &operation, &status, &completedAt); err != nil {
+			continue
+		}
+		if operation != "apply" || status != "success" || !completedAt.Valid {
+			continue
+		}
+		if completedAt.Time.After(lastApply) {
+			lastApply = completedAt.Time
+		}
+		runIDs = append(runIDs, id)
+	}
+
+	return lastApply, runIDs, nil
+}
+
+// startDestroyRun creates a pre-approved destroy run with the settings of an apply run
+func startDestroyRun(applyRunID string) error {
+	var deploymentID, path, ref, tool string
+	var commitSHA, envVarsJSON, tfvarsFilesJSON, initFlags, planFlags, workspace sql.NullString
+	err := database.DB.QueryRow(`
+		SELECT deployment_id, path, ref, commit_sha, tool, env_vars, tfvars_files, init_flags, plan_flags, terraform_workspace
+		FROM deployment_runs WHERE id = $1
+	`, applyRunID).Scan(&deploymentID, &path, &ref, &commitSHA, &tool, &envVarsJSON, &tfvarsFilesJSON, &initFlags, &planFlags, &workspace)
+	if err != nil {
+		return err
+	}
+
+	runID := uuid.New().String()
+	now := time.Now()
+	_, err = database.DB.Exec(`
+		INSERT INTO deployment_runs (id, deployment_id, path, ref, commit_sha, tool, env_vars, tfvars_files, init_flags, plan_flags,
+		                             terraform_workspace, operation, parent_run_id, approved_by, approved_at, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, 'destroy', $12, 'auto-destroy', $13, 'pending', $13)
+	`, runID, deploymentID, path, ref, commitSHA, tool, envVarsJSON, tfvarsFilesJSON, initFlags, planFlags, workspace, applyRunID, now)
+	if err != nil {
+		return err
+	}
+	if err := build.CopyRunInputs(applyRunID, runID); err != nil {
+		return err
+	}
+
+	var tfvarsFiles []string
+	json.Unmarshal([]byte(tfvarsFilesJSON.String), &tfvarsFiles)
+
+	go build.ExecuteDeploymentRun(runID, deploymentID, path, ref, tool, tfvarsFiles, initFlags.String, planFlags.String, workspace.String)
+	return nil
+}
@@ -0,0 +1,125 @@
+package scheduler
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"iac-tool/internal/cluster"
+	"iac-tool/internal/maintenance"
+	"iac-tool/internal/models"
+)
+
+// autoDestroySchedulePrefix prefixes the deployment ID in the ID of an auto-destroy schedule
+const autoDestroySchedulePrefix = "auto_destroy:"
+
+// ErrScheduleNotFound is returned for an ID that is neither a job nor a deployment with
+// auto_destroy_after
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// Schedules lists the timed work: the scheduler's periodic jobs and the auto-destroy of
+// every deployment with auto_destroy_after
+func Schedules() ([]models.Schedule, error) {
+	schedules, err := jobSchedules()
+	if err != nil {
+		return nil, err
+	}
+	autoDestroys, err := AutoDestroySchedules("")
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range autoDestroys {
+		schedules = append(schedules, autoDestroySchedule(s))
+	}
+	return schedules, nil
+}
+
+// NextOccurrences returns up to count times the schedule is next due. A job recurs every
+// interval from its next run; an auto-destroy has at most one, as the one after it depends
+// on the next apply.
+func NextOccurrences(id string, count int) ([]time.Time, error) {
+	if deploymentID, ok := strings.CutPrefix(id, autoDestroySchedulePrefix); ok {
+		autoDestroys, err := AutoDestroySchedules(deploymentID)
+		if err != nil {
+			return nil, err
+		}
+		if len(autoDestroys) == 0 {
+			return nil, ErrScheduleNotFound
+		}
+		occurrences := []time.Time{}
+		if next := autoDestroys[0].NextRun; next != nil && count > 0 {
+			occurrences = append(occurrences, *next)
+		}
+		return occurrences, nil
+	}
+
+	schedules, err := jobSchedules()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range schedules {
+		if s.ID != id {
+			continue
+		}
+		occurrences := []time.Time{}
+		if s.NextRun == nil {
+			return occurrences, nil
+		}
+		interval := time.Duration(s.IntervalSeconds) * time.Second
+		for i := 0; i < count; i++ {
+			occurrences = append(occurrences, s.NextRun.Add(time.Duration(i)*interval))
+		}
+		return occurrences, nil
+	}
+	return nil, ErrScheduleNotFound
+}
+
+// jobSchedules reports the scheduler's periodic jobs. A job is next due an interval after
+// its last run, or on the next scheduler tick when it never ran or is already due.
+func jobSchedules() ([]models.Schedule, error) {
+	runs, err := cluster.JobRuns()
+	if err != nil {
+		return nil, err
+	}
+	inMaintenance := maintenance.Enabled()
+	now := time.Now()
+
+	var schedules []models.Schedule
+	for _, def := range jobs() {
+		j := runs[def.name]
+		s := models.Schedule{
+			ID:              def.name,
+			Kind:            "job",
+			Description:     def.description,
+			IntervalSeconds: int(def.interval.Seconds()),
+			LastRun:         j.LastRunAt,
+		}
+		switch {
+		case def.interval == 0:
+			s.Status = "disabled"
+		case def.changes && inMaintenance:
+			s.Status = "paused"
+		default:
+			s.Status = jobStatus(j, def.interval)
+			next := now
+			if j.LastRunAt != nil && j.LastRunAt.Add(def.interval).After(now) {
+				next = j.LastRunAt.Add(def.interval)
+			}
+			s.NextRun = &next
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, nil
+}
+
+// autoDestroySchedule reports a deployment's auto-destroy as a schedule
+func autoDestroySchedule(s models.AutoDestroySchedule) models.Schedule {
+	return models.Schedule{
+		ID:          autoDestroySchedulePrefix + s.DeploymentID,
+		Kind:        "auto_destroy",
+		Description: "Destroys " + s.Deployment + " " + s.AutoDestroyAfter + " after its last apply",
+		Status:      s.Status,
+		LastRun:     s.LastRun,
+		NextRun:     s.NextRun,
+	}
+}
@@ -0,0 +1,70 @@
+package scheduler
+
+import (
+	"os"
+	"time"
+
+	"iac-tool/internal/cluster"
+	"iac-tool/internal/maintenance"
+	"iac-tool/internal/models"
+	"iac-tool/internal/notify"
+)
+
+// jobStatus derives the status of a job from its last run. A job is overdue when it has
+// not started for its interval plus two scheduler ticks.
+func jobStatus(j models.BackgroundJob, interval time.Duration) string {
+	switch {
+	case j.LastRunAt == nil:
+		return "idle"
+	case interval > 0 && time.Since(*j.LastRunAt) > interval+2*schedulerInterval():
+		return "overdue"
+	case j.LastFinishedAt == nil || j.LastFinishedAt.Before(*j.LastRunAt):
+		return "running"
+	case j.LastError != nil:
+		return "failing"
+	}
+	return "ok"
+}
+
+// Status reports the background jobs: the scheduler's periodic jobs, the run reconciler
+// every instance runs each tick, and notification webhook deliveries
+func Status() ([]models.BackgroundJob, error) {
+	runs, err := cluster.JobRuns()
+	if err != nil {
+		return nil, err
+	}
+	inMaintenance := maintenance.Enabled()
+
+	var status []models.BackgroundJob
+	for _, def := range jobs() {
+		j := runs[def.name]
+		j.Name, j.Description, j.Trigger = def.name, def.description, "interval"
+		j.IntervalSeconds = int(def.interval.Seconds())
+		switch {
+		case def.interval == 0:
+			j.Status = "disabled"
+		case def.changes && inMaintenance:
+			j.Status = "paused"
+		default:
+			j.Status = jobStatus(j, def.interval)
+		}
+		status = append(status, j)
+	}
+
+	reconciler := runs[reconcilerJob]
+	reconciler.Name, reconciler.Description, reconciler.Trigger = reconcilerJob, "Takes over runs and stacks of instances that went away", "tick"
+	reconciler.IntervalSeconds = int(schedulerInterval().Seconds())
+	reconciler.Status = jobStatus(reconciler, schedulerInterval())
+	status = append(status, reconciler)
+
+	deliveries := runs[notify.DeliveryJob]
+	deliveries.Name, deliveries.Description, deliveries.Trigger = notify.DeliveryJob, "Delivers notifications to NOTIFICATION_WEBHOOK_URL", "event"
+	if os.Getenv("NOTIFICATION_WEBHOOK_URL") == "" {
+		deliveries.Status = "disabled"
+	} else {
+		deliveries.Status = jobStatus(deliveries, 0)
+	}
+	status = append(status, deliveries)
+
+	return status, nil
+}
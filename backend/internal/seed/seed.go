@@ -0,0 +1,282 @@
+// Package seed fills a new installation with demo data (`iac-tool seed`): namespaces,
+// modules with versions, a provider with platforms and a deployment with a run history,
+// so the dashboard has something to show before real content is published. Seeded
+// versions, provider files and repositories do not exist; terraform cannot download them.
+package seed
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"iac-tool/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// DemoNamespace is the public namespace holding most of the demo data. Seeding is skipped
+// when it exists.
+const DemoNamespace = "demo"
+
+// demoGitHost is the (non-existent) host of the demo repositories
+const demoGitHost = "https://git.example.com"
+
+type demoModule struct {
+	namespace, name, provider, description string
+	versions                               []string
+}
+
+var demoModules = []demoModule{
+	{DemoNamespace, "vpc", "aws", "VPC with public and private subnets across availability zones", []string{"1.0.0", "1.1.0", "1.2.1", "2.0.0"}},
+	{DemoNamespace, "storage-account", "azurerm", "Storage account with private endpoints and lifecycle rules", []string{"0.1.0", "0.2.0"}},
+	{DemoNamespace, "gke-cluster", "google", "Private GKE cluster with a managed node pool", []string{"3.0.0", "3.1.0"}},
+	{"platform-team", "eks-cluster", "aws", "Hardened EKS cluster used by the platform team", []string{"5.4.0", "5.5.0-beta.1"}},
+}
+
+// demoPlatforms are the platforms of every demo provider version
+var demoPlatforms = [][2]string{{"linux", "amd64"}, {"linux", "arm64"}, {"darwin", "arm64"}, {"windows", "amd64"}}
+
+// Run seeds the demo data in one transaction. It reports false when the demo namespace
+// already exists and nothing was changed.
+func Run() (bool, error) {
+	var exists bool
+	if err := database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM namespaces WHERE name = $1)`, DemoNamespace).Scan(&exists); err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	namespaces := map[string]string{}
+	for _, ns := range []struct {
+		name, description string
+		public            bool
+	}{
+		{DemoNamespace, "Example modules, providers and deployments created by `iac-tool seed`", true},
+		{"platform-team", "Private modules of the (fictional) platform team", false},
+	} {
+		id := uuid.New().String()
+		_, err := tx.Exec(`
+			INSERT INTO namespaces (id, name, description, is_public, owner_emails, support_contact, links, logo_url, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, '', $8, $8)
+			ON CONFLICT (name) DO NOTHING
+		`, id, ns.name, ns.description, ns.public, `["platform@example.com"]`, "#platform-support", `[]`, now)
+		if err != nil {
+			return false, fmt.Errorf("namespace %s: %w", ns.name, err)
+		}
+		if err := tx.QueryRow(`SELECT id FROM namespaces WHERE name = $1`, ns.name).Scan(&id); err != nil {
+			return false, err
+		}
+		namespaces[ns.name] = id
+	}
+
+	for _, m := range demoModules {
+		if err := seedModule(tx, namespaces[m.namespace], m, now); err != nil {
+			return false, fmt.Errorf("module %s/%s/%s: %w", m.namespace, m.name, m.provider, err)
+		}
+	}
+	if err := seedProvider(tx, namespaces[DemoNamespace], "example", []string{"0.1.0", "0.2.0", "1.0.0"}, now); err != nil {
+		return false, fmt.Errorf("provider %s/example: %w", DemoNamespace, err)
+	}
+	if err := seedDeployment(tx, namespaces[DemoNamespace], now); err != nil {
+		return false, fmt.Errorf("deployment: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	log.Printf("Seeded demo data in namespaces %q and %q", DemoNamespace, "platform-team")
+	return true, nil
+}
+
+// seedModule adds a synced module with one version per entry, a month apart
+func seedModule(tx *sql.Tx, namespaceID string, m demoModule, now time.Time) error {
+	repo := fmt.Sprintf("%s/%s/terraform-%s-%s", demoGitHost, m.namespace, m.provider, m.name)
+	moduleID := uuid.New().String()
+	_, err := tx.Exec(`
+		INSERT INTO modules (id, namespace_id, name, provider, description, source_url, git_url, git_ref, synced, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, 'main', TRUE, $8, $8)
+	`, moduleID, namespaceID, m.name, m.provider, m.description, repo, repo+".git", now)
+	if err != nil {
+		return err
+	}
+
+	for i, version := range m.versions {
+		tagDate := now.AddDate(0, -(len(m.versions) - i), 0)
+		documentation := fmt.Sprintf("# %s\n\n%s.\n\n## Usage\n\n```hcl\nmodule \"%s\" {\n  source  = \"<registry host>/%s/%s/%s\"\n  version = \"%s\"\n}\n```\n",
+			m.name, m.description, m.name, m.namespace, m.name, m.provider, version)
+		_, err := tx.Exec(`
+			INSERT INTO module_versions (id, module_id, version, download_url, documentation, enabled, tag_date, created_at)
+			VALUES ($1, $2, $3, $4, $5, TRUE, $6, $6)
+		`, uuid.New().String(), moduleID, version, "git::"+repo+".git?ref=v"+version, documentation, tagDate)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seedProvider adds a provider with dummy platforms for every version. The files are
+// not created; checksums are derived from the file names.
+func seedProvider(tx *sql.Tx, namespaceID, name string, versions []string, now time.Time) error {
+	providerID := uuid.New().String()
+	_, err := tx.Exec(`
+		INSERT INTO providers (id, namespace_id, name, description, source_url, synced, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, TRUE, $6, $6)
+	`, providerID, namespaceID, name, "Example provider with dummy platform packages",
+		fmt.Sprintf("%s/%s/terraform-provider-%s", demoGitHost, DemoNamespace, name), now)
+	if err != nil {
+		return err
+	}
+
+	for i, version := range versions {
+		versionID := uuid.New().String()
+		tagDate := now.AddDate(0, -(len(versions) - i), 0)
+		_, err := tx.Exec(`
+			INSERT INTO provider_versions (id, provider_id, version, protocols, enabled, tag_date, created_at)
+			VALUES ($1, $2, $3, '["5.0"]', TRUE, $4, $4)
+		`, versionID, providerID, version, tagDate)
+		if err != nil {
+			return err
+		}
+		for _, platform := range demoPlatforms {
+			filename := fmt.Sprintf("terraform-provider-%s_%s_%s_%s.zip", name, version, platform[0], platform[1])
+			sum := sha256.Sum256([]byte(filename))
+			_, err := tx.Exec(`
+				INSERT INTO provider_platforms (id, version_id, os, arch, filename, download_url, shasum)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+			`, uuid.New().String(), versionID, platform[0], platform[1], filename,
+				fmt.Sprintf("/downloads/providers/%s/%s/%s/%s", DemoNamespace, name, version, filename), hex.EncodeToString(sum[:]))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// demoRun is a finished run of the demo deployment
+type demoRun struct {
+	ago       time.Duration
+	status    string
+	operation string
+	errorMsg  string
+	resources []string // addresses created by the run
+}
+
+var demoRuns = []demoRun{
+	{ago: 14 * 24 * time.Hour, status: "success", operation: "apply", resources: []string{"aws_s3_bucket.assets", "aws_s3_bucket_versioning.assets"}},
+	{ago: 9 * 24 * time.Hour, status: "failed", operation: "apply", errorMsg: "Plan failed: exit status 1"},
+	{ago: 7 * 24 * time.Hour, status: "success", operation: "apply", resources: []string{"aws_cloudfront_distribution.cdn"}},
+	{ago: 3 * 24 * time.Hour, status: "cancelled", operation: "apply"},
+	{ago: 26 * time.Hour, status: "success", operation: "apply", resources: []string{"aws_route53_record.www"}},
+}
+
+// seedDeployment adds a deployment with a history of finished runs. Only finished runs
+// are seeded: unfinished ones would be failed by run reconciliation.
+func seedDeployment(tx *sql.Tx, namespaceID string, now time.Time) error {
+	deploymentID := uuid.New().String()
+	_, err := tx.Exec(`
+		INSERT INTO deployments (id, namespace_id, name, description, git_url, git_ref, working_directory, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, 'main', $6, $7, $7)
+	`, deploymentID, namespaceID, "static-website", "Static website on S3 and CloudFront (demo data, the repository does not exist)",
+		demoGitHost+"/"+DemoNamespace+"/infrastructure.git", "environments/dev", now.Add(-15*24*time.Hour))
+	if err != nil {
+		return err
+	}
+
+	for i, r := range demoRuns {
+		started := now.Add(-r.ago)
+		completed := started.Add(3*time.Minute + time.Duration(i*17)*time.Second)
+		commit := sha256.Sum256([]byte(fmt.Sprintf("demo-commit-%d", i)))
+		planLog, applyLog, planJSON, applyReport := demoRunLogs(r)
+		_, err := tx.Exec(`
+			INSERT INTO deployment_runs (id, deployment_id, path, ref, commit_sha, tool, tfvars_files, status, operation,
+			                             plan_log, plan_json, apply_log, apply_report, error_message, approved_by, approved_at,
+			                             started_at, completed_at, created_at)
+			VALUES ($1, $2, 'environments/dev', 'main', $3, 'terraform', '[]', $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $13)
+		`, uuid.New().String(), deploymentID, hex.EncodeToString(commit[:20]), r.status, r.operation,
+			planLog, planJSON, applyLog, applyReport, nullString(r.errorMsg), nullString(approver(r)), approvedAt(r, started),
+			started, completed)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// demoRunLogs returns the plan log, apply log, plan JSON and apply report of a demo run
+func demoRunLogs(r demoRun) (sql.NullString, sql.NullString, sql.NullString, sql.NullString) {
+	if r.status == "failed" {
+		return nullString("Error: Invalid reference\n\n  on main.tf line 12, in resource \"aws_s3_bucket_policy\" \"assets\":\n  12:   bucket = aws_s3_bucket.asset.id\n\nA managed resource \"aws_s3_bucket\" \"asset\" has not been declared in the root module.\n"),
+			sql.NullString{}, sql.NullString{}, sql.NullString{}
+	}
+
+	type change struct {
+		Address string `json:"address"`
+		Mode    string `json:"mode"`
+		Type    string `json:"type"`
+		Name    string `json:"name"`
+		Change  struct {
+			Actions []string `json:"actions"`
+		} `json:"change"`
+	}
+	type result struct {
+		Address        string  `json:"address"`
+		Action         string  `json:"action"`
+		Status         string  `json:"status"`
+		ElapsedSeconds float64 `json:"elapsed_seconds,omitempty"`
+	}
+	var planLog, applyLog string
+	var changes []change
+	var results []result
+	for _, address := range r.resources {
+		var c change
+		c.Address, c.Mode = address, "managed"
+		c.Type, c.Name, _ = strings.Cut(address, ".")
+		c.Change.Actions = []string{"create"}
+		changes = append(changes, c)
+		results = append(results, result{Address: address, Action: "create", Status: "complete", ElapsedSeconds: 4})
+		planLog += fmt.Sprintf("  # %s will be created\n", address)
+		applyLog += fmt.Sprintf("%s: Creation complete after 4s\n", address)
+	}
+	planLog += fmt.Sprintf("\nPlan: %d to add, 0 to change, 0 to destroy.\n", len(r.resources))
+	if r.status != "success" {
+		return nullString(planLog), sql.NullString{}, sql.NullString{}, sql.NullString{}
+	}
+	applyLog += fmt.Sprintf("\nApply complete! Resources: %d added, 0 changed, 0 destroyed.\n", len(r.resources))
+
+	planJSON, _ := json.Marshal(map[string]interface{}{"format_version": "1.2", "resource_changes": changes})
+	applyReport, _ := json.Marshal(results)
+	return nullString(planLog), nullString(applyLog), nullString(string(planJSON)), nullString(string(applyReport))
+}
+
+func approver(r demoRun) string {
+	if r.status == "success" {
+		return "demo-approver"
+	}
+	return ""
+}
+
+func approvedAt(r demoRun, started time.Time) interface{} {
+	if r.status == "success" {
+		return started.Add(90 * time.Second)
+	}
+	return nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
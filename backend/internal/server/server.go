@@ -0,0 +1,230 @@
+// Package server runs the HTTP listener: plain HTTP by default, or HTTPS with a
+// certificate from files or from an ACME CA (Let's Encrypt), with an optional
+// HTTP→HTTPS redirect listener and HSTS. On shutdown it stops accepting connections,
+// ends streaming responses and waits for in-flight requests to finish.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Config is the listener configuration, read from the environment by FromEnv
+type Config struct {
+	Addr string
+
+	// Certificate files (TLS_CERT_FILE, TLS_KEY_FILE)
+	CertFile, KeyFile string
+
+	// ACME (TLS_ACME_DOMAINS, TLS_ACME_EMAIL, TLS_ACME_CACHE_DIR, TLS_ACME_DIRECTORY)
+	ACMEDomains   []string
+	ACMEEmail     string
+	ACMECacheDir  string
+	ACMEDirectory string
+
+	// RedirectAddr serves HTTP→HTTPS redirects (and ACME http-01 challenges) (TLS_REDIRECT_ADDR)
+	RedirectAddr string
+
+	// HSTS (HSTS_MAX_AGE, HSTS_INCLUDE_SUBDOMAINS, HSTS_PRELOAD)
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	// ShutdownTimeout bounds how long in-flight requests may take to finish after a
+	// shutdown signal (SHUTDOWN_TIMEOUT, default 30s)
+	ShutdownTimeout time.Duration
+}
+
+var (
+	shuttingDown     = make(chan struct{})
+	shuttingDownOnce sync.Once
+)
+
+// ShuttingDown is closed when the server starts shutting down. Streaming handlers
+// (server-sent events) end their stream on it, so clients reconnect to another instance
+// instead of holding up the shutdown.
+func ShuttingDown() <-chan struct{} {
+	return shuttingDown
+}
+
+// FromEnv reads the listener configuration for addr
+func FromEnv(addr string) (*Config, error) {
+	cfg := &Config{
+		Addr:                  addr,
+		CertFile:              os.Getenv("TLS_CERT_FILE"),
+		KeyFile:               os.Getenv("TLS_KEY_FILE"),
+		ACMEEmail:             os.Getenv("TLS_ACME_EMAIL"),
+		ACMECacheDir:          os.Getenv("TLS_ACME_CACHE_DIR"),
+		ACMEDirectory:         os.Getenv("TLS_ACME_DIRECTORY"),
+		RedirectAddr:          os.Getenv("TLS_REDIRECT_ADDR"),
+		HSTSIncludeSubdomains: os.Getenv("HSTS_INCLUDE_SUBDOMAINS") == "true",
+		HSTSPreload:           os.Getenv("HSTS_PRELOAD") == "true",
+		ShutdownTimeout:       30 * time.Second,
+	}
+	for _, domain := range strings.Split(os.Getenv("TLS_ACME_DOMAINS"), ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			cfg.ACMEDomains = append(cfg.ACMEDomains, domain)
+		}
+	}
+	if cfg.ACMECacheDir == "" {
+		cfg.ACMECacheDir = "/app/data/autocert"
+	}
+	if maxAge := os.Getenv("HSTS_MAX_AGE"); maxAge != "" {
+		d, err := time.ParseDuration(maxAge)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid HSTS_MAX_AGE %q", maxAge)
+		}
+		cfg.HSTSMaxAge = d
+	}
+	if timeout := os.Getenv("SHUTDOWN_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid SHUTDOWN_TIMEOUT %q", timeout)
+		}
+		cfg.ShutdownTimeout = d
+	}
+
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if cfg.CertFile != "" && len(cfg.ACMEDomains) > 0 {
+		return nil, fmt.Errorf("use either TLS_CERT_FILE/TLS_KEY_FILE or TLS_ACME_DOMAINS, not both")
+	}
+	if !cfg.TLS() && cfg.RedirectAddr != "" {
+		return nil, fmt.Errorf("TLS_REDIRECT_ADDR requires TLS to be configured")
+	}
+	if cfg.HSTSPreload && (cfg.HSTSMaxAge < 365*24*time.Hour || !cfg.HSTSIncludeSubdomains) {
+		return nil, fmt.Errorf("HSTS_PRELOAD requires HSTS_MAX_AGE of at least 8760h and HSTS_INCLUDE_SUBDOMAINS=true")
+	}
+	return cfg, nil
+}
+
+// TLS reports whether the listener serves HTTPS
+func (c *Config) TLS() bool {
+	return c.CertFile != "" || len(c.ACMEDomains) > 0
+}
+
+// Scheme returns "https" or "http"
+func (c *Config) Scheme() string {
+	if c.TLS() {
+		return "https"
+	}
+	return "http"
+}
+
+// HSTS sets Strict-Transport-Security on HTTPS responses when HSTS_MAX_AGE is set
+func (c *Config) HSTS() gin.HandlerFunc {
+	value := "max-age=" + strconv.Itoa(int(c.HSTSMaxAge.Seconds()))
+	if c.HSTSIncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if c.HSTSPreload {
+		value += "; preload"
+	}
+	enabled := c.HSTSMaxAge > 0
+	return func(ctx *gin.Context) {
+		if enabled && ctx.Request.TLS != nil {
+			ctx.Header("Strict-Transport-Security", value)
+		}
+		ctx.Next()
+	}
+}
+
+// ListenAndServe serves handler until the listener fails or ctx is cancelled. It then
+// shuts down gracefully: no new connections are accepted, ShuttingDown is closed and
+// in-flight requests get ShutdownTimeout to finish. A graceful shutdown returns nil.
+func (c *Config) ListenAndServe(ctx context.Context, handler http.Handler) error {
+	srv := &http.Server{Addr: c.Addr, Handler: handler}
+	var redirectSrv *http.Server
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.serve(srv, &redirectSrv)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down: draining in-flight requests (up to %s)", c.ShutdownTimeout)
+	shuttingDownOnce.Do(func() { close(shuttingDown) })
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), c.ShutdownTimeout)
+	defer cancel()
+	if redirectSrv != nil {
+		redirectSrv.Shutdown(shutdownCtx)
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return fmt.Errorf("requests still in flight after %s: %w", c.ShutdownTimeout, err)
+	}
+	if err := <-errs; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// serve runs srv (and the redirect listener, stored in redirectSrv) until it is shut down
+func (c *Config) serve(srv *http.Server, redirectSrv **http.Server) error {
+	if !c.TLS() {
+		return srv.ListenAndServe()
+	}
+
+	srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	var redirect http.Handler = http.HandlerFunc(c.redirectToHTTPS)
+
+	if len(c.ACMEDomains) > 0 {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(c.ACMEDomains...),
+			Cache:      autocert.DirCache(c.ACMECacheDir),
+			Email:      c.ACMEEmail,
+		}
+		if c.ACMEDirectory != "" {
+			manager.Client = &acme.Client{DirectoryURL: c.ACMEDirectory}
+		}
+		srv.TLSConfig.GetCertificate = manager.GetCertificate
+		srv.TLSConfig.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+		redirect = manager.HTTPHandler(redirect)
+		log.Printf("TLS: certificates for %s from ACME (cache %s)", strings.Join(c.ACMEDomains, ", "), c.ACMECacheDir)
+	}
+
+	if c.RedirectAddr != "" {
+		*redirectSrv = &http.Server{Addr: c.RedirectAddr, Handler: redirect}
+		go func(redirectSrv *http.Server) {
+			log.Printf("Redirecting HTTP on %s to HTTPS", c.RedirectAddr)
+			if err := redirectSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("Warning: HTTP redirect listener stopped: %v", err)
+			}
+		}(*redirectSrv)
+	}
+
+	return srv.ListenAndServeTLS(c.CertFile, c.KeyFile)
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL on the HTTPS listener
+func (c *Config) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if _, port, err := net.SplitHostPort(c.Addr); err == nil && port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+}
@@ -0,0 +1,201 @@
+// Package signing authenticates backend↔runner traffic with an HMAC shared secret
+// (RUNNER_SHARED_SECRET) and, optionally, mutual TLS.
+//
+// A request carries X-Signature-Timestamp, X-Signature-Nonce (random, one per request)
+// and X-Signature, the HMAC-SHA256 of
+//
+//	METHOD \n request URI \n timestamp \n nonce \n hex(sha256(body))
+//
+// and is rejected when the timestamp is more than MaxSkew away or the nonce was already
+// used, so identical requests sent within the same second are still accepted. The response carries X-Signature over "response", the request signature,
+// the status code and the body hash, so a response cannot be forged or replayed.
+// Event streams (live logs) are not signed. The runner implements the same scheme.
+package signing
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TimestampHeader = "X-Signature-Timestamp"
+	NonceHeader     = "X-Signature-Nonce"
+	SignatureHeader = "X-Signature"
+	// MaxSkew is how far a request timestamp may be from the receiver's clock
+	MaxSkew = 5 * time.Minute
+)
+
+// Secret returns the shared secret; signing is disabled when it is empty
+func Secret() string {
+	return os.Getenv("RUNNER_SHARED_SECRET")
+}
+
+// sign returns the hex HMAC-SHA256 of the lines joined by newlines
+func sign(secret string, lines ...string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// bodyHash returns the hex SHA-256 of a body
+func bodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// RequestSignature computes the signature of a request
+func RequestSignature(secret, method, requestURI, timestamp, nonce string, body []byte) string {
+	return sign(secret, method, requestURI, timestamp, nonce, bodyHash(body))
+}
+
+// newNonce returns a random request nonce
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ResponseSignature computes the signature of the response to the request signed with requestSignature
+func ResponseSignature(secret, requestSignature string, status int, body []byte) string {
+	return sign(secret, "response", requestSignature, strconv.Itoa(status), bodyHash(body))
+}
+
+// seen remembers the nonces of accepted requests until they would be too old anyway
+var seen = struct {
+	sync.Mutex
+	at map[string]time.Time
+}{at: map[string]time.Time{}}
+
+// VerifyRequest checks the signature headers of a received request. The body must
+// be the full request body.
+func VerifyRequest(secret string, r *http.Request, body []byte) error {
+	timestamp := r.Header.Get(TimestampHeader)
+	nonce := r.Header.Get(NonceHeader)
+	signature := r.Header.Get(SignatureHeader)
+	if timestamp == "" || nonce == "" || signature == "" {
+		return errors.New("request is not signed")
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid signature timestamp")
+	}
+	if skew := time.Since(time.Unix(unix, 0)); skew > MaxSkew || skew < -MaxSkew {
+		return errors.New("signature timestamp is outside the allowed clock skew")
+	}
+	expected := RequestSignature(secret, r.Method, r.URL.RequestURI(), timestamp, nonce, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return errors.New("invalid request signature")
+	}
+
+	seen.Lock()
+	defer seen.Unlock()
+	now := time.Now()
+	for used, at := range seen.at {
+		if now.Sub(at) > 2*MaxSkew {
+			delete(seen.at, used)
+		}
+	}
+	if _, replayed := seen.at[nonce]; replayed {
+		return errors.New("request nonce was already used")
+	}
+	seen.at[nonce] = now
+	return nil
+}
+
+// Transport signs outgoing requests and verifies the signatures of their responses
+type Transport struct {
+	Base   http.RoundTripper
+	Secret string
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.Secret == "" {
+		return t.Base.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := RequestSignature(t.Secret, req.Method, req.URL.RequestURI(), timestamp, nonce, body)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(NonceHeader, nonce)
+	req.Header.Set(SignatureHeader, signature)
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil || strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return resp, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	expected := ResponseSignature(t.Secret, signature, resp.StatusCode, respBody)
+	if !hmac.Equal([]byte(resp.Header.Get(SignatureHeader)), []byte(expected)) {
+		return nil, fmt.Errorf("response from %s has no valid signature", req.URL.Host)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	return resp, nil
+}
+
+// TLSConfig returns the client TLS configuration for calls to the runner: the CA in
+// RUNNER_TLS_CA verifies the runner, and RUNNER_TLS_CERT/RUNNER_TLS_KEY is presented as
+// the client certificate. It returns nil when none of them are set.
+func TLSConfig() (*tls.Config, error) {
+	caFile, certFile, keyFile := os.Getenv("RUNNER_TLS_CA"), os.Getenv("RUNNER_TLS_CERT"), os.Getenv("RUNNER_TLS_KEY")
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading RUNNER_TLS_CA: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("RUNNER_TLS_CA contains no PEM certificates")
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading RUNNER_TLS_CERT/RUNNER_TLS_KEY: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
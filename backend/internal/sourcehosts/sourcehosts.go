@@ -0,0 +1,98 @@
+// Package sourcehosts enforces the admin-managed allowlist of hosts that git repositories
+// and mirrored provider artifacts may come from, so that modules, providers and
+// deployments cannot be pointed at arbitrary servers. A kind without entries allows any
+// host.
+package sourcehosts
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"iac-tool/internal/database"
+)
+
+// Kinds of allowlisted hosts
+const (
+	KindGit      = "git"      // module, provider and deployment repositories
+	KindArtifact = "artifact" // upstream registries and downloads of mirrored providers
+)
+
+// patternRegex matches a hostname, optionally prefixed with "." or "*." for all its
+// subdomains
+var patternRegex = regexp.MustCompile(`^(\*?\.)?[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+
+// NormalizePattern lower-cases a pattern and checks its syntax
+func NormalizePattern(pattern string) (string, error) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if !patternRegex.MatchString(pattern) {
+		return "", fmt.Errorf("pattern must be a hostname, or .domain / *.domain for its subdomains")
+	}
+	return pattern, nil
+}
+
+// Patterns returns the allowlisted patterns of a kind, none when any host is allowed
+func Patterns(kind string) ([]string, error) {
+	rows, err := database.Reader().Query(`SELECT pattern FROM source_hosts WHERE kind = $1 ORDER BY pattern`, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var patterns []string
+	for rows.Next() {
+		var pattern string
+		if err := rows.Scan(&pattern); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, rows.Err()
+}
+
+// Match reports whether host matches one of the patterns; ".corp.com" and "*.corp.com"
+// match corp.com and all its subdomains
+func Match(host string, patterns []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range patterns {
+		if suffix := strings.TrimPrefix(pattern, "*"); strings.HasPrefix(suffix, ".") {
+			if strings.HasSuffix(host, suffix) || host == suffix[1:] {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// NotAllowedError is returned for a URL whose host is not allowlisted
+type NotAllowedError struct {
+	Kind string
+	Host string
+}
+
+func (e *NotAllowedError) Error() string {
+	return fmt.Sprintf("host %q is not in the %s source allowlist", e.Host, e.Kind)
+}
+
+// Check returns a *NotAllowedError when the allowlist of kind is not empty and the host
+// of rawURL does not match it
+func Check(kind, rawURL string) error {
+	patterns, err := Patterns(kind)
+	if err != nil {
+		return fmt.Errorf("failed to read the %s source allowlist: %w", kind, err)
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" {
+		return &NotAllowedError{Kind: kind, Host: rawURL}
+	}
+	if !Match(parsed.Hostname(), patterns) {
+		return &NotAllowedError{Kind: kind, Host: parsed.Hostname()}
+	}
+	return nil
+}
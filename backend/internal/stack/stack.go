@@ -0,0 +1,291 @@
+package stack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"iac-tool/internal/models"
+)
+
+// DefaultConfigFile is the stack file read when a stack run lists no paths
+const DefaultConfigFile = "stack.yaml"
+
+// RunState is the run started for one path of a stack
+type RunState struct {
+	ID          string
+	Status      string
+	StartedAt   *time.Time
+	CompletedAt *time.Time
+}
+
+// Clean trims "./" prefixes and trailing slashes so paths and dependencies compare equal
+func Clean(paths []models.StackPath) []models.StackPath {
+	clean := func(p string) string {
+		p = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(p), "./"), "/")
+		if p == "" {
+			return "."
+		}
+		return p
+	}
+
+	cleaned := make([]models.StackPath, len(paths))
+	for i, p := range paths {
+		cleaned[i] = models.StackPath{Path: clean(p.Path), DependsOn: make([]string, len(p.DependsOn))}
+		for j, dep := range p.DependsOn {
+			cleaned[i].DependsOn[j] = clean(dep)
+		}
+	}
+	return cleaned
+}
+
+// Validate checks that the paths stay inside the repository, are listed once, only
+// depend on listed paths and have no dependency cycles
+func Validate(paths []models.StackPath) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("a stack needs at least one path")
+	}
+
+	seen := map[string]bool{}
+	for _, p := range paths {
+		if strings.HasPrefix(p.Path, "/") || strings.HasPrefix(p.Path, "-") {
+			return fmt.Errorf("stack path %q must be relative to the repository root", p.Path)
+		}
+		for _, part := range strings.Split(p.Path, "/") {
+			if part == ".." {
+				return fmt.Errorf("stack path %q must not contain '..'", p.Path)
+			}
+		}
+		if seen[p.Path] {
+			return fmt.Errorf("stack path %q is listed more than once", p.Path)
+		}
+		seen[p.Path] = true
+	}
+	for _, p := range paths {
+		for _, dep := range p.DependsOn {
+			if !seen[dep] {
+				return fmt.Errorf("stack path %q depends on %q, which is not part of the stack", p.Path, dep)
+			}
+			if dep == p.Path {
+				return fmt.Errorf("stack path %q depends on itself", p.Path)
+			}
+		}
+	}
+
+	if _, err := levels(paths, false); err != nil {
+		return err
+	}
+	return nil
+}
+
+// prerequisites maps every path to the paths that must succeed before it starts.
+// Destroy runs reverse the dependencies: a path is destroyed after its dependents.
+func prerequisites(paths []models.StackPath, destroy bool) map[string][]string {
+	prereq := make(map[string][]string, len(paths))
+	for _, p := range paths {
+		if _, ok := prereq[p.Path]; !ok {
+			prereq[p.Path] = nil
+		}
+		for _, dep := range p.DependsOn {
+			if destroy {
+				prereq[dep] = append(prereq[dep], p.Path)
+			} else {
+				prereq[p.Path] = append(prereq[p.Path], dep)
+			}
+		}
+	}
+	return prereq
+}
+
+// levels assigns every path its depth in execution order: paths without prerequisites
+// are level 0, every other path one more than its deepest prerequisite
+func levels(paths []models.StackPath, destroy bool) (map[string]int, error) {
+	prereq := prerequisites(paths, destroy)
+	level := make(map[string]int, len(paths))
+	for len(level) < len(paths) {
+		progress := false
+		for _, p := range paths {
+			if _, done := level[p.Path]; done {
+				continue
+			}
+			depth, ready := 0, true
+			for _, dep := range prereq[p.Path] {
+				l, ok := level[dep]
+				if !ok {
+					ready = false
+					break
+				}
+				if l+1 > depth {
+					depth = l + 1
+				}
+			}
+			if ready {
+				level[p.Path] = depth
+				progress = true
+			}
+		}
+		if !progress {
+			var cycle []string
+			for _, p := range paths {
+				if _, done := level[p.Path]; !done {
+					cycle = append(cycle, p.Path)
+				}
+			}
+			return nil, fmt.Errorf("stack paths have a dependency cycle: %s", strings.Join(cycle, ", "))
+		}
+	}
+	return level, nil
+}
+
+// Graph returns the execution edges and the paths grouped by level
+func Graph(paths []models.StackPath, destroy bool) ([]models.StackEdge, [][]string) {
+	edges := []models.StackEdge{}
+	prereq := prerequisites(paths, destroy)
+	for _, p := range paths {
+		for _, from := range prereq[p.Path] {
+			edges = append(edges, models.StackEdge{From: from, To: p.Path})
+		}
+	}
+
+	level, err := levels(paths, destroy)
+	if err != nil {
+		return edges, [][]string{}
+	}
+	grouped := [][]string{}
+	for _, p := range paths {
+		l := level[p.Path]
+		for len(grouped) <= l {
+			grouped = append(grouped, []string{})
+		}
+		grouped[l] = append(grouped[l], p.Path)
+	}
+	for _, g := range grouped {
+		sort.Strings(g)
+	}
+	return edges, grouped
+}
+
+// IsFinished reports whether a run status is final
+func IsFinished(status string) bool {
+	switch status {
+	case "success", "failed", "cancelled", "stale", "expired":
+		return true
+	}
+	return false
+}
+
+// Nodes combines the stack's paths with the runs started for them. Paths without a run
+// are "waiting", or "skipped" when a prerequisite failed or was skipped.
+func Nodes(paths []models.StackPath, runs map[string]RunState, destroy bool) []models.StackNode {
+	prereq := prerequisites(paths, destroy)
+	level, _ := levels(paths, destroy)
+
+	status := map[string]string{}
+	var resolve func(path string) string
+	resolve = func(path string) string {
+		if s, ok := status[path]; ok {
+			return s
+		}
+		s := "waiting"
+		if run, ok := runs[path]; ok {
+			s = run.Status
+		} else {
+			for _, dep := range prereq[path] {
+				if d := resolve(dep); d == "skipped" || (IsFinished(d) && d != "success") {
+					s = "skipped"
+					break
+				}
+			}
+		}
+		status[path] = s
+		return s
+	}
+
+	nodes := make([]models.StackNode, 0, len(paths))
+	for _, p := range paths {
+		node := models.StackNode{
+			Path:      p.Path,
+			DependsOn: p.DependsOn,
+			Level:     level[p.Path],
+			Status:    resolve(p.Path),
+		}
+		if node.DependsOn == nil {
+			node.DependsOn = []string{}
+		}
+		if run, ok := runs[p.Path]; ok {
+			runID := run.ID
+			node.RunID = &runID
+			node.StartedAt = run.StartedAt
+			node.CompletedAt = run.CompletedAt
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// Ready returns the waiting paths whose prerequisites have all succeeded
+func Ready(paths []models.StackPath, nodes []models.StackNode, destroy bool) []string {
+	prereq := prerequisites(paths, destroy)
+	status := make(map[string]string, len(nodes))
+	for _, n := range nodes {
+		status[n.Path] = n.Status
+	}
+
+	var ready []string
+	for _, n := range nodes {
+		if n.Status != "waiting" {
+			continue
+		}
+		ok := true
+		for _, dep := range prereq[n.Path] {
+			if status[dep] != "success" {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			ready = append(ready, n.Path)
+		}
+	}
+	return ready
+}
+
+// Status aggregates the node statuses: "awaiting_approval" while any run waits for
+// approval, "running" while any run is active or paths can still start, and otherwise
+// "success" if every path succeeded or "failed"
+func Status(nodes []models.StackNode) string {
+	active, awaiting, waiting, succeeded := false, false, false, 0
+	for _, n := range nodes {
+		switch {
+		case n.Status == "awaiting_approval":
+			awaiting = true
+		case n.Status == "waiting":
+			waiting = true
+		case n.Status == "success":
+			succeeded++
+		case n.Status != "skipped" && !IsFinished(n.Status):
+			active = true
+		}
+	}
+
+	switch {
+	case awaiting:
+		return "awaiting_approval"
+	case active || waiting:
+		return "running"
+	case succeeded == len(nodes):
+		return "success"
+	default:
+		return "failed"
+	}
+}
+
+// Counts returns the number of paths per node status
+func Counts(nodes []models.StackNode) map[string]int {
+	counts := map[string]int{}
+	for _, n := range nodes {
+		counts[n.Status]++
+	}
+	return counts
+}
@@ -0,0 +1,115 @@
+package tfconfig
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Feature is a language feature a configuration uses that not every tool or version
+// supports, with the lowest version of each tool that does
+type Feature struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+	File        string `json:"file"`                // First file, by name, using it
+	Terraform   string `json:"terraform,omitempty"` // Empty: terraform does not support it
+	Tofu        string `json:"tofu,omitempty"`      // Empty: tofu does not support it
+}
+
+// featureCheck detects a feature in a top-level statement of a file
+type featureCheck struct {
+	Feature
+	match func(file, stmt string) bool
+}
+
+var (
+	terraformBlockPattern = regexp.MustCompile(`^terraform\s*\{`)
+	encryptionPattern     = regexp.MustCompile(`(?m)^\s*encryption\s*\{`)
+	backendPattern        = regexp.MustCompile(`(?m)^\s*backend\s+"[^"]*"\s*\{`)
+	moduleBlockPattern    = regexp.MustCompile(`^module\s+"[^"]+"\s*\{`)
+	moduleSourcePattern   = regexp.MustCompile(`(?m)^\s*(source|version)\s*=.*\b(var|local)\.`)
+	referencePattern      = regexp.MustCompile(`\b(var|local)\.`)
+	importBlockPattern    = regexp.MustCompile(`^import\s*\{`)
+	forEachPattern        = regexp.MustCompile(`(?m)^\s*for_each\s*=`)
+	removedBlockPattern   = regexp.MustCompile(`^removed\s*\{`)
+	checkBlockPattern     = regexp.MustCompile(`^check\s+"[^"]+"\s*\{`)
+	ephemeralPattern      = regexp.MustCompile(`^ephemeral\s+"[^"]+"\s+"[^"]+"\s*\{`)
+	providerFuncPattern   = regexp.MustCompile(`\bprovider::[A-Za-z0-9_-]+::`)
+)
+
+// featureChecks are the features Features detects. OpenTofu's first release is 1.6.0, so
+// features terraform had before are supported from then on.
+var featureChecks = []featureCheck{
+	{Feature{Key: "state_encryption", Description: "state and plan encryption (terraform { encryption })", Tofu: "1.7.0"},
+		func(_, stmt string) bool {
+			return terraformBlockPattern.MatchString(stmt) && encryptionPattern.MatchString(stmt)
+		}},
+	{Feature{Key: "tofu_files", Description: ".tofu files", Tofu: "1.8.0"},
+		func(file, _ string) bool { return strings.HasSuffix(file, ".tofu") }},
+	{Feature{Key: "early_evaluation", Description: "variables or locals in a backend block or a module source or version", Tofu: "1.8.0"},
+		func(_, stmt string) bool {
+			if terraformBlockPattern.MatchString(stmt) {
+				if loc := backendPattern.FindStringIndex(stmt); loc != nil {
+					return referencePattern.MatchString(blockBody(stmt, loc[1]-1))
+				}
+			}
+			return moduleBlockPattern.MatchString(stmt) && moduleSourcePattern.MatchString(stmt)
+		}},
+	{Feature{Key: "provider_functions", Description: "provider-defined functions (provider::<name>::<function>)", Terraform: "1.8.0", Tofu: "1.7.0"},
+		func(_, stmt string) bool { return providerFuncPattern.MatchString(stmt) }},
+	{Feature{Key: "removed_block", Description: "removed blocks", Terraform: "1.7.0", Tofu: "1.7.0"},
+		func(_, stmt string) bool { return removedBlockPattern.MatchString(stmt) }},
+	{Feature{Key: "import_for_each", Description: "for_each in import blocks", Terraform: "1.7.0", Tofu: "1.7.0"},
+		func(_, stmt string) bool {
+			return importBlockPattern.MatchString(stmt) && forEachPattern.MatchString(stmt)
+		}},
+	{Feature{Key: "import_block", Description: "import blocks", Terraform: "1.5.0", Tofu: "1.6.0"},
+		func(_, stmt string) bool { return importBlockPattern.MatchString(stmt) }},
+	{Feature{Key: "check_block", Description: "check blocks", Terraform: "1.5.0", Tofu: "1.6.0"},
+		func(_, stmt string) bool { return checkBlockPattern.MatchString(stmt) }},
+	{Feature{Key: "ephemeral_resources", Description: "ephemeral resources", Terraform: "1.10.0", Tofu: "1.11.0"},
+		func(_, stmt string) bool { return ephemeralPattern.MatchString(stmt) }},
+}
+
+// Features returns the version-dependent language features used in files (file name to
+// content, .tf and .tofu), in the order of featureChecks
+func Features(files map[string]string) []Feature {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	features := []Feature{}
+	for _, check := range featureChecks {
+	search:
+		for _, name := range names {
+			for _, stmt := range statements(files[name]) {
+				if check.match(name, stmt) {
+					feature := check.Feature
+					feature.File = name
+					features = append(features, feature)
+					break search
+				}
+			}
+		}
+	}
+	return features
+}
+
+// blockBody returns the block of src opening at the brace at open, braces included
+func blockBody(src string, open int) string {
+	depth := 0
+	for i := open; i < len(src); i++ {
+		switch src[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return src[open : i+1]
+			}
+		}
+	}
+	return src[open:]
+}
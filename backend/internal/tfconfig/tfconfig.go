@@ -0,0 +1,200 @@
+// Package tfconfig reads the input variables of a terraform module from its .tf files,
+// the values .tfvars files assign to them, and the language features it uses that need a
+// particular tool or version.
+//
+// It is not a full HCL parser: it splits the files into top-level statements (skipping
+// comments, strings and heredocs), picks the variable blocks and keeps the source text
+// of their type and default expressions.
+package tfconfig
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	variablePattern  = regexp.MustCompile(`^variable\s+"([^"]+)"\s*\{`)
+	attributePattern = regexp.MustCompile(`(?s)^([A-Za-z_][A-Za-z0-9_-]*)\s*=\s*(.*)$`)
+	heredocPattern   = regexp.MustCompile(`^<<-?([A-Za-z_][A-Za-z0-9_]*)[ \t]*\n`)
+)
+
+// Variable is an input variable of a module
+type Variable struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`    // Type expression as written, e.g. list(string)
+	Default     string `json:"default,omitempty"` // Default expression as written
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required"` // No default
+	Sensitive   bool   `json:"sensitive,omitempty"`
+	File        string `json:"file"`
+}
+
+// Variables returns the variables declared in files (file name to content), sorted by name
+func Variables(files map[string]string) []Variable {
+	variables := []Variable{}
+	for file, content := range files {
+		for _, stmt := range statements(content) {
+			match := variablePattern.FindStringSubmatch(stmt)
+			end := strings.LastIndex(stmt, "}")
+			if match == nil || end < len(match[0]) {
+				continue
+			}
+			variable := Variable{Name: match[1], Required: true, File: file}
+			for _, attr := range statements(stmt[len(match[0]):end]) {
+				m := attributePattern.FindStringSubmatch(attr)
+				if m == nil {
+					continue // Nested block, e.g. validation
+				}
+				value := strings.TrimSpace(m[2])
+				switch m[1] {
+				case "type":
+					variable.Type = value
+				case "default":
+					variable.Default = value
+					variable.Required = false
+				case "description":
+					variable.Description = stringValue(value)
+				case "sensitive":
+					variable.Sensitive = value == "true"
+				}
+			}
+			variables = append(variables, variable)
+		}
+	}
+	sort.Slice(variables, func(i, j int) bool { return variables[i].Name < variables[j].Name })
+	return variables
+}
+
+// Assignments returns the top-level attributes of a .tfvars file, variable name to the
+// source text of its value
+func Assignments(content string) map[string]string {
+	values := map[string]string{}
+	for _, stmt := range statements(content) {
+		if m := attributePattern.FindStringSubmatch(stmt); m != nil {
+			values[m[1]] = strings.TrimSpace(m[2])
+		}
+	}
+	return values
+}
+
+// Placeholder returns a value of the variable's type to fill in: an empty string, 0,
+// false, an empty collection, or null when the type is unknown
+func (v Variable) Placeholder() string {
+	t := strings.ReplaceAll(v.Type, " ", "")
+	switch {
+	case t == "string":
+		return `""`
+	case t == "number":
+		return "0"
+	case t == "bool":
+		return "false"
+	case strings.HasPrefix(t, "list("), strings.HasPrefix(t, "set("), strings.HasPrefix(t, "tuple("):
+		return "[]"
+	case strings.HasPrefix(t, "map("), strings.HasPrefix(t, "object("):
+		return "{}"
+	default:
+		return "null"
+	}
+}
+
+// stringValue returns the text of a quoted string or heredoc, or the expression as is
+func stringValue(expr string) string {
+	if s, err := strconv.Unquote(expr); err == nil {
+		return s
+	}
+	if m := heredocPattern.FindStringSubmatch(expr); m != nil {
+		body := strings.TrimPrefix(expr, m[0])
+		if i := strings.LastIndex(body, "\n"); i >= 0 {
+			body = body[:i]
+		}
+		if strings.HasPrefix(expr, "<<-") {
+			// Indented heredoc: terraform strips the common indentation
+			lines := strings.Split(body, "\n")
+			for i, line := range lines {
+				lines[i] = strings.TrimSpace(line)
+			}
+			body = strings.Join(lines, "\n")
+		}
+		return strings.TrimSpace(body)
+	}
+	return expr
+}
+
+// statements splits HCL source into top-level statements: an attribute or a block,
+// each ending at a newline outside brackets, strings and heredocs. Comments are dropped.
+func statements(src string) []string {
+	var stmts []string
+	var current strings.Builder
+	depth := 0
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(src); i++ {
+		ch := src[i]
+		switch {
+		case ch == '#' || (ch == '/' && i+1 < len(src) && src[i+1] == '/'):
+			for i+1 < len(src) && src[i+1] != '\n' {
+				i++
+			}
+		case ch == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += end + 3
+			}
+		case ch == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' && src[j] != '\n' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				j = len(src) - 1
+			}
+			current.WriteString(src[i : j+1])
+			i = j
+		case ch == '<' && heredocPattern.MatchString(src[i:]):
+			m := heredocPattern.FindStringSubmatch(src[i:])
+			j := i + len(m[0])
+			for j < len(src) {
+				lineEnd := strings.IndexByte(src[j:], '\n')
+				if lineEnd < 0 {
+					lineEnd = len(src) - j
+				}
+				line := src[j : j+lineEnd]
+				j += lineEnd
+				if strings.TrimSpace(line) == m[1] {
+					break
+				}
+				j++
+			}
+			if j > len(src) {
+				j = len(src)
+			}
+			current.WriteString(src[i:j])
+			i = j - 1
+		case ch == '{' || ch == '[' || ch == '(':
+			depth++
+			current.WriteByte(ch)
+		case ch == '}' || ch == ']' || ch == ')':
+			depth--
+			current.WriteByte(ch)
+		case ch == '\n' && depth <= 0:
+			depth = 0
+			flush()
+		default:
+			current.WriteByte(ch)
+		}
+	}
+	flush()
+	return stmts
+}
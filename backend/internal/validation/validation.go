@@ -0,0 +1,267 @@
+// Package validation checks request payloads. Register adds custom validators for
+// registry names (Terraform's address grammar), environment variable names and paths
+// within a repository to gin's binding, and Errors turns binding errors into
+// field-level messages a client can show next to the offending input.
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	// Namespaces are shared by modules and providers, so they follow the stricter provider
+	// namespace rule: letters, digits and dashes, not at either end
+	namespacePattern = regexp.MustCompile(`^[0-9A-Za-z](?:[0-9A-Za-z-]{0,62}[0-9A-Za-z])?$`)
+	// Module names may also contain underscores
+	moduleNamePattern = regexp.MustCompile(`^[0-9A-Za-z](?:[0-9A-Za-z_-]{0,62}[0-9A-Za-z])?$`)
+	// The provider (target system) of a module is a single lowercase word
+	moduleProviderPattern = regexp.MustCompile(`^[0-9a-z]{1,64}$`)
+	// Provider types are lowercase letters, digits and dashes, not at either end
+	providerNamePattern = regexp.MustCompile(`^[0-9a-z](?:[0-9a-z-]{0,62}[0-9a-z])?$`)
+	envVarNamePattern   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// rule is a custom validator and the message shown when a value fails it
+type rule struct {
+	valid   func(string) bool
+	message string
+}
+
+var rules = map[string]rule{
+	"tf_namespace": {
+		valid:   namespacePattern.MatchString,
+		message: "must be 1-64 letters, digits or dashes, starting and ending with a letter or digit",
+	},
+	"tf_module_name": {
+		valid:   moduleNamePattern.MatchString,
+		message: "must be 1-64 letters, digits, dashes or underscores, starting and ending with a letter or digit",
+	},
+	"tf_module_provider": {
+		valid:   moduleProviderPattern.MatchString,
+		message: "must be 1-64 lowercase letters or digits (e.g. aws)",
+	},
+	"tf_provider_name": {
+		valid:   providerNamePattern.MatchString,
+		message: "must be 1-64 lowercase letters, digits or dashes, starting and ending with a letter or digit",
+	},
+	"env_var_name": {
+		valid:   envVarNamePattern.MatchString,
+		message: "must be a valid environment variable name (letters, digits and underscores, not starting with a digit)",
+	},
+	"relpath": {
+		valid:   ValidRelativePath,
+		message: "must be a path relative to the repository root without '..' segments",
+	},
+}
+
+// ValidNamespace reports whether name is a valid namespace name
+func ValidNamespace(name string) bool { return namespacePattern.MatchString(name) }
+
+// ValidModuleName reports whether name is a valid module name
+func ValidModuleName(name string) bool { return moduleNamePattern.MatchString(name) }
+
+// ValidModuleProvider reports whether name is a valid module provider (target system)
+func ValidModuleProvider(name string) bool { return moduleProviderPattern.MatchString(name) }
+
+// ValidProviderName reports whether name is a valid provider type name
+func ValidProviderName(name string) bool { return providerNamePattern.MatchString(name) }
+
+// ValidRelativePath reports whether p stays within the directory it is relative to: it is
+// not absolute, has no '..' segments, control characters or backslashes, and cannot be
+// mistaken for a command-line flag
+func ValidRelativePath(p string) bool {
+	if strings.HasPrefix(p, "/") || strings.HasPrefix(p, "-") || strings.ContainsAny(p, "\\") {
+		return false
+	}
+	for _, r := range p {
+		if r < 0x20 || r == 0x7f {
+			return false
+		}
+	}
+	for _, part := range strings.Split(p, "/") {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// platforms are the os/arch pairs providers are published for: the targets Terraform and
+// OpenTofu release binaries for. Values outside this list end up in file names and
+// download URLs, so they are rejected rather than stored.
+var platforms = map[string][]string{
+	"darwin":  {"amd64", "arm64"},
+	"freebsd": {"386", "amd64", "arm", "arm64"},
+	"linux":   {"386", "amd64", "arm", "arm64"},
+	"openbsd": {"386", "amd64"},
+	"solaris": {"amd64"},
+	"windows": {"386", "amd64", "arm64"},
+}
+
+// ValidPlatform reports whether os/arch is a supported provider platform
+func ValidPlatform(os, arch string) bool {
+	for _, a := range platforms[os] {
+		if a == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportedPlatforms lists the supported provider platforms as "os_arch", sorted
+func SupportedPlatforms() []string {
+	var list []string
+	for os, archs := range platforms {
+		for _, arch := range archs {
+			list = append(list, os+"_"+arch)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+// PlatformMessage explains why a platform was rejected
+func PlatformMessage(os, arch string) string {
+	return fmt.Sprintf("unsupported platform %s_%s; supported platforms are %s", os, arch, strings.Join(SupportedPlatforms(), ", "))
+}
+
+// Message returns the message for a failed custom validator tag
+func Message(tag string) string {
+	return rules[tag].message
+}
+
+// Register adds the custom validators to gin's binding and makes errors name fields by
+// their JSON names. Call it once before serving requests.
+func Register() error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return fmt.Errorf("unexpected validator engine %T", binding.Validator.Engine())
+	}
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	for tag, r := range rules {
+		valid := r.valid
+		err := v.RegisterValidation(tag, func(fl validator.FieldLevel) bool {
+			return valid(fl.Field().String())
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FieldError describes why one field of a request was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors translates an error from binding a JSON request into field-level errors
+func Errors(err error) []FieldError {
+	var validationErrors validator.ValidationErrors
+	var typeError *json.UnmarshalTypeError
+	var syntaxError *json.SyntaxError
+
+	switch {
+	case errors.As(err, &validationErrors):
+		fields := make([]FieldError, 0, len(validationErrors))
+		for _, fe := range validationErrors {
+			fields = append(fields, FieldError{Field: fieldPath(fe.Namespace()), Message: message(fe)})
+		}
+		return fields
+	case errors.As(err, &typeError):
+		return []FieldError{{Field: typeError.Field, Message: "must be " + jsonType(typeError.Type)}}
+	case errors.As(err, &syntaxError):
+		return []FieldError{{Message: fmt.Sprintf("request body is not valid JSON (at byte %d)", syntaxError.Offset)}}
+	case errors.Is(err, io.EOF):
+		return []FieldError{{Message: "request body is empty"}}
+	}
+	return []FieldError{{Message: err.Error()}}
+}
+
+// Summary joins field errors into one line, e.g. for the "error" key of a response
+func Summary(fields []FieldError) string {
+	parts := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f.Field == "" {
+			parts = append(parts, f.Message)
+		} else {
+			parts = append(parts, f.Field+": "+f.Message)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// fieldPath drops the struct name from a validator namespace ("RunCreate.env_vars[A B]")
+func fieldPath(namespace string) string {
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+// message describes a failed validation tag
+func message(fe validator.FieldError) string {
+	if r, ok := rules[fe.Tag()]; ok {
+		return r.message
+	}
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "max":
+		if fe.Kind() == reflect.String {
+			return "must be at most " + fe.Param() + " characters"
+		}
+		return "must have at most " + fe.Param() + " entries"
+	case "min":
+		if fe.Kind() == reflect.String {
+			return "must be at least " + fe.Param() + " characters"
+		}
+		return "must have at least " + fe.Param() + " entries"
+	case "email":
+		return "must be an email address"
+	case "url", "http_url":
+		return "must be a URL"
+	}
+	return "is invalid (" + fe.Tag() + ")"
+}
+
+// jsonType names the JSON type a Go type is decoded from
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return "a " + t.String()
+}
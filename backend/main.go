@@ -1,17 +1,25 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	_ "time/tzdata" // ?tz= of the schedule endpoints works without zoneinfo in the image
 
 	"iac-tool/internal/api"
+	"iac-tool/internal/build"
+	"iac-tool/internal/cluster"
 	"iac-tool/internal/crypto"
 	"iac-tool/internal/database"
 	"iac-tool/internal/gpg"
+	"iac-tool/internal/outbound"
 	"iac-tool/internal/registry"
-
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
+	"iac-tool/internal/scheduler"
+	"iac-tool/internal/seed"
+	"iac-tool/internal/server"
+	"iac-tool/internal/validation"
 )
 
 func main() {
@@ -26,16 +34,46 @@ func main() {
 	}
 	log.Println("✓ Registry authentication token initialized")
 
+	// Custom validators used by request bindings (registry names, env var names, paths)
+	if err := validation.Register(); err != nil {
+		log.Fatalf("Failed to register request validators: %v", err)
+	}
+
+	// Custom CA bundle for calls to git servers and upstream registries
+	if err := outbound.Validate(); err != nil {
+		log.Fatalf("Invalid outbound configuration: %v", err)
+	}
+
 	// Initialize database
 	if err := database.Init(); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	// `iac-tool seed` adds demo data for new installations and exits
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		seeded, err := seed.Run()
+		if err != nil {
+			log.Fatalf("Failed to seed demo data: %v", err)
+		}
+		if !seeded {
+			log.Printf("Namespace %q already exists; demo data was not seeded again", seed.DemoNamespace)
+		}
+		return
+	}
+
 	// Initialize runner API key (create if doesn't exist)
 	if err := api.InitRunnerAPIKey(); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	// Encrypt env vars stored before they were encrypted at rest
+	if err := api.EncryptLegacyEnvVars(); err != nil {
+		log.Fatalf("Failed to encrypt stored env vars: %v", err)
+	}
+	if err := build.EncryptLegacyRunArtifacts(); err != nil {
+		log.Fatalf("Failed to encrypt stored run artifacts: %v", err)
+	}
+
 	// Initialize GPG for signing providers
 	if err := gpg.Init(); err != nil {
 		log.Printf("Warning: GPG initialization failed: %v", err)
@@ -44,158 +82,50 @@ func main() {
 		log.Printf("GPG initialized with key ID: %s", gpg.GetKeyID())
 	}
 
-	r := gin.Default()
-
-	// CORS configuration
-	config := cors.DefaultConfig()
-
-	// Get host and ports from environment
-	frontendHost := os.Getenv("FRONTEND_HOST")
-	if frontendHost == "" {
-		frontendHost = "localhost"
-	}
-	frontendPort := os.Getenv("FRONTEND_PORT")
-	if frontendPort == "" {
-		frontendPort = "3000"
-	}
-	viteDevPort := os.Getenv("VITE_DEV_PORT")
-	if viteDevPort == "" {
-		viteDevPort = "5173"
-	}
+	// Start background jobs (auto-destroy, ...)
+	scheduler.Start()
 
-	config.AllowOrigins = []string{
-		"http://" + frontendHost + ":" + frontendPort,
-		"http://" + frontendHost + ":" + viteDevPort,
-		"*",
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "9080"
 	}
-	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key"}
-	r.Use(cors.New(config))
-
-	// =========================================================================
-	// Terraform Service Discovery (/.well-known/terraform.json)
-	// =========================================================================
-	r.GET("/.well-known/terraform.json", api.ServiceDiscovery)
-
-	// =========================================================================
-	// Static file downloads (provider binaries)
-	// =========================================================================
-	buildDir := os.Getenv("BUILD_DIR")
-	if buildDir == "" {
-		buildDir = "/app/data/builds"
+	listener, err := server.FromEnv(":" + port)
+	if err != nil {
+		log.Fatalf("Invalid server configuration: %v", err)
 	}
-	r.Static("/downloads", buildDir)
-
-	// SHA256SUMS and signature endpoints for provider verification
-	r.GET("/shasums/providers/:namespace/:name/:version", api.GetProviderSHASums)
-	r.GET("/shasums/providers/:namespace/:name/:version/sig", api.GetProviderSHASumsSig)
-
-	// =========================================================================
-	// Terraform Registry Protocol v1 (for terraform init/get)
-	// These endpoints require API key authentication for Terraform CLI
-	// =========================================================================
-	v1 := r.Group("/v1")
-	v1.Use(api.TerraformAuthMiddleware()) // Only checks auth for Terraform protocol
-	{
-		// Module Registry Protocol
-		modules := v1.Group("/modules")
-		{
-			modules.GET("/:namespace/:name/:provider/versions", api.TFListModuleVersions)
-			modules.GET("/:namespace/:name/:provider/:version/download", api.TFDownloadModule)
-		}
 
-		// Provider Registry Protocol
-		providers := v1.Group("/providers")
-		{
-			providers.GET("/:namespace/:name/versions", api.TFListProviderVersions)
-			providers.GET("/:namespace/:name/:version/download/:os/:arch", api.TFDownloadProvider)
-		}
+	r, err := newRouter(listener.HSTS())
+	if err != nil {
+		log.Fatalf("Failed to build router: %v", err)
 	}
 
-	// =========================================================================
-	// Management API (for frontend) - NO AUTHENTICATION REQUIRED
-	// =========================================================================
-	apiGroup := r.Group("/api")
-	{
-		// Modules
-		apiGroup.GET("/modules", api.GetModules)
-		apiGroup.GET("/modules/:id", api.GetModule)
-		apiGroup.GET("/modules/:id/versions", api.GetModuleVersions)
-		apiGroup.GET("/modules/:id/git-tags", api.GetModuleGitTags)
-		apiGroup.GET("/modules/:id/readme", api.GetModuleReadme)
-		apiGroup.POST("/modules", api.CreateModuleFromGit)
-		apiGroup.PUT("/modules/:id", api.UpdateModule)
-		apiGroup.DELETE("/modules/:id", api.DeleteModuleByID)
-		apiGroup.POST("/modules/:id/sync-tags", api.SyncModuleTags)
-		apiGroup.POST("/modules/:id/versions", api.AddModuleVersion)
-		apiGroup.PATCH("/modules/:id/versions/:versionId", api.ToggleModuleVersion)
-		apiGroup.DELETE("/modules/:id/versions/:versionId", api.DeleteModuleVersionByID)
-
-		// Providers
-		apiGroup.GET("/providers", api.GetProviders)
-		apiGroup.GET("/providers/:id", api.GetProvider)
-		apiGroup.GET("/providers/:id/versions", api.GetProviderVersions)
-		apiGroup.GET("/providers/:id/git-tags", api.GetProviderGitTags)
-		apiGroup.GET("/providers/:id/readme", api.GetProviderReadme)
-		apiGroup.POST("/providers", api.CreateProviderFromGit)
-		apiGroup.DELETE("/providers/:id", api.DeleteProviderByID)
-		apiGroup.POST("/providers/:id/sync-tags", api.SyncProviderTags)
-		apiGroup.POST("/providers/:id/versions", api.AddProviderVersion)
-		apiGroup.PATCH("/providers/:id/versions/:versionId", api.ToggleProviderVersion)
-		apiGroup.DELETE("/providers/:id/versions/:versionId", api.DeleteProviderVersionByID)
-		apiGroup.GET("/providers/:id/versions/:versionId/platforms", api.GetProviderPlatforms)
-		apiGroup.POST("/providers/:id/versions/:versionId/platforms", api.AddProviderPlatform)
-		apiGroup.DELETE("/providers/:id/versions/:versionId/platforms/:platformId", api.DeleteProviderPlatform)
-		apiGroup.POST("/providers/:id/versions/:versionId/platforms/upload", api.UploadProviderPlatform)
-
-		// Namespaces
-		apiGroup.GET("/namespaces", api.GetNamespaces)
-		apiGroup.GET("/namespaces/:id", api.GetNamespace)
-		apiGroup.POST("/namespaces", api.CreateNamespace)
-		apiGroup.PATCH("/namespaces/:id", api.UpdateNamespace)
-		apiGroup.DELETE("/namespaces/:id", api.DeleteNamespace)
-
-		// API Keys (global, for Terraform CLI access to all namespaces)
-		apiGroup.GET("/api-keys", api.GetAPIKeys)
-		apiGroup.POST("/api-keys", api.CreateAPIKey)
-		apiGroup.DELETE("/api-keys/:keyId", api.DeleteAPIKey)
-
-		// Deployments
-		apiGroup.GET("/deployments", api.ListDeployments)
-		apiGroup.GET("/deployments/:id", api.GetDeployment)
-		apiGroup.POST("/deployments", api.CreateDeployment)
-		apiGroup.DELETE("/deployments/:id", api.DeleteDeployment)
-		apiGroup.GET("/deployments/:id/references", api.GetDeploymentReferences)
-		apiGroup.GET("/deployments/:id/browse", api.GetDeploymentDirectory)
-		apiGroup.GET("/deployments/:id/tfvars", api.GetTfvarsFiles)
-		apiGroup.POST("/deployments/:id/runs", api.CreateDeploymentRun)
-		apiGroup.GET("/deployments/:id/runs", api.ListDeploymentRuns)
-		apiGroup.GET("/deployments/:id/runs/:runId", api.GetDeploymentRun)
-		apiGroup.GET("/deployments/:id/runs/:runId/stream", api.StreamDeploymentRunLogs)
-		apiGroup.POST("/deployments/:id/runs/:runId/approve", api.ApproveDeploymentRun)
-		apiGroup.POST("/deployments/:id/runs/:runId/cancel", api.CancelDeploymentRun)
-		apiGroup.DELETE("/deployments/:id/runs/:runId", api.DeleteDeploymentRun)
-		apiGroup.GET("/deployments/:id/status", api.GetDirectoryStatus)
-
-		// Internal registry token endpoint (for runner)
-		apiGroup.GET("/internal/registry-token", api.GetRegistryToken)
-	}
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "9080"
-	}
 	registryHost := os.Getenv("REGISTRY_HOST")
 	if registryHost == "" {
 		registryHost = "localhost"
 	}
 
-	log.Printf("Terraform Private Registry starting on :%s\n", port)
-	log.Printf("Service discovery: http://%s:%s/.well-known/terraform.json\n", registryHost, port)
-	log.Printf("Module registry:   http://%s:%s/v1/modules/\n", registryHost, port)
-	log.Printf("Provider registry: http://%s:%s/v1/providers/\n", registryHost, port)
-	log.Printf("Management API:    http://%s:%s/api/\n", registryHost, port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	scheme := listener.Scheme()
+	log.Printf("Terraform Private Registry starting on :%s (%s)\n", port, scheme)
+	log.Printf("Service discovery: %s://%s:%s/.well-known/terraform.json\n", scheme, registryHost, port)
+	log.Printf("Module registry:   %s://%s:%s/v1/modules/\n", scheme, registryHost, port)
+	log.Printf("Provider registry: %s://%s:%s/v1/providers/\n", scheme, registryHost, port)
+	log.Printf("Management API:    %s://%s:%s/api/\n", scheme, registryHost, port)
+
+	// SIGTERM (or Ctrl-C) drains the server: in-flight requests finish, event streams end,
+	// the scheduler stops and runs and stacks this instance follows are handed over
+	ctx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+	if err := listener.ListenAndServe(ctx, r); err != nil {
+		if ctx.Err() == nil {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+		log.Printf("Warning: %v", err)
 	}
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), listener.ShutdownTimeout)
+	defer cancel()
+	scheduler.Stop(drainCtx)
+	cluster.Drain(drainCtx)
+	database.DB.Close()
+	log.Printf("Shutdown complete")
 }
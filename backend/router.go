@@ -0,0 +1,351 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"iac-shared/cors"
+	"iac-tool/internal/api"
+	"iac-tool/internal/features"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newRouter builds the HTTP router: Terraform protocol, downloads and the management
+// API. middleware runs before every route (main passes the listener's HSTS handler).
+// Configuration errors are returned instead of exiting so tests can build the router.
+func newRouter(middleware ...gin.HandlerFunc) (*gin.Engine, error) {
+	r := gin.Default()
+
+	// Client IPs (lockouts, alerts, rate limits) come from X-Forwarded-For only when the
+	// peer is one of TRUSTED_PROXIES; by default no proxy is trusted and the peer address is used
+	var trustedProxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+
+	r.Use(middleware...)
+
+	// CORS: the dashboard origins (ALLOWED_ORIGINS, defaulting to the frontend's) may call
+	// the management API; Terraform protocol, download and internal routes are not for browsers
+	frontendHost := os.Getenv("FRONTEND_HOST")
+	if frontendHost == "" {
+		frontendHost = "localhost"
+	}
+	frontendPort := os.Getenv("FRONTEND_PORT")
+	if frontendPort == "" {
+		frontendPort = "3000"
+	}
+	viteDevPort := os.Getenv("VITE_DEV_PORT")
+	if viteDevPort == "" {
+		viteDevPort = "5173"
+	}
+
+	dashboardCORS, err := cors.FromEnv(
+		[]string{
+			"http://" + frontendHost + ":" + frontendPort,
+			"http://" + frontendHost + ":" + viteDevPort,
+		},
+		[]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		[]string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "Idempotency-Key", "X-CSRF-Token"},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CORS configuration: %w", err)
+	}
+	r.Use(cors.Middleware(dashboardCORS,
+		cors.Route{Prefix: "/v1/"},
+		cors.Route{Prefix: "/.well-known/"},
+		cors.Route{Prefix: "/downloads/"},
+		cors.Route{Prefix: "/blobs/"},
+		cors.Route{Prefix: "/shasums/"},
+		cors.Route{Prefix: "/api/internal/"},
+	))
+
+	// =========================================================================
+	// Terraform Service Discovery (/.well-known/terraform.json)
+	// =========================================================================
+	r.GET("/.well-known/terraform.json", api.ServiceDiscovery)
+
+	// =========================================================================
+	// Static file downloads (provider binaries)
+	// =========================================================================
+	buildDir := os.Getenv("BUILD_DIR")
+	if buildDir == "" {
+		buildDir = "/app/data/builds"
+	}
+	r.Static("/downloads", buildDir)
+	r.GET("/blobs/sha256/:digest", api.DownloadBlob)
+
+	// SHA256SUMS and signature endpoints for provider verification
+	r.GET("/shasums/providers/:namespace/:name/:version", api.GetProviderSHASums)
+	r.GET("/shasums/providers/:namespace/:name/:version/sig", api.GetProviderSHASumsSig)
+
+	// =========================================================================
+	// Terraform Registry Protocol v1 (for terraform init/get)
+	// These endpoints require API key authentication for Terraform CLI
+	// =========================================================================
+	v1 := r.Group("/v1")
+	v1.Use(api.TerraformAuthMiddleware()) // Only checks auth for Terraform protocol
+	{
+		// Module Registry Protocol
+		modules := v1.Group("/modules")
+		{
+			modules.GET("/:namespace/:name/:provider/versions", api.TFListModuleVersions)
+			modules.GET("/:namespace/:name/:provider/:version/download", api.TFDownloadModule)
+		}
+
+		// Provider Registry Protocol
+		providers := v1.Group("/providers")
+		{
+			providers.GET("/:namespace/:name/versions", api.TFListProviderVersions)
+			providers.GET("/:namespace/:name/:version/download/:os/:arch", api.TFDownloadProvider)
+		}
+	}
+
+	// =========================================================================
+	// Management API (for frontend) - NO AUTHENTICATION REQUIRED
+	// =========================================================================
+	internalNetwork, err := api.RequireInternalNetwork()
+	if err != nil {
+		return nil, fmt.Errorf("invalid internal network configuration: %w", err)
+	}
+
+	// Request body limits (MAX_JSON_BODY_SIZE, MAX_UPLOAD_SIZE)
+	bodyLimit, err := api.LimitRequestBody()
+	if err != nil {
+		return nil, fmt.Errorf("invalid request body limits: %w", err)
+	}
+
+	apiGroup := r.Group("/api", bodyLimit, api.RequireCSRFToken(), api.RejectDuringMaintenance())
+	{
+		// Frontend sessions (cookie + CSRF token in place of an API key)
+		apiGroup.POST("/auth/session", api.CreateSession)
+		apiGroup.GET("/auth/session", api.GetSession)
+		apiGroup.POST("/auth/session/refresh", api.RefreshSession)
+		apiGroup.DELETE("/auth/session", api.DeleteSession)
+
+		// Modules
+		apiGroup.GET("/modules", api.GetModules)
+		apiGroup.GET("/modules/:id", api.GetModule)
+		apiGroup.GET("/modules/:id/versions", api.GetModuleVersions)
+		apiGroup.GET("/modules/:id/git-tags", api.GetModuleGitTags)
+		apiGroup.GET("/modules/:id/readme", api.GetModuleReadme)
+		apiGroup.GET("/modules/:id/usage", api.GetModuleUsage)
+		apiGroup.GET("/modules/:id/upgrade-report", api.GetModuleUpgradeReport)
+		apiGroup.GET("/modules/:id/versions/:versionId/examples", api.GetModuleVersionExamples)
+		apiGroup.POST("/modules", api.CreateModuleFromGit)
+		apiGroup.PUT("/modules/:id", api.UpdateModule)
+		apiGroup.DELETE("/modules/:id", api.DeleteModuleByID)
+		apiGroup.POST("/modules/:id/transfer", api.RequireRole("admin"), api.TransferModule)
+		apiGroup.GET("/modules/:id/aliases", api.GetModuleAliases)
+		apiGroup.POST("/modules/:id/aliases", api.RequireRole("admin"), api.CreateModuleAlias)
+		apiGroup.DELETE("/modules/:id/aliases/:aliasId", api.RequireRole("admin"), api.DeleteModuleAlias)
+		apiGroup.POST("/modules/:id/sync-tags", api.SyncModuleTags)
+		apiGroup.GET("/modules/:id/auto-enable", api.GetModuleAutoEnableRule)
+		apiGroup.PUT("/modules/:id/auto-enable", api.SetModuleAutoEnableRule)
+		apiGroup.DELETE("/modules/:id/auto-enable", api.DeleteModuleAutoEnableRule)
+		apiGroup.POST("/modules/:id/versions", api.AddModuleVersion)
+		apiGroup.PATCH("/modules/:id/versions/:versionId", api.ToggleModuleVersion)
+		apiGroup.DELETE("/modules/:id/versions/:versionId", api.DeleteModuleVersionByID)
+		apiGroup.PUT("/modules/:id/versions/:versionId/deprecation", api.DeprecateModuleVersion)
+		apiGroup.DELETE("/modules/:id/versions/:versionId/deprecation", api.UndeprecateModuleVersion)
+
+		// Providers
+		apiGroup.GET("/providers", api.GetProviders)
+		apiGroup.GET("/providers/:id", api.GetProvider)
+		apiGroup.GET("/providers/:id/versions", api.GetProviderVersions)
+		apiGroup.GET("/providers/:id/stats", api.GetProviderInstallStats)
+		apiGroup.GET("/providers/:id/git-tags", api.GetProviderGitTags)
+		apiGroup.GET("/providers/:id/readme", api.GetProviderReadme)
+		apiGroup.POST("/providers", api.CreateProviderFromGit)
+		apiGroup.DELETE("/providers/:id", api.DeleteProviderByID)
+		apiGroup.POST("/providers/:id/transfer", api.RequireRole("admin"), api.TransferProvider)
+		apiGroup.POST("/providers/:id/sync-tags", api.SyncProviderTags)
+		apiGroup.GET("/providers/:id/auto-enable", api.GetProviderAutoEnableRule)
+		apiGroup.PUT("/providers/:id/auto-enable", api.SetProviderAutoEnableRule)
+		apiGroup.DELETE("/providers/:id/auto-enable", api.DeleteProviderAutoEnableRule)
+		apiGroup.POST("/providers/:id/versions", api.AddProviderVersion)
+		apiGroup.PATCH("/providers/:id/versions/:versionId", api.ToggleProviderVersion)
+		apiGroup.DELETE("/providers/:id/versions/:versionId", api.DeleteProviderVersionByID)
+		apiGroup.PUT("/providers/:id/versions/:versionId/deprecation", api.DeprecateProviderVersion)
+		apiGroup.DELETE("/providers/:id/versions/:versionId/deprecation", api.UndeprecateProviderVersion)
+		apiGroup.GET("/providers/:id/versions/:versionId/platforms", api.GetProviderPlatforms)
+		apiGroup.POST("/providers/:id/versions/:versionId/platforms", api.AddProviderPlatform)
+		apiGroup.DELETE("/providers/:id/versions/:versionId/platforms/:platformId", api.DeleteProviderPlatform)
+		apiGroup.POST("/providers/:id/versions/:versionId/platforms/upload", api.UploadProviderPlatform)
+		apiGroup.GET("/providers/:id/channels", api.GetProviderChannels)
+		apiGroup.GET("/providers/:id/channels/:channel", api.GetProviderChannel)
+		apiGroup.PUT("/providers/:id/channels/:channel", api.SetProviderChannel)
+		apiGroup.DELETE("/providers/:id/channels/:channel", api.DeleteProviderChannel)
+		apiGroup.POST("/providers/:id/versions/:versionId/builds", api.StartProviderBuild)
+		apiGroup.GET("/providers/:id/build-toolchain", api.GetProviderBuildToolchain)
+		apiGroup.PUT("/providers/:id/build-toolchain", api.SetProviderBuildToolchain)
+		apiGroup.DELETE("/providers/:id/build-toolchain", api.DeleteProviderBuildToolchain)
+		apiGroup.POST("/providers/:id/versions/:versionId/import-release", api.ImportProviderRelease)
+		apiGroup.GET("/providers/:id/builds", api.GetProviderBuilds)
+		apiGroup.GET("/providers/:id/builds/:buildId", api.GetProviderBuild)
+		apiGroup.GET("/providers/:id/builds/:buildId/stream", api.StreamProviderBuildLogs)
+		apiGroup.POST("/providers/:id/builds/:buildId/retry", api.RetryProviderBuild)
+		apiGroup.GET("/providers/:id/builds/:buildId/provenance/:os/:arch", api.GetProviderBuildProvenance)
+		apiGroup.GET("/providers/:id/builds/:buildId/provenance/:os/:arch/signature", api.GetProviderBuildProvenanceSignature)
+
+		// Provider mirrors (upstream providers copied on a schedule), behind the network_mirror
+		// feature flag; listing and creating check it per namespace
+		mirrorFeature := api.RequireFeatureFor(features.NetworkMirror, api.ProviderMirrorNamespace)
+		apiGroup.GET("/provider-mirrors", api.GetProviderMirrors)
+		apiGroup.GET("/provider-mirrors/:id", mirrorFeature, api.GetProviderMirror)
+		apiGroup.POST("/provider-mirrors", api.CreateProviderMirror)
+		apiGroup.PATCH("/provider-mirrors/:id", mirrorFeature, api.UpdateProviderMirror)
+		apiGroup.DELETE("/provider-mirrors/:id", mirrorFeature, api.DeleteProviderMirror)
+		apiGroup.POST("/provider-mirrors/:id/sync", mirrorFeature, api.SyncProviderMirror)
+
+		// Organizations (groups of namespaces with shared settings and quotas)
+		apiGroup.GET("/organizations", api.GetOrganizations)
+		apiGroup.GET("/organizations/:id", api.GetOrganization)
+		apiGroup.POST("/organizations", api.RequireRole("admin"), api.CreateOrganization)
+		apiGroup.PATCH("/organizations/:id", api.RequireRole("admin"), api.UpdateOrganization)
+		apiGroup.DELETE("/organizations/:id", api.RequireRole("admin"), api.DeleteOrganization)
+
+		// Namespaces
+		apiGroup.GET("/namespaces", api.GetNamespaces)
+		apiGroup.GET("/namespaces/:id", api.GetNamespace)
+		apiGroup.GET("/namespaces/:id/contacts", api.GetNamespaceContacts)
+		apiGroup.POST("/namespaces", api.CreateNamespace)
+		apiGroup.PATCH("/namespaces/:id", api.UpdateNamespace)
+		apiGroup.DELETE("/namespaces/:id", api.DeleteNamespace)
+		apiGroup.GET("/namespaces/:id/storage", api.GetNamespaceStorage)
+		apiGroup.PUT("/namespaces/:id/storage-quota", api.RequireRole("admin"), api.SetNamespaceStorageQuota)
+		apiGroup.GET("/namespaces/:id/runners", api.GetNamespaceRunners)
+		apiGroup.GET("/namespaces/:id/env-defaults", api.GetNamespaceEnvDefaults)
+		apiGroup.PUT("/namespaces/:id/env-defaults", api.RequireRole("admin"), api.SetNamespaceEnvDefaults)
+		apiGroup.PUT("/namespaces/:id/runners", api.RequireRole("admin"), api.SetNamespaceRunners)
+
+		// API Keys (global, for Terraform CLI access to all namespaces)
+		apiGroup.GET("/api-keys", api.GetAPIKeys)
+		apiGroup.POST("/api-keys", api.CreateAPIKey) // Admin, except for the first key (see CreateAPIKey)
+		apiGroup.DELETE("/api-keys/:keyId", api.RequireRole("admin"), api.DeleteAPIKey)
+
+		// Terraform CLI onboarding (credentials for the caller's key)
+		apiGroup.GET("/setup/cli", api.RequireRole("read"), api.GetCLISetup)
+
+		// Deployments
+		apiGroup.GET("/deployments", api.ListDeployments)
+		apiGroup.GET("/deployments/:id", api.GetDeployment)
+		apiGroup.POST("/deployments", api.CreateDeployment)
+		apiGroup.POST("/deployments/changes", api.DetectDeploymentChanges)
+		apiGroup.PATCH("/deployments/:id", api.UpdateDeployment)
+		apiGroup.DELETE("/deployments/:id", api.DeleteDeployment)
+		apiGroup.POST("/deployments/:id/clone", api.CloneDeployment)
+		apiGroup.GET("/deployments/:id/references", api.GetDeploymentReferences)
+		apiGroup.GET("/deployments/:id/dependencies", api.GetDeploymentDependencies)
+		apiGroup.GET("/deployments/:id/outputs", api.RequireRole("read"), api.GetDeploymentOutputs)
+		apiGroup.GET("/deployments/:id/browse", api.GetDeploymentDirectory)
+		apiGroup.GET("/deployments/:id/tfvars", api.GetTfvarsFiles)
+		apiGroup.POST("/deployments/:id/runs", api.CreateDeploymentRun)
+		apiGroup.GET("/deployments/:id/runs", api.ListDeploymentRuns)
+		apiGroup.GET("/deployments/:id/runs/:runId", api.GetDeploymentRun)
+		apiGroup.GET("/deployments/:id/runs/:runId/stream", api.RequireRole("read"), api.StreamDeploymentRunLogs)
+		apiGroup.GET("/deployments/:id/runs/:runId/logs", api.RequireRole("read"), api.GetDeploymentRunLogs)
+		apiGroup.GET("/deployments/:id/runs/:runId/logs/download", api.RequireRole("read"), api.DownloadDeploymentRunLogs)
+		apiGroup.GET("/deployments/:id/runs/:runId/apply-report", api.GetDeploymentRunApplyReport)
+		apiGroup.GET("/deployments/:id/runs/:runId/changes", api.GetDeploymentRunChanges)
+		apiGroup.GET("/deployments/:id/runs/:runId/stages", api.GetDeploymentRunStages)
+		apiGroup.GET("/deployments/:id/runs/:runId/inputs", api.GetDeploymentRunInputs)
+		apiGroup.GET("/deployments/:id/runs/:runId/env-vars", api.RequireRole("admin"), api.RevealRunEnvVars)
+		apiGroup.POST("/deployments/:id/runs/:runId/import", api.ImportDeploymentRunResources)
+		apiGroup.POST("/deployments/:id/runs/:runId/state/mv", api.RequireRole("approver"), api.MoveDeploymentRunState)
+		apiGroup.POST("/deployments/:id/runs/:runId/state/rm", api.RequireRole("approver"), api.RemoveDeploymentRunState)
+		apiGroup.POST("/deployments/:id/runs/:runId/force-unlock", api.RequireRole("approver"), api.ForceUnlockDeploymentRunState)
+		apiGroup.POST("/deployments/:id/runs/:runId/approve", api.RequireRole("approver"), api.ApproveDeploymentRun)
+		apiGroup.POST("/deployments/:id/runs/:runId/cancel", api.CancelDeploymentRun)
+		apiGroup.POST("/deployments/:id/runs/:runId/replan", api.ReplanDeploymentRun)
+		apiGroup.GET("/deployments/:id/runs/:runId/manifest", api.GetDeploymentRunManifest)
+		apiGroup.POST("/deployments/:id/runs/:runId/reproduce", api.ReproduceDeploymentRun)
+		apiGroup.POST("/deployments/:id/runs/:runId/retry", api.RetryDeploymentRun)
+		apiGroup.DELETE("/deployments/:id/runs/:runId", api.DeleteDeploymentRun)
+		apiGroup.GET("/deployments/:id/status", api.GetDirectoryStatus)
+		apiGroup.GET("/deployments/:id/auto-destroy", api.GetAutoDestroySchedule)
+		apiGroup.GET("/auto-destroy", api.ListAutoDestroySchedules)
+		apiGroup.GET("/schedules", api.ListSchedules)
+		apiGroup.GET("/schedules/:id/next-occurrences", api.GetScheduleOccurrences)
+		apiGroup.GET("/runs", api.SearchRuns)
+		apiGroup.POST("/deployments/:id/stacks", api.CreateStackRun)
+		apiGroup.GET("/deployments/:id/stacks", api.ListStackRuns)
+		apiGroup.GET("/deployments/:id/stacks/:stackId", api.GetStackRun)
+		apiGroup.POST("/deployments/:id/stacks/:stackId/cancel", api.CancelStackRun)
+
+		// Deployment templates (standard deployment settings managed by admins)
+		apiGroup.GET("/deployment-templates", api.GetDeploymentTemplates)
+		apiGroup.GET("/deployment-templates/:id", api.GetDeploymentTemplate)
+		apiGroup.POST("/deployment-templates", api.RequireRole("admin"), api.CreateDeploymentTemplate)
+		apiGroup.PATCH("/deployment-templates/:id", api.RequireRole("admin"), api.UpdateDeploymentTemplate)
+		apiGroup.DELETE("/deployment-templates/:id", api.RequireRole("admin"), api.DeleteDeploymentTemplate)
+		apiGroup.POST("/deployment-templates/:id/deployments", api.CreateDeploymentFromTemplate)
+
+		// Announcements
+		apiGroup.GET("/announcements", api.GetAnnouncements)
+		apiGroup.GET("/announcements/:id", api.GetAnnouncement)
+		apiGroup.POST("/announcements", api.RequireRole("admin"), api.CreateAnnouncement)
+		apiGroup.PATCH("/announcements/:id", api.RequireRole("admin"), api.UpdateAnnouncement)
+		apiGroup.DELETE("/announcements/:id", api.RequireRole("admin"), api.DeleteAnnouncement)
+
+		// Inbox of the calling API key
+		apiGroup.GET("/inbox", api.RequireRole("read"), api.GetInbox)
+		apiGroup.POST("/inbox/read", api.RequireRole("read"), api.MarkInboxRead)
+		apiGroup.POST("/inbox/read-all", api.RequireRole("read"), api.MarkInboxAllRead)
+
+		// Activity digests
+		apiGroup.GET("/digest", api.GetDigest)
+		apiGroup.GET("/digest-subscriptions", api.GetDigestSubscriptions)
+		apiGroup.POST("/digest-subscriptions", api.CreateDigestSubscription)
+		apiGroup.DELETE("/digest-subscriptions/:id", api.DeleteDigestSubscription)
+
+		// Git credential health
+		apiGroup.GET("/credentials", api.GetCredentialHealth)
+		apiGroup.POST("/credentials/check", api.CheckAllCredentials)
+		apiGroup.POST("/credentials/:type/:id/check", api.CheckCredential)
+		apiGroup.PUT("/credentials/:type/:id", api.SetCredentialExpiry)
+
+		// Administration
+		apiGroup.GET("/maintenance", api.GetMaintenanceMode)
+		apiGroup.GET("/features", api.GetFeatures)
+		apiGroup.GET("/admin/flags", api.RequireRole("admin"), api.GetFeatureFlags)
+		apiGroup.PUT("/admin/flags/:key", api.RequireRole("admin"), api.UpdateFeatureFlag)
+		apiGroup.DELETE("/admin/flags/:key", api.RequireRole("admin"), api.ResetFeatureFlag)
+		apiGroup.PUT("/admin/maintenance", api.RequireRole("admin"), api.SetMaintenanceMode)
+		apiGroup.GET("/admin/gc", api.RequireRole("admin"), api.GetArtifactGCReport)
+		apiGroup.GET("/admin/jobs", api.RequireRole("admin"), api.GetBackgroundJobs)
+		apiGroup.GET("/admin/env-defaults", api.RequireRole("admin"), api.GetPlatformEnvDefaults)
+		apiGroup.PUT("/admin/env-defaults", api.RequireRole("admin"), api.SetPlatformEnvDefaults)
+		apiGroup.GET("/admin/dead-letters", api.RequireRole("admin"), api.GetDeadLetters)
+		apiGroup.POST("/admin/dead-letters/:id/redeliver", api.RequireRole("admin"), api.RedeliverDeadLetter)
+		apiGroup.POST("/admin/gc", api.RequireRole("admin"), api.RunArtifactGC)
+		apiGroup.GET("/admin/registry-cache", api.RequireRole("admin"), api.GetRegistryCacheStats)
+		apiGroup.DELETE("/admin/registry-cache", api.RequireRole("admin"), api.FlushRegistryCache)
+		apiGroup.GET("/admin/replica", api.RequireRole("admin"), api.GetReplicaStatus)
+		apiGroup.GET("/admin/runner", api.RequireRole("admin"), api.GetRunnerStatus)
+		apiGroup.GET("/admin/audit-events", api.RequireRole("admin"), api.GetAuditEvents)
+		apiGroup.GET("/admin/security-alerts", api.RequireRole("admin"), api.GetSecurityAlerts)
+		apiGroup.POST("/admin/security-alerts/:id/acknowledge", api.RequireRole("admin"), api.AcknowledgeSecurityAlert)
+		apiGroup.GET("/admin/auth-lockouts", api.RequireRole("admin"), api.GetAuthLockouts)
+		apiGroup.DELETE("/admin/auth-lockouts/:subject", api.RequireRole("admin"), api.ClearAuthLockout)
+		apiGroup.GET("/admin/source-hosts", api.RequireRole("admin"), api.GetSourceHosts)
+		apiGroup.POST("/admin/source-hosts", api.RequireRole("admin"), api.CreateSourceHost)
+		apiGroup.DELETE("/admin/source-hosts/:id", api.RequireRole("admin"), api.DeleteSourceHost)
+
+		// Internal endpoints (for the runner): internal networks only, signed when
+		// RUNNER_SHARED_SECRET is set
+		internal := apiGroup.Group("/internal", internalNetwork, api.RequireRunnerSignature())
+		{
+			internal.GET("/registry-token", api.GetRegistryToken)
+		}
+	}
+
+	return r, nil
+}
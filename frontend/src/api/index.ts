@@ -2,24 +2,73 @@ import axios from 'axios';
 import type {
   Namespace,
   NamespaceCreate,
+  NamespaceContacts,
+  NamespaceStorage,
+  NamespaceRunners,
+  NamespaceRunnerAssignment,
+  EnvDefaults,
+  Organization,
+  OrganizationCreate,
   APIKey,
   APIKeyCreate,
   Module,
+  ModuleAlias,
   ModuleCreate,
   ModuleFromGitCreate,
+  TfvarsListing,
+  RunManifest,
+  RunLogs,
+  LogFormat,
+  RunSummary,
+  RunSearchParams,
+  VersionAutoEnableRule,
+  VersionDeprecation,
   ModuleVersion,
+  ModuleReadme,
+  ModuleExample,
+  ModuleUsage,
+  ModuleUpgradeReport,
   GitTag,
   Provider,
   ProviderFromGitCreate,
   ProviderVersion,
+  ProviderInstallStats,
   ProviderPlatform,
   ProviderPlatformCreate,
+  ProviderReleaseImport,
+  ProviderReleaseImportCreate,
+  ProviderMirror,
+  ProviderMirrorCreate,
   Deployment,
   DeploymentCreate,
+  DeploymentClone,
+  DeploymentOutputs,
+  DeploymentTemplate,
+  DeploymentTemplateCreate,
+  DeploymentFromTemplate,
   GitReference,
   DirectoryListing,
   DeploymentRun,
-  DirectoryStatus
+  DirectoryStatus,
+  Announcement,
+  AnnouncementCreate,
+  AnnouncementUpdate,
+  Digest,
+  DigestFrequency,
+  DigestSubscription,
+  DigestSubscriptionCreate,
+  Inbox,
+  AuditEvent,
+  Session,
+  SecurityAlert,
+  AuthLockout,
+  RegistryCacheStats,
+  MaintenanceState,
+  BackgroundJob,
+  DeadLetter,
+  FeatureFlag,
+  SourceHost,
+  CLISetup
 } from '../types';
 
 // Use environment variable for API base URL, fallback to relative path
@@ -27,10 +76,49 @@ const apiBaseUrl = import.meta.env.VITE_API_BASE_URL || '/api';
 
 const api = axios.create({
   baseURL: apiBaseUrl,
+  // Send the session cookie (cross-origin setups need CORS_ALLOW_CREDENTIALS on the backend)
+  withCredentials: true,
 });
 
-// No authentication needed for management API
-// API keys are only required for Terraform protocol endpoints
+// Most of the management API is open. Protected endpoints accept an API key or the
+// session cookie; with a session, changing requests must carry its CSRF token.
+let csrfToken: string | null = null;
+
+api.interceptors.request.use(config => {
+  const method = (config.method || 'get').toLowerCase();
+  if (csrfToken && !['get', 'head', 'options'].includes(method)) {
+    config.headers.set('X-CSRF-Token', csrfToken);
+  }
+  return config;
+});
+
+const rememberSession = (session: Session) => {
+  csrfToken = session.csrf_token;
+  return session;
+};
+
+// Session API (log in with an API key once; the cookie stands in for it)
+export const authApi = {
+  login: (apiKey: string) =>
+    api.post<Session>('/auth/session', { api_key: apiKey }).then(res => rememberSession(res.data)),
+  getSession: () => api.get<Session>('/auth/session').then(res => rememberSession(res.data)),
+  refresh: () => api.post<Session>('/auth/session/refresh').then(res => rememberSession(res.data)),
+  logout: () => api.delete('/auth/session').then(res => {
+    csrfToken = null;
+    return res.data;
+  }),
+  // Terraform CLI credentials snippets for the logged-in key
+  getCLISetup: () => api.get<CLISetup>('/setup/cli').then(res => res.data),
+};
+
+// Organizations API
+export const organizationsApi = {
+  getAll: () => api.get<Organization[]>('/organizations').then(res => res.data || []),
+  getById: (id: string) => api.get<Organization>(`/organizations/${id}`).then(res => res.data),
+  create: (data: OrganizationCreate) => api.post<Organization>('/organizations', data).then(res => res.data),
+  update: (id: string, data: Partial<OrganizationCreate>) => api.patch<Organization>(`/organizations/${id}`, data).then(res => res.data),
+  delete: (id: string) => api.delete(`/organizations/${id}`).then(res => res.data),
+};
 
 // Namespaces API
 export const namespacesApi = {
@@ -39,6 +127,20 @@ export const namespacesApi = {
   create: (data: NamespaceCreate) => api.post<Namespace>('/namespaces', data).then(res => res.data),
   update: (id: string, data: Partial<NamespaceCreate>) => api.patch<Namespace>(`/namespaces/${id}`, data).then(res => res.data),
   delete: (id: string) => api.delete(`/namespaces/${id}`).then(res => res.data),
+  getContacts: (id: string) =>
+    api.get<NamespaceContacts & { namespace_id: string; namespace: string }>(`/namespaces/${id}/contacts`).then(res => res.data),
+  getStorage: (id: string) => api.get<NamespaceStorage>(`/namespaces/${id}/storage`).then(res => res.data),
+  // null falls back to NAMESPACE_STORAGE_QUOTA, 0 is unlimited (admin)
+  setStorageQuota: (id: string, quotaBytes: number | null) =>
+    api.put<NamespaceStorage>(`/namespaces/${id}/storage-quota`, { quota_bytes: quotaBytes }).then(res => res.data),
+  getRunners: (id: string) => api.get<NamespaceRunnerAssignment>(`/namespaces/${id}/runners`).then(res => res.data),
+  // (admin)
+  setRunners: (id: string, runners: NamespaceRunners) =>
+    api.put<NamespaceRunnerAssignment>(`/namespaces/${id}/runners`, runners).then(res => res.data),
+  getEnvDefaults: (id: string) => api.get<EnvDefaults>(`/namespaces/${id}/env-defaults`).then(res => res.data),
+  // A '********' value keeps the stored one (admin)
+  setEnvDefaults: (id: string, envVars: Record<string, string>) =>
+    api.put<EnvDefaults>(`/namespaces/${id}/env-defaults`, { env_vars: envVars }).then(res => res.data),
 
   // API Keys (for Terraform CLI access)
   getAPIKeys: (namespaceId: string) => api.get<APIKey[]>(`/namespaces/${namespaceId}/api-keys`).then(res => res.data || []),
@@ -56,17 +158,40 @@ export const modulesApi = {
   create: (data: ModuleFromGitCreate) => api.post<Module>('/modules', data).then(res => res.data),
   update: (id: string, data: Partial<ModuleCreate>) => api.put<Module>(`/modules/${id}`, data).then(res => res.data),
   delete: (id: string) => api.delete(`/modules/${id}`).then(res => res.data),
+  // Move to another namespace; the old registry address answers with the new one
+  transfer: (id: string, namespaceId: string) =>
+    api.post<{ message: string; from: string; to: string }>(`/modules/${id}/transfer`, { namespace_id: namespaceId }).then(res => res.data),
+  getAliases: (id: string) => api.get<ModuleAlias[]>(`/modules/${id}/aliases`).then(res => res.data || []),
+  // Adds an alias, or changes the expiry of an existing one
+  addAlias: (id: string, data: { namespace: string; name: string; provider: string; expires_at?: string }) =>
+    api.post<ModuleAlias[]>(`/modules/${id}/aliases`, data).then(res => res.data),
+  deleteAlias: (id: string, aliasId: string) => api.delete(`/modules/${id}/aliases/${aliasId}`).then(res => res.data),
   getVersions: (id: string) => api.get<ModuleVersion[]>(`/modules/${id}/versions`).then(res => res.data || []),
   getGitTags: (id: string) => api.get<GitTag[]>(`/modules/${id}/git-tags`).then(res => res.data || []),
-  getReadme: (id: string, ref?: string) => {
-    const params = ref ? { ref } : {};
-    return api.get<{ content: string }>(`/modules/${id}/readme`, { params }).then(res => res.data);
+  getReadme: (id: string, ref?: string, format?: 'markdown' | 'html') => {
+    const params = { ...(ref ? { ref } : {}), ...(format ? { format } : {}) };
+    return api.get<ModuleReadme>(`/modules/${id}/readme`, { params }).then(res => res.data);
   },
-  syncTags: (id: string) => api.post<{ message: string; tags_found: number; tags_added: number }>(`/modules/${id}/sync-tags`).then(res => res.data),
+  getUsage: (id: string, version?: string) =>
+    api.get<ModuleUsage>(`/modules/${id}/usage`, { params: version ? { version } : {} }).then(res => res.data),
+  getUpgradeReport: (id: string, activeDays?: number) =>
+    api.get<ModuleUpgradeReport>(`/modules/${id}/upgrade-report`, { params: activeDays ? { active_days: activeDays } : {} }).then(res => res.data),
+  getExamples: (id: string, versionId: string) =>
+    api.get<ModuleExample[]>(`/modules/${id}/versions/${versionId}/examples`).then(res => res.data || []),
+  syncTags: (id: string) =>
+    api.post<{ message: string; tags_found: number; tags_added: number; tags_enabled: number }>(`/modules/${id}/sync-tags`).then(res => res.data),
+  getAutoEnableRule: (id: string) => api.get<VersionAutoEnableRule>(`/modules/${id}/auto-enable`).then(res => res.data),
+  setAutoEnableRule: (id: string, rule: VersionAutoEnableRule) =>
+    api.put<VersionAutoEnableRule>(`/modules/${id}/auto-enable`, rule).then(res => res.data),
+  deleteAutoEnableRule: (id: string) => api.delete(`/modules/${id}/auto-enable`).then(res => res.data),
   addVersion: (id: string, data: { version: string; enabled?: boolean; subdir?: string }) =>
     api.post<ModuleVersion>(`/modules/${id}/versions`, data).then(res => res.data),
   toggleVersion: (id: string, versionId: string, enabled: boolean) =>
     api.patch<{ message: string; enabled: boolean }>(`/modules/${id}/versions/${versionId}`, { enabled }).then(res => res.data),
+  deprecateVersion: (id: string, versionId: string, data: { reason: string; replacement?: string }) =>
+    api.put<VersionDeprecation>(`/modules/${id}/versions/${versionId}/deprecation`, data).then(res => res.data),
+  undeprecateVersion: (id: string, versionId: string) =>
+    api.delete(`/modules/${id}/versions/${versionId}/deprecation`).then(res => res.data),
   deleteVersion: (id: string, versionId: string) =>
     api.delete(`/modules/${id}/versions/${versionId}`).then(res => res.data),
 };
@@ -80,17 +205,32 @@ export const providersApi = {
   getById: (id: string) => api.get<Provider>(`/providers/${id}`).then(res => res.data),
   create: (data: ProviderFromGitCreate) => api.post<Provider>('/providers', data).then(res => res.data),
   delete: (id: string) => api.delete(`/providers/${id}`).then(res => res.data),
-  getVersions: (id: string) => api.get<ProviderVersion[]>(`/providers/${id}/versions`).then(res => res.data || []),
+  // Move to another namespace with its files; the old registry address answers with the new one
+  transfer: (id: string, namespaceId: string) =>
+    api.post<{ message: string; from: string; to: string }>(`/providers/${id}/transfer`, { namespace_id: namespaceId }).then(res => res.data),
+  getVersions: (id: string, options?: { include?: 'stats'; active_days?: number }) =>
+    api.get<ProviderVersion[]>(`/providers/${id}/versions`, { params: options }).then(res => res.data || []),
+  getStats: (id: string, activeDays?: number) =>
+    api.get<ProviderInstallStats>(`/providers/${id}/stats`, { params: { active_days: activeDays } }).then(res => res.data),
   getGitTags: (id: string) => api.get<GitTag[]>(`/providers/${id}/git-tags`).then(res => res.data || []),
   getReadme: (id: string, ref?: string) => {
     const params = ref ? { ref } : {};
     return api.get<{ content: string }>(`/providers/${id}/readme`, { params }).then(res => res.data);
   },
-  syncTags: (id: string) => api.post<{ message: string; tags_found: number; tags_added: number }>(`/providers/${id}/sync-tags`).then(res => res.data),
+  syncTags: (id: string) =>
+    api.post<{ message: string; tags_found: number; tags_added: number; tags_enabled: number }>(`/providers/${id}/sync-tags`).then(res => res.data),
+  getAutoEnableRule: (id: string) => api.get<VersionAutoEnableRule>(`/providers/${id}/auto-enable`).then(res => res.data),
+  setAutoEnableRule: (id: string, rule: VersionAutoEnableRule) =>
+    api.put<VersionAutoEnableRule>(`/providers/${id}/auto-enable`, rule).then(res => res.data),
+  deleteAutoEnableRule: (id: string) => api.delete(`/providers/${id}/auto-enable`).then(res => res.data),
   addVersion: (id: string, data: { version: string; protocols?: string[] }) =>
     api.post<ProviderVersion>(`/providers/${id}/versions`, data).then(res => res.data),
   toggleVersion: (id: string, versionId: string, enabled: boolean) =>
     api.patch<{ message: string; enabled: boolean }>(`/providers/${id}/versions/${versionId}`, { enabled }).then(res => res.data),
+  deprecateVersion: (id: string, versionId: string, data: { reason: string; replacement?: string }) =>
+    api.put<VersionDeprecation>(`/providers/${id}/versions/${versionId}/deprecation`, data).then(res => res.data),
+  undeprecateVersion: (id: string, versionId: string) =>
+    api.delete(`/providers/${id}/versions/${versionId}/deprecation`).then(res => res.data),
   deleteVersion: (id: string, versionId: string) =>
     api.delete(`/providers/${id}/versions/${versionId}`).then(res => res.data),
 
@@ -114,6 +254,33 @@ export const providersApi = {
       { headers: { 'Content-Type': 'multipart/form-data' } }
     ).then(res => res.data);
   },
+
+  // Import platforms from the goreleaser artifacts of the version's GitHub release
+  importRelease: (id: string, versionId: string, data: ProviderReleaseImportCreate) =>
+    api.post<ProviderReleaseImport>(`/providers/${id}/versions/${versionId}/import-release`, data).then(res => res.data),
+};
+
+// Provider mirrors API
+export const providerMirrorsApi = {
+  getAll: () => api.get<ProviderMirror[]>('/provider-mirrors').then(res => res.data || []),
+  get: (id: string) => api.get<ProviderMirror>(`/provider-mirrors/${id}`).then(res => res.data),
+  create: (data: ProviderMirrorCreate) => api.post<ProviderMirror>('/provider-mirrors', data).then(res => res.data),
+  update: (id: string, versionConstraint: string) =>
+    api.patch<ProviderMirror>(`/provider-mirrors/${id}`, { version_constraint: versionConstraint }).then(res => res.data),
+  delete: (id: string) => api.delete(`/provider-mirrors/${id}`).then(res => res.data),
+  sync: (id: string) => api.post<{ message: string }>(`/provider-mirrors/${id}/sync`).then(res => res.data),
+};
+
+// Deployment templates API
+export const deploymentTemplatesApi = {
+  getAll: () => api.get<DeploymentTemplate[]>('/deployment-templates').then(res => res.data || []),
+  get: (id: string) => api.get<DeploymentTemplate>(`/deployment-templates/${id}`).then(res => res.data),
+  create: (data: DeploymentTemplateCreate) => api.post<DeploymentTemplate>('/deployment-templates', data).then(res => res.data),
+  update: (id: string, data: Partial<Omit<DeploymentTemplateCreate, 'name'>>) =>
+    api.patch<DeploymentTemplate>(`/deployment-templates/${id}`, data).then(res => res.data),
+  delete: (id: string) => api.delete(`/deployment-templates/${id}`).then(res => res.data),
+  createDeployment: (id: string, data: DeploymentFromTemplate) =>
+    api.post<Deployment>(`/deployment-templates/${id}/deployments`, data).then(res => res.data),
 };
 
 // Deployments API
@@ -124,6 +291,10 @@ export const deploymentsApi = {
   },
   getById: (id: string) => api.get<Deployment>(`/deployments/${id}`).then(res => res.data),
   create: (data: DeploymentCreate) => api.post<Deployment>('/deployments', data).then(res => res.data),
+  getOutputs: (id: string, path?: string) =>
+    api.get<{ deployment_id: string; deployment: string; namespace: string; paths: DeploymentOutputs[] }>(
+      `/deployments/${id}/outputs`, { params: path ? { path } : {} }).then(res => res.data),
+  clone: (id: string, data: DeploymentClone) => api.post<Deployment>(`/deployments/${id}/clone`, data).then(res => res.data),
   delete: (id: string) => api.delete(`/deployments/${id}`).then(res => res.data),
   getReferences: (id: string) =>
     api.get<{ branches: string[], tags: string[] }>(`/deployments/${id}/references`).then(res => {
@@ -147,26 +318,125 @@ export const deploymentsApi = {
   },
   getTfvarsFiles: (id: string, ref: string, path?: string) => {
     const params = path ? { ref, path } : { ref };
-    return api.get<{ tfvars_files: string[] }>(`/deployments/${id}/tfvars`, { params }).then(res => res.data);
+    return api.get<TfvarsListing>(`/deployments/${id}/tfvars`, { params }).then(res => res.data);
   },
-  createRun: (id: string, data: { path: string, ref: string, tool: 'terraform' | 'tofu', env_vars?: Record<string, string>, tfvars_files?: string[], init_flags?: string, plan_flags?: string }) =>
-    api.post<DeploymentRun>(`/deployments/${id}/runs`, { deployment_id: id, ...data }).then(res => res.data),
+  // A retry with the same idempotencyKey returns the run the first request created
+  createRun: (id: string, data: { path: string, ref: string, tool: 'terraform' | 'tofu', env_vars?: Record<string, string>, tfvars_files?: string[], init_flags?: string, plan_flags?: string }, idempotencyKey?: string) =>
+    api.post<DeploymentRun>(`/deployments/${id}/runs`, { deployment_id: id, ...data }, idempotencyKey ? { headers: { 'Idempotency-Key': idempotencyKey } } : undefined).then(res => res.data),
   getRuns: (id: string, path?: string) => {
     const params = path ? { path } : {};
     return api.get<DeploymentRun[]>(`/deployments/${id}/runs`, { params }).then(res => res.data || []);
   },
   getRun: (id: string, runId: string) =>
     api.get<DeploymentRun>(`/deployments/${id}/runs/${runId}`).then(res => res.data),
-  approveRun: (id: string, runId: string, data: { approved: boolean, approved_by?: string }) =>
+  approveRun: (id: string, runId: string, data: { approved: boolean }) =>
     api.post<DeploymentRun>(`/deployments/${id}/runs/${runId}/approve`, data).then(res => res.data),
   cancelRun: (id: string, runId: string) =>
     api.post<DeploymentRun>(`/deployments/${id}/runs/${runId}/cancel`).then(res => res.data),
   deleteRun: (id: string, runId: string) =>
     api.delete(`/deployments/${id}/runs/${runId}`).then(res => res.data),
+  getRunLogs: (id: string, runId: string, format: LogFormat = 'raw') =>
+    api.get<RunLogs>(`/deployments/${id}/runs/${runId}/logs`, { params: { format } }).then(res => res.data),
+  // URL of a run's logs as a file, for a download link
+  runLogsDownloadUrl: (id: string, runId: string, phase: 'init' | 'plan' | 'apply' | 'hooks' | 'all' = 'all', gzip = false) =>
+    `${apiBaseUrl}/deployments/${id}/runs/${runId}/logs/download?phase=${phase}${gzip ? '&gzip=true' : ''}`,
+  getRunManifest: (id: string, runId: string) =>
+    api.get<RunManifest>(`/deployments/${id}/runs/${runId}/manifest`).then(res => res.data),
+  // New run replaying the manifest of a finished run
+  reproduceRun: (id: string, runId: string) =>
+    api.post<DeploymentRun>(`/deployments/${id}/runs/${runId}/reproduce`).then(res => res.data),
+  // Clear-text env vars of a run (admin API key, recorded as an audit event)
+  revealRunEnvVars: (id: string, runId: string, apiKey: string) =>
+    api.get<{ run_id: string; env_vars: Record<string, string> }>(`/deployments/${id}/runs/${runId}/env-vars`, { headers: { 'X-API-Key': apiKey } }).then(res => res.data),
   getStatus: (id: string, path?: string) => {
     const params = path ? { path } : {};
     return api.get<DirectoryStatus>(`/deployments/${id}/status`, { params }).then(res => res.data);
   },
 };
 
+// Runs of all deployments
+export const runsApi = {
+  search: (params?: RunSearchParams) =>
+    api.get<RunSummary[]>('/runs', { params }).then(res => res.data),
+};
+
+// Announcements API (publishing requires an admin API key)
+export const announcementsApi = {
+  getActive: (target?: { module_id?: string; provider_id?: string; namespace_id?: string }) =>
+    api.get<Announcement[]>('/announcements', { params: target }).then(res => res.data || []),
+  getAll: () => api.get<Announcement[]>('/announcements', { params: { all: true } }).then(res => res.data || []),
+  create: (data: AnnouncementCreate, apiKey: string) =>
+    api.post<Announcement>('/announcements', data, { headers: { 'X-API-Key': apiKey } }).then(res => res.data),
+  update: (id: string, data: AnnouncementUpdate, apiKey: string) =>
+    api.patch<Announcement>(`/announcements/${id}`, data, { headers: { 'X-API-Key': apiKey } }).then(res => res.data),
+  delete: (id: string, apiKey: string) =>
+    api.delete(`/announcements/${id}`, { headers: { 'X-API-Key': apiKey } }).then(res => res.data),
+};
+
+// Inbox of the calling API key (notification bell)
+export const inboxApi = {
+  get: (unreadOnly = false) =>
+    api.get<Inbox>('/inbox', { params: unreadOnly ? { unread: true } : {} }).then(res => res.data),
+  markRead: (ids: string[], read = true) =>
+    api.post<{ message: string; updated: number }>('/inbox/read', { ids, read }).then(res => res.data),
+  markAllRead: () => api.post<{ message: string; updated: number }>('/inbox/read-all').then(res => res.data),
+};
+
+// Activity digests API
+export const digestsApi = {
+  preview: (frequency: DigestFrequency = 'daily', namespaceId?: string) =>
+    api.get<Digest>('/digest', { params: { frequency, ...(namespaceId ? { namespace_id: namespaceId } : {}) } }).then(res => res.data),
+  listSubscriptions: () => api.get<DigestSubscription[]>('/digest-subscriptions').then(res => res.data || []),
+  subscribe: (data: DigestSubscriptionCreate) =>
+    api.post<DigestSubscription>('/digest-subscriptions', data).then(res => res.data),
+  unsubscribe: (id: string) => api.delete(`/digest-subscriptions/${id}`).then(res => res.data),
+};
+
+// Administration API (admin API key)
+export const adminApi = {
+  getAuditEvents: (apiKey: string, params?: { action?: string; target_id?: string; limit?: number }) =>
+    api.get<AuditEvent[]>('/admin/audit-events', { params, headers: { 'X-API-Key': apiKey } }).then(res => res.data || []),
+  getSecurityAlerts: (apiKey: string, params?: { type?: string; acknowledged?: boolean; limit?: number }) =>
+    api.get<SecurityAlert[]>('/admin/security-alerts', { params, headers: { 'X-API-Key': apiKey } }).then(res => res.data || []),
+  acknowledgeSecurityAlert: (apiKey: string, id: string) =>
+    api.post<{ message: string }>(`/admin/security-alerts/${id}/acknowledge`, null, { headers: { 'X-API-Key': apiKey } }).then(res => res.data),
+  getAuthLockouts: (apiKey: string) =>
+    api.get<AuthLockout[]>('/admin/auth-lockouts', { headers: { 'X-API-Key': apiKey } }).then(res => res.data || []),
+  clearAuthLockout: (apiKey: string, subject: string) =>
+    api.delete(`/admin/auth-lockouts/${encodeURIComponent(subject)}`, { headers: { 'X-API-Key': apiKey } }).then(res => res.data),
+  getRegistryCacheStats: (apiKey: string) =>
+    api.get<RegistryCacheStats>('/admin/registry-cache', { headers: { 'X-API-Key': apiKey } }).then(res => res.data),
+  flushRegistryCache: (apiKey: string) =>
+    api.delete('/admin/registry-cache', { headers: { 'X-API-Key': apiKey } }).then(res => res.data),
+  getSourceHosts: (apiKey: string) =>
+    api.get<SourceHost[]>('/admin/source-hosts', { headers: { 'X-API-Key': apiKey } }).then(res => res.data || []),
+  addSourceHost: (apiKey: string, data: { kind: SourceHost['kind']; pattern: string; description?: string }) =>
+    api.post<SourceHost>('/admin/source-hosts', data, { headers: { 'X-API-Key': apiKey } }).then(res => res.data),
+  removeSourceHost: (apiKey: string, id: string) =>
+    api.delete(`/admin/source-hosts/${id}`, { headers: { 'X-API-Key': apiKey } }).then(res => res.data),
+  getEnvDefaults: (apiKey: string) =>
+    api.get<EnvDefaults>('/admin/env-defaults', { headers: { 'X-API-Key': apiKey } }).then(res => res.data),
+  setEnvDefaults: (apiKey: string, envVars: Record<string, string>) =>
+    api.put<EnvDefaults>('/admin/env-defaults', { env_vars: envVars }, { headers: { 'X-API-Key': apiKey } }).then(res => res.data),
+  getJobs: (apiKey: string) =>
+    api.get<BackgroundJob[]>('/admin/jobs', { headers: { 'X-API-Key': apiKey } }).then(res => res.data || []),
+  getDeadLetters: (apiKey: string, params?: { pending?: boolean; event_type?: string; limit?: number }) =>
+    api.get<DeadLetter[]>('/admin/dead-letters', { params, headers: { 'X-API-Key': apiKey } }).then(res => res.data || []),
+  redeliverDeadLetter: (apiKey: string, id: string) =>
+    api.post<DeadLetter>(`/admin/dead-letters/${id}/redeliver`, null, { headers: { 'X-API-Key': apiKey } }).then(res => res.data),
+  getMaintenance: () =>
+    api.get<MaintenanceState>('/maintenance').then(res => res.data),
+  setMaintenance: (apiKey: string, data: { enabled: boolean; message?: string; ends_at?: string }) =>
+    api.put<MaintenanceState>('/admin/maintenance', data, { headers: { 'X-API-Key': apiKey } }).then(res => res.data),
+  listFeatureFlags: (apiKey: string) =>
+    api.get<FeatureFlag[]>('/admin/flags', { headers: { 'X-API-Key': apiKey } }).then(res => res.data || []),
+  updateFeatureFlag: (apiKey: string, key: FeatureFlag['key'], data: { enabled: boolean; namespaces?: string[]; percentage?: number }) =>
+    api.put<FeatureFlag>(`/admin/flags/${key}`, data, { headers: { 'X-API-Key': apiKey } }).then(res => res.data),
+  resetFeatureFlag: (apiKey: string, key: FeatureFlag['key']) =>
+    api.delete<FeatureFlag>(`/admin/flags/${key}`, { headers: { 'X-API-Key': apiKey } }).then(res => res.data),
+  // Which feature flags are on for a namespace (any caller)
+  getFeatures: (namespace?: string) =>
+    api.get<Record<FeatureFlag['key'], boolean>>('/features', { params: { namespace } }).then(res => res.data),
+};
+
 export default api;
@@ -23,7 +23,7 @@ export default function DeploymentRunDetailPage() {
 
     // Auto-refresh polling when run is active - aggressive polling for near-real-time updates
     useEffect(() => {
-        const activeStatuses = ['pending', 'initializing', 'planning', 'awaiting_approval', 'applying'];
+        const activeStatuses = ['pending', 'initializing', 'planning', 'awaiting_approval', 'applying', 'runner_unreachable'];
         if (!run || !activeStatuses.includes(run.status)) {
             return;
         }
@@ -84,18 +84,15 @@ export default function DeploymentRunDetailPage() {
 
         setApproving(true);
         try {
-            // Send approval/rejection to server
-            await deploymentsApi.approveRun(id, runId, {
-                approved,
-                approved_by: 'User' // TODO: Get from auth context
-            });
+            // Send approval/rejection to server; it records the logged-in key as approver
+            const updated = await deploymentsApi.approveRun(id, runId, { approved });
 
             // Update local state immediately for smooth transition
             if (run) {
                 setRun({
                     ...run,
                     status: approved ? 'applying' : 'cancelled',
-                    approved_by: approved ? 'User' : 'REJECTED'
+                    approved_by: updated?.approved_by ?? (approved ? undefined : 'REJECTED')
                 });
             }
         } catch (err) {
@@ -186,7 +183,7 @@ export default function DeploymentRunDetailPage() {
 
     if (!run) return null;
 
-    const canCancel = ['pending', 'initializing', 'planning', 'awaiting_approval', 'applying'].includes(run.status);
+    const canCancel = ['pending', 'initializing', 'planning', 'awaiting_approval', 'applying', 'runner_unreachable'].includes(run.status);
     const canDelete = !canCancel; // Can only delete completed/failed/cancelled runs
 
     return (
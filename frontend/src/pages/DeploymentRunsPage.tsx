@@ -18,7 +18,7 @@ export default function DeploymentRunsPage() {
 
     useEffect(() => {
         // Auto-refresh every 3 seconds if there are running/pending deployments
-        const activeStatuses = ['pending', 'initializing', 'planning', 'awaiting_approval', 'applying'];
+        const activeStatuses = ['pending', 'initializing', 'planning', 'awaiting_approval', 'applying', 'runner_unreachable'];
         const hasActiveRuns = runs.some(run => activeStatuses.includes(run.status));
         
         if (hasActiveRuns) {
@@ -202,14 +202,14 @@ export default function DeploymentRunsPage() {
                                         <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500 dark:text-gray-400">
                                             {run.completed_at ? (
                                                 `${Math.round((new Date(run.completed_at).getTime() - new Date(run.created_at).getTime()) / 1000)}s`
-                                            ) : ['pending', 'initializing', 'planning', 'awaiting_approval', 'applying'].includes(run.status) ? (
+                                            ) : ['pending', 'initializing', 'planning', 'awaiting_approval', 'applying', 'runner_unreachable'].includes(run.status) ? (
                                                 <span className="text-yellow-600 dark:text-yellow-400">In Progress...</span>
                                             ) : (
                                                 '-'
                                             )}
                                         </td>
                                         <td className="px-6 py-4 whitespace-nowrap text-right text-sm font-medium">
-                                            {!['pending', 'initializing', 'planning', 'awaiting_approval', 'applying'].includes(run.status) && (
+                                            {!['pending', 'initializing', 'planning', 'awaiting_approval', 'applying', 'runner_unreachable'].includes(run.status) && (
                                                 <button
                                                     onClick={(e) => handleDelete(run.id, e)}
                                                     disabled={deleting === run.id}
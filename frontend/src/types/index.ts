@@ -1,19 +1,105 @@
 // Namespace (Authority) - organization that owns modules and providers
-export interface Namespace {
+export interface Namespace extends NamespaceContacts {
   id: string;
   name: string;
   description?: string;
   is_public: boolean;
+  organization_id?: string;
   module_count?: number;
   provider_count?: number;
   created_at: string;
   updated_at: string;
 }
 
+// Who maintains the content of a namespace
+export interface NamespaceContacts {
+  owner_emails: string[];
+  support_contact?: string;
+  links: NamespaceLink[];
+  logo_url?: string;
+}
+
+export interface NamespaceLink {
+  title: string;
+  url: string;
+}
+
+// Provider file storage of a namespace
+export interface NamespaceStorage {
+  namespace_id: string;
+  used_bytes: number;
+  quota_bytes: number; // 0: unlimited
+  quota_source?: 'namespace' | 'default';
+}
+
+// Runners a namespace's runs are bound to; empty lists allow the whole pool
+export interface NamespaceRunners {
+  runners: string[];
+  labels: string[];
+}
+
+// Env vars given to every run, or to the runs of a namespace's deployments; values redacted
+export interface EnvDefaults {
+  scope: 'platform' | 'namespace';
+  namespace_id?: string;
+  env_vars: Record<string, string>;
+  updated_by?: string;
+  updated_at?: string;
+}
+
+export interface NamespaceRunnerAssignment extends NamespaceRunners {
+  namespace_id: string;
+  restricted: boolean;
+  eligible: string[];
+}
+
 export interface NamespaceCreate {
   name: string;
   description?: string;
   is_public: boolean;
+  owner_emails?: string[];
+  support_contact?: string;
+  links?: NamespaceLink[];
+  logo_url?: string;
+  organization_id?: string; // '' on update leaves the organization
+}
+
+// Organization grouping namespaces under shared settings and quotas
+export interface Organization {
+  id: string;
+  name: string;
+  description?: string;
+  default_deployment_settings: DeploymentSettings;
+  vcs_connections: VCSConnection[];
+  quotas: OrganizationQuotas;
+  usage: {
+    namespaces: number;
+    deployments: number;
+    active_runs: number;
+  };
+  created_at: string;
+  updated_at: string;
+}
+
+export interface VCSConnection {
+  host: string;
+  username: string;
+  password?: string; // write-only; omit on update to keep the stored one
+}
+
+// 0 or unset is unlimited
+export interface OrganizationQuotas {
+  max_namespaces?: number;
+  max_deployments?: number;
+  max_concurrent_runs?: number;
+}
+
+export interface OrganizationCreate {
+  name: string;
+  description?: string;
+  default_deployment_settings?: DeploymentSettings;
+  vcs_connections?: VCSConnection[];
+  quotas?: OrganizationQuotas;
 }
 
 // API Key for authentication
@@ -22,7 +108,7 @@ export interface APIKey {
   namespace_id: string;
   name: string;
   key?: string; // Only shown on creation
-  permissions: 'read' | 'write' | 'admin';
+  permissions: 'read' | 'write' | 'approver' | 'admin';
   expires_at?: string;
   created_at: string;
   last_used_at?: string;
@@ -30,7 +116,7 @@ export interface APIKey {
 
 export interface APIKeyCreate {
   name: string;
-  permissions: 'read' | 'write' | 'admin';
+  permissions: 'read' | 'write' | 'approver' | 'admin';
   expires_at?: string;
 }
 
@@ -45,10 +131,25 @@ export interface Module {
   source_url?: string;
   synced: boolean;
   sync_error?: string;
+  credential_status?: CredentialStatus;
+  maintainers?: NamespaceContacts;
+  aliases?: ModuleAlias[]; // Previous addresses the registry still serves it under
   created_at: string;
   updated_at: string;
 }
 
+// Another address the registry protocol serves a module under, e.g. before a rename
+export interface ModuleAlias {
+  id: string;
+  module_id: string;
+  namespace: string;
+  name: string;
+  provider: string;
+  expires_at?: string; // Never expires when absent
+  active: boolean;
+  created_at: string;
+}
+
 export interface ModuleCreate {
   name: string;
   provider: string;
@@ -67,6 +168,20 @@ export interface ModuleFromGitCreate {
   is_private?: boolean;
   git_username?: string;
   git_password?: string;
+  terraform_workspace?: string;
+}
+
+// Decides which versions a tag sync enables right away
+export interface VersionAutoEnableRule {
+  constraint: string; // e.g. ">= 1.0.0"
+  include_prereleases?: boolean;
+}
+
+// Marks a version as deprecated; it stays installable
+export interface VersionDeprecation {
+  reason: string;
+  replacement?: string; // version to upgrade to
+  deprecated_at?: string;
 }
 
 // Add version to existing module
@@ -83,9 +198,89 @@ export interface ModuleVersion {
   download_url: string;
   documentation?: string;
   enabled: boolean;
+  tag_message?: string; // annotated tag message
+  changelog?: string; // CHANGELOG.md section of the version
+  deprecation?: VersionDeprecation;
   created_at: string;
 }
 
+// Cached module README; html is the sanitized rendering (format=html)
+export interface ModuleReadme {
+  content: string;
+  ref: string;
+  fetched_at: string;
+  html?: string;
+}
+
+// Usage example of a module version
+export interface ModuleExample {
+  name: string;
+  path: string;
+  content: string;
+}
+
+// Input variable of a module version
+export interface ModuleVariable {
+  name: string;
+  type?: string;
+  default?: string;
+  description?: string;
+  required: boolean;
+  sensitive?: boolean;
+  file: string;
+}
+
+// .tfvars file of a deployment directory, checked against the declared variables
+export interface TfvarsFile {
+  name: string;
+  content: string;
+  values: Record<string, string>; // variable name to the value's source text
+  undeclared: string[];
+  missing_required: string[];
+  parse_error?: string;
+}
+
+export interface TfvarsListing {
+  tfvars_files: string[];
+  files: TfvarsFile[];
+  variables: ModuleVariable[]; // declared by the directory's .tf files
+}
+
+// Module block to paste into a configuration
+export interface ModuleUsage {
+  source: string;
+  version: string;
+  constraint: string;
+  hcl: string;
+  inputs: ModuleVariable[];
+}
+
+// A version to upgrade to and where to read what changed
+export interface ModuleUpgradeTarget {
+  version: string;
+  has_changelog: boolean;
+  changelog_url?: string; // GitHub and GitLab repositories
+}
+
+// A consumer (API key, deployment or client IP) on an outdated module version
+export interface ModuleConsumerDrift {
+  consumer: string;
+  name?: string;
+  current_version: string;
+  last_downloaded_at: string;
+  upgrade: 'major' | 'minor' | 'patch' | 'prerelease';
+  latest_compatible?: ModuleUpgradeTarget; // newest release of the same major version
+  latest: ModuleUpgradeTarget;
+}
+
+export interface ModuleUpgradeReport {
+  module_id: string;
+  latest_version: string;
+  active_days: number;
+  up_to_date: number;
+  outdated: ModuleConsumerDrift[];
+}
+
 // Git tag from repository
 export interface GitTag {
   name: string;
@@ -107,8 +302,15 @@ export interface Provider {
   description?: string;
   source_url?: string;
   synced: boolean;
+  credential_status?: CredentialStatus;
+  channels?: Record<string, string>;
+  maintainers?: NamespaceContacts;
   created_at: string;
   updated_at: string;
+  abstract?: string;
+  repository_description?: string;
+  topics: string[];
+  catalog_synced_at?: string;
 }
 
 export interface ProviderCreate {
@@ -125,6 +327,7 @@ export interface ProviderFromGitCreate {
   is_private?: boolean;
   git_username?: string;
   git_password?: string;
+  terraform_workspace?: string;
 }
 
 export interface ProviderVersion {
@@ -134,9 +337,36 @@ export interface ProviderVersion {
   protocols: string[];
   enabled: boolean;
   platforms?: ProviderPlatform[];
+  channels?: string[];
+  tag_message?: string; // annotated tag message
+  changelog?: string; // CHANGELOG.md section of the version
+  stats?: ProviderVersionStats; // with include=stats
+  deprecation?: VersionDeprecation;
   created_at: string;
 }
 
+// Downloads of a provider version through the registry protocol
+export interface ProviderVersionStats {
+  downloads: number;
+  consumers: number;
+  active_consumers: number; // downloaded within active_days
+  last_downloaded_at?: string;
+}
+
+export interface ProviderInstallStats {
+  active_days: number;
+  versions: (ProviderVersionStats & { version_id: string; version: string; enabled: boolean })[];
+}
+
+// Named alias (latest, stable, beta, ...) pointing at a provider version
+export interface ProviderChannel {
+  name: string;
+  version_id: string;
+  version: string;
+  automatic: boolean;
+  updated_at?: string;
+}
+
 export interface ProviderPlatform {
   id: string;
   version_id: string;
@@ -146,6 +376,86 @@ export interface ProviderPlatform {
   download_url: string;
 }
 
+export type ProviderBuildStatus = 'pending' | 'running' | 'success' | 'partial' | 'failed';
+
+export interface ProviderBuildPlatform {
+  os: string;
+  arch: string;
+  status: 'pending' | 'running' | 'success' | 'failed';
+  log?: string;
+  duration_seconds: number;
+  filename?: string;
+  shasum?: string;
+  go_version?: string; // toolchain that compiled the artifact
+  error?: string;
+  provenance?: unknown; // in-toto statement with SLSA v1 provenance
+  provenance_signature?: string; // base64 detached GPG signature
+}
+
+// Compilation of a provider version from its Git source
+export interface ProviderBuild {
+  id: string;
+  provider_id: string;
+  version_id: string;
+  version: string;
+  status: ProviderBuildStatus;
+  platforms: ProviderBuildPlatform[];
+  log?: string;
+  go_version?: string; // requested, then the exact toolchain used (e.g., "go1.22.5")
+  error?: string;
+  started_at?: string;
+  finished_at?: string;
+  created_at: string;
+}
+
+// Import of a version's platforms from its GitHub release
+export interface ProviderReleaseImportCreate {
+  tag?: string; // default: v<version>
+  platforms?: { os: string; arch: string }[]; // default: every zip in the release
+  gpg_public_key: string; // publisher's key (required); SHA256SUMS.sig must verify against it
+}
+
+export interface ProviderReleaseImport {
+  tag: string;
+  signature_verified: boolean;
+  protocols?: string[];
+  platforms: {
+    os: string;
+    arch: string;
+    filename: string;
+    shasum?: string;
+    error?: string;
+  }[];
+}
+
+// Line emitted by the provider build log stream
+export interface ProviderBuildLogLine {
+  platform?: string;
+  line: string;
+}
+
+// Upstream provider copied into a local namespace on a schedule
+export interface ProviderMirror {
+  id: string;
+  provider_id: string;
+  namespace: string;
+  name: string;
+  upstream_source: string; // e.g. registry.terraform.io/hashicorp/aws
+  version_constraint: string; // e.g. ">= 5.0, < 6.0"
+  version_count: number;
+  last_synced_at?: string;
+  last_error?: string;
+  created_at: string;
+}
+
+export interface ProviderMirrorCreate {
+  namespace_id: string;
+  name?: string; // default: the upstream name
+  upstream_source: string;
+  version_constraint: string;
+  description?: string;
+}
+
 // Deployment for IaC management
 export interface Deployment {
   id: string;
@@ -155,10 +465,68 @@ export interface Deployment {
   description?: string;
   git_url: string;
   is_private: boolean;
+  terraform_workspace?: string;
+  hooks?: DeploymentHooks;
+  runner_image?: string;
+  auto_destroy_after?: string;
+  plan_validity?: string;
+  clone_options?: CloneOptions;
+  pipeline?: PipelineOptions;
+  terragrunt?: TerragruntOptions;
+  watch_paths?: string[];
+  registry_namespaces?: string[];
+  concurrency?: ConcurrencyOptions;
+  credential_status?: CredentialStatus;
   created_at: string;
   updated_at: string;
 }
 
+export interface RunHook {
+  name?: string;
+  command: string;
+  timeout?: number;
+  on_failure?: 'fail' | 'warn';
+}
+
+export interface AffectedDeployment {
+  deployment_id: string;
+  name: string;
+  namespace: string;
+  paths: string[];
+  matched_files: string[];
+}
+
+export interface ChangeSet {
+  before: string;
+  after: string;
+  changed_files: string[];
+  all_changed: boolean;
+  deployments: AffectedDeployment[];
+}
+
+export interface CloneOptions {
+  sparse: boolean;
+  extra_paths: string[];
+  submodules: boolean;
+}
+
+export interface PipelineOptions {
+  validate: boolean;
+  policy_checks: RunHook[];
+}
+
+export type IaCTool = 'terraform' | 'tofu' | 'terragrunt' | 'auto';
+
+export interface TerragruntOptions {
+  run_all: boolean;
+  tf_binary?: 'terraform' | 'tofu';
+}
+
+export interface DeploymentHooks {
+  pre_init: RunHook[];
+  post_apply: RunHook[];
+}
+
 export interface DeploymentCreate {
   namespace_id: string;
   name: string;
@@ -167,6 +535,63 @@ export interface DeploymentCreate {
   is_private?: boolean;
   git_username?: string;
   git_password?: string;
+  terraform_workspace?: string;
+  registry_namespaces?: string[];
+  concurrency?: ConcurrencyOptions;
+}
+
+// Named concurrency groups: across deployments, one run of a group applies at a time
+export interface ConcurrencyOptions {
+  group?: string;
+  workspaces?: Record<string, string>; // group by workspace ("default" for runs without one)
+}
+
+export interface DeploymentClone {
+  name: string;
+  namespace_id?: string; // default: the source deployment's namespace
+  description?: string;
+  git_url?: string; // credentials are only copied for the same host
+}
+
+// Settings shared by deployments and deployment templates
+export interface DeploymentSettings {
+  terraform_workspace?: string;
+  hooks?: DeploymentHooks;
+  runner_image?: string;
+  auto_destroy_after?: string;
+  plan_validity?: string;
+  clone_options?: CloneOptions;
+  pipeline?: PipelineOptions;
+  terragrunt?: TerragruntOptions;
+  watch_paths?: string[];
+  registry_namespaces?: string[];
+}
+
+export interface DeploymentTemplate {
+  id: string;
+  name: string;
+  description?: string;
+  git_url_pattern: string; // {namespace} and {name} are replaced
+  settings: DeploymentSettings;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface DeploymentTemplateCreate {
+  name: string;
+  description?: string;
+  git_url_pattern: string;
+  settings: DeploymentSettings;
+}
+
+export interface DeploymentFromTemplate {
+  namespace_id: string;
+  name: string;
+  description?: string;
+  git_url?: string; // overrides the template's git_url_pattern
+  is_private?: boolean;
+  git_username?: string;
+  git_password?: string;
 }
 
 export interface GitReference {
@@ -181,6 +606,9 @@ export interface FileNode {
   type: string;
   size: number;
   is_dir: boolean;
+  deployable?: boolean; // directory holds IaC files, runs can target it
+  iac_type?: 'terraform' | 'tofu' | 'terragrunt';
+  contains_deployable?: boolean; // a directory directly below is deployable
 }
 
 export interface DirectoryListing {
@@ -188,58 +616,345 @@ export interface DirectoryListing {
   files: FileNode[];
   readme?: string;
   has_gitops: boolean;
+  iac_type?: 'terraform' | 'tofu' | 'terragrunt';
+  platform_config?: PlatformConfig; // repository root only
+  platform_config_error?: string;
   shasums_url?: string;
   shasums_signature_url?: string;
   shasum: string;
   signing_keys?: string;
 }
 
+// platform.yaml at the root of a deployment's repository
+export interface PlatformConfig {
+  tool?: IaCTool;
+  runner_image?: string;
+  workspaces?: string[];
+  var_files?: string[];
+  hooks: DeploymentHooks;
+  apply: {
+    auto_approve: boolean;
+    plan_validity?: string;
+    validate: boolean;
+    policy_checks: RunHook[];
+  };
+}
+
 export interface DeploymentRun {
   id: string;
   deployment_id: string;
   path: string;
   ref: string;
-  tool: 'terraform' | 'tofu';
-  env_vars: Record<string, string>;
+  commit_sha?: string;
+  tool: IaCTool; // Replaced by the detected tool once the runner resolves "auto"
+  tool_version?: string; // terraform/tofu version the run executes with
+  env_vars: Record<string, string>; // Values are redacted ("********")
   tfvars_files: string[];
   init_flags?: string;
   plan_flags?: string;
-  status: 'pending' | 'initializing' | 'planning' | 'awaiting_approval' | 'applying' | 'success' | 'failed' | 'cancelled' | 'running';
+  terraform_workspace?: string;
+  status: 'pending' | 'initializing' | 'planning' | 'awaiting_approval' | 'applying' | 'runner_unreachable' | 'success' | 'failed' | 'cancelled' | 'stale' | 'expired' | 'running';
+  plan_expires_at?: string;
   init_log: string;
   plan_log: string;
   plan_output: string;
   apply_log: string;
   apply_output: string;
+  hook_log?: string;
+  apply_report?: ApplyResourceResult[];
+  operation?: string;
+  operation_args?: unknown;
+  parent_run_id?: string;
+  reproduces_run_id?: string; // Run whose manifest this run replays
+  stack_run_id?: string;
+  operation_result?: {
+    command: string;
+    state_before?: { serial: number; lineage: string };
+    state_after?: { serial: number; lineage: string };
+  };
+  code_changes?: RunCodeChanges;
   error_message?: string;
+  failure_category?: FailureCategory;
+  failure_hint?: string;
+  command_exit?: CommandExit;
+  state_lock?: StateLock;
   work_dir: string;
+  runner_url?: string; // Runner the run executes on
   approved_by?: string;
   approved_at?: string;
+  approval_comment?: string;
+  change_ticket?: string;
+  apply_not_before?: string;
+  concurrency_group?: string; // Approved runs of the group apply one at a time
+  required_features?: string[]; // Version-dependent language features the configuration uses
   created_at: string;
   started_at?: string;
   completed_at?: string;
 }
 
-export interface DeploymentRunCreate {
+export type LogFormat = 'raw' | 'plain' | 'html';
+
+// Logs of a run in one format (GET .../runs/:runId/logs); html is escaped markup for a <pre>
+export interface RunLogs {
+  format: LogFormat;
+  init_log: string;
+  plan_log: string;
+  apply_log: string;
+  hook_log: string;
+}
+
+// Snapshot of everything a run started with (GET .../runs/:runId/manifest)
+export interface RunManifest {
+  run_id: string;
+  recorded_at: string;
+  reproduces_run_id?: string;
+  git_url: string;
+  ref: string;
+  commit_sha?: string;
+  path: string;
+  workspace?: string;
+  operation: string;
+  tool: IaCTool;
+  tool_version?: string;
+  terragrunt?: TerragruntOptions;
+  image?: string;
+  init_flags?: string;
+  plan_flags?: string;
+  tfvars_files: string[];
+  tfvars_sha256?: Record<string, string>;
+  env_vars: string[]; // Names only
+  env_var_sources?: Record<string, 'platform' | 'namespace' | 'run' | 'input'>;
+  inputs?: { variable: string; source_run_id: string; output: string }[];
+  pre_hooks?: RunHook[];
+  post_hooks?: RunHook[];
+  validate?: boolean;
+  policy_checks?: RunHook[];
+  clone: CloneOptions;
+  plan_validity_minutes: number;
+  auto_approve: boolean;
+  platform_config: boolean;
+  runner_url: string;
+  runner?: string;
+}
+
+// Run as listed by the cross-deployment run search
+export interface RunSummary {
+  id: string;
   deployment_id: string;
+  deployment_name: string;
+  namespace: string;
   path: string;
   ref: string;
-  tool: 'terraform' | 'tofu';
+  commit_sha?: string;
+  tool: string;
+  operation: string;
+  status: string;
+  error_message?: string;
+  failure_category?: FailureCategory;
+  approved_by?: string;
+  created_at: string;
+  started_at?: string;
+  completed_at?: string;
+}
+
+// State lock a run failed on, as reported by terraform
+export interface StateLock {
+  id: string;
+  path?: string;
+  operation?: string;
+  who?: string;
+  version?: string;
+  created?: string;
+}
+
+export type FailureCategory = 'state_lock' | 'provider_auth' | 'quota_exceeded' | 'syntax_error' | 'timeout' | 'out_of_memory' | 'other';
+
+// How the runner command that failed a run ended
+export interface CommandExit {
+  command: string; // e.g. "terraform apply", "hook lint"
+  reason: 'exit' | 'signal' | 'timeout' | 'oom_killed' | 'start_failed';
+  exit_code?: number;
+  signal?: string;
+  message?: string;
+}
+
+export interface RunSearchParams {
+  status?: string; // Comma-separated
+  namespace?: string;
+  deployment_id?: string;
+  path?: string;
+  ref?: string;
+  failure_category?: FailureCategory;
+  approved_by?: string;
+  since?: string;
+  until?: string;
+  q?: string;
+  limit?: number;
+  offset?: number;
+}
+
+// Files changed since the last successful apply of the run's path
+export interface RunCodeChanges {
+  base_run_id: string;
+  base_commit_sha: string;
+  commit_sha: string;
+  changed_files: string[];
+  error?: string;
+}
+
+export interface StackPath {
+  path: string;
+  depends_on?: string[];
+}
+
+export interface StackNode {
+  path: string;
+  depends_on: string[];
+  level: number;
+  run_id?: string;
+  status: DeploymentRun['status'] | 'waiting' | 'skipped';
+  started_at?: string;
+  completed_at?: string;
+}
+
+export interface StackRun {
+  id: string;
+  deployment_id: string;
+  ref: string;
+  commit_sha: string;
+  tool: IaCTool;
+  env_vars: Record<string, string>; // Values are redacted ("********")
+  tfvars_files: string[];
+  init_flags: string;
+  plan_flags: string;
+  terraform_workspace?: string;
+  operation: 'apply' | 'destroy';
+  paths: StackPath[];
+  config_file?: string;
+  status: 'pending' | 'running' | 'awaiting_approval' | 'success' | 'failed' | 'cancelled';
+  error_message?: string;
+  counts: Record<string, number>;
+  nodes: StackNode[];
+  edges: { from: string; to: string }[];
+  levels: string[][];
+  created_at: string;
+  started_at?: string;
+  completed_at?: string;
+}
+
+export type PipelineStageName = 'clone' | 'pre_hooks' | 'init' | 'validate' | 'plan' | 'policy' | 'approval' | 'apply' | 'outputs' | 'post_hooks';
+
+export interface DeploymentRunStage {
+  name: PipelineStageName;
+  status: 'pending' | 'running' | 'success' | 'failed' | 'skipped' | 'cancelled' | 'stale' | 'expired';
+  started_at?: string;
+  completed_at?: string;
+  duration_seconds?: number;
+  log?: string;
+  error?: string;
+  reused?: boolean;
+}
+
+export interface ApplyResourceResult {
+  address: string;
+  action: string;
+  status: 'pending' | 'complete' | 'errored';
+  id_value?: string;
+  elapsed_seconds?: number;
+  error?: string;
+}
+
+export type PlanAction = 'create' | 'update' | 'replace' | 'delete' | 'forget' | 'read' | 'import' | 'move';
+
+export interface PlanChange {
+  address: string;
+  action: PlanAction;
+  summary: string;
+  forces?: string[];
+  reason?: string;
+  previous_address?: string;
+  deposed?: string;
+}
+
+export interface PlanSummary {
+  run_id: string;
+  status: string;
+  available: boolean;
+  terraform_version?: string;
+  counts: Partial<Record<PlanAction, number>>;
+  groups: { action: PlanAction; changes: PlanChange[] }[];
+  outputs: { name: string; action: string }[];
+}
+
+export interface RunInput {
+  deployment_id: string;
+  path?: string;
+  output: string;
+  variable?: string;
+}
+
+export interface DeploymentRunInput {
+  variable: string;
+  source_deployment_id: string;
+  source_deployment_name?: string;
+  source_run_id: string;
+  source_path: string;
+  output: string;
+  sensitive: boolean;
+  created_at: string;
+}
+
+export interface DeploymentDependency {
+  deployment_id: string;
+  name: string;
+  namespace: string;
+  outputs: string[];
+  last_run_id: string;
+  last_used_at: string;
+}
+
+// Outputs of a deployment path as of its latest successful apply
+export interface DeploymentOutputs {
+  path: string;
+  run_id: string;
+  commit_sha?: string;
+  applied_at: string;
+  outputs: Record<string, unknown>;
+  sensitive_outputs: string[]; // names only, values are never returned
+}
+
+export interface DeploymentDependencies {
+  upstream: DeploymentDependency[];
+  downstream: DeploymentDependency[];
+}
+
+export interface DeploymentRunCreate {
+  deployment_id: string;
+  path: string;
+  ref?: string;
+  commit_sha?: string;
+  tool?: IaCTool; // default: tool in platform.yaml
   env_vars?: Record<string, string>;
   tfvars_files?: string[];
   init_flags?: string;
   plan_flags?: string;
+  terraform_workspace?: string;
+  inputs?: RunInput[];
 }
 
 export interface DeploymentRunApproval {
   approved: boolean;
   approved_by?: string;
+  comment?: string;
+  change_ticket?: string;
+  apply_not_before?: string;
 }
 
 export interface DirectoryStatus {
   path: string;
   last_run?: DeploymentRun;
-  status: 'none' | 'pending' | 'success' | 'running' | 'failed' | 'initializing' | 'planning' | 'awaiting_approval' | 'applying' | 'cancelled';
-  status_color: 'blue' | 'green' | 'yellow' | 'red' | 'purple' | 'gray';
+  status: 'none' | 'pending' | 'success' | 'running' | 'failed' | 'initializing' | 'planning' | 'awaiting_approval' | 'applying' | 'runner_unreachable' | 'cancelled' | 'stale' | 'expired';
+  status_color: 'blue' | 'green' | 'yellow' | 'red' | 'purple' | 'gray' | 'orange';
 }
 
 export interface ProviderPlatformCreate {
@@ -258,3 +973,260 @@ export interface ProviderVersionCreate {
   protocols?: string[];
   platforms: ProviderPlatformCreate[];
 }
+
+// Result of reconciling provider files under BUILD_DIR with the database
+export interface ArtifactReport {
+  dry_run: boolean;
+  scanned: number;
+  orphaned: {
+    path: string;
+    size: number;
+    modified_at: string;
+    removed: boolean;
+    error?: string;
+  }[];
+  missing: {
+    platform_id: string;
+    provider_id: string;
+    namespace: string;
+    provider: string;
+    version: string;
+    os: string;
+    arch: string;
+    path: string;
+  }[];
+  removed: number;
+  reclaimed_bytes: number;
+  skipped_recent: number;
+  deduplicated: number;
+  blobs: number;
+  blob_bytes: number;
+  saved_bytes: number;
+}
+
+// Health of stored git credentials (private repositories only)
+export type CredentialStatus = 'valid' | 'expiring' | 'expired' | 'invalid';
+
+export interface CredentialHealth {
+  resource_type: 'modules' | 'providers' | 'deployments';
+  resource_id: string;
+  name: string;
+  url: string;
+  status?: CredentialStatus;
+  error?: string;
+  checked_at?: string;
+  expires_at?: string;
+}
+
+// Banner shown in the frontend, global or attached to a namespace, module or provider
+export interface Announcement {
+  id: string;
+  title: string;
+  message: string;
+  severity: 'info' | 'warning' | 'critical';
+  namespace_id?: string;
+  module_id?: string;
+  provider_id?: string;
+  starts_at: string;
+  ends_at?: string;
+  active: boolean;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface AnnouncementCreate {
+  title: string;
+  message?: string;
+  severity?: 'info' | 'warning' | 'critical';
+  namespace_id?: string;
+  module_id?: string;
+  provider_id?: string;
+  starts_at?: string;
+  ends_at?: string;
+}
+
+// Fields of an announcement to change; ends_at null shows it until deleted
+export type AnnouncementUpdate = Partial<Omit<AnnouncementCreate, 'namespace_id' | 'module_id' | 'provider_id' | 'ends_at'>> & {
+  ends_at?: string | null;
+};
+
+// Something waiting for the calling API key
+export interface InboxItem {
+  id: string; // pass to inboxApi.markRead
+  kind: 'run_approval' | 'credential_expiration';
+  title: string;
+  target_type: 'run' | 'modules' | 'providers' | 'deployments';
+  target_id: string;
+  parent_id?: string; // deployment of a run
+  namespace_id: string;
+  namespace: string;
+  due_at?: string;
+  read: boolean;
+  created_at: string;
+}
+
+export interface Inbox {
+  items: InboxItem[];
+  unread: number;
+}
+
+export type DigestFrequency = 'daily' | 'weekly';
+
+// An email address receiving the activity digest of a namespace (or of all namespaces)
+export interface DigestSubscription {
+  id: string;
+  email: string;
+  namespace_id?: string;
+  frequency: DigestFrequency;
+  last_sent_at?: string;
+  created_at: string;
+}
+
+export interface DigestSubscriptionCreate {
+  email: string;
+  namespace_id?: string;
+  frequency: DigestFrequency;
+}
+
+// Activity of one namespace during a digest's period
+export interface NamespaceDigest {
+  namespace_id: string;
+  namespace: string;
+  new_versions: { kind: 'module' | 'provider'; id: string; name: string; version: string; enabled: boolean; created_at: string }[];
+  failed_runs: { run_id: string; deployment_id: string; deployment: string; path: string; operation: string; failure_category?: FailureCategory; completed_at: string }[];
+  expiring_credentials: { resource_type: CredentialHealth['resource_type']; resource_id: string; name: string; status: 'expiring' | 'expired'; expires_at?: string }[];
+}
+
+export interface Digest {
+  since: string;
+  until: string;
+  namespaces: NamespaceDigest[];
+}
+
+export interface AuditEvent {
+  id: string;
+  action: string;
+  actor: string;
+  target_type: string;
+  target_id: string;
+  details?: Record<string, unknown>;
+  created_at: string;
+}
+
+// Authentication anomaly flagged for security review
+export interface SecurityAlert {
+  id: string;
+  type: 'brute_force' | 'new_location' | 'volume_spike';
+  api_key_id?: string;
+  api_key_name?: string;
+  client_ip: string;
+  location?: string; // "country:XX" or "net:<cidr>"
+  details?: Record<string, unknown>;
+  created_at: string;
+  acknowledged_at?: string;
+  acknowledged_by?: string;
+}
+
+// Client IP or key refused after repeated failed authentication
+export interface AuthLockout {
+  subject: string; // "ip:<address>" or "key:<hash prefix>"
+  failures: number;
+  locked_until: string;
+}
+
+// Registry lookup cache counters (per backend instance)
+export interface RegistryCacheStats {
+  enabled: boolean;
+  ttl_seconds: number;
+  max_entries: number;
+  entries: number;
+  groups: number;
+  hits: number;
+  misses: number;
+  loads: number;
+  evictions: number;
+  invalidations: number;
+  hit_rate: number;
+}
+
+// State of a background job (GET /api/admin/jobs)
+export interface BackgroundJob {
+  name: string;
+  description: string;
+  trigger: 'interval' | 'tick' | 'event';
+  interval_seconds?: number;
+  status: 'ok' | 'running' | 'failing' | 'overdue' | 'paused' | 'disabled' | 'idle';
+  last_run_at?: string;
+  last_finished_at?: string;
+  last_duration_ms?: number;
+  processed?: number; // Items the last run processed
+  last_error?: string;
+  last_success_at?: string;
+  consecutive_failures: number;
+  instance?: string;
+}
+
+// Notification the webhook did not accept after all retries (GET /api/admin/dead-letters)
+export interface DeadLetter {
+  id: string;
+  event_type: string;
+  payload: Record<string, unknown>; // The event as it was posted
+  attempts: number;
+  last_error: string;
+  created_at: string;
+  last_attempt_at: string;
+  redelivered_at?: string;
+  redelivered_by?: string;
+}
+
+// Maintenance mode: changes are rejected with 503 while registry downloads keep working
+export interface MaintenanceState {
+  enabled: boolean;
+  message?: string;
+  ends_at?: string;
+  source?: 'env' | 'api';
+  enabled_by?: string;
+  enabled_at?: string;
+}
+
+// Rollout of a feature flag: on for everyone, for the namespaces listed, or for a
+// percentage of namespaces
+export interface FeatureFlag {
+  key: 'auto_apply' | 'network_mirror';
+  description: string;
+  enabled: boolean;
+  namespaces: string[];
+  percentage: number;
+  stored: boolean; // false while the flag has its default
+  updated_by?: string;
+  updated_at?: string;
+}
+
+// Allowlisted host for git repositories or mirrored provider artifacts
+export interface SourceHost {
+  id: string;
+  kind: 'git' | 'artifact';
+  pattern: string; // host, or .domain / *.domain
+  description?: string;
+  created_at: string;
+}
+
+// Frontend session (cookie-based, in place of an API key)
+export interface Session {
+  key_name: string;
+  permissions: 'read' | 'write' | 'approver' | 'admin';
+  csrf_token: string;
+  created_at: string;
+  expires_at: string;
+}
+
+// Terraform CLI credentials for this registry (GET /setup/cli)
+export interface CLISetup {
+  host: string;
+  api_key_included: boolean; // false: replace <your-api-key>
+  terraformrc: string;
+  credentials_tfrc_json: string;
+  env?: Record<string, string>; // TF_TOKEN_<host>, absent for hosts with a port
+  bash: string;
+  powershell: string;
+}
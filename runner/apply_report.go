@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ResourceResult describes what happened to a single resource during apply
+type ResourceResult struct {
+	Address        string  `json:"address"`
+	Action         string  `json:"action"` // "create", "update", "delete", "replace", "read", ...
+	Status         string  `json:"status"` // "pending", "complete", "errored"
+	IDValue        string  `json:"id_value,omitempty"`
+	ElapsedSeconds float64 `json:"elapsed_seconds,omitempty"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// applyReport collects resource results from `apply -json` output
+type applyReport struct {
+	order     []string
+	resources map[string]*ResourceResult
+}
+
+// applyEvent is the subset of terraform's machine-readable UI output we care about
+type applyEvent struct {
+	Message string `json:"@message"`
+	Type    string `json:"type"`
+	Hook    struct {
+		Resource struct {
+			Addr string `json:"addr"`
+		} `json:"resource"`
+		Action         string  `json:"action"`
+		IDValue        string  `json:"id_value"`
+		ElapsedSeconds float64 `json:"elapsed_seconds"`
+	} `json:"hook"`
+	Diagnostic struct {
+		Severity string `json:"severity"`
+		Summary  string `json:"summary"`
+		Detail   string `json:"detail"`
+		Address  string `json:"address"`
+	} `json:"diagnostic"`
+}
+
+func newApplyReport() *applyReport {
+	return &applyReport{resources: make(map[string]*ResourceResult)}
+}
+
+// handleLine records a JSON output line and returns the human-readable message for the logs.
+// Lines that are not JSON are returned unchanged.
+func (r *applyReport) handleLine(line string) string {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "{") {
+		return line
+	}
+
+	var event applyEvent
+	if err := json.Unmarshal([]byte(trimmed), &event); err != nil {
+		return line
+	}
+
+	switch event.Type {
+	case "apply_start":
+		res := r.resource(event.Hook.Resource.Addr)
+		res.Action = event.Hook.Action
+		res.Status = "pending"
+	case "apply_complete":
+		res := r.resource(event.Hook.Resource.Addr)
+		res.Action = event.Hook.Action
+		res.Status = "complete"
+		res.IDValue = event.Hook.IDValue
+		res.ElapsedSeconds = event.Hook.ElapsedSeconds
+	case "apply_errored":
+		res := r.resource(event.Hook.Resource.Addr)
+		res.Action = event.Hook.Action
+		res.Status = "errored"
+		res.ElapsedSeconds = event.Hook.ElapsedSeconds
+	case "diagnostic":
+		if event.Diagnostic.Severity == "error" && event.Diagnostic.Address != "" {
+			res := r.resource(event.Diagnostic.Address)
+			res.Status = "errored"
+			res.Error = strings.TrimSpace(event.Diagnostic.Summary + ": " + event.Diagnostic.Detail)
+		}
+		if event.Diagnostic.Detail != "" {
+			return event.Message + "\n" + event.Diagnostic.Detail
+		}
+	}
+
+	return event.Message
+}
+
+func (r *applyReport) resource(address string) *ResourceResult {
+	res, ok := r.resources[address]
+	if !ok {
+		res = &ResourceResult{Address: address}
+		r.resources[address] = res
+		r.order = append(r.order, address)
+	}
+	return res
+}
+
+// results returns a snapshot of the resource results in the order they were first seen
+func (r *applyReport) results() []ResourceResult {
+	results := make([]ResourceResult, 0, len(r.order))
+	for _, address := range r.order {
+		results = append(results, *r.resources[address])
+	}
+	return results
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/gin-gonic/gin"
+)
+
+// deploymentsRoot is where deployments get their working directories
+const deploymentsRoot = "/tmp/iac-deployments"
+
+// versionCheckTimeout bounds each `<tool> version` call of a capabilities check
+const versionCheckTimeout = 10 * time.Second
+
+// ToolCapability reports whether a binary is installed and its version
+type ToolCapability struct {
+	Installed bool   `json:"installed"`
+	Version   string `json:"version,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// Every installed version, newest first, for tools with several (see RUNNER_TOOLS_DIR)
+	Versions []string `json:"versions,omitempty"`
+}
+
+// DiskCapability is the space left for deployment working directories
+type DiskCapability struct {
+	Path       string `json:"path"`
+	FreeBytes  uint64 `json:"free_bytes"`
+	TotalBytes uint64 `json:"total_bytes"`
+}
+
+// Capabilities describes what this runner can execute. The backend uses it to check
+// that a run's tool is installed before starting the run.
+type Capabilities struct {
+	Status    string                    `json:"status"`   // "healthy", or "degraded" when no IaC tool works
+	Executor  string                    `json:"executor"` // "local" or "docker"
+	Tools     map[string]ToolCapability `json:"tools"`    // Registered tools (see plugins) and git
+	Disk      *DiskCapability           `json:"disk,omitempty"`
+	PTY       bool                      `json:"pty"` // Colored output through a pseudo-terminal
+	CheckedAt time.Time                 `json:"checked_at"`
+}
+
+// handleCapabilities reports the installed tool versions, free disk space and PTY support
+func handleCapabilities(c *gin.Context) {
+	c.JSON(200, checkCapabilities())
+}
+
+// checkCapabilities runs the version command of every tool and probes disk and PTY
+func checkCapabilities() Capabilities {
+	caps := Capabilities{
+		Status:    "degraded",
+		Executor:  "local",
+		Tools:     map[string]ToolCapability{},
+		CheckedAt: time.Now(),
+	}
+	if os.Getenv("RUNNER_EXECUTOR") == "docker" {
+		caps.Executor = "docker"
+	}
+
+	for name := range plugins {
+		caps.Tools[name] = checkTool(name, toolVersion(name))
+		if _, versioned := versionFiles[name]; versioned {
+			capability := caps.Tools[name]
+			installed := installedVersions(name)
+			for _, t := range installed {
+				capability.Versions = append(capability.Versions, t.version)
+			}
+			if !capability.Installed && len(installed) > 0 {
+				// Only in RUNNER_TOOLS_DIR
+				capability = ToolCapability{Installed: true, Version: installed[0].version, Path: installed[0].path, Versions: capability.Versions}
+			}
+			caps.Tools[name] = capability
+		}
+		if caps.Tools[name].Installed {
+			caps.Status = "healthy"
+		}
+	}
+	caps.Tools["git"] = checkTool("git", func(ctx context.Context, path string) (string, error) {
+		out, err := exec.CommandContext(ctx, path, "--version").Output()
+		return strings.TrimPrefix(strings.TrimSpace(string(out)), "git version "), err
+	})
+
+	if err := os.MkdirAll(deploymentsRoot, 0755); err == nil {
+		var stat syscall.Statfs_t
+		if syscall.Statfs(deploymentsRoot, &stat) == nil {
+			caps.Disk = &DiskCapability{
+				Path:       deploymentsRoot,
+				FreeBytes:  stat.Bavail * uint64(stat.Bsize),
+				TotalBytes: stat.Blocks * uint64(stat.Bsize),
+			}
+		}
+	}
+
+	if ptmx, tty, err := pty.Open(); err == nil {
+		caps.PTY = true
+		tty.Close()
+		ptmx.Close()
+	}
+
+	return caps
+}
+
+// checkTool looks the binary up in PATH and asks it for its version
+func checkTool(binary string, version func(ctx context.Context, path string) (string, error)) ToolCapability {
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return ToolCapability{Error: err.Error()}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), versionCheckTimeout)
+	defer cancel()
+	v, err := version(ctx, path)
+	if err != nil {
+		return ToolCapability{Path: path, Error: "version check failed: " + err.Error()}
+	}
+	return ToolCapability{Installed: true, Version: v, Path: path}
+}
+
+// toolVersion returns the version check of an IaC tool. terraform and tofu report
+// their version as JSON; terragrunt only as text.
+func toolVersion(tool string) func(ctx context.Context, path string) (string, error) {
+	if tool == "terragrunt" {
+		return func(ctx context.Context, path string) (string, error) {
+			out, err := exec.CommandContext(ctx, path, "--version").Output()
+			return strings.TrimPrefix(strings.TrimSpace(string(out)), "terragrunt version "), err
+		}
+	}
+	return func(ctx context.Context, path string) (string, error) {
+		out, err := exec.CommandContext(ctx, path, "version", "-json").Output()
+		if err != nil {
+			return "", err
+		}
+		var v struct {
+			TerraformVersion string `json:"terraform_version"`
+		}
+		if err := json.Unmarshal(out, &v); err != nil {
+			return "", err
+		}
+		return v.TerraformVersion, nil
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// CommandExit describes how the command that failed a deployment ended, so a timeout, an
+// out-of-memory kill and an ordinary non-zero exit can be told apart
+type CommandExit struct {
+	Command  string `json:"command"`             // e.g. "terraform plan", "hook lint", "git fetch"
+	Reason   string `json:"reason"`              // "exit", "signal", "timeout", "oom_killed" or "start_failed"
+	ExitCode *int   `json:"exit_code,omitempty"` // Exit status, when the process exited
+	Signal   string `json:"signal,omitempty"`    // Signal that killed the process, e.g. "SIGKILL"
+	Message  string `json:"message,omitempty"`
+}
+
+// signalNames names the signals commands are commonly killed with
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGTERM: "SIGTERM",
+}
+
+// dockerOOMExitCode is the status docker run exits with when the container was SIGKILLed,
+// which the memory limit does when the container exceeds it
+const dockerOOMExitCode = 128 + int(syscall.SIGKILL)
+
+// oomKills returns how many processes of the run's cgroup the kernel killed for exceeding
+// its memory limit so far; 0 without per-run cgroups
+func oomKills(deployment *Deployment) int {
+	runCgroups.Lock()
+	dir, ok := runCgroups.dirs[deployment.WorkDir]
+	runCgroups.Unlock()
+	if !ok {
+		return 0
+	}
+	content, err := os.ReadFile(filepath.Join(dir.Name(), "memory.events"))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if value, ok := strings.CutPrefix(line, "oom_kill "); ok {
+			n, _ := strconv.Atoi(strings.TrimSpace(value))
+			return n
+		}
+	}
+	return 0
+}
+
+// commandExit describes how a command that returned err ended. ctx is the command's
+// context and oomBefore the run's oomKills before it started.
+func commandExit(ctx context.Context, deployment *Deployment, command string, err error, oomBefore int) *CommandExit {
+	exit := &CommandExit{Command: command, Message: err.Error()}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		exit.Reason = "start_failed"
+		if ctx.Err() == context.DeadlineExceeded {
+			exit.Reason = "timeout"
+		}
+		return exit
+	}
+
+	status, _ := exitErr.Sys().(syscall.WaitStatus)
+	if status.Signaled() {
+		exit.Reason = "signal"
+		exit.Signal = signalNames[status.Signal()]
+		if exit.Signal == "" {
+			exit.Signal = fmt.Sprintf("signal %d", int(status.Signal()))
+		}
+	} else {
+		code := exitErr.ExitCode()
+		exit.ExitCode = &code
+		exit.Reason = "exit"
+	}
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		// exec.CommandContext kills the process when the timeout passes
+		exit.Reason = "timeout"
+	case oomKills(deployment) > oomBefore:
+		exit.Reason = "oom_killed"
+	case deployment.Request.Image != "" && sandbox.memory > 0 && exit.ExitCode != nil && *exit.ExitCode == dockerOOMExitCode:
+		exit.Reason = "oom_killed"
+	}
+	return exit
+}
+
+// recordExit keeps how the last failed command ended; it is reported if the stage fails
+func (d *Deployment) recordExit(exit *CommandExit) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastExit = exit
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Repositories, and their submodules, are only cloned from hosts allowed by both the
+// request's git_allowlist (the backend's admin-managed list) and RUNNER_GIT_ALLOWLIST
+// (comma-separated, for runners that should not trust the backend's list alone). An empty
+// list allows any host. Entries use the sandbox egress syntax: "host", ".domain" or
+// "*.domain".
+
+// runnerGitAllowlist returns the entries of RUNNER_GIT_ALLOWLIST
+func runnerGitAllowlist() []string {
+	var entries []string
+	for _, entry := range strings.Split(os.Getenv("RUNNER_GIT_ALLOWLIST"), ",") {
+		if entry = strings.ToLower(strings.TrimSpace(entry)); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// gitURLHost returns the host of an https://, ssh:// or scp-like (git@host:path) URL;
+// empty for local paths and file:// URLs
+func gitURLHost(repoURL string) string {
+	if strings.Contains(repoURL, "://") {
+		parsed, err := url.Parse(repoURL)
+		if err != nil {
+			return ""
+		}
+		return parsed.Hostname()
+	}
+	if colon := strings.Index(repoURL, ":"); colon > 0 && !strings.Contains(repoURL[:colon], "/") {
+		host := repoURL[:colon]
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			host = host[at+1:]
+		}
+		return host
+	}
+	return ""
+}
+
+// checkGitHost returns an error when the host of repoURL is not allowed for the request
+func checkGitHost(req DeploymentRequest, repoURL string) error {
+	host := gitURLHost(repoURL)
+	for _, list := range []struct {
+		name    string
+		entries []string
+	}{
+		{"the platform's git allowlist", req.GitAllowlist},
+		{"RUNNER_GIT_ALLOWLIST", runnerGitAllowlist()},
+	} {
+		if len(list.entries) > 0 && (host == "" || !hostMatches(host, list.entries)) {
+			return fmt.Errorf("refusing to clone %s: host %q is not allowed by %s", scrubCredentials(repoURL, req.GitAuth), host, list.name)
+		}
+	}
+	return nil
+}
+
+// gitAllowlistActive reports whether any allowlist restricts the request's clones
+func gitAllowlistActive(req DeploymentRequest) bool {
+	return len(req.GitAllowlist) > 0 || len(runnerGitAllowlist()) > 0
+}
+
+// updateSubmodules initialises the submodules of dir one level at a time, checking each
+// submodule URL against the allowlists before it is cloned. Relative URLs resolve against
+// the already allowed superproject and are accepted.
+func updateSubmodules(deployment *Deployment, dir string) error {
+	out, err := exec.Command("git", "-C", dir, "config", "--file", ".gitmodules", "--get-regexp", `^submodule\..*\.(path|url)$`).Output()
+	if err != nil {
+		// No .gitmodules, or no submodules in it
+		return nil
+	}
+	var paths []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		if strings.HasSuffix(key, ".path") {
+			paths = append(paths, value)
+			continue
+		}
+		if strings.HasPrefix(value, "./") || strings.HasPrefix(value, "../") {
+			continue
+		}
+		if err := checkGitHost(deployment.Request, value); err != nil {
+			return err
+		}
+	}
+
+	if err := runGit(deployment, "-C", dir, "submodule", "update", "--init", "--depth", "1"); err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := updateSubmodules(deployment, filepath.Join(dir, path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -10,10 +10,14 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"iac-shared/cors"
+
 	"github.com/creack/pty"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -21,17 +25,43 @@ import (
 
 // DeploymentRequest represents a deployment request
 type DeploymentRequest struct {
-	Tool        string            `json:"tool" binding:"required"`    // "terraform" or "tofu"
-	GitURL      string            `json:"git_url" binding:"required"` // Git repository URL
-	GitRef      string            `json:"git_ref" binding:"required"` // Branch, tag, or commit
-	Path        string            `json:"path"`                       // Path within repo (default: root)
-	EnvVars     map[string]string `json:"env_vars"`                   // Environment variables
-	TfvarsFiles []string          `json:"tfvars_files"`               // List of .tfvars files to use
-	InitFlags   string            `json:"init_flags"`                 // Custom flags for terraform init
-	PlanFlags   string            `json:"plan_flags"`                 // Custom flags for terraform plan
-	Timeout     int               `json:"timeout"`                    // Timeout in minutes (default: 60)
-	GitAuth     *GitAuth          `json:"git_auth,omitempty"`         // Git authentication
-	AutoApprove bool              `json:"auto_approve"`               // Auto-approve terraform apply
+	Tool          string             `json:"tool" binding:"required"`    // "terraform", "tofu", "terragrunt" or "auto" (see resolveTool)
+	ToolVersion   string             `json:"tool_version"`               // Exact terraform/tofu version to run (default: chosen from the repository's constraints)
+	Terragrunt    *TerragruntOptions `json:"terragrunt,omitempty"`       // Options for tool "terragrunt"
+	GitURL        string             `json:"git_url" binding:"required"` // Git repository URL
+	GitRef        string             `json:"git_ref" binding:"required"` // Branch, tag, or commit
+	Commit        string             `json:"commit"`                     // Exact commit SHA to check out instead of the tip of GitRef
+	Path          string             `json:"path"`                       // Path within repo (default: root)
+	EnvVars       map[string]string  `json:"env_vars"`                   // Environment variables
+	TfvarsFiles   []string           `json:"tfvars_files"`               // List of .tfvars files to use
+	InitFlags     string             `json:"init_flags"`                 // Custom flags for terraform init
+	PlanFlags     string             `json:"plan_flags"`                 // Custom flags for terraform plan
+	Workspace     string             `json:"workspace"`                  // CLI workspace to select before plan (optional)
+	PreHooks      []Hook             `json:"pre_hooks"`                  // Commands run before terraform init
+	PostHooks     []Hook             `json:"post_hooks"`                 // Commands run after terraform apply
+	Validate      bool               `json:"validate"`                   // Run terraform validate between init and plan
+	PolicyChecks  []Hook             `json:"policy_checks"`              // Commands run against the plan (TFPLAN_JSON) before approval
+	Image         string             `json:"image"`                      // Container image to run commands in (requires docker executor)
+	Destroy       bool               `json:"destroy"`                    // Plan and apply a destroy instead of changes
+	Timeout       int                `json:"timeout"`                    // Timeout in minutes (default: 60)
+	GitAuth       *GitAuth           `json:"git_auth,omitempty"`         // Git authentication
+	AutoApprove   bool               `json:"auto_approve"`               // Auto-approve terraform apply
+	PlanValidity  int                `json:"plan_validity"`              // Minutes a plan may await approval before the deployment expires (default: 1440)
+	Sparse        bool               `json:"sparse"`                     // Sparse, blob-filtered checkout of Path and SparsePaths only
+	SparsePaths   []string           `json:"sparse_paths"`               // Extra directories to check out in sparse mode
+	Submodules    bool               `json:"submodules"`                 // Initialise submodules after cloning
+	RegistryToken string             `json:"registry_token"`             // Scoped private registry token for this run (fetched from the backend if empty)
+	GitAllowlist  []string           `json:"git_allowlist"`              // Hosts repositories and submodules may be cloned from (empty: any)
+
+	toolPath string // Binary of the selected tool version (see resolveTool)
+}
+
+// Hook represents a custom shell command executed in the deployment path
+type Hook struct {
+	Name      string `json:"name,omitempty"`       // Display name (default: the command)
+	Command   string `json:"command"`              // Command run with sh -c
+	Timeout   int    `json:"timeout,omitempty"`    // Timeout in seconds (default: 300)
+	OnFailure string `json:"on_failure,omitempty"` // "fail" (default) aborts the run, "warn" continues
 }
 
 // GitAuth represents git authentication credentials (HTTPS only)
@@ -50,19 +80,33 @@ type DeploymentResponse struct {
 
 // DeploymentStatus represents the current status of a deployment
 type DeploymentStatus struct {
-	DeploymentID string     `json:"deployment_id"`
-	Status       string     `json:"status"` // "running", "success", "failed", "awaiting_approval"
-	Phase        string     `json:"phase"`  // "cloning", "init", "plan", "apply"
-	StartedAt    time.Time  `json:"started_at"`
-	EndedAt      *time.Time `json:"ended_at,omitempty"`
-	Error        string     `json:"error,omitempty"`
-	InitLog      string     `json:"init_log,omitempty"`
-	PlanLog      string     `json:"plan_log,omitempty"`
-	PlanOutput   string     `json:"plan_output,omitempty"`
-	ApplyLog     string     `json:"apply_log,omitempty"`
-	ApplyOutput  string     `json:"apply_output,omitempty"`
+	DeploymentID    string            `json:"deployment_id"`
+	Status          string            `json:"status"` // "running", "success", "failed", "awaiting_approval"
+	Phase           string            `json:"phase"`  // "cloning", "init", "plan", "apply"
+	StartedAt       time.Time         `json:"started_at"`
+	EndedAt         *time.Time        `json:"ended_at,omitempty"`
+	Error           string            `json:"error,omitempty"`
+	InitLog         string            `json:"init_log,omitempty"`
+	PlanLog         string            `json:"plan_log,omitempty"`
+	PlanOutput      string            `json:"plan_output,omitempty"`
+	ApplyLog        string            `json:"apply_log,omitempty"`
+	ApplyOutput     string            `json:"apply_output,omitempty"`
+	HookLog         string            `json:"hook_log,omitempty"`
+	ApplyReport     []ResourceResult  `json:"apply_report,omitempty"`
+	OperationResult *OperationResult  `json:"operation_result,omitempty"`
+	CommitSHA       string            `json:"commit_sha,omitempty"` // Commit checked out for the run
+	PlanJSON        json.RawMessage   `json:"plan_json,omitempty"`  // Resource changes of the plan, without attribute values
+	Stages          []StageResult     `json:"stages,omitempty"`     // Per-stage status, timing and logs of the pipeline
+	Tool            string            `json:"tool,omitempty"`       // Tool the deployment runs with, once resolved after the clone
+	ToolVersion     string            `json:"tool_version,omitempty"`
+	TfvarsSHA256    map[string]string `json:"tfvars_sha256,omitempty"` // SHA-256 of each tfvars file, once cloned
+	Runner          string            `json:"runner,omitempty"`        // Hostname of the runner executing the deployment
+	Exit            *CommandExit      `json:"exit,omitempty"`          // How the command that failed the deployment ended
 }
 
+// runnerHostname identifies this runner in deployment statuses
+var runnerHostname, _ = os.Hostname()
+
 // Deployment represents an active deployment
 type Deployment struct {
 	ID          string
@@ -73,40 +117,70 @@ type Deployment struct {
 	LogBuffer   []string // Store all logs for late subscribers
 	ApproveChan chan bool
 	CancelChan  chan bool
+	stage       int          // Index of the running pipeline stage, -1 between stages
+	planKey     []byte       // Key of the plan sealed while awaiting approval (see plan_seal.go)
+	lastExit    *CommandExit // How the last failed command ended, reported if its stage fails
 	mu          sync.RWMutex
 }
 
+// commitSHAPattern matches full SHA-1 and SHA-256 commit IDs
+var commitSHAPattern = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+
 var (
 	deployments = make(map[string]*Deployment)
 	deployMu    sync.RWMutex
 )
 
 func main() {
+	// Started as the simulated terraform or tofu (see simulate.go)
+	runAsSimulatedTool()
+
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
 
-	// CORS middleware with configurable origins
-	allowedOrigins := os.Getenv("ALLOWED_ORIGINS")
-	if allowedOrigins == "" {
-		allowedOrigins = "*"
+	// CORS for browser clients listed in ALLOWED_ORIGINS (none by default)
+	policy, err := cors.FromEnv(nil,
+		[]string{"GET", "POST", "OPTIONS"},
+		[]string{"Content-Type", "X-Registry-Token", signatureTimestampHeader, signatureNonceHeader, signatureHeader},
+	)
+	if err != nil {
+		log.Fatalf("Invalid CORS configuration: %v", err)
 	}
+	r.Use(cors.Middleware(policy))
 
-	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", allowedOrigins)
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-		c.Next()
-	})
+	// Strict-Transport-Security on HTTPS responses (see serve in security.go)
+	hstsMiddleware, err := hsts()
+	if err != nil {
+		log.Fatalf("Invalid TLS configuration: %v", err)
+	}
+	r.Use(hstsMiddleware)
+
+	// CA bundle and proxies for git clones and registry calls (see outbound.go)
+	if err := initOutbound(); err != nil {
+		log.Fatalf("Invalid outbound configuration: %v", err)
+	}
+
+	// Optional sandboxing of run commands (see sandbox.go)
+	if err := initSandbox(); err != nil {
+		log.Fatalf("Invalid sandbox configuration: %v", err)
+	}
+
+	// Fake terraform for end-to-end tests without cloud credentials (see simulate.go)
+	if err := initSimulation(); err != nil {
+		log.Fatalf("Failed to set up simulation mode: %v", err)
+	}
+
+	// Only the backend may call the runner (see security.go)
+	r.Use(requireSignature())
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "healthy"})
 	})
 
+	// Installed tools, disk space and PTY support
+	r.GET("/capabilities", handleCapabilities)
+
 	// Start a new deployment
 	r.POST("/deploy", handleDeploy)
 
@@ -125,8 +199,18 @@ func main() {
 	// Cancel/stop deployment
 	r.POST("/deploy/:id/cancel", handleCancel)
 
-	log.Println("Runner HTTP server starting on :8080")
-	if err := r.Run(":8080"); err != nil {
+	// Re-run a finished deployment from its failed stage
+	r.POST("/deploy/:id/retry", handleRetry)
+
+	// Import existing resources into a finished deployment's state
+	r.POST("/deploy/:id/import", handleImport)
+
+	// State surgery on a finished deployment's state
+	r.POST("/deploy/:id/state/mv", handleStateMove)
+	r.POST("/deploy/:id/state/rm", handleStateRemove)
+	r.POST("/deploy/:id/force-unlock", handleForceUnlock)
+
+	if err := serve(r, ":8080"); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
@@ -142,10 +226,40 @@ func handleDeploy(c *gin.Context) {
 	if req.Timeout <= 0 {
 		req.Timeout = 60
 	}
+	if req.PlanValidity <= 0 {
+		req.PlanValidity = 24 * 60
+	}
 	if req.Path == "" {
 		req.Path = "."
 	}
 
+	if err := validTool(req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Paths and flags must stay within the clone and away from the runner's own options
+	if err := sanitizeRequest(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Commit != "" && !commitSHAPattern.MatchString(req.Commit) {
+		c.JSON(400, gin.H{"error": "commit must be a full hexadecimal commit SHA"})
+		return
+	}
+
+	// Custom images need an executor that can start containers
+	if req.Image != "" && executor() != "docker" {
+		c.JSON(400, gin.H{"error": "Custom images require RUNNER_EXECUTOR=docker"})
+		return
+	}
+	// An image brings its own terraform, which the simulation cannot replace
+	if req.Image != "" && simulating() {
+		c.JSON(400, gin.H{"error": "Custom images are not simulated: RUNNER_SIMULATE=true refuses runs with an image"})
+		return
+	}
+
 	// Create deployment
 	deploymentID := uuid.New().String()
 	deployment := &Deployment{
@@ -160,6 +274,7 @@ func handleDeploy(c *gin.Context) {
 			Status:       "running",
 			Phase:        "initializing",
 			StartedAt:    time.Now(),
+			Runner:       runnerHostname,
 		},
 	}
 
@@ -191,6 +306,7 @@ func handleStatus(c *gin.Context) {
 
 	deployment.mu.RLock()
 	status := deployment.Status
+	status.Stages = append([]StageResult(nil), deployment.Status.Stages...)
 	deployment.mu.RUnlock()
 
 	c.JSON(200, status)
@@ -294,22 +410,12 @@ func handleCancel(c *gin.Context) {
 	}
 }
 
+// executeDeployment runs the full pipeline of a new deployment in its own work directory
 func executeDeployment(deployment *Deployment) {
 	defer close(deployment.LogChan)
 
-	// Helper to check for cancellation
-	checkCancel := func() bool {
-		select {
-		case <-deployment.CancelChan:
-			deployment.updateStatus("cancelled", "", "Deployment cancelled by user")
-			return true
-		default:
-			return false
-		}
-	}
-
 	// Create working directory
-	workDir := filepath.Join("/tmp/iac-deployments", deployment.ID)
+	workDir := filepath.Join(deploymentsRoot, deployment.ID)
 	if err := os.MkdirAll(workDir, 0755); err != nil {
 		deployment.updateStatus("failed", "", fmt.Sprintf("Failed to create work directory: %v", err))
 		return
@@ -320,192 +426,168 @@ func executeDeployment(deployment *Deployment) {
 	defer func() {
 		time.AfterFunc(24*time.Hour, func() {
 			os.RemoveAll(workDir)
+			removeRunCgroup(workDir)
 		})
 	}()
 
-	// Clone repository
-	if checkCancel() {
-		return
-	}
-	deployment.updateStatus("running", "cloning", "")
-	deployment.log("Cloning repository...")
-	if err := gitClone(deployment); err != nil {
-		deployment.updateStatus("failed", "cloning", fmt.Sprintf("Git clone failed: %v", err))
-		return
-	}
+	deployment.initStages(nil, 0)
+	runPipeline(deployment, 0)
+}
 
-	// Navigate to deployment path
-	deployPath := filepath.Join(workDir, deployment.Request.Path)
-	if _, err := os.Stat(deployPath); os.IsNotExist(err) {
-		deployment.updateStatus("failed", "cloning", fmt.Sprintf("Path does not exist: %s", deployment.Request.Path))
-		return
-	}
+func gitClone(deployment *Deployment) error {
+	req := deployment.Request
 
-	// Terraform init
-	if checkCancel() {
-		return
+	// Credentials are answered by the askpass helper (see runGit), never put in the URL
+	gitURL := req.GitURL
+	if err := checkGitHost(req, gitURL); err != nil {
+		return err
 	}
-	deployment.updateStatus("running", "init", "")
-	deployment.log("Running terraform init...")
 
-	// Parse custom init flags
-	var initArgs []string
-	if deployment.Request.InitFlags != "" {
-		initArgs = parseShellArgs(deployment.Request.InitFlags)
-		deployment.log(fmt.Sprintf("Using custom init flags: %s", deployment.Request.InitFlags))
-	}
+	// Only fetch the trees needed for the run; blobs outside them are never downloaded
+	sparse := req.Sparse && req.Path != "" && req.Path != "."
+	sparsePaths := append([]string{req.Path}, req.SparsePaths...)
 
-	initLog, err := runTerraformCommand(deployment, deployPath, "init", initArgs)
-	deployment.Status.InitLog = initLog
-	if err != nil {
-		deployment.updateStatus("failed", "init", fmt.Sprintf("Init failed: %v", err))
-		return
-	}
+	if req.Commit != "" {
+		// git clone cannot check out a commit directly, so fetch exactly that commit
+		deployment.log(fmt.Sprintf("Checking out pinned commit %s", req.Commit))
+		if err := runGit(deployment, "init", "-q", deployment.WorkDir); err != nil {
+			return err
+		}
+		if err := runGit(deployment, "-C", deployment.WorkDir, "remote", "add", "--", "origin", gitURL); err != nil {
+			return err
+		}
+		fetchArgs := []string{"-C", deployment.WorkDir, "fetch", "--depth", "1"}
+		if sparse {
+			deployment.log(fmt.Sprintf("Sparse checkout: %s", strings.Join(sparsePaths, ", ")))
+			if err := runGit(deployment, append([]string{"-C", deployment.WorkDir, "sparse-checkout", "set", "--"}, sparsePaths...)...); err != nil {
+				return fmt.Errorf("sparse checkout failed: %w", err)
+			}
+			fetchArgs = append(fetchArgs, "--filter=blob:none")
+		}
+		if err := runGit(deployment, append(fetchArgs, "origin", req.Commit)...); err != nil {
+			return fmt.Errorf("commit %s could not be fetched: %w", req.Commit, err)
+		}
+		if err := runGit(deployment, "-C", deployment.WorkDir, "checkout", "-q", "FETCH_HEAD"); err != nil {
+			return err
+		}
+	} else {
+		args := []string{"clone", "--depth", "1", "--branch", req.GitRef}
+		if sparse {
+			args = append(args, "--filter=blob:none", "--sparse")
+		}
+		args = append(args, "--", gitURL, deployment.WorkDir)
 
-	// Terraform plan
-	if checkCancel() {
-		return
-	}
-	deployment.updateStatus("running", "plan", "")
-	deployment.log("Running terraform plan...")
-	planArgs := []string{"-out=tfplan"}
+		if err := runGit(deployment, args...); err != nil {
+			return err
+		}
 
-	// Add custom plan flags
-	if deployment.Request.PlanFlags != "" {
-		customFlags := parseShellArgs(deployment.Request.PlanFlags)
-		planArgs = append(planArgs, customFlags...)
-		deployment.log(fmt.Sprintf("Using custom plan flags: %s", deployment.Request.PlanFlags))
+		if sparse {
+			deployment.log(fmt.Sprintf("Sparse checkout: %s", strings.Join(sparsePaths, ", ")))
+			if err := runGit(deployment, append([]string{"-C", deployment.WorkDir, "sparse-checkout", "set", "--"}, sparsePaths...)...); err != nil {
+				return fmt.Errorf("sparse checkout failed: %w", err)
+			}
+		}
 	}
 
-	// Add tfvars files
-	for _, tfvarsFile := range deployment.Request.TfvarsFiles {
-		planArgs = append(planArgs, "-var-file="+tfvarsFile)
-		deployment.log(fmt.Sprintf("Using tfvars file: %s", tfvarsFile))
-	}
-	planLog, err := runTerraformCommand(deployment, deployPath, "plan", planArgs)
-	deployment.Status.PlanLog = planLog
+	// Record the exact commit so the run can be reproduced after the ref moves
+	out, err := exec.Command("git", "-C", deployment.WorkDir, "rev-parse", "HEAD").Output()
 	if err != nil {
-		deployment.updateStatus("failed", "plan", fmt.Sprintf("Plan failed: %v", err))
-		return
+		return fmt.Errorf("failed to resolve commit: %w", err)
 	}
+	commit := strings.TrimSpace(string(out))
+	deployment.setCommitSHA(commit)
+	deployment.log(fmt.Sprintf("Commit: %s", commit))
 
-	// Wait for approval if not auto-approved
-	if !deployment.Request.AutoApprove {
-		deployment.updateStatus("awaiting_approval", "plan", "")
-		deployment.log("Waiting for approval...")
-
-		select {
-		case approved := <-deployment.ApproveChan:
-			if !approved {
-				deployment.log("❌ Deployment rejected by user")
-				deployment.updateStatus("cancelled", "plan", "")
-				return
+	if req.Submodules {
+		deployment.log("Initialising submodules")
+		if gitAllowlistActive(req) {
+			if err := updateSubmodules(deployment, deployment.WorkDir); err != nil {
+				return fmt.Errorf("submodule update failed: %w", err)
 			}
-			deployment.log("✅ Deployment approved, continuing with apply...")
-		case <-deployment.CancelChan:
-			deployment.log("🛑 Deployment cancelled by user")
-			deployment.updateStatus("cancelled", "plan", "")
-			return
-		case <-time.After(24 * time.Hour):
-			deployment.log("⏱️ Approval timeout exceeded")
-			deployment.updateStatus("cancelled", "plan", "")
-			return
+		} else if err := runGit(deployment, "-C", deployment.WorkDir, "submodule", "update", "--init", "--recursive", "--depth", "1"); err != nil {
+			return fmt.Errorf("submodule update failed: %w", err)
 		}
 	}
 
-	// Terraform apply
-	if checkCancel() {
-		return
-	}
-	deployment.updateStatus("running", "apply", "")
-	deployment.log("Running terraform apply...")
-	applyLog, err := runTerraformCommand(deployment, deployPath, "apply", []string{"tfplan"})
-	deployment.Status.ApplyLog = applyLog
-	if err != nil {
-		deployment.updateStatus("failed", "apply", fmt.Sprintf("Apply failed: %v", err))
-		return
-	}
+	return nil
+}
 
-	// Get terraform outputs
-	deployment.log("Retrieving outputs...")
-	outputLog, err := runTerraformCommand(deployment, deployPath, "output", []string{"-json"})
+// gitRemoteSubcommands are the git subcommands that talk to the remote, which are retried
+// on transient network errors
+var gitRemoteSubcommands = map[string]bool{"clone": true, "fetch": true, "submodule": true, "ls-remote": true}
+
+// runGit runs a git command without prompting on a terminal, passing the request's
+// credentials through askpass, and logs its output with credentials scrubbed. Commands
+// that talk to the remote are retried while they fail on a transient network error.
+func runGit(deployment *Deployment, args ...string) error {
+	subcommand := gitSubcommand(args)
+	err := withRetry("git "+subcommand, deployment.log, func() error {
+		cmd := exec.Command("git", args...)
+		cmd.Env = gitEnv(deployment.Request.GitURL, deployment.Request.GitAuth)
+
+		output, err := cmd.CombinedOutput()
+		deployment.log(scrubCredentials(string(output), deployment.Request.GitAuth))
+		if err != nil && (!gitRemoteSubcommands[subcommand] || !transientGit(string(output))) {
+			return &permanentError{err: err}
+		}
+		return err
+	})
 	if err != nil {
-		// Non-fatal if there are no outputs
-		deployment.log("No outputs available")
-	} else {
-		deployment.Status.ApplyOutput = outputLog
+		deployment.recordExit(commandExit(context.Background(), deployment, "git "+gitSubcommand(args), err, 0))
 	}
-
-	// Success
-	deployment.updateStatus("success", "completed", "")
-	deployment.log("Deployment completed successfully!")
+	return err
 }
 
-func gitClone(deployment *Deployment) error {
-	req := deployment.Request
-	args := []string{"clone", "--depth", "1", "--branch", req.GitRef}
-
-	// Add auth if provided
-	gitURL := req.GitURL
-	if req.GitAuth != nil && req.GitAuth.Type == "http" && req.GitAuth.Username != "" {
-		// Inject credentials into URL
-		parts := strings.SplitN(gitURL, "://", 2)
-		if len(parts) == 2 {
-			gitURL = fmt.Sprintf("%s://%s:%s@%s", parts[0], req.GitAuth.Username, req.GitAuth.Password, parts[1])
+// gitSubcommand returns the subcommand of git arguments, skipping "-C <dir>"
+func gitSubcommand(args []string) string {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-C" {
+			i++
+			continue
+		}
+		if !strings.HasPrefix(args[i], "-") {
+			return args[i]
 		}
 	}
-
-	args = append(args, gitURL, deployment.WorkDir)
-
-	cmd := exec.Command("git", args...)
-	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		deployment.log(string(output))
-		return err
-	}
-
-	deployment.log(string(output))
-	return nil
+	return ""
 }
 
 func runTerraformCommand(deployment *Deployment, workDir, command string, args []string) (string, error) {
-	cmdName := deployment.Request.Tool
-	if cmdName != "tofu" {
-		cmdName = "terraform"
-	}
+	return runTerraformCommandWithHandler(deployment, workDir, command, args, nil)
+}
 
-	cmdArgs := []string{command}
-	cmdArgs = append(cmdArgs, args...)
+// runTerraformCommandWithHandler runs a terraform command, passing every output line
+// through onLine (if set) before it is logged. onLine returns the text to log.
+func runTerraformCommandWithHandler(deployment *Deployment, workDir, command string, args []string, onLine func(string) string) (string, error) {
+	cmdName := toolName(deployment.Request)
+	cmdArgs := toolArgs(deployment.Request, command, args...)
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(deployment.Request.Timeout)*time.Minute)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, cmdName, cmdArgs...)
-	cmd.Dir = workDir
-
 	// Set environment variables
-	cmd.Env = os.Environ()
-	for k, v := range deployment.Request.EnvVars {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
-	}
+	env := deploymentEnv(deployment)
 
 	// Configure private registry if REGISTRY_HOST is set
 	if registryURL := os.Getenv("REGISTRY_HOST"); registryURL != "" {
 		terraformrcPath := filepath.Join(workDir, ".terraformrc")
-		if err := configureTerraformRegistry(workDir, registryURL); err != nil {
+		if err := configureTerraformRegistry(workDir, registryURL, deployment.Request.RegistryToken); err != nil {
 			deployment.log(fmt.Sprintf("Warning: Failed to configure private registry: %v", err))
 		} else {
 			// Set TF_CLI_CONFIG_FILE environment variable
-			cmd.Env = append(cmd.Env, fmt.Sprintf("TF_CLI_CONFIG_FILE=%s", terraformrcPath))
+			env = append(env, fmt.Sprintf("TF_CLI_CONFIG_FILE=%s", terraformrcPath))
 			deployment.log(fmt.Sprintf("✓ Configured private registry: %s", registryURL))
 		}
 	}
 
+	cmd := newCommand(ctx, deployment, workDir, env, true, cmdName, cmdArgs...)
+	label := filepath.Base(cmdName) + " " + command
+	oomBefore := oomKills(deployment)
+
 	// Use PTY for colored output
 	ptmx, err := pty.Start(cmd)
 	if err != nil {
+		deployment.recordExit(commandExit(ctx, deployment, label, err, oomBefore))
 		return "", err
 	}
 	defer ptmx.Close()
@@ -515,18 +597,243 @@ func runTerraformCommand(deployment *Deployment, workDir, command string, args [
 	scanner := bufio.NewScanner(ptmx)
 	for scanner.Scan() {
 		line := scanner.Text()
+		if onLine != nil {
+			line = onLine(line)
+		}
 		output.WriteString(line + "\n")
 		deployment.log(line)
 	}
 
 	// Wait for command to finish
 	if err := cmd.Wait(); err != nil {
+		exit := commandExit(ctx, deployment, label, err, oomBefore)
+		deployment.recordExit(exit)
+		switch exit.Reason {
+		case "timeout":
+			return output.String(), fmt.Errorf("timed out after %dm", deployment.Request.Timeout)
+		case "oom_killed":
+			return output.String(), fmt.Errorf("killed for exceeding the memory limit")
+		}
 		return output.String(), err
 	}
 
 	return output.String(), nil
 }
 
+// runHooks executes hooks in order, stopping at the first failing hook unless it is marked "warn".
+// extraEnv is added to the deployment's environment variables.
+func runHooks(deployment *Deployment, workDir, stage string, hooks []Hook, extraEnv ...string) error {
+	for _, hook := range hooks {
+		name := hook.Name
+		if name == "" {
+			name = hook.Command
+		}
+
+		deployment.log(fmt.Sprintf("Running %s hook: %s", stage, name))
+		deployment.appendHookLog(fmt.Sprintf("==> [%s] %s\n", stage, name))
+
+		output, exit, err := runHookCommand(deployment, workDir, hook, extraEnv)
+		deployment.appendHookLog(output)
+		if err == nil {
+			continue
+		}
+
+		if hook.OnFailure == "warn" {
+			deployment.log(fmt.Sprintf("⚠️ Hook %q failed (continuing): %v", name, err))
+			deployment.appendHookLog(fmt.Sprintf("Hook failed (ignored): %v\n", err))
+			continue
+		}
+		deployment.appendHookLog(fmt.Sprintf("Hook failed: %v\n", err))
+		if exit != nil {
+			exit.Command = "hook " + name
+			deployment.recordExit(exit)
+		}
+		return fmt.Errorf("%s hook %q failed: %v", stage, name, err)
+	}
+	return nil
+}
+
+// runHookCommand runs a single hook with sh -c and streams its output to the logs. A hook
+// that fails also returns how it ended.
+func runHookCommand(deployment *Deployment, workDir string, hook Hook, extraEnv []string) (string, *CommandExit, error) {
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = 300
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	// Hooks see the same environment as terraform
+	cmd := newCommand(ctx, deployment, workDir, append(deploymentEnv(deployment), extraEnv...), false, "sh", "-c", hook.Command)
+	oomBefore := oomKills(deployment)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", nil, err
+	}
+	cmd.Stderr = cmd.Stdout
+
+	if err := cmd.Start(); err != nil {
+		return "", commandExit(ctx, deployment, "hook", err, oomBefore), err
+	}
+
+	var output strings.Builder
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		output.WriteString(line + "\n")
+		deployment.log(line)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		exit := commandExit(ctx, deployment, "hook", err, oomBefore)
+		switch exit.Reason {
+		case "timeout":
+			return output.String(), exit, fmt.Errorf("timed out after %ds", timeout)
+		case "oom_killed":
+			return output.String(), exit, fmt.Errorf("killed for exceeding the memory limit")
+		}
+		return output.String(), exit, err
+	}
+
+	return output.String(), nil, nil
+}
+
+// toolName returns the binary for the requested tool: the selected version's, or "tofu",
+// "terragrunt" or "terraform" from PATH
+func toolName(req DeploymentRequest) string {
+	if req.toolPath != "" {
+		return req.toolPath
+	}
+	if req.Tool == "tofu" || req.Tool == "terragrunt" {
+		return req.Tool
+	}
+	return "terraform"
+}
+
+// executor returns the configured command executor ("local" or "docker")
+func executor() string {
+	if e := os.Getenv("RUNNER_EXECUTOR"); e != "" {
+		return e
+	}
+	return "local"
+}
+
+// deploymentEnv returns the deployment's environment variables in KEY=value form
+func deploymentEnv(deployment *Deployment) []string {
+	env := terragruntEnv(deployment.Request)
+	for k, v := range deployment.Request.EnvVars {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+	return env
+}
+
+// newCommand builds a command for a deployment. Without a custom image the command
+// runs directly on the runner; otherwise it runs in a throwaway container of that
+// image with the work directory mounted at the same path. Either way the configured
+// sandbox applies.
+func newCommand(ctx context.Context, deployment *Deployment, workDir string, env []string, tty bool, name string, args ...string) *exec.Cmd {
+	if deployment.Request.Image == "" {
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Dir = workDir
+		cmd.Env = append(append(os.Environ(), env...), sandboxEnv(deployment)...)
+		sandboxLocal(cmd, deployment)
+		return cmd
+	}
+
+	// Every command of a run with an image runs the image's binaries, so in simulation
+	// mode none may start, whichever path reached here
+	if simulating() {
+		cmd := exec.CommandContext(ctx, "docker")
+		cmd.Err = fmt.Errorf("simulation mode: refusing to run %s in image %s", name, deployment.Request.Image)
+		return cmd
+	}
+
+	// DOCKER_WORKDIR_VOLUME names the volume backing /tmp/iac-deployments when the
+	// runner itself is containerized and talks to the host's docker daemon
+	mount := deployment.WorkDir + ":" + deployment.WorkDir
+	if volume := os.Getenv("DOCKER_WORKDIR_VOLUME"); volume != "" {
+		mount = volume + ":/tmp/iac-deployments"
+	}
+
+	// Killing the docker client on cancel or timeout leaves the container running, so
+	// containers are named to be removed then
+	container := fmt.Sprintf("iac-%s-%d", deployment.ID, containerSeq.Add(1))
+	dockerArgs := []string{"run", "--rm", "-i", "--name", container, "-v", mount, "-w", workDir}
+	if tty {
+		dockerArgs = append(dockerArgs, "-t")
+	}
+	if network := os.Getenv("DOCKER_NETWORK"); network != "" {
+		dockerArgs = append(dockerArgs, "--network", network)
+	}
+	dockerArgs = append(dockerArgs, sandboxDockerArgs()...)
+	// Values are passed through the docker client's environment, not its arguments, so
+	// secrets do not show up in process listings. DOCKER_* variables would configure the
+	// client itself and are passed as arguments instead.
+	var clientEnv []string
+	for _, e := range append(append([]string{}, env...), sandboxEnv(deployment)...) {
+		key, _, _ := strings.Cut(e, "=")
+		if strings.HasPrefix(key, "DOCKER_") {
+			dockerArgs = append(dockerArgs, "-e", e)
+			continue
+		}
+		dockerArgs = append(dockerArgs, "-e", key)
+		clientEnv = append(clientEnv, e)
+	}
+	dockerArgs = append(dockerArgs, "--entrypoint", name, deployment.Request.Image)
+	dockerArgs = append(dockerArgs, args...)
+
+	cmd := exec.CommandContext(ctx, "docker", dockerArgs...)
+	cmd.Env = append(os.Environ(), clientEnv...)
+	cmd.Cancel = func() error {
+		removeContainer(container)
+		return cmd.Process.Kill()
+	}
+	if sandbox.dropUser {
+		if err := handOverWorkDir(deployment); err != nil {
+			cmd.Err = fmt.Errorf("sandbox: preparing work directory: %w", err)
+		}
+	}
+	return cmd
+}
+
+// containerSeq numbers the containers of the docker executor
+var containerSeq atomic.Int64
+
+// removeContainer force-removes a run container, e.g. when its command is cancelled
+func removeContainer(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if output, err := exec.CommandContext(ctx, "docker", "rm", "-f", name).CombinedOutput(); err != nil {
+		log.Printf("Failed to remove container %s: %v: %s", name, err, strings.TrimSpace(string(output)))
+	}
+}
+
+func (d *Deployment) setApplyReport(results []ResourceResult) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Status.ApplyReport = results
+}
+
+func (d *Deployment) setCommitSHA(sha string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Status.CommitSHA = sha
+}
+
+func (d *Deployment) setTfvarsSHA256(hashes map[string]string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Status.TfvarsSHA256 = hashes
+}
+
+func (d *Deployment) appendHookLog(text string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Status.HookLog += text
+}
+
 func (d *Deployment) updateStatus(status, phase, errorMsg string) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -534,8 +841,11 @@ func (d *Deployment) updateStatus(status, phase, errorMsg string) {
 	d.Status.Status = status
 	d.Status.Phase = phase
 	d.Status.Error = errorMsg
+	if status == "failed" {
+		d.Status.Exit = d.lastExit
+	}
 
-	if status == "success" || status == "failed" || status == "cancelled" {
+	if status == "success" || status == "failed" || status == "cancelled" || status == "stale" || status == "expired" {
 		now := time.Now()
 		d.Status.EndedAt = &now
 	}
@@ -545,6 +855,9 @@ func (d *Deployment) log(message string) {
 	// Store in buffer
 	d.mu.Lock()
 	d.LogBuffer = append(d.LogBuffer, message)
+	if d.stage >= 0 && d.stage < len(d.Status.Stages) {
+		d.Status.Stages[d.stage].Log += message + "\n"
+	}
 	d.mu.Unlock()
 
 	// Try to send to active listeners
@@ -555,7 +868,7 @@ func (d *Deployment) log(message string) {
 	}
 }
 
-func configureTerraformRegistry(workDir, registryURL string) error {
+func configureTerraformRegistry(workDir, registryURL, token string) error {
 	// Create .terraformrc in the work directory
 	terraformrcPath := filepath.Join(workDir, ".terraformrc")
 
@@ -567,19 +880,22 @@ func configureTerraformRegistry(workDir, registryURL string) error {
 	// This allows module sources like "registry.local/namespace/module" to work
 	registryHostname := strings.Split(registryHostWithPort, ":")[0]
 
-	// Fetch token from backend (this token will work for all private namespaces from runner)
-	token, err := fetchRegistryToken(registryURL)
-	if err != nil {
-		// If we can't get the token, continue without auth (for development)
-		log.Printf("Warning: Could not fetch registry token: %v", err)
-		token = "no-auth"
+	// Runs normally bring a token scoped to their namespaces; older backends only offer
+	// the global token (valid for all private namespaces)
+	if token == "" {
+		var err error
+		if token, err = fetchRegistryToken(registryURL); err != nil {
+			// If we can't get the token, continue without auth (for development)
+			log.Printf("Warning: Could not fetch registry token: %v", err)
+			token = "no-auth"
+		}
 	}
 
 	// Configure .terraformrc with single credential for the entire registry
 	// Note: host block uses hostname only (no port) to match module source format
 	// Service URLs use full registryURL with protocol and port
 	content := fmt.Sprintf(`# Terraform Registry Configuration
-# Single credential for both public namespaces and runner access to private namespaces
+# Single credential for public namespaces and the private namespaces this run may read
 
 credentials "%s" {
   token = "%s"
@@ -597,27 +913,30 @@ host "%s" {
 	return os.WriteFile(terraformrcPath, []byte(content), 0644)
 }
 
-// fetchRegistryToken gets the authentication token from the backend
+// fetchRegistryToken gets the authentication token from the backend, retrying while the
+// backend cannot be reached or answers that it is unavailable
 func fetchRegistryToken(registryURL string) (string, error) {
-	resp, err := http.Get(registryURL + "/api/internal/registry-token")
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("backend returned status %d", resp.StatusCode)
-	}
-
 	var result struct {
 		Token string `json:"token"`
 	}
+	err := withRetry("registry token fetch", nil, func() error {
+		resp, err := backendClient().Get(registryURL + "/api/internal/registry-token")
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
-	}
-
-	return result.Token, nil
+		if resp.StatusCode != 200 {
+			err := fmt.Errorf("backend returned status %d", resp.StatusCode)
+			switch resp.StatusCode {
+			case 429, 502, 503, 504:
+				return err
+			}
+			return &permanentError{err: err}
+		}
+		return json.NewDecoder(resp.Body).Decode(&result)
+	})
+	return result.Token, err
 }
 
 // parseShellArgs parses a command-line string into arguments, respecting quotes
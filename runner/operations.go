@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ImportRequest lists the resources to import into a deployment's state
+type ImportRequest struct {
+	Imports []ImportPair `json:"imports" binding:"required"`
+}
+
+// ImportPair maps a resource address to the ID of the existing infrastructure object
+type ImportPair struct {
+	Address string `json:"address"`
+	ID      string `json:"id"`
+}
+
+// startOperation creates a deployment that reuses the working directory of a finished
+// deployment, so follow-up commands (import, state surgery) see the same configuration,
+// providers and workspace. State commands need a single state, so with singleState they are
+// refused for terragrunt run-all deployments. It writes the error response itself and returns
+// nil on failure.
+func startOperation(c *gin.Context, singleState bool) *Deployment {
+	sourceID := c.Param("id")
+
+	deployMu.RLock()
+	source, exists := deployments[sourceID]
+	deployMu.RUnlock()
+
+	if !exists {
+		c.JSON(404, gin.H{"error": "Deployment not found"})
+		return nil
+	}
+
+	source.mu.RLock()
+	finished := source.Status.EndedAt != nil
+	workDir := source.WorkDir
+	req := source.Request
+	source.mu.RUnlock()
+
+	if !finished {
+		c.JSON(409, gin.H{"error": "Deployment is still running"})
+		return nil
+	}
+	if workDir == "" {
+		c.JSON(409, gin.H{"error": "Deployment has no working directory"})
+		return nil
+	}
+	if _, err := os.Stat(workDir); err != nil {
+		c.JSON(410, gin.H{"error": "Deployment working directory has been cleaned up"})
+		return nil
+	}
+	if singleState && runAll(req) {
+		c.JSON(400, gin.H{"error": "State operations are not supported for terragrunt run-all deployments"})
+		return nil
+	}
+	// The backend issues each operation a fresh registry token; the source's may have expired
+	if token := c.GetHeader("X-Registry-Token"); token != "" {
+		req.RegistryToken = token
+	}
+
+	operationID := uuid.New().String()
+	operation := &Deployment{
+		ID:          operationID,
+		Request:     req,
+		WorkDir:     workDir,
+		LogChan:     make(chan string, 100),
+		LogBuffer:   make([]string, 0),
+		ApproveChan: make(chan bool, 1),
+		CancelChan:  make(chan bool, 1),
+		Status: DeploymentStatus{
+			DeploymentID: operationID,
+			Status:       "running",
+			Phase:        "initializing",
+			StartedAt:    time.Now(),
+			Runner:       runnerHostname,
+		},
+	}
+
+	deployMu.Lock()
+	deployments[operationID] = operation
+	deployMu.Unlock()
+
+	return operation
+}
+
+func handleImport(c *gin.Context) {
+	var req ImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.Imports) == 0 {
+		c.JSON(400, gin.H{"error": "At least one import is required"})
+		return
+	}
+	for _, imp := range req.Imports {
+		if imp.Address == "" || imp.ID == "" {
+			c.JSON(400, gin.H{"error": "Each import needs an address and an id"})
+			return
+		}
+		if strings.HasPrefix(imp.Address, "-") || strings.HasPrefix(imp.ID, "-") {
+			c.JSON(400, gin.H{"error": "Import address and id must not start with '-'"})
+			return
+		}
+	}
+
+	operation := startOperation(c, true)
+	if operation == nil {
+		return
+	}
+
+	go executeImport(operation, req.Imports)
+
+	c.JSON(202, DeploymentResponse{
+		DeploymentID: operation.ID,
+		Status:       "running",
+		Message:      "Import started",
+	})
+}
+
+// executeImport runs terraform import for each pair, then a plan preview
+func executeImport(operation *Deployment, imports []ImportPair) {
+	defer close(operation.LogChan)
+
+	deployPath := filepath.Join(operation.WorkDir, operation.Request.Path)
+	varArgs := varFileArgs(operation.Request)
+
+	operation.updateStatus("running", "import", "")
+
+	var importLog strings.Builder
+	for _, imp := range imports {
+		select {
+		case <-operation.CancelChan:
+			operation.updateStatus("cancelled", "import", "Import cancelled by user")
+			return
+		default:
+		}
+
+		operation.log(fmt.Sprintf("Importing %s (id: %s)...", imp.Address, imp.ID))
+		args := append(append([]string{"-input=false"}, varArgs...), imp.Address, imp.ID)
+		output, err := runTerraformCommand(operation, deployPath, "import", args)
+		importLog.WriteString(output)
+		operation.Status.ApplyLog = importLog.String()
+		if err != nil {
+			operation.updateStatus("failed", "import", fmt.Sprintf("Import of %s failed: %v", imp.Address, err))
+			return
+		}
+	}
+
+	// Plan preview so the user can see how the imported resources differ from the configuration
+	operation.updateStatus("running", "plan", "")
+	operation.log("Running terraform plan to preview imported resources...")
+	planArgs := append([]string{"-input=false"}, varArgs...)
+	customFlags, _ := parseToolFlags("plan_flags", operation.Request.PlanFlags, operation.Request.Path, planFlags)
+	planArgs = append(planArgs, customFlags...)
+	planLog, err := runTerraformCommand(operation, deployPath, "plan", planArgs)
+	operation.Status.PlanLog = planLog
+	if err != nil {
+		operation.updateStatus("failed", "plan", fmt.Sprintf("Plan failed: %v", err))
+		return
+	}
+
+	operation.updateStatus("success", "completed", "")
+	operation.log("Import completed successfully!")
+}
+
+// varFileArgs returns -var-file arguments for the request's tfvars files
+func varFileArgs(req DeploymentRequest) []string {
+	args := make([]string, 0, len(req.TfvarsFiles))
+	for _, tfvarsFile := range req.TfvarsFiles {
+		args = append(args, "-var-file="+tfvarsFile)
+	}
+	return args
+}
+
+// StateMoveRequest moves a resource to a new address in the state
+type StateMoveRequest struct {
+	Source      string `json:"source" binding:"required"`
+	Destination string `json:"destination" binding:"required"`
+}
+
+// StateRemoveRequest removes resources from the state
+type StateRemoveRequest struct {
+	Addresses []string `json:"addresses" binding:"required"`
+}
+
+// ForceUnlockRequest releases a state lock left behind by a run that died
+type ForceUnlockRequest struct {
+	LockID string `json:"lock_id" binding:"required"`
+}
+
+// OperationResult records the command a state operation ran and the state versions around it
+type OperationResult struct {
+	Command     string        `json:"command"`
+	StateBefore *StateVersion `json:"state_before,omitempty"`
+	StateAfter  *StateVersion `json:"state_after,omitempty"`
+}
+
+// StateVersion identifies a version of a Terraform state
+type StateVersion struct {
+	Serial  int64  `json:"serial"`
+	Lineage string `json:"lineage"`
+}
+
+func handleStateMove(c *gin.Context) {
+	var req StateMoveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if strings.HasPrefix(req.Source, "-") || strings.HasPrefix(req.Destination, "-") {
+		c.JSON(400, gin.H{"error": "Addresses must not start with '-'"})
+		return
+	}
+
+	operation := startOperation(c, true)
+	if operation == nil {
+		return
+	}
+
+	go executeStateCommand(operation, []string{"mv", req.Source, req.Destination})
+
+	c.JSON(202, DeploymentResponse{
+		DeploymentID: operation.ID,
+		Status:       "running",
+		Message:      "State move started",
+	})
+}
+
+func handleStateRemove(c *gin.Context) {
+	var req StateRemoveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.Addresses) == 0 {
+		c.JSON(400, gin.H{"error": "At least one address is required"})
+		return
+	}
+	for _, address := range req.Addresses {
+		if address == "" || strings.HasPrefix(address, "-") {
+			c.JSON(400, gin.H{"error": "Invalid address: " + address})
+			return
+		}
+	}
+
+	operation := startOperation(c, true)
+	if operation == nil {
+		return
+	}
+
+	go executeStateCommand(operation, append([]string{"rm"}, req.Addresses...))
+
+	c.JSON(202, DeploymentResponse{
+		DeploymentID: operation.ID,
+		Status:       "running",
+		Message:      "State removal started",
+	})
+}
+
+func handleForceUnlock(c *gin.Context) {
+	var req ForceUnlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if strings.HasPrefix(req.LockID, "-") || strings.ContainsAny(req.LockID, " \t\n") {
+		c.JSON(400, gin.H{"error": "Invalid lock ID"})
+		return
+	}
+
+	operation := startOperation(c, true)
+	if operation == nil {
+		return
+	}
+
+	go executeForceUnlock(operation, req.LockID)
+
+	c.JSON(202, DeploymentResponse{
+		DeploymentID: operation.ID,
+		Status:       "running",
+		Message:      "Force-unlock started",
+	})
+}
+
+// executeForceUnlock runs `terraform force-unlock -force <lock ID>`
+func executeForceUnlock(operation *Deployment, lockID string) {
+	defer close(operation.LogChan)
+
+	deployPath := filepath.Join(operation.WorkDir, operation.Request.Path)
+	operation.setOperationResult(&OperationResult{
+		Command: strings.Join([]string{toolName(operation.Request), "force-unlock", "-force", lockID}, " "),
+	})
+
+	operation.updateStatus("running", "state", "")
+	operation.log(fmt.Sprintf("Releasing state lock %s...", lockID))
+
+	output, err := runTerraformCommand(operation, deployPath, "force-unlock", []string{"-force", lockID})
+	operation.Status.ApplyLog = output
+	if err != nil {
+		operation.updateStatus("failed", "state", fmt.Sprintf("Force-unlock failed: %v", err))
+		return
+	}
+
+	operation.updateStatus("success", "completed", "")
+	operation.log("State lock released")
+}
+
+// executeStateCommand runs `terraform state <args>`, recording the state version before and after
+func executeStateCommand(operation *Deployment, args []string) {
+	defer close(operation.LogChan)
+
+	deployPath := filepath.Join(operation.WorkDir, operation.Request.Path)
+	result := &OperationResult{
+		Command: strings.Join(append([]string{toolName(operation.Request), "state"}, args...), " "),
+	}
+
+	operation.updateStatus("running", "state", "")
+	operation.log(fmt.Sprintf("Running %s", result.Command))
+
+	before, err := pullStateVersion(operation, deployPath)
+	if err != nil {
+		operation.log(fmt.Sprintf("Warning: could not read state before operation: %v", err))
+	}
+	result.StateBefore = before
+	operation.setOperationResult(result)
+
+	output, err := runTerraformCommand(operation, deployPath, "state", args)
+	operation.Status.ApplyLog = output
+	if err != nil {
+		operation.updateStatus("failed", "state", fmt.Sprintf("State command failed: %v", err))
+		return
+	}
+
+	after, err := pullStateVersion(operation, deployPath)
+	if err != nil {
+		operation.log(fmt.Sprintf("Warning: could not read state after operation: %v", err))
+	}
+	result.StateAfter = after
+	operation.setOperationResult(result)
+
+	if before != nil && after != nil {
+		operation.log(fmt.Sprintf("State serial %d -> %d (lineage %s)", before.Serial, after.Serial, after.Lineage))
+	}
+
+	operation.updateStatus("success", "completed", "")
+	operation.log("State operation completed successfully!")
+}
+
+// pullStateVersion reads the serial and lineage of the current state without logging its
+// contents, which may contain secrets
+func pullStateVersion(deployment *Deployment, workDir string) (*StateVersion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cmd := newCommand(ctx, deployment, workDir, deploymentEnv(deployment), false, toolName(deployment.Request), "state", "pull")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var state StateVersion
+	if err := json.Unmarshal(output, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (d *Deployment) setOperationResult(result *OperationResult) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	copied := *result
+	d.Status.OperationResult = &copied
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The runner's own outbound calls (git clones, registry token fetches) honour
+// OUTBOUND_CA_BUNDLE, a PEM file of CAs added to the system roots, and the standard
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables, like the backend's.
+
+// systemBundles are the usual locations of the system CA bundle, which git would read
+// when GIT_SSL_CAINFO is not set
+var systemBundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",                // Debian, Ubuntu, Alpine
+	"/etc/pki/tls/certs/ca-bundle.crt",                  // Fedora, RHEL
+	"/etc/ssl/ca-bundle.pem",                            // openSUSE
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", // CentOS, RHEL 7
+	"/etc/ssl/cert.pem",                                 // macOS, Alpine
+}
+
+var outbound struct {
+	transport http.RoundTripper
+	gitBundle string // system CAs followed by OUTBOUND_CA_BUNDLE, for GIT_SSL_CAINFO
+}
+
+var outboundOnce sync.Once
+
+// initOutbound reads OUTBOUND_CA_BUNDLE and prepares the transport and the git CA bundle.
+// It runs at startup so an unusable bundle stops the runner instead of failing each run.
+func initOutbound() error {
+	var err error
+	outboundOnce.Do(func() { err = setupOutbound() })
+	return err
+}
+
+func setupOutbound() error {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.Proxy = http.ProxyFromEnvironment
+	outbound.transport = base
+
+	path := os.Getenv("OUTBOUND_CA_BUNDLE")
+	if path == "" {
+		return nil
+	}
+	custom, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("OUTBOUND_CA_BUNDLE: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(custom) {
+		return fmt.Errorf("OUTBOUND_CA_BUNDLE: no PEM certificates in %s", path)
+	}
+	base.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+
+	// GIT_SSL_CAINFO replaces git's default bundle, so the system CAs have to be part
+	// of it for public hosts to keep working
+	var combined []byte
+	candidates := systemBundles
+	if file := os.Getenv("SSL_CERT_FILE"); file != "" {
+		candidates = append([]string{file}, candidates...)
+	}
+	for _, file := range candidates {
+		if system, err := os.ReadFile(file); err == nil {
+			combined = append(system, '\n')
+			break
+		}
+	}
+	combined = append(combined, custom...)
+
+	dir, err := os.MkdirTemp("", "outbound-ca-*")
+	if err != nil {
+		return fmt.Errorf("writing git CA bundle: %w", err)
+	}
+	outbound.gitBundle = filepath.Join(dir, "ca-bundle.pem")
+	if err := os.WriteFile(outbound.gitBundle, combined, 0644); err != nil {
+		return fmt.Errorf("writing git CA bundle: %w", err)
+	}
+	return nil
+}
+
+// outboundTransport returns the transport for the runner's outbound calls
+func outboundTransport() http.RoundTripper {
+	initOutbound()
+	return outbound.transport
+}
+
+// outboundGitEnv returns the variables that give git the same CAs and proxies as the
+// runner's own calls. curl, which git uses for HTTPS, only reads the lower-case
+// http_proxy, so upper-case proxy variables are mirrored to lower case.
+func outboundGitEnv() []string {
+	initOutbound()
+	var env []string
+	if outbound.gitBundle != "" {
+		env = append(env, "GIT_SSL_CAINFO="+outbound.gitBundle)
+	}
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"} {
+		lower := strings.ToLower(name)
+		if value := os.Getenv(name); value != "" && os.Getenv(lower) == "" {
+			env = append(env, lower+"="+value)
+		}
+	}
+	return env
+}
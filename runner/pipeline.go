@@ -0,0 +1,376 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StageResult is the outcome of one pipeline stage
+type StageResult struct {
+	Name            string     `json:"name"`
+	Status          string     `json:"status"` // "pending", "running", "success", "failed", "skipped", "cancelled", "stale", "expired"
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	EndedAt         *time.Time `json:"ended_at,omitempty"`
+	DurationSeconds float64    `json:"duration_seconds,omitempty"`
+	Log             string     `json:"log,omitempty"`
+	Error           string     `json:"error,omitempty"`
+	Reused          bool       `json:"reused,omitempty"` // Result carried over from the deployment being retried
+}
+
+// RetryRequest selects where a retried deployment resumes
+type RetryRequest struct {
+	FromStage    string `json:"from_stage"`    // Stage to resume from (default: the stage that did not succeed)
+	PlanValidity int    `json:"plan_validity"` // Minutes a new plan may await approval (default: the original request's)
+}
+
+// stage is one step of the deployment pipeline
+type stage struct {
+	name    string
+	phase   string                           // Phase reported while the stage runs
+	enabled func(req DeploymentRequest) bool // Optional stages run only when this returns true
+	run     func(d *Deployment, deployPath string) error
+}
+
+// stageStop ends the pipeline with a status other than "failed"
+type stageStop struct {
+	status  string // "cancelled", "stale" or "expired"
+	message string
+}
+
+func (s *stageStop) Error() string { return s.message }
+
+// pipelineStages are the stages of a deployment, in order
+var pipelineStages = []stage{
+	{name: "clone", phase: "cloning", run: stageClone},
+	{name: "pre_hooks", phase: "pre_hooks", enabled: func(req DeploymentRequest) bool { return len(req.PreHooks) > 0 }, run: stagePreHooks},
+	{name: "init", phase: "init", run: stageInit},
+	{name: "validate", phase: "validate", enabled: func(req DeploymentRequest) bool { return req.Validate }, run: stageValidate},
+	{name: "plan", phase: "plan", run: stagePlan},
+	{name: "policy", phase: "policy", enabled: func(req DeploymentRequest) bool { return len(req.PolicyChecks) > 0 }, run: stagePolicy},
+	{name: "approval", phase: "plan", enabled: func(req DeploymentRequest) bool { return !req.AutoApprove }, run: stageApproval},
+	{name: "apply", phase: "apply", run: stageApply},
+	{name: "outputs", phase: "apply", run: stageOutputs},
+	{name: "post_hooks", phase: "post_hooks", enabled: func(req DeploymentRequest) bool { return len(req.PostHooks) > 0 }, run: stagePostHooks},
+}
+
+// stageIndex returns the position of the named stage, or -1
+func stageIndex(name string) int {
+	for i, s := range pipelineStages {
+		if s.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// phaseFor returns the phase reported while s runs; destroy runs report "destroy" for apply
+func (s stage) phaseFor(req DeploymentRequest) string {
+	if s.name == "apply" && req.Destroy {
+		return "destroy"
+	}
+	return s.phase
+}
+
+// runPipeline executes the stages from index start onwards. Stages before start keep
+// the results set up by initStages.
+func runPipeline(d *Deployment, start int) {
+	deployPath := filepath.Join(d.WorkDir, d.Request.Path)
+
+	for i := start; i < len(pipelineStages); i++ {
+		s := pipelineStages[i]
+		if s.enabled != nil && !s.enabled(d.Request) {
+			continue
+		}
+
+		select {
+		case <-d.CancelChan:
+			d.finishStage(i, "cancelled", "")
+			d.updateStatus("cancelled", "", "Deployment cancelled by user")
+			return
+		default:
+		}
+
+		d.startStage(i)
+		d.updateStatus("running", s.phaseFor(d.Request), "")
+
+		if err := s.run(d, deployPath); err != nil {
+			if stop, ok := err.(*stageStop); ok {
+				d.finishStage(i, stop.status, stop.message)
+				d.updateStatus(stop.status, s.phaseFor(d.Request), stop.message)
+				return
+			}
+			d.finishStage(i, "failed", err.Error())
+			d.updateStatus("failed", s.phaseFor(d.Request), err.Error())
+			return
+		}
+		d.finishStage(i, "success", "")
+	}
+
+	d.updateStatus("success", "completed", "")
+	d.log("Deployment completed successfully!")
+}
+
+func stageClone(d *Deployment, deployPath string) error {
+	// A retried clone starts from an empty directory
+	if err := os.RemoveAll(d.WorkDir); err != nil {
+		return fmt.Errorf("Failed to clean work directory: %v", err)
+	}
+	if err := os.MkdirAll(d.WorkDir, 0755); err != nil {
+		return fmt.Errorf("Failed to create work directory: %v", err)
+	}
+
+	if d.Request.Image != "" {
+		d.log(fmt.Sprintf("Commands will run in image: %s", d.Request.Image))
+	}
+	d.log("Cloning repository...")
+	if err := gitClone(d); err != nil {
+		return fmt.Errorf("Git clone failed: %v", err)
+	}
+
+	if _, err := os.Stat(deployPath); os.IsNotExist(err) {
+		return fmt.Errorf("Path does not exist: %s", d.Request.Path)
+	}
+	// A symlink in the repository must not lead the run outside the clone
+	if err := checkClonedPaths(d); err != nil {
+		return err
+	}
+	hashTfvarsFiles(d, deployPath)
+	return resolveTool(d, deployPath)
+}
+
+// hashTfvarsFiles records the SHA-256 of the request's tfvars files for the backend's run
+// manifest, before the tool is resolved so both are reported together. Missing files are
+// left out; terraform reports them.
+func hashTfvarsFiles(d *Deployment, deployPath string) {
+	hashes := make(map[string]string, len(d.Request.TfvarsFiles))
+	for _, file := range d.Request.TfvarsFiles {
+		content, err := os.ReadFile(filepath.Join(deployPath, file))
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(content)
+		hashes[file] = hex.EncodeToString(sum[:])
+	}
+	d.setTfvarsSHA256(hashes)
+}
+
+func stagePreHooks(d *Deployment, deployPath string) error {
+	return runHooks(d, deployPath, "pre-init", d.Request.PreHooks)
+}
+
+func stageInit(d *Deployment, deployPath string) error {
+	return d.tool().Prepare(d, deployPath)
+}
+
+func stageValidate(d *Deployment, deployPath string) error {
+	return d.tool().Validate(d, deployPath)
+}
+
+func stagePlan(d *Deployment, deployPath string) error {
+	return d.tool().Preview(d, deployPath)
+}
+
+// stagePolicy runs the policy checks against the plan. The full plan JSON is passed
+// in TFPLAN_JSON so tools such as conftest or OPA can evaluate it.
+func stagePolicy(d *Deployment, deployPath string) error {
+	planFile := filepath.Join(deployPath, planJSONFile)
+	if _, err := os.Stat(planFile); err != nil {
+		return fmt.Errorf("Plan JSON is not available for policy checks: %v", err)
+	}
+	return runHooks(d, deployPath, "policy", d.Request.PolicyChecks, "TFPLAN_JSON="+planFile)
+}
+
+func stageApproval(d *Deployment, deployPath string) error {
+	if err := sealPlan(d, deployPath); err != nil {
+		return fmt.Errorf("Failed to seal the plan: %v", err)
+	}
+	d.updateStatus("awaiting_approval", "plan", "")
+	d.log("Waiting for approval...")
+
+	select {
+	case approved := <-d.ApproveChan:
+		if !approved {
+			d.log("❌ Deployment rejected by user")
+			return &stageStop{status: "cancelled"}
+		}
+		d.log("✅ Deployment approved, continuing with apply...")
+		return nil
+	case <-d.CancelChan:
+		d.log("🛑 Deployment cancelled by user")
+		return &stageStop{status: "cancelled"}
+	case <-time.After(time.Duration(d.Request.PlanValidity) * time.Minute):
+		d.log("⏱️ Approval timed out; a fresh plan is required")
+		return &stageStop{status: "expired", message: "Approval timed out after " + (time.Duration(d.Request.PlanValidity) * time.Minute).String() + "; re-plan required"}
+	}
+}
+
+func stageApply(d *Deployment, deployPath string) error {
+	if err := unsealPlan(d, deployPath); err != nil {
+		return err
+	}
+	return d.tool().Execute(d, deployPath)
+}
+
+func stageOutputs(d *Deployment, deployPath string) error {
+	return d.tool().Outputs(d, deployPath)
+}
+
+func stagePostHooks(d *Deployment, deployPath string) error {
+	return runHooks(d, deployPath, "post-apply", d.Request.PostHooks)
+}
+
+// initStages lists every stage of the deployment as pending or skipped. Results of
+// the stages before start are copied from previous (the deployment being retried).
+func (d *Deployment) initStages(previous []StageResult, start int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.stage = -1
+	d.Status.Stages = make([]StageResult, len(pipelineStages))
+	for i, s := range pipelineStages {
+		switch {
+		case i < start && i < len(previous):
+			d.Status.Stages[i] = previous[i]
+			d.Status.Stages[i].Reused = true
+		case s.enabled != nil && !s.enabled(d.Request):
+			d.Status.Stages[i] = StageResult{Name: s.name, Status: "skipped"}
+		default:
+			d.Status.Stages[i] = StageResult{Name: s.name, Status: "pending"}
+		}
+	}
+}
+
+func (d *Deployment) startStage(i int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	d.stage = i
+	d.lastExit = nil
+	d.Status.Stages[i].Status = "running"
+	d.Status.Stages[i].StartedAt = &now
+}
+
+func (d *Deployment) finishStage(i int, status, errorMsg string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	result := &d.Status.Stages[i]
+	result.Status = status
+	result.Error = errorMsg
+	result.EndedAt = &now
+	if result.StartedAt != nil {
+		result.DurationSeconds = now.Sub(*result.StartedAt).Seconds()
+	}
+	d.stage = -1
+}
+
+// retryStart picks the stage a retry of source resumes from: fromStage if given,
+// otherwise the first stage that did not succeed. A stale or expired plan is always re-created.
+func retryStart(stages []StageResult, fromStage string) (int, error) {
+	failed := -1
+	for i, result := range stages {
+		if result.Status != "success" && result.Status != "skipped" {
+			failed = i
+			break
+		}
+	}
+	if failed == -1 {
+		return 0, fmt.Errorf("Deployment succeeded; there is no failed stage to retry")
+	}
+	if stages[failed].Status == "stale" || stages[failed].Status == "expired" {
+		failed = stageIndex("plan")
+	}
+
+	if fromStage == "" {
+		return failed, nil
+	}
+	start := stageIndex(fromStage)
+	if start == -1 {
+		return 0, fmt.Errorf("Unknown stage: %s", fromStage)
+	}
+	if start > failed {
+		return 0, fmt.Errorf("Cannot resume from %s: stage %s did not succeed", fromStage, stages[failed].Name)
+	}
+	return start, nil
+}
+
+// handleRetry re-runs a finished deployment from the stage that failed (or an earlier
+// one) in the same working directory; results of the earlier stages are carried over
+func handleRetry(c *gin.Context) {
+	var req RetryRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	deployMu.RLock()
+	source, exists := deployments[c.Param("id")]
+	deployMu.RUnlock()
+
+	if !exists {
+		c.JSON(404, gin.H{"error": "Deployment not found"})
+		return
+	}
+
+	source.mu.RLock()
+	previous := append([]StageResult(nil), source.Status.Stages...)
+	sourceStatus := source.Status
+	source.mu.RUnlock()
+
+	if len(previous) == 0 {
+		c.JSON(409, gin.H{"error": "Deployment has no stages to retry"})
+		return
+	}
+	start, err := retryStart(previous, req.FromStage)
+	if err != nil {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+
+	operation := startOperation(c, false)
+	if operation == nil {
+		return
+	}
+	if req.PlanValidity > 0 {
+		operation.Request.PlanValidity = req.PlanValidity
+	}
+
+	// Keep what the skipped stages produced so the retry reports a complete run
+	operation.Status.CommitSHA = sourceStatus.CommitSHA
+	source.mu.RLock()
+	operation.planKey = source.planKey
+	source.mu.RUnlock()
+	if start > stageIndex("pre_hooks") {
+		operation.Status.HookLog = sourceStatus.HookLog
+	}
+	if start > stageIndex("init") {
+		operation.Status.InitLog = sourceStatus.InitLog
+	}
+	if start > stageIndex("plan") {
+		operation.Status.PlanLog = sourceStatus.PlanLog
+		operation.Status.PlanJSON = sourceStatus.PlanJSON
+	}
+	operation.initStages(previous, start)
+
+	go func() {
+		defer close(operation.LogChan)
+		operation.log(fmt.Sprintf("Retrying deployment %s from stage %s", source.ID, pipelineStages[start].name))
+		runPipeline(operation, start)
+	}()
+
+	c.JSON(202, DeploymentResponse{
+		DeploymentID: operation.ID,
+		Status:       "running",
+		Message:      fmt.Sprintf("Retry started from stage %s", pipelineStages[start].name),
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// planJSONFile is the full plan JSON written next to tfplan for policy checks
+const planJSONFile = "tfplan.json"
+
+// planJSON is the subset of `show -json tfplan` passed to the backend. Attribute values
+// are dropped because plans contain secrets in plain text; the actions, replace paths
+// and reasons are enough to describe what the plan will do.
+type planJSON struct {
+	FormatVersion    string                      `json:"format_version"`
+	TerraformVersion string                      `json:"terraform_version,omitempty"`
+	ResourceChanges  []planResourceChange        `json:"resource_changes"`
+	OutputChanges    map[string]planOutputChange `json:"output_changes,omitempty"`
+}
+
+type planOutputChange struct {
+	Actions []string `json:"actions"`
+}
+
+type planResourceChange struct {
+	Address         string `json:"address"`
+	PreviousAddress string `json:"previous_address,omitempty"`
+	ModuleAddress   string `json:"module_address,omitempty"`
+	Mode            string `json:"mode"`
+	Type            string `json:"type"`
+	Name            string `json:"name"`
+	Deposed         string `json:"deposed,omitempty"`
+	ActionReason    string `json:"action_reason,omitempty"`
+	Change          struct {
+		Actions      []string        `json:"actions"`
+		ReplacePaths json.RawMessage `json:"replace_paths,omitempty"`
+		Importing    json.RawMessage `json:"importing,omitempty"`
+	} `json:"change"`
+}
+
+// capturePlanJSON renders the saved plan as JSON without logging it. The full output is
+// kept in planJSONFile inside the work directory; the returned JSON is sanitized.
+func capturePlanJSON(deployment *Deployment, workDir string) (json.RawMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cmd := newCommand(ctx, deployment, workDir, deploymentEnv(deployment), false, toolName(deployment.Request), toolArgs(deployment.Request, "show", "-json", "tfplan")...)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(workDir, planJSONFile), output, 0600); err != nil {
+		return nil, err
+	}
+
+	// terragrunt run-all prints one plan document per unit; their changes are combined
+	var plan planJSON
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	for decoder.More() {
+		var unit planJSON
+		if err := decoder.Decode(&unit); err != nil {
+			return nil, err
+		}
+		if plan.FormatVersion == "" {
+			plan.FormatVersion = unit.FormatVersion
+			plan.TerraformVersion = unit.TerraformVersion
+		}
+		plan.ResourceChanges = append(plan.ResourceChanges, unit.ResourceChanges...)
+		for name, change := range unit.OutputChanges {
+			if plan.OutputChanges == nil {
+				plan.OutputChanges = map[string]planOutputChange{}
+			}
+			plan.OutputChanges[name] = change
+		}
+	}
+	return json.Marshal(plan)
+}
+
+func (d *Deployment) setPlanJSON(plan json.RawMessage) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Status.PlanJSON = plan
+}
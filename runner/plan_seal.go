@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// A plan awaiting approval is sealed: the saved plan files (tfplan, and tfplan.json kept
+// for policy checks), which hold every attribute value of the plan in clear text, are
+// encrypted with a key that only exists in the runner's memory for the deployment and
+// are restored once it is approved. A rejected, expired or cancelled plan is never
+// decrypted again, and no plan can be read from a work directory left by a runner that
+// stopped.
+
+// sealedPlanFiles are the names of the plan files sealed while awaiting approval; under
+// terragrunt run-all every unit has its own
+var sealedPlanFiles = map[string]bool{"tfplan": true, planJSONFile: true}
+
+// sealedSuffix is appended to the name of a sealed plan file
+const sealedSuffix = ".sealed"
+
+// planCipher returns the cipher of the deployment's plan key, creating the key on first use
+func (d *Deployment) planCipher() (cipher.AEAD, error) {
+	d.mu.Lock()
+	if d.planKey == nil {
+		d.planKey = make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, d.planKey); err != nil {
+			d.planKey = nil
+			d.mu.Unlock()
+			return nil, err
+		}
+	}
+	key := d.planKey
+	d.mu.Unlock()
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// planFiles returns the plan files below deployPath, either the clear ones or the sealed
+func planFiles(deployPath string, sealed bool) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(deployPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		name := entry.Name()
+		if sealed {
+			if filepath.Ext(name) != sealedSuffix || !sealedPlanFiles[name[:len(name)-len(sealedSuffix)]] {
+				return nil
+			}
+		} else if !sealedPlanFiles[name] {
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	return files, err
+}
+
+// sealPlan encrypts the plan files below deployPath and removes the clear ones
+func sealPlan(d *Deployment, deployPath string) error {
+	files, err := planFiles(deployPath, false)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+	aead, err := d.planCipher()
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file+sealedSuffix, aead.Seal(nonce, nonce, content, nil), 0600); err != nil {
+			return err
+		}
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+	d.log(fmt.Sprintf("Sealed %d plan file(s) until approval", len(files)))
+	return nil
+}
+
+// unsealPlan restores the plan files below deployPath sealed by sealPlan
+func unsealPlan(d *Deployment, deployPath string) error {
+	files, err := planFiles(deployPath, true)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+	d.mu.RLock()
+	hasKey := d.planKey != nil
+	d.mu.RUnlock()
+	if !hasKey {
+		return fmt.Errorf("the plan was sealed by another runner process and cannot be decrypted; re-plan required")
+	}
+	aead, err := d.planCipher()
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if len(content) < aead.NonceSize() {
+			return fmt.Errorf("sealed plan %s is truncated", filepath.Base(file))
+		}
+		plain, err := aead.Open(nil, content[:aead.NonceSize()], content[aead.NonceSize():], nil)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %v", filepath.Base(file), err)
+		}
+		if err := os.WriteFile(file[:len(file)-len(sealedSuffix)], plain, 0600); err != nil {
+			return err
+		}
+		os.Remove(file)
+	}
+	return nil
+}
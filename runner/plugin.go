@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ToolPlugin runs one IaC tool inside the deployment pipeline. The pipeline itself
+// clones the repository, runs hooks and policy checks and waits for confirmation
+// (approval); a plugin implements the tool-specific steps in between:
+//
+//	clone → Prepare → Preview → confirm → Execute → Outputs
+//
+// Methods run in the deployment path and report progress with d.log. They return an
+// error to fail the stage, or a *stageStop to end the deployment as cancelled, stale or expired.
+type ToolPlugin interface {
+	// Prepare readies the working directory, e.g. installs providers and selects the workspace
+	Prepare(d *Deployment, deployPath string) error
+	// Validate checks the configuration; it runs only when the request enables validation
+	Validate(d *Deployment, deployPath string) error
+	// Preview computes the changes Execute will make and keeps them for Execute. Plugins
+	// that can describe the changes as JSON set the plan JSON and write planJSONFile.
+	Preview(d *Deployment, deployPath string) error
+	// Execute makes the previewed changes
+	Execute(d *Deployment, deployPath string) error
+	// Outputs collects the values the deployment exports after Execute
+	Outputs(d *Deployment, deployPath string) error
+}
+
+// plugins maps the request's tool to the plugin that runs it
+var plugins = map[string]ToolPlugin{}
+
+// registerPlugin makes a plugin available as tool name
+func registerPlugin(name string, plugin ToolPlugin) {
+	plugins[name] = plugin
+}
+
+func init() {
+	registerPlugin("terraform", terraformPlugin{})
+	registerPlugin("tofu", terraformPlugin{})
+	// Terragrunt forwards the terraform commands to the binary it wraps
+	registerPlugin("terragrunt", terraformPlugin{})
+}
+
+// pluginFor returns the plugin for the requested tool
+func pluginFor(req DeploymentRequest) (ToolPlugin, error) {
+	plugin, ok := plugins[req.Tool]
+	if !ok {
+		names := make([]string, 0, len(plugins))
+		for name := range plugins {
+			names = append(names, "'"+name+"'")
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("tool must be one of %s", strings.Join(names, ", "))
+	}
+	return plugin, nil
+}
+
+// tool returns the plugin running the deployment. The tool was checked when the
+// deployment was requested.
+func (d *Deployment) tool() ToolPlugin {
+	return plugins[d.Request.Tool]
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Registry token fetches and git clones and fetches are retried on transient network
+// errors with exponential backoff and jitter, configured like the backend's:
+// RETRY_ATTEMPTS (3, including the first), RETRY_BACKOFF (1s, doubled for each retry),
+// RETRY_MAX_BACKOFF (30s) and RETRY_JITTER (0.2, the randomized fraction of each delay).
+
+// retryPolicy is how often and how fast a failing operation is retried
+type retryPolicy struct {
+	attempts  int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	jitter    float64
+}
+
+// retryPolicyFromEnv returns the retry policy configured by the environment
+func retryPolicyFromEnv() retryPolicy {
+	p := retryPolicy{attempts: 3, baseDelay: time.Second, maxDelay: 30 * time.Second, jitter: 0.2}
+	if n, err := strconv.Atoi(os.Getenv("RETRY_ATTEMPTS")); err == nil && n > 0 {
+		p.attempts = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("RETRY_BACKOFF")); err == nil && d >= 0 {
+		p.baseDelay = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("RETRY_MAX_BACKOFF")); err == nil && d >= 0 {
+		p.maxDelay = d
+	}
+	if j, err := strconv.ParseFloat(os.Getenv("RETRY_JITTER"), 64); err == nil && j >= 0 && j <= 1 {
+		p.jitter = j
+	}
+	return p
+}
+
+// permanentError is an error retrying cannot fix
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// withRetry runs fn until it succeeds, returns an error wrapped in permanentError or runs
+// out of attempts. Each retry is logged, and reported to logf when it is set (a run's log).
+func withRetry(name string, logf func(string), fn func() error) error {
+	p := retryPolicyFromEnv()
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		if attempt >= p.attempts {
+			if attempt > 1 {
+				return fmt.Errorf("%w (after %d attempts)", err, attempt)
+			}
+			return err
+		}
+		delay := p.delay(attempt)
+		message := fmt.Sprintf("%s failed (attempt %d/%d), retrying in %s: %v", name, attempt, p.attempts, delay, err)
+		log.Printf("Retry: %s", message)
+		if logf != nil {
+			logf(message)
+		}
+		time.Sleep(delay)
+	}
+}
+
+// delay returns the backoff before retry number attempt
+func (p retryPolicy) delay(attempt int) time.Duration {
+	delay := p.baseDelay << (attempt - 1)
+	if delay > p.maxDelay || delay <= 0 {
+		delay = p.maxDelay
+	}
+	if p.jitter > 0 {
+		spread := float64(delay) * p.jitter
+		delay = time.Duration(float64(delay) - spread + rand.Float64()*2*spread)
+	}
+	return delay.Round(time.Millisecond)
+}
+
+// transientGitOutput are messages of git failures caused by the network or an overloaded
+// server, rather than by credentials or a missing repository or ref
+var transientGitOutput = []string{
+	"could not resolve host",
+	"connection timed out",
+	"connection reset",
+	"connection refused",
+	"operation timed out",
+	"early eof",
+	"the remote end hung up unexpectedly",
+	"rpc failed",
+	"unexpected disconnect",
+	"tls connection was non-properly terminated",
+	"gnutls recv error",
+	"the requested url returned error: 429",
+	"the requested url returned error: 502",
+	"the requested url returned error: 503",
+	"the requested url returned error: 504",
+	"temporary failure in name resolution",
+}
+
+// transientGit reports whether the output of a failed git command points to a transient
+// network error
+func transientGit(output string) bool {
+	output = strings.ToLower(output)
+	for _, message := range transientGitOutput {
+		if strings.Contains(output, message) {
+			return true
+		}
+	}
+	return false
+}
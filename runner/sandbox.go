@@ -0,0 +1,393 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Optional sandboxing of the commands a deployment runs (terraform, hooks, state reads).
+// Git clones and registry setup stay with the runner's own user. Everything is off unless
+// configured:
+//
+//   - RUNNER_SANDBOX_UID / RUNNER_SANDBOX_GID: run commands as this low-privilege user
+//     (the runner must be root); the work directory is handed over to it
+//   - RUNNER_SANDBOX_NO_NEW_PRIVS=true: commands cannot gain privileges (setuid binaries,
+//     file capabilities); needs setpriv(1) for local commands
+//   - RUNNER_SANDBOX_SECCOMP: seccomp profile for run containers (docker executor)
+//   - RUNNER_SANDBOX_EGRESS_ALLOWLIST: hosts commands may reach through the runner's
+//     egress proxy; combine with a firewall rule that blocks the sandbox UID otherwise
+//   - RUNNER_SANDBOX_CPUS / RUNNER_SANDBOX_MEMORY: per-run limits, via cgroup v2 for local
+//     commands (outside Kubernetes, where pod limits apply instead)
+type sandboxConfig struct {
+	uid, gid     int
+	dropUser     bool
+	noNewPrivs   bool
+	setpriv      string
+	seccomp      string
+	allowlist    []string
+	proxyURL     string
+	cpus         float64
+	memory       int64
+	cgroupRoot   string
+	cgroupsReady bool
+}
+
+var sandbox sandboxConfig
+
+// initSandbox reads the sandbox configuration and starts the egress proxy
+func initSandbox() error {
+	if uid := os.Getenv("RUNNER_SANDBOX_UID"); uid != "" {
+		var err error
+		if sandbox.uid, err = strconv.Atoi(uid); err != nil || sandbox.uid < 0 {
+			return fmt.Errorf("invalid RUNNER_SANDBOX_UID %q", uid)
+		}
+		sandbox.gid = sandbox.uid
+		if gid := os.Getenv("RUNNER_SANDBOX_GID"); gid != "" {
+			if sandbox.gid, err = strconv.Atoi(gid); err != nil || sandbox.gid < 0 {
+				return fmt.Errorf("invalid RUNNER_SANDBOX_GID %q", gid)
+			}
+		}
+		if os.Geteuid() != 0 {
+			return fmt.Errorf("RUNNER_SANDBOX_UID requires the runner to run as root")
+		}
+		sandbox.dropUser = true
+		log.Printf("Sandbox: commands run as uid %d, gid %d", sandbox.uid, sandbox.gid)
+	}
+
+	if os.Getenv("RUNNER_SANDBOX_NO_NEW_PRIVS") == "true" {
+		sandbox.noNewPrivs = true
+		if path, err := exec.LookPath("setpriv"); err == nil {
+			sandbox.setpriv = path
+		} else {
+			log.Println("Warning: setpriv not found, no-new-privileges only applies to run containers")
+		}
+	}
+
+	if profile := os.Getenv("RUNNER_SANDBOX_SECCOMP"); profile != "" {
+		if _, err := os.Stat(profile); err != nil {
+			return fmt.Errorf("RUNNER_SANDBOX_SECCOMP: %w", err)
+		}
+		sandbox.seccomp = profile
+		log.Println("Sandbox: seccomp profile applies to run containers (docker executor) only")
+	}
+
+	if cpus := os.Getenv("RUNNER_SANDBOX_CPUS"); cpus != "" {
+		var err error
+		if sandbox.cpus, err = strconv.ParseFloat(cpus, 64); err != nil || sandbox.cpus <= 0 {
+			return fmt.Errorf("invalid RUNNER_SANDBOX_CPUS %q", cpus)
+		}
+	}
+	if memory := os.Getenv("RUNNER_SANDBOX_MEMORY"); memory != "" {
+		var err error
+		if sandbox.memory, err = parseBytes(memory); err != nil {
+			return fmt.Errorf("invalid RUNNER_SANDBOX_MEMORY %q", memory)
+		}
+	}
+	if sandbox.cpus > 0 || sandbox.memory > 0 {
+		sandbox.cgroupRoot = os.Getenv("RUNNER_SANDBOX_CGROUP_ROOT")
+		if sandbox.cgroupRoot == "" {
+			sandbox.cgroupRoot = "/sys/fs/cgroup/iac-runner"
+		}
+		if err := prepareCgroupRoot(sandbox.cgroupRoot); err != nil {
+			// Run containers get --cpus/--memory regardless
+			log.Printf("Warning: cgroup limits unavailable for local commands: %v", err)
+		} else {
+			sandbox.cgroupsReady = true
+			log.Printf("Sandbox: per-run limits cpus=%g memory=%d bytes (%s)", sandbox.cpus, sandbox.memory, sandbox.cgroupRoot)
+		}
+	}
+
+	if allowlist := os.Getenv("RUNNER_SANDBOX_EGRESS_ALLOWLIST"); allowlist != "" {
+		for _, host := range strings.Split(allowlist, ",") {
+			if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+				sandbox.allowlist = append(sandbox.allowlist, host)
+			}
+		}
+		listen := os.Getenv("RUNNER_SANDBOX_PROXY_LISTEN")
+		if listen == "" {
+			listen = "127.0.0.1:3128"
+		}
+		listener, err := net.Listen("tcp", listen)
+		if err != nil {
+			return fmt.Errorf("starting egress proxy: %w", err)
+		}
+		// Run containers cannot reach the runner's loopback, so the URL they use is configurable
+		sandbox.proxyURL = os.Getenv("RUNNER_SANDBOX_PROXY_URL")
+		if sandbox.proxyURL == "" {
+			sandbox.proxyURL = "http://" + listener.Addr().String()
+		}
+		go http.Serve(listener, http.HandlerFunc(egressProxy))
+		log.Printf("Sandbox: egress proxy on %s allows %s", listener.Addr(), strings.Join(sandbox.allowlist, ", "))
+	}
+
+	return nil
+}
+
+// parseBytes parses a size such as "512m", "2g" or a plain byte count
+func parseBytes(s string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "k"):
+		multiplier, s = 1<<10, strings.TrimSuffix(s, "k")
+	case strings.HasSuffix(s, "m"):
+		multiplier, s = 1<<20, strings.TrimSuffix(s, "m")
+	case strings.HasSuffix(s, "g"):
+		multiplier, s = 1<<30, strings.TrimSuffix(s, "g")
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size")
+	}
+	return n * multiplier, nil
+}
+
+// sandboxEnv returns environment variables every sandboxed command gets. They come after
+// the deployment's own variables, so a run cannot point itself past the proxy.
+func sandboxEnv(deployment *Deployment) []string {
+	var env []string
+	if sandbox.dropUser {
+		env = append(env, "HOME="+sandboxHome(deployment))
+	}
+	if sandbox.proxyURL != "" {
+		env = append(env,
+			"HTTP_PROXY="+sandbox.proxyURL, "HTTPS_PROXY="+sandbox.proxyURL,
+			"http_proxy="+sandbox.proxyURL, "https_proxy="+sandbox.proxyURL,
+			"NO_PROXY=", "no_proxy=",
+		)
+	}
+	return env
+}
+
+// sandboxHome is the sandbox user's home directory, inside the run's work directory
+func sandboxHome(deployment *Deployment) string {
+	return filepath.Join(deployment.WorkDir, ".home")
+}
+
+// sandboxDockerArgs returns the docker run flags that apply the sandbox to a run container
+func sandboxDockerArgs() []string {
+	var args []string
+	if sandbox.dropUser {
+		args = append(args, "--user", fmt.Sprintf("%d:%d", sandbox.uid, sandbox.gid))
+	}
+	if sandbox.noNewPrivs {
+		args = append(args, "--security-opt", "no-new-privileges")
+	}
+	if sandbox.seccomp != "" {
+		args = append(args, "--security-opt", "seccomp="+sandbox.seccomp)
+	}
+	if sandbox.cpus > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(sandbox.cpus, 'f', -1, 64))
+	}
+	if sandbox.memory > 0 {
+		args = append(args, "--memory", strconv.FormatInt(sandbox.memory, 10))
+	}
+	return args
+}
+
+// sandboxLocal applies the sandbox to a command that runs directly on the runner. Setup
+// failures are reported through cmd.Err so the command fails to start instead of
+// running unconfined.
+func sandboxLocal(cmd *exec.Cmd, deployment *Deployment) {
+	if sandbox.setpriv != "" {
+		cmd.Args = append([]string{sandbox.setpriv, "--no-new-privs", "--"}, cmd.Args...)
+		cmd.Path = sandbox.setpriv
+	}
+
+	if sandbox.dropUser {
+		if err := handOverWorkDir(deployment); err != nil {
+			cmd.Err = fmt.Errorf("sandbox: preparing work directory: %w", err)
+			return
+		}
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(sandbox.uid), Gid: uint32(sandbox.gid)}
+	}
+
+	if sandbox.cgroupsReady {
+		fd, err := runCgroup(deployment)
+		if err != nil {
+			cmd.Err = fmt.Errorf("sandbox: %w", err)
+			return
+		}
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = fd
+	}
+}
+
+// handOverWorkDir gives the sandbox user the work directory, which the runner fills
+// (clone, .terraformrc) as itself
+func handOverWorkDir(deployment *Deployment) error {
+	if err := os.MkdirAll(sandboxHome(deployment), 0700); err != nil {
+		return err
+	}
+	return filepath.WalkDir(deployment.WorkDir, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, sandbox.uid, sandbox.gid)
+	})
+}
+
+// prepareCgroupRoot creates the cgroup v2 parent of the per-run cgroups and enables the
+// cpu and memory controllers for them
+func prepareCgroupRoot(root string) error {
+	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err != nil {
+		return fmt.Errorf("cgroup v2 is not mounted at /sys/fs/cgroup")
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(root, "cgroup.subtree_control"), []byte("+cpu +memory"), 0644)
+}
+
+// runCgroups holds the open cgroup directories of runs, keyed by work directory, so the
+// commands and state operations of one run share its limits
+var runCgroups = struct {
+	sync.Mutex
+	dirs map[string]*os.File
+}{dirs: map[string]*os.File{}}
+
+// runCgroup returns a descriptor of the run's cgroup, creating it with the configured limits
+func runCgroup(deployment *Deployment) (int, error) {
+	runCgroups.Lock()
+	defer runCgroups.Unlock()
+
+	if dir, ok := runCgroups.dirs[deployment.WorkDir]; ok {
+		return int(dir.Fd()), nil
+	}
+
+	path := filepath.Join(sandbox.cgroupRoot, filepath.Base(deployment.WorkDir))
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return 0, fmt.Errorf("creating cgroup: %w", err)
+	}
+	if sandbox.cpus > 0 {
+		const period = 100000
+		quota := fmt.Sprintf("%d %d", int64(sandbox.cpus*period), period)
+		if err := os.WriteFile(filepath.Join(path, "cpu.max"), []byte(quota), 0644); err != nil {
+			return 0, fmt.Errorf("setting cpu limit: %w", err)
+		}
+	}
+	if sandbox.memory > 0 {
+		if err := os.WriteFile(filepath.Join(path, "memory.max"), []byte(strconv.FormatInt(sandbox.memory, 10)), 0644); err != nil {
+			return 0, fmt.Errorf("setting memory limit: %w", err)
+		}
+	}
+
+	dir, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("opening cgroup: %w", err)
+	}
+	runCgroups.dirs[deployment.WorkDir] = dir
+	return int(dir.Fd()), nil
+}
+
+// removeRunCgroup deletes the run's cgroup once its work directory is cleaned up
+func removeRunCgroup(workDir string) {
+	runCgroups.Lock()
+	defer runCgroups.Unlock()
+
+	dir, ok := runCgroups.dirs[workDir]
+	if !ok {
+		return
+	}
+	dir.Close()
+	delete(runCgroups.dirs, workDir)
+	if err := os.Remove(dir.Name()); err != nil {
+		log.Printf("Warning: failed to remove cgroup %s: %v", dir.Name(), err)
+	}
+}
+
+// egressAllowed reports whether the proxy may connect to host
+func egressAllowed(host string) bool {
+	return hostMatches(host, sandbox.allowlist)
+}
+
+// hostMatches reports whether host matches one of the entries. Entries match the host
+// exactly; entries starting with "." or "*." also match subdomains.
+func hostMatches(host string, entries []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, entry := range entries {
+		if suffix := strings.TrimPrefix(entry, "*"); strings.HasPrefix(suffix, ".") {
+			if strings.HasSuffix(host, suffix) || host == suffix[1:] {
+				return true
+			}
+		} else if host == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// egressProxy is a forward proxy that only reaches allowlisted hosts: CONNECT tunnels for
+// HTTPS and absolute-URI requests for plain HTTP
+func egressProxy(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Hostname()
+	if r.Method == http.MethodConnect {
+		host, _, _ = net.SplitHostPort(r.Host)
+	}
+	if !egressAllowed(host) {
+		log.Printf("Sandbox: blocked egress to %s", r.Host)
+		http.Error(w, "egress to "+host+" is not allowed by RUNNER_SANDBOX_EGRESS_ALLOWLIST", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != http.MethodConnect {
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for k, values := range resp.Header {
+			for _, v := range values {
+				w.Header().Add(k, v)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	upstream, err := net.DialTimeout("tcp", r.Host, 30*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+	client, _, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+
+	go func() {
+		io.Copy(upstream, client)
+		upstream.Close()
+	}()
+	io.Copy(client, upstream)
+	client.Close()
+}
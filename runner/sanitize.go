@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Run inputs end up as paths and command-line arguments of git and terraform. They are
+// checked when a deployment is accepted, so a request can neither reach outside the clone
+// (path "../../etc") nor smuggle options such as -chdir or -state into a command. Paths are
+// checked again once the repository is cloned, since a symlink in it may point elsewhere.
+
+// flagSpec describes a flag users may pass to terraform init or plan
+type flagSpec struct {
+	value bool // takes a value, as -name=value or -name value (otherwise a boolean)
+	path  bool // the value is a file that must stay within the clone
+}
+
+// initFlags are the flags accepted in init_flags
+var initFlags = map[string]flagSpec{
+	"backend":        {},
+	"backend-config": {value: true, path: true},
+	"force-copy":     {},
+	"get":            {},
+	"input":          {},
+	"lock":           {},
+	"lock-timeout":   {value: true},
+	"lockfile":       {value: true},
+	"migrate-state":  {},
+	"no-color":       {},
+	"plugin-dir":     {value: true, path: true},
+	"reconfigure":    {},
+	"upgrade":        {},
+}
+
+// planFlags are the flags accepted in plan_flags. -out, -destroy, -state and output
+// format flags are set by the runner itself.
+var planFlags = map[string]flagSpec{
+	"compact-warnings":    {},
+	"generate-config-out": {value: true, path: true},
+	"input":               {},
+	"lock":                {},
+	"lock-timeout":        {value: true},
+	"no-color":            {},
+	"parallelism":         {value: true},
+	"refresh":             {},
+	"refresh-only":        {},
+	"replace":             {value: true},
+	"target":              {value: true},
+	"var":                 {value: true},
+	"var-file":            {value: true, path: true},
+}
+
+var (
+	workspacePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,89}$`)
+	refPattern       = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_./+@-]{0,254}$`)
+)
+
+// cleanRelativePath cleans p, a path relative to base (both relative to the clone root),
+// and rejects it when it is absolute, escapes the clone, looks like a flag or contains
+// control characters. It returns p cleaned.
+func cleanRelativePath(field, base, p string) (string, error) {
+	if p == "" {
+		return "", fmt.Errorf("%s must not be empty", field)
+	}
+	for _, r := range p {
+		if r < 0x20 || r == 0x7f {
+			return "", fmt.Errorf("%s %q contains control characters", field, p)
+		}
+	}
+	if strings.HasPrefix(p, "/") || strings.HasPrefix(p, "\\") || filepath.IsAbs(p) {
+		return "", fmt.Errorf("%s %q must be relative to the repository", field, p)
+	}
+	if strings.HasPrefix(p, "-") {
+		return "", fmt.Errorf("%s %q must not start with '-'", field, p)
+	}
+	if joined := path.Clean(path.Join(base, p)); joined == ".." || strings.HasPrefix(joined, "../") {
+		return "", fmt.Errorf("%s %q points outside the repository", field, p)
+	}
+	return path.Clean(p), nil
+}
+
+// parseToolFlags splits init_flags or plan_flags into arguments and rejects flags that are
+// not allowed, positional arguments and files outside the clone. Paths are relative to
+// deployPath, the run's directory within the clone.
+func parseToolFlags(field, flags, deployPath string, allowed map[string]flagSpec) ([]string, error) {
+	args := parseShellArgs(flags)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" || arg == "--" {
+			return nil, fmt.Errorf("%s: unexpected argument %q (only flags are allowed)", field, arg)
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		spec, ok := allowed[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: flag -%s is not allowed", field, name)
+		}
+		if !spec.value {
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("%s: flag -%s needs a value", field, name)
+			}
+			i++
+			value = args[i]
+		}
+		if spec.path && !(name == "backend-config" && strings.Contains(value, "=")) {
+			if _, err := cleanRelativePath(field+" -"+name, deployPath, value); err != nil {
+				return nil, err
+			}
+		}
+		if name == "lockfile" && value != "readonly" {
+			return nil, fmt.Errorf("%s: -lockfile only accepts 'readonly'", field)
+		}
+	}
+	return args, nil
+}
+
+// sanitizeRequest checks the paths, flags and names of a deployment request and cleans
+// its paths. The error explains which input was rejected.
+func sanitizeRequest(req *DeploymentRequest) error {
+	if !strings.HasPrefix(req.GitURL, "https://") && !strings.HasPrefix(req.GitURL, "http://") {
+		return fmt.Errorf("git_url must be an http(s) URL")
+	}
+	if !refPattern.MatchString(req.GitRef) || strings.Contains(req.GitRef, "..") {
+		return fmt.Errorf("git_ref %q is not a valid branch or tag name", req.GitRef)
+	}
+
+	p, err := cleanRelativePath("path", ".", req.Path)
+	if err != nil {
+		return err
+	}
+	req.Path = p
+	for i, file := range req.TfvarsFiles {
+		if req.TfvarsFiles[i], err = cleanRelativePath("tfvars_files", req.Path, file); err != nil {
+			return err
+		}
+	}
+	for i, sparsePath := range req.SparsePaths {
+		if req.SparsePaths[i], err = cleanRelativePath("sparse_paths", ".", sparsePath); err != nil {
+			return err
+		}
+	}
+
+	if _, err := parseToolFlags("init_flags", req.InitFlags, req.Path, initFlags); err != nil {
+		return err
+	}
+	if _, err := parseToolFlags("plan_flags", req.PlanFlags, req.Path, planFlags); err != nil {
+		return err
+	}
+	if req.Workspace != "" && !workspacePattern.MatchString(req.Workspace) {
+		return fmt.Errorf("workspace %q may only contain letters, digits, '_', '.' and '-' and must not start with '-' or '.'", req.Workspace)
+	}
+	return nil
+}
+
+// confinePath resolves rel within root, following symlinks, and fails when the result
+// lies outside root. Files that do not exist yet are checked by their nearest existing
+// parent.
+func confinePath(root, rel string) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(root, rel)
+	for {
+		resolved, err := filepath.EvalSymlinks(target)
+		if err == nil {
+			if resolved != realRoot && !strings.HasPrefix(resolved, realRoot+string(filepath.Separator)) {
+				return fmt.Errorf("%s resolves to a location outside the repository", rel)
+			}
+			return nil
+		}
+		parent := filepath.Dir(target)
+		if parent == target || len(parent) < len(root) {
+			return nil
+		}
+		target = parent
+	}
+}
+
+// checkClonedPaths confines the request's path and tfvars files to the clone now that
+// symlinks in the repository can be resolved
+func checkClonedPaths(d *Deployment) error {
+	if err := confinePath(d.WorkDir, d.Request.Path); err != nil {
+		return fmt.Errorf("path: %v", err)
+	}
+	for _, file := range d.Request.TfvarsFiles {
+		if err := confinePath(d.WorkDir, filepath.Join(d.Request.Path, file)); err != nil {
+			return fmt.Errorf("tfvars_files: %v", err)
+		}
+	}
+	return nil
+}
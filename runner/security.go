@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Backend↔runner traffic is authenticated with the same scheme as the backend's
+// internal/signing package: with RUNNER_SHARED_SECRET set, requests carry
+// X-Signature-Timestamp, X-Signature-Nonce and X-Signature (HMAC-SHA256 of method, request
+// URI, timestamp, nonce and body hash) and responses carry X-Signature over the request signature, status and
+// body hash. Live log streams are not signed. RUNNER_TLS_* adds mutual TLS.
+const (
+	signatureTimestampHeader = "X-Signature-Timestamp"
+	signatureNonceHeader     = "X-Signature-Nonce"
+	signatureHeader          = "X-Signature"
+	signatureMaxSkew         = 5 * time.Minute
+)
+
+// sharedSecret returns the signing secret; signing is disabled when it is empty
+func sharedSecret() string {
+	return os.Getenv("RUNNER_SHARED_SECRET")
+}
+
+// hmacHex returns the hex HMAC-SHA256 of the lines joined by newlines
+func hmacHex(secret string, lines ...string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sha256Hex returns the hex SHA-256 of a body
+func sha256Hex(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+func requestSignature(secret, method, requestURI, timestamp, nonce string, body []byte) string {
+	return hmacHex(secret, method, requestURI, timestamp, nonce, sha256Hex(body))
+}
+
+// newNonce returns a random request nonce
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func responseSignature(secret, reqSignature string, status int, body []byte) string {
+	return hmacHex(secret, "response", reqSignature, strconv.Itoa(status), sha256Hex(body))
+}
+
+// usedNonces remembers the nonces of accepted requests so a captured request cannot be
+// replayed, while identical requests with their own nonces are still accepted
+var usedNonces = struct {
+	sync.Mutex
+	at map[string]time.Time
+}{at: map[string]time.Time{}}
+
+// verifyRequest checks the signature headers of a request from the backend
+func verifyRequest(secret string, r *http.Request, body []byte) error {
+	timestamp := r.Header.Get(signatureTimestampHeader)
+	nonce := r.Header.Get(signatureNonceHeader)
+	signature := r.Header.Get(signatureHeader)
+	if timestamp == "" || nonce == "" || signature == "" {
+		return errors.New("request is not signed")
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid signature timestamp")
+	}
+	if skew := time.Since(time.Unix(unix, 0)); skew > signatureMaxSkew || skew < -signatureMaxSkew {
+		return errors.New("signature timestamp is outside the allowed clock skew")
+	}
+	if !hmac.Equal([]byte(signature), []byte(requestSignature(secret, r.Method, r.URL.RequestURI(), timestamp, nonce, body))) {
+		return errors.New("invalid request signature")
+	}
+
+	usedNonces.Lock()
+	defer usedNonces.Unlock()
+	now := time.Now()
+	for used, at := range usedNonces.at {
+		if now.Sub(at) > 2*signatureMaxSkew {
+			delete(usedNonces.at, used)
+		}
+	}
+	if _, replayed := usedNonces.at[nonce]; replayed {
+		return errors.New("request nonce was already used")
+	}
+	usedNonces.at[nonce] = now
+	return nil
+}
+
+// signedResponseWriter holds back the response so its signature can be sent as a header
+type signedResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *signedResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *signedResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// WriteHeaderNow is deferred until the signature is known
+func (w *signedResponseWriter) WriteHeaderNow() {}
+
+// requireSignature rejects requests the backend did not sign and signs the responses.
+// /health stays open for container health checks; the log stream is verified but its
+// response is not signed. Without RUNNER_SHARED_SECRET every request passes.
+func requireSignature() gin.HandlerFunc {
+	secret := sharedSecret()
+	return func(c *gin.Context) {
+		if secret == "" || c.Request.URL.Path == "/health" || c.Request.Method == "OPTIONS" {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(400, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err := verifyRequest(secret, c.Request, body); err != nil {
+			log.Printf("Rejected unsigned request %s %s from %s: %v", c.Request.Method, c.Request.URL.Path, c.ClientIP(), err)
+			c.AbortWithStatusJSON(401, gin.H{"error": err.Error()})
+			return
+		}
+
+		if c.FullPath() == "/deploy/:id/logs" {
+			c.Next()
+			return
+		}
+
+		writer := &signedResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		reqSignature := c.Request.Header.Get(signatureHeader)
+		writer.Header().Set(signatureHeader, responseSignature(secret, reqSignature, writer.Status(), writer.body.Bytes()))
+		writer.ResponseWriter.WriteHeaderNow()
+		writer.ResponseWriter.Write(writer.body.Bytes())
+	}
+}
+
+// signingTransport signs requests to the backend and verifies the responses
+type signingTransport struct {
+	base   http.RoundTripper
+	secret string
+}
+
+func (t *signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := requestSignature(t.secret, req.Method, req.URL.RequestURI(), timestamp, nonce, body)
+	req.Header.Set(signatureTimestampHeader, timestamp)
+	req.Header.Set(signatureNonceHeader, nonce)
+	req.Header.Set(signatureHeader, signature)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(resp.Header.Get(signatureHeader)), []byte(responseSignature(t.secret, signature, resp.StatusCode, respBody))) {
+		return nil, fmt.Errorf("response from %s has no valid signature", req.URL.Host)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	return resp, nil
+}
+
+// backendClient returns the client for callbacks to the backend, through the outbound
+// proxies and CAs and signed when RUNNER_SHARED_SECRET is set
+func backendClient() *http.Client {
+	client := &http.Client{Timeout: 30 * time.Second, Transport: outboundTransport()}
+	if secret := sharedSecret(); secret != "" {
+		client.Transport = &signingTransport{base: client.Transport, secret: secret}
+	}
+	return client
+}
+
+// serve listens on addr, with TLS when RUNNER_TLS_CERT and RUNNER_TLS_KEY are set or
+// RUNNER_TLS_ACME_DOMAINS lists domains to obtain certificates for from an ACME CA.
+// RUNNER_TLS_CLIENT_CA then lists the CAs whose client certificates (the backend's) are
+// accepted; without it no client certificate is required. RUNNER_TLS_REDIRECT_ADDR adds
+// a plain HTTP listener that redirects to HTTPS (and answers ACME http-01 challenges).
+func serve(r *gin.Engine, addr string) error {
+	certFile, keyFile := os.Getenv("RUNNER_TLS_CERT"), os.Getenv("RUNNER_TLS_KEY")
+	var acmeDomains []string
+	for _, domain := range strings.Split(os.Getenv("RUNNER_TLS_ACME_DOMAINS"), ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			acmeDomains = append(acmeDomains, domain)
+		}
+	}
+	redirectAddr := os.Getenv("RUNNER_TLS_REDIRECT_ADDR")
+
+	if (certFile == "") != (keyFile == "") {
+		return errors.New("RUNNER_TLS_CERT and RUNNER_TLS_KEY must be set together")
+	}
+	if certFile != "" && len(acmeDomains) > 0 {
+		return errors.New("use either RUNNER_TLS_CERT/RUNNER_TLS_KEY or RUNNER_TLS_ACME_DOMAINS, not both")
+	}
+	if certFile == "" && len(acmeDomains) == 0 {
+		if redirectAddr != "" {
+			return errors.New("RUNNER_TLS_REDIRECT_ADDR requires TLS to be configured")
+		}
+		if sharedSecret() == "" {
+			log.Println("Warning: RUNNER_SHARED_SECRET and RUNNER_TLS_* are not set, any client on the network can control deployments")
+		}
+		log.Printf("Runner HTTP server starting on %s", addr)
+		return r.Run(addr)
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile := os.Getenv("RUNNER_TLS_CLIENT_CA"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("reading RUNNER_TLS_CLIENT_CA: %w", err)
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return errors.New("RUNNER_TLS_CLIENT_CA contains no PEM certificates")
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	var redirect http.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if _, port, err := net.SplitHostPort(addr); err == nil && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+
+	if len(acmeDomains) > 0 {
+		cacheDir := os.Getenv("RUNNER_TLS_ACME_CACHE_DIR")
+		if cacheDir == "" {
+			cacheDir = "/var/cache/iac-runner/autocert"
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(acmeDomains...),
+			Cache:      autocert.DirCache(cacheDir),
+			Email:      os.Getenv("RUNNER_TLS_ACME_EMAIL"),
+		}
+		if directory := os.Getenv("RUNNER_TLS_ACME_DIRECTORY"); directory != "" {
+			manager.Client = &acme.Client{DirectoryURL: directory}
+		}
+		config.GetCertificate = manager.GetCertificate
+		config.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+		redirect = manager.HTTPHandler(redirect)
+		log.Printf("TLS certificates for %s from ACME (cache %s)", strings.Join(acmeDomains, ", "), cacheDir)
+	}
+
+	if redirectAddr != "" {
+		go func() {
+			log.Printf("Redirecting HTTP on %s to HTTPS", redirectAddr)
+			if err := http.ListenAndServe(redirectAddr, redirect); err != nil {
+				log.Printf("Warning: HTTP redirect listener stopped: %v", err)
+			}
+		}()
+	}
+
+	server := &http.Server{Addr: addr, Handler: r, TLSConfig: config}
+	log.Printf("Runner HTTPS server starting on %s (client certificates required: %t)", addr, config.ClientCAs != nil)
+	return server.ListenAndServeTLS(certFile, keyFile)
+}
+
+// hsts sets Strict-Transport-Security on HTTPS responses when RUNNER_HSTS_MAX_AGE is set
+// (a duration, e.g. 8760h); RUNNER_HSTS_INCLUDE_SUBDOMAINS=true extends it to subdomains
+func hsts() (gin.HandlerFunc, error) {
+	var maxAge time.Duration
+	if value := os.Getenv("RUNNER_HSTS_MAX_AGE"); value != "" {
+		var err error
+		if maxAge, err = time.ParseDuration(value); err != nil || maxAge < 0 {
+			return nil, fmt.Errorf("invalid RUNNER_HSTS_MAX_AGE %q", value)
+		}
+	}
+	header := "max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+	if os.Getenv("RUNNER_HSTS_INCLUDE_SUBDOMAINS") == "true" {
+		header += "; includeSubDomains"
+	}
+	return func(c *gin.Context) {
+		if maxAge > 0 && c.Request.TLS != nil {
+			c.Header("Strict-Transport-Security", header)
+		}
+		c.Next()
+	}, nil
+}
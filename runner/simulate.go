@@ -0,0 +1,486 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// With RUNNER_SIMULATE=true the runner runs deployments against a fake terraform: the
+// runner binary links itself as terraform and tofu into a directory put first in PATH,
+// and when started under one of these names it behaves like the CLI instead of serving.
+// The fake reads the resource and output blocks of the configuration and prints the
+// output terraform would (plan text, plan JSON from show -json, apply -json events), so
+// the run lifecycle, approvals, cancellation and log streaming can be exercised end to
+// end without cloud credentials. Runs control it through their environment variables:
+//
+//	SIMULATE_DELAY  pause between output lines (Go duration, default 500ms)
+//	SIMULATE_FAIL   command to fail: init, validate, plan, apply or stale (stale plan on apply)
+
+// simulatedTools are the binaries the fake replaces
+var simulatedTools = []string{"terraform", "tofu"}
+
+// simulatedVersion is the version the fake reports
+const simulatedVersion = "1.9.8"
+
+// simulating reports whether the runner uses the fake terraform
+func simulating() bool {
+	return os.Getenv("RUNNER_SIMULATE") == "true"
+}
+
+// initSimulation links the runner binary as the simulated tools and puts them first in
+// PATH, for the runner's own lookups and for the commands it starts
+func initSimulation() error {
+	if !simulating() {
+		return nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(os.TempDir(), "iac-runner-simulate")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, tool := range simulatedTools {
+		link := filepath.Join(dir, tool)
+		os.Remove(link)
+		if err := os.Symlink(exe, link); err != nil {
+			return err
+		}
+	}
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	log.Printf("⚠️ Simulation mode: %s are simulated, nothing is deployed", strings.Join(simulatedTools, " and "))
+	return nil
+}
+
+// runAsSimulatedTool runs the fake CLI when the binary was started as one of the
+// simulated tools. It does not return in that case.
+func runAsSimulatedTool() {
+	name := filepath.Base(os.Args[0])
+	for _, tool := range simulatedTools {
+		if name == tool {
+			os.Exit(newFakeTerraform(name).run(os.Args[1:]))
+		}
+	}
+}
+
+// fakeTerraform imitates the terraform CLI in the current directory
+type fakeTerraform struct {
+	tool  string
+	delay time.Duration
+	fail  string
+}
+
+// fakeChange is a planned change of one resource, as kept in the saved plan
+type fakeChange struct {
+	Address string `json:"address"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Action  string `json:"action"` // "create" or "delete"
+}
+
+// fakePlan is the content of the saved plan file
+type fakePlan struct {
+	Simulated bool         `json:"simulated"`
+	Destroy   bool         `json:"destroy"`
+	Changes   []fakeChange `json:"changes"`
+	Outputs   []string     `json:"outputs"`
+}
+
+var (
+	resourceBlockPattern = regexp.MustCompile(`(?m)^\s*resource\s+"([^"]+)"\s+"([^"]+)"`)
+	outputBlockPattern   = regexp.MustCompile(`(?m)^\s*output\s+"([^"]+)"`)
+)
+
+func newFakeTerraform(tool string) *fakeTerraform {
+	f := &fakeTerraform{tool: tool, delay: 500 * time.Millisecond, fail: os.Getenv("SIMULATE_FAIL")}
+	if d, err := time.ParseDuration(os.Getenv("SIMULATE_DELAY")); err == nil && d >= 0 {
+		f.delay = d
+	}
+	return f
+}
+
+// run executes a command and returns the exit code
+func (f *fakeTerraform) run(args []string) int {
+	if len(args) == 0 {
+		fmt.Printf("Usage: %s [global options] <subcommand> [args]\n", f.tool)
+		return 127
+	}
+	command, args := args[0], args[1:]
+	// apply fails part-way through instead (see apply)
+	if f.fail == command && command != "apply" {
+		return f.diagnostic("Simulated failure", fmt.Sprintf("SIMULATE_FAIL=%s made this command fail.", command))
+	}
+
+	switch command {
+	case "version", "-version", "--version":
+		return f.version(args)
+	case "init":
+		return f.init()
+	case "workspace":
+		if len(args) > 0 {
+			f.say(fmt.Sprintf("Switched to workspace %q.", args[len(args)-1]))
+		}
+		return 0
+	case "validate":
+		f.say("Success! The configuration is valid.")
+		return 0
+	case "plan":
+		return f.plan(args)
+	case "show":
+		return f.show(args)
+	case "apply":
+		return f.apply(args)
+	case "output":
+		return f.output()
+	case "import":
+		if len(args) >= 2 {
+			f.say(args[len(args)-2] + ": Importing from ID \"" + args[len(args)-1] + "\"...")
+			f.say(args[len(args)-2] + ": Import prepared!")
+		}
+		f.say("Import successful!")
+		return 0
+	case "state":
+		return f.state(args)
+	}
+	f.say(fmt.Sprintf("(simulated) %s %s: nothing to do", f.tool, command))
+	return 0
+}
+
+// say prints a line after the configured delay
+func (f *fakeTerraform) say(line string) {
+	time.Sleep(f.delay)
+	fmt.Println(line)
+}
+
+// diagnostic prints an error the way terraform does and returns exit code 1
+func (f *fakeTerraform) diagnostic(summary, detail string) int {
+	fmt.Println()
+	fmt.Println("Error: " + summary)
+	fmt.Println()
+	fmt.Println("  " + detail)
+	return 1
+}
+
+func (f *fakeTerraform) version(args []string) int {
+	platform := runtime.GOOS + "_" + runtime.GOARCH
+	if len(args) > 0 && args[0] == "-json" {
+		out, _ := json.Marshal(map[string]interface{}{
+			"terraform_version":   simulatedVersion,
+			"platform":            platform,
+			"provider_selections": map[string]string{},
+			"terraform_outdated":  false,
+			"simulated_by_runner": true,
+		})
+		fmt.Println(string(out))
+		return 0
+	}
+	product := "Terraform"
+	if f.tool == "tofu" {
+		product = "OpenTofu"
+	}
+	fmt.Printf("%s v%s (simulated)\non %s\n", product, simulatedVersion, platform)
+	return 0
+}
+
+// config returns the resources (sorted addresses) and outputs of the configuration. A
+// configuration without resources gets one null_resource, so every run has a change.
+func (f *fakeTerraform) config() ([]fakeChange, []string) {
+	files, _ := filepath.Glob("*.tf")
+	var resources []fakeChange
+	var outputs []string
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for _, m := range resourceBlockPattern.FindAllStringSubmatch(string(content), -1) {
+			resources = append(resources, fakeChange{Address: m[1] + "." + m[2], Type: m[1], Name: m[2]})
+		}
+		for _, m := range outputBlockPattern.FindAllStringSubmatch(string(content), -1) {
+			outputs = append(outputs, m[1])
+		}
+	}
+	if len(resources) == 0 {
+		resources = []fakeChange{{Address: "null_resource.simulated", Type: "null_resource", Name: "simulated"}}
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Address < resources[j].Address })
+	sort.Strings(outputs)
+	return resources, outputs
+}
+
+func (f *fakeTerraform) init() int {
+	resources, _ := f.config()
+	f.say("Initializing the backend...")
+	f.say("")
+	f.say("Initializing provider plugins...")
+	seen := map[string]bool{}
+	for _, r := range resources {
+		provider, _, _ := strings.Cut(r.Type, "_")
+		if seen[provider] {
+			continue
+		}
+		seen[provider] = true
+		f.say(fmt.Sprintf("- Finding latest version of hashicorp/%s...", provider))
+		f.say(fmt.Sprintf("- Installing hashicorp/%s v3.2.2 (simulated)...", provider))
+		f.say(fmt.Sprintf("- Installed hashicorp/%s v3.2.2 (simulated)", provider))
+	}
+	f.say("")
+	f.say("Terraform has been successfully initialized!")
+	return 0
+}
+
+func (f *fakeTerraform) plan(args []string) int {
+	resources, outputs := f.config()
+	plan := fakePlan{Simulated: true, Outputs: outputs}
+	out := ""
+	for _, arg := range args {
+		switch {
+		case arg == "-destroy" || arg == "--destroy":
+			plan.Destroy = true
+		case strings.HasPrefix(arg, "-out="):
+			out = strings.TrimPrefix(arg, "-out=")
+		}
+	}
+	action, symbol, verb := "create", "+", "created"
+	if plan.Destroy {
+		action, symbol, verb = "delete", "-", "destroyed"
+		plan.Outputs = nil
+	}
+	for _, r := range resources {
+		r.Action = action
+		plan.Changes = append(plan.Changes, r)
+	}
+
+	f.say("Terraform used the selected providers to generate the following execution")
+	f.say("plan. Resource actions are indicated with the following symbols:")
+	if plan.Destroy {
+		f.say("  - destroy")
+	} else {
+		f.say("  + create")
+	}
+	f.say("")
+	f.say("Terraform will perform the following actions:")
+	for _, c := range plan.Changes {
+		f.say("")
+		f.say(fmt.Sprintf("  # %s will be %s", c.Address, verb))
+		f.say(fmt.Sprintf("  %s resource %q %q {", symbol, c.Type, c.Name))
+		if plan.Destroy {
+			f.say(fmt.Sprintf("      - id = %q -> null", fakeID(c.Address)))
+		} else {
+			f.say("      + id = (known after apply)")
+		}
+		f.say("    }")
+	}
+	f.say("")
+	if plan.Destroy {
+		f.say(fmt.Sprintf("Plan: 0 to add, 0 to change, %d to destroy.", len(plan.Changes)))
+	} else {
+		f.say(fmt.Sprintf("Plan: %d to add, 0 to change, 0 to destroy.", len(plan.Changes)))
+	}
+
+	if out != "" {
+		content, _ := json.Marshal(plan)
+		if err := os.WriteFile(out, content, 0600); err != nil {
+			return f.diagnostic("Failed to write plan file", err.Error())
+		}
+		f.say("")
+		f.say("Saved the plan to: " + out)
+	}
+	return 0
+}
+
+// readPlan loads the saved plan named by the last argument
+func (f *fakeTerraform) readPlan(args []string) (*fakePlan, error) {
+	if len(args) == 0 || strings.HasPrefix(args[len(args)-1], "-") {
+		return nil, fmt.Errorf("no saved plan given")
+	}
+	content, err := os.ReadFile(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	var plan fakePlan
+	if err := json.Unmarshal(content, &plan); err != nil || !plan.Simulated {
+		return nil, fmt.Errorf("%s is not a plan saved by the simulated %s", args[len(args)-1], f.tool)
+	}
+	return &plan, nil
+}
+
+// show renders a saved plan as JSON (show -json tfplan)
+func (f *fakeTerraform) show(args []string) int {
+	plan, err := f.readPlan(args)
+	if err != nil {
+		return f.diagnostic("Failed to read the given file as a plan", err.Error())
+	}
+	type change struct {
+		Actions []string `json:"actions"`
+	}
+	type resourceChange struct {
+		Address string `json:"address"`
+		Mode    string `json:"mode"`
+		Type    string `json:"type"`
+		Name    string `json:"name"`
+		Change  change `json:"change"`
+	}
+	doc := struct {
+		FormatVersion    string            `json:"format_version"`
+		TerraformVersion string            `json:"terraform_version"`
+		ResourceChanges  []resourceChange  `json:"resource_changes"`
+		OutputChanges    map[string]change `json:"output_changes,omitempty"`
+	}{FormatVersion: "1.2", TerraformVersion: simulatedVersion, ResourceChanges: []resourceChange{}}
+	for _, c := range plan.Changes {
+		doc.ResourceChanges = append(doc.ResourceChanges, resourceChange{
+			Address: c.Address, Mode: "managed", Type: c.Type, Name: c.Name, Change: change{Actions: []string{c.Action}},
+		})
+	}
+	for _, name := range plan.Outputs {
+		if doc.OutputChanges == nil {
+			doc.OutputChanges = map[string]change{}
+		}
+		doc.OutputChanges[name] = change{Actions: []string{"create"}}
+	}
+	out, _ := json.Marshal(doc)
+	fmt.Println(string(out))
+	return 0
+}
+
+// apply applies a saved plan, printing machine-readable UI events (apply -json tfplan)
+func (f *fakeTerraform) apply(args []string) int {
+	if f.fail == "stale" {
+		return f.diagnostic("Saved plan is stale", "The given plan file can no longer be applied because the state was changed by another operation after the plan was created.")
+	}
+	plan, err := f.readPlan(args)
+	if err != nil {
+		return f.diagnostic("Failed to load the plan", err.Error())
+	}
+
+	emit := func(event map[string]interface{}) {
+		if event["@level"] == nil {
+			event["@level"] = "info"
+		}
+		event["@module"] = "terraform.ui"
+		event["@timestamp"] = time.Now().Format(time.RFC3339Nano)
+		out, _ := json.Marshal(event)
+		time.Sleep(f.delay)
+		fmt.Println(string(out))
+	}
+	emit(map[string]interface{}{"@message": f.tool + " " + simulatedVersion + " (simulated)", "type": "version"})
+
+	added, destroyed := 0, 0
+	for i, c := range plan.Changes {
+		hook := map[string]interface{}{
+			"resource": map[string]string{"addr": c.Address, "resource_type": c.Type, "resource_name": c.Name},
+			"action":   c.Action,
+		}
+		progress, noun := "Creating...", "Creation"
+		if c.Action == "delete" {
+			progress, noun = "Destroying...", "Destruction"
+		}
+		emit(map[string]interface{}{"@message": c.Address + ": " + progress, "type": "apply_start", "hook": hook})
+
+		// The last resource fails when apply should fail, after the others succeeded
+		if f.fail == "apply" && i == len(plan.Changes)-1 {
+			emit(map[string]interface{}{"@message": c.Address + ": " + noun + " errored after 1s", "type": "apply_errored", "hook": hook})
+			emit(map[string]interface{}{
+				"@level":     "error",
+				"@message":   "Error: Simulated failure",
+				"type":       "diagnostic",
+				"diagnostic": map[string]string{"severity": "error", "summary": "Simulated failure", "detail": "SIMULATE_FAIL=apply made this resource fail.", "address": c.Address},
+			})
+			return 1
+		}
+
+		hook["id_value"] = fakeID(c.Address)
+		hook["elapsed_seconds"] = 1
+		message := fmt.Sprintf("%s: %s complete after 1s [id=%s]", c.Address, noun, fakeID(c.Address))
+		if c.Action == "delete" {
+			destroyed++
+			delete(hook, "id_value")
+			message = fmt.Sprintf("%s: %s complete after 1s", c.Address, noun)
+		} else {
+			added++
+		}
+		emit(map[string]interface{}{"@message": message, "type": "apply_complete", "hook": hook})
+	}
+
+	operation := "apply"
+	summary := fmt.Sprintf("Apply complete! Resources: %d added, 0 changed, %d destroyed.", added, destroyed)
+	if plan.Destroy {
+		operation = "destroy"
+		summary = fmt.Sprintf("Destroy complete! Resources: %d destroyed.", destroyed)
+	}
+	emit(map[string]interface{}{
+		"@message": summary,
+		"type":     "change_summary",
+		"changes":  map[string]interface{}{"add": added, "change": 0, "remove": destroyed, "operation": operation},
+	})
+	if len(plan.Outputs) > 0 {
+		emit(map[string]interface{}{"@message": "Outputs: " + fmt.Sprint(len(plan.Outputs)), "type": "outputs", "outputs": fakeOutputs(plan.Outputs)})
+	}
+	return 0
+}
+
+// output prints the configuration's outputs (output -json)
+func (f *fakeTerraform) output() int {
+	_, outputs := f.config()
+	out, _ := json.Marshal(fakeOutputs(outputs))
+	fmt.Println(string(out))
+	return 0
+}
+
+// state handles state list, rm and mv
+func (f *fakeTerraform) state(args []string) int {
+	if len(args) == 0 {
+		return f.diagnostic("Missing state subcommand", "Use state list, rm or mv.")
+	}
+	switch args[0] {
+	case "list":
+		resources, _ := f.config()
+		for _, r := range resources {
+			fmt.Println(r.Address)
+		}
+	case "rm":
+		removed := 0
+		for _, address := range args[1:] {
+			if !strings.HasPrefix(address, "-") {
+				f.say("Removed " + address)
+				removed++
+			}
+		}
+		f.say(fmt.Sprintf("Successfully removed %d resource instance(s).", removed))
+	case "mv":
+		if len(args) >= 3 {
+			f.say(fmt.Sprintf("Move %q to %q", args[len(args)-2], args[len(args)-1]))
+		}
+		f.say("Successfully moved 1 object(s).")
+	default:
+		f.say(fmt.Sprintf("(simulated) state %s: nothing to do", args[0]))
+	}
+	return 0
+}
+
+// fakeID is a stable resource ID for an address
+func fakeID(address string) string {
+	var h uint32 = 2166136261
+	for i := 0; i < len(address); i++ {
+		h = (h ^ uint32(address[i])) * 16777619
+	}
+	return fmt.Sprintf("sim-%08x", h)
+}
+
+// fakeOutputs are the values of simulated outputs, as output -json prints them
+func fakeOutputs(names []string) map[string]interface{} {
+	outputs := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		outputs[name] = map[string]interface{}{"sensitive": false, "type": "string", "value": "simulated-" + name}
+	}
+	return outputs
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// terraformPlugin runs terraform, tofu and terragrunt. The binary comes from toolName;
+// the plan is saved as tfplan in the deployment path and applied as is.
+type terraformPlugin struct{}
+
+// Prepare runs init and selects (or creates) the CLI workspace
+func (terraformPlugin) Prepare(d *Deployment, deployPath string) error {
+	d.log("Running terraform init...")
+
+	// Parse custom init flags
+	initArgs, err := parseToolFlags("init_flags", d.Request.InitFlags, d.Request.Path, initFlags)
+	if err != nil {
+		return err
+	}
+	if d.Request.InitFlags != "" {
+		d.log(fmt.Sprintf("Using custom init flags: %s", d.Request.InitFlags))
+	}
+
+	initLog, err := runTerraformCommand(d, deployPath, "init", initArgs)
+	d.Status.InitLog = initLog
+	if err != nil {
+		return fmt.Errorf("Init failed: %v", err)
+	}
+
+	// Select (or create) the CLI workspace
+	if d.Request.Workspace != "" {
+		d.log(fmt.Sprintf("Selecting workspace: %s", d.Request.Workspace))
+		workspaceLog, err := runTerraformCommand(d, deployPath, "workspace", []string{"select", "-or-create", d.Request.Workspace})
+		d.Status.InitLog += workspaceLog
+		if err != nil {
+			return fmt.Errorf("Workspace select failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// Validate runs validate
+func (terraformPlugin) Validate(d *Deployment, deployPath string) error {
+	d.log("Running terraform validate...")
+	if _, err := runTerraformCommand(d, deployPath, "validate", nil); err != nil {
+		return fmt.Errorf("Validate failed: %v", err)
+	}
+	return nil
+}
+
+// Preview saves the plan as tfplan and renders it as JSON
+func (terraformPlugin) Preview(d *Deployment, deployPath string) error {
+	d.log("Running terraform plan...")
+	planArgs := []string{"-out=tfplan"}
+	if d.Request.Destroy {
+		planArgs = append(planArgs, "-destroy")
+		d.log("Planning destruction of all managed resources")
+	}
+
+	// Add custom plan flags
+	customFlags, err := parseToolFlags("plan_flags", d.Request.PlanFlags, d.Request.Path, planFlags)
+	if err != nil {
+		return err
+	}
+	if d.Request.PlanFlags != "" {
+		planArgs = append(planArgs, customFlags...)
+		d.log(fmt.Sprintf("Using custom plan flags: %s", d.Request.PlanFlags))
+	}
+
+	// Add tfvars files
+	for _, tfvarsFile := range d.Request.TfvarsFiles {
+		planArgs = append(planArgs, "-var-file="+tfvarsFile)
+		d.log(fmt.Sprintf("Using tfvars file: %s", tfvarsFile))
+	}
+	planLog, err := runTerraformCommand(d, deployPath, "plan", planArgs)
+	d.Status.PlanLog = planLog
+	if err != nil {
+		return fmt.Errorf("Plan failed: %v", err)
+	}
+
+	// Machine-readable plan for the change summary shown on approval and for policy checks
+	if plan, err := capturePlanJSON(d, deployPath); err != nil {
+		d.log(fmt.Sprintf("Warning: Failed to render plan as JSON: %v", err))
+	} else {
+		d.setPlanJSON(plan)
+	}
+	return nil
+}
+
+// Execute applies tfplan, recording the result of every resource
+func (terraformPlugin) Execute(d *Deployment, deployPath string) error {
+	d.log("Running terraform apply...")
+	report := newApplyReport()
+	applyLog, err := runTerraformCommandWithHandler(d, deployPath, "apply", []string{"-json", "tfplan"}, func(line string) string {
+		message := report.handleLine(line)
+		d.setApplyReport(report.results())
+		return message
+	})
+	d.Status.ApplyLog = applyLog
+	d.setApplyReport(report.results())
+	if err != nil {
+		// The state changed after planning (e.g. another run applied), so the saved plan cannot be used
+		if strings.Contains(applyLog, "Saved plan is stale") {
+			return &stageStop{status: "stale", message: "Saved plan is stale: the state changed after the plan was created; re-plan required"}
+		}
+		return fmt.Errorf("Apply failed: %v", err)
+	}
+	return nil
+}
+
+// Outputs reads the outputs as JSON; a configuration without outputs is not an error
+func (terraformPlugin) Outputs(d *Deployment, deployPath string) error {
+	d.log("Retrieving outputs...")
+	outputLog, err := runTerraformCommand(d, deployPath, "output", []string{"-json"})
+	if err != nil {
+		// Non-fatal if there are no outputs
+		d.log("No outputs available")
+	} else {
+		d.Status.ApplyOutput = outputLog
+	}
+	return nil
+}
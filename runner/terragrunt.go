@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TerragruntOptions configures runs with tool "terragrunt"
+type TerragruntOptions struct {
+	RunAll   bool   `json:"run_all"`   // Run every command with run-all across all units below Path
+	TFBinary string `json:"tf_binary"` // Binary terragrunt wraps: "terraform" (default) or "tofu"
+}
+
+// validTool reports whether the runner has a plugin for the requested tool, or the tool
+// is detected after the clone ("auto"), and its options are valid
+func validTool(req DeploymentRequest) error {
+	if req.Tool != "auto" {
+		if _, err := pluginFor(req); err != nil {
+			return err
+		}
+	}
+	if req.ToolVersion != "" {
+		if _, ok := parseToolVersion(req.ToolVersion); !ok {
+			return fmt.Errorf("tool_version must be a version such as 1.9.5")
+		}
+	}
+	if req.Tool == "terragrunt" && req.Terragrunt != nil && req.Terragrunt.TFBinary != "" &&
+		req.Terragrunt.TFBinary != "terraform" && req.Terragrunt.TFBinary != "tofu" {
+		return fmt.Errorf("terragrunt tf_binary must be 'terraform' or 'tofu'")
+	}
+	return nil
+}
+
+// runAll reports whether commands run in every terragrunt unit below the deployment path
+func runAll(req DeploymentRequest) bool {
+	return req.Tool == "terragrunt" && req.Terragrunt != nil && req.Terragrunt.RunAll
+}
+
+// toolArgs prefixes a terraform command with run-all for terragrunt run-all deployments
+func toolArgs(req DeploymentRequest, command string, args ...string) []string {
+	cmdArgs := append([]string{command}, args...)
+	if runAll(req) {
+		cmdArgs = append([]string{"run-all"}, cmdArgs...)
+	}
+	return cmdArgs
+}
+
+// terragruntEnv returns the environment terragrunt runs with: the runner's own
+// TERRAGRUNT_* settings (which containers would not inherit otherwise), then the wrapped
+// binary and non-interactive mode. The deployment's environment variables are appended
+// after these and take precedence.
+func terragruntEnv(req DeploymentRequest) []string {
+	if req.Tool != "terragrunt" {
+		return nil
+	}
+
+	var env []string
+	for _, e := range os.Environ() {
+		if strings.HasPrefix(e, "TERRAGRUNT_") {
+			env = append(env, e)
+		}
+	}
+
+	tfBinary := "terraform"
+	if req.Terragrunt != nil && req.Terragrunt.TFBinary != "" {
+		tfBinary = req.Terragrunt.TFBinary
+	}
+	return append(env, "TERRAGRUNT_TFPATH="+tfBinary, "TERRAGRUNT_NON_INTERACTIVE=true")
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Tool and version selection. A request with tool "auto" runs the tool the repository is
+// written for: terragrunt when the run path has a terragrunt.hcl, tofu when it has .tofu
+// files or an .opentofu-version, terraform when it has a .terraform-version, otherwise
+// whichever of terraform and tofu (in that order) has an installed version satisfying the
+// configuration's required_version. For terraform and tofu the version is then chosen
+// among the installed ones: the one in PATH plus RUNNER_TOOLS_DIR/<tool>/<version>/<tool>
+// (default /opt/iac-tools). A pinned tool_version must be installed; otherwise the newest
+// version satisfying every required_version runs, or the one a version file names when it
+// is installed. Runs in a custom image use the image's tools as they are.
+
+// defaultToolsDir is where additional tool versions are installed
+const defaultToolsDir = "/opt/iac-tools"
+
+// versionFiles are the tfenv/tofuenv version files, by tool
+var versionFiles = map[string]string{
+	"terraform": ".terraform-version",
+	"tofu":      ".opentofu-version",
+}
+
+// requiredVersionPattern matches required_version in a terraform block
+var requiredVersionPattern = regexp.MustCompile(`(?m)^\s*required_version\s*=\s*"([^"]*)"`)
+
+// installedTool is one installed version of terraform or tofu
+type installedTool struct {
+	version string
+	path    string
+}
+
+// toolsDir returns the directory holding additional tool versions
+func toolsDir() string {
+	if dir := os.Getenv("RUNNER_TOOLS_DIR"); dir != "" {
+		return dir
+	}
+	return defaultToolsDir
+}
+
+// installedVersions lists the installed versions of tool, newest first
+func installedVersions(tool string) []installedTool {
+	var installed []installedTool
+	if capability := checkTool(tool, toolVersion(tool)); capability.Installed {
+		installed = append(installed, installedTool{version: capability.Version, path: capability.Path})
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(toolsDir(), tool))
+	for _, entry := range entries {
+		if _, ok := parseToolVersion(entry.Name()); !ok {
+			continue
+		}
+		path := filepath.Join(toolsDir(), tool, entry.Name(), tool)
+		if info, err := os.Stat(path); err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+			continue
+		}
+		duplicate := false
+		for _, t := range installed {
+			duplicate = duplicate || t.version == entry.Name()
+		}
+		if !duplicate {
+			installed = append(installed, installedTool{version: entry.Name(), path: path})
+		}
+	}
+
+	sort.SliceStable(installed, func(i, j int) bool {
+		return compareToolVersions(installed[i].version, installed[j].version) > 0
+	})
+	return installed
+}
+
+// parsedVersion is a major.minor.patch version with an optional pre-release
+type parsedVersion struct {
+	parts [3]int
+	pre   string
+}
+
+// parseToolVersion parses a version such as "1.9.5", "v1.6.0-rc1" or "1.5"
+func parseToolVersion(s string) (parsedVersion, bool) {
+	var v parsedVersion
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	core, pre, _ := strings.Cut(s, "-")
+	v.pre = pre
+	segments := strings.Split(core, ".")
+	if len(segments) > 3 || segments[0] == "" {
+		return v, false
+	}
+	for i, segment := range segments {
+		n, err := strconv.Atoi(segment)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v.parts[i] = n
+	}
+	return v, true
+}
+
+func (v parsedVersion) compare(o parsedVersion) int {
+	for i := range v.parts {
+		if v.parts[i] != o.parts[i] {
+			if v.parts[i] < o.parts[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.pre == o.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case o.pre == "":
+		return -1
+	case v.pre < o.pre:
+		return -1
+	}
+	return 1
+}
+
+// compareToolVersions orders two versions; unparsable versions sort last
+func compareToolVersions(a, b string) int {
+	va, okA := parseToolVersion(a)
+	vb, okB := parseToolVersion(b)
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+	return va.compare(vb)
+}
+
+// versionSatisfies reports whether version satisfies a terraform version constraint such
+// as ">= 1.5, < 2.0" or "~> 1.6". Pre-releases only match an exact "=".
+func versionSatisfies(version, constraint string) (bool, error) {
+	v, ok := parseToolVersion(version)
+	if !ok {
+		return false, nil
+	}
+	for _, condition := range strings.Split(constraint, ",") {
+		condition = strings.TrimSpace(condition)
+		op := "="
+		for _, candidate := range []string{"~>", ">=", "<=", "!=", ">", "<", "="} {
+			if strings.HasPrefix(condition, candidate) {
+				op = candidate
+				condition = strings.TrimSpace(strings.TrimPrefix(condition, candidate))
+				break
+			}
+		}
+		c, ok := parseToolVersion(condition)
+		if !ok {
+			return false, fmt.Errorf("invalid required_version %q", constraint)
+		}
+		if v.pre != "" && (op != "=" || v.compare(c) != 0) {
+			return false, nil
+		}
+
+		cmp := v.compare(c)
+		switch op {
+		case "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case "~>":
+			// ~> 1.6 allows 1.x from 1.6; ~> 1.6.2 allows 1.6.x from 1.6.2
+			upper := c
+			upper.pre = ""
+			i := len(strings.Split(strings.SplitN(condition, "-", 2)[0], ".")) - 2
+			if i < 0 {
+				i = 0
+			}
+			upper.parts[i]++
+			for j := i + 1; j < len(upper.parts); j++ {
+				upper.parts[j] = 0
+			}
+			ok = cmp >= 0 && v.compare(upper) < 0
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// requiredVersions returns the required_version constraints of the configuration in dir
+func requiredVersions(dir string) []string {
+	var constraints []string
+	for _, pattern := range []string{"*.tf", "*.tofu"} {
+		files, _ := filepath.Glob(filepath.Join(dir, pattern))
+		for _, file := range files {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				continue
+			}
+			for _, match := range requiredVersionPattern.FindAllStringSubmatch(string(content), -1) {
+				constraints = append(constraints, match[1])
+			}
+		}
+	}
+	return constraints
+}
+
+// readVersionFile returns the content and path of the closest version file of tool, looking
+// in deployPath and its parents up to the root of the clone
+func readVersionFile(d *Deployment, deployPath, tool string) (string, string) {
+	name, ok := versionFiles[tool]
+	if !ok {
+		return "", ""
+	}
+	root := filepath.Clean(d.WorkDir)
+	for dir := filepath.Clean(deployPath); ; dir = filepath.Dir(dir) {
+		if content, err := os.ReadFile(filepath.Join(dir, name)); err == nil {
+			value, _, _ := strings.Cut(strings.TrimSpace(string(content)), "\n")
+			rel, _ := filepath.Rel(root, filepath.Join(dir, name))
+			return strings.TrimSpace(value), rel
+		}
+		if dir == root || !strings.HasPrefix(dir, root) {
+			return "", ""
+		}
+	}
+}
+
+// detectTool picks the tool of a run with tool "auto"
+func detectTool(d *Deployment, deployPath string, constraints []string) (string, error) {
+	if _, err := os.Stat(filepath.Join(deployPath, "terragrunt.hcl")); err == nil {
+		d.log("Tool: terragrunt (terragrunt.hcl)")
+		return "terragrunt", nil
+	}
+	if files, _ := filepath.Glob(filepath.Join(deployPath, "*.tofu")); len(files) > 0 {
+		d.log("Tool: tofu (.tofu files)")
+		return "tofu", nil
+	}
+	for _, tool := range []string{"tofu", "terraform"} {
+		if _, file := readVersionFile(d, deployPath, tool); file != "" {
+			d.log(fmt.Sprintf("Tool: %s (%s)", tool, file))
+			return tool, nil
+		}
+	}
+
+	for _, tool := range []string{"terraform", "tofu"} {
+		if _, err := selectVersion(tool, constraints, "", false); err == nil {
+			d.log(fmt.Sprintf("Tool: %s (first with an installed version satisfying required_version)", tool))
+			return tool, nil
+		}
+	}
+	return "", fmt.Errorf("no installed terraform or tofu satisfies required_version %s (installed: %s)",
+		strings.Join(quoteAll(constraints), ", "), describeInstalled("terraform", "tofu"))
+}
+
+// selectVersion returns the newest installed version of tool satisfying every constraint,
+// or exactly version when set; oldest instead of newest picks the lowest satisfying one
+func selectVersion(tool string, constraints []string, version string, oldest bool) (installedTool, error) {
+	installed := installedVersions(tool)
+	if oldest {
+		for i, j := 0, len(installed)-1; i < j; i, j = i+1, j-1 {
+			installed[i], installed[j] = installed[j], installed[i]
+		}
+	}
+	for _, candidate := range installed {
+		if version != "" && compareToolVersions(candidate.version, version) != 0 {
+			continue
+		}
+		satisfied := true
+		for _, constraint := range constraints {
+			ok, err := versionSatisfies(candidate.version, constraint)
+			if err != nil {
+				return installedTool{}, err
+			}
+			satisfied = satisfied && ok
+		}
+		if satisfied {
+			return candidate, nil
+		}
+	}
+	switch {
+	case len(installed) == 0:
+		return installedTool{}, fmt.Errorf("%s is not installed on this runner", tool)
+	case version != "":
+		return installedTool{}, fmt.Errorf("%s %s is not installed on this runner, or does not satisfy required_version (installed: %s)",
+			tool, version, describeInstalled(tool))
+	}
+	return installedTool{}, fmt.Errorf("no installed %s satisfies required_version %s (installed: %s)",
+		tool, strings.Join(quoteAll(constraints), ", "), describeInstalled(tool))
+}
+
+// describeInstalled lists the installed versions of tools for error messages
+func describeInstalled(tools ...string) string {
+	var versions []string
+	for _, tool := range tools {
+		for _, t := range installedVersions(tool) {
+			versions = append(versions, tool+" "+t.version)
+		}
+	}
+	if len(versions) == 0 {
+		return "none"
+	}
+	return strings.Join(versions, ", ")
+}
+
+func quoteAll(values []string) []string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	return quoted
+}
+
+// resolveTool settles the tool and version a deployment runs with, after the clone. It
+// replaces tool "auto" in the request and points toolName at the chosen binary.
+func resolveTool(d *Deployment, deployPath string) error {
+	constraints := requiredVersions(deployPath)
+	if d.Request.Tool == "auto" {
+		tool, err := detectTool(d, deployPath, constraints)
+		if err != nil {
+			return err
+		}
+		d.Request.Tool = tool
+	}
+	tool := d.Request.Tool
+	if d.Request.Image != "" || (tool != "terraform" && tool != "tofu") {
+		d.setTool(tool, "")
+		return nil
+	}
+
+	version, oldest := d.Request.ToolVersion, false
+	if version == "" {
+		if value, file := readVersionFile(d, deployPath, tool); file != "" {
+			switch {
+			case value == "min-required":
+				oldest = true
+			case value == "" || value == "latest" || strings.HasPrefix(value, "latest:"):
+			default:
+				if _, err := selectVersion(tool, constraints, value, false); err == nil {
+					version = value
+				} else {
+					d.log(fmt.Sprintf("Warning: %s asks for %s %s, which is not installed or does not satisfy required_version; choosing by required_version", file, tool, value))
+				}
+			}
+		}
+	}
+
+	selected, err := selectVersion(tool, constraints, version, oldest)
+	if err != nil {
+		return err
+	}
+	d.Request.toolPath = selected.path
+	d.setTool(tool, selected.version)
+	d.log(fmt.Sprintf("Using %s %s (%s)", tool, selected.version, selected.path))
+	return nil
+}
+
+// setTool records the tool and version the deployment runs with in its status
+func (d *Deployment) setTool(tool, version string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Status.Tool = tool
+	d.Status.ToolVersion = version
+}
@@ -0,0 +1,229 @@
+// Package cors implements the CORS policies of the backend and the runner. Origins are
+// matched strictly (scheme, host and port), credentials are only allowed for listed
+// origins, and policies can differ per route prefix.
+package cors
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Policy is the CORS policy of a group of routes
+type Policy struct {
+	// AllowOrigins lists allowed origins: "https://app.example.com",
+	// "https://*.example.com" (subdomains), or "*" alone (any origin, no credentials)
+	AllowOrigins     []string
+	AllowMethods     []string
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+
+	anyOrigin bool
+	origins   map[string]bool
+	wildcards []wildcardOrigin
+}
+
+// wildcardOrigin matches subdomains of a host for one scheme and port
+type wildcardOrigin struct {
+	scheme, suffix, port string
+}
+
+// Validate checks the configured origins and prepares the policy for matching
+func (p *Policy) Validate() error {
+	p.origins = map[string]bool{}
+	p.wildcards = nil
+	p.anyOrigin = false
+
+	for _, origin := range p.AllowOrigins {
+		if origin == "*" {
+			if len(p.AllowOrigins) > 1 {
+				return fmt.Errorf("origin \"*\" cannot be combined with specific origins")
+			}
+			if p.AllowCredentials {
+				return fmt.Errorf("origin \"*\" cannot be used with credentials")
+			}
+			p.anyOrigin = true
+			continue
+		}
+
+		u, err := parseOrigin(strings.Replace(origin, "://*.", "://wildcard.", 1))
+		if err != nil {
+			return fmt.Errorf("invalid origin %q: %v", origin, err)
+		}
+		if strings.Contains(origin, "://*.") {
+			p.wildcards = append(p.wildcards, wildcardOrigin{
+				scheme: u.Scheme,
+				suffix: strings.TrimPrefix(u.Hostname(), "wildcard"),
+				port:   u.Port(),
+			})
+			continue
+		}
+		p.origins[u.Scheme+"://"+u.Host] = true
+	}
+	return nil
+}
+
+// parseOrigin parses an origin: a scheme and host, with an optional port and nothing else
+func parseOrigin(origin string) (*url.URL, error) {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("scheme must be http or https")
+	}
+	if u.Host == "" || u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("origin must be scheme://host[:port]")
+	}
+	if strings.Contains(u.Hostname(), "*") {
+		return nil, fmt.Errorf("wildcards are only allowed as the first label")
+	}
+	u.Host = strings.ToLower(u.Host)
+	return u, nil
+}
+
+// Allows reports whether a request Origin header matches the policy
+func (p *Policy) Allows(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	u, err := parseOrigin(origin)
+	if err != nil || u.Path != "" {
+		return false
+	}
+	if p.origins[u.Scheme+"://"+u.Host] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		host := u.Hostname()
+		if u.Scheme == w.scheme && u.Port() == w.port && strings.HasSuffix(host, w.suffix) && len(host) > len(w.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Route applies a policy to every path under a prefix. A nil policy disables CORS there:
+// browsers get no CORS headers and preflights are rejected.
+type Route struct {
+	Prefix string
+	Policy *Policy
+}
+
+// Middleware applies the policy of the longest matching route prefix, or the default
+func Middleware(defaultPolicy *Policy, routes ...Route) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy := defaultPolicy
+		matched := -1
+		for _, route := range routes {
+			if strings.HasPrefix(c.Request.URL.Path, route.Prefix) && len(route.Prefix) > matched {
+				policy, matched = route.Policy, len(route.Prefix)
+			}
+		}
+		handle(c, policy)
+	}
+}
+
+func handle(c *gin.Context, p *Policy) {
+	origin := c.Request.Header.Get("Origin")
+	preflight := c.Request.Method == "OPTIONS" && c.Request.Header.Get("Access-Control-Request-Method") != ""
+	if origin == "" {
+		c.Next()
+		return
+	}
+
+	header := c.Writer.Header()
+	header.Add("Vary", "Origin")
+	if p == nil || !p.Allows(origin) {
+		if preflight {
+			c.AbortWithStatusJSON(403, gin.H{"error": "Origin not allowed"})
+			return
+		}
+		// The browser blocks the response without CORS headers
+		c.Next()
+		return
+	}
+
+	if p.anyOrigin {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if !preflight {
+		if len(p.ExposeHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(p.ExposeHeaders, ", "))
+		}
+		c.Next()
+		return
+	}
+
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	if !containsFold(p.AllowMethods, c.Request.Header.Get("Access-Control-Request-Method")) {
+		c.AbortWithStatusJSON(403, gin.H{"error": "Method not allowed by CORS policy"})
+		return
+	}
+	for _, h := range strings.Split(c.Request.Header.Get("Access-Control-Request-Headers"), ",") {
+		if h = strings.TrimSpace(h); h != "" && !containsFold(p.AllowHeaders, h) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "Header " + h + " not allowed by CORS policy"})
+			return
+		}
+	}
+	header.Set("Access-Control-Allow-Methods", strings.Join(p.AllowMethods, ", "))
+	header.Set("Access-Control-Allow-Headers", strings.Join(p.AllowHeaders, ", "))
+	if p.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+	}
+	c.AbortWithStatus(204)
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromEnv builds a policy from ALLOWED_ORIGINS (comma-separated, defaultOrigins when
+// unset), CORS_ALLOW_CREDENTIALS and CORS_MAX_AGE, and validates it
+func FromEnv(defaultOrigins, methods, headers []string) (*Policy, error) {
+	policy := &Policy{
+		AllowOrigins:     defaultOrigins,
+		AllowMethods:     methods,
+		AllowHeaders:     headers,
+		AllowCredentials: os.Getenv("CORS_ALLOW_CREDENTIALS") == "true",
+		MaxAge:           10 * time.Minute,
+	}
+	if origins := os.Getenv("ALLOWED_ORIGINS"); origins != "" {
+		policy.AllowOrigins = nil
+		for _, origin := range strings.Split(origins, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				policy.AllowOrigins = append(policy.AllowOrigins, origin)
+			}
+		}
+	}
+	if maxAge := os.Getenv("CORS_MAX_AGE"); maxAge != "" {
+		d, err := time.ParseDuration(maxAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CORS_MAX_AGE %q", maxAge)
+		}
+		policy.MaxAge = d
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}